@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"tab-sync-backend-refactor/pkg/config"
@@ -15,27 +17,55 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+const (
+	// requestTimeout 请求总时限（vercel.json 中 maxDuration 为 30s，留5秒缓冲）
+	requestTimeout = 25 * time.Second
+	// responseReserve 从总时限中预留给写出错误响应的时间
+	responseReserve = 2 * time.Second
+
+	// defaultBodyLimit API 请求体默认上限；快照路由使用 MAX_SNAPSHOT_BYTES
+	defaultBodyLimit = 1 << 20
+	// importBodyLimit 批量导入（集合条目 batch、浏览器历史）的请求体上限
+	importBodyLimit = 10 << 20
+)
+
 // Handler 是Vercel函数的入口点
 // 这个函数实现了"单体路由模式"，将所有API端点集中在一个Chi路由器中管理
 func Handler(w http.ResponseWriter, r *http.Request) {
 	// 加载配置
 	cfg := config.GetCached()
 
-	// 验证配置
-	if err := cfg.Validate(); err != nil {
-		utils.WriteInternalServerErrorResponse(w, "Configuration error: "+err.Error())
+	// 验证配置（每个冷启动只执行一次）；/readyz 仍然可用，便于查看具体问题
+	if err := config.ValidateCached(); err != nil {
+		if r.URL.Path == "/readyz" {
+			writeReadiness(w, err, nil)
+			return
+		}
+		utils.WriteAppError(w, utils.ErrInternal.Wrap(err).WithMessage("Configuration error"))
 		return
 	}
 
-	// 获取优化的数据库连接（自动适配Vercel环境）
-    db := database.GetOptimizedDatabase(database.DatabaseConfig{
-        PostgresDSN: cfg.PostgresDSN,
-        SupabaseURL: cfg.SupabaseURL,
-        SupabaseKey: cfg.SupabaseKey,
-        Debug:       cfg.Debug,
-    })
-	// 注意：连接由优化器管理，无需手动关闭
+	// 路由器不持有数据库连接：需要数据库的路由组通过 middleware.Database 按需获取
+	getRouter(cfg).ServeHTTP(w, r)
+}
+
+var (
+	routerOnce   sync.Once
+	cachedRouter *chi.Mux
+)
+
+// getRouter 返回进程级缓存的路由器。
+// 与 config.GetCached 一样，每个冷启动只构建一次，热调用直接复用，
+// 避免每个请求重新创建路由树、中间件链和处理器。
+func getRouter(cfg *config.Config) *chi.Mux {
+	routerOnce.Do(func() {
+		cachedRouter = newRouter(cfg)
+	})
+	return cachedRouter
+}
 
+// newRouter 根据配置构建完整的Chi路由器（不依赖任何请求级状态）
+func newRouter(cfg *config.Config) *chi.Mux {
 	// 创建Chi路由器
 	router := chi.NewRouter()
 
@@ -43,31 +73,47 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	setupMiddleware(router, cfg)
 
 	// 设置路由
-	setupRoutes(router, cfg, db)
+	setupRoutes(router, cfg)
 
-	// 将请求传递给Chi路由器处理
-	router.ServeHTTP(w, r)
+	return router
 }
 
 // setupMiddleware 设置全局中间件
 func setupMiddleware(router *chi.Mux, cfg *config.Config) {
+	// 追踪（OTEL_EXPORTER_OTLP_ENDPOINT 未配置时为空操作），放在最外层以覆盖整个请求
+	router.Use(customMiddleware.Tracing(cfg))
+
 	// 基础中间件
-	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	router.Use(customMiddleware.RequestID) // 请求 ID 写入 X-Request-ID 响应头、错误响应与日志
+	// 客户端 IP：只从 TRUSTED_PROXIES 中的代理接受 X-Forwarded-For / X-Real-IP
+	router.Use(customMiddleware.TrustedProxies(cfg))
 	// Normalize path and restore scheme/host before logging and routing
 	router.Use(customMiddleware.Normalize())
 	router.Use(customMiddleware.Logger(cfg))
-	router.Use(middleware.Recoverer)
+	router.Use(customMiddleware.Recovery(cfg)) // panic 返回带 request_id 的 JSON 500 并上报
 
-	// CORS中间件
-	router.Use(customMiddleware.CORS(cfg))
+	// CORS中间件：应用 API 使用带凭据的严格来源策略，个别路由前缀单独指定
+	router.Use(customMiddleware.CORS(cfg, map[string]customMiddleware.CORSPolicy{
+		"/api/oauth/":     customMiddleware.CORSPublic, // 浏览器跳转的回调页，不读写凭据
+		"/api/webhooks/":  customMiddleware.CORSNone,   // 服务端回调，不需要跨域
+		"/api/cron/":      customMiddleware.CORSNone,   // 定时任务，仅由 Vercel Cron 调用
+		"/api/email/":     customMiddleware.CORSNone,   // 邮件中的链接与邮件客户端回调
+		"/api/downloads/": customMiddleware.CORSNone,   // 签名下载链接，浏览器直接打开
+		"/api/admin/":     customMiddleware.CORSNone,   // 运维管理 API，仅服务端调用
+	}))
 
-	// 超时中间件（Vercel函数有时间限制）
-	router.Use(middleware.Timeout(25 * time.Second)) // 留5秒缓冲
+	// 超时中间件（Vercel函数有时间限制）：出站调用的截止时间从请求上下文派生
+	router.Use(customMiddleware.Timeout(requestTimeout, responseReserve))
 
 	// 压缩中间件
 	router.Use(middleware.Compress(5))
 
+	// 错误上报（SENTRY_DSN 未配置时为空操作）
+	router.Use(customMiddleware.ErrorReporting(cfg))
+
+	// 读己之写：回传 X-Consistency-Token 的请求绕过只读副本，有写入的请求下发新令牌
+	router.Use(customMiddleware.Consistency)
+
 	// 开发环境额外中间件
 	if cfg.IsDevelopment() {
 		router.Use(middleware.Heartbeat("/ping"))
@@ -75,15 +121,33 @@ func setupMiddleware(router *chi.Mux, cfg *config.Config) {
 }
 
 // setupRoutes 设置所有API路由
-func setupRoutes(router *chi.Mux, cfg *config.Config, db database.DatabaseInterface) {
-	// 创建处理器
-	authHandler := handlers.NewAuthHandler(cfg, db)
-	snapshotHandler := handlers.NewSnapshotHandler(cfg, db)
-	webhookHandler := handlers.NewWebhookHandler(cfg, db)
-	collectionsHandler := handlers.NewCollectionsHandler(cfg, db)
-
-	// 健康检查端点
-	router.Get("/", authHandler.HealthCheck)
+func setupRoutes(router *chi.Mux, cfg *config.Config) {
+	// 创建处理器（数据库句柄在请求时从上下文获取）
+	authHandler := handlers.NewAuthHandler(cfg)
+	snapshotHandler := handlers.NewSnapshotHandler(cfg)
+	webhookHandler := handlers.NewWebhookHandler(cfg)
+	collectionsHandler := handlers.NewCollectionsHandler(cfg)
+	orgsHandler := handlers.NewOrgsHandler(cfg)
+	subscriptionHandler := handlers.NewSubscriptionHandler(cfg)
+	promoHandler := handlers.NewPromoHandler(cfg)
+	exportHandler := handlers.NewExportHandler(cfg)
+	downloadsHandler := handlers.NewDownloadsHandler(cfg)
+	imageProxyHandler := handlers.NewImageProxyHandler(cfg)
+	clientHandler := handlers.NewClientHandler(cfg)
+	notificationsHandler := handlers.NewNotificationsHandler(cfg)
+	devicesHandler := handlers.NewDevicesHandler(cfg)
+	flagsHandler := handlers.NewFlagsHandler(cfg)
+	adminHandler := handlers.NewAdminHandler(cfg)
+
+	// 健康检查端点（数据库不可用时报告 degraded，而不是直接 503）
+	router.With(customMiddleware.OptionalDatabase(cfg)).Get("/", authHandler.HealthCheck)
+	router.With(customMiddleware.OptionalDatabase(cfg)).Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		dbErr := database.ErrUnavailable
+		if db := database.FromContext(r.Context()); db != nil {
+			dbErr = db.HealthCheck()
+		}
+		writeReadiness(w, nil, dbErr)
+	})
 
 	// 数据库连接池状态端点（调试用）
 	if cfg.IsDevelopment() {
@@ -127,8 +191,24 @@ func setupRoutes(router *chi.Mux, cfg *config.Config, db database.DatabaseInterf
 
 	// API路由组
 	router.Route("/api", func(r chi.Router) {
+		// DEBUG 模式下记录脱敏请求体；个别路由通过 SkipBodyLogging 关闭
+		r.Use(customMiddleware.BodyLogger(cfg))
+		// 请求体上限（路由可覆盖）
+		r.Use(customMiddleware.MaxBodySize(defaultBodyLimit))
+		// 被封禁的扩展版本返回 503 与 Retry-After（BLOCKED_CLIENT_VERSIONS / KV killswitch:client_versions）
+		r.Use(customMiddleware.ClientKillSwitch(cfg))
+
+		// 扩展版本检查（不受版本门限制，过旧的扩展据此提示更新）
+		r.Get("/client/version", clientHandler.Version)
+		// 部署启用的功能与各等级限额（扩展据此调整界面）
+		r.Get("/capabilities", clientHandler.Capabilities)
+
 		// 公开路由（不需要认证）
 		r.Route("/auth", func(r chi.Router) {
+			r.Use(customMiddleware.ClientVersion(cfg)) // X-Client-Version 低于 MIN_CLIENT_VERSION 时返回 426
+			r.Use(customMiddleware.ContentTypeJSON)
+			r.Use(customMiddleware.Database(cfg))
+
 			// 认证相关路由
 			r.Post("/register", authHandler.Register)
 			r.Post("/login", authHandler.Login)
@@ -148,18 +228,36 @@ func setupRoutes(router *chi.Mux, cfg *config.Config, db database.DatabaseInterf
 
 		// OAuth回调路由（在API路由组内）
 		r.Route("/oauth", func(r chi.Router) {
+			r.Use(customMiddleware.SkipBodyLogging)
 			r.Get("/callback", authHandler.OAuthCallback)
-			r.Get("/google/callback", authHandler.GoogleOAuthCallback)
+			// 只有 Google 回调会查找/创建用户，其余回调页面不需要数据库连接
+			r.With(customMiddleware.Database(cfg)).Get("/google/callback", authHandler.GoogleOAuthCallback)
 			r.Get("/github/callback", authHandler.GitHubOAuthCallback)
 			// 扩展专用回调路由
 			r.Get("/extension/callback", authHandler.ExtensionOAuthCallback)
 		})
 
+		// 快照分块上传：请求体为原始字节或 multipart/form-data，除 ContentTypeJSON 外与下方认证分组相同
+		r.Group(func(r chi.Router) {
+			r.Use(customMiddleware.ClientVersion(cfg))
+			r.Use(customMiddleware.AuthMiddleware(cfg))
+			r.Use(customMiddleware.Database(cfg))
+			r.Use(customMiddleware.TokenVersion)
+			r.Use(customMiddleware.OrgQuota(cfg))
+			r.Use(customMiddleware.SkipBodyLogging)
+			r.Put("/snapshot-uploads/{id}/chunks/{index}", snapshotHandler.PutSnapshotUploadChunk)
+		})
+
 		// 需要认证的路由
 		// 需要认证的路由
 		r.Group(func(r chi.Router) {
-			// 应用认证中间件
+			r.Use(customMiddleware.ClientVersion(cfg)) // 过旧的扩展返回 426，先于鉴权
+			// 应用认证中间件（先鉴权，未登录请求不会触发数据库连接）
 			r.Use(customMiddleware.AuthMiddleware(cfg))
+			r.Use(customMiddleware.ContentTypeJSON)
+			r.Use(customMiddleware.Database(cfg))
+			r.Use(customMiddleware.TokenVersion)  // 等级/组织变化后要求刷新访问令牌
+			r.Use(customMiddleware.OrgQuota(cfg)) // 组织每日 API 配额（X-Org-ID / org_id，缺省为默认组织）
 
 			// 认证相关的需要认证的路由（使用不同的路径避免冲突）
 			r.Route("/session", func(r chi.Router) {
@@ -172,30 +270,71 @@ func setupRoutes(router *chi.Mux, cfg *config.Config, db database.DatabaseInterf
 				r.Get("/profile", handleNotImplemented)
 				r.Put("/profile", handleNotImplemented)
 				r.Delete("/account", handleNotImplemented)
+				r.Post("/export", exportHandler.RequestExport) // GDPR 数据导出（异步）
+				r.Get("/export/{id}", exportHandler.GetExport) // 导出状态与签名下载链接
+
+				// 外部账户关联
+				r.Get("/identities", authHandler.ListIdentities)
+				r.Post("/identities/link", authHandler.LinkIdentity) // 以 OAuth 返回的关联令牌显式关联
+
+				// 登录记录（IP 与 GeoIP 位置），供账户安全页识别可疑登录
+				r.Get("/login-events", authHandler.ListLoginEvents)
 			})
 
+			// 功能开关（按用户/组织/等级评估）
+			r.Get("/flags", flagsHandler.GetFlags)
+			r.Get("/experiments", flagsHandler.GetExperiments)                 // 实验变体分配
+			r.Post("/experiments/{key}/exposure", flagsHandler.RecordExposure) // 记录首次曝光
+
+			// 当前用户：资料、等级、AI 积分、组织与默认组织
+			r.Get("/me", authHandler.GetMe)
+			// 当前用户在各组织的角色与各空间的有效权限（单次聚合查询）
+			r.Get("/me/permissions", orgsHandler.GetMyPermissions)
+
 			// 快照管理路由
 			// Organizations & Spaces
-            orgsHandler := handlers.NewOrgsHandler(cfg, db)
             r.Route("/orgs", func(r chi.Router) {
                 r.Get("/", orgsHandler.ListMyOrganizations)
                 r.Post("/", orgsHandler.CreateOrganization)
                 r.Put("/{id}", orgsHandler.UpdateOrganization)
+                r.Put("/{id}/slug", orgsHandler.UpdateSlug)                 // owner/admin
+                r.Get("/by-slug/{slug}", orgsHandler.GetOrganizationBySlug) // 解析 /o/{slug} 分享链接
+                r.Get("/{id}/encryption", orgsHandler.GetEncryption)
+                r.Post("/{id}/encryption", orgsHandler.EnableEncryption) // owner，启用后不可关闭
+                r.Get("/{id}/usage", orgsHandler.GetOrgUsage) // owner/admin，每日 API 用量与配额
+                r.Get("/{id}/recent", orgsHandler.GetRecentItems) // 最近加入/删除的条目（扩展首页弹窗）?limit=
+                r.Get("/{id}/web-archive", orgsHandler.GetWebArchive)
+                r.Put("/{id}/web-archive", orgsHandler.UpdateWebArchive) // owner/admin，开启后保存的 URL 提交到 Internet Archive
+                r.Get("/{id}/domain-policies", orgsHandler.ListDomainPolicies) // 成员可见
+                r.Put("/{id}/domain-policies", orgsHandler.SetDomainPolicy)   // owner/admin，{"domain","action":"block"|"warn"}
+                r.Delete("/{id}/domain-policies/{domain}", orgsHandler.DeleteDomainPolicy)
+                r.Get("/{id}/policy-violations", orgsHandler.ListPolicyViolations) // owner/admin，违规审计 ?limit=
                 r.Get("/members", orgsHandler.ListMembers) // expects ?org_id=
+                r.Delete("/members/{userID}", orgsHandler.RemoveMember) // owner；expects ?org_id=
                 r.Get("/spaces", orgsHandler.ListSpaces)   // expects ?org_id=
                 r.Post("/spaces", orgsHandler.CreateSpace)
 				r.Put("/spaces/{id}", orgsHandler.UpdateSpace)
 				r.Delete("/spaces/{id}", orgsHandler.DeleteSpace)
 				r.Post("/invite", orgsHandler.InviteMember)
 				r.Put("/spaces/permissions", orgsHandler.SetSpacePermission)
+				r.Get("/spaces/{id}/permissions", orgsHandler.ListEffectiveSpacePermissions) // 成员有效权限（共享对话框）
+				r.Get("/spaces/{id}/guests", orgsHandler.ListSpaceGuests)
+				r.Post("/spaces/{id}/guests", orgsHandler.InviteSpaceGuest) // owner/admin，按邮箱邀请外部协作者
+				r.Delete("/spaces/{id}/guests/{userID}", orgsHandler.RemoveSpaceGuest)
 			})
 
 			// Invitations
 			r.Route("/invitations", func(r chi.Router) {
 				r.Get("/my", orgsHandler.ListMyInvitations)
 				r.Post("/accept", orgsHandler.AcceptInvitation)
+				r.Post("/{id}/accept", orgsHandler.AcceptInvitationByID) // 应用内接受（邀请须指向当前用户）
 			})
 
+			// Space guest invitations
+			r.Post("/space-invitations/accept", orgsHandler.AcceptSpaceInvitation)
+			// 应用内接受（邀请须发给当前用户的邮箱）
+			r.Post("/space-invitations/{id}/accept", orgsHandler.AcceptSpaceInvitationByID)
+
 			// Collections
 			r.Route("/collections", func(r chi.Router) {
 				r.Get("/", collectionsHandler.ListCollections)           // ?space_id=
@@ -204,27 +343,84 @@ func setupRoutes(router *chi.Mux, cfg *config.Config, db database.DatabaseInterf
 				r.Delete("/{id}", collectionsHandler.DeleteCollection)   // requires ?space_id=
 			})
 
+            // 集合上下文：集合 + 空间 + 组织摘要（深链接）
+            r.Get("/collections/{id}/context", collectionsHandler.GetCollectionContext)
+
             // Collection Items
-            r.Get("/collections/{id}/items", collectionsHandler.ListItems)
+            r.Get("/collections/{id}/items", collectionsHandler.ListItems) // ?state=active（默认）|archived|all
             r.Post("/collections/{id}/items", collectionsHandler.CreateItem)
-            r.Post("/collections/{id}/items/batch", collectionsHandler.CreateItemsBatch)
+            r.With(customMiddleware.MaxBodySize(importBodyLimit)).Post("/collections/{id}/items/batch", collectionsHandler.CreateItemsBatch)
             r.Put("/collection-items/{item_id}", collectionsHandler.UpdateItem)
             r.Delete("/collection-items/{item_id}", collectionsHandler.DeleteItem)
-
+            r.Post("/collection-items/{item_id}/archive", collectionsHandler.ArchiveItem)     // 归档（不删除，默认列表不再返回）
+            r.Post("/collection-items/{item_id}/unarchive", collectionsHandler.UnarchiveItem) // 取消归档
+            r.Get("/collection-items/{item_id}/revisions", collectionsHandler.ListItemRevisions) // 修改历史（最近 50 个版本）
+            r.Post("/collection-items/{item_id}/revisions/{revision_id}/revert", collectionsHandler.RevertItem)
+            r.Put("/collection-items/{item_id}/reminder", collectionsHandler.SetItemReminder)      // {"remind_at","email"}，每人一条
+            r.Delete("/collection-items/{item_id}/reminder", collectionsHandler.ClearItemReminder)
+            r.Get("/reminders", collectionsHandler.ListReminders) // ?status=due（默认）|upcoming|all
+            r.Post("/quick-save", collectionsHandler.QuickSave) // 只需 URL：默认保存到 Inbox，元数据异步补全
+            r.Get("/inbox", collectionsHandler.GetInbox)              // 待整理条目及按域名建议的目标集合
+            r.Post("/inbox/triage", collectionsHandler.TriageInbox)   // 批量移动 / 延后
+            r.With(customMiddleware.MaxBodySize(importBodyLimit)).Post("/import/history", collectionsHandler.ImportHistory) // 分批导入浏览器历史，按访问日期分到 History 集合
+            r.Get("/import/history/{id}", collectionsHandler.GetHistoryImport) // 导入进度
+
+			// 快照结构上限（不放在 /snapshots 下，避免遮蔽名为 limits 的快照）
+			r.Get("/snapshot-limits", snapshotHandler.GetSnapshotLimits)
 			r.Route("/snapshots", func(r chi.Router) {
+				r.Use(customMiddleware.MaxBodySize(cfg.MaxSnapshotBytes))
 				r.Get("/", snapshotHandler.ListSnapshots)           // 列出快照
 				r.Post("/", snapshotHandler.CreateSnapshot)         // 创建快照
+				r.Post("/prune", snapshotHandler.PruneSnapshots)    // 批量清理 {"kind":"auto","keep":n}
 				r.Get("/{name}", snapshotHandler.GetSnapshot)       // 获取快照
 				r.Put("/{name}", snapshotHandler.UpdateSnapshot)    // 更新快照
 				r.Delete("/{name}", snapshotHandler.DeleteSnapshot) // 删除快照
+				// 将快照中的标签组转为集合 {"space_id","group_id","name"}
+				r.Post("/{name}/materialize", snapshotHandler.MaterializeSnapshot)
 			})
+			// 大快照分块上传（init → 逐块 PUT → commit）；分块 PUT 不要求 JSON，注册在下方单独的分组
+			r.Post("/snapshot-uploads", snapshotHandler.CreateSnapshotUpload)               // 开始上传 {"name","kind","total_bytes"}
+			r.Get("/snapshot-uploads/{id}", snapshotHandler.GetSnapshotUpload)              // 上传进度（已收到的分块）
+			r.Post("/snapshot-uploads/{id}/commit", snapshotHandler.CommitSnapshotUpload)   // 组装并保存快照
+			r.Delete("/snapshot-uploads/{id}", snapshotHandler.AbortSnapshotUpload)         // 放弃上传
 
 			// 订阅管理路由
 			r.Route("/subscription", func(r chi.Router) {
-				r.Get("/", handleNotImplemented)    // 获取订阅状态
-				r.Post("/", handleNotImplemented)   // 创建订阅
-				r.Put("/", handleNotImplemented)    // 更新订阅
-				r.Delete("/", handleNotImplemented) // 取消订阅
+				r.Get("/", subscriptionHandler.GetStatus)        // 获取订阅状态（含催缴提醒）
+				r.Post("/", subscriptionHandler.CreateCheckout)  // 创建订阅结账（可带 promo_code）
+				r.Put("/", handleNotImplemented)                 // 更新订阅
+				r.Delete("/", handleNotImplemented)              // 取消订阅
+				r.Post("/trial", subscriptionHandler.StartTrial) // 开启 Pro 试用
+				r.Put("/plan", subscriptionHandler.ChangePlan)   // Pro/Power 互换（按比例结算）
+			})
+
+			// 站内通知
+			r.Route("/notifications", func(r chi.Router) {
+				r.Get("/", notificationsHandler.ListNotifications)       // ?unread=true
+				r.Get("/unread-count", notificationsHandler.UnreadCount) // 扩展角标
+				r.Post("/mark-read", notificationsHandler.MarkRead)      // {"ids":[...]} 或 {"all":true}
+				r.Get("/preferences", notificationsHandler.GetPreferences)
+				r.Put("/preferences", notificationsHandler.UpdatePreferences) // {"weekly_digest": false}
+			})
+
+			// 设备（扩展安装）
+			r.Route("/devices", func(r chi.Router) {
+				r.Get("/", devicesHandler.ListDevices)
+				r.Post("/", devicesHandler.RegisterDevice)          // {"install_id","name","browser","platform"}
+				r.Post("/{id}/heartbeat", devicesHandler.Heartbeat) // {"sync_cursor": "..."}（可选）
+				r.Delete("/{id}", devicesHandler.RevokeDevice)
+				r.Get("/{id}/spaces", devicesHandler.GetDeviceSpaces)
+				r.Put("/{id}/spaces", devicesHandler.SetDeviceSpaces)  // {"space_ids":[...]}，空数组为同步全部空间
+				r.Post("/{id}/push", devicesHandler.PushToDevice)      // 发送到设备 {"urls":[...]}
+				r.Get("/{id}/pushes", devicesHandler.ListDevicePushes) // 目标设备轮询（取走即标记 delivered）
+				r.Get("/pushes/{pushID}", devicesHandler.GetDevicePush)
+				r.Post("/pushes/{pushID}/ack", devicesHandler.AckDevicePush) // {"status":"opened"|"dismissed"}
+			})
+
+			// 优惠码
+			r.Route("/promo", func(r chi.Router) {
+				r.Post("/validate", promoHandler.ValidatePromo) // 校验（不兑换）
+				r.Post("/redeem", promoHandler.RedeemPromo)     // 兑换站内优惠（临时升级 / AI 积分）
 			})
 
 			// AI功能路由
@@ -236,8 +432,48 @@ func setupRoutes(router *chi.Mux, cfg *config.Config, db database.DatabaseInterf
 
 		// Webhook路由（不需要认证，但需要验证签名）
 		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(customMiddleware.SkipBodyLogging)
+			r.Use(customMiddleware.Database(cfg))
 			r.Post("/paddle", webhookHandler.HandlePaddleWebhook) // Paddle支付回调
 		})
+
+		// 邮件退订与登录解锁（公开路由，以签名校验链接）
+		r.Route("/email", func(r chi.Router) {
+			r.Use(customMiddleware.Database(cfg))
+			r.Get("/unsubscribe", notificationsHandler.Unsubscribe)
+			r.Post("/unsubscribe", notificationsHandler.Unsubscribe) // RFC 8058 一键退订
+			r.Get("/unlock", authHandler.Unlock)                     // 登录锁定解锁链接
+		})
+
+		// 导出等产物的下载（公开路由，以带有效期、绑定用户的签名令牌校验链接）
+		r.Route("/downloads", func(r chi.Router) {
+			r.Use(customMiddleware.SkipBodyLogging)
+			r.Use(customMiddleware.Database(cfg))
+			r.Get("/{token}", downloadsHandler.Download)
+		})
+
+		// 头像与 favicon 代理（公开路由，<img> 直接引用；只抓取 IMAGE_PROXY_HOSTS 中的主机）
+		r.With(customMiddleware.SkipBodyLogging).Get("/img", imageProxyHandler.Image)
+
+		// 定时任务路由（由 Vercel Cron 以 GET 调用，CRON_SECRET 鉴权）
+		r.Route("/cron", func(r chi.Router) {
+			r.Use(customMiddleware.CronAuth(cfg))
+			r.Use(customMiddleware.Database(cfg))
+			r.Get("/expire-trials", subscriptionHandler.ExpireTrials)   // 到期试用降级
+			r.Get("/expire-dunning", subscriptionHandler.ExpireDunning) // 催缴宽限期到期降级
+			r.Get("/weekly-digest", notificationsHandler.SendWeeklyDigest) // 每周摘要邮件
+			r.Get("/process-exports", exportHandler.ProcessExports)        // 生成 GDPR 数据导出
+			r.Get("/enrich-items", collectionsHandler.EnrichItems)         // 补全快速保存条目的页面元数据
+			r.Get("/send-reminders", notificationsHandler.SendDueReminders) // 到期的条目提醒
+			r.Get("/web-archive", collectionsHandler.ArchiveItems)         // 提交网页存档并轮询结果
+		})
+
+		// 运维管理 API（ADMIN_API_KEY 鉴权）
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(customMiddleware.AdminAuth(cfg))
+			r.Use(customMiddleware.Database(cfg))
+			r.Get("/users/{id}/tier-changes", adminHandler.ListTierChanges) // 等级变化历史
+		})
 	})
 
 	// 404处理
@@ -252,6 +488,35 @@ func setupRoutes(router *chi.Mux, cfg *config.Config, db database.DatabaseInterf
 	})
 }
 
+// writeReadiness 输出就绪检查结果：配置问题逐条列出（只含环境变量名，不含取值），任一检查失败返回 503
+func writeReadiness(w http.ResponseWriter, cfgErr, dbErr error) {
+	checks := map[string]interface{}{"config": "ok", "database": "ok"}
+	ready := true
+	if cfgErr != nil {
+		ready = false
+		var ve *config.ValidationError
+		if errors.As(cfgErr, &ve) {
+			checks["config"] = ve.Problems
+		} else {
+			checks["config"] = []string{cfgErr.Error()}
+		}
+		checks["database"] = "skipped"
+	} else if dbErr != nil {
+		ready = false
+		checks["database"] = "unavailable"
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+		utils.SetRetryAfter(w, utils.DefaultRetryAfter)
+	}
+	utils.WriteJSONResponse(w, status, map[string]interface{}{
+		"ready":  ready,
+		"checks": checks,
+	})
+}
+
 // handleNotImplemented 临时处理器，用于标记未实现的端点
 func handleNotImplemented(w http.ResponseWriter, r *http.Request) {
 	utils.WriteErrorResponseWithCode(w, http.StatusNotImplemented, "NOT_IMPLEMENTED",
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const testSnapshotLimit = 2 << 20
+
+// fakeRouteDB 注入请求上下文，使需认证路由不连接真实数据库；只实现请求体解析之前会用到的方法
+type fakeRouteDB struct {
+	database.DatabaseInterface
+}
+
+func (fakeRouteDB) GetTokenVersion(userID string) (int, error) { return 0, nil }
+
+// ListUserOrganizations 用户没有组织，组织配额不计数
+func (fakeRouteDB) ListUserOrganizations(userID string) ([]models.Organization, error) {
+	return nil, nil
+}
+
+// serveAuthenticated 以已登录用户身份经完整路由器发送请求
+func serveAuthenticated(t *testing.T, method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	cfg := &config.Config{JWTSecret: "route-test-secret", MaxSnapshotBytes: testSnapshotLimit}
+	token, _, err := utils.NewJWTService(cfg.JWTSecret).GenerateAccessToken("u1", "u1@example.com", models.TokenProfile{Tier: "free"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(method, path, bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	r = r.WithContext(database.ContextWithDatabase(context.Background(), fakeRouteDB{}))
+	w := httptest.NewRecorder()
+	newRouter(cfg).ServeHTTP(w, r)
+	return w
+}
+
+// jsonOfSize 返回恰好 n 字节、字段均未知的 JSON 对象（处理器解析后按缺少必填字段返回 400）
+func jsonOfSize(n int) []byte {
+	const prefix, suffix = `{"pad":"`, `"}`
+	return []byte(prefix + strings.Repeat("a", n-len(prefix)-len(suffix)) + suffix)
+}
+
+func TestRouteBodyLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		size int
+		want int
+	}{
+		{"default limit allows 1MB", "/api/quick-save", defaultBodyLimit, http.StatusBadRequest},
+		{"default limit", "/api/quick-save", defaultBodyLimit + 1, http.StatusRequestEntityTooLarge},
+		{"history import allows more than the default", "/api/import/history", defaultBodyLimit * 2, http.StatusBadRequest},
+		{"history import limit", "/api/import/history", importBodyLimit + 1, http.StatusRequestEntityTooLarge},
+		{"snapshots allow MAX_SNAPSHOT_BYTES", "/api/snapshots/", testSnapshotLimit, http.StatusBadRequest},
+		{"snapshots limit", "/api/snapshots/", testSnapshotLimit + 1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAuthenticated(t, http.MethodPost, tt.path, "application/json", jsonOfSize(tt.size))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %.200s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouteRequiresJSONContentType(t *testing.T) {
+	for _, path := range []string{"/api/quick-save", "/api/snapshots/", "/api/import/history"} {
+		w := serveAuthenticated(t, http.MethodPost, path, "text/plain", []byte(`{"url":"https://example.com"}`))
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("POST %s: status = %d, want 415 (body %s)", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package cache 跨实例共享的短期状态（计数器、锁定标记等）。
+// Serverless 实例之间不共享内存，生产环境应配置 Redis REST（Upstash / Vercel KV）；
+// 未配置时退回进程内存，只在单实例（本地开发）下准确。
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+)
+
+// Store 带过期时间的键值存储
+type Store interface {
+	// Incr 将计数器加一并返回新值；计数器新建时设置 ttl，之后的递增不延长过期时间（固定窗口）
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Get 返回值与剩余有效期；不存在时 ok 为 false
+	Get(ctx context.Context, key string) (value string, ttl time.Duration, ok bool, err error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+var (
+	sharedOnce  sync.Once
+	sharedStore Store
+)
+
+// Shared 返回进程内共享的 Store（与 config.GetCached 一样每个冷启动只创建一次）
+func Shared(cfg *config.Config) Store {
+	sharedOnce.Do(func() {
+		if cfg.CacheRESTURL != "" {
+			sharedStore = NewRESTStore(cfg.CacheRESTURL, cfg.CacheRESTToken)
+			return
+		}
+		fmt.Printf("⚠️  KV_REST_API_URL not set: using in-memory cache (counters are per instance)\n")
+		sharedStore = NewMemoryStore()
+	})
+	return sharedStore
+}
+
+// MemoryStore 进程内实现
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value     string
+	counter   int64
+	expiresAt time.Time
+}
+
+// NewMemoryStore 创建进程内 Store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}}
+}
+
+// get 返回未过期的条目，顺带清理过期条目；调用方持有锁
+func (s *MemoryStore) get(key string, now time.Time) (memoryEntry, bool) {
+	e, ok := s.entries[key]
+	if ok && !now.Before(e.expiresAt) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return e, ok
+}
+
+// Incr 实现 Store
+func (s *MemoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	e, ok := s.get(key, now)
+	if !ok {
+		e = memoryEntry{expiresAt: now.Add(ttl)}
+	}
+	e.counter++
+	e.value = fmt.Sprint(e.counter)
+	s.entries[key] = e
+	return e.counter, nil
+}
+
+// Get 实现 Store
+func (s *MemoryStore) Get(ctx context.Context, key string) (string, time.Duration, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	e, ok := s.get(key, now)
+	if !ok {
+		return "", 0, false, nil
+	}
+	return e.value, e.expiresAt.Sub(now), true, nil
+}
+
+// Set 实现 Store
+func (s *MemoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryEntry{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Delete 实现 Store
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		delete(s.entries, k)
+	}
+	return nil
+}
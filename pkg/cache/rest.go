@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/tracing"
+)
+
+// RESTStore 通过 Redis REST API（Upstash / Vercel KV）访问 Redis，无需长连接，适合 Serverless
+type RESTStore struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewRESTStore 创建 REST Store
+func NewRESTStore(url, token string) *RESTStore {
+	return &RESTStore{
+		url:    strings.TrimRight(url, "/"),
+		token:  token,
+		client: tracing.NewHTTPClient(3 * time.Second),
+	}
+}
+
+type restResult struct {
+	Result interface{} `json:"result"`
+	Error  string      `json:"error"`
+}
+
+// pipeline 在一次请求中依次执行多条命令
+func (s *RESTStore) pipeline(ctx context.Context, commands ...[]interface{}) ([]restResult, error) {
+	body, err := json.Marshal(commands)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/pipeline", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cache request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cache request failed with status %d: %s", resp.StatusCode, data)
+	}
+	var results []restResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse cache response: %w", err)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			return nil, fmt.Errorf("cache command failed: %s", r.Error)
+		}
+	}
+	return results, nil
+}
+
+// Incr 实现 Store（PEXPIRE NX 只在计数器尚无过期时间时设置）
+func (s *RESTStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	results, err := s.pipeline(ctx,
+		[]interface{}{"INCR", key},
+		[]interface{}{"PEXPIRE", key, ttl.Milliseconds(), "NX"},
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := results[0].Result.(float64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected INCR result %v", results[0].Result)
+	}
+	return int64(n), nil
+}
+
+// Get 实现 Store
+func (s *RESTStore) Get(ctx context.Context, key string) (string, time.Duration, bool, error) {
+	results, err := s.pipeline(ctx,
+		[]interface{}{"GET", key},
+		[]interface{}{"PTTL", key},
+	)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if results[0].Result == nil {
+		return "", 0, false, nil
+	}
+	value := fmt.Sprint(results[0].Result)
+	var ttl time.Duration
+	if ms, ok := results[1].Result.(float64); ok && ms > 0 {
+		ttl = time.Duration(ms) * time.Millisecond
+	}
+	return value, ttl, true, nil
+}
+
+// Set 实现 Store
+func (s *RESTStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	_, err := s.pipeline(ctx, []interface{}{"SET", key, value, "PX", strconv.FormatInt(ttl.Milliseconds(), 10)})
+	return err
+}
+
+// Delete 实现 Store
+func (s *RESTStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	cmd := []interface{}{"DEL"}
+	for _, k := range keys {
+		cmd = append(cmd, k)
+	}
+	_, err := s.pipeline(ctx, cmd)
+	return err
+}
@@ -2,7 +2,11 @@ package config
 
 import (
     "bufio"
+    "encoding/base64"
+    "encoding/json"
     "fmt"
+    "net"
+    "net/url"
     "os"
     "strconv"
     "strings"
@@ -16,9 +20,59 @@ type Config struct {
 	Port        string
 
 	// 数据库配置
-	PostgresDSN string
-	SupabaseURL string
-	SupabaseKey string
+	DBDriver        string // 显式驱动（postgres|supabase），为空时按环境自动选择
+	PostgresDSN     string
+	PostgresReadDSN string // 可选只读副本（List*/Get* 使用，失败回退主库）
+	// 数据驻留：主库所在区域与其他区域库（组织可固定到某一区域，见 database.RegionalDatabase）
+	HomeRegion    string
+	PostgresDSNUS string
+	PostgresDSNEU string
+	SupabaseURL     string
+	SupabaseReadURL string // 可选只读端点（只读副本或 API 负载均衡地址），GET 请求优先使用
+	SupabaseKey     string
+	// PostgreSQL 应用侧连接池（0 表示按环境取默认值：Vercel 5/2，其他 20/10）
+	DBMaxOpenConns           int
+	DBMaxIdleConns           int
+	DBConnMaxLifetimeSeconds int
+	DBConnMaxIdleSeconds     int
+
+	// 快照存储
+	MaxSnapshotBytes    int64 // 单个快照请求体上限，超出返回 413
+	SnapshotCompression bool  // 以 gzip 压缩存储 tab_groups
+	AutoSnapshotKeep    int   // 每个用户保留的自动快照数，超出的最旧快照在保存时清理
+	// 单个快照的结构上限（标签组数、单组标签数、URL 长度），超出返回 SNAPSHOT_LIMIT_EXCEEDED
+	MaxSnapshotGroups    int
+	MaxSnapshotGroupTabs int
+	MaxSnapshotURLLength int
+	// 分块上传（/api/snapshot-uploads）组装后的快照上限；慢速网络下大快照分块上传，不受单次请求体上限约束
+	MaxSnapshotUploadBytes int64
+
+	// 应用层加密：组织启用后，条目 url/标题/metadata 以组织数据密钥加密，数据密钥由此主密钥包装（base64 编码的 32 字节）
+	EncryptionMasterKey string
+
+	// 功能开关：FEATURE_FLAGS 为 JSON 规则 {"key": {"enabled", "percent", "tiers", "users", "orgs"}}（见 pkg/flags）
+	FeatureFlags string
+	// A/B 实验：EXPERIMENTS 为 JSON {"key": {"enabled", "variants": [{"name","weight"}], "tiers"}}
+	Experiments string
+	// 组织每日 API 配额覆盖：ORG_DAILY_QUOTAS 为 JSON {"free": {"read": 20000, "write": 5000}}，0 表示不限；未列出的等级使用内置默认值
+	OrgDailyQuotas string
+
+	// 试用与定时任务
+	TrialDays        int    // Pro 试用天数
+	DunningGraceDays int    // 付款失败后保留付费等级的宽限天数
+	CronSecret       string // Vercel Cron 调用任务端点时携带的 Bearer 密钥
+	AdminAPIKey      string // 运维管理 API（/api/admin/*）的 Bearer 密钥；为空时管理 API 不可用
+
+	// 邮件（SMTP_HOST 为空时只打印日志，不实际发送）
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	EmailFrom    string // 发件人，如 "Tab Sync <no-reply@example.com>"
+
+	// 共享缓存（Redis REST：Upstash / Vercel KV），用于跨实例的登录失败计数与锁定；未配置时退回进程内存
+	CacheRESTURL   string
+	CacheRESTToken string
 
 	// JWT配置
 	JWTSecret string
@@ -29,6 +83,9 @@ type Config struct {
 	PaddleWebhookSecret string
 	PaddleProPriceID    string
 	PaddlePowerPriceID  string
+	// 一次性终身会员价格（可选）
+	PaddleLifetimeProPriceID   string
+	PaddleLifetimePowerPriceID string
 
 	// OAuth配置
 	GoogleClientID     string
@@ -41,8 +98,62 @@ type Config struct {
 	// CORS配置
 	AllowedOrigins []string
 
+	// 可信代理（CIDR 或单个 IP）：只从这些跳转地址接受 X-Forwarded-For / X-Real-IP，见 middleware.TrustedProxies
+	TrustedProxies []string
+
+	// GeoIP（可选）：登录记录与设备列表标注大致位置。GEOIP_PROVIDER 为 ipinfo 或 maxmind；
+	// GEOIP_TOKEN 为 ipinfo 令牌或 MaxMind License Key，MaxMind 另需 GEOIP_ACCOUNT_ID
+	GeoIPProvider  string
+	GeoIPToken     string
+	GeoIPAccountID string
+
+	// 浏览器扩展版本：低于 MIN_CLIENT_VERSION 的请求返回 426（见 middleware.ClientVersion）；
+	// 低于 CLIENT_DEPRECATED_BELOW 的版本在 /api/client/version 中收到 CLIENT_DEPRECATION_MESSAGE 提示
+	MinClientVersion         string
+	LatestClientVersion      string
+	ClientDeprecatedBelow    string
+	ClientDeprecationMessage string
+	// 故障版本封禁（见 middleware.ClientKillSwitch）：BLOCKED_CLIENT_VERSIONS 为逗号分隔的版本或前缀通配（1.4.*），
+	// 运行时还可写入共享缓存的 killswitch:client_versions；被拒绝的请求带 Retry-After（KILL_SWITCH_RETRY_AFTER 秒）
+	BlockedClientVersions []string
+	KillSwitchRetryAfter  int
+
+	// 图片代理（/api/img）允许抓取的主机；"*.example.com" 匹配其所有子域名
+	ImageProxyHosts []string
+
+	// 网页存档（可选，见 pkg/webarchive）：以 Internet Archive 的 S3 风格密钥调用 Save Page Now，组织 opt-in 后
+	// 新保存的 URL 由 /api/cron/web-archive 提交存档；WEB_ARCHIVE_DAILY_LIMIT 为每个组织每日提交上限
+	WebArchiveAccessKey  string
+	WebArchiveSecretKey  string
+	WebArchiveDailyLimit int
+
+	// 对象存储（可选，见 pkg/storage）：STORAGE_PROVIDER 为 s3 或 supabase，对象写入 STORAGE_BUCKET。
+	// s3 需要 S3_ACCESS_KEY_ID / S3_SECRET_ACCESS_KEY，S3_ENDPOINT 为空时使用 AWS（R2、MinIO 等填写其端点）；
+	// supabase 复用 SUPABASE_URL 与 SUPABASE_SERVICE_KEY
+	StorageProvider   string
+	StorageBucket     string
+	S3Endpoint        string
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3ForcePathStyle  bool
+
+	// 可疑活动告警：ANOMALY_REAUTH 列出触发后吊销全部会话、要求重新登录的告警类型
+	// （failed_attempts、token_reuse，逗号分隔；默认只通知不吊销。新国家登录只通知）
+	AnomalyReauth []string
+
+	// 错误上报（Sentry，可选）
+	SentryDSN     string
+	SentryRelease string
+
+	// 分布式追踪（OTLP/HTTP，可选）
+	OTLPEndpoint    string
+	OTLPHeaders     string
+	TraceSampleRate float64 // 新建 trace 的采样率（0-1）；带 traceparent 的请求总是跟随上游
+
 	// 调试配置
-	Debug bool
+	Debug               bool
+	DebugBodySampleRate float64 // DEBUG 模式下记录请求体的采样率（0-1）
 }
 
 // LoadConfig 加载配置（支持本地和Vercel环境）
@@ -70,12 +181,53 @@ func LoadConfig() *Config {
 		JWTSecret:   getEnvWithDefault("JWT_SECRET", "your-secret-key-change-in-production"),
 		Debug:       getEnvBool("DEBUG", false),
 	}
+	config.DebugBodySampleRate = getEnvFloat("DEBUG_BODY_SAMPLE_RATE", 1)
 
 	// 数据库配置
     // Trim whitespace to avoid trailing spaces/newlines from env sources
+	config.DBDriver = strings.ToLower(strings.TrimSpace(os.Getenv("DB_DRIVER")))
     config.PostgresDSN = strings.TrimSpace(os.Getenv("POSTGRES_DSN"))
+    config.PostgresReadDSN = strings.TrimSpace(os.Getenv("POSTGRES_READ_DSN"))
+	config.HomeRegion = strings.ToLower(getEnvWithDefault("DATA_HOME_REGION", "us"))
+	config.PostgresDSNUS = strings.TrimSpace(os.Getenv("POSTGRES_DSN_US"))
+	config.PostgresDSNEU = strings.TrimSpace(os.Getenv("POSTGRES_DSN_EU"))
     config.SupabaseURL = strings.TrimSpace(os.Getenv("SUPABASE_URL"))
+	config.SupabaseReadURL = strings.TrimSpace(os.Getenv("SUPABASE_READ_URL"))
     config.SupabaseKey = strings.TrimSpace(os.Getenv("SUPABASE_SERVICE_KEY"))
+	config.DBMaxOpenConns = int(getEnvInt64("DB_MAX_OPEN_CONNS", 0))
+	config.DBMaxIdleConns = int(getEnvInt64("DB_MAX_IDLE_CONNS", 0))
+	config.DBConnMaxLifetimeSeconds = int(getEnvInt64("DB_CONN_MAX_LIFETIME_SECONDS", 0))
+	config.DBConnMaxIdleSeconds = int(getEnvInt64("DB_CONN_MAX_IDLE_SECONDS", 0))
+
+	// 快照存储配置（默认 4MB，低于 Vercel 4.5MB 的请求体上限）
+	config.MaxSnapshotBytes = getEnvInt64("MAX_SNAPSHOT_BYTES", 4<<20)
+	config.MaxSnapshotUploadBytes = getEnvInt64("SNAPSHOT_UPLOAD_MAX_BYTES", 32<<20)
+	config.SnapshotCompression = getEnvBool("SNAPSHOT_COMPRESSION", false)
+	config.AutoSnapshotKeep = int(getEnvInt64("SNAPSHOT_AUTO_KEEP", 24))
+	config.MaxSnapshotGroups = int(getEnvInt64("SNAPSHOT_MAX_GROUPS", 200))
+	config.MaxSnapshotGroupTabs = int(getEnvInt64("SNAPSHOT_MAX_GROUP_TABS", 1000))
+	config.MaxSnapshotURLLength = int(getEnvInt64("SNAPSHOT_MAX_URL_LENGTH", 8192))
+	config.EncryptionMasterKey = strings.TrimSpace(os.Getenv("ENCRYPTION_MASTER_KEY"))
+	config.FeatureFlags = strings.TrimSpace(os.Getenv("FEATURE_FLAGS"))
+	config.Experiments = strings.TrimSpace(os.Getenv("EXPERIMENTS"))
+	config.OrgDailyQuotas = strings.TrimSpace(os.Getenv("ORG_DAILY_QUOTAS"))
+
+	// 试用与定时任务配置
+	config.TrialDays = int(getEnvInt64("TRIAL_DAYS", 14))
+	config.DunningGraceDays = int(getEnvInt64("DUNNING_GRACE_DAYS", 7))
+	config.CronSecret = strings.TrimSpace(os.Getenv("CRON_SECRET"))
+	config.AdminAPIKey = strings.TrimSpace(os.Getenv("ADMIN_API_KEY"))
+
+	// 共享缓存配置（Vercel KV 注入 KV_REST_API_*，Upstash 注入 UPSTASH_REDIS_REST_*）
+	config.CacheRESTURL = strings.TrimSpace(getEnvWithDefault("KV_REST_API_URL", os.Getenv("UPSTASH_REDIS_REST_URL")))
+	config.CacheRESTToken = strings.TrimSpace(getEnvWithDefault("KV_REST_API_TOKEN", os.Getenv("UPSTASH_REDIS_REST_TOKEN")))
+
+	// 邮件配置
+	config.SMTPHost = strings.TrimSpace(os.Getenv("SMTP_HOST"))
+	config.SMTPPort = int(getEnvInt64("SMTP_PORT", 587))
+	config.SMTPUsername = strings.TrimSpace(os.Getenv("SMTP_USERNAME"))
+	config.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	config.EmailFrom = strings.TrimSpace(os.Getenv("EMAIL_FROM"))
 
 	// Paddle配置
 	config.PaddleAPIKey = os.Getenv("PADDLE_API_KEY")
@@ -83,6 +235,8 @@ func LoadConfig() *Config {
 	config.PaddleWebhookSecret = os.Getenv("PADDLE_WEBHOOK_SECRET")
 	config.PaddleProPriceID = os.Getenv("PADDLE_PRO_PRICE_ID")
 	config.PaddlePowerPriceID = os.Getenv("PADDLE_POWER_PRICE_ID")
+	config.PaddleLifetimeProPriceID = strings.TrimSpace(os.Getenv("PADDLE_LIFETIME_PRO_PRICE_ID"))
+	config.PaddleLifetimePowerPriceID = strings.TrimSpace(os.Getenv("PADDLE_LIFETIME_POWER_PRICE_ID"))
 
 	// OAuth配置
     config.GoogleClientID = strings.TrimSpace(os.Getenv("GOOGLE_CLIENT_ID"))
@@ -92,6 +246,15 @@ func LoadConfig() *Config {
     config.OAuthRedirectURI = strings.TrimSpace(os.Getenv("OAUTH_REDIRECT_URI"))
     config.BaseURL = strings.TrimSpace(os.Getenv("BASE_URL"))
 
+	// 错误上报配置
+	config.SentryDSN = strings.TrimSpace(os.Getenv("SENTRY_DSN"))
+	config.SentryRelease = getEnvWithDefault("SENTRY_RELEASE", os.Getenv("VERCEL_GIT_COMMIT_SHA"))
+
+	// 追踪配置（沿用 OpenTelemetry 标准环境变量名）
+	config.OTLPEndpoint = strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	config.OTLPHeaders = os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")
+	config.TraceSampleRate = getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1)
+
 	// CORS配置
 	allowedOrigins := getEnvWithDefault("ALLOWED_ORIGINS", "*")
 	if allowedOrigins == "*" {
@@ -100,6 +263,43 @@ func LoadConfig() *Config {
 		config.AllowedOrigins = strings.Split(allowedOrigins, ",")
 	}
 
+	// 可信代理配置：默认信任回环与私有网段（Vercel 等平台的内部转发），"none" 表示不信任任何代理
+	config.TrustedProxies = splitList(getEnvWithDefault("TRUSTED_PROXIES", defaultTrustedProxies))
+	if len(config.TrustedProxies) == 1 && strings.EqualFold(config.TrustedProxies[0], "none") {
+		config.TrustedProxies = nil
+	}
+
+	// GeoIP 配置
+	config.GeoIPProvider = strings.ToLower(strings.TrimSpace(os.Getenv("GEOIP_PROVIDER")))
+	config.GeoIPToken = strings.TrimSpace(os.Getenv("GEOIP_TOKEN"))
+	config.GeoIPAccountID = strings.TrimSpace(os.Getenv("GEOIP_ACCOUNT_ID"))
+	config.AnomalyReauth = splitList(strings.ToLower(os.Getenv("ANOMALY_REAUTH")))
+
+	// 客户端版本配置
+	config.MinClientVersion = strings.TrimSpace(os.Getenv("MIN_CLIENT_VERSION"))
+	config.LatestClientVersion = strings.TrimSpace(os.Getenv("LATEST_CLIENT_VERSION"))
+	config.ClientDeprecatedBelow = strings.TrimSpace(os.Getenv("CLIENT_DEPRECATED_BELOW"))
+	config.ClientDeprecationMessage = strings.TrimSpace(os.Getenv("CLIENT_DEPRECATION_MESSAGE"))
+	config.BlockedClientVersions = splitList(os.Getenv("BLOCKED_CLIENT_VERSIONS"))
+	config.KillSwitchRetryAfter = int(getEnvInt64("KILL_SWITCH_RETRY_AFTER", 3600))
+
+	// 图片代理：默认允许 Google / GitHub 头像与 Google、DuckDuckGo 的 favicon 服务
+	config.ImageProxyHosts = splitList(strings.ToLower(getEnvWithDefault("IMAGE_PROXY_HOSTS", defaultImageProxyHosts)))
+
+	// 网页存档配置
+	config.WebArchiveAccessKey = strings.TrimSpace(os.Getenv("WEB_ARCHIVE_ACCESS_KEY"))
+	config.WebArchiveSecretKey = strings.TrimSpace(os.Getenv("WEB_ARCHIVE_SECRET_KEY"))
+	config.WebArchiveDailyLimit = int(getEnvInt64("WEB_ARCHIVE_DAILY_LIMIT", 200))
+
+	// 对象存储配置
+	config.StorageProvider = strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_PROVIDER")))
+	config.StorageBucket = strings.TrimSpace(os.Getenv("STORAGE_BUCKET"))
+	config.S3Endpoint = strings.TrimSpace(os.Getenv("S3_ENDPOINT"))
+	config.S3Region = getEnvWithDefault("S3_REGION", "us-east-1")
+	config.S3AccessKeyID = strings.TrimSpace(os.Getenv("S3_ACCESS_KEY_ID"))
+	config.S3SecretAccessKey = strings.TrimSpace(os.Getenv("S3_SECRET_ACCESS_KEY"))
+	config.S3ForcePathStyle = getEnvBool("S3_FORCE_PATH_STYLE", false)
+
 	// 环境特定配置
 	if config.Environment == "production" {
 		// 生产环境强制使用外部数据库（PostgreSQL或Supabase）
@@ -132,17 +332,31 @@ func GetCached() *Config {
     return cachedConfig
 }
 
-// Validate 验证配置
+// ValidationError 汇总所有配置问题，每条问题都指明需要修改的环境变量
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate 验证配置；一次性返回全部问题，而不是遇到第一个就停止
 func (c *Config) Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
 	// 验证端口
 	if c.Port == "" {
-		return fmt.Errorf("PORT is required")
+		addf("PORT is required")
 	}
 
 	// 验证JWT密钥
 	if c.JWTSecret == "" || c.JWTSecret == "your-secret-key-change-in-production" || c.JWTSecret == "your-local-development-secret-key" {
 		if c.Environment == "production" {
-			return fmt.Errorf("JWT_SECRET must be set in production")
+			addf("JWT_SECRET must be set to a non-default value in production")
 		}
 		if c.Environment == "development" {
 			fmt.Println("⚠️  Using default JWT secret (not recommended for production)")
@@ -150,19 +364,252 @@ func (c *Config) Validate() error {
 	}
 
 	// 验证数据库配置
-	if false { // local DB removed
-		// 使用本地文件数据库，无需额外验证
-	} else if c.PostgresDSN != "" {
-		// 使用本地PostgreSQL，无需额外验证
-	} else if c.SupabaseURL != "" && c.SupabaseKey != "" {
-		// 使用Supabase，无需额外验证
-	} else {
-		return fmt.Errorf("数据库配置不完整：请配置 POSTGRES_DSN 或 SUPABASE_URL+SUPABASE_SERVICE_KEY")
+	switch c.DBDriver {
+	case "":
+		if c.PostgresDSN == "" && (c.SupabaseURL == "" || c.SupabaseKey == "") {
+			addf("数据库配置不完整：请配置 POSTGRES_DSN 或 SUPABASE_URL+SUPABASE_SERVICE_KEY")
+		}
+	case "postgres":
+		if c.PostgresDSN == "" {
+			addf("DB_DRIVER=postgres requires POSTGRES_DSN")
+		}
+	case "supabase":
+		if c.SupabaseURL == "" || c.SupabaseKey == "" {
+			addf("DB_DRIVER=supabase requires SUPABASE_URL and SUPABASE_SERVICE_KEY")
+		}
+	case "sqlite", "local":
+		addf("DB_DRIVER=%s is no longer supported: the local file database was removed, use postgres or supabase", c.DBDriver)
+	default:
+		addf("DB_DRIVER must be postgres or supabase (got %q)", c.DBDriver)
+	}
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 || c.DBConnMaxLifetimeSeconds < 0 || c.DBConnMaxIdleSeconds < 0 {
+		addf("DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME_SECONDS and DB_CONN_MAX_IDLE_SECONDS must not be negative")
+	}
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		addf("DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
+	}
+	if c.PostgresReadDSN != "" && c.PostgresDSN == "" {
+		addf("POSTGRES_READ_DSN requires POSTGRES_DSN (the primary handles all writes)")
+	}
+	if c.HomeRegion != "us" && c.HomeRegion != "eu" {
+		addf("DATA_HOME_REGION must be us or eu")
+	}
+	if c.SupabaseReadURL != "" {
+		if c.SupabaseURL == "" {
+			addf("SUPABASE_READ_URL requires SUPABASE_URL (the primary handles all writes)")
+		} else if err := checkAbsoluteURL(c.SupabaseReadURL); err != nil {
+			addf("SUPABASE_READ_URL %v", err)
+		}
+	}
+	if (c.SupabaseURL == "") != (c.SupabaseKey == "") {
+		addf("SUPABASE_URL and SUPABASE_SERVICE_KEY must be set together")
+	}
+	if c.SupabaseURL != "" {
+		if err := checkAbsoluteURL(c.SupabaseURL); err != nil {
+			addf("SUPABASE_URL %v", err)
+		}
+	}
+
+	if c.MaxSnapshotBytes <= 0 {
+		addf("MAX_SNAPSHOT_BYTES must be a positive number of bytes")
+	}
+	if c.MaxSnapshotUploadBytes < c.MaxSnapshotBytes {
+		addf("SNAPSHOT_UPLOAD_MAX_BYTES must not be smaller than MAX_SNAPSHOT_BYTES")
+	}
+	if c.AutoSnapshotKeep <= 0 {
+		addf("SNAPSHOT_AUTO_KEEP must be a positive number of snapshots")
+	}
+	if c.MaxSnapshotGroups <= 0 || c.MaxSnapshotGroupTabs <= 0 || c.MaxSnapshotURLLength <= 0 {
+		addf("SNAPSHOT_MAX_GROUPS, SNAPSHOT_MAX_GROUP_TABS and SNAPSHOT_MAX_URL_LENGTH must be positive numbers")
+	}
+	if c.EncryptionMasterKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.EncryptionMasterKey); err != nil || len(key) != 32 {
+			addf("ENCRYPTION_MASTER_KEY must be 32 random bytes, base64 encoded (e.g. openssl rand -base64 32)")
+		}
+	}
+	if c.FeatureFlags != "" {
+		var rules map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(c.FeatureFlags), &rules); err != nil {
+			addf("FEATURE_FLAGS must be a JSON object of flag rules: %v", err)
+		}
+	}
+	if c.Experiments != "" {
+		var experiments map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(c.Experiments), &experiments); err != nil {
+			addf("EXPERIMENTS must be a JSON object of experiments: %v", err)
+		}
+	}
+	if c.OrgDailyQuotas != "" {
+		var quotas map[string]struct{ Read, Write int }
+		if err := json.Unmarshal([]byte(c.OrgDailyQuotas), &quotas); err != nil {
+			addf("ORG_DAILY_QUOTAS must be a JSON object of per-tier quotas: %v", err)
+		}
+		for tier, q := range quotas {
+			if q.Read < 0 || q.Write < 0 {
+				addf("ORG_DAILY_QUOTAS: quotas for %q must not be negative", tier)
+			}
+		}
+	}
+	if c.TrialDays <= 0 {
+		addf("TRIAL_DAYS must be a positive number of days")
+	}
+	if c.DunningGraceDays <= 0 {
+		addf("DUNNING_GRACE_DAYS must be a positive number of days")
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			addf("TRUSTED_PROXIES entry %q must be an IP address or CIDR range", proxy)
+		}
+	}
+	for _, kind := range c.AnomalyReauth {
+		if kind != "failed_attempts" && kind != "token_reuse" {
+			addf("ANOMALY_REAUTH entry %q must be failed_attempts or token_reuse", kind)
+		}
+	}
+	switch c.GeoIPProvider {
+	case "":
+	case "ipinfo":
+		if c.GeoIPToken == "" {
+			addf("GEOIP_TOKEN is required when GEOIP_PROVIDER=ipinfo")
+		}
+	case "maxmind":
+		if c.GeoIPToken == "" || c.GeoIPAccountID == "" {
+			addf("GEOIP_ACCOUNT_ID and GEOIP_TOKEN (license key) are required when GEOIP_PROVIDER=maxmind")
+		}
+	default:
+		addf("GEOIP_PROVIDER must be ipinfo or maxmind")
+	}
+	for name, v := range map[string]string{
+		"MIN_CLIENT_VERSION":      c.MinClientVersion,
+		"LATEST_CLIENT_VERSION":   c.LatestClientVersion,
+		"CLIENT_DEPRECATED_BELOW": c.ClientDeprecatedBelow,
+	} {
+		if v != "" && !validVersion(v) {
+			addf("%s must be a dotted numeric version such as 1.4.0", name)
+		}
+	}
+	for _, v := range c.BlockedClientVersions {
+		if !validVersion(strings.TrimSuffix(v, ".*")) {
+			addf("BLOCKED_CLIENT_VERSIONS entry %q must be a version (1.4.2) or prefix wildcard (1.4.*)", v)
+		}
+	}
+	if c.KillSwitchRetryAfter <= 0 {
+		addf("KILL_SWITCH_RETRY_AFTER must be a positive number of seconds")
+	}
+	switch c.StorageProvider {
+	case "":
+	case "s3":
+		if c.S3AccessKeyID == "" || c.S3SecretAccessKey == "" {
+			addf("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required when STORAGE_PROVIDER=s3")
+		}
+		if c.S3Endpoint != "" {
+			if err := checkAbsoluteURL(c.S3Endpoint); err != nil {
+				addf("S3_ENDPOINT %v", err)
+			}
+		}
+	case "supabase":
+		if c.SupabaseURL == "" || c.SupabaseKey == "" {
+			addf("SUPABASE_URL and SUPABASE_SERVICE_KEY are required when STORAGE_PROVIDER=supabase")
+		}
+	default:
+		addf("STORAGE_PROVIDER must be s3 or supabase")
+	}
+	if c.StorageProvider != "" && c.StorageBucket == "" {
+		addf("STORAGE_BUCKET is required when STORAGE_PROVIDER is set")
+	}
+	if c.CacheRESTURL != "" {
+		if err := checkAbsoluteURL(c.CacheRESTURL); err != nil {
+			addf("KV_REST_API_URL %v", err)
+		}
+		if c.CacheRESTToken == "" {
+			addf("KV_REST_API_TOKEN is required when KV_REST_API_URL is set")
+		}
+	}
+	if c.SMTPHost != "" {
+		if c.SMTPPort <= 0 || c.SMTPPort > 65535 {
+			addf("SMTP_PORT must be a valid port number")
+		}
+		if c.EmailFrom == "" {
+			addf("EMAIL_FROM is required when SMTP_HOST is set")
+		}
+	}
+
+	if (c.WebArchiveAccessKey == "") != (c.WebArchiveSecretKey == "") {
+		addf("WEB_ARCHIVE_ACCESS_KEY and WEB_ARCHIVE_SECRET_KEY must be set together")
+	}
+	if c.WebArchiveDailyLimit <= 0 {
+		addf("WEB_ARCHIVE_DAILY_LIMIT must be a positive number")
+	}
+
+	// OAuth：ID 与 Secret 成对出现
+	if (c.GoogleClientID == "") != (c.GoogleClientSecret == "") {
+		addf("GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET must be set together")
+	}
+	if (c.GitHubClientID == "") != (c.GitHubClientSecret == "") {
+		addf("GITHUB_CLIENT_ID and GITHUB_CLIENT_SECRET must be set together")
+	}
+	if c.OAuthRedirectURI != "" {
+		if err := checkAbsoluteURL(c.OAuthRedirectURI); err != nil {
+			addf("OAUTH_REDIRECT_URI %v", err)
+		}
+	} else if c.GoogleClientID != "" {
+		addf("OAUTH_REDIRECT_URI is required when GOOGLE_CLIENT_ID is set")
+	}
+	if c.BaseURL != "" {
+		if err := checkAbsoluteURL(c.BaseURL); err != nil {
+			addf("BASE_URL %v", err)
+		}
 	}
 
+	// Paddle：启用 webhook 时必须能把价格映射到套餐
+	if c.PaddleWebhookSecret != "" {
+		if c.PaddleProPriceID == "" {
+			addf("PADDLE_PRO_PRICE_ID is required when PADDLE_WEBHOOK_SECRET is set")
+		}
+		if c.PaddlePowerPriceID == "" {
+			addf("PADDLE_POWER_PRICE_ID is required when PADDLE_WEBHOOK_SECRET is set")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// checkAbsoluteURL 要求形如 https://host/path 的绝对 http(s) URL
+func checkAbsoluteURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must start with http:// or https:// (got %q)", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("must include a host (got %q)", raw)
+	}
 	return nil
 }
 
+// Cached validation result (computed once per cold start)
+var (
+	validateErr  error
+	validateOnce sync.Once
+)
+
+// ValidateCached validates the cached Config once per cold start and
+// returns the same result on every warm invocation.
+func ValidateCached() error {
+	validateOnce.Do(func() {
+		validateErr = GetCached().Validate()
+		if validateErr != nil {
+			fmt.Printf("❌ %v\n", validateErr)
+		}
+	})
+	return validateErr
+}
+
 // IsProduction 检查是否为生产环境
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
@@ -173,8 +620,50 @@ func (c *Config) IsDevelopment() bool {
 	return c.Environment == "development"
 }
 
+// RegionDSNs 返回主库区域之外已配置的区域库 DSN（区域 -> DSN）
+func (c *Config) RegionDSNs() map[string]string {
+	regions := map[string]string{}
+	for region, dsn := range map[string]string{"us": c.PostgresDSNUS, "eu": c.PostgresDSNEU} {
+		if dsn != "" && region != c.HomeRegion {
+			regions[region] = dsn
+		}
+	}
+	return regions
+}
+
 // 辅助函数
 
+// defaultTrustedProxies 回环、私有与链路本地网段
+const defaultTrustedProxies = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,169.254.0.0/16,fc00::/7,fe80::/10"
+
+// validVersion 点分数字版本号（1 到 4 段），与扩展 manifest 的 version 格式一致
+func validVersion(v string) bool {
+	parts := strings.Split(v, ".")
+	if len(parts) > 4 {
+		return false
+	}
+	for _, p := range parts {
+		if _, err := strconv.ParseUint(p, 10, 16); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultImageProxyHosts 头像（Google、GitHub）与 favicon 服务（Google s2 会重定向到 gstatic）
+const defaultImageProxyHosts = "lh3.googleusercontent.com,avatars.githubusercontent.com,www.google.com,*.gstatic.com,icons.duckduckgo.com"
+
+// splitList 按逗号拆分并去掉空白项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // getEnvWithDefault 获取环境变量，如果不存在则使用默认值
 func getEnvWithDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -193,6 +682,26 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// getEnvFloat 获取浮点类型的环境变量
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvInt64 获取整数类型的环境变量
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
 // loadEnvFile 加载 .env 文件到环境变量
 func loadEnvFile(filename string) {
 	// 检查文件是否存在
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// 查找缓存：条目写入的权限校验在短时间内反复读取同一空间/集合，缓存少量结果即可消除大部分重复查询
+const (
+	lookupCacheTTL  = 10 * time.Second
+	lookupCacheSize = 1024
+)
+
+// CachedDatabase 为 GetSpaceByID/GetCollection 提供进程内 LRU（按用户 + ID 缓存，只缓存成功结果）。
+// 经本实例的空间、集合、空间权限、访客、成员移除与条目增删写入会立即失效相关条目；其他实例的写入最迟在 lookupCacheTTL 后可见。
+// 位于 RegionalDatabase 之下（每个库各自一份），不影响区域路由对请求内已解析 ID 的记录
+type CachedDatabase struct {
+	DatabaseInterface
+
+	cache *lookupCache
+}
+
+// NewCachedDatabase 在 inner 之上启用查找缓存
+func NewCachedDatabase(inner DatabaseInterface) *CachedDatabase {
+	return &CachedDatabase{DatabaseInterface: inner, cache: newLookupCache(lookupCacheSize, lookupCacheTTL)}
+}
+
+// WithContext 实现 contextBinder；缓存在各请求的副本间共享
+func (db *CachedDatabase) WithContext(ctx context.Context) DatabaseInterface {
+	c := *db
+	c.DatabaseInterface = WithContext(db.DatabaseInterface, ctx)
+	return &c
+}
+
+func (db *CachedDatabase) GetSpaceByID(userID, spaceID string) (*models.Space, error) {
+	key := "space:" + userID + ":" + spaceID
+	if v, ok := db.cache.get(key); ok {
+		space := *v.(*models.Space)
+		return &space, nil
+	}
+	space, err := db.DatabaseInterface.GetSpaceByID(userID, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	cached := *space
+	db.cache.put(key, &cached, spaceID)
+	return space, nil
+}
+
+func (db *CachedDatabase) GetCollection(userID, id string) (*models.Collection, error) {
+	key := "collection:" + userID + ":" + id
+	if v, ok := db.cache.get(key); ok {
+		c := *v.(*models.Collection)
+		return &c, nil
+	}
+	c, err := db.DatabaseInterface.GetCollection(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	cached := *c
+	// 同时以所属空间为标签：空间删除或权限变化时一并失效
+	db.cache.put(key, &cached, id, c.SpaceID)
+	return c, nil
+}
+
+// ---- 失效 ----
+
+func (db *CachedDatabase) UpdateOrganization(org *models.Organization) error {
+	// owner 变化会改变空间/集合的访问范围；组织级变化很少，整体清空
+	defer db.cache.purge()
+	return db.DatabaseInterface.UpdateOrganization(org)
+}
+
+// 设为默认空间会清除同组织其他空间的 is_default，整体清空
+func (db *CachedDatabase) CreateSpace(space *models.Space) error {
+	if space.IsDefault {
+		defer db.cache.purge()
+	}
+	return db.DatabaseInterface.CreateSpace(space)
+}
+
+func (db *CachedDatabase) UpdateSpace(space *models.Space) error {
+	if space.IsDefault {
+		defer db.cache.purge()
+	} else {
+		defer db.cache.invalidate(space.ID)
+	}
+	return db.DatabaseInterface.UpdateSpace(space)
+}
+
+func (db *CachedDatabase) DeleteSpace(spaceID string) error {
+	defer db.cache.invalidate(spaceID)
+	return db.DatabaseInterface.DeleteSpace(spaceID)
+}
+
+func (db *CachedDatabase) SetSpacePermission(spaceID, userID string, canEdit bool) error {
+	defer db.cache.invalidate(spaceID)
+	return db.DatabaseInterface.SetSpacePermission(spaceID, userID, canEdit)
+}
+
+func (db *CachedDatabase) DeleteSpacePermission(spaceID, userID string) error {
+	defer db.cache.invalidate(spaceID)
+	return db.DatabaseInterface.DeleteSpacePermission(spaceID, userID)
+}
+
+func (db *CachedDatabase) AddSpaceGuest(spaceID, userID, invitationID string, canEdit bool) error {
+	defer db.cache.invalidate(spaceID)
+	return db.DatabaseInterface.AddSpaceGuest(spaceID, userID, invitationID, canEdit)
+}
+
+func (db *CachedDatabase) RemoveSpaceGuest(spaceID, userID string) error {
+	defer db.cache.invalidate(spaceID)
+	return db.DatabaseInterface.RemoveSpaceGuest(spaceID, userID)
+}
+
+// 成员移除后其缓存的空间/集合访问须立即失效；缓存不按组织打标签，整体清空
+func (db *CachedDatabase) RemoveOrganizationMember(orgID, userID string) error {
+	defer db.cache.purge()
+	return db.DatabaseInterface.RemoveOrganizationMember(orgID, userID)
+}
+
+func (db *CachedDatabase) UpdateCollection(c *models.Collection) error {
+	defer db.cache.invalidate(c.ID)
+	return db.DatabaseInterface.UpdateCollection(c)
+}
+
+func (db *CachedDatabase) DeleteCollection(id string) error {
+	defer db.cache.invalidate(id)
+	return db.DatabaseInterface.DeleteCollection(id)
+}
+
+// 条目增删改变集合的 item_count / last_item_added_at
+func (db *CachedDatabase) CreateCollectionItem(it *models.CollectionItem) error {
+	defer db.cache.invalidate(it.CollectionID)
+	return db.DatabaseInterface.CreateCollectionItem(it)
+}
+
+func (db *CachedDatabase) DeleteCollectionItem(collectionID, id string) error {
+	defer db.cache.invalidate(collectionID)
+	return db.DatabaseInterface.DeleteCollectionItem(collectionID, id)
+}
+
+func (db *CachedDatabase) UpdateCollectionItem(it *models.CollectionItem) error {
+	// 全量更新可能移动条目或改变删除状态，且不知道原集合，整体清空
+	defer db.cache.purge()
+	return db.DatabaseInterface.UpdateCollectionItem(it)
+}
+
+func (db *CachedDatabase) UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) (*models.CollectionItem, error) {
+	if _, moved := patch["collection_id"]; moved {
+		defer db.cache.purge()
+	}
+	return db.DatabaseInterface.UpdateCollectionItemPartial(itemID, patch)
+}
+
+func (db *CachedDatabase) DeleteUser(id string) error {
+	defer db.cache.purge()
+	return db.DatabaseInterface.DeleteUser(id)
+}
+
+// lookupCache 带 TTL 的 LRU；每个条目带若干标签（空间/集合 ID），按标签失效
+type lookupCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List // 最近使用的在前
+	items map[string]*list.Element
+}
+
+type lookupEntry struct {
+	key       string
+	value     interface{}
+	tags      []string
+	expiresAt time.Time
+}
+
+func newLookupCache(size int, ttl time.Duration) *lookupCache {
+	return &lookupCache{size: size, ttl: ttl, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *lookupCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lookupEntry)
+	if time.Now().After(e.expiresAt) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *lookupCache) put(key string, value interface{}, tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+	}
+	c.items[key] = c.order.PushFront(&lookupEntry{key: key, value: value, tags: tags, expiresAt: time.Now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lookupEntry).key)
+	}
+}
+
+// invalidate 删除带有 tag 的所有条目（缓存很小，线性扫描即可）
+func (c *lookupCache) invalidate(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*lookupEntry)
+		for _, t := range e.tags {
+			if t == tag {
+				c.order.Remove(el)
+				delete(c.items, e.key)
+				break
+			}
+		}
+		el = next
+	}
+}
+
+func (c *lookupCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = map[string]*list.Element{}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"testing"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// countingLookupDB 统计 GetSpaceByID 穿透到内层的次数；写入方法只做记录
+type countingLookupDB struct {
+	DatabaseInterface
+	lookups int
+}
+
+func (db *countingLookupDB) GetSpaceByID(userID, spaceID string) (*models.Space, error) {
+	db.lookups++
+	return &models.Space{ID: spaceID, OrganizationID: "o1"}, nil
+}
+
+func (db *countingLookupDB) RemoveSpaceGuest(spaceID, userID string) error { return nil }
+
+func (db *countingLookupDB) AddSpaceGuest(spaceID, userID, invitationID string, canEdit bool) error {
+	return nil
+}
+
+func (db *countingLookupDB) RemoveOrganizationMember(orgID, userID string) error { return nil }
+
+func TestCachedDatabaseInvalidatesOnAccessRemoval(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(db *CachedDatabase) error
+	}{
+		{"remove space guest", func(db *CachedDatabase) error { return db.RemoveSpaceGuest("s1", "u1") }},
+		{"add space guest", func(db *CachedDatabase) error { return db.AddSpaceGuest("s1", "u1", "", false) }},
+		{"remove organization member", func(db *CachedDatabase) error { return db.RemoveOrganizationMember("o1", "u1") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &countingLookupDB{}
+			db := NewCachedDatabase(inner)
+			for i := 0; i < 2; i++ {
+				if _, err := db.GetSpaceByID("u1", "s1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if inner.lookups != 1 {
+				t.Fatalf("lookups before write = %d, want 1 (second read cached)", inner.lookups)
+			}
+			if err := tt.write(db); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.GetSpaceByID("u1", "s1"); err != nil {
+				t.Fatal(err)
+			}
+			if inner.lookups != 2 {
+				t.Errorf("lookups after write = %d, want 2 (cache invalidated)", inner.lookups)
+			}
+		})
+	}
+}
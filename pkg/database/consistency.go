@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 读己之写：只读副本（POSTGRES_READ_DSN / SUPABASE_READ_URL）存在复制延迟，"创建条目后立即列表"可能读不到新行。
+// 同一请求写入之后的读取自动走主库；跨请求时，写请求的响应带一致性令牌（写入时间），客户端在后续请求中回传，
+// 令牌未超过 consistencyWindow 时读取走主库（见 middleware.Consistency）
+const consistencyWindow = 10 * time.Second
+
+type consistencyKey struct{}
+
+// consistencyState 请求内的读写状态；指针存放在请求上下文中，由该请求绑定的各数据库句柄共享
+type consistencyState struct {
+	mu      sync.Mutex
+	primary bool      // 读取走主库：令牌未过期，或本请求已写入
+	wroteAt time.Time // 本请求最近一次写入时间，零值表示未写入
+}
+
+// WithConsistency 为请求上下文附加读写状态；token 为客户端回传的一致性令牌（可为空或无效，均视为无令牌）
+func WithConsistency(ctx context.Context, token string) context.Context {
+	state := &consistencyState{}
+	if ms, err := strconv.ParseInt(token, 10, 64); err == nil {
+		age := time.Since(time.UnixMilli(ms))
+		// 允许少量时钟偏差；更"新"的令牌视为伪造，忽略
+		state.primary = age < consistencyWindow && age > -time.Second
+	}
+	return context.WithValue(ctx, consistencyKey{}, state)
+}
+
+// ConsistencyToken 返回本请求写入后应下发给客户端的令牌；未写入时返回空串
+func ConsistencyToken(ctx context.Context) string {
+	state, ok := ctx.Value(consistencyKey{}).(*consistencyState)
+	if !ok {
+		return ""
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.wroteAt.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(state.wroteAt.UnixMilli(), 10)
+}
+
+// markWrite 记录本请求发生了写入：之后的读取走主库，响应下发令牌
+func markWrite(ctx context.Context) {
+	state, ok := ctx.Value(consistencyKey{}).(*consistencyState)
+	if !ok {
+		return
+	}
+	state.mu.Lock()
+	state.primary = true
+	state.wroteAt = time.Now()
+	state.mu.Unlock()
+}
+
+// primaryReads 报告本请求的读取是否应绕过只读副本
+func primaryReads(ctx context.Context) bool {
+	state, ok := ctx.Value(consistencyKey{}).(*consistencyState)
+	if !ok {
+		return false
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.primary
+}
@@ -0,0 +1,34 @@
+package database
+
+import "context"
+
+// contextBinder 由支持请求上下文的实现提供：返回共享同一连接、但携带 ctx 的浅拷贝
+type contextBinder interface {
+	WithContext(ctx context.Context) DatabaseInterface
+}
+
+// WithContext 返回绑定了 ctx 的数据库句柄，使后续调用继承请求的追踪 Span 与取消信号。
+// 实现不支持时原样返回 db。
+func WithContext(db DatabaseInterface, ctx context.Context) DatabaseInterface {
+	if b, ok := db.(contextBinder); ok && ctx != nil {
+		return b.WithContext(ctx)
+	}
+	return db
+}
+
+type handleKey struct{}
+
+// ContextWithDatabase 将数据库句柄放入请求上下文（见 middleware.Database）
+func ContextWithDatabase(ctx context.Context, db DatabaseInterface) context.Context {
+	return context.WithValue(ctx, handleKey{}, db)
+}
+
+// FromContext 返回上下文中的数据库句柄，并绑定到 ctx 本身（Span、取消信号）。
+// 路由未挂载数据库中间件或连接失败时返回 nil。
+func FromContext(ctx context.Context) DatabaseInterface {
+	db, _ := ctx.Value(handleKey{}).(DatabaseInterface)
+	if db == nil {
+		return nil
+	}
+	return WithContext(db, ctx)
+}
@@ -0,0 +1,496 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/encryption"
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// encryptedMetadataKey 加密后的 metadata 形如 {"enc": "enc:v1:...", "normalized_url": "bi:v1:..."}：
+// 原 metadata 整体加密，normalized_url 替换为盲索引，使按 URL 去重仍可在库内等值查找
+const encryptedMetadataKey = "enc"
+
+// encryptedItemTitle 摘要等无法按组织解密的场景中代替密文标题
+const encryptedItemTitle = "Encrypted item"
+
+// dataKeyNegativeTTL 未启用加密的组织的缓存时间；其他实例启用加密后，本实例最迟在此时间后开始加密写入
+const dataKeyNegativeTTL = time.Minute
+
+// EncryptedDatabase 应用层加密：启用了加密的组织，其条目的 title/url/original_title/ai_generated_title/domain
+// 与 metadata 以组织数据密钥（AES-256-GCM）加密后写入，读取时透明解密。
+// 加密是"软"的：启用前写入的条目保持明文可读，在下一次修改时重写为密文。
+type EncryptedDatabase struct {
+	DatabaseInterface
+
+	wrapper encryption.KeyWrapper
+	keys    *sync.Map // orgID -> *orgCipher，进程内共享
+}
+
+type orgCipher struct {
+	cipher    *encryption.FieldCipher // nil 表示组织未启用加密
+	expiresAt time.Time               // 仅对 nil 生效
+}
+
+// NewEncryptedDatabase 在 inner 之上启用应用层加密
+func NewEncryptedDatabase(inner DatabaseInterface, wrapper encryption.KeyWrapper) *EncryptedDatabase {
+	fmt.Printf("🔐 Application-layer item encryption available\n")
+	return &EncryptedDatabase{DatabaseInterface: inner, wrapper: wrapper, keys: &sync.Map{}}
+}
+
+// WithContext 实现 contextBinder
+func (db *EncryptedDatabase) WithContext(ctx context.Context) DatabaseInterface {
+	c := *db
+	c.DatabaseInterface = WithContext(db.DatabaseInterface, ctx)
+	return &c
+}
+
+// cipherForOrg 返回组织的字段加密器，未启用加密时返回 nil
+func (db *EncryptedDatabase) cipherForOrg(orgID string) (*encryption.FieldCipher, error) {
+	if v, ok := db.keys.Load(orgID); ok {
+		entry := v.(*orgCipher)
+		if entry.cipher != nil || time.Now().Before(entry.expiresAt) {
+			return entry.cipher, nil
+		}
+	}
+	wrapped, err := db.DatabaseInterface.GetOrganizationDataKey(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if wrapped == "" {
+		db.keys.Store(orgID, &orgCipher{expiresAt: time.Now().Add(dataKeyNegativeTTL)})
+		return nil, nil
+	}
+	dataKey, err := db.wrapper.Unwrap(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key for organization %s: %w", orgID, err)
+	}
+	c, err := encryption.NewFieldCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	db.keys.Store(orgID, &orgCipher{cipher: c})
+	return c, nil
+}
+
+// cipherForCollection 返回集合所属组织的字段加密器
+func (db *EncryptedDatabase) cipherForCollection(collectionID string) (*encryption.FieldCipher, error) {
+	orgID, err := db.DatabaseInterface.GetCollectionOrganizationID(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	return db.cipherForOrg(orgID)
+}
+
+// SetOrganizationDataKey 写入后清除本实例的缓存，使后续写入立即加密
+func (db *EncryptedDatabase) SetOrganizationDataKey(orgID, wrappedKey string) error {
+	if err := db.DatabaseInterface.SetOrganizationDataKey(orgID, wrappedKey); err != nil {
+		return err
+	}
+	db.keys.Delete(orgID)
+	return nil
+}
+
+// ================ 字段加解密 =================
+
+// encryptedFields 返回条目中需要加密的字符串字段
+func encryptedFields(it *models.CollectionItem) map[string]*string {
+	return map[string]*string{
+		"title":              &it.Title,
+		"url":                &it.URL,
+		"original_title":     &it.OriginalTitle,
+		"ai_generated_title": &it.AIGeneratedTitle,
+		"domain":             &it.Domain,
+	}
+}
+
+// encryptItem 原地加密条目字段（已是密文的值保持不变）
+func encryptItem(c *encryption.FieldCipher, it *models.CollectionItem) error {
+	metadata, err := encryptMetadata(c, it.Metadata, it.URL)
+	if err != nil {
+		return err
+	}
+	for field, value := range encryptedFields(it) {
+		enc, err := c.Encrypt(field, *value)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt item %s: %w", field, err)
+		}
+		*value = enc
+	}
+	it.Metadata = metadata
+	return nil
+}
+
+// decryptItem 原地解密条目字段；c 为 nil 时要求条目中没有密文
+func decryptItem(c *encryption.FieldCipher, it *models.CollectionItem) error {
+	if !itemEncrypted(it) {
+		return nil
+	}
+	if c == nil {
+		return fmt.Errorf("item %s is encrypted but its organization has no data key", it.ID)
+	}
+	for field, value := range encryptedFields(it) {
+		dec, err := c.Decrypt(field, *value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt item %s %s: %w", it.ID, field, err)
+		}
+		*value = dec
+	}
+	metadata, err := decryptMetadata(c, it.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt item %s metadata: %w", it.ID, err)
+	}
+	it.Metadata = metadata
+	return nil
+}
+
+// itemEncrypted 条目是否含有密文（明文条目读取时无需查找数据密钥）
+func itemEncrypted(it *models.CollectionItem) bool {
+	for _, value := range encryptedFields(it) {
+		if encryption.IsEncrypted(*value) {
+			return true
+		}
+	}
+	_, ok := encryptedMetadataValue(it.Metadata)
+	return ok
+}
+
+// encryptedMetadataValue 返回加密 metadata 中的密文（原 metadata 为空时只有盲索引，密文为空串）
+func encryptedMetadataValue(metadata []byte) (string, bool) {
+	var fields map[string]interface{}
+	if json.Unmarshal(metadata, &fields) != nil {
+		return "", false
+	}
+	if enc, ok := fields[encryptedMetadataKey].(string); ok && encryption.IsEncrypted(enc) {
+		return enc, true
+	}
+	index, _ := fields["normalized_url"].(string)
+	return "", len(fields) == 1 && strings.HasPrefix(index, encryption.BlindIndexPrefix)
+}
+
+// encryptMetadata 加密 metadata 并附带 normalized_url 盲索引（与处理器去重时的规范化规则一致）
+func encryptMetadata(c *encryption.FieldCipher, metadata []byte, url string) ([]byte, error) {
+	if _, ok := encryptedMetadataValue(metadata); ok {
+		return metadata, nil
+	}
+	var fields map[string]interface{}
+	_ = json.Unmarshal(metadata, &fields)
+	normalizedURL, _ := fields["normalized_url"].(string)
+	if strings.TrimSpace(normalizedURL) == "" {
+		normalizedURL = strings.ToLower(strings.TrimSpace(url))
+	}
+
+	out := map[string]string{}
+	if len(fields) > 0 {
+		enc, err := c.Encrypt("metadata", string(metadata))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt item metadata: %w", err)
+		}
+		out[encryptedMetadataKey] = enc
+	}
+	if strings.TrimSpace(normalizedURL) != "" {
+		out["normalized_url"] = c.BlindIndex(normalizedURL)
+	}
+	return json.Marshal(out)
+}
+
+func decryptMetadata(c *encryption.FieldCipher, metadata []byte) ([]byte, error) {
+	enc, ok := encryptedMetadataValue(metadata)
+	if !ok {
+		return metadata, nil
+	}
+	if enc == "" {
+		return []byte("{}"), nil
+	}
+	plaintext, err := c.Decrypt("metadata", enc)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(plaintext), nil
+}
+
+// ================ Collection Items =================
+
+func (db *EncryptedDatabase) CreateCollectionItem(it *models.CollectionItem) error {
+	c, err := db.cipherForCollection(it.CollectionID)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return db.DatabaseInterface.CreateCollectionItem(it)
+	}
+	row := *it
+	if err := encryptItem(c, &row); err != nil {
+		return err
+	}
+	if err := db.DatabaseInterface.CreateCollectionItem(&row); err != nil {
+		return err
+	}
+	it.ID, it.CreatedAt, it.UpdatedAt = row.ID, row.CreatedAt, row.UpdatedAt
+	return nil
+}
+
+func (db *EncryptedDatabase) GetCollectionItem(id string) (*models.CollectionItem, error) {
+	it, err := db.DatabaseInterface.GetCollectionItem(id)
+	if err != nil {
+		return nil, err
+	}
+	return it, db.decrypt(it)
+}
+
+func (db *EncryptedDatabase) UpdateCollectionItem(it *models.CollectionItem) error {
+	c, err := db.cipherForCollection(it.CollectionID)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return db.DatabaseInterface.UpdateCollectionItem(it)
+	}
+	row := *it
+	if err := encryptItem(c, &row); err != nil {
+		return err
+	}
+	if err := db.DatabaseInterface.UpdateCollectionItem(&row); err != nil {
+		return err
+	}
+	it.UpdatedAt = row.UpdatedAt
+	return nil
+}
+
+// UpdateCollectionItemPartial patch 涉及加密字段或移动集合时，先解密当前条目并合并 patch，
+// 再以目标集合所属组织的密钥重写全部加密字段（盲索引依赖 url 与 metadata，不能只加密 patch 中的字段）
+func (db *EncryptedDatabase) UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) (*models.CollectionItem, error) {
+	touches := false
+	for k := range patch {
+		switch k {
+		case "collection_id", "title", "url", "original_title", "ai_generated_title", "domain", "metadata":
+			touches = true
+		}
+	}
+	if !touches {
+		it, err := db.DatabaseInterface.UpdateCollectionItemPartial(itemID, patch)
+		if err != nil {
+			return nil, err
+		}
+		return it, db.decrypt(it)
+	}
+
+	current, err := db.GetCollectionItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	targetCollection := current.CollectionID
+	if s, ok := patch["collection_id"].(string); ok && strings.TrimSpace(s) != "" {
+		targetCollection = s
+	}
+	c, err := db.cipherForCollection(targetCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := *current
+	for field, value := range encryptedFields(&merged) {
+		if s, ok := patch[field].(string); ok {
+			*value = s
+		}
+	}
+	if v, ok := patch["metadata"]; ok && v != nil {
+		switch vv := v.(type) {
+		case []byte:
+			merged.Metadata = vv
+		default:
+			bs, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata: %w", err)
+			}
+			merged.Metadata = bs
+		}
+	}
+	if c != nil {
+		if err := encryptItem(c, &merged); err != nil {
+			return nil, err
+		}
+	}
+
+	rewritten := make(map[string]interface{}, len(patch)+6)
+	for k, v := range patch {
+		rewritten[k] = v
+	}
+	for field, value := range encryptedFields(&merged) {
+		rewritten[field] = *value
+	}
+	rewritten["metadata"] = merged.Metadata
+
+	it, err := db.DatabaseInterface.UpdateCollectionItemPartial(itemID, rewritten)
+	if err != nil {
+		return nil, err
+	}
+	return it, decryptItem(c, it)
+}
+
+func (db *EncryptedDatabase) ListItemsByCollection(collectionID, state string) ([]models.CollectionItem, error) {
+	items, err := db.DatabaseInterface.ListItemsByCollection(collectionID, state)
+	if err != nil {
+		return nil, err
+	}
+	var c *encryption.FieldCipher
+	for i := range items {
+		if !itemEncrypted(&items[i]) {
+			continue
+		}
+		if c == nil {
+			if c, err = db.cipherForCollection(collectionID); err != nil {
+				return nil, err
+			}
+		}
+		if err := decryptItem(c, &items[i]); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// ListItemsBySpace 空间内的集合属于同一组织，加密器只需查找一次
+func (db *EncryptedDatabase) ListItemsBySpace(spaceID, state string) ([]models.CollectionItem, error) {
+	items, err := db.DatabaseInterface.ListItemsBySpace(spaceID, state)
+	if err != nil {
+		return nil, err
+	}
+	var c *encryption.FieldCipher
+	for i := range items {
+		if !itemEncrypted(&items[i]) {
+			continue
+		}
+		if c == nil {
+			if c, err = db.cipherForCollection(items[i].CollectionID); err != nil {
+				return nil, err
+			}
+		}
+		if err := decryptItem(c, &items[i]); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// ListRecentItems 最近条目来自同一组织的空间，加密器只需查找一次
+func (db *EncryptedDatabase) ListRecentItems(spaceIDs []string, limit int) ([]models.RecentItem, []models.RecentItem, error) {
+	added, deleted, err := db.DatabaseInterface.ListRecentItems(spaceIDs, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	var c *encryption.FieldCipher
+	for _, list := range [][]models.RecentItem{added, deleted} {
+		for i := range list {
+			it := &list[i].CollectionItem
+			if !itemEncrypted(it) {
+				continue
+			}
+			if c == nil {
+				if c, err = db.cipherForCollection(it.CollectionID); err != nil {
+					return nil, nil, err
+				}
+			}
+			if err := decryptItem(c, it); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return added, deleted, nil
+}
+
+// FindItemByCollectionAndNormalizedURL 加密组织先按盲索引查找，未命中再按明文查找启用前写入的条目
+func (db *EncryptedDatabase) FindItemByCollectionAndNormalizedURL(collectionID, normalizedURL string) (*models.CollectionItem, error) {
+	c, err := db.cipherForCollection(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		it, err := db.DatabaseInterface.FindItemByCollectionAndNormalizedURL(collectionID, c.BlindIndex(normalizedURL))
+		if err == nil {
+			return it, decryptItem(c, it)
+		}
+	}
+	it, err := db.DatabaseInterface.FindItemByCollectionAndNormalizedURL(collectionID, normalizedURL)
+	if err != nil {
+		return nil, err
+	}
+	return it, decryptItem(c, it)
+}
+
+// decrypt 解密单个条目，只有含密文时才查找数据密钥
+// ListItemRevisions 历史版本由触发器按库内原值记录，加密组织的历史同样是密文，读取时解密
+func (db *EncryptedDatabase) ListItemRevisions(itemID string, limit int) ([]models.ItemRevision, error) {
+	revisions, err := db.DatabaseInterface.ListItemRevisions(itemID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		if err := db.decryptRevision(&revisions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return revisions, nil
+}
+
+func (db *EncryptedDatabase) GetItemRevision(itemID, revisionID string) (*models.ItemRevision, error) {
+	rev, err := db.DatabaseInterface.GetItemRevision(itemID, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	return rev, db.decryptRevision(rev)
+}
+
+// decryptRevision 以记录时所在集合的组织密钥解密（复用条目的字段解密逻辑）
+func (db *EncryptedDatabase) decryptRevision(rev *models.ItemRevision) error {
+	it := models.CollectionItem{ID: rev.ItemID, Title: rev.Title, URL: rev.URL, Metadata: rev.Metadata}
+	if !itemEncrypted(&it) {
+		return nil
+	}
+	c, err := db.cipherForCollection(rev.CollectionID)
+	if err != nil {
+		return err
+	}
+	if err := decryptItem(c, &it); err != nil {
+		return err
+	}
+	rev.Title, rev.URL, rev.Metadata = it.Title, it.URL, it.Metadata
+	return nil
+}
+
+func (db *EncryptedDatabase) decrypt(it *models.CollectionItem) error {
+	if it == nil || !itemEncrypted(it) {
+		return nil
+	}
+	c, err := db.cipherForCollection(it.CollectionID)
+	if err != nil {
+		return err
+	}
+	return decryptItem(c, it)
+}
+
+// ================ 汇总 =================
+
+// GetActivityDigest 摘要在库内按用户跨组织汇总，不逐条解密：加密条目以占位标题展示、不含链接
+func (db *EncryptedDatabase) GetActivityDigest(userID string, since time.Time) (*models.ActivityDigest, error) {
+	digest, err := db.DatabaseInterface.GetActivityDigest(userID, since)
+	if err != nil {
+		return nil, err
+	}
+	for _, items := range [][]models.DigestItem{digest.RecentItems, digest.DeadLinks} {
+		for i := range items {
+			if encryption.IsEncrypted(items[i].Title) {
+				items[i].Title = encryptedItemTitle
+			}
+			if encryption.IsEncrypted(items[i].URL) {
+				items[i].URL = ""
+			}
+		}
+	}
+	return digest, nil
+}
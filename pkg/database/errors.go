@@ -0,0 +1,86 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotFound 所有"记录不存在"错误的哨兵值，调用方使用 errors.Is(err, ErrNotFound) 判断
+var ErrNotFound = errors.New("not found")
+
+// NotFoundError 描述具体哪类实体不存在（user/organization/space/...）
+type NotFoundError struct {
+	Entity string
+}
+
+func (e *NotFoundError) Error() string { return e.Entity + " not found" }
+
+// Is 使 errors.Is(err, ErrNotFound) 成立
+func (e *NotFoundError) Is(target error) bool { return target == ErrNotFound }
+
+func notFound(entity string) error {
+	return &NotFoundError{Entity: entity}
+}
+
+// ErrAlreadyExists 所有"违反唯一约束"错误的哨兵值（如并发登录以同一邮箱创建用户）
+var ErrAlreadyExists = errors.New("already exists")
+
+// AlreadyExistsError 描述具体哪类实体已存在
+type AlreadyExistsError struct {
+	Entity string
+}
+
+func (e *AlreadyExistsError) Error() string { return e.Entity + " already exists" }
+
+// Is 使 errors.Is(err, ErrAlreadyExists) 成立
+func (e *AlreadyExistsError) Is(target error) bool { return target == ErrAlreadyExists }
+
+func alreadyExists(entity string) error {
+	return &AlreadyExistsError{Entity: entity}
+}
+
+// 优惠码兑换冲突：同一用户重复兑换、或兑换次数已用完
+var (
+	ErrPromoAlreadyRedeemed = errors.New("promo code already redeemed")
+	ErrPromoExhausted       = errors.New("promo code redemption limit reached")
+)
+
+// ErrUnavailable 数据库不可达（连接失败、网络错误、上游 503 等），调用方应返回 503 而非 500
+var ErrUnavailable = errors.New("database unavailable")
+
+// unavailable 包装为 ErrUnavailable，并使连接池缓存的健康状态失效（见 healthFresh）
+func unavailable(err error) error {
+	markUnavailable()
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
+
+// 数据驻留：组织请求了未配置的区域，或一次操作涉及不同区域的资源（如把条目移动到另一区域的集合）
+var (
+	ErrUnsupportedRegion = errors.New("data region not available")
+	ErrCrossRegion       = errors.New("resources belong to different data regions")
+)
+
+// ErrDataKeyExists 组织已启用应用层加密（数据密钥不可覆盖，否则已加密的条目将无法解密）
+var ErrDataKeyExists = errors.New("organization data key already exists")
+
+// ErrSlugTaken 组织 slug 已被其他组织使用
+var ErrSlugTaken = errors.New("organization slug already taken")
+
+// isUniqueViolation 判断写入是否违反唯一约束：Postgres 驱动返回 SQLSTATE 23505，
+// PostgREST 以 409 响应并在响应体中带同一错误码
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return strings.Contains(err.Error(), "status 409") && strings.Contains(err.Error(), `"23505"`)
+}
+
+// ErrIdentityLinked 该外部账户（provider + provider_user_id）已关联到其他用户
+var ErrIdentityLinked = errors.New("identity already linked to another user")
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// healthCheckTTL 复用连接时，距上次健康检查不足该时长且其间没有出现连接错误，则跳过 Ping
+const healthCheckTTL = 30 * time.Second
+
+// lastUnavailable 最近一次出现连接层错误（见 unavailable）的时间（UnixNano），0 表示尚未出现
+var lastUnavailable atomic.Int64
+
+// markUnavailable 记录连接错误，使缓存的健康状态失效，下次复用连接前重新检查
+func markUnavailable() {
+	lastUnavailable.Store(time.Now().UnixNano())
+}
+
+// healthFresh 报告 checkedAt 时的健康检查结果是否仍可信：未过期，且之后没有出现连接错误
+func healthFresh(checkedAt time.Time) bool {
+	if checkedAt.IsZero() || time.Since(checkedAt) > healthCheckTTL {
+		return false
+	}
+	return checkedAt.UnixNano() > lastUnavailable.Load()
+}
@@ -1,36 +1,73 @@
 package database
 
 import (
+    "encoding/json"
     "fmt"
     "os"
+    "time"
+
+    "tab-sync-backend-refactor/pkg/encryption"
     "tab-sync-backend-refactor/pkg/models"
 )
 
 // DatabaseInterface 定义数据库访问接口
+//
+// Update* 方法会用服务端写入后的行（RETURNING / return=representation）
+// 刷新传入的实体，调用方可直接把它返回给客户端，包含最新的 updated_at。
 type DatabaseInterface interface {
     // 用户管理
+    // CreateUser 邮箱已被使用时返回 ErrAlreadyExists
     CreateUser(user *models.User) error
     GetUserByEmail(email string) (*models.User, error)
     GetUserByID(id string) (*models.User, error)
+    // UpdateUser 只更新资料字段（name/avatar/provider），不修改 email 与 tier
     UpdateUser(user *models.User) error
     DeleteUser(id string) error
 
     // 用户订阅信息
     GetUserWithSubscription(userID string) (*models.UserWithSubscription, error)
+    // GetTokenVersion 返回 users.token_version：等级或组织成员关系变化时由触发器递增
+    GetTokenVersion(userID string) (int, error)
+    // RevokeUserSessions 吊销全部会话（设置 sessions_revoked_at，此前签发的刷新令牌失效）
+    RevokeUserSessions(userID string) error
+    // GetSessionsRevokedAt 返回最近一次会话吊销时间，从未吊销时为 nil
+    GetSessionsRevokedAt(userID string) (*time.Time, error)
+    // 计费字段（来自 Paddle webhook，见 postgres_billing.go / supabase_billing.go）
+    GetUserByPaddleCustomerID(customerID string) (*models.User, error)
+    UpdateUserBilling(userID string, update UserBillingUpdate) error
+    // UpdateUserTier 只修改等级（不触碰资料与其他计费字段）
+    UpdateUserTier(userID, tier string) error
+    // ListExpiredTrials 返回 trial_active 且 trial_ends_at 早于 before 的用户（before 取未来时间可同时得到即将到期的试用）
+    ListExpiredTrials(before time.Time) ([]models.UserWithSubscription, error)
+    // ListExpiredDunning 返回在 before 之前进入宽限期、仍未恢复付款的用户
+    ListExpiredDunning(before time.Time) ([]models.UserWithSubscription, error)
 
     // Organizations & Memberships
     CreateOrganization(org *models.Organization) error
     UpdateOrganization(org *models.Organization) error
     ListUserOrganizations(userID string) ([]models.Organization, error)
     GetOrganization(orgID string) (*models.Organization, error)
+    // GetOrganizationBySlug 按 slug 查找组织（slug 以小写存储），不做成员校验
+    GetOrganizationBySlug(slug string) (*models.Organization, error)
+    // SetOrganizationSlug 设置组织 slug，已被其他组织使用时返回 ErrSlugTaken
+    SetOrganizationSlug(orgID, slug string) error
     AddOrganizationMember(m *models.OrganizationMembership) error
     ListOrganizationMembers(orgID string) ([]models.OrganizationMembership, error)
+    // ListOrganizationMemberProfiles 按加入时间分页返回成员（附带姓名、邮箱、头像）及总数；limit <= 0 时返回全部
+    ListOrganizationMemberProfiles(orgID string, limit, offset int) ([]models.OrganizationMember, int, error)
+    // RemoveOrganizationMember 删除成员关系（触发器同时清除其在该组织各空间的显式权限与访客记录）；不是成员时返回 NotFound
+    RemoveOrganizationMember(orgID, userID string) error
+    // 应用层加密（见 encryption.go）：返回组织被主密钥包装的数据密钥，未启用加密时返回空串
+    GetOrganizationDataKey(orgID string) (string, error)
+    // SetOrganizationDataKey 仅在组织尚无数据密钥时写入（启用后不可更换），已存在时返回 ErrDataKeyExists
+    SetOrganizationDataKey(orgID, wrappedKey string) error
 
     // Spaces
     CreateSpace(space *models.Space) error
     ListSpacesByOrganization(orgID string) ([]models.Space, error)
     UpdateSpace(space *models.Space) error
-    GetSpaceByID(spaceID string) (*models.Space, error)
+    // GetSpaceByID 仅返回 userID 所属组织（owner 或成员）下的空间，否则视为不存在
+    GetSpaceByID(userID, spaceID string) (*models.Space, error)
     DeleteSpace(spaceID string) error
     SetSpacePermission(spaceID, userID string, canEdit bool) error
     GetSpacePermissions(spaceID string) ([]models.SpacePermission, error)
@@ -40,41 +77,235 @@ type DatabaseInterface interface {
     UpdateCollection(c *models.Collection) error
     DeleteCollection(id string) error
     ListCollectionsBySpace(spaceID string) ([]models.Collection, error)
-    GetCollection(id string) (*models.Collection, error)
+    // GetCollection 仅返回 userID 所属组织下的集合，否则视为不存在
+    GetCollection(userID, id string) (*models.Collection, error)
+    // GetCollectionOrganizationID 返回集合所属组织（不做成员校验，供加密层选择数据密钥）
+    GetCollectionOrganizationID(collectionID string) (string, error)
 
     // Collection Items
     CreateCollectionItem(it *models.CollectionItem) error
+    // GetCollectionItem loads a single item by id, including soft-deleted rows (DeletedAt set).
+    GetCollectionItem(id string) (*models.CollectionItem, error)
     // UpdateCollectionItem updates all provided fields on item; kept for backward compatibility.
     // Prefer UpdateCollectionItemPartial to avoid overwriting unspecified fields.
     UpdateCollectionItem(it *models.CollectionItem) error
     // UpdateCollectionItemPartial performs a partial update using the provided patch map.
     // Allowed keys: "collection_id","title","url","fav_icon_url","original_title",
-    // "ai_generated_title","domain","metadata","position".
-    UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) error
-    DeleteCollectionItem(id string) error
-    ListItemsByCollection(collectionID string) ([]models.CollectionItem, error)
+    // "ai_generated_title","domain","metadata","position". Returns the updated row.
+    UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) (*models.CollectionItem, error)
+    // DeleteCollectionItem 仅删除属于 collectionID 的条目；条目不属于该集合时返回 not found
+    DeleteCollectionItem(collectionID, id string) error
+    // ListItemsByCollection 列出未删除的条目；state 为 models.ItemStateActive / ItemStateArchived，空或 ItemStateAll 时返回全部
+    ListItemsByCollection(collectionID, state string) ([]models.CollectionItem, error)
+    // ListItemsBySpace 列出空间内未删除集合中的条目（智能集合在读取时据此求值），按创建时间倒序
+    ListItemsBySpace(spaceID, state string) ([]models.CollectionItem, error)
+    // ListRecentItems 返回 spaceIDs 内最近加入（未归档）与最近删除的条目，各至多 limit 条
+    ListRecentItems(spaceIDs []string, limit int) (added, deleted []models.RecentItem, err error)
     // Idempotency helpers
     FindItemByCollectionAndNormalizedURL(collectionID, normalizedURL string) (*models.CollectionItem, error)
+    // ListItemRevisions 按时间倒序返回条目被修改前的 title/url/metadata（修改时由触发器记录）
+    ListItemRevisions(itemID string, limit int) ([]models.ItemRevision, error)
+    GetItemRevision(itemID, revisionID string) (*models.ItemRevision, error)
+    // 快速保存后的元数据补全队列（见 postgres_item_enrichments.go / supabase_item_enrichments.go），只存条目 id
+    EnqueueItemEnrichment(itemID string) error
+    // ClaimItemEnrichments 认领至多 limit 个未认领（或认领早于 staleBefore）的条目并将 attempts 加一
+    ClaimItemEnrichments(limit int, staleBefore time.Time) ([]models.ItemEnrichment, error)
+    DeleteItemEnrichment(itemID string) error
+
+    // 条目提醒（见 postgres_item_reminders.go / supabase_item_reminders.go），按 (item_id, user_id) 每人一条
+    SetItemReminder(rem *models.ItemReminder) error
+    DeleteItemReminder(userID, itemID string) error
+    // ListItemReminders 按 remind_at 升序返回用户的全部提醒（含已触发的）
+    ListItemReminders(userID string) ([]models.ItemReminder, error)
+    // ClaimDueItemReminders 认领至多 limit 个到期未触发的提醒并将 notified_at 设为 now
+    ClaimDueItemReminders(now time.Time, limit int) ([]models.ItemReminder, error)
+
+    // 网页存档（见 postgres_web_archive.go / supabase_web_archive.go）：组织 opt-in 与提交队列，队列只存条目 id
+    GetWebArchiveEnabled(orgID string) (bool, error)
+    // SetWebArchiveEnabled 关闭时同时清空该组织尚未完成的存档任务
+    SetWebArchiveEnabled(orgID, userID string, enabled bool) error
+    EnqueueWebArchiveJob(itemID, orgID string) error
+    // ClaimWebArchiveJobs 认领至多 limit 个 next_attempt_at 不晚于 now、未认领（或认领早于 staleBefore）的任务
+    ClaimWebArchiveJobs(limit int, now, staleBefore time.Time) ([]models.WebArchiveJob, error)
+    // UpdateWebArchiveJob 保存 job_id / attempts / next_attempt_at 并释放认领
+    UpdateWebArchiveJob(j *models.WebArchiveJob) error
+    DeleteWebArchiveJob(itemID string) error
+
+    // 浏览器历史导入（见 postgres_history_imports.go / supabase_history_imports.go）：进度由各批次计数汇总
+    CreateHistoryImport(imp *models.HistoryImport) error
+    // GetHistoryImport 仅返回属于 userID 的导入，附带已记录的批次序号与计数合计
+    GetHistoryImport(userID, id string) (*models.HistoryImport, error)
+    // RecordHistoryImportBatch 记录批次结果；同一序号已记录时保留原结果
+    RecordHistoryImportBatch(b *models.HistoryImportBatch) error
+    CompleteHistoryImport(id string) error
+
+    // 组织域名策略（见 postgres_domain_policies.go / supabase_domain_policies.go）与违规审计
+    ListDomainPolicies(orgID string) ([]models.DomainPolicy, error)
+    // SetDomainPolicy 按 (organization_id, domain) 新增或覆盖
+    SetDomainPolicy(p *models.DomainPolicy) error
+    DeleteDomainPolicy(orgID, domain string) error
+    RecordPolicyViolations(vs []models.PolicyViolation) error
+    // ListPolicyViolations 按时间倒序返回至多 limit 条
+    ListPolicyViolations(orgID string, limit int) ([]models.PolicyViolation, error)
+
+    // DeleteSpacePermission 删除显式权限
+    DeleteSpacePermission(spaceID, userID string) error
+    // ListPermissionGrants 返回用户在各组织的角色及可访问空间的权限要素（见 postgres_permissions.go / supabase_permissions.go）
+    ListPermissionGrants(userID string) ([]models.PermissionGrant, error)
+
+    // 空间访客邀请（见 postgres_space_guests.go / supabase_space_guests.go）
+    CreateSpaceInvitation(inv *models.SpaceInvitation) error
+    // 邀请令牌只以摘要存储：按 token 查找时对传入值求摘要，读出的邀请不含 token
+    GetSpaceInvitationByToken(token string) (*models.SpaceInvitation, error)
+    GetSpaceInvitationByID(id string) (*models.SpaceInvitation, error)
+    UpdateSpaceInvitation(inv *models.SpaceInvitation) error
+    // 空间访客（space_guests，与空间同库）：只有接受过访客邀请的用户才是访客，单有显式权限不算
+    // AddSpaceGuest 记录访客并写入其显式权限
+    AddSpaceGuest(spaceID, userID, invitationID string, canEdit bool) error
+    // RemoveSpaceGuest 删除访客记录及其显式权限
+    RemoveSpaceGuest(spaceID, userID string) error
+    // ListSpaceGuests 返回访客的 user_id、can_edit 与加入时间（不含用户资料）
+    ListSpaceGuests(spaceID string) ([]models.SpaceGuest, error)
 
     // Invitations
     CreateInvitation(inv *models.OrganizationInvitation) error
     GetInvitationByToken(token string) (*models.OrganizationInvitation, error)
-    ListInvitationsByEmail(email string) ([]models.OrganizationInvitation, error)
+    GetInvitationByID(id string) (*models.OrganizationInvitation, error)
+    // ListInvitationsForUser 返回 invitee_id 为 userID、或邮箱（不区分大小写）属于 emails 之一的邀请
+    ListInvitationsForUser(userID string, emails []string) ([]models.OrganizationInvitation, error)
     UpdateInvitation(inv *models.OrganizationInvitation) error
 
+    // A/B 实验曝光（见 postgres_experiments.go / supabase_experiments.go）
+    RecordExperimentExposure(userID, experimentKey, variant string) error
+
+    // 登录记录（见 postgres_login_events.go / supabase_login_events.go）
+    RecordLoginEvent(e *models.LoginEvent) error
+    // ListLoginEvents 按时间倒序返回用户最近的 limit 条登录记录
+    ListLoginEvents(userID string, limit int) ([]models.LoginEvent, error)
+
+    // 等级变化历史（见 postgres_tier_changes.go / supabase_tier_changes.go）
+    RecordTierChange(c *models.TierChange) error
+    // ListTierChanges 按时间倒序返回用户最近的 limit 条等级变化
+    ListTierChanges(userID string, limit int) ([]models.TierChange, error)
+
+    // 分块上传快照（见 postgres_snapshot_uploads.go / supabase_snapshot_uploads.go）
+    CreateSnapshotUpload(u *models.SnapshotUpload) error
+    // GetSnapshotUpload 仅返回属于 userID 且未过期的上传，附带已收到的分块序号与字节数
+    GetSnapshotUpload(userID, id string) (*models.SnapshotUpload, error)
+    // PutSnapshotUploadChunk 写入（覆盖）一个分块，重传同一序号是幂等的
+    PutSnapshotUploadChunk(uploadID string, index int, data []byte) error
+    // LoadSnapshotUploadChunks 按序号升序返回全部分块内容
+    LoadSnapshotUploadChunks(uploadID string) ([][]byte, error)
+    DeleteSnapshotUpload(id string) error
+    PurgeExpiredSnapshotUploads(before time.Time) (int, error)
+
     // 快照管理
-    SaveSnapshot(userID, name string, tabGroups []models.TabGroup) error
-    ListSnapshots(userID string) ([]SnapshotInfo, error)
+    // SaveSnapshot 按 (user_id, name) 插入或覆盖；kind 为空时保留已有快照的类型（新快照为 manual）
+    SaveSnapshot(userID, name, kind string, tabGroups []models.TabGroup) error
+    // ListSnapshots 按 updated_at 倒序列出快照；kind 为空时返回全部类型
+    ListSnapshots(userID, kind string) ([]SnapshotInfo, error)
     LoadSnapshot(userID, name string) (*LoadSnapshotResponse, error)
+    // LoadSnapshotRaw 加载快照但不解析 tab_groups，供大快照直接写入响应
+    LoadSnapshotRaw(userID, name string) (*RawSnapshot, error)
     DeleteSnapshot(userID, name string) error
+    // PruneSnapshots 删除 kind 类型中除最近更新的 keep 个以外的快照，返回删除条数
+    PruneSnapshots(userID, kind string, keep int) (int, error)
+
+    // 组织共享快照（见 postgres_org_snapshots.go / supabase_org_snapshots.go），数据驻留时存放在组织所在区域
+    // SaveOrgSnapshot 按 (organization_id, name) 插入或覆盖；created_by 保留首次保存者
+    SaveOrgSnapshot(orgID, userID, name string, tabGroups []models.TabGroup) error
+    ListOrgSnapshots(orgID string) ([]SnapshotInfo, error)
+    LoadOrgSnapshotRaw(orgID, name string) (*RawSnapshot, error)
+    DeleteOrgSnapshot(orgID, name string) error
 
-    // 订阅管理
+    // 订阅管理（user_subscriptions 镜像 Paddle 订阅，由 webhook 维护）
+    GetSubscriptionPlanByTier(tier models.UserTier) (*models.SubscriptionPlan, error)
     CreateSubscription(subscription *models.UserSubscription) error
     GetUserSubscription(userID string) (*models.UserSubscription, error)
     UpdateSubscription(subscription *models.UserSubscription) error
     CancelSubscription(userID string) error
+    // Paddle webhook 去重（见 postgres_webhook_events.go / supabase_webhook_events.go）
+    // ClaimWebhookEvent 记录事件 ID：首次投递返回 true，重复投递返回 false
+    ClaimWebhookEvent(eventID, eventType string) (bool, error)
+    // ReleaseWebhookEvent 删除事件记录（处理失败时调用，使 Paddle 的重试能重新处理）
+    ReleaseWebhookEvent(eventID string) error
+
+    // 优惠码（见 postgres_billing.go / supabase_billing.go）
+    GetPromoCode(code string) (*models.PromoCode, error)
+    HasRedeemedPromo(promoID, userID string) (bool, error)
+    // RedeemPromoCode 记录兑换并计数；重复兑换返回 ErrPromoAlreadyRedeemed，次数用完返回 ErrPromoExhausted
+    RedeemPromoCode(promoID, userID string) error
+
+    // 站内通知（见 postgres_notifications.go / supabase_notifications.go）
+    // CreateNotification 写入通知；DedupeKey 已存在时不重复写入（n.ID 保持为空）
+    CreateNotification(n *models.Notification) error
+    // ListNotifications 按时间倒序分页返回通知及总数
+    ListNotifications(userID string, unreadOnly bool, limit, offset int) ([]models.Notification, int, error)
+    CountUnreadNotifications(userID string) (int, error)
+    // MarkNotificationsRead 将指定通知（ids 为空时为全部）标记为已读，返回更新条数
+    MarkNotificationsRead(userID string, ids []string) (int, error)
+    // 通知偏好与每周摘要
+    GetNotificationPreferences(userID string) (*models.NotificationPreferences, error)
+    UpdateNotificationPreferences(prefs *models.NotificationPreferences) error
+    // ListDigestRecipients 返回开启每周摘要、且上次发送早于 sentBefore（或从未发送）的用户，最多 limit 个
+    ListDigestRecipients(sentBefore time.Time, limit int) ([]models.User, error)
+    MarkDigestSent(userID string, at time.Time) error
+    // GetActivityDigest 汇总 since 之后用户所在组织的新增条目、新共享给用户的空间与失效链接
+    GetActivityDigest(userID string, since time.Time) (*models.ActivityDigest, error)
+
+    // GDPR 数据导出（见 postgres_exports.go / supabase_exports.go）
+    CreateDataExport(e *models.DataExport) error
+    // GetLatestDataExport 返回用户最近一次导出
+    GetLatestDataExport(userID string) (*models.DataExport, error)
+    // GetDataExport 仅返回属于 userID 的导出，否则视为不存在
+    GetDataExport(userID, id string) (*models.DataExport, error)
+    // GetDataExportArchive 返回导出及其 zip 内容（签名下载链接使用，不校验用户）
+    GetDataExportArchive(id string) (*models.DataExport, []byte, error)
+    // ClaimDataExports 将最多 limit 个 pending（或 processing 超过 staleBefore 的）导出标记为 processing 并返回
+    ClaimDataExports(limit int, staleBefore time.Time) ([]models.DataExport, error)
+    CompleteDataExport(id string, archive []byte, expiresAt time.Time) error
+    FailDataExport(id, reason string) error
+    // PurgeExpiredDataExports 清空 expires_at 早于 before 的归档并标记为 expired，返回条数
+    PurgeExpiredDataExports(before time.Time) (int, error)
+
+    // 一次性会话码（见 postgres_session_codes.go / supabase_session_codes.go）
+    // ConsumeSessionCode 记录会话码 JTI 已兑换：首次兑换返回 true，重放返回 false；顺带清理已过期的记录
+    ConsumeSessionCode(jti, userID string, expiresAt time.Time) (bool, error)
+
+    // 外部身份（见 postgres_identities.go / supabase_identities.go）
+    // GetUserIdentity 按 provider + provider_user_id 查找关联
+    GetUserIdentity(provider, providerUserID string) (*models.UserIdentity, error)
+    ListUserIdentities(userID string) ([]models.UserIdentity, error)
+    // LinkUserIdentity 建立关联；已关联到同一用户时视为成功，已关联到其他用户时返回 ErrIdentityLinked
+    LinkUserIdentity(identity *models.UserIdentity) error
+
+    // 设备（见 postgres_devices.go / supabase_devices.go）
+    // RegisterDevice 按 (user_id, install_id) 插入或更新设备信息，刷新 last_seen 并清除吊销状态
+    RegisterDevice(d *models.Device) error
+    // GetDevice 仅返回属于 userID 的设备，否则视为不存在
+    GetDevice(userID, id string) (*models.Device, error)
+    // ListDevices 按 last_seen 倒序返回用户的全部设备（含已吊销）
+    ListDevices(userID string) ([]models.Device, error)
+    // TouchDevice 刷新 last_seen；cursor 非空时同时更新 last_sync_cursor。已吊销或不存在时返回 ErrNotFound
+    TouchDevice(userID, id string, cursor *string) error
+    RevokeDevice(userID, id string) error
+    // ListDeviceSpaces 返回设备订阅同步的空间（选择性同步）；为空表示同步全部空间
+    ListDeviceSpaces(deviceID string) ([]string, error)
+    // SetDeviceSpaces 整体替换设备的空间订阅；spaceIDs 为空即恢复同步全部空间
+    SetDeviceSpaces(deviceID string, spaceIDs []string) error
+
+    // 发送到设备（见 postgres_device_pushes.go / supabase_device_pushes.go）
+    CreateDevicePush(p *models.DevicePush) error
+    // GetDevicePush 仅返回属于 userID 的推送，否则视为不存在
+    GetDevicePush(userID, id string) (*models.DevicePush, error)
+    // ClaimDevicePushes 返回目标设备在 createdAfter 之后尚未处理的推送（按创建时间升序），并将 pending 标记为 delivered
+    ClaimDevicePushes(userID, deviceID string, createdAfter time.Time) ([]models.DevicePush, error)
+    // CompleteDevicePush 记录目标设备的处理结果（opened/dismissed）；已完成的推送返回 ErrNotFound
+    CompleteDevicePush(userID, id string, status models.DevicePushStatus) error
 
     // AI 额度管理
+    // GrantAICredits 向用户当前周期追加积分（无当前周期时新建一个月的周期）
+    GrantAICredits(userID string, amount int) error
     GetUserAICredits(userID string) (*models.AICredits, error)
     UpdateAICredits(credits *models.AICredits) error
     ConsumeAICredits(userID string, amount int) error
@@ -89,6 +320,8 @@ type DatabaseInterface interface {
 // SnapshotInfo 列表信息（用于本地/远程统一返回）
 type SnapshotInfo struct {
     Name       string `json:"name"`
+    Kind       string `json:"kind"`
+    CreatedBy  string `json:"created_by,omitempty"` // 仅组织共享快照
     CreatedAt  string `json:"created_at"`
     UpdatedAt  string `json:"updated_at"`
     TabCount   int    `json:"tab_count"`
@@ -103,17 +336,111 @@ type LoadSnapshotResponse struct {
     UpdatedAt string            `json:"updatedAt"`
 }
 
+// UserBillingUpdate 用户计费字段的部分更新；nil 字段保持不变
+type UserBillingUpdate struct {
+    Tier             *string
+    PaddleCustomerID *string
+    // 终身会员：LifetimeMemberType 为空字符串时清空（退款/拒付）
+    IsLifetimeMember   *bool
+    LifetimeMemberType *string
+    // 试用
+    TrialEndsAt *time.Time
+    TrialActive *bool
+    // 催缴：DunningStatus 为空字符串时同时清空 dunning_started_at（付款恢复）
+    DunningStatus    *string
+    DunningStartedAt *time.Time
+}
+
+// RawSnapshot 快照原文：TabGroups 为数据库中存储的 JSON 数组，未经反序列化
+type RawSnapshot struct {
+    Name      string
+    TabGroups json.RawMessage
+    CreatedAt time.Time
+    UpdatedAt time.Time
+}
+
+// 数据库驱动（DatabaseConfig.Driver）；本地文件数据库已移除，不再提供 sqlite/local
+const (
+    DriverPostgres = "postgres"
+    DriverSupabase = "supabase"
+)
+
 // DatabaseConfig 数据库配置（仅保留外部数据库）
 type DatabaseConfig struct {
-    PostgresDSN string
-    SupabaseURL string
-    SupabaseKey string
-    Debug       bool
+    // Driver 显式指定驱动（DriverPostgres/DriverSupabase）；为空时按环境自动选择（见 newDatabase）
+    Driver          string
+    PostgresDSN     string
+    PostgresReadDSN string // 可选只读副本，仅在使用 PostgreSQL 时生效
+    SupabaseURL     string
+    SupabaseReadURL string // 可选只读端点，仅在使用 Supabase 时生效
+    SupabaseKey     string
+    // SnapshotCompression 新写入的快照以 gzip 压缩存储 tab_groups（读取总是透明解压）
+    SnapshotCompression bool
+    Debug               bool
+    // 数据驻留（可选）：HomeRegion 为主库所在区域，RegionDSNs 为其他区域的 PostgreSQL 区域库（区域 -> DSN）
+    HomeRegion string
+    RegionDSNs map[string]string
+    // EncryptionMasterKey 应用层加密主密钥（base64 编码的 32 字节）；为空时不启用加密层
+    EncryptionMasterKey string
+    // Pool PostgreSQL 应用侧连接池参数（主库、只读副本与区域库共用）；零值字段按环境取默认值
+    Pool PoolConfig
+}
+
+// newSupabaseFromConfig 创建 Supabase 实例并设置可选的只读端点
+func newSupabaseFromConfig(config DatabaseConfig) DatabaseInterface {
+    db := NewSupabaseDatabase(config.SupabaseURL, config.SupabaseKey)
+    db.(*SupabaseDatabase).setReadURL(config.SupabaseReadURL)
+    return db
 }
 
 // NewDatabase 根据环境与配置选择数据库实现
-// 已移除本地文件数据库的支持
-func NewDatabase(config DatabaseConfig) DatabaseInterface {
+// 已移除本地文件数据库的支持；连接失败时返回错误而非 panic，由调用方降级处理
+func NewDatabase(config DatabaseConfig) (DatabaseInterface, error) {
+    db, err := newDatabase(config)
+    if err != nil {
+        return nil, err
+    }
+    if c, ok := db.(snapshotCompressor); ok {
+        c.setSnapshotCompression(config.SnapshotCompression)
+    }
+    db = NewCachedDatabase(db)
+    if len(config.RegionDSNs) > 0 {
+        if db, err = NewRegionalDatabase(db, config.HomeRegion, config.RegionDSNs); err != nil {
+            return nil, err
+        }
+    }
+    tunePostgresPools(db, config.Pool.withDefaults(isVercelEnvironment()))
+    // 加密层在最外层：区域路由看到的已是密文
+    if config.EncryptionMasterKey != "" {
+        wrapper, err := encryption.NewLocalKeyWrapper(config.EncryptionMasterKey)
+        if err != nil {
+            return nil, fmt.Errorf("invalid ENCRYPTION_MASTER_KEY: %w", err)
+        }
+        return NewEncryptedDatabase(db, wrapper), nil
+    }
+    return db, nil
+}
+
+func newDatabase(config DatabaseConfig) (DatabaseInterface, error) {
+    // 显式指定驱动时不做回退：配置缺失直接报错，避免静默连到另一个库
+    switch config.Driver {
+    case "":
+    case DriverPostgres:
+        if config.PostgresDSN == "" {
+            return nil, fmt.Errorf("DB_DRIVER=postgres requires POSTGRES_DSN")
+        }
+        fmt.Printf("🗄️  Using PostgreSQL database (DB_DRIVER)\n")
+        return NewPostgresDatabaseWithReplica(config.PostgresDSN, config.PostgresReadDSN)
+    case DriverSupabase:
+        if config.SupabaseURL == "" || config.SupabaseKey == "" {
+            return nil, fmt.Errorf("DB_DRIVER=supabase requires SUPABASE_URL+SUPABASE_SERVICE_KEY")
+        }
+        fmt.Printf("🧰  Using Supabase REST API (DB_DRIVER)\n")
+        return newSupabaseFromConfig(config), nil
+    default:
+        return nil, fmt.Errorf("unsupported database driver %q: use postgres or supabase", config.Driver)
+    }
+
     // 是否在 Vercel 生产环境
     isVercelProduction := isVercelEnvironment()
 
@@ -123,31 +450,31 @@ func NewDatabase(config DatabaseConfig) DatabaseInterface {
         // Vercel 优先使用 Supabase（避免 IPv6）
         if config.SupabaseURL != "" && config.SupabaseKey != "" {
             fmt.Printf("🚀  Using Supabase REST API (Vercel optimized)\n")
-            return NewSupabaseDatabase(config.SupabaseURL, config.SupabaseKey)
+            return newSupabaseFromConfig(config), nil
         }
 
         // 次选 PostgreSQL
         if config.PostgresDSN != "" {
             fmt.Printf("🌐  Using PostgreSQL in Vercel (may have IPv6 issues)\n")
-            return NewPostgresDatabase(config.PostgresDSN)
+            return NewPostgresDatabaseWithReplica(config.PostgresDSN, config.PostgresReadDSN)
         }
 
         // 未配置受支持的数据库，直接失败
-        panic("No valid database configured for Vercel environment. Please set SUPABASE_URL+SUPABASE_SERVICE_KEY or POSTGRES_DSN")
+        return nil, fmt.Errorf("no valid database configured for Vercel environment: set SUPABASE_URL+SUPABASE_SERVICE_KEY or POSTGRES_DSN")
     }
 
     // 非 Vercel 环境：PostgreSQL > Supabase
     if config.PostgresDSN != "" {
         fmt.Printf("🗄️  Using PostgreSQL database\n")
-        return NewPostgresDatabase(config.PostgresDSN)
+        return NewPostgresDatabaseWithReplica(config.PostgresDSN, config.PostgresReadDSN)
     }
 
     if config.SupabaseURL != "" && config.SupabaseKey != "" {
         fmt.Printf("🧰  Using Supabase REST API\n")
-        return NewSupabaseDatabase(config.SupabaseURL, config.SupabaseKey)
+        return newSupabaseFromConfig(config), nil
     }
 
-    panic("No valid database configuration found. Please configure POSTGRES_DSN or SUPABASE_URL+SUPABASE_SERVICE_KEY")
+    return nil, fmt.Errorf("no valid database configuration found: configure POSTGRES_DSN or SUPABASE_URL+SUPABASE_SERVICE_KEY")
 }
 
 // isVercelEnvironment 内部检查 Vercel 环境
@@ -159,6 +486,6 @@ func isVercelEnvironment() bool {
 }
 
 // NewDatabaseFromConfig 已弃用：避免误用本地数据库
-func NewDatabaseFromConfig(cfg interface{}) DatabaseInterface {
-    panic("NewDatabaseFromConfig is deprecated. Please construct DatabaseConfig with Postgres or Supabase settings.")
+func NewDatabaseFromConfig(cfg interface{}) (DatabaseInterface, error) {
+    return nil, fmt.Errorf("NewDatabaseFromConfig is deprecated: construct DatabaseConfig with Postgres or Supabase settings")
 }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -9,9 +10,10 @@ import (
 // DatabasePool 数据库连接池
 type DatabasePool struct {
 	instance DatabaseInterface
-	config   DatabaseConfig
-	mu       sync.RWMutex
-	lastUsed time.Time
+	config    DatabaseConfig
+	mu        sync.RWMutex
+	lastUsed  time.Time
+	checkedAt time.Time // 最近一次健康检查通过的时间（见 healthFresh）
 }
 
 var (
@@ -19,8 +21,8 @@ var (
 	poolMutex  sync.Mutex
 )
 
-// GetDatabase 获取数据库连接（单例模式 + 连接池）
-func GetDatabase(config DatabaseConfig) DatabaseInterface {
+// GetDatabase 获取数据库连接（单例模式 + 连接池）；连接失败时不缓存，下次请求重新尝试
+func GetDatabase(config DatabaseConfig) (DatabaseInterface, error) {
 	poolMutex.Lock()
 	defer poolMutex.Unlock()
 
@@ -32,17 +34,18 @@ func GetDatabase(config DatabaseConfig) DatabaseInterface {
 		if globalPool != nil && globalPool.instance != nil {
 			globalPool.instance.Close()
 		}
+		globalPool = nil
 
 		// 创建新连接
-        instance := NewDatabase(config)
-        // 调整应用侧连接池（若为 PostgreSQL 实现）
-        if psql, ok := instance.(*PostgresDatabase); ok {
-            psql.tunePoolParams()
+        instance, err := NewDatabase(config)
+        if err != nil {
+            return nil, err
         }
 		globalPool = &DatabasePool{
 			instance: instance,
-			config:   config,
-			lastUsed: time.Now(),
+			config:    config,
+			lastUsed:  time.Now(),
+			checkedAt: time.Now(),
 		}
 	} else {
 		// 更新最后使用时间
@@ -53,7 +56,7 @@ func GetDatabase(config DatabaseConfig) DatabaseInterface {
 		fmt.Printf("♻️  Reusing existing database connection\n")
 	}
 
-	return globalPool.instance
+	return globalPool.instance, nil
 }
 
 // shouldRecreateConnection 判断是否需要重新创建连接
@@ -78,20 +81,37 @@ func shouldRecreateConnection(pool *DatabasePool, newConfig DatabaseConfig) bool
 		return true
 	}
 
-	// 检查连接健康状态
+	// 检查连接健康状态（结果缓存 healthCheckTTL，出现连接错误后重新检查）
+	pool.mu.RLock()
+	fresh := healthFresh(pool.checkedAt)
+	pool.mu.RUnlock()
+	if fresh {
+		return false
+	}
 	if err := pool.instance.HealthCheck(); err != nil {
 		fmt.Printf("❌ Database health check failed, recreating: %v\n", err)
 		return true
 	}
+	pool.mu.Lock()
+	pool.checkedAt = time.Now()
+	pool.mu.Unlock()
 
 	return false
 }
 
 // configEquals 比较两个数据库配置是否相等
 func configEquals(a, b DatabaseConfig) bool {
-    return a.PostgresDSN == b.PostgresDSN &&
+    return a.Driver == b.Driver &&
+        a.PostgresDSN == b.PostgresDSN &&
+        a.PostgresReadDSN == b.PostgresReadDSN &&
         a.SupabaseURL == b.SupabaseURL &&
-        a.SupabaseKey == b.SupabaseKey
+        a.SupabaseReadURL == b.SupabaseReadURL &&
+        a.SupabaseKey == b.SupabaseKey &&
+        a.SnapshotCompression == b.SnapshotCompression &&
+        a.HomeRegion == b.HomeRegion &&
+        fmt.Sprint(a.RegionDSNs) == fmt.Sprint(b.RegionDSNs) &&
+        a.EncryptionMasterKey == b.EncryptionMasterKey &&
+        a.Pool == b.Pool
 }
 
 // CleanupIdleConnections 清理空闲连接（可以在后台定期调用）
@@ -116,6 +136,22 @@ func CleanupIdleConnections() {
 	}
 }
 
+// RunIdleCleanup 按 interval 定期清理空闲连接（连接池与 Vercel 优化器），直到 ctx 结束。
+// 供常驻进程（独立服务器）在启动时 go 调用、关闭时 cancel；无服务器环境不需要，取连接时会顺带清理
+func RunIdleCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			CleanupIdleConnections()
+			GetVercelOptimizer().cleanupExpiredConnections()
+		}
+	}
+}
+
 // GetConnectionStats 获取连接池统计信息
 func GetConnectionStats() map[string]interface{} {
 	poolMutex.Lock()
@@ -138,6 +174,7 @@ func GetConnectionStats() map[string]interface{} {
 		"age":       time.Since(lastUsed).String(),
         "config": map[string]interface{}{
             "has_postgres": globalPool.config.PostgresDSN != "",
+            "has_replica":  globalPool.config.PostgresReadDSN != "",
             "has_supabase": globalPool.config.SupabaseURL != "",
         },
     }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -9,16 +10,48 @@ import (
 
 	"tab-sync-backend-refactor/pkg/models"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // PostgresDatabase PostgreSQL数据库实现
 type PostgresDatabase struct {
-	db *sql.DB
+	db   *sql.DB
+	read *sql.DB         // 只读副本（POSTGRES_READ_DSN），为空时读请求走主库
+	ctx  context.Context // 请求上下文（见 WithContext），为空时使用 Background
+
+	compressSnapshots bool // 以 gzip 压缩存储 tab_groups（见 snapshot_codec.go）
 }
 
-// NewPostgresDatabase 创建PostgreSQL数据库实例
-func NewPostgresDatabase(dsn string) DatabaseInterface {
+// NewPostgresDatabase 创建PostgreSQL数据库实例；所有连接策略都失败时返回 ErrUnavailable
+func NewPostgresDatabase(dsn string) (DatabaseInterface, error) {
+	db, err := openPostgres(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresDatabase{db: db}, nil
+}
+
+// NewPostgresDatabaseWithReplica 创建带只读副本的实例：List*/Get* 走副本，副本不可达时回退主库。
+// 副本连接失败不影响启动，只记录警告。
+func NewPostgresDatabaseWithReplica(dsn, readDSN string) (DatabaseInterface, error) {
+	db, err := openPostgres(dsn)
+	if err != nil {
+		return nil, err
+	}
+	pg := &PostgresDatabase{db: db}
+	if strings.TrimSpace(readDSN) != "" {
+		if read, err := openPostgres(readDSN); err != nil {
+			fmt.Printf("⚠️  Read replica unavailable, reads will use the primary: %v\n", err)
+		} else {
+			fmt.Printf("📖 PostgreSQL read replica enabled\n")
+			pg.read = read
+		}
+	}
+	return pg, nil
+}
+
+// openPostgres 依次尝试多种连接策略，返回第一个能 Ping 通的连接
+func openPostgres(dsn string) (*sql.DB, error) {
 	// 尝试多种连接策略来解决Vercel Lambda的IPv6问题
 	// Sanitize DSN to avoid stray CR/LF from env values
 	dsn = strings.TrimSpace(dsn)
@@ -41,11 +74,7 @@ func NewPostgresDatabase(dsn string) DatabaseInterface {
 			continue
 		}
 
-		// 设置连接池参数，适合无服务器环境
-		db.SetMaxOpenConns(5)                  // 限制最大连接数
-		db.SetMaxIdleConns(2)                  // 限制空闲连接数
-		db.SetConnMaxLifetime(5 * time.Minute) // 连接最大生命周期
-
+		// 连接池参数由 NewDatabase 统一设置（见 PoolConfig），这里只验证连通性
 		// 测试连接
 		if err = db.Ping(); err != nil {
 			fmt.Printf("❌ Strategy %d failed to ping: %v\n", i+1, err)
@@ -54,11 +83,11 @@ func NewPostgresDatabase(dsn string) DatabaseInterface {
 		}
 
 		fmt.Printf("✅ PostgreSQL connection established successfully with strategy %d\n", i+1)
-		return &PostgresDatabase{db: db}
+		return db, nil
 	}
 
 	// 所有策略都失败了
-	panic(fmt.Sprintf("Failed to connect to PostgreSQL with all strategies. Last error: %v", err))
+	return nil, unavailable(fmt.Errorf("failed to connect to PostgreSQL with all strategies: %w", err))
 }
 
 // addConnectionParams 添加连接参数到DSN
@@ -80,12 +109,13 @@ func (db *PostgresDatabase) CreateUser(user *models.User) error {
     if user.Provider == "" {
         user.Provider = "email"
     }
+    user.Email = models.NormalizeEmail(user.Email)
     // Debug: 打印当前数据库/Schema 和 public.users 列，确认运行时连接与结构
     {
         var dbName, currSchema, searchPath string
-        _ = db.db.QueryRow("SELECT current_database(), current_schema(), array_to_string(current_schemas(true), ',')").Scan(&dbName, &currSchema, &searchPath)
+        _ = db.queryRow("SELECT current_database(), current_schema(), array_to_string(current_schemas(true), ',')").Scan(&dbName, &currSchema, &searchPath)
         fmt.Printf("DEBUG[PG] current_database=%s, current_schema=%s, search_path=%s\n", dbName, currSchema, searchPath)
-        if rows, err := db.db.Query("SELECT column_name, data_type FROM information_schema.columns WHERE table_schema='public' AND table_name='users' ORDER BY ordinal_position"); err == nil {
+        if rows, err := db.query("SELECT column_name, data_type FROM information_schema.columns WHERE table_schema='public' AND table_name='users' ORDER BY ordinal_position"); err == nil {
             defer rows.Close()
             cols := []string{}
             for rows.Next() {
@@ -103,8 +133,11 @@ func (db *PostgresDatabase) CreateUser(user *models.User) error {
         RETURNING id, created_at, updated_at
     `
     var createdAt, updatedAt time.Time
-    err := db.db.QueryRow(query, user.Email, user.Password, user.Name, user.Avatar, user.Provider).
+    err := db.queryRow(query, user.Email, user.Password, user.Name, user.Avatar, user.Provider).
         Scan(&user.ID, &createdAt, &updatedAt)
+    if isUniqueViolation(err) {
+        return alreadyExists("user")
+    }
     if err != nil {
         return fmt.Errorf("failed to create user: %w", err)
     }
@@ -113,57 +146,43 @@ func (db *PostgresDatabase) CreateUser(user *models.User) error {
     return nil
 }
 
+// userColumns 用户资料的完整列（与 scanUser 顺序一致）；读取后整行交给 UpdateUser 不会丢失字段
+const userColumns = `id, email, COALESCE(name,''), COALESCE(avatar,''), COALESCE(provider,'email'),
+               COALESCE(password_hash,''), COALESCE(tier,'free'), created_at, updated_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+    var u models.User
+    if err := row.Scan(&u.ID, &u.Email, &u.Name, &u.Avatar, &u.Provider, &u.Password, &u.Tier, &u.CreatedAt, &u.UpdatedAt); err != nil {
+        return nil, err
+    }
+    return &u, nil
+}
+
 // GetUserByEmail 根据邮箱获取用户
 func (db *PostgresDatabase) GetUserByEmail(email string) (*models.User, error) {
-    query := `
-        SELECT id, email, COALESCE(name,''), COALESCE(avatar,''), COALESCE(provider,'email'),
-               COALESCE(password_hash,''), created_at, updated_at
-        FROM public.users
-        WHERE email = $1
-    `
-    var u models.User
-    var createdAt, updatedAt time.Time
-    err := db.db.QueryRow(query, email).Scan(
-        &u.ID, &u.Email, &u.Name, &u.Avatar, &u.Provider, &u.Password, &createdAt, &updatedAt,
-    )
+    u, err := scanUser(db.queryRowRead(`SELECT `+userColumns+` FROM public.users WHERE lower(email) = $1`, models.NormalizeEmail(email)))
     if err != nil {
         if err == sql.ErrNoRows {
-            return nil, fmt.Errorf("user not found")
+            return nil, notFound("user")
         }
         return nil, fmt.Errorf("failed to get user by email: %w", err)
     }
-    u.CreatedAt = createdAt
-    u.UpdatedAt = updatedAt
-    return &u, nil
+    return u, nil
 }
 
-// GetUserByID 根据ID获取用户
+// GetUserByID 根据ID获取用户（完整资料）
 func (db *PostgresDatabase) GetUserByID(id string) (*models.User, error) {
-    query := `
-        SELECT id, email, created_at, updated_at
-        FROM public.users
-        WHERE id = $1
-    `
-
-	var user models.User
-	err := db.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Email, &user.CreatedAt, &user.UpdatedAt,
-	)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
-		}
-		return nil, fmt.Errorf("failed to get user: %w", err)
-	}
-
-	// 设置默认值
-	user.Provider = "email"
-
-	return &user, nil
+    u, err := scanUser(db.queryRowRead(`SELECT `+userColumns+` FROM public.users WHERE id = $1`, id))
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, notFound("user")
+        }
+        return nil, fmt.Errorf("failed to get user: %w", err)
+    }
+    return u, nil
 }
 
-// UpdateUser 更新用户
+// UpdateUser 更新用户资料（name/avatar/provider）；不修改等级，等级走 UpdateUserTier / UpdateUserBilling
 func (db *PostgresDatabase) UpdateUser(user *models.User) error {
     if user.ID == "" {
         return fmt.Errorf("user ID is required for update")
@@ -175,8 +194,13 @@ func (db *PostgresDatabase) UpdateUser(user *models.User) error {
             provider = COALESCE($3, provider),
             updated_at = NOW()
         WHERE id = $4
+        RETURNING email, COALESCE(name, ''), COALESCE(avatar, ''), COALESCE(provider, 'email'), COALESCE(tier, 'free'), created_at, updated_at
     `
-    _, err := db.db.Exec(query, user.Name, user.Avatar, user.Provider, user.ID)
+    err := db.queryRow(query, user.Name, user.Avatar, user.Provider, user.ID).
+        Scan(&user.Email, &user.Name, &user.Avatar, &user.Provider, &user.Tier, &user.CreatedAt, &user.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return notFound("user")
+    }
     if err != nil {
         return fmt.Errorf("failed to update user: %w", err)
     }
@@ -198,8 +222,11 @@ func (db *PostgresDatabase) GetUserWithSubscription(userID string) (*models.User
             COALESCE(u.tier::text, 'free') as tier,
             u.paddle_customer_id,
             u.trial_ends_at,
+            COALESCE(u.trial_active, false) as trial_active,
             COALESCE(u.is_lifetime_member, false) as is_lifetime_member,
-            u.lifetime_member_type
+            u.lifetime_member_type,
+            COALESCE(u.dunning_status, '') as dunning_status,
+            u.dunning_started_at
         FROM public.users u
         WHERE u.id = $1
     `
@@ -207,15 +234,16 @@ func (db *PostgresDatabase) GetUserWithSubscription(userID string) (*models.User
 	var userWithSub models.UserWithSubscription
 	var tierStr string
 
-	err := db.db.QueryRow(query, userID).Scan(
+	err := db.queryRowRead(query, userID).Scan(
 		&userWithSub.ID, &userWithSub.Email, &userWithSub.CreatedAt, &userWithSub.UpdatedAt,
-		&tierStr, &userWithSub.PaddleCustomerID, &userWithSub.TrialEndsAt,
+		&tierStr, &userWithSub.PaddleCustomerID, &userWithSub.TrialEndsAt, &userWithSub.TrialActive,
 		&userWithSub.IsLifetimeMember, &userWithSub.LifetimeMemberType,
+		&userWithSub.DunningStatus, &userWithSub.DunningStartedAt,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, notFound("user")
 		}
 		return nil, fmt.Errorf("failed to get user with subscription: %w", err)
 	}
@@ -237,8 +265,8 @@ func (db *PostgresDatabase) GetUserWithSubscription(userID string) (*models.User
 	return &userWithSub, nil
 }
 
-// SaveSnapshot 保存快照
-func (db *PostgresDatabase) SaveSnapshot(userID, name string, tabGroups []models.TabGroup) error {
+// SaveSnapshot 保存快照（kind 为空时保留已有快照的类型，新快照为 manual）
+func (db *PostgresDatabase) SaveSnapshot(userID, name, kind string, tabGroups []models.TabGroup) error {
 	// 计算统计信息
 	groupCount := len(tabGroups)
 	tabCount := 0
@@ -246,25 +274,26 @@ func (db *PostgresDatabase) SaveSnapshot(userID, name string, tabGroups []models
 		tabCount += len(group.Tabs)
 	}
 
-	// 将tabGroups转换为JSON
-	tabGroupsJSON, err := json.Marshal(tabGroups)
+	// 将tabGroups转换为JSON（按配置压缩）
+	tabGroupsJSON, err := encodeTabGroups(tabGroups, db.compressSnapshots)
 	if err != nil {
-		return fmt.Errorf("failed to marshal tab groups: %w", err)
+		return err
 	}
 
 	// 使用UPSERT语句（INSERT ... ON CONFLICT）
 	query := `
-		INSERT INTO snapshots (user_id, name, tab_groups, group_count, tab_count, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		INSERT INTO snapshots (user_id, name, kind, tab_groups, group_count, tab_count, created_at, updated_at)
+		VALUES ($1, $2, COALESCE(NULLIF($6, ''), 'manual'), $3, $4, $5, NOW(), NOW())
 		ON CONFLICT (user_id, name)
 		DO UPDATE SET
+			kind = COALESCE(NULLIF($6, ''), snapshots.kind),
 			tab_groups = EXCLUDED.tab_groups,
 			group_count = EXCLUDED.group_count,
 			tab_count = EXCLUDED.tab_count,
 			updated_at = NOW()
 	`
 
-	_, err = db.db.Exec(query, userID, name, tabGroupsJSON, groupCount, tabCount)
+	_, err = db.exec(query, userID, name, []byte(tabGroupsJSON), groupCount, tabCount, kind)
 	if err != nil {
 		return fmt.Errorf("failed to save snapshot: %w", err)
 	}
@@ -273,16 +302,16 @@ func (db *PostgresDatabase) SaveSnapshot(userID, name string, tabGroups []models
 	return nil
 }
 
-// ListSnapshots 列出快照
-func (db *PostgresDatabase) ListSnapshots(userID string) ([]SnapshotInfo, error) {
+// ListSnapshots 列出快照（kind 为空时返回全部类型）
+func (db *PostgresDatabase) ListSnapshots(userID, kind string) ([]SnapshotInfo, error) {
 	query := `
-		SELECT name, created_at, updated_at, group_count, tab_count
+		SELECT name, kind, created_at, updated_at, group_count, tab_count
 		FROM snapshots
-		WHERE user_id = $1
+		WHERE user_id = $1 AND ($2 = '' OR kind = $2)
 		ORDER BY updated_at DESC
 	`
 
-	rows, err := db.db.Query(query, userID)
+	rows, err := db.queryRead(query, userID, kind)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query snapshots: %w", err)
 	}
@@ -294,7 +323,7 @@ func (db *PostgresDatabase) ListSnapshots(userID string) ([]SnapshotInfo, error)
 		var createdAt, updatedAt time.Time
 
 		err := rows.Scan(
-			&snapshot.Name, &createdAt, &updatedAt,
+			&snapshot.Name, &snapshot.Kind, &createdAt, &updatedAt,
 			&snapshot.GroupCount, &snapshot.TabCount,
 		)
 		if err != nil {
@@ -325,18 +354,22 @@ func (db *PostgresDatabase) LoadSnapshot(userID, name string) (*LoadSnapshotResp
 	var tabGroupsJSON []byte
 	var createdAt, updatedAt time.Time
 
-	err := db.db.QueryRow(query, userID, name).Scan(
+	err := db.queryRow(query, userID, name).Scan(
 		&response.Name, &tabGroupsJSON, &createdAt, &updatedAt,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("snapshot not found")
+			return nil, notFound("snapshot")
 		}
 		return nil, fmt.Errorf("failed to load snapshot: %w", err)
 	}
 
-	// 解析JSON
+	// 解析JSON（压缩存储的快照先解压）
+	tabGroupsJSON, err = decodeTabGroups(tabGroupsJSON)
+	if err != nil {
+		return nil, err
+	}
 	err = json.Unmarshal(tabGroupsJSON, &response.TabGroups)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal tab groups: %w", err)
@@ -348,11 +381,37 @@ func (db *PostgresDatabase) LoadSnapshot(userID, name string) (*LoadSnapshotResp
 	return &response, nil
 }
 
+// LoadSnapshotRaw 加载快照，tab_groups 按 JSONB 原文返回
+func (db *PostgresDatabase) LoadSnapshotRaw(userID, name string) (*RawSnapshot, error) {
+	query := `
+		SELECT name, tab_groups, created_at, updated_at
+		FROM snapshots
+		WHERE user_id = $1 AND name = $2
+	`
+
+	var snapshot RawSnapshot
+	var tabGroups []byte
+	err := db.queryRow(query, userID, name).Scan(
+		&snapshot.Name, &tabGroups, &snapshot.CreatedAt, &snapshot.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("snapshot")
+		}
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	snapshot.TabGroups, err = decodeTabGroups(tabGroups)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
 // DeleteSnapshot 删除快照
 func (db *PostgresDatabase) DeleteSnapshot(userID, name string) error {
 	query := `DELETE FROM snapshots WHERE user_id = $1 AND name = $2`
 
-	result, err := db.db.Exec(query, userID, name)
+	result, err := db.exec(query, userID, name)
 	if err != nil {
 		return fmt.Errorf("failed to delete snapshot: %w", err)
 	}
@@ -363,41 +422,50 @@ func (db *PostgresDatabase) DeleteSnapshot(userID, name string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("snapshot not found")
+		return notFound("snapshot")
 	}
 
 	fmt.Printf("🗑️ Deleted snapshot '%s' for user %s\n", name, userID)
 	return nil
 }
 
-// CreateSubscription 创建订阅
-func (db *PostgresDatabase) CreateSubscription(subscription *models.UserSubscription) error {
-	// TODO: 实现PostgreSQL订阅创建
-	return fmt.Errorf("CreateSubscription not implemented for PostgreSQL")
-}
-
-// GetUserSubscription 获取用户订阅
-func (db *PostgresDatabase) GetUserSubscription(userID string) (*models.UserSubscription, error) {
-	// TODO: 实现PostgreSQL订阅查询
-	return nil, fmt.Errorf("GetUserSubscription not implemented for PostgreSQL")
-}
-
-// UpdateSubscription 更新订阅
-func (db *PostgresDatabase) UpdateSubscription(subscription *models.UserSubscription) error {
-	// TODO: 实现PostgreSQL订阅更新
-	return fmt.Errorf("UpdateSubscription not implemented for PostgreSQL")
-}
-
-// CancelSubscription 取消订阅
-func (db *PostgresDatabase) CancelSubscription(userID string) error {
-	// TODO: 实现PostgreSQL订阅取消
-	return fmt.Errorf("CancelSubscription not implemented for PostgreSQL")
+// PruneSnapshots 删除 kind 类型中除最近更新的 keep 个以外的快照
+func (db *PostgresDatabase) PruneSnapshots(userID, kind string, keep int) (int, error) {
+	result, err := db.exec(`
+		DELETE FROM snapshots
+		WHERE user_id = $1 AND kind = $2 AND id NOT IN (
+			SELECT id FROM snapshots WHERE user_id = $1 AND kind = $2
+			ORDER BY updated_at DESC
+			LIMIT $3
+		)
+	`, userID, kind, keep)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune snapshots: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		fmt.Printf("🧹 Pruned %d %s snapshots for user %s (kept %d)\n", n, kind, userID, keep)
+	}
+	return int(n), nil
 }
 
-// GetUserAICredits 获取AI积分
+// GetUserAICredits 返回当前周期（period_end 晚于现在的最新一期）的 AI 积分；没有当前周期时返回 not found
 func (db *PostgresDatabase) GetUserAICredits(userID string) (*models.AICredits, error) {
-	// TODO: 实现PostgreSQL AI积分查询
-	return nil, fmt.Errorf("GetUserAICredits not implemented for PostgreSQL")
+	var c models.AICredits
+	err := db.queryRowRead(`
+		SELECT id, user_id, credits_total, credits_used, credits_remaining, period_start, period_end, created_at, updated_at
+		FROM public.ai_credits
+		WHERE user_id = $1 AND period_end > NOW()
+		ORDER BY period_end DESC
+		LIMIT 1`, userID).
+		Scan(&c.ID, &c.UserID, &c.CreditsTotal, &c.CreditsUsed, &c.CreditsRemaining, &c.PeriodStart, &c.PeriodEnd, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, notFound("ai credits")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ai credits: %w", err)
+	}
+	return &c, nil
 }
 
 // UpdateAICredits 更新AI积分
@@ -414,41 +482,100 @@ func (db *PostgresDatabase) ConsumeAICredits(userID string, amount int) error {
 
 // HealthCheck 健康检查
 func (db *PostgresDatabase) HealthCheck() error {
-	return db.db.Ping()
+	return db.db.PingContext(db.reqCtx())
 }
 
 // Close 关闭连接
 func (db *PostgresDatabase) Close() error {
+    if db.read != nil {
+        db.read.Close()
+    }
     return db.db.Close()
 }
 
-// tunePoolParams 调整应用侧连接池参数（主要池化由 Neon/pgBouncer 负责）
-func (db *PostgresDatabase) tunePoolParams() {
+// PoolConfig 应用侧连接池参数（主要池化由 Neon/pgBouncer 负责）；零值字段使用默认值（见 withDefaults）
+type PoolConfig struct {
+    MaxOpenConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
+    ConnMaxIdleTime time.Duration
+}
+
+// withDefaults 补全未设置的字段：无服务器环境每个实例只处理少量并发请求，且实例数可能很多，
+// 默认值保持小池与较短空闲时间，避免耗尽数据库连接数
+func (p PoolConfig) withDefaults(serverless bool) PoolConfig {
+    def := PoolConfig{MaxOpenConns: 20, MaxIdleConns: 10, ConnMaxLifetime: 5 * time.Minute, ConnMaxIdleTime: 2 * time.Minute}
+    if serverless {
+        def = PoolConfig{MaxOpenConns: 5, MaxIdleConns: 2, ConnMaxLifetime: 5 * time.Minute, ConnMaxIdleTime: time.Minute}
+    }
+    if p.MaxOpenConns <= 0 {
+        p.MaxOpenConns = def.MaxOpenConns
+    }
+    if p.MaxIdleConns <= 0 {
+        p.MaxIdleConns = def.MaxIdleConns
+    }
+    if p.MaxIdleConns > p.MaxOpenConns {
+        p.MaxIdleConns = p.MaxOpenConns
+    }
+    if p.ConnMaxLifetime <= 0 {
+        p.ConnMaxLifetime = def.ConnMaxLifetime
+    }
+    if p.ConnMaxIdleTime <= 0 {
+        p.ConnMaxIdleTime = def.ConnMaxIdleTime
+    }
+    return p
+}
+
+// tunePoolParams 把连接池参数应用到主库与只读副本
+func (db *PostgresDatabase) tunePoolParams(p PoolConfig) {
     if db == nil || db.db == nil {
         return
     }
-    db.db.SetMaxOpenConns(20)
-    db.db.SetMaxIdleConns(10)
-    db.db.SetConnMaxLifetime(5 * time.Minute)
-    db.db.SetConnMaxIdleTime(2 * time.Minute)
+    for _, pool := range []*sql.DB{db.db, db.read} {
+        if pool == nil {
+            continue
+        }
+        pool.SetMaxOpenConns(p.MaxOpenConns)
+        pool.SetMaxIdleConns(p.MaxIdleConns)
+        pool.SetConnMaxLifetime(p.ConnMaxLifetime)
+        pool.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+    }
+}
+
+// tunePostgresPools 穿过加密层与区域路由，调整所有 PostgreSQL 实例（主库与各区域库）的连接池
+func tunePostgresPools(db DatabaseInterface, p PoolConfig) {
+    switch d := db.(type) {
+    case *EncryptedDatabase:
+        tunePostgresPools(d.DatabaseInterface, p)
+    case *CachedDatabase:
+        tunePostgresPools(d.DatabaseInterface, p)
+    case *RegionalDatabase:
+        tunePostgresPools(d.DatabaseInterface, p)
+        for _, regional := range d.regions {
+            tunePostgresPools(regional, p)
+        }
+    case *PostgresDatabase:
+        d.tunePoolParams(p)
+    }
 }
 
 // ================= Organizations & Spaces & Invitations =================
 
 // Organizations
 func (db *PostgresDatabase) CreateOrganization(org *models.Organization) error {
+    // org.ID 非空时沿用（区域库中的组织副本与主库目录使用同一 ID）
     query := `
-        INSERT INTO organizations (name, owner_id, description, avatar, color, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+        INSERT INTO organizations (id, name, owner_id, description, avatar, color, region, created_at, updated_at)
+        VALUES (COALESCE($6::uuid, gen_random_uuid()), $1, $2, $3, $4, $5, $7, NOW(), NOW())
         RETURNING id, created_at, updated_at
     `
-    err := db.db.QueryRow(query, org.Name, org.OwnerID, org.Description, org.Avatar, org.Color).
+    err := db.queryRow(query, org.Name, org.OwnerID, org.Description, org.Avatar, org.Color, nullIfEmpty(org.ID), nullIfEmpty(org.Region)).
         Scan(&org.ID, &org.CreatedAt, &org.UpdatedAt)
     if err != nil {
         return fmt.Errorf("failed to create organization: %w", err)
     }
     // owner membership
-    _, err = db.db.Exec(`
+    _, err = db.exec(`
         INSERT INTO organization_memberships (organization_id, user_id, role, created_at)
         VALUES ($1, $2, 'owner', NOW())
         ON CONFLICT (organization_id, user_id) DO NOTHING
@@ -461,13 +588,13 @@ func (db *PostgresDatabase) CreateOrganization(org *models.Organization) error {
 
 func (db *PostgresDatabase) ListUserOrganizations(userID string) ([]models.Organization, error) {
     query := `
-        SELECT DISTINCT o.id, o.name, o.owner_id, o.description, o.avatar, COALESCE(o.color,''), o.created_at, o.updated_at
+        SELECT DISTINCT o.id, o.name, COALESCE(o.slug,''), o.owner_id, o.description, o.avatar, COALESCE(o.color,''), COALESCE(o.region,''), o.created_at, o.updated_at
         FROM organizations o
         LEFT JOIN organization_memberships m ON m.organization_id = o.id
         WHERE o.owner_id = $1 OR m.user_id = $1
         ORDER BY o.created_at DESC
     `
-    rows, err := db.db.Query(query, userID)
+    rows, err := db.queryRead(query, userID)
     if err != nil {
         return nil, fmt.Errorf("failed to list organizations: %w", err)
     }
@@ -475,7 +602,7 @@ func (db *PostgresDatabase) ListUserOrganizations(userID string) ([]models.Organ
     var result []models.Organization
     for rows.Next() {
         var o models.Organization
-        if err := rows.Scan(&o.ID, &o.Name, &o.OwnerID, &o.Description, &o.Avatar, &o.Color, &o.CreatedAt, &o.UpdatedAt); err != nil {
+        if err := rows.Scan(&o.ID, &o.Name, &o.Slug, &o.OwnerID, &o.Description, &o.Avatar, &o.Color, &o.Region, &o.CreatedAt, &o.UpdatedAt); err != nil {
             return nil, err
         }
         result = append(result, o)
@@ -484,12 +611,12 @@ func (db *PostgresDatabase) ListUserOrganizations(userID string) ([]models.Organ
 }
 
 func (db *PostgresDatabase) GetOrganization(orgID string) (*models.Organization, error) {
-    query := `SELECT id, name, owner_id, description, avatar, COALESCE(color,''), created_at, updated_at FROM organizations WHERE id = $1`
+    query := `SELECT id, name, COALESCE(slug,''), owner_id, description, avatar, COALESCE(color,''), COALESCE(region,''), created_at, updated_at FROM organizations WHERE id = $1`
     var o models.Organization
-    err := db.db.QueryRow(query, orgID).Scan(&o.ID, &o.Name, &o.OwnerID, &o.Description, &o.Avatar, &o.Color, &o.CreatedAt, &o.UpdatedAt)
+    err := db.queryRowRead(query, orgID).Scan(&o.ID, &o.Name, &o.Slug, &o.OwnerID, &o.Description, &o.Avatar, &o.Color, &o.Region, &o.CreatedAt, &o.UpdatedAt)
     if err != nil {
         if err == sql.ErrNoRows {
-            return nil, fmt.Errorf("organization not found")
+            return nil, notFound("organization")
         }
         return nil, fmt.Errorf("failed to get organization: %w", err)
     }
@@ -497,7 +624,7 @@ func (db *PostgresDatabase) GetOrganization(orgID string) (*models.Organization,
 }
 
 func (db *PostgresDatabase) UpdateOrganization(org *models.Organization) error {
-    _, err := db.db.Exec(`
+    err := db.queryRow(`
         UPDATE organizations
         SET name = COALESCE($1, name),
             description = COALESCE($2, description),
@@ -505,7 +632,10 @@ func (db *PostgresDatabase) UpdateOrganization(org *models.Organization) error {
             color = COALESCE($4, color),
             updated_at = NOW()
         WHERE id = $5
-    `, nullIfEmpty(org.Name), nullIfEmpty(org.Description), nullIfEmpty(org.Avatar), nullIfEmpty(org.Color), org.ID)
+        RETURNING id, name, COALESCE(slug,''), owner_id, description, avatar, COALESCE(color,''), COALESCE(region,''), created_at, updated_at
+    `, nullIfEmpty(org.Name), nullIfEmpty(org.Description), nullIfEmpty(org.Avatar), nullIfEmpty(org.Color), org.ID).
+        Scan(&org.ID, &org.Name, &org.Slug, &org.OwnerID, &org.Description, &org.Avatar, &org.Color, &org.Region, &org.CreatedAt, &org.UpdatedAt)
+    if err == sql.ErrNoRows { return notFound("organization") }
     return err
 }
 
@@ -514,6 +644,12 @@ func nullIfEmpty(s string) interface{} {
     return s
 }
 
+// sqlLimit LIMIT 参数：n <= 0 时为 NULL（LIMIT NULL 即不限制）
+func sqlLimit(n int) interface{} {
+    if n <= 0 { return nil }
+    return n
+}
+
 func (db *PostgresDatabase) AddOrganizationMember(m *models.OrganizationMembership) error {
     query := `
         INSERT INTO organization_memberships (organization_id, user_id, role, created_at)
@@ -521,7 +657,14 @@ func (db *PostgresDatabase) AddOrganizationMember(m *models.OrganizationMembersh
         ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role
         RETURNING id
     `
-    return db.db.QueryRow(query, m.OrganizationID, m.UserID, string(m.Role)).Scan(&m.ID)
+    return db.queryRow(query, m.OrganizationID, m.UserID, string(m.Role)).Scan(&m.ID)
+}
+
+func (db *PostgresDatabase) RemoveOrganizationMember(orgID, userID string) error {
+    res, err := db.exec(`DELETE FROM organization_memberships WHERE organization_id = $1 AND user_id = $2`, orgID, userID)
+    if err != nil { return fmt.Errorf("failed to remove member: %w", err) }
+    if n, _ := res.RowsAffected(); n == 0 { return notFound("member") }
+    return nil
 }
 
 func (db *PostgresDatabase) ListOrganizationMembers(orgID string) ([]models.OrganizationMembership, error) {
@@ -531,7 +674,7 @@ func (db *PostgresDatabase) ListOrganizationMembers(orgID string) ([]models.Orga
         WHERE organization_id = $1
         ORDER BY created_at ASC
     `
-    rows, err := db.db.Query(query, orgID)
+    rows, err := db.queryRead(query, orgID)
     if err != nil {
         return nil, fmt.Errorf("failed to list members: %w", err)
     }
@@ -549,52 +692,146 @@ func (db *PostgresDatabase) ListOrganizationMembers(orgID string) ([]models.Orga
     return result, nil
 }
 
+func (db *PostgresDatabase) ListOrganizationMemberProfiles(orgID string, limit, offset int) ([]models.OrganizationMember, int, error) {
+    var total int
+    if err := db.queryRowRead(`SELECT COUNT(*) FROM organization_memberships WHERE organization_id = $1`, orgID).Scan(&total); err != nil {
+        return nil, 0, fmt.Errorf("failed to count members: %w", err)
+    }
+    rows, err := db.queryRead(`
+        SELECT m.id, m.organization_id, m.user_id, m.role, m.created_at,
+               COALESCE(u.email,''), COALESCE(u.name,''), COALESCE(u.avatar,'')
+        FROM organization_memberships m
+        LEFT JOIN public.users u ON u.id = m.user_id
+        WHERE m.organization_id = $1
+        ORDER BY m.created_at ASC, m.id
+        LIMIT $2 OFFSET $3
+    `, orgID, sqlLimit(limit), offset)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to list members: %w", err)
+    }
+    defer rows.Close()
+    result := []models.OrganizationMember{}
+    for rows.Next() {
+        var m models.OrganizationMember
+        var role string
+        if err := rows.Scan(&m.ID, &m.OrganizationID, &m.UserID, &role, &m.CreatedAt, &m.Email, &m.Name, &m.Avatar); err != nil {
+            return nil, 0, err
+        }
+        m.Role = models.OrgMemberRole(role)
+        result = append(result, m)
+    }
+    return result, total, rows.Err()
+}
+
 // Spaces
+const spaceColumns = `s.id, s.organization_id, s.name, s.description, COALESCE(s.color,''), COALESCE(s.icon,''), s.is_default, COALESCE(s.default_access,'view'), COALESCE(s.visibility,'org'), s.created_at, s.updated_at`
+
+func scanSpace(row interface{ Scan(...interface{}) error }) (*models.Space, error) {
+    var s models.Space
+    if err := row.Scan(&s.ID, &s.OrganizationID, &s.Name, &s.Description, &s.Color, &s.Icon, &s.IsDefault, &s.DefaultAccess, &s.Visibility, &s.CreatedAt, &s.UpdatedAt); err != nil {
+        return nil, err
+    }
+    return &s, nil
+}
+
+// clearDefaultSpace 取消组织内其他空间的默认标记（keepID 为空时取消全部）。
+// 须与设为默认的写入处于同一事务，idx_spaces_single_default 保证每个组织至多一个默认空间
+func clearDefaultSpace(tx *sql.Tx, orgID, keepID string) error {
+    _, err := tx.Exec(`UPDATE spaces SET is_default=FALSE, updated_at=NOW()
+        WHERE organization_id=$1 AND is_default AND id::text <> $2`, orgID, keepID)
+    return err
+}
+
+// CreateSpace 创建空间；is_default 为 true 时在同一事务中取消原默认空间
 func (db *PostgresDatabase) CreateSpace(space *models.Space) error {
     query := `
-        INSERT INTO spaces (organization_id, name, description, is_default, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, NOW(), NOW())
-        RETURNING id, created_at, updated_at
+        INSERT INTO spaces (organization_id, name, description, color, icon, is_default, default_access, visibility, created_at, updated_at)
+        VALUES ($1, $2, $3, $7, $8, $4, COALESCE(NULLIF($5,''),'view'), COALESCE(NULLIF($6,''),'org'), NOW(), NOW())
+        RETURNING id, default_access, visibility, created_at, updated_at
     `
-    return db.db.QueryRow(query, space.OrganizationID, space.Name, space.Description, space.IsDefault).
-        Scan(&space.ID, &space.CreatedAt, &space.UpdatedAt)
+    args := []interface{}{space.OrganizationID, space.Name, space.Description, space.IsDefault, space.DefaultAccess, space.Visibility, space.Color, space.Icon}
+    if !space.IsDefault {
+        return db.queryRow(query, args...).Scan(&space.ID, &space.DefaultAccess, &space.Visibility, &space.CreatedAt, &space.UpdatedAt)
+    }
+    tx, err := db.begin()
+    if err != nil { return err }
+    if err := clearDefaultSpace(tx, space.OrganizationID, ""); err != nil {
+        _ = tx.Rollback()
+        return err
+    }
+    if err := tx.QueryRow(query, args...).Scan(&space.ID, &space.DefaultAccess, &space.Visibility, &space.CreatedAt, &space.UpdatedAt); err != nil {
+        _ = tx.Rollback()
+        return err
+    }
+    return tx.Commit()
 }
 
 func (db *PostgresDatabase) ListSpacesByOrganization(orgID string) ([]models.Space, error) {
-    rows, err := db.db.Query(`SELECT id, organization_id, name, description, is_default, created_at, updated_at FROM spaces WHERE organization_id = $1 AND deleted_at IS NULL ORDER BY created_at ASC`, orgID)
+    rows, err := db.queryRead(`SELECT `+spaceColumns+` FROM spaces s WHERE s.organization_id = $1 AND s.deleted_at IS NULL ORDER BY s.created_at ASC`, orgID)
     if err != nil {
         return nil, fmt.Errorf("failed to list spaces: %w", err)
     }
     defer rows.Close()
     var result []models.Space
     for rows.Next() {
-        var s models.Space
-        if err := rows.Scan(&s.ID, &s.OrganizationID, &s.Name, &s.Description, &s.IsDefault, &s.CreatedAt, &s.UpdatedAt); err != nil {
+        s, err := scanSpace(rows)
+        if err != nil {
             return nil, err
         }
-        result = append(result, s)
+        result = append(result, *s)
     }
     return result, nil
 }
 
+// UpdateSpace writes the space and refreshes it from the RETURNING row.
+// 设为默认时在同一事务中取消同组织原默认空间
 func (db *PostgresDatabase) UpdateSpace(space *models.Space) error {
-    _, err := db.db.Exec(`UPDATE spaces SET name=$1, description=$2, is_default=$3, updated_at=NOW() WHERE id=$4`, space.Name, space.Description, space.IsDefault, space.ID)
-    return err
+    query := `UPDATE spaces s SET name=$1, description=$2, is_default=$3, default_access=COALESCE(NULLIF($4,''),s.default_access),
+        visibility=COALESCE(NULLIF($5,''),s.visibility), color=$7, icon=$8, updated_at=NOW() WHERE s.id=$6
+        RETURNING `+spaceColumns
+    args := []interface{}{space.Name, space.Description, space.IsDefault, space.DefaultAccess, space.Visibility, space.ID, space.Color, space.Icon}
+    var s *models.Space
+    var err error
+    if !space.IsDefault {
+        s, err = scanSpace(db.queryRow(query, args...))
+    } else {
+        var tx *sql.Tx
+        if tx, err = db.begin(); err != nil { return err }
+        var orgID string
+        err = tx.QueryRow(`SELECT organization_id FROM spaces WHERE id=$1`, space.ID).Scan(&orgID)
+        if err == nil { err = clearDefaultSpace(tx, orgID, space.ID) }
+        if err == nil { s, err = scanSpace(tx.QueryRow(query, args...)) }
+        if err == nil {
+            err = tx.Commit()
+        } else {
+            _ = tx.Rollback()
+        }
+    }
+    if err == sql.ErrNoRows { return notFound("space") }
+    if err != nil { return err }
+    *space = *s
+    return nil
 }
 
-func (db *PostgresDatabase) GetSpaceByID(spaceID string) (*models.Space, error) {
-    var s models.Space
-    err := db.db.QueryRow(`SELECT id, organization_id, name, description, is_default, created_at, updated_at FROM spaces WHERE id = $1`, spaceID).
-        Scan(&s.ID, &s.OrganizationID, &s.Name, &s.Description, &s.IsDefault, &s.CreatedAt, &s.UpdatedAt)
+// spaceAccessScope 限定 s（spaces）为 $2 用户可访问：所属组织的 owner、organization_memberships 成员，
+// 或该空间的访客（space_guests 中有记录；单有 space_permissions 不算）
+const spaceAccessScope = `(o.owner_id = $2 OR EXISTS (
+        SELECT 1 FROM organization_memberships m WHERE m.organization_id = o.id AND m.user_id = $2) OR EXISTS (
+        SELECT 1 FROM space_guests g WHERE g.space_id = s.id AND g.user_id = $2))`
+
+func (db *PostgresDatabase) GetSpaceByID(userID, spaceID string) (*models.Space, error) {
+    s, err := scanSpace(db.queryRowRead(`SELECT `+spaceColumns+`
+        FROM spaces s JOIN organizations o ON o.id = s.organization_id
+        WHERE s.id = $1 AND `+spaceAccessScope, spaceID, userID))
     if err != nil {
-        if err == sql.ErrNoRows { return nil, fmt.Errorf("space not found") }
+        if err == sql.ErrNoRows { return nil, notFound("space") }
         return nil, fmt.Errorf("failed to get space: %w", err)
     }
-    return &s, nil
+    return s, nil
 }
 
 func (db *PostgresDatabase) DeleteSpace(spaceID string) error {
-    _, err := db.db.Exec(`DELETE FROM spaces WHERE id=$1`, spaceID)
+    _, err := db.exec(`DELETE FROM spaces WHERE id=$1`, spaceID)
     if err != nil {
         return fmt.Errorf("failed to delete space: %w", err)
     }
@@ -602,7 +839,7 @@ func (db *PostgresDatabase) DeleteSpace(spaceID string) error {
 }
 
 func (db *PostgresDatabase) SetSpacePermission(spaceID, userID string, canEdit bool) error {
-    _, err := db.db.Exec(`
+    _, err := db.exec(`
         INSERT INTO space_permissions (space_id, user_id, can_edit, created_at, updated_at)
         VALUES ($1, $2, $3, NOW(), NOW())
         ON CONFLICT (space_id, user_id) DO UPDATE SET can_edit = EXCLUDED.can_edit, updated_at = NOW()
@@ -611,7 +848,7 @@ func (db *PostgresDatabase) SetSpacePermission(spaceID, userID string, canEdit b
 }
 
 func (db *PostgresDatabase) GetSpacePermissions(spaceID string) ([]models.SpacePermission, error) {
-    rows, err := db.db.Query(`SELECT id, space_id, user_id, can_edit, created_at, updated_at FROM space_permissions WHERE space_id=$1`, spaceID)
+    rows, err := db.queryRead(`SELECT id, space_id, user_id, can_edit, created_at, updated_at FROM space_permissions WHERE space_id=$1`, spaceID)
     if err != nil {
         return nil, fmt.Errorf("failed to get space permissions: %w", err)
     }
@@ -630,33 +867,70 @@ func (db *PostgresDatabase) GetSpacePermissions(spaceID string) ([]models.SpaceP
 // Invitations
 func (db *PostgresDatabase) CreateInvitation(inv *models.OrganizationInvitation) error {
     query := `
-        INSERT INTO organization_invitations (organization_id, email, inviter_id, token, status, expires_at, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+        INSERT INTO organization_invitations (organization_id, email, invitee_id, inviter_id, token, status, expires_at, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
         RETURNING id, created_at, updated_at
     `
-    return db.db.QueryRow(query, inv.OrganizationID, inv.Email, inv.InviterID, inv.Token, string(inv.Status), inv.ExpiresAt).
+    inv.Email = models.NormalizeEmail(inv.Email)
+    return db.queryRow(query, inv.OrganizationID, inv.Email, inv.InviteeID, inv.InviterID, hashToken(inv.Token), string(inv.Status), inv.ExpiresAt).
         Scan(&inv.ID, &inv.CreatedAt, &inv.UpdatedAt)
 }
 
 // ================= Collections =================
 
+// collectionColumns 集合读取与 RETURNING 共用的列（表别名 c）
+const collectionColumns = `c.id, c.space_id, c.name, c.description, c.color, c.icon, c.position, c.item_count, c.last_item_added_at, COALESCE(c.type,'manual'), c.query, c.created_at, c.updated_at, c.deleted_at`
+
+func scanCollection(row interface{ Scan(...interface{}) error }) (*models.Collection, error) {
+    var c models.Collection
+    var query []byte
+    if err := row.Scan(&c.ID, &c.SpaceID, &c.Name, &c.Description, &c.Color, &c.Icon, &c.Position, &c.ItemCount, &c.LastItemAddedAt, &c.Type, &query, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt); err != nil {
+        return nil, err
+    }
+    if len(query) > 0 {
+        c.Query = &models.SmartQuery{}
+        if err := json.Unmarshal(query, c.Query); err != nil {
+            return nil, fmt.Errorf("invalid query on collection %s: %w", c.ID, err)
+        }
+    }
+    return &c, nil
+}
+
+// collectionQueryJSON 智能集合的查询定义（普通集合为 NULL）
+func collectionQueryJSON(c *models.Collection) ([]byte, error) {
+    if c.Query == nil {
+        return nil, nil
+    }
+    return json.Marshal(c.Query)
+}
+
 func (db *PostgresDatabase) CreateCollection(c *models.Collection) error {
-    query := `
-        INSERT INTO collections (space_id, name, description, color, icon, position, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, COALESCE($6,0), NOW(), NOW())
-        RETURNING id, created_at, updated_at
-    `
-    return db.db.QueryRow(query, c.SpaceID, c.Name, c.Description, c.Color, c.Icon, c.Position).Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
+    query, err := collectionQueryJSON(c)
+    if err != nil { return err }
+    return db.queryRow(`
+        INSERT INTO collections (space_id, name, description, color, icon, position, type, query, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, COALESCE($6,0), COALESCE(NULLIF($7,''),'manual'), $8, NOW(), NOW())
+        RETURNING id, type, created_at, updated_at
+    `, c.SpaceID, c.Name, c.Description, c.Color, c.Icon, c.Position, c.Type, query).Scan(&c.ID, &c.Type, &c.CreatedAt, &c.UpdatedAt)
 }
 
+// UpdateCollection writes the collection and refreshes it from the RETURNING row.
 func (db *PostgresDatabase) UpdateCollection(c *models.Collection) error {
-    _, err := db.db.Exec(`UPDATE collections SET name=$1, description=$2, color=$3, icon=$4, position=$5, updated_at=NOW() WHERE id=$6`,
-        c.Name, c.Description, c.Color, c.Icon, c.Position, c.ID)
-    return err
+    // type 创建后不可改；智能集合可以修改查询定义
+    query, err := collectionQueryJSON(c)
+    if err != nil { return err }
+    updated, err := scanCollection(db.queryRow(`UPDATE collections c SET name=$1, description=$2, color=$3, icon=$4, position=$5,
+        query=CASE WHEN c.type='smart' THEN COALESCE($7, c.query) ELSE c.query END, updated_at=NOW() WHERE c.id=$6
+        RETURNING `+collectionColumns,
+        c.Name, c.Description, c.Color, c.Icon, c.Position, c.ID, query))
+    if err == sql.ErrNoRows { return notFound("collection") }
+    if err != nil { return err }
+    *c = *updated
+    return nil
 }
 
 func (db *PostgresDatabase) DeleteCollection(id string) error {
-    tx, err := db.db.Begin()
+    tx, err := db.begin()
     if err != nil { return err }
     // Soft-delete the collection
     res1, err := tx.Exec(`UPDATE collections SET deleted_at=NOW(), updated_at=NOW() WHERE id=$1`, id)
@@ -666,7 +940,7 @@ func (db *PostgresDatabase) DeleteCollection(id string) error {
     }
     if rows, _ := res1.RowsAffected(); rows == 0 {
         _ = tx.Rollback()
-        return fmt.Errorf("collection not found")
+        return notFound("collection")
     }
     // Cascade soft-delete to its items
     if _, err := tx.Exec(`UPDATE collection_items SET deleted_at=NOW(), updated_at=NOW() WHERE collection_id=$1`, id); err != nil {
@@ -677,29 +951,31 @@ func (db *PostgresDatabase) DeleteCollection(id string) error {
 }
 
 func (db *PostgresDatabase) ListCollectionsBySpace(spaceID string) ([]models.Collection, error) {
-    rows, err := db.db.Query(`SELECT id, space_id, name, description, color, icon, position, created_at, updated_at, deleted_at FROM collections WHERE space_id=$1 ORDER BY position ASC, created_at ASC`, spaceID)
+    rows, err := db.queryRead(`SELECT `+collectionColumns+` FROM collections c WHERE c.space_id=$1 ORDER BY c.position ASC, c.created_at ASC`, spaceID)
     if err != nil { return nil, fmt.Errorf("failed to list collections: %w", err) }
     defer rows.Close()
     var list []models.Collection
     for rows.Next() {
-        var c models.Collection
-        if err := rows.Scan(&c.ID, &c.SpaceID, &c.Name, &c.Description, &c.Color, &c.Icon, &c.Position, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt); err != nil {
+        c, err := scanCollection(rows)
+        if err != nil {
             return nil, err
         }
-        list = append(list, c)
+        list = append(list, *c)
     }
     return list, nil
 }
 
-func (db *PostgresDatabase) GetCollection(id string) (*models.Collection, error) {
-    var c models.Collection
-    err := db.db.QueryRow(`SELECT id, space_id, name, description, color, icon, position, created_at, updated_at, deleted_at FROM collections WHERE id=$1`, id).
-        Scan(&c.ID, &c.SpaceID, &c.Name, &c.Description, &c.Color, &c.Icon, &c.Position, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
+func (db *PostgresDatabase) GetCollection(userID, id string) (*models.Collection, error) {
+    c, err := scanCollection(db.queryRowRead(`SELECT `+collectionColumns+`
+        FROM collections c
+        JOIN spaces s ON s.id = c.space_id
+        JOIN organizations o ON o.id = s.organization_id
+        WHERE c.id = $1 AND `+spaceAccessScope, id, userID))
     if err != nil {
-        if err == sql.ErrNoRows { return nil, fmt.Errorf("collection not found") }
+        if err == sql.ErrNoRows { return nil, notFound("collection") }
         return nil, fmt.Errorf("failed to get collection: %w", err)
     }
-    return &c, nil
+    return c, nil
 }
 
 // ================ Collection Items =================
@@ -710,88 +986,108 @@ func (db *PostgresDatabase) CreateCollectionItem(it *models.CollectionItem) erro
         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,COALESCE($9,0), NOW(), NOW())
         RETURNING id, created_at, updated_at
     `
-    return db.db.QueryRow(query, it.CollectionID, it.Title, it.URL, it.FavIconURL, it.OriginalTitle, it.AIGeneratedTitle, it.Domain, it.Metadata, it.Position).
+    return db.queryRow(query, it.CollectionID, it.Title, it.URL, it.FavIconURL, it.OriginalTitle, it.AIGeneratedTitle, it.Domain, it.Metadata, it.Position).
         Scan(&it.ID, &it.CreatedAt, &it.UpdatedAt)
 }
 
+// collectionItemColumns is the column list shared by item reads and RETURNING clauses.
+const collectionItemColumns = "id, collection_id, title, url, fav_icon_url, original_title, ai_generated_title, domain, metadata, position, created_at, updated_at, archived_at, snoozed_until, deleted_at"
+
 func (db *PostgresDatabase) UpdateCollectionItem(it *models.CollectionItem) error {
     // Backward-compatible full update. Note: Does NOT change collection_id.
-    _, err := db.db.Exec(`UPDATE collection_items SET title=$1, url=$2, fav_icon_url=$3, original_title=$4, ai_generated_title=$5, domain=$6, metadata=$7, position=$8, updated_at=NOW() WHERE id=$9`,
-        it.Title, it.URL, it.FavIconURL, it.OriginalTitle, it.AIGeneratedTitle, it.Domain, it.Metadata, it.Position, it.ID)
+    err := db.queryRow(`UPDATE collection_items SET title=$1, url=$2, fav_icon_url=$3, original_title=$4, ai_generated_title=$5, domain=$6, metadata=$7, position=$8, updated_at=NOW() WHERE id=$9
+        RETURNING `+collectionItemColumns,
+        it.Title, it.URL, it.FavIconURL, it.OriginalTitle, it.AIGeneratedTitle, it.Domain, it.Metadata, it.Position, it.ID).
+        Scan(&it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle, &it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.ArchivedAt, &it.SnoozedUntil, &it.DeletedAt)
+    if err == sql.ErrNoRows { return notFound("item") }
     return err
 }
 
-// UpdateCollectionItemPartial performs a partial update, including optional collection_id move.
-func (db *PostgresDatabase) UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) error {
-    if strings.TrimSpace(itemID) == "" { return fmt.Errorf("item id required") }
-    // Build dynamic SET clause safely
-    setClauses := make([]string, 0, 10)
-    args := make([]interface{}, 0, 10)
-    idx := 1
+// collectionItemUpdatableColumns are the patch keys UpdateCollectionItemPartial may write
+var collectionItemUpdatableColumns = []string{
+    "collection_id", "title", "url", "fav_icon_url", "original_title", "ai_generated_title", "domain", "metadata", "position", "archived_at", "snoozed_until",
+}
 
-    // whitelist keys -> column names
-    add := func(col string, val interface{}) {
-        setClauses = append(setClauses, fmt.Sprintf("%s=$%d", col, idx))
-        args = append(args, val)
-        idx++
-    }
+// UpdateCollectionItemPartial performs a partial update, including optional collection_id move,
+// and returns the updated row (with the new updated_at).
+func (db *PostgresDatabase) UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) (*models.CollectionItem, error) {
+    if strings.TrimSpace(itemID) == "" { return nil, fmt.Errorf("item id required") }
+    b := newUpdateBuilder("collection_items", collectionItemUpdatableColumns...)
 
     for k, v := range patch {
+        var err error
         switch k {
         case "collection_id":
-            if s, ok := v.(string); ok && strings.TrimSpace(s) != "" { add("collection_id", s) }
-        case "title":
-            if v != nil { add("title", v) }
-        case "url":
-            if v != nil { add("url", v) }
-        case "fav_icon_url":
-            if v != nil { add("fav_icon_url", v) }
-        case "original_title":
-            if v != nil { add("original_title", v) }
-        case "ai_generated_title":
-            if v != nil { add("ai_generated_title", v) }
-        case "domain":
-            if v != nil { add("domain", v) }
+            if s, ok := v.(string); ok && strings.TrimSpace(s) != "" { err = b.Set(k, s) }
+        case "title", "url", "fav_icon_url", "original_title", "ai_generated_title", "domain":
+            if v != nil { err = b.Set(k, v) }
         case "metadata":
             // Accept either []byte (JSON) or any value that can marshal to JSON
             switch vv := v.(type) {
             case []byte:
-                add("metadata", vv)
+                err = b.Set(k, vv)
             default:
-                b, _ := json.Marshal(v)
-                add("metadata", b)
+                bs, mErr := json.Marshal(v)
+                if mErr != nil { return nil, fmt.Errorf("invalid metadata: %w", mErr) }
+                err = b.Set(k, bs)
             }
         case "position":
-            add("position", v)
+            err = b.Set(k, v)
+        case "archived_at", "snoozed_until":
+            // *time.Time；nil 取消归档 / 取消延后
+            err = b.Set(k, v)
         }
+        if err != nil { return nil, err }
     }
-    if len(setClauses) == 0 {
-        // Nothing to update
-        return nil
+    if b.Empty() {
+        // Nothing to update; return the current row so callers still get a consistent entity
+        return db.GetCollectionItem(itemID)
     }
-    // Always bump updated_at
-    setClauses = append(setClauses, "updated_at=NOW()")
 
-    // WHERE id=$N
-    args = append(args, itemID)
-    query := fmt.Sprintf("UPDATE collection_items SET %s WHERE id=$%d", strings.Join(setClauses, ", "), idx)
-    _, err := db.db.Exec(query, args...)
-    return err
+    query, args := b.Build(itemID, collectionItemColumns)
+    var it models.CollectionItem
+    err := db.queryRow(query, args...).Scan(&it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle, &it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.ArchivedAt, &it.SnoozedUntil, &it.DeletedAt)
+    if err == sql.ErrNoRows { return nil, notFound("item") }
+    if err != nil { return nil, fmt.Errorf("failed to update item: %w", err) }
+    return &it, nil
 }
 
-func (db *PostgresDatabase) DeleteCollectionItem(id string) error {
-    _, err := db.db.Exec(`UPDATE collection_items SET deleted_at=NOW(), updated_at=NOW() WHERE id=$1`, id)
-    return err
+// GetCollectionItem loads a single item by id (including soft-deleted rows).
+func (db *PostgresDatabase) GetCollectionItem(itemID string) (*models.CollectionItem, error) {
+    var it models.CollectionItem
+    err := db.queryRow(`SELECT `+collectionItemColumns+` FROM collection_items WHERE id=$1`, itemID).
+        Scan(&it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle, &it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.ArchivedAt, &it.SnoozedUntil, &it.DeletedAt)
+    if err == sql.ErrNoRows { return nil, notFound("item") }
+    if err != nil { return nil, err }
+    return &it, nil
+}
+
+func (db *PostgresDatabase) DeleteCollectionItem(collectionID, id string) error {
+    res, err := db.exec(`UPDATE collection_items SET deleted_at=NOW(), updated_at=NOW() WHERE id=$1 AND collection_id=$2`, id, collectionID)
+    if err != nil {
+        return fmt.Errorf("failed to delete collection item: %w", err)
+    }
+    if n, err := res.RowsAffected(); err == nil && n == 0 {
+        return notFound("item")
+    }
+    return nil
 }
 
-func (db *PostgresDatabase) ListItemsByCollection(collectionID string) ([]models.CollectionItem, error) {
-    rows, err := db.db.Query(`SELECT id, collection_id, title, url, fav_icon_url, original_title, ai_generated_title, domain, metadata, position, created_at, updated_at, deleted_at FROM collection_items WHERE collection_id=$1 AND deleted_at IS NULL ORDER BY position ASC, created_at ASC`, collectionID)
+func (db *PostgresDatabase) ListItemsByCollection(collectionID, state string) ([]models.CollectionItem, error) {
+    filter := ""
+    switch state {
+    case models.ItemStateActive:
+        filter = " AND archived_at IS NULL"
+    case models.ItemStateArchived:
+        filter = " AND archived_at IS NOT NULL"
+    }
+    rows, err := db.queryRead(`SELECT `+collectionItemColumns+` FROM collection_items WHERE collection_id=$1 AND deleted_at IS NULL`+filter+` ORDER BY position ASC, created_at ASC`, collectionID)
     if err != nil { return nil, fmt.Errorf("failed to list items: %w", err) }
     defer rows.Close()
     var list []models.CollectionItem
     for rows.Next() {
         var it models.CollectionItem
-        if err := rows.Scan(&it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle, &it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.DeletedAt); err != nil {
+        if err := rows.Scan(&it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle, &it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.ArchivedAt, &it.SnoozedUntil, &it.DeletedAt); err != nil {
             return nil, err
         }
         list = append(list, it)
@@ -799,23 +1095,49 @@ func (db *PostgresDatabase) ListItemsByCollection(collectionID string) ([]models
     return list, nil
 }
 
+// ListItemsBySpace 列出空间内未删除集合中的条目（供智能集合求值），state 与 ListItemsByCollection 相同
+func (db *PostgresDatabase) ListItemsBySpace(spaceID, state string) ([]models.CollectionItem, error) {
+    filter := ""
+    switch state {
+    case models.ItemStateActive:
+        filter = " AND i.archived_at IS NULL"
+    case models.ItemStateArchived:
+        filter = " AND i.archived_at IS NOT NULL"
+    }
+    rows, err := db.queryRead(`SELECT i.`+strings.ReplaceAll(collectionItemColumns, ", ", ", i.")+`
+        FROM collection_items i JOIN collections c ON c.id = i.collection_id
+        WHERE c.space_id=$1 AND c.deleted_at IS NULL AND i.deleted_at IS NULL`+filter+`
+        ORDER BY i.created_at DESC`, spaceID)
+    if err != nil { return nil, fmt.Errorf("failed to list space items: %w", err) }
+    defer rows.Close()
+    var list []models.CollectionItem
+    for rows.Next() {
+        var it models.CollectionItem
+        if err := rows.Scan(&it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle, &it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.ArchivedAt, &it.SnoozedUntil, &it.DeletedAt); err != nil {
+            return nil, err
+        }
+        list = append(list, it)
+    }
+    return list, rows.Err()
+}
+
 // FindItemByCollectionAndNormalizedURL checks for an existing item by metadata->>'normalized_url' or normalized url of 'url'
 func (db *PostgresDatabase) FindItemByCollectionAndNormalizedURL(collectionID, normalizedURL string) (*models.CollectionItem, error) {
     if strings.TrimSpace(collectionID) == "" || strings.TrimSpace(normalizedURL) == "" { return nil, fmt.Errorf("invalid args") }
     // First try metadata->>'normalized_url'
     var it models.CollectionItem
-    err := db.db.QueryRow(`SELECT id, collection_id, title, url, fav_icon_url, original_title, ai_generated_title, domain, metadata, position, created_at, updated_at, deleted_at
+    err := db.queryRow(`SELECT `+collectionItemColumns+`
         FROM collection_items WHERE collection_id=$1 AND deleted_at IS NULL AND metadata->>'normalized_url'=$2 LIMIT 1`, collectionID, normalizedURL).
-        Scan(&it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle, &it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.DeletedAt)
+        Scan(&it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle, &it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.ArchivedAt, &it.SnoozedUntil, &it.DeletedAt)
     if err == nil { return &it, nil }
     // Fallback: compare against normalized url of column url
-    rows, e2 := db.db.Query(`SELECT id, collection_id, title, url, fav_icon_url, original_title, ai_generated_title, domain, metadata, position, created_at, updated_at, deleted_at
+    rows, e2 := db.query(`SELECT `+collectionItemColumns+`
         FROM collection_items WHERE collection_id=$1 AND deleted_at IS NULL`, collectionID)
     if e2 != nil { return nil, e2 }
     defer rows.Close()
     for rows.Next() {
         var row models.CollectionItem
-        if err := rows.Scan(&row.ID, &row.CollectionID, &row.Title, &row.URL, &row.FavIconURL, &row.OriginalTitle, &row.AIGeneratedTitle, &row.Domain, &row.Metadata, &row.Position, &row.CreatedAt, &row.UpdatedAt, &row.DeletedAt); err == nil {
+        if err := rows.Scan(&row.ID, &row.CollectionID, &row.Title, &row.URL, &row.FavIconURL, &row.OriginalTitle, &row.AIGeneratedTitle, &row.Domain, &row.Metadata, &row.Position, &row.CreatedAt, &row.UpdatedAt, &row.ArchivedAt, &row.SnoozedUntil, &row.DeletedAt); err == nil {
             if strings.TrimSpace(row.URL) != "" {
                 // simple normalization
                 u := strings.TrimSpace(row.URL)
@@ -824,48 +1146,64 @@ func (db *PostgresDatabase) FindItemByCollectionAndNormalizedURL(collectionID, n
             }
         }
     }
-    return nil, fmt.Errorf("not found")
+    return nil, notFound("item")
 }
 
-func (db *PostgresDatabase) GetInvitationByToken(token string) (*models.OrganizationInvitation, error) {
+// token 列只存摘要（见 hashToken），不读出
+const invitationColumns = `id, organization_id, email, invitee_id, inviter_id, status, expires_at, accepted_by, created_at, updated_at`
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*models.OrganizationInvitation, error) {
     var inv models.OrganizationInvitation
     var status string
-    err := db.db.QueryRow(`
-        SELECT id, organization_id, email, inviter_id, token, status, expires_at, accepted_by, created_at, updated_at
-        FROM organization_invitations WHERE token = $1
-    `, token).Scan(&inv.ID, &inv.OrganizationID, &inv.Email, &inv.InviterID, &inv.Token, &status, &inv.ExpiresAt, &inv.AcceptedBy, &inv.CreatedAt, &inv.UpdatedAt)
-    if err != nil {
-        if err == sql.ErrNoRows { return nil, fmt.Errorf("invitation not found") }
-        return nil, fmt.Errorf("failed to get invitation: %w", err)
+    if err := row.Scan(&inv.ID, &inv.OrganizationID, &inv.Email, &inv.InviteeID, &inv.InviterID, &status, &inv.ExpiresAt, &inv.AcceptedBy, &inv.CreatedAt, &inv.UpdatedAt); err != nil {
+        return nil, err
     }
     inv.Status = models.InvitationStatus(status)
     return &inv, nil
 }
 
-func (db *PostgresDatabase) ListInvitationsByEmail(email string) ([]models.OrganizationInvitation, error) {
-    rows, err := db.db.Query(`
-        SELECT id, organization_id, email, inviter_id, token, status, expires_at, accepted_by, created_at, updated_at
-        FROM organization_invitations WHERE email = $1 ORDER BY created_at DESC
-    `, email)
+func (db *PostgresDatabase) GetInvitationByToken(token string) (*models.OrganizationInvitation, error) {
+    inv, err := scanInvitation(db.queryRowRead(`SELECT `+invitationColumns+` FROM organization_invitations WHERE token = $1`, hashToken(token)))
+    if err != nil {
+        if err == sql.ErrNoRows { return nil, notFound("invitation") }
+        return nil, fmt.Errorf("failed to get invitation: %w", err)
+    }
+    return inv, nil
+}
+
+func (db *PostgresDatabase) GetInvitationByID(id string) (*models.OrganizationInvitation, error) {
+    inv, err := scanInvitation(db.queryRowRead(`SELECT `+invitationColumns+` FROM organization_invitations WHERE id = $1`, id))
+    if err != nil {
+        if err == sql.ErrNoRows { return nil, notFound("invitation") }
+        return nil, fmt.Errorf("failed to get invitation: %w", err)
+    }
+    return inv, nil
+}
+
+func (db *PostgresDatabase) ListInvitationsForUser(userID string, emails []string) ([]models.OrganizationInvitation, error) {
+    lowered := make([]string, len(emails))
+    for i, e := range emails { lowered[i] = strings.ToLower(e) }
+    rows, err := db.queryRead(`
+        SELECT `+invitationColumns+`
+        FROM organization_invitations WHERE invitee_id = $1 OR lower(email) = ANY($2) ORDER BY created_at DESC
+    `, userID, pq.Array(lowered))
     if err != nil {
         return nil, fmt.Errorf("failed to list invitations: %w", err)
     }
     defer rows.Close()
     var list []models.OrganizationInvitation
     for rows.Next() {
-        var inv models.OrganizationInvitation
-        var status string
-        if err := rows.Scan(&inv.ID, &inv.OrganizationID, &inv.Email, &inv.InviterID, &inv.Token, &status, &inv.ExpiresAt, &inv.AcceptedBy, &inv.CreatedAt, &inv.UpdatedAt); err != nil {
+        inv, err := scanInvitation(rows)
+        if err != nil {
             return nil, err
         }
-        inv.Status = models.InvitationStatus(status)
-        list = append(list, inv)
+        list = append(list, *inv)
     }
     return list, nil
 }
 
 func (db *PostgresDatabase) UpdateInvitation(inv *models.OrganizationInvitation) error {
-    _, err := db.db.Exec(`
+    _, err := db.exec(`
         UPDATE organization_invitations SET status=$1, accepted_by=$2, expires_at=$3, updated_at=NOW() WHERE id=$4
     `, string(inv.Status), inv.AcceptedBy, inv.ExpiresAt, inv.ID)
     return err
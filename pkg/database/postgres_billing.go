@@ -0,0 +1,376 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// GetUserByPaddleCustomerID 根据 Paddle 客户 ID（ctm_...）查找用户
+func (db *PostgresDatabase) GetUserByPaddleCustomerID(customerID string) (*models.User, error) {
+	if strings.TrimSpace(customerID) == "" {
+		return nil, notFound("user")
+	}
+	query := `
+		SELECT id, email, COALESCE(name, ''), COALESCE(tier, 'free'), created_at, updated_at
+		FROM public.users
+		WHERE paddle_customer_id = $1
+	`
+	var u models.User
+	err := db.queryRow(query, customerID).Scan(&u.ID, &u.Email, &u.Name, &u.Tier, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("user")
+		}
+		return nil, fmt.Errorf("failed to get user by paddle customer id: %w", err)
+	}
+	return &u, nil
+}
+
+// UpdateUserTier 只更新等级
+func (db *PostgresDatabase) UpdateUserTier(userID, tier string) error {
+	res, err := db.exec(`UPDATE public.users SET tier = $2, updated_at = NOW() WHERE id = $1`, userID, tier)
+	if err != nil {
+		return fmt.Errorf("failed to update user tier: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return notFound("user")
+	}
+	return nil
+}
+
+// UpdateUserBilling 只更新给定的计费字段
+func (db *PostgresDatabase) UpdateUserBilling(userID string, update UserBillingUpdate) error {
+	b := newUpdateBuilder("public.users", "tier", "paddle_customer_id", "is_lifetime_member", "lifetime_member_type",
+		"trial_ends_at", "trial_active", "dunning_status", "dunning_started_at")
+	if update.Tier != nil {
+		if err := b.Set("tier", *update.Tier); err != nil {
+			return err
+		}
+	}
+	if update.PaddleCustomerID != nil {
+		if err := b.Set("paddle_customer_id", *update.PaddleCustomerID); err != nil {
+			return err
+		}
+	}
+	if update.IsLifetimeMember != nil {
+		if err := b.Set("is_lifetime_member", *update.IsLifetimeMember); err != nil {
+			return err
+		}
+	}
+	if update.LifetimeMemberType != nil {
+		if err := b.Set("lifetime_member_type", nullIfEmpty(*update.LifetimeMemberType)); err != nil {
+			return err
+		}
+	}
+	if update.TrialEndsAt != nil {
+		if err := b.Set("trial_ends_at", *update.TrialEndsAt); err != nil {
+			return err
+		}
+	}
+	if update.TrialActive != nil {
+		if err := b.Set("trial_active", *update.TrialActive); err != nil {
+			return err
+		}
+	}
+	if update.DunningStatus != nil {
+		if err := b.Set("dunning_status", nullIfEmpty(*update.DunningStatus)); err != nil {
+			return err
+		}
+		if *update.DunningStatus == "" {
+			if err := b.Set("dunning_started_at", nil); err != nil {
+				return err
+			}
+		}
+	}
+	if update.DunningStartedAt != nil {
+		if err := b.Set("dunning_started_at", *update.DunningStartedAt); err != nil {
+			return err
+		}
+	}
+	if b.Empty() {
+		return nil
+	}
+
+	query, args := b.Build(userID)
+	res, err := db.exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update user billing: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return notFound("user")
+	}
+	return nil
+}
+
+// ListExpiredTrials 返回试用已到期但尚未回收的用户
+func (db *PostgresDatabase) ListExpiredTrials(before time.Time) ([]models.UserWithSubscription, error) {
+	query := `
+		SELECT id, email, created_at, updated_at, COALESCE(tier, 'free'), trial_ends_at,
+		       COALESCE(is_lifetime_member, false), lifetime_member_type
+		FROM public.users
+		WHERE trial_active AND trial_ends_at < $1
+		ORDER BY trial_ends_at
+	`
+	rows, err := db.query(query, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired trials: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.UserWithSubscription
+	for rows.Next() {
+		var u models.UserWithSubscription
+		var tier string
+		if err := rows.Scan(&u.ID, &u.Email, &u.CreatedAt, &u.UpdatedAt, &tier, &u.TrialEndsAt,
+			&u.IsLifetimeMember, &u.LifetimeMemberType); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		u.Tier = models.UserTier(tier)
+		u.TrialActive = true
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// ListExpiredDunning 返回宽限期已过（dunning_started_at 早于 before）仍处于 grace 的用户
+func (db *PostgresDatabase) ListExpiredDunning(before time.Time) ([]models.UserWithSubscription, error) {
+	query := `
+		SELECT id, email, created_at, updated_at, COALESCE(tier, 'free'), dunning_started_at,
+		       COALESCE(is_lifetime_member, false), lifetime_member_type
+		FROM public.users
+		WHERE dunning_status = 'grace' AND dunning_started_at < $1
+		ORDER BY dunning_started_at
+	`
+	rows, err := db.query(query, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired dunning: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.UserWithSubscription
+	for rows.Next() {
+		var u models.UserWithSubscription
+		var tier string
+		if err := rows.Scan(&u.ID, &u.Email, &u.CreatedAt, &u.UpdatedAt, &tier, &u.DunningStartedAt,
+			&u.IsLifetimeMember, &u.LifetimeMemberType); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		u.Tier = models.UserTier(tier)
+		u.DunningStatus = models.DunningGrace
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetSubscriptionPlanByTier 返回该等级当前启用的订阅计划
+func (db *PostgresDatabase) GetSubscriptionPlanByTier(tier models.UserTier) (*models.SubscriptionPlan, error) {
+	query := `
+		SELECT id, name, display_name, tier, price_cents, COALESCE(currency, 'USD'), billing_interval,
+		       paddle_price_id, COALESCE(ai_credits_monthly, 0), max_workspaces, COALESCE(features, '[]'),
+		       COALESCE(is_active, true), created_at, updated_at
+		FROM public.subscription_plans
+		WHERE tier = $1 AND COALESCE(is_active, true)
+		ORDER BY created_at
+		LIMIT 1
+	`
+	var p models.SubscriptionPlan
+	var features []byte
+	err := db.queryRowRead(query, string(tier)).Scan(&p.ID, &p.Name, &p.DisplayName, &p.Tier, &p.PriceCents, &p.Currency,
+		&p.BillingInterval, &p.PaddlePriceID, &p.AICreditsMonthly, &p.MaxWorkspaces, &features,
+		&p.IsActive, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("subscription plan")
+		}
+		return nil, fmt.Errorf("failed to get subscription plan: %w", err)
+	}
+	if err := json.Unmarshal(features, &p.Features); err != nil {
+		return nil, fmt.Errorf("failed to parse plan features: %w", err)
+	}
+	return &p, nil
+}
+
+// CreateSubscription 创建订阅记录
+func (db *PostgresDatabase) CreateSubscription(subscription *models.UserSubscription) error {
+	query := `
+		INSERT INTO public.user_subscriptions (user_id, plan_id, paddle_subscription_id, status,
+			current_period_start, current_period_end, cancel_at_period_end, canceled_at, trial_start, trial_end)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`
+	err := db.queryRow(query, subscription.UserID, subscription.PlanID, subscription.PaddleSubscriptionID,
+		string(subscription.Status), subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd,
+		subscription.CancelAtPeriodEnd, subscription.CanceledAt, subscription.TrialStart, subscription.TrialEnd).
+		Scan(&subscription.ID, &subscription.CreatedAt, &subscription.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create subscription: %w", err)
+	}
+	return nil
+}
+
+// GetUserSubscription 返回用户最近的一条订阅记录
+func (db *PostgresDatabase) GetUserSubscription(userID string) (*models.UserSubscription, error) {
+	query := `
+		SELECT id, user_id, plan_id, paddle_subscription_id, COALESCE(status, 'active'),
+		       current_period_start, current_period_end, COALESCE(cancel_at_period_end, false), canceled_at,
+		       trial_start, trial_end, created_at, updated_at
+		FROM public.user_subscriptions
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	var s models.UserSubscription
+	var status string
+	err := db.queryRowRead(query, userID).Scan(&s.ID, &s.UserID, &s.PlanID, &s.PaddleSubscriptionID, &status,
+		&s.CurrentPeriodStart, &s.CurrentPeriodEnd, &s.CancelAtPeriodEnd, &s.CanceledAt,
+		&s.TrialStart, &s.TrialEnd, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("subscription")
+		}
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	s.Status = models.SubscriptionStatus(status)
+	return &s, nil
+}
+
+// UpdateSubscription 更新订阅记录（按 ID 整行更新）
+func (db *PostgresDatabase) UpdateSubscription(subscription *models.UserSubscription) error {
+	query := `
+		UPDATE public.user_subscriptions
+		SET plan_id = $2, paddle_subscription_id = $3, status = $4, current_period_start = $5,
+		    current_period_end = $6, cancel_at_period_end = $7, canceled_at = $8, trial_start = $9,
+		    trial_end = $10, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	err := db.queryRow(query, subscription.ID, subscription.PlanID, subscription.PaddleSubscriptionID,
+		string(subscription.Status), subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd,
+		subscription.CancelAtPeriodEnd, subscription.CanceledAt, subscription.TrialStart, subscription.TrialEnd).
+		Scan(&subscription.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("subscription")
+		}
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+	return nil
+}
+
+// CancelSubscription 将用户尚未取消的订阅记录标记为已取消
+func (db *PostgresDatabase) CancelSubscription(userID string) error {
+	query := `
+		UPDATE public.user_subscriptions
+		SET status = 'canceled', canceled_at = NOW(), updated_at = NOW()
+		WHERE user_id = $1 AND status <> 'canceled'
+	`
+	if _, err := db.exec(query, userID); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return nil
+}
+
+// GetPromoCode 按（规范化后的）优惠码查找
+func (db *PostgresDatabase) GetPromoCode(code string) (*models.PromoCode, error) {
+	query := `
+		SELECT id, code, kind, paddle_discount_id, tier, duration_days, credits, max_redemptions,
+		       redemption_count, expires_at, is_active, created_at, updated_at
+		FROM public.promo_codes
+		WHERE code = $1
+	`
+	var p models.PromoCode
+	var kind string
+	var tier sql.NullString
+	err := db.queryRowRead(query, models.NormalizePromoCode(code)).Scan(&p.ID, &p.Code, &kind, &p.PaddleDiscountID, &tier,
+		&p.DurationDays, &p.Credits, &p.MaxRedemptions, &p.RedemptionCount, &p.ExpiresAt, &p.IsActive,
+		&p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("promo code")
+		}
+		return nil, fmt.Errorf("failed to get promo code: %w", err)
+	}
+	p.Kind = models.PromoKind(kind)
+	if tier.Valid && tier.String != "" {
+		t := models.UserTier(tier.String)
+		p.Tier = &t
+	}
+	return &p, nil
+}
+
+// HasRedeemedPromo 用户是否已兑换过该优惠码
+func (db *PostgresDatabase) HasRedeemedPromo(promoID, userID string) (bool, error) {
+	var exists bool
+	err := db.queryRow(`SELECT EXISTS (SELECT 1 FROM public.promo_redemptions WHERE promo_id = $1 AND user_id = $2)`,
+		promoID, userID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check promo redemption: %w", err)
+	}
+	return exists, nil
+}
+
+// RedeemPromoCode 在同一事务中写入兑换记录并递增计数，并发兑换不会超出 max_redemptions
+func (db *PostgresDatabase) RedeemPromoCode(promoID, userID string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`
+		INSERT INTO public.promo_redemptions (promo_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (promo_id, user_id) DO NOTHING
+	`, promoID, userID)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("failed to record promo redemption: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		_ = tx.Rollback()
+		return ErrPromoAlreadyRedeemed
+	}
+	res, err = tx.Exec(`
+		UPDATE public.promo_codes SET redemption_count = redemption_count + 1
+		WHERE id = $1 AND (max_redemptions IS NULL OR redemption_count < max_redemptions)
+	`, promoID)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("failed to count promo redemption: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		_ = tx.Rollback()
+		return ErrPromoExhausted
+	}
+	return tx.Commit()
+}
+
+// GrantAICredits 向用户当前周期追加积分（无当前周期时新建一个月的周期）
+func (db *PostgresDatabase) GrantAICredits(userID string, amount int) error {
+	res, err := db.exec(`
+		UPDATE public.ai_credits
+		SET credits_total = credits_total + $2, credits_remaining = credits_remaining + $2
+		WHERE id = (
+			SELECT id FROM public.ai_credits
+			WHERE user_id = $1 AND period_end > NOW()
+			ORDER BY period_end DESC
+			LIMIT 1
+		)
+	`, userID, amount)
+	if err != nil {
+		return fmt.Errorf("failed to grant ai credits: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = db.exec(`
+		INSERT INTO public.ai_credits (user_id, credits_total, credits_used, credits_remaining, period_start, period_end)
+		VALUES ($1, $2, 0, $2, NOW(), NOW() + INTERVAL '1 month')
+	`, userID, amount)
+	if err != nil {
+		return fmt.Errorf("failed to grant ai credits: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"tab-sync-backend-refactor/pkg/tracing"
+)
+
+// WithContext 实现 contextBinder
+func (db *PostgresDatabase) WithContext(ctx context.Context) DatabaseInterface {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+func (db *PostgresDatabase) reqCtx() context.Context {
+	if db.ctx != nil {
+		return db.ctx
+	}
+	return context.Background()
+}
+
+// startSpan 为一次 SQL 调用创建子 Span，语句截断后作为 db.statement 记录（参数不记录）
+func (db *PostgresDatabase) startSpan(query string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartSpan(db.reqCtx(), "postgres "+sqlOperation(query), tracing.KindClient)
+	span.SetAttribute("db.system", "postgresql")
+	stmt := strings.Join(strings.Fields(query), " ")
+	if len(stmt) > 300 {
+		stmt = stmt[:300] + "..."
+	}
+	span.SetAttribute("db.statement", stmt)
+	return ctx, span
+}
+
+func (db *PostgresDatabase) queryRow(query string, args ...interface{}) *sql.Row {
+	db.noteWrite(query)
+	ctx, span := db.startSpan(query)
+	defer span.End()
+	row := db.db.QueryRowContext(ctx, query, args...)
+	span.RecordError(row.Err())
+	return row
+}
+
+func (db *PostgresDatabase) query(query string, args ...interface{}) (*sql.Rows, error) {
+	db.noteWrite(query)
+	ctx, span := db.startSpan(query)
+	defer span.End()
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	span.RecordError(err)
+	return rows, classifyConnErr(err)
+}
+
+func (db *PostgresDatabase) exec(query string, args ...interface{}) (sql.Result, error) {
+	db.noteWrite(query)
+	ctx, span := db.startSpan(query)
+	defer span.End()
+	res, err := db.db.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	return res, classifyConnErr(err)
+}
+
+// noteWrite 非 SELECT 语句（含 RETURNING 写入与 WITH 语句）记为写入，本请求之后的读取走主库（见 consistency.go）
+func (db *PostgresDatabase) noteWrite(query string) {
+	if sqlOperation(query) != "SELECT" {
+		markWrite(db.reqCtx())
+	}
+}
+
+// useReplica 是否把只读查询发往副本：配置了副本，且本请求不要求读己之写
+func (db *PostgresDatabase) useReplica() bool {
+	return db.read != nil && !primaryReads(db.reqCtx())
+}
+
+// queryRowRead 只读查询优先走副本；副本连接失败时回退主库（SQL 错误不回退）
+func (db *PostgresDatabase) queryRowRead(query string, args ...interface{}) *sql.Row {
+	if db.useReplica() {
+		ctx, span := db.startSpan(query)
+		span.SetAttribute("db.replica", true)
+		row := db.read.QueryRowContext(ctx, query, args...)
+		span.RecordError(row.Err())
+		span.End()
+		if !errors.Is(classifyConnErr(row.Err()), ErrUnavailable) {
+			return row
+		}
+		fmt.Printf("⚠️  Read replica query failed, falling back to primary: %v\n", row.Err())
+	}
+	return db.queryRow(query, args...)
+}
+
+// queryRead 同 queryRowRead，用于多行查询
+func (db *PostgresDatabase) queryRead(query string, args ...interface{}) (*sql.Rows, error) {
+	if db.useReplica() {
+		ctx, span := db.startSpan(query)
+		span.SetAttribute("db.replica", true)
+		rows, err := db.read.QueryContext(ctx, query, args...)
+		span.RecordError(err)
+		span.End()
+		err = classifyConnErr(err)
+		if !errors.Is(err, ErrUnavailable) {
+			return rows, err
+		}
+		fmt.Printf("⚠️  Read replica query failed, falling back to primary: %v\n", err)
+	}
+	return db.query(query, args...)
+}
+
+func (db *PostgresDatabase) begin() (*sql.Tx, error) {
+	markWrite(db.reqCtx())
+	tx, err := db.db.BeginTx(db.reqCtx(), nil)
+	return tx, classifyConnErr(err)
+}
+
+// classifyConnErr 将连接层失败（拨号/网络错误、坏连接）标记为 ErrUnavailable，SQL 错误原样返回
+func classifyConnErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return unavailable(err)
+	}
+	return err
+}
+
+// sqlOperation 取语句的首个关键字（SELECT/INSERT/...）作为 Span 名
+func sqlOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+
+	"github.com/lib/pq"
+)
+
+const devicePushColumns = `id, user_id, source_device_id, target_device_id, urls, status, delivered_at, completed_at, created_at`
+
+func scanDevicePush(row interface{ Scan(...interface{}) error }) (*models.DevicePush, error) {
+	var p models.DevicePush
+	var urls pq.StringArray
+	if err := row.Scan(&p.ID, &p.UserID, &p.SourceDeviceID, &p.TargetDeviceID, &urls,
+		&p.Status, &p.DeliveredAt, &p.CompletedAt, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	p.URLs = []string(urls)
+	return &p, nil
+}
+
+// CreateDevicePush 为目标设备排队一组 URL
+func (db *PostgresDatabase) CreateDevicePush(p *models.DevicePush) error {
+	created, err := scanDevicePush(db.queryRow(`
+		INSERT INTO device_pushes (user_id, source_device_id, target_device_id, urls, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+devicePushColumns,
+		p.UserID, p.SourceDeviceID, p.TargetDeviceID, pq.Array(p.URLs), models.DevicePushPending))
+	if err != nil {
+		return fmt.Errorf("failed to create device push: %w", err)
+	}
+	*p = *created
+	return nil
+}
+
+// GetDevicePush 仅返回属于 userID 的推送，否则视为不存在
+func (db *PostgresDatabase) GetDevicePush(userID, id string) (*models.DevicePush, error) {
+	p, err := scanDevicePush(db.queryRow(`
+		SELECT `+devicePushColumns+` FROM device_pushes WHERE id::text = $1 AND user_id = $2
+	`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("device push")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device push: %w", err)
+	}
+	return p, nil
+}
+
+// ClaimDevicePushes 返回目标设备在 createdAfter 之后尚未处理的推送，并将 pending 标记为 delivered
+func (db *PostgresDatabase) ClaimDevicePushes(userID, deviceID string, createdAfter time.Time) ([]models.DevicePush, error) {
+	rows, err := db.query(`
+		WITH claimed AS (
+			UPDATE device_pushes SET status = $4, delivered_at = COALESCE(delivered_at, NOW())
+			WHERE user_id = $1 AND target_device_id::text = $2 AND created_at > $3 AND status IN ($4, $5)
+			RETURNING `+devicePushColumns+`
+		)
+		SELECT `+devicePushColumns+` FROM claimed ORDER BY created_at`,
+		userID, deviceID, createdAfter, models.DevicePushDelivered, models.DevicePushPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim device pushes: %w", err)
+	}
+	defer rows.Close()
+	pushes := []models.DevicePush{}
+	for rows.Next() {
+		p, err := scanDevicePush(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device push: %w", err)
+		}
+		pushes = append(pushes, *p)
+	}
+	return pushes, rows.Err()
+}
+
+// CompleteDevicePush 记录目标设备的处理结果（opened/dismissed）；已完成的推送返回 ErrNotFound
+func (db *PostgresDatabase) CompleteDevicePush(userID, id string, status models.DevicePushStatus) error {
+	res, err := db.exec(`
+		UPDATE device_pushes SET status = $3, completed_at = NOW()
+		WHERE id::text = $1 AND user_id = $2 AND completed_at IS NULL
+	`, id, userID, status)
+	if err != nil {
+		return fmt.Errorf("failed to update device push: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("device push")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+const deviceColumns = `id, user_id, install_id, name, browser, platform, last_seen, last_sync_cursor, revoked_at,
+	last_ip, country, region, city, created_at`
+
+func scanDevice(row interface{ Scan(...interface{}) error }) (*models.Device, error) {
+	var d models.Device
+	if err := row.Scan(&d.ID, &d.UserID, &d.InstallID, &d.Name, &d.Browser, &d.Platform,
+		&d.LastSeen, &d.LastSyncCursor, &d.RevokedAt, &d.LastIP, &d.Country, &d.Region, &d.City, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// RegisterDevice 按 (user_id, install_id) 插入或更新设备信息，刷新 last_seen 并清除吊销状态
+func (db *PostgresDatabase) RegisterDevice(d *models.Device) error {
+	registered, err := scanDevice(db.queryRow(`
+		INSERT INTO devices (user_id, install_id, name, browser, platform, last_seen, last_ip, country, region, city)
+		VALUES ($1, $2, $3, $4, $5, NOW(), $6, $7, $8, $9)
+		ON CONFLICT (user_id, install_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			browser = EXCLUDED.browser,
+			platform = EXCLUDED.platform,
+			last_seen = NOW(),
+			revoked_at = NULL,
+			last_ip = EXCLUDED.last_ip,
+			country = EXCLUDED.country,
+			region = EXCLUDED.region,
+			city = EXCLUDED.city
+		RETURNING `+deviceColumns,
+		d.UserID, d.InstallID, d.Name, d.Browser, d.Platform, d.LastIP, d.Country, d.Region, d.City))
+	if err != nil {
+		return fmt.Errorf("failed to register device: %w", err)
+	}
+	*d = *registered
+	return nil
+}
+
+// GetDevice 仅返回属于 userID 的设备，否则视为不存在
+func (db *PostgresDatabase) GetDevice(userID, id string) (*models.Device, error) {
+	d, err := scanDevice(db.queryRowRead(`
+		SELECT `+deviceColumns+` FROM devices WHERE id::text = $1 AND user_id = $2
+	`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("device")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return d, nil
+}
+
+// ListDevices 按 last_seen 倒序返回用户的全部设备（含已吊销）
+func (db *PostgresDatabase) ListDevices(userID string) ([]models.Device, error) {
+	rows, err := db.queryRead(`
+		SELECT `+deviceColumns+` FROM devices WHERE user_id = $1 ORDER BY last_seen DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	defer rows.Close()
+	devices := []models.Device{}
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, *d)
+	}
+	return devices, rows.Err()
+}
+
+// TouchDevice 刷新 last_seen；cursor 非空时同时更新 last_sync_cursor
+func (db *PostgresDatabase) TouchDevice(userID, id string, cursor *string) error {
+	res, err := db.exec(`
+		UPDATE devices SET last_seen = NOW(), last_sync_cursor = COALESCE($3, last_sync_cursor)
+		WHERE id::text = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID, cursor)
+	if err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("device")
+	}
+	return nil
+}
+
+// RevokeDevice 标记设备为已吊销；设备下次心跳时被要求重新登录
+func (db *PostgresDatabase) RevokeDevice(userID, id string) error {
+	res, err := db.exec(`
+		UPDATE devices SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id::text = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke device: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("device")
+	}
+	return nil
+}
+
+// ListDeviceSpaces 返回设备订阅同步的空间；为空表示同步全部空间
+func (db *PostgresDatabase) ListDeviceSpaces(deviceID string) ([]string, error) {
+	rows, err := db.queryRead(`SELECT space_id FROM device_spaces WHERE device_id::text = $1 ORDER BY created_at`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device spaces: %w", err)
+	}
+	defer rows.Close()
+	spaceIDs := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan device space: %w", err)
+		}
+		spaceIDs = append(spaceIDs, id)
+	}
+	return spaceIDs, rows.Err()
+}
+
+// SetDeviceSpaces 在事务中整体替换设备的空间订阅
+func (db *PostgresDatabase) SetDeviceSpaces(deviceID string, spaceIDs []string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM device_spaces WHERE device_id::text = $1`, deviceID); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("failed to clear device spaces: %w", err)
+	}
+	for _, spaceID := range spaceIDs {
+		if _, err := tx.Exec(`
+			INSERT INTO device_spaces (device_id, space_id) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		`, deviceID, spaceID); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to set device spaces: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// digestItemsLimit 摘要中列出的条目上限（计数仍为全量）
+const digestItemsLimit = 5
+
+// digestDeadLinksLimit 摘要中列出的失效链接上限
+const digestDeadLinksLimit = 10
+
+// GetNotificationPreferences 返回通知偏好；无记录时返回默认值
+func (db *PostgresDatabase) GetNotificationPreferences(userID string) (*models.NotificationPreferences, error) {
+	prefs := &models.NotificationPreferences{UserID: userID}
+	err := db.queryRowRead(`
+		SELECT weekly_digest, last_digest_at FROM public.notification_preferences WHERE user_id = $1
+	`, userID).Scan(&prefs.WeeklyDigest, &prefs.LastDigestAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.DefaultNotificationPreferences(userID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// UpdateNotificationPreferences 写入用户可修改的偏好（不影响 last_digest_at）
+func (db *PostgresDatabase) UpdateNotificationPreferences(prefs *models.NotificationPreferences) error {
+	_, err := db.exec(`
+		INSERT INTO public.notification_preferences (user_id, weekly_digest)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET weekly_digest = EXCLUDED.weekly_digest
+	`, prefs.UserID, prefs.WeeklyDigest)
+	if err != nil {
+		return fmt.Errorf("failed to update notification preferences: %w", err)
+	}
+	return nil
+}
+
+// ListDigestRecipients 返回开启每周摘要、且上次发送早于 sentBefore（或从未发送）的用户，最多 limit 个
+func (db *PostgresDatabase) ListDigestRecipients(sentBefore time.Time, limit int) ([]models.User, error) {
+	rows, err := db.query(`
+		SELECT u.id, u.email, COALESCE(u.name, ''), COALESCE(u.tier, 'free'), u.created_at, u.updated_at
+		FROM public.users u
+		LEFT JOIN public.notification_preferences p ON p.user_id = u.id
+		WHERE COALESCE(p.weekly_digest, true)
+		  AND (p.last_digest_at IS NULL OR p.last_digest_at < $1)
+		ORDER BY p.last_digest_at NULLS FIRST, u.created_at
+		LIMIT $2
+	`, sentBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Tier, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// MarkDigestSent 记录本次摘要发送时间（空摘要同样记录，避免同一周重复计算）
+func (db *PostgresDatabase) MarkDigestSent(userID string, at time.Time) error {
+	_, err := db.exec(`
+		INSERT INTO public.notification_preferences (user_id, last_digest_at)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET last_digest_at = EXCLUDED.last_digest_at
+	`, userID, at)
+	if err != nil {
+		return fmt.Errorf("failed to mark digest sent: %w", err)
+	}
+	return nil
+}
+
+// digestItemsScope 用户所在组织中未删除的条目
+const digestItemsScope = `
+	FROM public.collection_items i
+	JOIN public.collections c ON c.id = i.collection_id AND c.deleted_at IS NULL
+	JOIN public.spaces s ON s.id = c.space_id AND s.deleted_at IS NULL
+	JOIN public.organization_memberships m ON m.organization_id = s.organization_id AND m.user_id = $1
+	WHERE i.deleted_at IS NULL`
+
+// GetActivityDigest 汇总 since 之后用户所在组织的新增条目、新共享给用户的空间与失效链接
+func (db *PostgresDatabase) GetActivityDigest(userID string, since time.Time) (*models.ActivityDigest, error) {
+	d := &models.ActivityDigest{Since: since, RecentItems: []models.DigestItem{}, SharedSpaces: []models.DigestSpace{}, DeadLinks: []models.DigestItem{}}
+
+	newItems := digestItemsScope + ` AND i.created_at > $2`
+	if err := db.queryRowRead(`SELECT COUNT(*)`+newItems, userID, since).Scan(&d.NewItemsCount); err != nil {
+		return nil, fmt.Errorf("failed to count new items: %w", err)
+	}
+	if d.NewItemsCount > 0 {
+		items, err := db.digestItems(`SELECT i.title, COALESCE(i.url, ''), c.name`+newItems+` ORDER BY i.created_at DESC LIMIT $3`,
+			userID, since, digestItemsLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list new items: %w", err)
+		}
+		d.RecentItems = items
+	}
+
+	deadLinks := digestItemsScope + ` AND i.metadata->>'link_status' = 'dead' AND i.updated_at > $2`
+	if err := db.queryRowRead(`SELECT COUNT(*)`+deadLinks, userID, since).Scan(&d.DeadLinksCount); err != nil {
+		return nil, fmt.Errorf("failed to count dead links: %w", err)
+	}
+	if d.DeadLinksCount > 0 {
+		items, err := db.digestItems(`SELECT i.title, COALESCE(i.url, ''), c.name`+deadLinks+` ORDER BY i.updated_at DESC LIMIT $3`,
+			userID, since, digestDeadLinksLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dead links: %w", err)
+		}
+		d.DeadLinks = items
+	}
+
+	rows, err := db.queryRead(`
+		SELECT s.id, s.name, o.name
+		FROM public.space_permissions p
+		JOIN public.spaces s ON s.id = p.space_id AND s.deleted_at IS NULL
+		JOIN public.organizations o ON o.id = s.organization_id
+		WHERE p.user_id = $1 AND p.created_at > $2
+		ORDER BY p.created_at DESC
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared spaces: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s models.DigestSpace
+		if err := rows.Scan(&s.ID, &s.Name, &s.Organization); err != nil {
+			return nil, fmt.Errorf("failed to scan shared space: %w", err)
+		}
+		d.SharedSpaces = append(d.SharedSpaces, s)
+	}
+	return d, rows.Err()
+}
+
+func (db *PostgresDatabase) digestItems(query string, args ...interface{}) ([]models.DigestItem, error) {
+	rows, err := db.queryRead(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []models.DigestItem{}
+	for rows.Next() {
+		var it models.DigestItem
+		if err := rows.Scan(&it.Title, &it.URL, &it.Collection); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
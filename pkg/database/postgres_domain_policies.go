@@ -0,0 +1,104 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// ListDomainPolicies 返回组织的域名策略（按域名排序）
+func (db *PostgresDatabase) ListDomainPolicies(orgID string) ([]models.DomainPolicy, error) {
+	rows, err := db.query(`
+		SELECT organization_id, domain, action, COALESCE(created_by::text, ''), created_at
+		FROM organization_domain_policies WHERE organization_id = $1 ORDER BY domain
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domain policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []models.DomainPolicy{}
+	for rows.Next() {
+		var p models.DomainPolicy
+		if err := rows.Scan(&p.OrganizationID, &p.Domain, &p.Action, &p.CreatedBy, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan domain policy: %w", err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// SetDomainPolicy 新增或修改（覆盖 action 与操作者）域名策略
+func (db *PostgresDatabase) SetDomainPolicy(p *models.DomainPolicy) error {
+	err := db.queryRow(`
+		INSERT INTO organization_domain_policies (organization_id, domain, action, created_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (organization_id, domain) DO UPDATE SET action = EXCLUDED.action, created_by = EXCLUDED.created_by, created_at = NOW()
+		RETURNING created_at
+	`, p.OrganizationID, p.Domain, p.Action, p.CreatedBy).Scan(&p.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set domain policy: %w", err)
+	}
+	return nil
+}
+
+// DeleteDomainPolicy 删除域名策略
+func (db *PostgresDatabase) DeleteDomainPolicy(orgID, domain string) error {
+	res, err := db.exec(`DELETE FROM organization_domain_policies WHERE organization_id = $1 AND domain = $2`, orgID, domain)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("domain policy")
+	}
+	return nil
+}
+
+// RecordPolicyViolations 批量写入违规审计记录
+func (db *PostgresDatabase) RecordPolicyViolations(vs []models.PolicyViolation) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	orgs := make([]string, len(vs))
+	users := make([]string, len(vs))
+	domains := make([]string, len(vs))
+	hosts := make([]string, len(vs))
+	actions := make([]string, len(vs))
+	sources := make([]string, len(vs))
+	for i, v := range vs {
+		orgs[i], users[i], domains[i], hosts[i], actions[i], sources[i] = v.OrganizationID, v.UserID, v.Domain, v.Host, string(v.Action), v.Source
+	}
+	_, err := db.exec(`
+		INSERT INTO policy_violations (organization_id, user_id, domain, host, action, source)
+		SELECT * FROM unnest($1::uuid[], $2::uuid[], $3::text[], $4::text[], $5::text[], $6::text[])
+	`, pq.Array(orgs), pq.Array(users), pq.Array(domains), pq.Array(hosts), pq.Array(actions), pq.Array(sources))
+	if err != nil {
+		return fmt.Errorf("failed to record policy violations: %w", err)
+	}
+	return nil
+}
+
+// ListPolicyViolations 返回组织最近的违规记录（按时间倒序）
+func (db *PostgresDatabase) ListPolicyViolations(orgID string, limit int) ([]models.PolicyViolation, error) {
+	rows, err := db.queryRead(`
+		SELECT id, organization_id, user_id, domain, host, action, source, created_at
+		FROM policy_violations WHERE organization_id = $1
+		ORDER BY created_at DESC LIMIT $2
+	`, orgID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy violations: %w", err)
+	}
+	defer rows.Close()
+
+	violations := []models.PolicyViolation{}
+	for rows.Next() {
+		var v models.PolicyViolation
+		if err := rows.Scan(&v.ID, &v.OrganizationID, &v.UserID, &v.Domain, &v.Host, &v.Action, &v.Source, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan policy violation: %w", err)
+		}
+		violations = append(violations, v)
+	}
+	return violations, rows.Err()
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// GetOrganizationDataKey 返回组织被包装的数据密钥，未启用加密时返回空串
+func (db *PostgresDatabase) GetOrganizationDataKey(orgID string) (string, error) {
+	var wrapped sql.NullString
+	err := db.queryRow(`SELECT encrypted_data_key FROM organizations WHERE id = $1`, orgID).Scan(&wrapped)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", notFound("organization")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get organization data key: %w", err)
+	}
+	return wrapped.String, nil
+}
+
+// SetOrganizationDataKey 仅在尚无数据密钥时写入
+func (db *PostgresDatabase) SetOrganizationDataKey(orgID, wrappedKey string) error {
+	res, err := db.exec(`
+		UPDATE organizations SET encrypted_data_key = $2, updated_at = NOW()
+		WHERE id = $1 AND encrypted_data_key IS NULL
+	`, orgID, wrappedKey)
+	if err != nil {
+		return fmt.Errorf("failed to set organization data key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if _, err := db.GetOrganizationDataKey(orgID); err != nil {
+			return err
+		}
+		return ErrDataKeyExists
+	}
+	return nil
+}
+
+// GetCollectionOrganizationID 返回集合所属组织
+func (db *PostgresDatabase) GetCollectionOrganizationID(collectionID string) (string, error) {
+	var orgID string
+	err := db.queryRow(`
+		SELECT s.organization_id FROM collections c JOIN spaces s ON s.id = c.space_id WHERE c.id = $1
+	`, collectionID).Scan(&orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", notFound("collection")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get collection organization: %w", err)
+	}
+	return orgID, nil
+}
@@ -0,0 +1,16 @@
+package database
+
+import "fmt"
+
+// RecordExperimentExposure 记录首次曝光；同一用户、实验、变体重复曝光时不变
+func (db *PostgresDatabase) RecordExperimentExposure(userID, experimentKey, variant string) error {
+	_, err := db.exec(`
+		INSERT INTO experiment_exposures (user_id, experiment_key, variant)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, experiment_key, variant) DO NOTHING
+	`, userID, experimentKey, variant)
+	if err != nil {
+		return fmt.Errorf("failed to record experiment exposure: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// dataExportColumns 导出元数据列（不含 archive）
+const dataExportColumns = `id, user_id, status, size_bytes, error, started_at, completed_at, expires_at, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDataExport(row rowScanner, extra ...interface{}) (*models.DataExport, error) {
+	var e models.DataExport
+	var status string
+	dest := append([]interface{}{&e.ID, &e.UserID, &status, &e.SizeBytes, &e.Error, &e.StartedAt,
+		&e.CompletedAt, &e.ExpiresAt, &e.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	e.Status = models.ExportStatus(status)
+	return &e, nil
+}
+
+// CreateDataExport 创建 pending 状态的导出
+func (db *PostgresDatabase) CreateDataExport(e *models.DataExport) error {
+	e.Status = models.ExportPending
+	err := db.queryRow(`
+		INSERT INTO public.data_exports (user_id, status) VALUES ($1, $2)
+		RETURNING id, created_at
+	`, e.UserID, e.Status).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create data export: %w", err)
+	}
+	return nil
+}
+
+// GetLatestDataExport 返回用户最近一次导出
+func (db *PostgresDatabase) GetLatestDataExport(userID string) (*models.DataExport, error) {
+	e, err := scanDataExport(db.queryRow(`
+		SELECT `+dataExportColumns+` FROM public.data_exports
+		WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1
+	`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("data export")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	return e, nil
+}
+
+// GetDataExport 仅返回属于 userID 的导出
+func (db *PostgresDatabase) GetDataExport(userID, id string) (*models.DataExport, error) {
+	e, err := scanDataExport(db.queryRow(`
+		SELECT `+dataExportColumns+` FROM public.data_exports WHERE id = $1 AND user_id = $2
+	`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("data export")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	return e, nil
+}
+
+// GetDataExportArchive 返回导出及其 zip 内容
+func (db *PostgresDatabase) GetDataExportArchive(id string) (*models.DataExport, []byte, error) {
+	var archive []byte
+	e, err := scanDataExport(db.queryRow(`
+		SELECT `+dataExportColumns+`, archive FROM public.data_exports WHERE id = $1
+	`, id), &archive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, notFound("data export")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	return e, archive, nil
+}
+
+// ClaimDataExports 以 SKIP LOCKED 认领待处理的导出，并发运行的任务不会拿到同一条
+func (db *PostgresDatabase) ClaimDataExports(limit int, staleBefore time.Time) ([]models.DataExport, error) {
+	rows, err := db.query(`
+		UPDATE public.data_exports SET status = 'processing', started_at = NOW()
+		WHERE id IN (
+			SELECT id FROM public.data_exports
+			WHERE status = 'pending' OR (status = 'processing' AND started_at < $2)
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+dataExportColumns, limit, staleBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim data exports: %w", err)
+	}
+	defer rows.Close()
+
+	var exports []models.DataExport
+	for rows.Next() {
+		e, err := scanDataExport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan data export: %w", err)
+		}
+		exports = append(exports, *e)
+	}
+	return exports, rows.Err()
+}
+
+// CompleteDataExport 保存归档并标记为 ready
+func (db *PostgresDatabase) CompleteDataExport(id string, archive []byte, expiresAt time.Time) error {
+	_, err := db.exec(`
+		UPDATE public.data_exports
+		SET status = 'ready', archive = $2, size_bytes = $3, error = NULL, completed_at = NOW(), expires_at = $4
+		WHERE id = $1
+	`, id, archive, len(archive), expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to complete data export: %w", err)
+	}
+	return nil
+}
+
+// FailDataExport 标记为 failed 并记录原因
+func (db *PostgresDatabase) FailDataExport(id, reason string) error {
+	_, err := db.exec(`
+		UPDATE public.data_exports SET status = 'failed', error = $2, completed_at = NOW() WHERE id = $1
+	`, id, reason)
+	if err != nil {
+		return fmt.Errorf("failed to mark data export failed: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredDataExports 清空过期归档
+func (db *PostgresDatabase) PurgeExpiredDataExports(before time.Time) (int, error) {
+	res, err := db.exec(`
+		UPDATE public.data_exports SET status = 'expired', archive = NULL
+		WHERE status = 'ready' AND expires_at < $1
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge data exports: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// CreateHistoryImport 创建历史导入
+func (db *PostgresDatabase) CreateHistoryImport(imp *models.HistoryImport) error {
+	err := db.queryRow(`
+		INSERT INTO history_imports (user_id, space_id, utc_offset_minutes, total_entries)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, imp.UserID, imp.SpaceID, imp.UTCOffsetMinutes, imp.TotalEntries).Scan(&imp.ID, &imp.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create history import: %w", err)
+	}
+	imp.ReceivedBatches = []int{}
+	return nil
+}
+
+// GetHistoryImport 仅返回属于 userID 的导入，附带已记录的批次与计数合计（读主库：批次刚刚写入）
+func (db *PostgresDatabase) GetHistoryImport(userID, id string) (*models.HistoryImport, error) {
+	var imp models.HistoryImport
+	var batches pq.Int64Array
+	err := db.queryRow(`
+		SELECT i.id, i.user_id, i.space_id, i.utc_offset_minutes, i.total_entries, i.completed_at, i.created_at,
+			COALESCE(array_agg(b.batch_index ORDER BY b.batch_index) FILTER (WHERE b.batch_index IS NOT NULL), '{}'),
+			COALESCE(SUM(b.received), 0), COALESCE(SUM(b.imported), 0), COALESCE(SUM(b.duplicates), 0), COALESCE(SUM(b.skipped), 0), COALESCE(SUM(b.blocked), 0)
+		FROM history_imports i LEFT JOIN history_import_batches b ON b.import_id = i.id
+		WHERE i.id = $1 AND i.user_id = $2
+		GROUP BY i.id
+	`, id, userID).Scan(&imp.ID, &imp.UserID, &imp.SpaceID, &imp.UTCOffsetMinutes, &imp.TotalEntries, &imp.CompletedAt, &imp.CreatedAt,
+		&batches, &imp.Received, &imp.Imported, &imp.Duplicates, &imp.Skipped, &imp.Blocked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("history import")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history import: %w", err)
+	}
+	imp.ReceivedBatches = make([]int, len(batches))
+	for i, b := range batches {
+		imp.ReceivedBatches[i] = int(b)
+	}
+	return &imp, nil
+}
+
+// RecordHistoryImportBatch 记录批次结果；同一序号已记录时保留原结果
+func (db *PostgresDatabase) RecordHistoryImportBatch(b *models.HistoryImportBatch) error {
+	_, err := db.exec(`
+		INSERT INTO history_import_batches (import_id, batch_index, received, imported, duplicates, skipped, blocked)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (import_id, batch_index) DO NOTHING
+	`, b.ImportID, b.Index, b.Received, b.Imported, b.Duplicates, b.Skipped, b.Blocked)
+	if err != nil {
+		return fmt.Errorf("failed to record history import batch: %w", err)
+	}
+	return nil
+}
+
+// CompleteHistoryImport 标记导入完成（重复调用保留首次完成时间）
+func (db *PostgresDatabase) CompleteHistoryImport(id string) error {
+	if _, err := db.exec(`UPDATE history_imports SET completed_at = NOW() WHERE id = $1 AND completed_at IS NULL`, id); err != nil {
+		return fmt.Errorf("failed to complete history import: %w", err)
+	}
+	return nil
+}
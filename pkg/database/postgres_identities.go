@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+const identityColumns = `id, user_id, provider, provider_user_id, COALESCE(email,''), created_at`
+
+func scanUserIdentity(row interface{ Scan(...interface{}) error }) (*models.UserIdentity, error) {
+	var i models.UserIdentity
+	if err := row.Scan(&i.ID, &i.UserID, &i.Provider, &i.ProviderUserID, &i.Email, &i.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// GetUserIdentity 按 provider + provider_user_id 查找关联
+func (db *PostgresDatabase) GetUserIdentity(provider, providerUserID string) (*models.UserIdentity, error) {
+	i, err := scanUserIdentity(db.queryRowRead(`
+		SELECT `+identityColumns+` FROM user_identities WHERE provider = $1 AND provider_user_id = $2
+	`, provider, providerUserID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("identity")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+	return i, nil
+}
+
+// ListUserIdentities 返回用户的全部外部身份
+func (db *PostgresDatabase) ListUserIdentities(userID string) ([]models.UserIdentity, error) {
+	rows, err := db.queryRead(`
+		SELECT `+identityColumns+` FROM user_identities WHERE user_id = $1 ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user identities: %w", err)
+	}
+	defer rows.Close()
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		i, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user identity: %w", err)
+		}
+		identities = append(identities, *i)
+	}
+	return identities, rows.Err()
+}
+
+// LinkUserIdentity 以 (provider, provider_user_id) 唯一约束判断是否已被关联
+func (db *PostgresDatabase) LinkUserIdentity(identity *models.UserIdentity) error {
+	identity.Email = models.NormalizeEmail(identity.Email)
+	err := db.queryRow(`
+		INSERT INTO user_identities (user_id, provider, provider_user_id, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (provider, provider_user_id) DO NOTHING
+		RETURNING id, created_at
+	`, identity.UserID, identity.Provider, identity.ProviderUserID, identity.Email).Scan(&identity.ID, &identity.CreatedAt)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to link user identity: %w", err)
+	}
+	existing, err := db.GetUserIdentity(identity.Provider, identity.ProviderUserID)
+	if err != nil {
+		return err
+	}
+	if existing.UserID != identity.UserID {
+		return ErrIdentityLinked
+	}
+	*identity = *existing
+	return nil
+}
+
+// GetTokenVersion 返回用户当前的令牌版本（由 init_db.sql 中的触发器维护）
+func (db *PostgresDatabase) GetTokenVersion(userID string) (int, error) {
+	var version int
+	err := db.queryRowRead(`SELECT COALESCE(token_version, 0) FROM public.users WHERE id = $1`, userID).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, notFound("user")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token version: %w", err)
+	}
+	return version, nil
+}
+
+// RevokeUserSessions 记录会话吊销时间：此前签发的刷新令牌失效，触发器同时递增令牌版本
+func (db *PostgresDatabase) RevokeUserSessions(userID string) error {
+	res, err := db.exec(`UPDATE public.users SET sessions_revoked_at = NOW() WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("user")
+	}
+	return nil
+}
+
+// GetSessionsRevokedAt 返回最近一次会话吊销时间；从未吊销时为 nil（读主库，吊销后立即生效）
+func (db *PostgresDatabase) GetSessionsRevokedAt(userID string) (*time.Time, error) {
+	var revokedAt *time.Time
+	err := db.queryRow(`SELECT sessions_revoked_at FROM public.users WHERE id = $1`, userID).Scan(&revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("user")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions revoked time: %w", err)
+	}
+	return revokedAt, nil
+}
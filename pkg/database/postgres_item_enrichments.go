@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// EnqueueItemEnrichment 将条目加入元数据补全队列；已在队列中时不重复加入
+func (db *PostgresDatabase) EnqueueItemEnrichment(itemID string) error {
+	_, err := db.exec(`
+		INSERT INTO item_enrichments (item_id) VALUES ($1)
+		ON CONFLICT (item_id) DO NOTHING
+	`, itemID)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue item enrichment: %w", err)
+	}
+	return nil
+}
+
+// ClaimItemEnrichments 以 SKIP LOCKED 认领未认领（或认领早于 staleBefore）的条目，认领时 attempts 加一
+func (db *PostgresDatabase) ClaimItemEnrichments(limit int, staleBefore time.Time) ([]models.ItemEnrichment, error) {
+	rows, err := db.query(`
+		UPDATE item_enrichments SET claimed_at = NOW(), attempts = attempts + 1
+		WHERE item_id IN (
+			SELECT item_id FROM item_enrichments
+			WHERE claimed_at IS NULL OR claimed_at < $2
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING item_id, attempts, claimed_at, created_at
+	`, limit, staleBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim item enrichments: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []models.ItemEnrichment
+	for rows.Next() {
+		var e models.ItemEnrichment
+		if err := rows.Scan(&e.ItemID, &e.Attempts, &e.ClaimedAt, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan item enrichment: %w", err)
+		}
+		claimed = append(claimed, e)
+	}
+	return claimed, rows.Err()
+}
+
+// DeleteItemEnrichment 将条目移出队列（补全完成或放弃）
+func (db *PostgresDatabase) DeleteItemEnrichment(itemID string) error {
+	if _, err := db.exec(`DELETE FROM item_enrichments WHERE item_id = $1`, itemID); err != nil {
+		return fmt.Errorf("failed to delete item enrichment: %w", err)
+	}
+	return nil
+}
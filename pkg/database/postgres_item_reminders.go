@@ -0,0 +1,92 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+const itemReminderColumns = `item_id, user_id, remind_at, email, notified_at, created_at`
+
+func scanItemReminder(row rowScanner) (*models.ItemReminder, error) {
+	var rem models.ItemReminder
+	if err := row.Scan(&rem.ItemID, &rem.UserID, &rem.RemindAt, &rem.Email, &rem.NotifiedAt, &rem.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &rem, nil
+}
+
+// SetItemReminder 设置（覆盖）用户在条目上的提醒；重新设置会清除 notified_at，使提醒再次触发
+func (db *PostgresDatabase) SetItemReminder(rem *models.ItemReminder) error {
+	err := db.queryRow(`
+		INSERT INTO item_reminders (item_id, user_id, remind_at, email) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (item_id, user_id) DO UPDATE SET remind_at = EXCLUDED.remind_at, email = EXCLUDED.email, notified_at = NULL
+		RETURNING notified_at, created_at
+	`, rem.ItemID, rem.UserID, rem.RemindAt, rem.Email).Scan(&rem.NotifiedAt, &rem.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set item reminder: %w", err)
+	}
+	return nil
+}
+
+// DeleteItemReminder 清除提醒；不存在时返回 not found
+func (db *PostgresDatabase) DeleteItemReminder(userID, itemID string) error {
+	res, err := db.exec(`DELETE FROM item_reminders WHERE item_id = $1 AND user_id = $2`, itemID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete item reminder: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("item reminder")
+	}
+	return nil
+}
+
+// ListItemReminders 按 remind_at 升序返回用户的全部提醒
+func (db *PostgresDatabase) ListItemReminders(userID string) ([]models.ItemReminder, error) {
+	rows, err := db.queryRead(`
+		SELECT `+itemReminderColumns+` FROM item_reminders WHERE user_id = $1 ORDER BY remind_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list item reminders: %w", err)
+	}
+	defer rows.Close()
+
+	reminders := []models.ItemReminder{}
+	for rows.Next() {
+		rem, err := scanItemReminder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan item reminder: %w", err)
+		}
+		reminders = append(reminders, *rem)
+	}
+	return reminders, rows.Err()
+}
+
+// ClaimDueItemReminders 以 SKIP LOCKED 认领 remind_at 不晚于 now 且尚未触发的提醒，并标记 notified_at
+func (db *PostgresDatabase) ClaimDueItemReminders(now time.Time, limit int) ([]models.ItemReminder, error) {
+	rows, err := db.query(`
+		UPDATE item_reminders SET notified_at = $1
+		WHERE (item_id, user_id) IN (
+			SELECT item_id, user_id FROM item_reminders
+			WHERE notified_at IS NULL AND remind_at <= $1
+			ORDER BY remind_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+itemReminderColumns, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim item reminders: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []models.ItemReminder
+	for rows.Next() {
+		rem, err := scanItemReminder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan item reminder: %w", err)
+		}
+		claimed = append(claimed, *rem)
+	}
+	return claimed, rows.Err()
+}
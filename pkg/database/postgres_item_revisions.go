@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// itemRevisionColumns 条目历史的列（url 可为 NULL）
+const itemRevisionColumns = "id, item_id, collection_id, title, COALESCE(url, ''), metadata, created_at"
+
+// ListItemRevisions 按时间倒序返回条目的历史版本（由 collection_items 上的触发器写入）
+func (db *PostgresDatabase) ListItemRevisions(itemID string, limit int) ([]models.ItemRevision, error) {
+	rows, err := db.queryRead(`SELECT `+itemRevisionColumns+` FROM item_revisions
+		WHERE item_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`, itemID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list item revisions: %w", err)
+	}
+	defer rows.Close()
+	revisions := []models.ItemRevision{}
+	for rows.Next() {
+		var rev models.ItemRevision
+		if err := rows.Scan(&rev.ID, &rev.ItemID, &rev.CollectionID, &rev.Title, &rev.URL, &rev.Metadata, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// GetItemRevision 返回属于 itemID 的一个历史版本
+func (db *PostgresDatabase) GetItemRevision(itemID, revisionID string) (*models.ItemRevision, error) {
+	var rev models.ItemRevision
+	err := db.queryRow(`SELECT `+itemRevisionColumns+` FROM item_revisions WHERE id = $1 AND item_id = $2`, revisionID, itemID).
+		Scan(&rev.ID, &rev.ItemID, &rev.CollectionID, &rev.Title, &rev.URL, &rev.Metadata, &rev.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("item revision")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item revision: %w", err)
+	}
+	return &rev, nil
+}
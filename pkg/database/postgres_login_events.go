@@ -0,0 +1,43 @@
+package database
+
+import (
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// RecordLoginEvent 记录一次成功登录
+func (db *PostgresDatabase) RecordLoginEvent(e *models.LoginEvent) error {
+	err := db.queryRow(`
+		INSERT INTO login_events (user_id, method, ip, user_agent, country, region, city)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, e.UserID, e.Method, e.IP, e.UserAgent, e.Country, e.Region, e.City).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record login event: %w", err)
+	}
+	return nil
+}
+
+// ListLoginEvents 按时间倒序返回用户最近的 limit 条登录记录
+func (db *PostgresDatabase) ListLoginEvents(userID string, limit int) ([]models.LoginEvent, error) {
+	rows, err := db.queryRead(`
+		SELECT id, user_id, method, ip, user_agent, country, region, city, created_at
+		FROM login_events WHERE user_id = $1
+		ORDER BY created_at DESC LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login events: %w", err)
+	}
+	defer rows.Close()
+	events := []models.LoginEvent{}
+	for rows.Next() {
+		var e models.LoginEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Method, &e.IP, &e.UserAgent,
+			&e.Country, &e.Region, &e.City, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan login event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+
+	"github.com/lib/pq"
+)
+
+// CreateNotification 写入通知；DedupeKey 已存在时不重复写入（n.ID 保持为空）
+func (db *PostgresDatabase) CreateNotification(n *models.Notification) error {
+	data, err := json.Marshal(notificationData(n))
+	if err != nil {
+		return fmt.Errorf("failed to encode notification data: %w", err)
+	}
+	rows, err := db.query(`
+		INSERT INTO public.notifications (user_id, kind, title, body, data, dedupe_key)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, dedupe_key) DO NOTHING
+		RETURNING id, created_at
+	`, n.UserID, n.Kind, n.Title, n.Body, data, n.DedupeKey)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(&n.ID, &n.CreatedAt); err != nil {
+			return fmt.Errorf("failed to create notification: %w", err)
+		}
+	}
+	return rows.Err()
+}
+
+// ListNotifications 按时间倒序分页返回通知及总数
+func (db *PostgresDatabase) ListNotifications(userID string, unreadOnly bool, limit, offset int) ([]models.Notification, int, error) {
+	where := `user_id = $1`
+	if unreadOnly {
+		where += ` AND read_at IS NULL`
+	}
+
+	var total int
+	if err := db.queryRowRead(`SELECT COUNT(*) FROM public.notifications WHERE `+where, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+
+	rows, err := db.queryRead(`
+		SELECT id, user_id, kind, title, body, data, read_at, created_at
+		FROM public.notifications
+		WHERE `+where+`
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Title, &n.Body, &data, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &n.Data); err != nil {
+				return nil, 0, fmt.Errorf("failed to parse notification data: %w", err)
+			}
+		}
+		list = append(list, n)
+	}
+	return list, total, rows.Err()
+}
+
+// CountUnreadNotifications 未读通知数（扩展角标）
+func (db *PostgresDatabase) CountUnreadNotifications(userID string) (int, error) {
+	var n int
+	err := db.queryRowRead(`SELECT COUNT(*) FROM public.notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return n, nil
+}
+
+// MarkNotificationsRead 将指定通知（ids 为空时为全部）标记为已读，返回更新条数
+func (db *PostgresDatabase) MarkNotificationsRead(userID string, ids []string) (int, error) {
+	query := `UPDATE public.notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+	args := []interface{}{userID}
+	if len(ids) > 0 {
+		query += ` AND id::text = ANY($2)`
+		args = append(args, pq.Array(ids))
+	}
+	res, err := db.exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// notificationData data 列不允许为 NULL
+func notificationData(n *models.Notification) map[string]interface{} {
+	if n.Data == nil {
+		return map[string]interface{}{}
+	}
+	return n.Data
+}
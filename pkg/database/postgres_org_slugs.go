@@ -0,0 +1,38 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// GetOrganizationBySlug 按 slug 查找组织 ID，再按 ID 读取完整记录
+func (db *PostgresDatabase) GetOrganizationBySlug(slug string) (*models.Organization, error) {
+	var id string
+	err := db.queryRowRead(`SELECT id FROM organizations WHERE slug = $1`, strings.ToLower(slug)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("organization")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization by slug: %w", err)
+	}
+	return db.GetOrganization(id)
+}
+
+// SetOrganizationSlug 依赖 idx_organizations_slug 唯一索引判断冲突（并发改名时同样可靠）
+func (db *PostgresDatabase) SetOrganizationSlug(orgID, slug string) error {
+	res, err := db.exec(`UPDATE organizations SET slug = $2, updated_at = NOW() WHERE id = $1`, orgID, strings.ToLower(slug))
+	if isUniqueViolation(err) {
+		return ErrSlugTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set organization slug: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return notFound("organization")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// SaveOrgSnapshot 按 (organization_id, name) 插入或覆盖组织共享快照；created_by 保留首次保存者
+func (db *PostgresDatabase) SaveOrgSnapshot(orgID, userID, name string, tabGroups []models.TabGroup) error {
+	tabCount := 0
+	for _, group := range tabGroups {
+		tabCount += len(group.Tabs)
+	}
+	tabGroupsJSON, err := encodeTabGroups(tabGroups, db.compressSnapshots)
+	if err != nil {
+		return err
+	}
+	_, err = db.exec(`
+		INSERT INTO org_snapshots (organization_id, name, tab_groups, group_count, tab_count, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (organization_id, name)
+		DO UPDATE SET
+			tab_groups = EXCLUDED.tab_groups,
+			group_count = EXCLUDED.group_count,
+			tab_count = EXCLUDED.tab_count,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+	`, orgID, name, []byte(tabGroupsJSON), len(tabGroups), tabCount, userID)
+	if err != nil {
+		return fmt.Errorf("failed to save org snapshot: %w", err)
+	}
+	return nil
+}
+
+// ListOrgSnapshots 按 updated_at 倒序列出组织共享快照
+func (db *PostgresDatabase) ListOrgSnapshots(orgID string) ([]SnapshotInfo, error) {
+	rows, err := db.queryRead(`
+		SELECT name, COALESCE(created_by::text, ''), created_at, updated_at, group_count, tab_count
+		FROM org_snapshots
+		WHERE organization_id = $1
+		ORDER BY updated_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query org snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []SnapshotInfo{}
+	for rows.Next() {
+		var s SnapshotInfo
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&s.Name, &s.CreatedBy, &createdAt, &updatedAt, &s.GroupCount, &s.TabCount); err != nil {
+			return nil, fmt.Errorf("failed to scan org snapshot: %w", err)
+		}
+		s.Kind = models.SnapshotKindManual
+		s.CreatedAt = createdAt.Format(time.RFC3339)
+		s.UpdatedAt = updatedAt.Format(time.RFC3339)
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// LoadOrgSnapshotRaw 加载组织共享快照，tab_groups 按 JSONB 原文返回
+func (db *PostgresDatabase) LoadOrgSnapshotRaw(orgID, name string) (*RawSnapshot, error) {
+	var snapshot RawSnapshot
+	var tabGroups []byte
+	err := db.queryRow(`
+		SELECT name, tab_groups, created_at, updated_at
+		FROM org_snapshots
+		WHERE organization_id = $1 AND name = $2
+	`, orgID, name).Scan(&snapshot.Name, &tabGroups, &snapshot.CreatedAt, &snapshot.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("snapshot")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load org snapshot: %w", err)
+	}
+	snapshot.TabGroups, err = decodeTabGroups(tabGroups)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// DeleteOrgSnapshot 删除组织共享快照
+func (db *PostgresDatabase) DeleteOrgSnapshot(orgID, name string) error {
+	res, err := db.exec(`DELETE FROM org_snapshots WHERE organization_id = $1 AND name = $2`, orgID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete org snapshot: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("snapshot")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// ListPermissionGrants 单次聚合查询：用户所属组织的角色（owner 优先于成员角色）左连接组织下未删除的空间及显式权限，
+// 再并上用户仅以访客身份（space_guests 中有记录、非组织成员）访问的空间
+func (db *PostgresDatabase) ListPermissionGrants(userID string) ([]models.PermissionGrant, error) {
+	rows, err := db.queryRead(`
+		WITH roles AS (
+			SELECT o.id AS organization_id, CASE WHEN o.owner_id = $1 THEN 'owner' ELSE m.role END AS role
+			FROM organizations o
+			LEFT JOIN organization_memberships m ON m.organization_id = o.id AND m.user_id = $1
+			WHERE o.owner_id = $1 OR m.user_id IS NOT NULL
+		)
+		SELECT r.organization_id, r.role, s.id, s.name, COALESCE(s.default_access,'view'), COALESCE(s.visibility,'org'), p.can_edit
+		FROM roles r
+		LEFT JOIN spaces s ON s.organization_id = r.organization_id AND s.deleted_at IS NULL
+		LEFT JOIN space_permissions p ON p.space_id = s.id AND p.user_id = $1
+		UNION ALL
+		SELECT s.organization_id, NULL, s.id, s.name, COALESCE(s.default_access,'view'), COALESCE(s.visibility,'org'), p.can_edit
+		FROM space_guests g
+		JOIN spaces s ON s.id = g.space_id AND s.deleted_at IS NULL
+		LEFT JOIN space_permissions p ON p.space_id = g.space_id AND p.user_id = $1
+		WHERE g.user_id = $1 AND NOT EXISTS (SELECT 1 FROM roles r WHERE r.organization_id = s.organization_id)`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permission grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []models.PermissionGrant{}
+	for rows.Next() {
+		var (
+			g                                       models.PermissionGrant
+			role, spaceID, name, access, visibility sql.NullString
+			canEdit                                 sql.NullBool
+		)
+		if err := rows.Scan(&g.OrganizationID, &role, &spaceID, &name, &access, &visibility, &canEdit); err != nil {
+			return nil, err
+		}
+		g.Role = models.OrgMemberRole(role.String)
+		if spaceID.Valid {
+			g.Space = &models.Space{
+				ID:             spaceID.String,
+				OrganizationID: g.OrganizationID,
+				Name:           name.String,
+				DefaultAccess:  access.String,
+				Visibility:     visibility.String,
+			}
+		}
+		if canEdit.Valid {
+			g.Explicit = &canEdit.Bool
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
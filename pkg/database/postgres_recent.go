@@ -0,0 +1,48 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// ListRecentItems 单次聚合查询：spaceIDs 内最近加入的未归档条目与最近删除的条目，各取 limit 条。
+// 最近删除包括随集合一起删除的条目
+func (db *PostgresDatabase) ListRecentItems(spaceIDs []string, limit int) (added, deleted []models.RecentItem, err error) {
+	added, deleted = []models.RecentItem{}, []models.RecentItem{}
+	if len(spaceIDs) == 0 {
+		return added, deleted, nil
+	}
+	columns := "i." + strings.ReplaceAll(collectionItemColumns, ", ", ", i.") + ", c.name, c.space_id"
+	rows, err := db.queryRead(`
+		(SELECT 'added', `+columns+`
+			FROM collection_items i JOIN collections c ON c.id = i.collection_id
+			WHERE c.space_id = ANY($1::uuid[]) AND c.deleted_at IS NULL AND i.deleted_at IS NULL AND i.archived_at IS NULL
+			ORDER BY i.created_at DESC LIMIT $2)
+		UNION ALL
+		(SELECT 'deleted', `+columns+`
+			FROM collection_items i JOIN collections c ON c.id = i.collection_id
+			WHERE c.space_id = ANY($1::uuid[]) AND i.deleted_at IS NOT NULL
+			ORDER BY i.deleted_at DESC LIMIT $2)`, pq.Array(spaceIDs), limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list recent items: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		var it models.RecentItem
+		if err := rows.Scan(&kind, &it.ID, &it.CollectionID, &it.Title, &it.URL, &it.FavIconURL, &it.OriginalTitle, &it.AIGeneratedTitle,
+			&it.Domain, &it.Metadata, &it.Position, &it.CreatedAt, &it.UpdatedAt, &it.ArchivedAt, &it.SnoozedUntil, &it.DeletedAt, &it.CollectionName, &it.SpaceID); err != nil {
+			return nil, nil, err
+		}
+		if kind == "added" {
+			added = append(added, it)
+		} else {
+			deleted = append(deleted, it)
+		}
+	}
+	return added, deleted, rows.Err()
+}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConsumeSessionCode 以主键冲突判断重放
+func (db *PostgresDatabase) ConsumeSessionCode(jti, userID string, expiresAt time.Time) (bool, error) {
+	res, err := db.exec(`
+		INSERT INTO consumed_session_codes (jti, user_id, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, userID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume session code: %w", err)
+	}
+	n, _ := res.RowsAffected()
+
+	if _, err := db.exec(`DELETE FROM consumed_session_codes WHERE expires_at < NOW()`); err != nil {
+		fmt.Printf("⚠️  Failed to purge consumed session codes: %v\n", err)
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// CreateSnapshotUpload 创建分块上传
+func (db *PostgresDatabase) CreateSnapshotUpload(u *models.SnapshotUpload) error {
+	err := db.queryRow(`
+		INSERT INTO snapshot_uploads (user_id, organization_id, name, kind, total_bytes, expires_at)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, u.UserID, u.OrganizationID, u.Name, u.Kind, u.TotalBytes, u.ExpiresAt).Scan(&u.ID, &u.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot upload: %w", err)
+	}
+	u.ReceivedChunks = []int{}
+	return nil
+}
+
+// GetSnapshotUpload 仅返回属于 userID 且未过期的上传，附带已收到的分块（读主库：分块刚刚写入）
+func (db *PostgresDatabase) GetSnapshotUpload(userID, id string) (*models.SnapshotUpload, error) {
+	var u models.SnapshotUpload
+	var chunks pq.Int64Array
+	err := db.queryRow(`
+		SELECT u.id, u.user_id, COALESCE(u.organization_id::text, ''), u.name, u.kind, u.total_bytes, u.expires_at, u.created_at,
+			COALESCE(array_agg(c.chunk_index ORDER BY c.chunk_index) FILTER (WHERE c.chunk_index IS NOT NULL), '{}'),
+			COALESCE(SUM(c.size_bytes), 0)
+		FROM snapshot_uploads u LEFT JOIN snapshot_upload_chunks c ON c.upload_id = u.id
+		WHERE u.id = $1 AND u.user_id = $2 AND u.expires_at > NOW()
+		GROUP BY u.id
+	`, id, userID).Scan(&u.ID, &u.UserID, &u.OrganizationID, &u.Name, &u.Kind, &u.TotalBytes, &u.ExpiresAt, &u.CreatedAt,
+		&chunks, &u.ReceivedBytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("snapshot upload")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot upload: %w", err)
+	}
+	u.ReceivedChunks = make([]int, len(chunks))
+	for i, c := range chunks {
+		u.ReceivedChunks[i] = int(c)
+	}
+	return &u, nil
+}
+
+// PutSnapshotUploadChunk 写入（覆盖）一个分块
+func (db *PostgresDatabase) PutSnapshotUploadChunk(uploadID string, index int, data []byte) error {
+	_, err := db.exec(`
+		INSERT INTO snapshot_upload_chunks (upload_id, chunk_index, data, size_bytes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (upload_id, chunk_index) DO UPDATE SET data = EXCLUDED.data, size_bytes = EXCLUDED.size_bytes, created_at = NOW()
+	`, uploadID, index, data, len(data))
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot upload chunk: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshotUploadChunks 按序号升序返回全部分块内容
+func (db *PostgresDatabase) LoadSnapshotUploadChunks(uploadID string) ([][]byte, error) {
+	rows, err := db.query(`
+		SELECT data FROM snapshot_upload_chunks WHERE upload_id = $1 ORDER BY chunk_index
+	`, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot upload chunks: %w", err)
+	}
+	defer rows.Close()
+	var chunks [][]byte
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot upload chunk: %w", err)
+		}
+		chunks = append(chunks, data)
+	}
+	return chunks, rows.Err()
+}
+
+// DeleteSnapshotUpload 删除上传及其分块
+func (db *PostgresDatabase) DeleteSnapshotUpload(id string) error {
+	if _, err := db.exec(`DELETE FROM snapshot_uploads WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete snapshot upload: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredSnapshotUploads 删除 expires_at 早于 before 的上传，返回条数
+func (db *PostgresDatabase) PurgeExpiredSnapshotUploads(before time.Time) (int, error) {
+	res, err := db.exec(`DELETE FROM snapshot_uploads WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge snapshot uploads: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
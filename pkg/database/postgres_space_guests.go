@@ -0,0 +1,123 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// DeleteSpacePermission 删除显式权限
+func (db *PostgresDatabase) DeleteSpacePermission(spaceID, userID string) error {
+	if _, err := db.exec(`DELETE FROM space_permissions WHERE space_id = $1 AND user_id = $2`, spaceID, userID); err != nil {
+		return fmt.Errorf("failed to delete space permission: %w", err)
+	}
+	return nil
+}
+
+// CreateSpaceInvitation 写入访客邀请
+func (db *PostgresDatabase) CreateSpaceInvitation(inv *models.SpaceInvitation) error {
+	inv.Email = models.NormalizeEmail(inv.Email)
+	err := db.queryRow(`
+		INSERT INTO space_invitations (organization_id, space_id, email, inviter_id, token, can_edit, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`, inv.OrganizationID, inv.SpaceID, inv.Email, inv.InviterID, hashToken(inv.Token), inv.CanEdit, string(inv.Status), inv.ExpiresAt).
+		Scan(&inv.ID, &inv.CreatedAt, &inv.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create space invitation: %w", err)
+	}
+	return nil
+}
+
+// GetSpaceInvitationByToken 按 token 摘要查找访客邀请
+func (db *PostgresDatabase) GetSpaceInvitationByToken(token string) (*models.SpaceInvitation, error) {
+	return db.getSpaceInvitation(`token = $1`, hashToken(token))
+}
+
+// GetSpaceInvitationByID 按 ID 查找访客邀请（应用内接受）
+func (db *PostgresDatabase) GetSpaceInvitationByID(id string) (*models.SpaceInvitation, error) {
+	return db.getSpaceInvitation(`id::text = $1`, id)
+}
+
+// getSpaceInvitation token 列只存摘要，不读出
+func (db *PostgresDatabase) getSpaceInvitation(cond string, arg interface{}) (*models.SpaceInvitation, error) {
+	var inv models.SpaceInvitation
+	var status string
+	err := db.queryRowRead(`
+		SELECT id, organization_id, space_id, email, inviter_id, can_edit, status, expires_at, accepted_by, created_at, updated_at
+		FROM space_invitations WHERE `+cond, arg).Scan(&inv.ID, &inv.OrganizationID, &inv.SpaceID, &inv.Email, &inv.InviterID, &inv.CanEdit, &status,
+		&inv.ExpiresAt, &inv.AcceptedBy, &inv.CreatedAt, &inv.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("invitation")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get space invitation: %w", err)
+	}
+	inv.Status = models.InvitationStatus(status)
+	return &inv, nil
+}
+
+// UpdateSpaceInvitation 更新状态与接受者
+func (db *PostgresDatabase) UpdateSpaceInvitation(inv *models.SpaceInvitation) error {
+	_, err := db.exec(`
+		UPDATE space_invitations SET status = $1, accepted_by = $2, updated_at = NOW() WHERE id = $3
+	`, string(inv.Status), inv.AcceptedBy, inv.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update space invitation: %w", err)
+	}
+	return nil
+}
+
+// AddSpaceGuest 记录访客并写入显式权限（单条语句，两者同时生效）
+func (db *PostgresDatabase) AddSpaceGuest(spaceID, userID, invitationID string, canEdit bool) error {
+	_, err := db.exec(`
+		WITH guest AS (
+			INSERT INTO space_guests (space_id, user_id, invitation_id) VALUES ($1, $2, $3)
+			ON CONFLICT (space_id, user_id) DO UPDATE SET invitation_id = EXCLUDED.invitation_id
+		)
+		INSERT INTO space_permissions (space_id, user_id, can_edit) VALUES ($1, $2, $4)
+		ON CONFLICT (space_id, user_id) DO UPDATE SET can_edit = EXCLUDED.can_edit, updated_at = NOW()
+	`, spaceID, userID, nullIfEmpty(invitationID), canEdit)
+	if err != nil {
+		return fmt.Errorf("failed to add space guest: %w", err)
+	}
+	return nil
+}
+
+// RemoveSpaceGuest 删除访客记录及其显式权限
+func (db *PostgresDatabase) RemoveSpaceGuest(spaceID, userID string) error {
+	_, err := db.exec(`
+		WITH guest AS (DELETE FROM space_guests WHERE space_id = $1 AND user_id = $2)
+		DELETE FROM space_permissions WHERE space_id = $1 AND user_id = $2
+	`, spaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove space guest: %w", err)
+	}
+	return nil
+}
+
+// ListSpaceGuests 按加入时间返回访客，can_edit 取自显式权限
+func (db *PostgresDatabase) ListSpaceGuests(spaceID string) ([]models.SpaceGuest, error) {
+	rows, err := db.queryRead(`
+		SELECT g.user_id, COALESCE(p.can_edit, FALSE), g.created_at
+		FROM space_guests g
+		LEFT JOIN space_permissions p ON p.space_id = g.space_id AND p.user_id = g.user_id
+		WHERE g.space_id = $1
+		ORDER BY g.created_at, g.user_id
+	`, spaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list space guests: %w", err)
+	}
+	defer rows.Close()
+	guests := []models.SpaceGuest{}
+	for rows.Next() {
+		var g models.SpaceGuest
+		if err := rows.Scan(&g.UserID, &g.CanEdit, &g.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan space guest: %w", err)
+		}
+		guests = append(guests, g)
+	}
+	return guests, rows.Err()
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// RecordTierChange 记录一次等级变化
+func (db *PostgresDatabase) RecordTierChange(c *models.TierChange) error {
+	err := db.queryRow(`
+		INSERT INTO tier_changes (user_id, old_tier, new_tier, source, reference_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, c.UserID, c.OldTier, c.NewTier, c.Source, c.ReferenceID).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record tier change: %w", err)
+	}
+	return nil
+}
+
+// ListTierChanges 按时间倒序返回用户最近的 limit 条等级变化
+func (db *PostgresDatabase) ListTierChanges(userID string, limit int) ([]models.TierChange, error) {
+	rows, err := db.queryRead(`
+		SELECT id, user_id, old_tier, new_tier, source, reference_id, created_at
+		FROM tier_changes WHERE user_id = $1
+		ORDER BY created_at DESC LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tier changes: %w", err)
+	}
+	defer rows.Close()
+	changes := []models.TierChange{}
+	for rows.Next() {
+		var c models.TierChange
+		if err := rows.Scan(&c.ID, &c.UserID, &c.OldTier, &c.NewTier, &c.Source, &c.ReferenceID, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tier change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+const webArchiveJobColumns = `item_id, organization_id, COALESCE(job_id, ''), attempts, next_attempt_at, claimed_at, created_at`
+
+// GetWebArchiveEnabled 组织是否开启了网页存档
+func (db *PostgresDatabase) GetWebArchiveEnabled(orgID string) (bool, error) {
+	var one int
+	err := db.queryRow(`SELECT 1 FROM organization_web_archive WHERE organization_id = $1`, orgID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get web archive setting: %w", err)
+	}
+	return true, nil
+}
+
+// SetWebArchiveEnabled 开启（记录操作者）或关闭组织的网页存档；关闭时同时清空该组织尚未完成的存档任务
+func (db *PostgresDatabase) SetWebArchiveEnabled(orgID, userID string, enabled bool) error {
+	if enabled {
+		_, err := db.exec(`
+			INSERT INTO organization_web_archive (organization_id, enabled_by) VALUES ($1, $2)
+			ON CONFLICT (organization_id) DO NOTHING
+		`, orgID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to enable web archive: %w", err)
+		}
+		return nil
+	}
+	if _, err := db.exec(`DELETE FROM organization_web_archive WHERE organization_id = $1`, orgID); err != nil {
+		return fmt.Errorf("failed to disable web archive: %w", err)
+	}
+	if _, err := db.exec(`DELETE FROM web_archive_jobs WHERE organization_id = $1`, orgID); err != nil {
+		return fmt.Errorf("failed to clear web archive jobs: %w", err)
+	}
+	return nil
+}
+
+// EnqueueWebArchiveJob 将条目加入存档队列；已在队列中时不重复加入
+func (db *PostgresDatabase) EnqueueWebArchiveJob(itemID, orgID string) error {
+	_, err := db.exec(`
+		INSERT INTO web_archive_jobs (item_id, organization_id) VALUES ($1, $2)
+		ON CONFLICT (item_id) DO NOTHING
+	`, itemID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue web archive job: %w", err)
+	}
+	return nil
+}
+
+// ClaimWebArchiveJobs 以 SKIP LOCKED 认领 next_attempt_at 已到且未认领（或认领早于 staleBefore）的任务
+func (db *PostgresDatabase) ClaimWebArchiveJobs(limit int, now, staleBefore time.Time) ([]models.WebArchiveJob, error) {
+	rows, err := db.query(`
+		UPDATE web_archive_jobs SET claimed_at = $2
+		WHERE item_id IN (
+			SELECT item_id FROM web_archive_jobs
+			WHERE next_attempt_at <= $2 AND (claimed_at IS NULL OR claimed_at < $3)
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webArchiveJobColumns, limit, now, staleBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim web archive jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.WebArchiveJob
+	for rows.Next() {
+		var j models.WebArchiveJob
+		if err := rows.Scan(&j.ItemID, &j.OrganizationID, &j.JobID, &j.Attempts, &j.NextAttemptAt, &j.ClaimedAt, &j.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan web archive job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// UpdateWebArchiveJob 保存任务进度（job_id、attempts、next_attempt_at）并释放认领
+func (db *PostgresDatabase) UpdateWebArchiveJob(j *models.WebArchiveJob) error {
+	_, err := db.exec(`
+		UPDATE web_archive_jobs SET job_id = NULLIF($2, ''), attempts = $3, next_attempt_at = $4, claimed_at = NULL
+		WHERE item_id = $1
+	`, j.ItemID, j.JobID, j.Attempts, j.NextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("failed to update web archive job: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebArchiveJob 将条目移出存档队列（完成或放弃）
+func (db *PostgresDatabase) DeleteWebArchiveJob(itemID string) error {
+	if _, err := db.exec(`DELETE FROM web_archive_jobs WHERE item_id = $1`, itemID); err != nil {
+		return fmt.Errorf("failed to delete web archive job: %w", err)
+	}
+	return nil
+}
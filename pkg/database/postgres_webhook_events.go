@@ -0,0 +1,24 @@
+package database
+
+import "fmt"
+
+// ClaimWebhookEvent 以主键冲突判断重复投递
+func (db *PostgresDatabase) ClaimWebhookEvent(eventID, eventType string) (bool, error) {
+	res, err := db.exec(`
+		INSERT INTO paddle_webhook_events (event_id, event_type) VALUES ($1, $2)
+		ON CONFLICT (event_id) DO NOTHING
+	`, eventID, eventType)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook event: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// ReleaseWebhookEvent 删除事件记录
+func (db *PostgresDatabase) ReleaseWebhookEvent(eventID string) error {
+	if _, err := db.exec(`DELETE FROM paddle_webhook_events WHERE event_id = $1`, eventID); err != nil {
+		return fmt.Errorf("failed to release webhook event: %w", err)
+	}
+	return nil
+}
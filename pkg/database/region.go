@@ -0,0 +1,720 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// 支持的数据区域
+const (
+	RegionUS = "us"
+	RegionEU = "eu"
+)
+
+// RegionalDatabase 数据驻留路由层：账户、计费、通知、个人快照与组织目录（organizations、
+// organization_memberships）始终在主库；固定到其他区域的组织，其空间、集合、条目与组织共享快照只存放在该区域库，
+// 区域库另存组织与成员的副本，使成员范围校验在同一库内完成。每个查询只落在一个库上，不做跨区域 JOIN。
+//
+// 以组织为键的调用按组织的区域路由；只带空间/集合/条目 ID 的调用使用本请求中先前解析到的区域
+// （GetSpaceByID / GetCollection / GetCollectionItem 会依次在各区域查找并记住命中的区域，
+// 处理器在修改前都会先做这些带权限的查找）。一次操作涉及不同区域的资源时返回 ErrCrossRegion。
+type RegionalDatabase struct {
+	DatabaseInterface // 主库（home 区域）
+
+	home       string
+	regions    map[string]DatabaseInterface // home 之外的区域库
+	orgRegions *sync.Map                    // orgID -> 区域；区域在创建时确定且不可变，进程内共享
+	req        *regionRequest
+}
+
+// regionRequest 单个请求内解析到的资源区域（WithContext 时新建）
+type regionRequest struct {
+	mu      sync.Mutex
+	current string
+	located map[string]string
+}
+
+// NewRegionalDatabase 在 primary 之上连接各区域库（PostgreSQL）
+func NewRegionalDatabase(primary DatabaseInterface, home string, dsns map[string]string) (DatabaseInterface, error) {
+	if home == "" {
+		home = RegionUS
+	}
+	regions := map[string]DatabaseInterface{}
+	for region, dsn := range dsns {
+		db, err := NewPostgresDatabase(dsn)
+		if err != nil {
+			for _, opened := range regions {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("failed to connect to %s region database: %w", region, err)
+		}
+		regions[region] = NewCachedDatabase(db)
+	}
+	fmt.Printf("🌍 Data residency enabled: home region %s, regional databases %s\n", home, strings.Join(sortedRegions(regions), ", "))
+	return &RegionalDatabase{
+		DatabaseInterface: primary,
+		home:              home,
+		regions:           regions,
+		orgRegions:        &sync.Map{},
+		req:               &regionRequest{located: map[string]string{}},
+	}, nil
+}
+
+// WithContext 实现 contextBinder：各库都绑定到 ctx，并开始新的请求内区域记录
+func (db *RegionalDatabase) WithContext(ctx context.Context) DatabaseInterface {
+	c := *db
+	c.DatabaseInterface = WithContext(db.DatabaseInterface, ctx)
+	c.regions = make(map[string]DatabaseInterface, len(db.regions))
+	for region, r := range db.regions {
+		c.regions[region] = WithContext(r, ctx)
+	}
+	c.req = &regionRequest{located: map[string]string{}}
+	return &c
+}
+
+// Regions 返回可用的区域（含 home）
+func (db *RegionalDatabase) Regions() []string {
+	return append([]string{db.home}, sortedRegions(db.regions)...)
+}
+
+func sortedRegions(regions map[string]DatabaseInterface) []string {
+	names := make([]string, 0, len(regions))
+	for region := range regions {
+		names = append(names, region)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (db *RegionalDatabase) normalize(region string) string {
+	region = strings.ToLower(strings.TrimSpace(region))
+	if region == "" {
+		return db.home
+	}
+	return region
+}
+
+// regionDB 返回区域对应的库
+func (db *RegionalDatabase) regionDB(region string) (DatabaseInterface, error) {
+	region = db.normalize(region)
+	if region == db.home {
+		return db.DatabaseInterface, nil
+	}
+	if r, ok := db.regions[region]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedRegion, region)
+}
+
+// orgRegion 从主库目录解析组织所在区域
+func (db *RegionalDatabase) orgRegion(orgID string) (string, error) {
+	if region, ok := db.orgRegions.Load(orgID); ok {
+		return region.(string), nil
+	}
+	org, err := db.DatabaseInterface.GetOrganization(orgID)
+	if err != nil {
+		return "", err
+	}
+	region := db.normalize(org.Region)
+	db.orgRegions.Store(orgID, region)
+	return region, nil
+}
+
+// forOrg 返回组织所在区域的库，并将其设为本请求的当前区域
+func (db *RegionalDatabase) forOrg(orgID string) (string, DatabaseInterface, error) {
+	region, err := db.orgRegion(orgID)
+	if err != nil {
+		return "", nil, err
+	}
+	target, err := db.regionDB(region)
+	if err != nil {
+		return "", nil, err
+	}
+	db.req.mu.Lock()
+	db.req.current = region
+	db.req.mu.Unlock()
+	return region, target, nil
+}
+
+// forIDs 返回这些资源所在区域的库：已知区域必须一致（否则 ErrCrossRegion），都未知时使用当前区域
+func (db *RegionalDatabase) forIDs(ids ...string) (string, DatabaseInterface, error) {
+	db.req.mu.Lock()
+	region := ""
+	for _, id := range ids {
+		known, ok := db.req.located[id]
+		if !ok {
+			continue
+		}
+		if region != "" && known != region {
+			db.req.mu.Unlock()
+			return "", nil, ErrCrossRegion
+		}
+		region = known
+	}
+	if region == "" {
+		region = db.normalize(db.req.current)
+	}
+	db.req.mu.Unlock()
+
+	target, err := db.regionDB(region)
+	return region, target, err
+}
+
+// remember 记录资源所在区域
+func (db *RegionalDatabase) remember(region string, ids ...string) {
+	db.req.mu.Lock()
+	defer db.req.mu.Unlock()
+	for _, id := range ids {
+		if id != "" {
+			db.req.located[id] = region
+		}
+	}
+	db.req.current = region
+}
+
+// probe 依次在各区域查找资源（已知区域、当前区域优先），命中后记住所在区域
+func (db *RegionalDatabase) probe(id string, find func(DatabaseInterface) error) error {
+	db.req.mu.Lock()
+	first, ok := db.req.located[id]
+	if !ok {
+		first = db.normalize(db.req.current)
+	}
+	db.req.mu.Unlock()
+
+	order := []string{first}
+	for _, region := range db.Regions() {
+		if region != first {
+			order = append(order, region)
+		}
+	}
+
+	var lastErr error
+	for _, region := range order {
+		target, err := db.regionDB(region)
+		if err != nil {
+			continue
+		}
+		err = find(target)
+		if err == nil {
+			db.remember(region, id)
+			return nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// ================ Organizations & Memberships =================
+
+// CreateOrganization 在组织的区域库创建组织（含 owner 成员），再以同一 ID 登记到主库目录
+func (db *RegionalDatabase) CreateOrganization(org *models.Organization) error {
+	region := db.normalize(org.Region)
+	if region == db.home {
+		org.Region = ""
+		err := db.DatabaseInterface.CreateOrganization(org)
+		org.Region = region
+		return err
+	}
+	target, err := db.regionDB(region)
+	if err != nil {
+		return err
+	}
+	org.Region = region
+	if err := target.CreateOrganization(org); err != nil {
+		return err
+	}
+	if err := db.DatabaseInterface.CreateOrganization(org); err != nil {
+		return fmt.Errorf("failed to register organization in directory: %w", err)
+	}
+	db.orgRegions.Store(org.ID, region)
+	return nil
+}
+
+// UpdateOrganization 更新主库目录，区域组织同时更新区域库中的副本
+func (db *RegionalDatabase) UpdateOrganization(org *models.Organization) error {
+	if err := db.DatabaseInterface.UpdateOrganization(org); err != nil {
+		return err
+	}
+	region := db.normalize(org.Region)
+	org.Region = region
+	if region == db.home {
+		return nil
+	}
+	target, err := db.regionDB(region)
+	if err != nil {
+		return err
+	}
+	replica := *org
+	return target.UpdateOrganization(&replica)
+}
+
+// ListUserOrganizations 从主库目录列出（区域为空的组织标记为 home 区域）
+func (db *RegionalDatabase) ListUserOrganizations(userID string) ([]models.Organization, error) {
+	orgs, err := db.DatabaseInterface.ListUserOrganizations(userID)
+	for i := range orgs {
+		orgs[i].Region = db.normalize(orgs[i].Region)
+		db.orgRegions.Store(orgs[i].ID, orgs[i].Region)
+	}
+	return orgs, err
+}
+
+// GetOrganization 从主库目录读取
+func (db *RegionalDatabase) GetOrganization(orgID string) (*models.Organization, error) {
+	org, err := db.DatabaseInterface.GetOrganization(orgID)
+	if err != nil {
+		return nil, err
+	}
+	org.Region = db.normalize(org.Region)
+	db.orgRegions.Store(org.ID, org.Region)
+	return org, nil
+}
+
+// GetOrganizationBySlug 从主库目录读取（slug 只存于目录）
+func (db *RegionalDatabase) GetOrganizationBySlug(slug string) (*models.Organization, error) {
+	org, err := db.DatabaseInterface.GetOrganizationBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	org.Region = db.normalize(org.Region)
+	db.orgRegions.Store(org.ID, org.Region)
+	return org, nil
+}
+
+// AddOrganizationMember 写入主库目录，区域组织同时写入区域库的成员副本
+func (db *RegionalDatabase) AddOrganizationMember(m *models.OrganizationMembership) error {
+	if err := db.DatabaseInterface.AddOrganizationMember(m); err != nil {
+		return err
+	}
+	region, err := db.orgRegion(m.OrganizationID)
+	if err != nil || region == db.home {
+		return err
+	}
+	target, err := db.regionDB(region)
+	if err != nil {
+		return err
+	}
+	replica := *m
+	return target.AddOrganizationMember(&replica)
+}
+
+// RemoveOrganizationMember 从主库目录删除，区域组织同时删除区域库的成员副本（区域库的触发器清除该库中的空间权限与访客记录）
+func (db *RegionalDatabase) RemoveOrganizationMember(orgID, userID string) error {
+	if err := db.DatabaseInterface.RemoveOrganizationMember(orgID, userID); err != nil {
+		return err
+	}
+	region, err := db.orgRegion(orgID)
+	if err != nil || region == db.home {
+		return err
+	}
+	target, err := db.regionDB(region)
+	if err != nil {
+		return err
+	}
+	if err := target.RemoveOrganizationMember(orgID, userID); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// ================ Spaces =================
+
+func (db *RegionalDatabase) CreateSpace(space *models.Space) error {
+	region, target, err := db.forOrg(space.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if err := target.CreateSpace(space); err != nil {
+		return err
+	}
+	db.remember(region, space.ID)
+	return nil
+}
+
+func (db *RegionalDatabase) ListSpacesByOrganization(orgID string) ([]models.Space, error) {
+	region, target, err := db.forOrg(orgID)
+	if err != nil {
+		return nil, err
+	}
+	spaces, err := target.ListSpacesByOrganization(orgID)
+	for _, s := range spaces {
+		db.remember(region, s.ID)
+	}
+	return spaces, err
+}
+
+func (db *RegionalDatabase) UpdateSpace(space *models.Space) error {
+	var target DatabaseInterface
+	var err error
+	if space.OrganizationID != "" {
+		_, target, err = db.forOrg(space.OrganizationID)
+	} else {
+		_, target, err = db.forIDs(space.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return target.UpdateSpace(space)
+}
+
+func (db *RegionalDatabase) GetSpaceByID(userID, spaceID string) (*models.Space, error) {
+	var space *models.Space
+	err := db.probe(spaceID, func(target DatabaseInterface) error {
+		var err error
+		space, err = target.GetSpaceByID(userID, spaceID)
+		return err
+	})
+	return space, err
+}
+
+func (db *RegionalDatabase) DeleteSpace(spaceID string) error {
+	_, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return err
+	}
+	return target.DeleteSpace(spaceID)
+}
+
+func (db *RegionalDatabase) SetSpacePermission(spaceID, userID string, canEdit bool) error {
+	_, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return err
+	}
+	return target.SetSpacePermission(spaceID, userID, canEdit)
+}
+
+func (db *RegionalDatabase) DeleteSpacePermission(spaceID, userID string) error {
+	_, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return err
+	}
+	return target.DeleteSpacePermission(spaceID, userID)
+}
+
+func (db *RegionalDatabase) GetSpacePermissions(spaceID string) ([]models.SpacePermission, error) {
+	_, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	return target.GetSpacePermissions(spaceID)
+}
+
+func (db *RegionalDatabase) AddSpaceGuest(spaceID, userID, invitationID string, canEdit bool) error {
+	_, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return err
+	}
+	return target.AddSpaceGuest(spaceID, userID, invitationID, canEdit)
+}
+
+func (db *RegionalDatabase) RemoveSpaceGuest(spaceID, userID string) error {
+	_, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return err
+	}
+	return target.RemoveSpaceGuest(spaceID, userID)
+}
+
+func (db *RegionalDatabase) ListSpaceGuests(spaceID string) ([]models.SpaceGuest, error) {
+	_, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	return target.ListSpaceGuests(spaceID)
+}
+
+// ================ Collections =================
+
+func (db *RegionalDatabase) CreateCollection(c *models.Collection) error {
+	region, target, err := db.forIDs(c.SpaceID)
+	if err != nil {
+		return err
+	}
+	if err := target.CreateCollection(c); err != nil {
+		return err
+	}
+	db.remember(region, c.ID)
+	return nil
+}
+
+func (db *RegionalDatabase) UpdateCollection(c *models.Collection) error {
+	_, target, err := db.forIDs(c.ID, c.SpaceID)
+	if err != nil {
+		return err
+	}
+	return target.UpdateCollection(c)
+}
+
+func (db *RegionalDatabase) DeleteCollection(id string) error {
+	_, target, err := db.forIDs(id)
+	if err != nil {
+		return err
+	}
+	return target.DeleteCollection(id)
+}
+
+func (db *RegionalDatabase) ListCollectionsBySpace(spaceID string) ([]models.Collection, error) {
+	region, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := target.ListCollectionsBySpace(spaceID)
+	for _, c := range collections {
+		db.remember(region, c.ID)
+	}
+	return collections, err
+}
+
+func (db *RegionalDatabase) GetCollection(userID, id string) (*models.Collection, error) {
+	var collection *models.Collection
+	err := db.probe(id, func(target DatabaseInterface) error {
+		var err error
+		collection, err = target.GetCollection(userID, id)
+		return err
+	})
+	return collection, err
+}
+
+func (db *RegionalDatabase) GetCollectionOrganizationID(collectionID string) (string, error) {
+	var orgID string
+	err := db.probe(collectionID, func(target DatabaseInterface) error {
+		var err error
+		orgID, err = target.GetCollectionOrganizationID(collectionID)
+		return err
+	})
+	return orgID, err
+}
+
+// ================ Collection Items =================
+
+func (db *RegionalDatabase) CreateCollectionItem(it *models.CollectionItem) error {
+	region, target, err := db.forIDs(it.CollectionID)
+	if err != nil {
+		return err
+	}
+	if err := target.CreateCollectionItem(it); err != nil {
+		return err
+	}
+	db.remember(region, it.ID)
+	return nil
+}
+
+func (db *RegionalDatabase) GetCollectionItem(id string) (*models.CollectionItem, error) {
+	var item *models.CollectionItem
+	err := db.probe(id, func(target DatabaseInterface) error {
+		var err error
+		item, err = target.GetCollectionItem(id)
+		return err
+	})
+	return item, err
+}
+
+func (db *RegionalDatabase) UpdateCollectionItem(it *models.CollectionItem) error {
+	_, target, err := db.forIDs(it.ID, it.CollectionID)
+	if err != nil {
+		return err
+	}
+	return target.UpdateCollectionItem(it)
+}
+
+// UpdateCollectionItemPartial 移动条目（patch 含 collection_id）时目标集合必须与条目在同一区域
+func (db *RegionalDatabase) UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) (*models.CollectionItem, error) {
+	ids := []string{itemID}
+	if collectionID, ok := patch["collection_id"].(string); ok {
+		ids = append(ids, collectionID)
+	}
+	_, target, err := db.forIDs(ids...)
+	if err != nil {
+		return nil, err
+	}
+	return target.UpdateCollectionItemPartial(itemID, patch)
+}
+
+func (db *RegionalDatabase) DeleteCollectionItem(collectionID, id string) error {
+	_, target, err := db.forIDs(collectionID, id)
+	if err != nil {
+		return err
+	}
+	return target.DeleteCollectionItem(collectionID, id)
+}
+
+func (db *RegionalDatabase) ListItemsByCollection(collectionID, state string) ([]models.CollectionItem, error) {
+	region, target, err := db.forIDs(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := target.ListItemsByCollection(collectionID, state)
+	for _, it := range items {
+		db.remember(region, it.ID)
+	}
+	return items, err
+}
+
+func (db *RegionalDatabase) ListItemsBySpace(spaceID, state string) ([]models.CollectionItem, error) {
+	region, target, err := db.forIDs(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := target.ListItemsBySpace(spaceID, state)
+	for _, it := range items {
+		db.remember(region, it.ID)
+	}
+	return items, err
+}
+
+// ListRecentItems spaceIDs 须属于同一组织（同一区域）
+func (db *RegionalDatabase) ListRecentItems(spaceIDs []string, limit int) ([]models.RecentItem, []models.RecentItem, error) {
+	region, target, err := db.forIDs(spaceIDs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	added, deleted, err := target.ListRecentItems(spaceIDs, limit)
+	for _, list := range [][]models.RecentItem{added, deleted} {
+		for _, it := range list {
+			db.remember(region, it.ID)
+		}
+	}
+	return added, deleted, err
+}
+
+func (db *RegionalDatabase) FindItemByCollectionAndNormalizedURL(collectionID, normalizedURL string) (*models.CollectionItem, error) {
+	_, target, err := db.forIDs(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	return target.FindItemByCollectionAndNormalizedURL(collectionID, normalizedURL)
+}
+
+// 条目历史与条目同在区域库；调用方先经 GetCollectionItem 解析条目所在区域
+func (db *RegionalDatabase) ListItemRevisions(itemID string, limit int) ([]models.ItemRevision, error) {
+	_, target, err := db.forIDs(itemID)
+	if err != nil {
+		return nil, err
+	}
+	return target.ListItemRevisions(itemID, limit)
+}
+
+func (db *RegionalDatabase) GetItemRevision(itemID, revisionID string) (*models.ItemRevision, error) {
+	_, target, err := db.forIDs(itemID)
+	if err != nil {
+		return nil, err
+	}
+	return target.GetItemRevision(itemID, revisionID)
+}
+
+// ================ Org Snapshots =================
+
+func (db *RegionalDatabase) SaveOrgSnapshot(orgID, userID, name string, tabGroups []models.TabGroup) error {
+	_, target, err := db.forOrg(orgID)
+	if err != nil {
+		return err
+	}
+	return target.SaveOrgSnapshot(orgID, userID, name, tabGroups)
+}
+
+func (db *RegionalDatabase) ListOrgSnapshots(orgID string) ([]SnapshotInfo, error) {
+	_, target, err := db.forOrg(orgID)
+	if err != nil {
+		return nil, err
+	}
+	return target.ListOrgSnapshots(orgID)
+}
+
+func (db *RegionalDatabase) LoadOrgSnapshotRaw(orgID, name string) (*RawSnapshot, error) {
+	_, target, err := db.forOrg(orgID)
+	if err != nil {
+		return nil, err
+	}
+	return target.LoadOrgSnapshotRaw(orgID, name)
+}
+
+func (db *RegionalDatabase) DeleteOrgSnapshot(orgID, name string) error {
+	_, target, err := db.forOrg(orgID)
+	if err != nil {
+		return err
+	}
+	return target.DeleteOrgSnapshot(orgID, name)
+}
+
+// ================ 跨区域汇总 =================
+
+// GetActivityDigest 在每个区域分别汇总后合并（不跨区域 JOIN）
+func (db *RegionalDatabase) GetActivityDigest(userID string, since time.Time) (*models.ActivityDigest, error) {
+	merged, err := db.DatabaseInterface.GetActivityDigest(userID, since)
+	if err != nil {
+		return nil, err
+	}
+	for _, region := range sortedRegions(db.regions) {
+		d, err := db.regions[region].GetActivityDigest(userID, since)
+		if err != nil {
+			return nil, fmt.Errorf("%s region: %w", region, err)
+		}
+		merged.NewItemsCount += d.NewItemsCount
+		merged.RecentItems = append(merged.RecentItems, d.RecentItems...)
+		merged.SharedSpaces = append(merged.SharedSpaces, d.SharedSpaces...)
+		merged.DeadLinksCount += d.DeadLinksCount
+		merged.DeadLinks = append(merged.DeadLinks, d.DeadLinks...)
+	}
+	if len(merged.RecentItems) > digestItemsLimit {
+		merged.RecentItems = merged.RecentItems[:digestItemsLimit]
+	}
+	if len(merged.DeadLinks) > digestDeadLinksLimit {
+		merged.DeadLinks = merged.DeadLinks[:digestDeadLinksLimit]
+	}
+	return merged, nil
+}
+
+// ListPermissionGrants 主库与各区域库分别聚合后合并；区域组织的目录行在主库（只有角色、没有空间），
+// 其空间行来自区域库的成员副本，处理器按组织合并角色
+func (db *RegionalDatabase) ListPermissionGrants(userID string) ([]models.PermissionGrant, error) {
+	merged, err := db.DatabaseInterface.ListPermissionGrants(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, region := range sortedRegions(db.regions) {
+		grants, err := db.regions[region].ListPermissionGrants(userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s region: %w", region, err)
+		}
+		for _, g := range grants {
+			if g.Space != nil {
+				db.remember(region, g.Space.ID)
+			}
+		}
+		merged = append(merged, grants...)
+	}
+	return merged, nil
+}
+
+// HealthCheck 主库与所有区域库都可用
+func (db *RegionalDatabase) HealthCheck() error {
+	if err := db.DatabaseInterface.HealthCheck(); err != nil {
+		return err
+	}
+	for _, region := range sortedRegions(db.regions) {
+		if err := db.regions[region].HealthCheck(); err != nil {
+			return fmt.Errorf("%s region: %w", region, err)
+		}
+	}
+	return nil
+}
+
+// Close 关闭主库与所有区域库
+func (db *RegionalDatabase) Close() error {
+	err := db.DatabaseInterface.Close()
+	for _, r := range db.regions {
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
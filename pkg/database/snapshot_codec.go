@@ -0,0 +1,73 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// compressedTabGroups 压缩存储时写入 tab_groups 列的包装对象；未压缩的快照仍为 JSON 数组，
+// 两种格式可以共存，读取时按首字符区分
+type compressedTabGroups struct {
+	Encoding string `json:"encoding"` // 目前只有 "gzip"
+	Data     []byte `json:"data"`     // base64 编码的压缩数据
+}
+
+// snapshotCompressor 由两种数据库实现提供，NewDatabase 按 DatabaseConfig.SnapshotCompression 开启
+type snapshotCompressor interface {
+	setSnapshotCompression(enabled bool)
+}
+
+func (db *PostgresDatabase) setSnapshotCompression(enabled bool) { db.compressSnapshots = enabled }
+func (db *SupabaseDatabase) setSnapshotCompression(enabled bool) { db.compressSnapshots = enabled }
+
+// encodeTabGroups 序列化 tab_groups；compress 为 true 时以 gzip 包装对象存储
+func encodeTabGroups(tabGroups []models.TabGroup, compress bool) (json.RawMessage, error) {
+	data, err := json.Marshal(tabGroups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tab groups: %w", err)
+	}
+	if !compress {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress tab groups: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress tab groups: %w", err)
+	}
+	return json.Marshal(compressedTabGroups{Encoding: "gzip", Data: buf.Bytes()})
+}
+
+// decodeTabGroups 返回 tab_groups 的 JSON 数组原文；压缩存储的快照在此透明解压
+func decodeTabGroups(raw json.RawMessage) (json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return raw, nil
+	}
+
+	var wrapped compressedTabGroups
+	if err := json.Unmarshal(trimmed, &wrapped); err != nil {
+		return nil, fmt.Errorf("failed to parse compressed tab groups: %w", err)
+	}
+	if wrapped.Encoding != "gzip" {
+		return nil, fmt.Errorf("unsupported tab groups encoding %q", wrapped.Encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(wrapped.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress tab groups: %w", err)
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress tab groups: %w", err)
+	}
+	return data, nil
+}
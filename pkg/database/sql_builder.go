@@ -0,0 +1,50 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// updateBuilder 构造参数化的 UPDATE 语句。
+// 列名只能来自构造时给定的白名单，值一律以 $n 占位符传递，
+// 因此调用方无法把外部输入拼接进 SQL 文本。
+type updateBuilder struct {
+	table   string
+	allowed map[string]bool
+	sets    []string
+	args    []interface{}
+}
+
+// newUpdateBuilder 创建针对 table 的构造器，allowed 为可更新列白名单
+func newUpdateBuilder(table string, allowed ...string) *updateBuilder {
+	m := make(map[string]bool, len(allowed))
+	for _, col := range allowed {
+		m[col] = true
+	}
+	return &updateBuilder{table: table, allowed: m}
+}
+
+// Set 添加 col=$n；列不在白名单内时返回错误
+func (b *updateBuilder) Set(col string, val interface{}) error {
+	if !b.allowed[col] {
+		return fmt.Errorf("column %q is not updatable on %s", col, b.table)
+	}
+	b.args = append(b.args, val)
+	b.sets = append(b.sets, fmt.Sprintf("%s=$%d", col, len(b.args)))
+	return nil
+}
+
+// Empty 是否没有任何待更新列
+func (b *updateBuilder) Empty() bool {
+	return len(b.sets) == 0
+}
+
+// Build 生成 "UPDATE t SET ..., updated_at=NOW() WHERE id=$n RETURNING ..." 及参数
+func (b *updateBuilder) Build(id string, returning ...string) (string, []interface{}) {
+	args := append(append([]interface{}{}, b.args...), id)
+	query := fmt.Sprintf("UPDATE %s SET %s, updated_at=NOW() WHERE id=$%d", b.table, strings.Join(b.sets, ", "), len(args))
+	if len(returning) > 0 {
+		query += " RETURNING " + strings.Join(returning, ", ")
+	}
+	return query, args
+}
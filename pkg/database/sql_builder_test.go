@@ -0,0 +1,115 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdateBuilderCollectionItemColumns(t *testing.T) {
+	for _, col := range collectionItemUpdatableColumns {
+		t.Run(col, func(t *testing.T) {
+			b := newUpdateBuilder("collection_items", collectionItemUpdatableColumns...)
+			if err := b.Set(col, "v"); err != nil {
+				t.Fatalf("Set(%q): %v", col, err)
+			}
+			query, args := b.Build("item-1")
+			want := "UPDATE collection_items SET " + col + "=$1, updated_at=NOW() WHERE id=$2"
+			if query != want {
+				t.Errorf("query = %q, want %q", query, want)
+			}
+			if !reflect.DeepEqual(args, []interface{}{"v", "item-1"}) {
+				t.Errorf("args = %v", args)
+			}
+		})
+	}
+}
+
+func TestUpdateBuilderRejectsUnknownColumn(t *testing.T) {
+	tests := []string{"id", "created_at", "deleted_at", "title; DROP TABLE users", ""}
+	for _, col := range tests {
+		b := newUpdateBuilder("collection_items", collectionItemUpdatableColumns...)
+		if err := b.Set(col, "v"); err == nil {
+			t.Errorf("Set(%q) succeeded, want error", col)
+		}
+		if !b.Empty() {
+			t.Errorf("Set(%q) left a pending column after rejection", col)
+		}
+	}
+}
+
+func TestUpdateBuilderEmpty(t *testing.T) {
+	b := newUpdateBuilder("collection_items", collectionItemUpdatableColumns...)
+	if !b.Empty() {
+		t.Fatal("new builder is not empty")
+	}
+	if err := b.Set("title", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if b.Empty() {
+		t.Fatal("builder is empty after Set")
+	}
+}
+
+func TestUpdateBuilderBuild(t *testing.T) {
+	tests := []struct {
+		name      string
+		sets      [][2]interface{}
+		returning []string
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "placeholders numbered in Set order with id last",
+			sets:      [][2]interface{}{{"title", "t"}, {"url", "u"}, {"position", 3}},
+			wantQuery: "UPDATE collection_items SET title=$1, url=$2, position=$3, updated_at=NOW() WHERE id=$4",
+			wantArgs:  []interface{}{"t", "u", 3, "item-1"},
+		},
+		{
+			name:      "returning clause",
+			sets:      [][2]interface{}{{"domain", "example.com"}},
+			returning: []string{"id", "updated_at"},
+			wantQuery: "UPDATE collection_items SET domain=$1, updated_at=NOW() WHERE id=$2 RETURNING id, updated_at",
+			wantArgs:  []interface{}{"example.com", "item-1"},
+		},
+		{
+			name:      "nil value is passed as an argument",
+			sets:      [][2]interface{}{{"archived_at", nil}},
+			returning: []string{collectionItemColumns},
+			wantQuery: "UPDATE collection_items SET archived_at=$1, updated_at=NOW() WHERE id=$2 RETURNING " + collectionItemColumns,
+			wantArgs:  []interface{}{nil, "item-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newUpdateBuilder("collection_items", collectionItemUpdatableColumns...)
+			for _, s := range tt.sets {
+				if err := b.Set(s[0].(string), s[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			query, args := b.Build("item-1", tt.returning...)
+			if query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+			if n := strings.Count(query, "$"); n != len(args) {
+				t.Errorf("%d placeholders for %d args", n, len(args))
+			}
+		})
+	}
+}
+
+func TestUpdateBuilderBuildDoesNotMutateArgs(t *testing.T) {
+	b := newUpdateBuilder("collection_items", collectionItemUpdatableColumns...)
+	if err := b.Set("title", "t"); err != nil {
+		t.Fatal(err)
+	}
+	b.Build("a")
+	_, args := b.Build("b")
+	if !reflect.DeepEqual(args, []interface{}{"t", "b"}) {
+		t.Errorf("args = %v, want [t b]", args)
+	}
+}
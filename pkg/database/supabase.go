@@ -2,21 +2,45 @@ package database
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/tracing"
 )
 
 // SupabaseDatabase Supabase数据库实现
 type SupabaseDatabase struct {
 	baseURL    string
-	apiKey     string
+	readURL    string // 可选只读端点（SUPABASE_READ_URL：只读副本或 API 负载均衡地址），GET 请求优先使用
+	apiKey     string // service key
 	httpClient *http.Client
+	ctx        context.Context // 请求上下文（见 WithContext），为空时使用 Background
+
+	compressSnapshots bool // 以 gzip 压缩存储 tab_groups（见 snapshot_codec.go）
+}
+
+// WithContext 实现 contextBinder
+func (db *SupabaseDatabase) WithContext(ctx context.Context) DatabaseInterface {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+func (db *SupabaseDatabase) reqCtx() context.Context {
+	if db.ctx != nil {
+		return db.ctx
+	}
+	return context.Background()
 }
 
 // NewSupabaseDatabase 创建Supabase数据库实例
@@ -29,99 +53,247 @@ func NewSupabaseDatabase(url, key string) DatabaseInterface {
 	return &SupabaseDatabase{
 		baseURL: url,
 		apiKey:  key,
+		// 单次请求上限；请求处理期间实际截止时间由请求上下文决定（见 middleware.Timeout）
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 	}
 }
 
+// setReadURL 设置只读端点（格式同 NewSupabaseDatabase 的 url）
+func (db *SupabaseDatabase) setReadURL(url string) {
+	url = strings.TrimRight(strings.TrimSpace(url), "/")
+	if url != "" && !strings.HasPrefix(url, "http") {
+		url = "https://" + url
+	}
+	db.readURL = url
+	if url != "" {
+		fmt.Printf("📖 Supabase read endpoint enabled\n")
+	}
+}
+
+// Supabase 请求重试参数：429 与 5xx 属于瞬时错误，按指数退避重试（POST 只重试 429 与发出前的连接错误，见 isRetryableStatus）
+const (
+	supabaseMaxAttempts   = 3
+	supabaseRetryBaseWait = 200 * time.Millisecond
+	supabaseRetryMaxWait  = 2 * time.Second
+
+	// supabasePageSize 单页拉取行数，需不大于 PostgREST 的 max-rows 配置
+	supabasePageSize = 1000
+)
+
 // makeRequest 发送HTTP请求到Supabase
 func (db *SupabaseDatabase) makeRequest(method, endpoint string, body interface{}) ([]byte, error) {
-	var reqBody io.Reader
+	return db.makeRequestWithHeaders(method, endpoint, body, nil)
+}
 
-	if body != nil {
-		jsonData, err := json.Marshal(body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+// makeRequestWithHeaders 发送HTTP请求到Supabase（支持自定义头）
+func (db *SupabaseDatabase) makeRequestWithHeaders(method, endpoint string, body interface{}, customHeaders map[string]string) ([]byte, error) {
+	respBody, _, err := db.doRequest(method, endpoint, body, customHeaders)
+	return respBody, err
+}
+
+// doRequest 发送请求并返回响应体与响应头。配置了只读端点时 GET 走该端点（本请求要求读己之写时除外，
+// 见 consistency.go），只读端点不可达时回退主库；其他方法记为写入
+func (db *SupabaseDatabase) doRequest(method, endpoint string, body interface{}, customHeaders map[string]string) ([]byte, http.Header, error) {
+	if method != http.MethodGet && method != http.MethodHead {
+		markWrite(db.reqCtx())
+	} else if db.readURL != "" && !primaryReads(db.reqCtx()) {
+		respBody, header, err := db.send(db.readURL, method, endpoint, body, customHeaders)
+		if !errors.Is(err, ErrUnavailable) {
+			return respBody, header, err
 		}
-		reqBody = bytes.NewBuffer(jsonData)
+		fmt.Printf("⚠️  Supabase read endpoint failed, falling back to primary: %v\n", err)
 	}
+	return db.send(db.baseURL, method, endpoint, body, customHeaders)
+}
 
-	url := db.baseURL + "/rest/v1" + endpoint
-	req, err := http.NewRequest(method, url, reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// send 向 base 发送请求；对瞬时失败（429/5xx、网络错误）自动重试
+func (db *SupabaseDatabase) send(base, method, endpoint string, body interface{}, customHeaders map[string]string) ([]byte, http.Header, error) {
+	var jsonData []byte
+	if body != nil {
+		var err error
+		jsonData, err = json.Marshal(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
 	}
 
-	// 设置请求头
-	req.Header.Set("apikey", db.apiKey)
-	req.Header.Set("Authorization", "Bearer "+db.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation")
+	url := base + "/rest/v1" + endpoint
 
-	resp, err := db.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	// 一次逻辑请求（含重试）对应一个子 Span
+	ctx, span := tracing.StartSpan(db.reqCtx(), "supabase "+method+" "+restTable(endpoint), tracing.KindClient)
+	defer span.End()
+	span.SetAttribute("db.system", "postgrest")
+	span.SetAttribute("http.method", method)
+	if base != db.baseURL {
+		span.SetAttribute("db.replica", true)
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
+	var lastErr error
+	for attempt := 1; attempt <= supabaseMaxAttempts; attempt++ {
+		span.SetAttribute("supabase.attempts", attempt)
+		var reqBody io.Reader
+		if jsonData != nil {
+			reqBody = bytes.NewReader(jsonData)
+		}
+		// 记录请求头是否已写出：之后的连接错误意味着服务端可能已收到并执行了请求
+		var sent atomic.Bool
+		traceCtx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{WroteHeaders: func() { sent.Store(true) }})
+		req, err := http.NewRequestWithContext(traceCtx, method, url, reqBody)
+		if err != nil {
+			span.RecordError(err)
+			return nil, nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		tracing.Inject(ctx, req.Header)
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
-	}
+		// 设置默认请求头
+		req.Header.Set("apikey", db.apiKey)
+		req.Header.Set("Authorization", "Bearer "+db.apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Prefer", "return=representation")
 
-	return respBody, nil
-}
+		// 设置自定义请求头
+		for key, value := range customHeaders {
+			req.Header.Set(key, value)
+		}
 
-// makeRequestWithHeaders 发送HTTP请求到Supabase（支持自定义头）
-func (db *SupabaseDatabase) makeRequestWithHeaders(method, endpoint string, body interface{}, customHeaders map[string]string) ([]byte, error) {
-	var reqBody io.Reader
+		resp, err := db.httpClient.Do(req)
+		if err != nil {
+			lastErr = unavailable(fmt.Errorf("failed to send request: %w", err))
+			// 请求发出后失败的非幂等请求可能已被服务端执行，不做重试；连接建立前（DNS、拨号、TLS）失败的任何请求都可重试
+			if (sent.Load() && !isIdempotentMethod(method)) || attempt == supabaseMaxAttempts {
+				span.RecordError(lastErr)
+				return nil, nil, lastErr
+			}
+			if !db.waitBeforeRetry(ctx, method, endpoint, attempt, "", lastErr) {
+				span.RecordError(lastErr)
+				return nil, nil, lastErr
+			}
+			continue
+		}
 
-	if body != nil {
-		jsonData, err := json.Marshal(body)
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+			span.RecordError(err)
+			return nil, nil, fmt.Errorf("failed to read response body: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonData)
-	}
 
-	url := db.baseURL + "/rest/v1" + endpoint
-	req, err := http.NewRequest(method, url, reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		span.SetAttribute("http.status_code", resp.StatusCode)
+		if resp.StatusCode < 400 {
+			return respBody, resp.Header, nil
+		}
+
+		lastErr = fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+		if resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout {
+			lastErr = unavailable(lastErr)
+		}
+		if !isRetryableStatus(method, resp.StatusCode) || attempt == supabaseMaxAttempts {
+			span.RecordError(lastErr)
+			return nil, nil, lastErr
+		}
+		if !db.waitBeforeRetry(ctx, method, endpoint, attempt, resp.Header.Get("Retry-After"), lastErr) {
+			span.RecordError(lastErr)
+			return nil, nil, lastErr
+		}
 	}
+	return nil, nil, lastErr
+}
 
-	// 设置默认请求头
-	req.Header.Set("apikey", db.apiKey)
-	req.Header.Set("Authorization", "Bearer "+db.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation")
+// waitBeforeRetry 按 Retry-After 或指数退避等待；请求截止时间内已来不及重试时返回 false，
+// 让调用方尽快返回错误（出站请求本身已通过 ctx 受请求时限约束）
+func (db *SupabaseDatabase) waitBeforeRetry(ctx context.Context, method, endpoint string, attempt int, retryAfter string, cause error) bool {
+	wait := supabaseRetryBaseWait << (attempt - 1)
+	if secs, err := strconv.Atoi(strings.TrimSpace(retryAfter)); err == nil && secs >= 0 {
+		wait = time.Duration(secs) * time.Second
+	}
+	if wait > supabaseRetryMaxWait {
+		wait = supabaseRetryMaxWait
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+		fmt.Printf("[warn] supabase %s %s attempt %d failed, no time budget left to retry: %v\n", method, endpoint, attempt, cause)
+		return false
+	}
+	fmt.Printf("[warn] supabase %s %s attempt %d failed, retrying in %s: %v\n", method, endpoint, attempt, wait, cause)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
 
-	// 设置自定义请求头
-	for key, value := range customHeaders {
-		req.Header.Set(key, value)
+// restTable 取 endpoint 中的表名，用于 Span 命名（不含过滤值）
+func restTable(endpoint string) string {
+	table := strings.TrimPrefix(endpoint, "/")
+	if i := strings.IndexAny(table, "?/"); i >= 0 {
+		table = table[:i]
 	}
+	return table
+}
 
-	resp, err := db.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+// isRetryableStatus 429 表示请求未被处理，任何方法都可重试；5xx（含 503）时请求可能已部分执行，仅对幂等方法重试
+func isRetryableStatus(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
 	}
-	defer resp.Body.Close()
+	return status >= 500 && isIdempotentMethod(method)
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+// isIdempotentMethod 按 HTTP 语义判断；PATCH 不保证幂等（可能触发按当前值计算的触发器），不随 5xx 或发出后的连接错误重试
+func isIdempotentMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "PUT", "DELETE":
+		return true
 	}
+	return false
+}
+
+// paginate 通过 Range/Content-Range 分页拉取全部结果，避免被 PostgREST 的 max-rows 静默截断。
+// 返回合并后的 JSON 数组，调用方按原方式反序列化。
+func (db *SupabaseDatabase) paginate(endpoint string) ([]byte, error) {
+	var all []json.RawMessage
+	for offset := 0; ; offset += supabasePageSize {
+		headers := map[string]string{
+			"Range-Unit": "items",
+			"Range":      fmt.Sprintf("%d-%d", offset, offset+supabasePageSize-1),
+			"Prefer":     "count=exact",
+		}
+		respBody, respHeader, err := db.doRequest("GET", endpoint, nil, headers)
+		if err != nil {
+			return nil, err
+		}
+		var page []json.RawMessage
+		if err := json.Unmarshal(respBody, &page); err != nil {
+			return nil, fmt.Errorf("failed to parse page: %w", err)
+		}
+		all = append(all, page...)
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+		total, ok := parseContentRangeTotal(respHeader.Get("Content-Range"))
+		if len(page) == 0 || (ok && len(all) >= total) || (!ok && len(page) < supabasePageSize) {
+			break
+		}
+	}
+	if all == nil {
+		all = []json.RawMessage{}
 	}
+	return json.Marshal(all)
+}
 
-	return respBody, nil
+// parseContentRangeTotal 解析 "0-999/5000" 或 "*/0" 中的总数；总数未知（"*"）时返回 false
+func parseContentRangeTotal(contentRange string) (int, bool) {
+	idx := strings.LastIndex(contentRange, "/")
+	if idx < 0 {
+		return 0, false
+	}
+	total, err := strconv.Atoi(contentRange[idx+1:])
+	if err != nil {
+		return 0, false
+	}
+	return total, true
 }
 
 // ================= Organizations & Spaces & Invitations =================
@@ -135,12 +307,13 @@ func (db *SupabaseDatabase) CreateOrganization(org *models.Organization) error {
         "avatar":      org.Avatar,
         "color":       org.Color,
     }
+    // org.ID 非空时沿用；Region 为空表示主库所在区域
+    if org.ID != "" { payload["id"] = org.ID }
+    if org.Region != "" { payload["region"] = org.Region }
     data, err := db.makeRequest("POST", "/organizations", payload)
     if err != nil { return err }
-    var rows []map[string]interface{}
-    if err := json.Unmarshal(data, &rows); err == nil && len(rows) > 0 {
-        if id, ok := rows[0]["id"].(string); ok { org.ID = id }
-    }
+    // 与 Postgres 一致：回填 ID 与时间戳（整行解码，color 等以库中存储的值为准）
+    if err := decodeFirstRow(data, org, "organization"); err != nil { return err }
     // owner membership
     _, err = db.makeRequest("POST", "/organization_memberships", map[string]interface{}{
         "organization_id": org.ID,
@@ -152,12 +325,12 @@ func (db *SupabaseDatabase) CreateOrganization(org *models.Organization) error {
 
 func (db *SupabaseDatabase) ListUserOrganizations(userID string) ([]models.Organization, error) {
     // filter by owner or membership; do two queries and merge
-    ownedData, err := db.makeRequest("GET", "/organizations?owner_id=eq."+userID+"&select=*", nil)
+    ownedData, err := db.makeRequest("GET", from("organizations").Eq("owner_id", userID).Select("*").String(), nil)
     if err != nil { return nil, err }
     var owned []models.Organization
     _ = json.Unmarshal(ownedData, &owned)
 
-    memData, err := db.makeRequest("GET", "/organization_memberships?user_id=eq."+userID+"&select=organization_id", nil)
+    memData, err := db.makeRequest("GET", from("organization_memberships").Eq("user_id", userID).Select("organization_id").String(), nil)
     if err != nil { return owned, nil }
     var mems []map[string]string
     _ = json.Unmarshal(memData, &mems)
@@ -167,7 +340,7 @@ func (db *SupabaseDatabase) ListUserOrganizations(userID string) ([]models.Organ
     // fetch orgs by ids
     var result []models.Organization
     for id := range orgIDs {
-        data, err := db.makeRequest("GET", "/organizations?id=eq."+id+"&select=*", nil)
+        data, err := db.makeRequest("GET", from("organizations").Eq("id", id).Select("*").String(), nil)
         if err == nil {
             var tmp []models.Organization
             if json.Unmarshal(data, &tmp) == nil && len(tmp) > 0 {
@@ -179,10 +352,10 @@ func (db *SupabaseDatabase) ListUserOrganizations(userID string) ([]models.Organ
 }
 
 func (db *SupabaseDatabase) GetOrganization(orgID string) (*models.Organization, error) {
-    data, err := db.makeRequest("GET", "/organizations?id=eq."+orgID+"&select=*", nil)
+    data, err := db.makeRequest("GET", from("organizations").Eq("id", orgID).Select("*").String(), nil)
     if err != nil { return nil, err }
     var rows []models.Organization
-    if err := json.Unmarshal(data, &rows); err != nil || len(rows) == 0 { return nil, fmt.Errorf("organization not found") }
+    if err := json.Unmarshal(data, &rows); err != nil || len(rows) == 0 { return nil, notFound("organization") }
     return &rows[0], nil
 }
 
@@ -193,8 +366,10 @@ func (db *SupabaseDatabase) UpdateOrganization(org *models.Organization) error {
     if strings.TrimSpace(org.Avatar) != "" { payload["avatar"] = org.Avatar }
     if strings.TrimSpace(org.Color) != "" { payload["color"] = org.Color }
     if len(payload) == 0 { return nil }
-    _, err := db.makeRequest("PATCH", "/organizations?id=eq."+org.ID, payload)
-    return err
+    payload["updated_at"] = time.Now().Format(time.RFC3339)
+    data, err := db.makeRequest("PATCH", from("organizations").Eq("id", org.ID).String(), payload)
+    if err != nil { return err }
+    return decodeFirstRow(data, org, "organization")
 }
 
 func (db *SupabaseDatabase) AddOrganizationMember(m *models.OrganizationMembership) error {
@@ -207,33 +382,96 @@ func (db *SupabaseDatabase) AddOrganizationMember(m *models.OrganizationMembersh
     return err
 }
 
+func (db *SupabaseDatabase) RemoveOrganizationMember(orgID, userID string) error {
+    endpoint := from("organization_memberships").Eq("organization_id", orgID).Eq("user_id", userID).String()
+    data, err := db.makeRequestWithHeaders("DELETE", endpoint, nil, map[string]string{"Prefer": "return=representation"})
+    if err != nil { return fmt.Errorf("failed to remove member: %w", err) }
+    var rows []struct{ ID string `json:"id"` }
+    if err := json.Unmarshal(data, &rows); err != nil { return err }
+    if len(rows) == 0 { return notFound("member") }
+    return nil
+}
+
 func (db *SupabaseDatabase) ListOrganizationMembers(orgID string) ([]models.OrganizationMembership, error) {
-    data, err := db.makeRequest("GET", "/organization_memberships?organization_id=eq."+orgID+"&select=*", nil)
+    data, err := db.makeRequest("GET", from("organization_memberships").Eq("organization_id", orgID).Select("*").String(), nil)
     if err != nil { return nil, err }
     var rows []models.OrganizationMembership
     if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
     return rows, nil
 }
 
+// ListOrganizationMemberProfiles 通过 users 嵌入取成员资料，Range + count=exact 分页
+func (db *SupabaseDatabase) ListOrganizationMemberProfiles(orgID string, limit, offset int) ([]models.OrganizationMember, int, error) {
+    if limit <= 0 {
+        // 不分页：按 supabasePageSize 逐页拉取，避免被 max-rows 截断
+        all := []models.OrganizationMember{}
+        for off := offset; ; off += supabasePageSize {
+            page, total, err := db.ListOrganizationMemberProfiles(orgID, supabasePageSize, off)
+            if err != nil { return nil, 0, err }
+            all = append(all, page...)
+            if len(page) < supabasePageSize || off+len(page) >= total { return all, total, nil }
+        }
+    }
+    endpoint := from("organization_memberships").Eq("organization_id", orgID).
+        Select("id,organization_id,user_id,role,created_at,users(email,name,avatar)").Order("created_at.asc,id.asc").String()
+    data, header, err := db.doRequest("GET", endpoint, nil, map[string]string{
+        "Range-Unit": "items",
+        "Range":      fmt.Sprintf("%d-%d", offset, offset+limit-1),
+        "Prefer":     "count=exact",
+    })
+    if err != nil { return nil, 0, fmt.Errorf("failed to list members: %w", err) }
+    var rows []struct {
+        models.OrganizationMembership
+        Users *struct {
+            Email  string  `json:"email"`
+            Name   *string `json:"name"`
+            Avatar *string `json:"avatar"`
+        } `json:"users"`
+    }
+    if err := json.Unmarshal(data, &rows); err != nil { return nil, 0, fmt.Errorf("failed to parse members: %w", err) }
+    result := make([]models.OrganizationMember, 0, len(rows))
+    for _, row := range rows {
+        m := models.OrganizationMember{OrganizationMembership: row.OrganizationMembership}
+        if row.Users != nil {
+            m.Email = row.Users.Email
+            if row.Users.Name != nil { m.Name = *row.Users.Name }
+            if row.Users.Avatar != nil { m.Avatar = *row.Users.Avatar }
+        }
+        result = append(result, m)
+    }
+    total, ok := parseContentRangeTotal(header.Get("Content-Range"))
+    if !ok { total = offset + len(result) }
+    return result, total, nil
+}
+
 // Spaces
 func (db *SupabaseDatabase) CreateSpace(space *models.Space) error {
     payload := map[string]interface{}{
         "organization_id": space.OrganizationID,
         "name":            space.Name,
         "description":     space.Description,
+        "color":           space.Color,
+        "icon":            space.Icon,
         "is_default":      space.IsDefault,
     }
+    if space.DefaultAccess != "" { payload["default_access"] = space.DefaultAccess }
+    if space.Visibility != "" { payload["visibility"] = space.Visibility }
+    if space.IsDefault {
+        if err := db.clearDefaultSpace(space.OrganizationID, ""); err != nil { return err }
+    }
     data, err := db.makeRequest("POST", "/spaces", payload)
     if err != nil { return err }
     var rows []map[string]interface{}
     if err := json.Unmarshal(data, &rows); err == nil && len(rows) > 0 {
         if id, ok := rows[0]["id"].(string); ok { space.ID = id }
+        if a, ok := rows[0]["default_access"].(string); ok { space.DefaultAccess = a }
+        if v, ok := rows[0]["visibility"].(string); ok { space.Visibility = v }
     }
     return nil
 }
 
 func (db *SupabaseDatabase) ListSpacesByOrganization(orgID string) ([]models.Space, error) {
-    data, err := db.makeRequest("GET", "/spaces?organization_id=eq."+orgID+"&deleted_at=is.null&select=*", nil)
+    data, err := db.makeRequest("GET", from("spaces").Eq("organization_id", orgID).Is("deleted_at", "null").Select("*").String(), nil)
     if err != nil { return nil, err }
     var rows []models.Space
     if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
@@ -241,46 +479,99 @@ func (db *SupabaseDatabase) ListSpacesByOrganization(orgID string) ([]models.Spa
 }
 
 func (db *SupabaseDatabase) UpdateSpace(space *models.Space) error {
-    _, err := db.makeRequest("PATCH", "/spaces?id=eq."+space.ID, map[string]interface{}{
+    patch := map[string]interface{}{
         "name":        space.Name,
         "description": space.Description,
+        "color":       space.Color,
+        "icon":        space.Icon,
         "is_default":  space.IsDefault,
+        "updated_at":  time.Now().Format(time.RFC3339),
+    }
+    if space.DefaultAccess != "" { patch["default_access"] = space.DefaultAccess }
+    if space.Visibility != "" { patch["visibility"] = space.Visibility }
+    if space.IsDefault {
+        orgID := space.OrganizationID
+        if orgID == "" {
+            data, err := db.makeRequest("GET", from("spaces").Eq("id", space.ID).Select("organization_id").String(), nil)
+            if err != nil { return err }
+            var rows []models.Space
+            if err := json.Unmarshal(data, &rows); err != nil { return err }
+            if len(rows) == 0 { return notFound("space") }
+            orgID = rows[0].OrganizationID
+        }
+        if err := db.clearDefaultSpace(orgID, space.ID); err != nil { return err }
+    }
+    data, err := db.makeRequest("PATCH", from("spaces").Eq("id", space.ID).String(), patch)
+    if err != nil { return err }
+    return decodeFirstRow(data, space, "space")
+}
+
+// clearDefaultSpace 取消组织内其他空间的默认标记。PostgREST 无法跨请求开启事务：
+// 并发设置默认空间时由 idx_spaces_single_default 拒绝后写入的一方，不会出现两个默认空间
+func (db *SupabaseDatabase) clearDefaultSpace(orgID, keepID string) error {
+    q := from("spaces").Eq("organization_id", orgID).Is("is_default", "true")
+    if keepID != "" { q = q.Neq("id", keepID) }
+    _, err := db.makeRequest("PATCH", q.String(), map[string]interface{}{
+        "is_default": false,
+        "updated_at": time.Now().Format(time.RFC3339),
     })
     return err
 }
 
-func (db *SupabaseDatabase) GetSpaceByID(spaceID string) (*models.Space, error) {
-    data, err := db.makeRequest("GET", "/spaces?id=eq."+spaceID+"&select=*", nil)
+func (db *SupabaseDatabase) GetSpaceByID(userID, spaceID string) (*models.Space, error) {
+    data, err := db.makeRequest("GET", from("spaces").Eq("id", spaceID).Select("*").String(), nil)
     if err != nil { return nil, err }
     var rows []models.Space
     if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
-    if len(rows) == 0 { return nil, fmt.Errorf("space not found") }
+    if len(rows) == 0 { return nil, notFound("space") }
+    member, err := db.isOrgMember(rows[0].OrganizationID, userID)
+    if err != nil { return nil, err }
+    if !member {
+        // 空间访客：不是组织成员，但接受过该空间的访客邀请（单有显式权限不算）
+        data, err := db.makeRequest("GET", from("space_guests").Eq("space_id", spaceID).Eq("user_id", userID).Select("space_id").String(), nil)
+        if err != nil { return nil, err }
+        var guest struct{ SpaceID string `json:"space_id"` }
+        if err := decodeFirstRow(data, &guest, "space"); err != nil { return nil, err }
+    }
     return &rows[0], nil
 }
 
+// isOrgMember 判断 userID 是否为组织 owner 或成员（租户范围校验）
+func (db *SupabaseDatabase) isOrgMember(orgID, userID string) (bool, error) {
+    if orgID == "" || userID == "" { return false, nil }
+    data, err := db.makeRequest("GET", from("organizations").Eq("id", orgID).Eq("owner_id", userID).Select("id").String(), nil)
+    if err != nil { return false, err }
+    var owners []struct{ ID string `json:"id"` }
+    if err := json.Unmarshal(data, &owners); err != nil { return false, err }
+    if len(owners) > 0 { return true, nil }
+    data, err = db.makeRequest("GET", from("organization_memberships").Eq("organization_id", orgID).Eq("user_id", userID).Select("id").String(), nil)
+    if err != nil { return false, err }
+    var members []struct{ ID string `json:"id"` }
+    if err := json.Unmarshal(data, &members); err != nil { return false, err }
+    return len(members) > 0, nil
+}
+
 func (db *SupabaseDatabase) DeleteSpace(spaceID string) error {
     // soft delete via setting deleted_at
-    _, err := db.makeRequest("PATCH", "/spaces?id=eq."+spaceID, map[string]interface{}{
+    _, err := db.makeRequest("PATCH", from("spaces").Eq("id", spaceID).String(), map[string]interface{}{
         "deleted_at": time.Now().Format(time.RFC3339),
     })
     return err
 }
 
 func (db *SupabaseDatabase) SetSpacePermission(spaceID, userID string, canEdit bool) error {
-    // upsert-like: first try patch, if none affected then insert
-    _, err := db.makeRequestWithHeaders("PATCH", "/space_permissions?space_id=eq."+spaceID+"&user_id=eq."+userID, map[string]interface{}{"can_edit": canEdit}, map[string]string{"Prefer": "return=representation"})
-    if err != nil {
-        _, err = db.makeRequest("POST", "/space_permissions", map[string]interface{}{
-            "space_id": spaceID,
-            "user_id":  userID,
-            "can_edit": canEdit,
-        })
-    }
+    // 以 (space_id, user_id) 唯一约束 upsert；PATCH 未命中时不会报错，不能据此判断是否需要插入
+    _, err := db.makeRequestWithHeaders("POST", "/space_permissions?on_conflict=space_id,user_id", map[string]interface{}{
+        "space_id":   spaceID,
+        "user_id":    userID,
+        "can_edit":   canEdit,
+        "updated_at": time.Now().UTC().Format(time.RFC3339),
+    }, map[string]string{"Prefer": "resolution=merge-duplicates,return=minimal"})
     return err
 }
 
 func (db *SupabaseDatabase) GetSpacePermissions(spaceID string) ([]models.SpacePermission, error) {
-    data, err := db.makeRequest("GET", "/space_permissions?space_id=eq."+spaceID+"&select=*", nil)
+    data, err := db.makeRequest("GET", from("space_permissions").Eq("space_id", spaceID).Select("*").String(), nil)
     if err != nil { return nil, err }
     var rows []models.SpacePermission
     if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
@@ -288,12 +579,18 @@ func (db *SupabaseDatabase) GetSpacePermissions(spaceID string) ([]models.SpaceP
 }
 
 // Invitations
+
+// invitationSelect token 列只存摘要（见 hashToken），不读出
+const invitationSelect = "id,organization_id,email,invitee_id,inviter_id,status,expires_at,accepted_by,created_at,updated_at"
+
 func (db *SupabaseDatabase) CreateInvitation(inv *models.OrganizationInvitation) error {
+    inv.Email = models.NormalizeEmail(inv.Email)
     payload := map[string]interface{}{
         "organization_id": inv.OrganizationID,
         "email":           inv.Email,
+        "invitee_id":      inv.InviteeID,
         "inviter_id":      inv.InviterID,
-        "token":           inv.Token,
+        "token":           hashToken(inv.Token),
         "status":          string(inv.Status),
         "expires_at":      inv.ExpiresAt.Format(time.RFC3339),
     }
@@ -307,15 +604,28 @@ func (db *SupabaseDatabase) CreateInvitation(inv *models.OrganizationInvitation)
 }
 
 func (db *SupabaseDatabase) GetInvitationByToken(token string) (*models.OrganizationInvitation, error) {
-    data, err := db.makeRequest("GET", "/organization_invitations?token=eq."+token+"&select=*", nil)
+    data, err := db.makeRequest("GET", from("organization_invitations").Eq("token", hashToken(token)).Select(invitationSelect).String(), nil)
     if err != nil { return nil, err }
     var rows []models.OrganizationInvitation
-    if err := json.Unmarshal(data, &rows); err != nil || len(rows) == 0 { return nil, fmt.Errorf("invitation not found") }
+    if err := json.Unmarshal(data, &rows); err != nil || len(rows) == 0 { return nil, notFound("invitation") }
     return &rows[0], nil
 }
 
-func (db *SupabaseDatabase) ListInvitationsByEmail(email string) ([]models.OrganizationInvitation, error) {
-    data, err := db.makeRequest("GET", "/organization_invitations?email=eq."+email+"&select=*", nil)
+func (db *SupabaseDatabase) GetInvitationByID(id string) (*models.OrganizationInvitation, error) {
+    data, err := db.makeRequest("GET", from("organization_invitations").Eq("id", id).Select(invitationSelect).String(), nil)
+    if err != nil { return nil, err }
+    var inv models.OrganizationInvitation
+    if err := decodeFirstRow(data, &inv, "invitation"); err != nil { return nil, err }
+    return &inv, nil
+}
+
+// ListInvitationsForUser 邮箱以转义通配符后的 ilike 做不区分大小写的精确匹配
+func (db *SupabaseDatabase) ListInvitationsForUser(userID string, emails []string) ([]models.OrganizationInvitation, error) {
+    conditions := []string{"invitee_id.eq." + quoteFilterValue(userID)}
+    for _, e := range emails {
+        conditions = append(conditions, "email.ilike."+quoteFilterValue(likeLiteral(e)))
+    }
+    data, err := db.makeRequest("GET", from("organization_invitations").Or(conditions...).Select(invitationSelect).Order("created_at.desc").String(), nil)
     if err != nil { return nil, err }
     var rows []models.OrganizationInvitation
     if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
@@ -323,7 +633,7 @@ func (db *SupabaseDatabase) ListInvitationsByEmail(email string) ([]models.Organ
 }
 
 func (db *SupabaseDatabase) UpdateInvitation(inv *models.OrganizationInvitation) error {
-    _, err := db.makeRequest("PATCH", "/organization_invitations?id=eq."+inv.ID, map[string]interface{}{
+    _, err := db.makeRequest("PATCH", from("organization_invitations").Eq("id", inv.ID).String(), map[string]interface{}{
         "status":     string(inv.Status),
         "accepted_by": inv.AcceptedBy,
         "expires_at":  inv.ExpiresAt.Format(time.RFC3339),
@@ -342,6 +652,8 @@ func (db *SupabaseDatabase) CreateCollection(c *models.Collection) error {
         "icon":       c.Icon,
         "position":   c.Position,
     }
+    if c.Type != "" { payload["type"] = c.Type }
+    if c.Query != nil { payload["query"] = c.Query }
     data, err := db.makeRequest("POST", "/collections", payload)
     if err != nil { return err }
     var rows []map[string]interface{}
@@ -352,41 +664,50 @@ func (db *SupabaseDatabase) CreateCollection(c *models.Collection) error {
 }
 
 func (db *SupabaseDatabase) UpdateCollection(c *models.Collection) error {
-    _, err := db.makeRequest("PATCH", "/collections?id=eq."+c.ID, map[string]interface{}{
+    body := map[string]interface{}{
         "name":        c.Name,
         "description": c.Description,
         "color":       c.Color,
         "icon":        c.Icon,
         "position":    c.Position,
-    })
-    return err
+        "updated_at":  time.Now().Format(time.RFC3339),
+    }
+    // type 创建后不可改；只有智能集合写入查询定义
+    if c.IsSmart() && c.Query != nil { body["query"] = c.Query }
+    data, err := db.makeRequest("PATCH", from("collections").Eq("id", c.ID).String(), body)
+    if err != nil { return err }
+    return decodeFirstRow(data, c, "collection")
 }
 
 func (db *SupabaseDatabase) DeleteCollection(id string) error {
     // Soft delete the collection
-    if _, err := db.makeRequest("PATCH", "/collections?id=eq."+id, map[string]interface{}{
+    if _, err := db.makeRequest("PATCH", from("collections").Eq("id", id).String(), map[string]interface{}{
         "deleted_at": time.Now().Format(time.RFC3339),
     }); err != nil { return err }
     // Cascade soft delete to items
-    if _, err := db.makeRequest("PATCH", "/collection_items?collection_id=eq."+id, map[string]interface{}{
+    if _, err := db.makeRequest("PATCH", from("collection_items").Eq("collection_id", id).String(), map[string]interface{}{
         "deleted_at": time.Now().Format(time.RFC3339),
     }); err != nil { return err }
     return nil
 }
 
 func (db *SupabaseDatabase) ListCollectionsBySpace(spaceID string) ([]models.Collection, error) {
-    data, err := db.makeRequest("GET", "/collections?space_id=eq."+spaceID+"&select=*", nil)
+    data, err := db.paginate(from("collections").Eq("space_id", spaceID).Select("*").String())
     if err != nil { return nil, err }
     var rows []models.Collection
     if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
     return rows, nil
 }
 
-func (db *SupabaseDatabase) GetCollection(id string) (*models.Collection, error) {
-    data, err := db.makeRequest("GET", "/collections?id=eq."+id+"&select=*", nil)
+func (db *SupabaseDatabase) GetCollection(userID, id string) (*models.Collection, error) {
+    data, err := db.makeRequest("GET", from("collections").Eq("id", id).Select("*").String(), nil)
     if err != nil { return nil, err }
     var rows []models.Collection
-    if err := json.Unmarshal(data, &rows); err != nil || len(rows) == 0 { return nil, fmt.Errorf("collection not found") }
+    if err := json.Unmarshal(data, &rows); err != nil || len(rows) == 0 { return nil, notFound("collection") }
+    if _, err := db.GetSpaceByID(userID, rows[0].SpaceID); err != nil {
+        if errors.Is(err, ErrNotFound) { return nil, notFound("collection") }
+        return nil, err
+    }
     return &rows[0], nil
 }
 
@@ -414,7 +735,7 @@ func (db *SupabaseDatabase) CreateCollectionItem(it *models.CollectionItem) erro
 }
 
 func (db *SupabaseDatabase) UpdateCollectionItem(it *models.CollectionItem) error {
-    _, err := db.makeRequest("PATCH", "/collection_items?id=eq."+it.ID, map[string]interface{}{
+    data, err := db.makeRequest("PATCH", from("collection_items").Eq("id", it.ID).String(), map[string]interface{}{
         "title":             it.Title,
         "url":               it.URL,
         "fav_icon_url":      it.FavIconURL,
@@ -423,13 +744,15 @@ func (db *SupabaseDatabase) UpdateCollectionItem(it *models.CollectionItem) erro
         "domain":            it.Domain,
         "metadata":          string(it.Metadata),
         "position":          it.Position,
+        "updated_at":        time.Now().Format(time.RFC3339),
     })
-    return err
+    if err != nil { return err }
+    return decodeFirstRow(data, it, "item")
 }
 
 // UpdateCollectionItemPartial performs a partial update via REST PATCH.
-func (db *SupabaseDatabase) UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) error {
-    if strings.TrimSpace(itemID) == "" { return fmt.Errorf("item id required") }
+func (db *SupabaseDatabase) UpdateCollectionItemPartial(itemID string, patch map[string]interface{}) (*models.CollectionItem, error) {
+    if strings.TrimSpace(itemID) == "" { return nil, fmt.Errorf("item id required") }
     body := map[string]interface{}{}
     for k, v := range patch {
         switch k {
@@ -443,20 +766,81 @@ func (db *SupabaseDatabase) UpdateCollectionItemPartial(itemID string, patch map
                 // allow map/object
                 body[k] = v
             }
+        case "archived_at", "snoozed_until":
+            // *time.Time；nil 取消归档 / 取消延后
+            if t, ok := v.(*time.Time); ok && t != nil {
+                body[k] = t.UTC().Format(time.RFC3339)
+            } else {
+                body[k] = nil
+            }
         }
     }
-    if len(body) == 0 { return nil }
-    _, err := db.makeRequest("PATCH", "/collection_items?id=eq."+itemID, body)
-    return err
+    var data []byte
+    var err error
+    if len(body) == 0 {
+        data, err = db.makeRequest("GET", from("collection_items").Eq("id", itemID).Select("*").String(), nil)
+    } else {
+        body["updated_at"] = time.Now().Format(time.RFC3339)
+        data, err = db.makeRequest("PATCH", from("collection_items").Eq("id", itemID).String(), body)
+    }
+    if err != nil { return nil, err }
+    var rows []models.CollectionItem
+    if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
+    if len(rows) == 0 { return nil, notFound("item") }
+    return &rows[0], nil
 }
 
-func (db *SupabaseDatabase) DeleteCollectionItem(id string) error {
-    _, err := db.makeRequest("PATCH", "/collection_items?id=eq."+id, map[string]interface{}{"deleted_at": time.Now().Format(time.RFC3339)})
-    return err
+// GetCollectionItem loads a single item by id (including soft-deleted rows).
+func (db *SupabaseDatabase) GetCollectionItem(itemID string) (*models.CollectionItem, error) {
+    data, err := db.makeRequest("GET", from("collection_items").Eq("id", itemID).Select("*").String(), nil)
+    if err != nil { return nil, err }
+    var rows []models.CollectionItem
+    if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
+    if len(rows) == 0 { return nil, notFound("item") }
+    return &rows[0], nil
+}
+
+func (db *SupabaseDatabase) DeleteCollectionItem(collectionID, id string) error {
+    data, err := db.makeRequest("PATCH", from("collection_items").Eq("id", id).Eq("collection_id", collectionID).String(), map[string]interface{}{"deleted_at": time.Now().Format(time.RFC3339)})
+    if err != nil { return err }
+    var rows []struct{ ID string `json:"id"` }
+    if err := json.Unmarshal(data, &rows); err != nil { return err }
+    if len(rows) == 0 { return notFound("item") }
+    return nil
+}
+
+func (db *SupabaseDatabase) ListItemsByCollection(collectionID, state string) ([]models.CollectionItem, error) {
+    q := from("collection_items").Eq("collection_id", collectionID).Is("deleted_at", "null")
+    switch state {
+    case models.ItemStateActive:
+        q = q.Is("archived_at", "null")
+    case models.ItemStateArchived:
+        q = q.IsNot("archived_at", "null")
+    }
+    data, err := db.paginate(q.Select("*").String())
+    if err != nil { return nil, err }
+    var rows []models.CollectionItem
+    if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
+    return rows, nil
 }
 
-func (db *SupabaseDatabase) ListItemsByCollection(collectionID string) ([]models.CollectionItem, error) {
-    data, err := db.makeRequest("GET", "/collection_items?collection_id=eq."+collectionID+"&deleted_at=is.null&select=*", nil)
+// ListItemsBySpace 列出空间内未删除集合中的条目（供智能集合求值），state 与 ListItemsByCollection 相同
+func (db *SupabaseDatabase) ListItemsBySpace(spaceID, state string) ([]models.CollectionItem, error) {
+    collections, err := db.ListCollectionsBySpace(spaceID)
+    if err != nil { return nil, err }
+    var ids []string
+    for _, c := range collections {
+        if c.DeletedAt == nil && !c.IsSmart() { ids = append(ids, c.ID) }
+    }
+    if len(ids) == 0 { return nil, nil }
+    q := from("collection_items").In("collection_id", ids).Is("deleted_at", "null")
+    switch state {
+    case models.ItemStateActive:
+        q = q.Is("archived_at", "null")
+    case models.ItemStateArchived:
+        q = q.IsNot("archived_at", "null")
+    }
+    data, err := db.paginate(q.Order("created_at.desc").Select("*").String())
     if err != nil { return nil, err }
     var rows []models.CollectionItem
     if err := json.Unmarshal(data, &rows); err != nil { return nil, err }
@@ -470,14 +854,14 @@ func (db *SupabaseDatabase) FindItemByCollectionAndNormalizedURL(collectionID, n
         return nil, fmt.Errorf("invalid args")
     }
     // Attempt direct query; ignore errors and fallback
-    if data, err := db.makeRequest("GET", "/collection_items?collection_id=eq."+collectionID+"&deleted_at=is.null&select=*&metadata->>normalized_url=eq."+normalizedURL, nil); err == nil {
+    if data, err := db.makeRequest("GET", from("collection_items").Eq("collection_id", collectionID).Is("deleted_at", "null").Eq("metadata->>normalized_url", normalizedURL).Select("*").String(), nil); err == nil {
         var rows []models.CollectionItem
         if e2 := json.Unmarshal(data, &rows); e2 == nil && len(rows) > 0 {
             return &rows[0], nil
         }
     }
     // Fallback scan of collection
-    items, err := db.ListItemsByCollection(collectionID)
+    items, err := db.ListItemsByCollection(collectionID, models.ItemStateAll)
     if err != nil { return nil, err }
     for _, it := range items {
         // try metadata first
@@ -486,10 +870,11 @@ func (db *SupabaseDatabase) FindItemByCollectionAndNormalizedURL(collectionID, n
         if v, ok := meta["normalized_url"].(string); ok && v == normalizedURL { return &it, nil }
         if it.URL == normalizedURL { return &it, nil }
     }
-    return nil, fmt.Errorf("not found")
+    return nil, notFound("item")
 }
 // CreateUser 创建用户
 func (db *SupabaseDatabase) CreateUser(user *models.User) error {
+	user.Email = models.NormalizeEmail(user.Email)
 	// 使用所有可用字段 - 不包含id字段，让PostgreSQL自动生成UUID
 	userData := map[string]interface{}{
 		"email":         user.Email,
@@ -503,6 +888,9 @@ func (db *SupabaseDatabase) CreateUser(user *models.User) error {
 
 	// 发送POST请求到users表
 	data, err := db.makeRequest("POST", "/users", userData)
+	if isUniqueViolation(err) {
+		return alreadyExists("user")
+	}
 	if err != nil {
 		return err
 	}
@@ -523,8 +911,8 @@ func (db *SupabaseDatabase) CreateUser(user *models.User) error {
 
 // GetUserByEmail 根据邮箱获取用户
 func (db *SupabaseDatabase) GetUserByEmail(email string) (*models.User, error) {
-	// 构建查询URL - 参考旧项目实现
-	url := fmt.Sprintf("/users?email=eq.%s&select=*", email)
+	// 转义通配符后以 ilike 做不区分大小写的精确匹配（兼容迁移前大小写混合的存量邮箱）
+	url := from("users").Ilike("email", likeLiteral(models.NormalizeEmail(email))).Select("*").String()
 
 	// 发送GET请求
 	data, err := db.makeRequest("GET", url, nil)
@@ -539,7 +927,7 @@ func (db *SupabaseDatabase) GetUserByEmail(email string) (*models.User, error) {
 	}
 
 	if len(rawUsers) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, notFound("user")
 	}
 
 	// 转换为User结构体
@@ -578,7 +966,7 @@ func (db *SupabaseDatabase) GetUserByEmail(email string) (*models.User, error) {
 
 // GetUserByID 根据ID获取用户
 func (db *SupabaseDatabase) GetUserByID(id string) (*models.User, error) {
-	endpoint := fmt.Sprintf("/users?id=eq.%s&select=*", id)
+	endpoint := from("users").Eq("id", id).Select("*").String()
 
 	data, err := db.makeRequest("GET", endpoint, nil)
 	if err != nil {
@@ -591,7 +979,7 @@ func (db *SupabaseDatabase) GetUserByID(id string) (*models.User, error) {
 	}
 
 	if len(users) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, notFound("user")
 	}
 
 	user := &users[0]
@@ -600,20 +988,23 @@ func (db *SupabaseDatabase) GetUserByID(id string) (*models.User, error) {
 
 // UpdateUser 更新用户
 func (db *SupabaseDatabase) UpdateUser(user *models.User) error {
-	// 更新所有可用字段
+	// 与 Postgres 一致只更新资料字段：调用方的 user 可能未加载 tier，写回空值会把付费用户降级
 	userData := map[string]interface{}{
 		"name":       user.Name,
 		"avatar":     user.Avatar,
 		"provider":   user.Provider,
-		"tier":       user.Tier,
-		"updated_at": user.UpdatedAt.Format(time.RFC3339),
+		"updated_at": time.Now().Format(time.RFC3339),
 	}
 
-	endpoint := fmt.Sprintf("/users?id=eq.%s", user.ID)
-	_, err := db.makeRequest("PATCH", endpoint, userData)
+	endpoint := from("users").Eq("id", user.ID).String()
+	data, err := db.makeRequest("PATCH", endpoint, userData)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
+	// 用服务端返回的行刷新调用方的实体（含新的 updated_at）
+	if err := decodeFirstRow(data, user, "user"); err != nil {
+		return err
+	}
 
 	fmt.Printf("👤 Updated user %s via Supabase REST (provider: %s, tier: %s)\n", user.Email, user.Provider, user.Tier)
 	return nil
@@ -628,7 +1019,7 @@ func (db *SupabaseDatabase) DeleteUser(id string) error {
 // GetUserWithSubscription 获取用户及订阅信息
 func (db *SupabaseDatabase) GetUserWithSubscription(userID string) (*models.UserWithSubscription, error) {
 	// 使用Supabase REST API查询用户信息
-	endpoint := fmt.Sprintf("/users?id=eq.%s&select=*", userID)
+	endpoint := from("users").Eq("id", userID).Select("*").String()
 
 	respBody, err := db.makeRequest("GET", endpoint, nil)
 	if err != nil {
@@ -642,7 +1033,7 @@ func (db *SupabaseDatabase) GetUserWithSubscription(userID string) (*models.User
 	}
 
 	if len(users) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, notFound("user")
 	}
 
 	user := &users[0]
@@ -656,8 +1047,8 @@ func (db *SupabaseDatabase) GetUserWithSubscription(userID string) (*models.User
 	return user, nil
 }
 
-// SaveSnapshot 保存快照
-func (db *SupabaseDatabase) SaveSnapshot(userID, name string, tabGroups []models.TabGroup) error {
+// SaveSnapshot 保存快照（kind 为空时保留已有快照的类型，新快照为 manual）
+func (db *SupabaseDatabase) SaveSnapshot(userID, name, kind string, tabGroups []models.TabGroup) error {
 	// 计算统计信息
 	groupCount := len(tabGroups)
 	tabCount := 0
@@ -665,22 +1056,29 @@ func (db *SupabaseDatabase) SaveSnapshot(userID, name string, tabGroups []models
 		tabCount += len(group.Tabs)
 	}
 
-	// 构建快照数据
+	// 构建快照数据（tab_groups 按配置压缩）
+	tabGroupsJSON, err := encodeTabGroups(tabGroups, db.compressSnapshots)
+	if err != nil {
+		return err
+	}
 	snapshot := map[string]interface{}{
 		"user_id":     userID,
 		"name":        name,
-		"tab_groups":  tabGroups,
+		"tab_groups":  tabGroupsJSON,
 		"group_count": groupCount,
 		"tab_count":   tabCount,
 		"updated_at":  time.Now().Format(time.RFC3339),
 	}
+	if kind != "" {
+		snapshot["kind"] = kind
+	}
 
 	// 检查快照是否已存在（参考旧项目实现）
 	existingSnapshot, err := db.getSnapshotByName(userID, name)
 	if err == nil && existingSnapshot != nil {
 		// 更新现有快照
 		fmt.Printf("📝 Updating existing snapshot: %s\n", name)
-		endpoint := fmt.Sprintf("/snapshots?user_id=eq.%s&name=eq.%s", userID, name)
+		endpoint := from("snapshots").Eq("user_id", userID).Eq("name", name).String()
 		_, err = db.makeRequest("PATCH", endpoint, snapshot)
 		if err != nil {
 			fmt.Printf("❌ Failed to update snapshot: %v\n", err)
@@ -693,6 +1091,9 @@ func (db *SupabaseDatabase) SaveSnapshot(userID, name string, tabGroups []models
 
 	// 创建新快照
 	fmt.Printf("🆕 Creating new snapshot: %s\n", name)
+	if kind == "" {
+		snapshot["kind"] = models.SnapshotKindManual
+	}
 	endpoint := "/snapshots"
 	_, err = db.makeRequest("POST", endpoint, snapshot)
 	if err != nil {
@@ -706,12 +1107,16 @@ func (db *SupabaseDatabase) SaveSnapshot(userID, name string, tabGroups []models
 	return nil
 }
 
-// ListSnapshots 列出快照
-func (db *SupabaseDatabase) ListSnapshots(userID string) ([]SnapshotInfo, error) {
+// ListSnapshots 列出快照（kind 为空时返回全部类型）
+func (db *SupabaseDatabase) ListSnapshots(userID, kind string) ([]SnapshotInfo, error) {
 	// 使用Supabase REST API查询快照列表
-	endpoint := fmt.Sprintf("/snapshots?user_id=eq.%s&select=name,created_at,updated_at,group_count,tab_count&order=updated_at.desc", userID)
+	q := from("snapshots").Eq("user_id", userID)
+	if kind != "" {
+		q = q.Eq("kind", kind)
+	}
+	endpoint := q.Select("name,kind,created_at,updated_at,group_count,tab_count").Order("updated_at.desc").String()
 
-	respBody, err := db.makeRequest("GET", endpoint, nil)
+	respBody, err := db.paginate(endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query snapshots: %w", err)
 	}
@@ -719,6 +1124,7 @@ func (db *SupabaseDatabase) ListSnapshots(userID string) ([]SnapshotInfo, error)
 	// 解析响应
 	var snapshots []struct {
 		Name       string    `json:"name"`
+		Kind       string    `json:"kind"`
 		CreatedAt  time.Time `json:"created_at"`
 		UpdatedAt  time.Time `json:"updated_at"`
 		GroupCount int       `json:"group_count"`
@@ -734,6 +1140,7 @@ func (db *SupabaseDatabase) ListSnapshots(userID string) ([]SnapshotInfo, error)
 	for _, snapshot := range snapshots {
 		result = append(result, SnapshotInfo{
 			Name:       snapshot.Name,
+			Kind:       snapshot.Kind,
 			CreatedAt:  snapshot.CreatedAt.Format(time.RFC3339),
 			UpdatedAt:  snapshot.UpdatedAt.Format(time.RFC3339),
 			GroupCount: snapshot.GroupCount,
@@ -749,7 +1156,7 @@ func (db *SupabaseDatabase) LoadSnapshot(userID, name string) (*LoadSnapshotResp
 	fmt.Printf("🔍 LoadSnapshot: Querying for userID=%s, name=%s\n", userID, name)
 
 	// 使用Supabase REST API查询指定快照
-	endpoint := fmt.Sprintf("/snapshots?user_id=eq.%s&name=eq.%s&select=name,tab_groups,created_at,updated_at", userID, name)
+	endpoint := from("snapshots").Eq("user_id", userID).Eq("name", name).Select("name,tab_groups,created_at,updated_at").String()
 	fmt.Printf("🔍 LoadSnapshot: Query endpoint: %s\n", endpoint)
 
 	respBody, err := db.makeRequest("GET", endpoint, nil)
@@ -763,9 +1170,9 @@ func (db *SupabaseDatabase) LoadSnapshot(userID, name string) (*LoadSnapshotResp
 	// 解析响应 - Supabase返回的是数组格式
 	var snapshots []struct {
 		Name      string            `json:"name"`
-		TabGroups []models.TabGroup `json:"tab_groups"`
-		CreatedAt time.Time         `json:"created_at"`
-		UpdatedAt time.Time         `json:"updated_at"`
+		TabGroups json.RawMessage `json:"tab_groups"`
+		CreatedAt time.Time       `json:"created_at"`
+		UpdatedAt time.Time       `json:"updated_at"`
 	}
 
 	if err := json.Unmarshal(respBody, &snapshots); err != nil {
@@ -778,25 +1185,67 @@ func (db *SupabaseDatabase) LoadSnapshot(userID, name string) (*LoadSnapshotResp
 	// 检查是否找到快照
 	if len(snapshots) == 0 {
 		fmt.Printf("❌ LoadSnapshot: No snapshots found for userID=%s, name=%s\n", userID, name)
-		return nil, fmt.Errorf("snapshot not found")
+		return nil, notFound("snapshot")
 	}
 
-	// 返回第一个匹配的快照
+	// 返回第一个匹配的快照（压缩存储的快照先解压）
 	snapshot := snapshots[0]
-	fmt.Printf("✅ LoadSnapshot: Successfully loaded snapshot '%s' with %d tab groups\n", snapshot.Name, len(snapshot.TabGroups))
+	tabGroupsJSON, err := decodeTabGroups(snapshot.TabGroups)
+	if err != nil {
+		return nil, err
+	}
+	var tabGroups []models.TabGroup
+	if err := json.Unmarshal(tabGroupsJSON, &tabGroups); err != nil {
+		return nil, fmt.Errorf("failed to parse tab groups: %w", err)
+	}
+	fmt.Printf("✅ LoadSnapshot: Successfully loaded snapshot '%s' with %d tab groups\n", snapshot.Name, len(tabGroups))
 
 	return &LoadSnapshotResponse{
 		Name:      snapshot.Name,
-		TabGroups: snapshot.TabGroups,
+		TabGroups: tabGroups,
 		CreatedAt: snapshot.CreatedAt.Format(time.RFC3339),
 		UpdatedAt: snapshot.UpdatedAt.Format(time.RFC3339),
 	}, nil
 }
 
+// LoadSnapshotRaw 加载快照，tab_groups 保持 PostgREST 返回的 JSON 原文
+func (db *SupabaseDatabase) LoadSnapshotRaw(userID, name string) (*RawSnapshot, error) {
+	endpoint := from("snapshots").Eq("user_id", userID).Eq("name", name).Select("name,tab_groups,created_at,updated_at").String()
+	respBody, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshot: %w", err)
+	}
+
+	var snapshots []struct {
+		Name      string          `json:"name"`
+		TabGroups json.RawMessage `json:"tab_groups"`
+		CreatedAt time.Time       `json:"created_at"`
+		UpdatedAt time.Time       `json:"updated_at"`
+	}
+	if err := json.Unmarshal(respBody, &snapshots); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot response: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return nil, notFound("snapshot")
+	}
+
+	s := snapshots[0]
+	tabGroups, err := decodeTabGroups(s.TabGroups)
+	if err != nil {
+		return nil, err
+	}
+	return &RawSnapshot{
+		Name:      s.Name,
+		TabGroups: tabGroups,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}, nil
+}
+
 // DeleteSnapshot 删除快照
 func (db *SupabaseDatabase) DeleteSnapshot(userID, name string) error {
 	// 使用Supabase REST API删除指定快照
-	endpoint := fmt.Sprintf("/snapshots?user_id=eq.%s&name=eq.%s", userID, name)
+	endpoint := from("snapshots").Eq("user_id", userID).Eq("name", name).String()
 
 	_, err := db.makeRequest("DELETE", endpoint, nil)
 	if err != nil {
@@ -807,34 +1256,54 @@ func (db *SupabaseDatabase) DeleteSnapshot(userID, name string) error {
 	return nil
 }
 
-// CreateSubscription 创建订阅
-func (db *SupabaseDatabase) CreateSubscription(subscription *models.UserSubscription) error {
-	// TODO: 实现Supabase订阅创建
-	return fmt.Errorf("CreateSubscription not implemented for Supabase")
-}
-
-// GetUserSubscription 获取用户订阅
-func (db *SupabaseDatabase) GetUserSubscription(userID string) (*models.UserSubscription, error) {
-	// TODO: 实现Supabase订阅查询
-	return nil, fmt.Errorf("GetUserSubscription not implemented for Supabase")
-}
-
-// UpdateSubscription 更新订阅
-func (db *SupabaseDatabase) UpdateSubscription(subscription *models.UserSubscription) error {
-	// TODO: 实现Supabase订阅更新
-	return fmt.Errorf("UpdateSubscription not implemented for Supabase")
-}
+// PruneSnapshots 删除 kind 类型中除最近更新的 keep 个以外的快照（按 id 分批删除，避免 URL 过长）
+func (db *SupabaseDatabase) PruneSnapshots(userID, kind string, keep int) (int, error) {
+	endpoint := from("snapshots").Eq("user_id", userID).Eq("kind", kind).Select("id").Order("updated_at.desc").String()
+	respBody, err := db.paginate(endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var rows []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &rows); err != nil {
+		return 0, fmt.Errorf("failed to parse snapshots response: %w", err)
+	}
+	if len(rows) <= keep {
+		return 0, nil
+	}
 
-// CancelSubscription 取消订阅
-func (db *SupabaseDatabase) CancelSubscription(userID string) error {
-	// TODO: 实现Supabase订阅取消
-	return fmt.Errorf("CancelSubscription not implemented for Supabase")
+	ids := make([]string, 0, len(rows)-keep)
+	for _, row := range rows[keep:] {
+		ids = append(ids, row.ID)
+	}
+	const batch = 100
+	for start := 0; start < len(ids); start += batch {
+		end := start + batch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if _, err := db.makeRequest("DELETE", from("snapshots").Eq("user_id", userID).In("id", ids[start:end]).String(), nil); err != nil {
+			return start, fmt.Errorf("failed to prune snapshots: %w", err)
+		}
+	}
+	fmt.Printf("🧹 Pruned %d %s snapshots for user %s (kept %d)\n", len(ids), kind, userID, keep)
+	return len(ids), nil
 }
 
-// GetUserAICredits 获取AI积分
+// GetUserAICredits 返回当前周期（period_end 晚于现在的最新一期）的 AI 积分；没有当前周期时返回 not found
 func (db *SupabaseDatabase) GetUserAICredits(userID string) (*models.AICredits, error) {
-	// TODO: 实现Supabase AI积分查询
-	return nil, fmt.Errorf("GetUserAICredits not implemented for Supabase")
+	endpoint := from("ai_credits").Eq("user_id", userID).Gt("period_end", time.Now().UTC().Format(time.RFC3339)).
+		Select("*").Order("period_end.desc").Limit(1).String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ai credits: %w", err)
+	}
+	var c models.AICredits
+	if err := decodeFirstRow(data, &c, "ai credits"); err != nil {
+		return nil, err
+	}
+	return &c, nil
 }
 
 // UpdateAICredits 更新AI积分
@@ -851,7 +1320,7 @@ func (db *SupabaseDatabase) ConsumeAICredits(userID string, amount int) error {
 
 // getSnapshotByName 根据名称获取快照（内部方法）
 func (db *SupabaseDatabase) getSnapshotByName(userID, name string) (map[string]interface{}, error) {
-	endpoint := fmt.Sprintf("/snapshots?user_id=eq.%s&name=eq.%s&select=*", userID, name)
+	endpoint := from("snapshots").Eq("user_id", userID).Eq("name", name).Select("*").String()
 
 	data, err := db.makeRequest("GET", endpoint, nil)
 	if err != nil {
@@ -864,12 +1333,24 @@ func (db *SupabaseDatabase) getSnapshotByName(userID, name string) (map[string]i
 	}
 
 	if len(snapshots) == 0 {
-		return nil, fmt.Errorf("snapshot not found")
+		return nil, notFound("snapshot")
 	}
 
 	return snapshots[0], nil
 }
 
+// decodeFirstRow 将 return=representation 返回的首行解码到 dst；无行时返回 entity 的 NotFoundError
+func decodeFirstRow(data []byte, dst interface{}, entity string) error {
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(rows) == 0 {
+		return notFound(entity)
+	}
+	return json.Unmarshal(rows[0], dst)
+}
+
 // HealthCheck 健康检查
 func (db *SupabaseDatabase) HealthCheck() error {
 	// 发送简单的查询来检查连接
@@ -0,0 +1,326 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// GetUserByPaddleCustomerID 根据 Paddle 客户 ID（ctm_...）查找用户
+func (db *SupabaseDatabase) GetUserByPaddleCustomerID(customerID string) (*models.User, error) {
+	if strings.TrimSpace(customerID) == "" {
+		return nil, notFound("user")
+	}
+	endpoint := from("users").Eq("paddle_customer_id", customerID).Select("id,email,name,tier,created_at,updated_at").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by paddle customer id: %w", err)
+	}
+	var user models.User
+	if err := decodeFirstRow(data, &user, "user"); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUserTier 只更新等级
+func (db *SupabaseDatabase) UpdateUserTier(userID, tier string) error {
+	data, err := db.makeRequest("PATCH", from("users").Eq("id", userID).Select("id").String(), map[string]interface{}{
+		"tier":       tier,
+		"updated_at": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user tier: %w", err)
+	}
+	var updated struct {
+		ID string `json:"id"`
+	}
+	return decodeFirstRow(data, &updated, "user")
+}
+
+// UpdateUserBilling 只更新给定的计费字段
+func (db *SupabaseDatabase) UpdateUserBilling(userID string, update UserBillingUpdate) error {
+	payload := map[string]interface{}{}
+	if update.Tier != nil {
+		payload["tier"] = *update.Tier
+	}
+	if update.PaddleCustomerID != nil {
+		payload["paddle_customer_id"] = *update.PaddleCustomerID
+	}
+	if update.IsLifetimeMember != nil {
+		payload["is_lifetime_member"] = *update.IsLifetimeMember
+	}
+	if update.LifetimeMemberType != nil {
+		if *update.LifetimeMemberType == "" {
+			payload["lifetime_member_type"] = nil
+		} else {
+			payload["lifetime_member_type"] = *update.LifetimeMemberType
+		}
+	}
+	if update.TrialEndsAt != nil {
+		payload["trial_ends_at"] = update.TrialEndsAt.UTC().Format(time.RFC3339)
+	}
+	if update.TrialActive != nil {
+		payload["trial_active"] = *update.TrialActive
+	}
+	if update.DunningStatus != nil {
+		if *update.DunningStatus == "" {
+			payload["dunning_status"] = nil
+			payload["dunning_started_at"] = nil
+		} else {
+			payload["dunning_status"] = *update.DunningStatus
+		}
+	}
+	if update.DunningStartedAt != nil {
+		payload["dunning_started_at"] = update.DunningStartedAt.UTC().Format(time.RFC3339)
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	payload["updated_at"] = time.Now().Format(time.RFC3339)
+
+	endpoint := from("users").Eq("id", userID).String()
+	data, err := db.makeRequest("PATCH", endpoint, payload)
+	if err != nil {
+		return fmt.Errorf("failed to update user billing: %w", err)
+	}
+	var updated models.User
+	return decodeFirstRow(data, &updated, "user")
+}
+
+// ListExpiredTrials 返回试用已到期但尚未回收的用户
+func (db *SupabaseDatabase) ListExpiredTrials(before time.Time) ([]models.UserWithSubscription, error) {
+	endpoint := from("users").
+		Is("trial_active", "true").
+		Lt("trial_ends_at", before.UTC().Format(time.RFC3339)).
+		Select("id,email,created_at,updated_at,tier,trial_ends_at,trial_active,is_lifetime_member,lifetime_member_type").
+		Order("trial_ends_at.asc").
+		String()
+	data, err := db.paginate(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired trials: %w", err)
+	}
+	var users []models.UserWithSubscription
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse users: %w", err)
+	}
+	return users, nil
+}
+
+// ListExpiredDunning 返回宽限期已过（dunning_started_at 早于 before）仍处于 grace 的用户
+func (db *SupabaseDatabase) ListExpiredDunning(before time.Time) ([]models.UserWithSubscription, error) {
+	endpoint := from("users").
+		Eq("dunning_status", string(models.DunningGrace)).
+		Lt("dunning_started_at", before.UTC().Format(time.RFC3339)).
+		Select("id,email,created_at,updated_at,tier,dunning_status,dunning_started_at,is_lifetime_member,lifetime_member_type").
+		Order("dunning_started_at.asc").
+		String()
+	data, err := db.paginate(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired dunning: %w", err)
+	}
+	var users []models.UserWithSubscription
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse users: %w", err)
+	}
+	return users, nil
+}
+
+// GetSubscriptionPlanByTier 返回该等级当前启用的订阅计划
+func (db *SupabaseDatabase) GetSubscriptionPlanByTier(tier models.UserTier) (*models.SubscriptionPlan, error) {
+	endpoint := from("subscription_plans").Eq("tier", string(tier)).Is("is_active", "true").
+		Select("*").Order("created_at.asc").Limit(1).String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription plan: %w", err)
+	}
+	var plan models.SubscriptionPlan
+	if err := decodeFirstRow(data, &plan, "subscription plan"); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// CreateSubscription 创建订阅记录
+func (db *SupabaseDatabase) CreateSubscription(subscription *models.UserSubscription) error {
+	payload := subscriptionPayload(subscription)
+	payload["user_id"] = subscription.UserID
+	data, err := db.makeRequest("POST", "/user_subscriptions", payload)
+	if err != nil {
+		return fmt.Errorf("failed to create subscription: %w", err)
+	}
+	return decodeFirstRow(data, subscription, "subscription")
+}
+
+// GetUserSubscription 返回用户最近的一条订阅记录
+func (db *SupabaseDatabase) GetUserSubscription(userID string) (*models.UserSubscription, error) {
+	endpoint := from("user_subscriptions").Eq("user_id", userID).Select("*").Order("created_at.desc").Limit(1).String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	var subscription models.UserSubscription
+	if err := decodeFirstRow(data, &subscription, "subscription"); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// UpdateSubscription 更新订阅记录（按 ID 整行更新）
+func (db *SupabaseDatabase) UpdateSubscription(subscription *models.UserSubscription) error {
+	payload := subscriptionPayload(subscription)
+	payload["updated_at"] = time.Now().Format(time.RFC3339)
+	data, err := db.makeRequest("PATCH", from("user_subscriptions").Eq("id", subscription.ID).String(), payload)
+	if err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+	return decodeFirstRow(data, subscription, "subscription")
+}
+
+// CancelSubscription 将用户尚未取消的订阅记录标记为已取消
+func (db *SupabaseDatabase) CancelSubscription(userID string) error {
+	now := time.Now().Format(time.RFC3339)
+	endpoint := from("user_subscriptions").Eq("user_id", userID).filter("status", "neq", string(models.StatusCanceled)).String()
+	if _, err := db.makeRequest("PATCH", endpoint, map[string]interface{}{
+		"status":      string(models.StatusCanceled),
+		"canceled_at": now,
+		"updated_at":  now,
+	}); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return nil
+}
+
+// subscriptionPayload 订阅记录的可写列
+func subscriptionPayload(s *models.UserSubscription) map[string]interface{} {
+	return map[string]interface{}{
+		"plan_id":                s.PlanID,
+		"paddle_subscription_id": s.PaddleSubscriptionID,
+		"status":                 string(s.Status),
+		"current_period_start":   s.CurrentPeriodStart,
+		"current_period_end":     s.CurrentPeriodEnd,
+		"cancel_at_period_end":   s.CancelAtPeriodEnd,
+		"canceled_at":            s.CanceledAt,
+		"trial_start":            s.TrialStart,
+		"trial_end":              s.TrialEnd,
+	}
+}
+
+// GetPromoCode 按（规范化后的）优惠码查找
+func (db *SupabaseDatabase) GetPromoCode(code string) (*models.PromoCode, error) {
+	endpoint := from("promo_codes").Eq("code", models.NormalizePromoCode(code)).Select("*").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promo code: %w", err)
+	}
+	var promo models.PromoCode
+	if err := decodeFirstRow(data, &promo, "promo code"); err != nil {
+		return nil, err
+	}
+	return &promo, nil
+}
+
+// HasRedeemedPromo 用户是否已兑换过该优惠码
+func (db *SupabaseDatabase) HasRedeemedPromo(promoID, userID string) (bool, error) {
+	endpoint := from("promo_redemptions").Eq("promo_id", promoID).Eq("user_id", userID).Select("id").Limit(1).String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to check promo redemption: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return false, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return len(rows) > 0, nil
+}
+
+// RedeemPromoCode 以 redemption_count 作乐观锁递增计数后写入兑换记录；
+// PostgREST 无事务，写入失败时回退计数
+func (db *SupabaseDatabase) RedeemPromoCode(promoID, userID string) error {
+	redeemed, err := db.HasRedeemedPromo(promoID, userID)
+	if err != nil {
+		return err
+	}
+	if redeemed {
+		return ErrPromoAlreadyRedeemed
+	}
+
+	data, err := db.makeRequest("GET", from("promo_codes").Eq("id", promoID).Select("*").String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to get promo code: %w", err)
+	}
+	var promo models.PromoCode
+	if err := decodeFirstRow(data, &promo, "promo code"); err != nil {
+		return err
+	}
+	if promo.MaxRedemptions != nil && promo.RedemptionCount >= *promo.MaxRedemptions {
+		return ErrPromoExhausted
+	}
+
+	count := strconv.Itoa(promo.RedemptionCount)
+	data, err = db.makeRequest("PATCH", from("promo_codes").Eq("id", promoID).Eq("redemption_count", count).String(),
+		map[string]interface{}{"redemption_count": promo.RedemptionCount + 1})
+	if err != nil {
+		return fmt.Errorf("failed to count promo redemption: %w", err)
+	}
+	var updated models.PromoCode
+	if err := decodeFirstRow(data, &updated, "promo code"); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			// 计数已被并发兑换修改
+			return ErrPromoExhausted
+		}
+		return err
+	}
+
+	if _, err := db.makeRequest("POST", "/promo_redemptions", map[string]interface{}{
+		"promo_id": promoID,
+		"user_id":  userID,
+	}); err != nil {
+		_, _ = db.makeRequest("PATCH", from("promo_codes").Eq("id", promoID).String(),
+			map[string]interface{}{"redemption_count": promo.RedemptionCount})
+		return fmt.Errorf("failed to record promo redemption: %w", err)
+	}
+	return nil
+}
+
+// GrantAICredits 向用户当前周期追加积分（无当前周期时新建一个月的周期）
+func (db *SupabaseDatabase) GrantAICredits(userID string, amount int) error {
+	now := time.Now().UTC()
+	endpoint := from("ai_credits").Eq("user_id", userID).Gt("period_end", now.Format(time.RFC3339)).
+		Select("*").Order("period_end.desc").Limit(1).String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get ai credits: %w", err)
+	}
+	var current models.AICredits
+	err = decodeFirstRow(data, &current, "ai credits")
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	if err == nil {
+		_, err = db.makeRequest("PATCH", from("ai_credits").Eq("id", current.ID).String(), map[string]interface{}{
+			"credits_total":     current.CreditsTotal + amount,
+			"credits_remaining": current.CreditsRemaining + amount,
+			"updated_at":        now.Format(time.RFC3339),
+		})
+	} else {
+		_, err = db.makeRequest("POST", "/ai_credits", map[string]interface{}{
+			"user_id":           userID,
+			"credits_total":     amount,
+			"credits_used":      0,
+			"credits_remaining": amount,
+			"period_start":      now.Format(time.RFC3339),
+			"period_end":        now.AddDate(0, 1, 0).Format(time.RFC3339),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to grant ai credits: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// CreateDevicePush 为目标设备排队一组 URL
+func (db *SupabaseDatabase) CreateDevicePush(p *models.DevicePush) error {
+	data, err := db.makeRequest("POST", "/device_pushes", map[string]interface{}{
+		"user_id":          p.UserID,
+		"source_device_id": p.SourceDeviceID,
+		"target_device_id": p.TargetDeviceID,
+		"urls":             p.URLs,
+		"status":           models.DevicePushPending,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create device push: %w", err)
+	}
+	return decodeFirstRow(data, p, "device push")
+}
+
+// GetDevicePush 仅返回属于 userID 的推送，否则视为不存在
+func (db *SupabaseDatabase) GetDevicePush(userID, id string) (*models.DevicePush, error) {
+	data, err := db.makeRequest("GET", from("device_pushes").Eq("id", id).Eq("user_id", userID).Select("*").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device push: %w", err)
+	}
+	var p models.DevicePush
+	if err := decodeFirstRow(data, &p, "device push"); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ClaimDevicePushes 先将 pending 标记为 delivered，再返回 createdAfter 之后尚未处理的推送
+func (db *SupabaseDatabase) ClaimDevicePushes(userID, deviceID string, createdAfter time.Time) ([]models.DevicePush, error) {
+	after := createdAfter.UTC().Format(time.RFC3339)
+	pending := from("device_pushes").Eq("user_id", userID).Eq("target_device_id", deviceID).
+		Eq("status", string(models.DevicePushPending)).Gt("created_at", after)
+	if _, err := db.makeRequest("PATCH", pending.String(), map[string]interface{}{
+		"status":       models.DevicePushDelivered,
+		"delivered_at": time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to claim device pushes: %w", err)
+	}
+	endpoint := from("device_pushes").Eq("user_id", userID).Eq("target_device_id", deviceID).
+		Eq("status", string(models.DevicePushDelivered)).Gt("created_at", after).
+		Select("*").Order("created_at.asc").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device pushes: %w", err)
+	}
+	pushes := []models.DevicePush{}
+	if err := json.Unmarshal(data, &pushes); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return pushes, nil
+}
+
+// CompleteDevicePush 记录目标设备的处理结果（opened/dismissed）；已完成的推送返回 ErrNotFound
+func (db *SupabaseDatabase) CompleteDevicePush(userID, id string, status models.DevicePushStatus) error {
+	endpoint := from("device_pushes").Eq("id", id).Eq("user_id", userID).Is("completed_at", "null").Select("id").String()
+	data, err := db.makeRequest("PATCH", endpoint, map[string]interface{}{
+		"status":       status,
+		"completed_at": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update device push: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(rows) == 0 {
+		return notFound("device push")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// RegisterDevice 以 merge-duplicates 按 (user_id, install_id) 插入或更新，刷新 last_seen 并清除吊销状态
+func (db *SupabaseDatabase) RegisterDevice(d *models.Device) error {
+	body := map[string]interface{}{
+		"user_id":    d.UserID,
+		"install_id": d.InstallID,
+		"name":       d.Name,
+		"browser":    d.Browser,
+		"platform":   d.Platform,
+		"last_seen":  time.Now().UTC().Format(time.RFC3339),
+		"revoked_at": nil,
+		"last_ip":    d.LastIP,
+		"country":    d.Country,
+		"region":     d.Region,
+		"city":       d.City,
+	}
+	data, err := db.makeRequestWithHeaders("POST", "/devices?on_conflict=user_id,install_id", body,
+		map[string]string{"Prefer": "resolution=merge-duplicates,return=representation"})
+	if err != nil {
+		return fmt.Errorf("failed to register device: %w", err)
+	}
+	return decodeFirstRow(data, d, "device")
+}
+
+// GetDevice 仅返回属于 userID 的设备，否则视为不存在
+func (db *SupabaseDatabase) GetDevice(userID, id string) (*models.Device, error) {
+	data, err := db.makeRequest("GET", from("devices").Eq("id", id).Eq("user_id", userID).Select("*").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	var d models.Device
+	if err := decodeFirstRow(data, &d, "device"); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDevices 按 last_seen 倒序返回用户的全部设备（含已吊销）
+func (db *SupabaseDatabase) ListDevices(userID string) ([]models.Device, error) {
+	data, err := db.makeRequest("GET", from("devices").Eq("user_id", userID).Select("*").Order("last_seen.desc").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	devices := []models.Device{}
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return devices, nil
+}
+
+// TouchDevice 刷新 last_seen；cursor 非空时同时更新 last_sync_cursor
+func (db *SupabaseDatabase) TouchDevice(userID, id string, cursor *string) error {
+	patch := map[string]interface{}{"last_seen": time.Now().UTC().Format(time.RFC3339)}
+	if cursor != nil {
+		patch["last_sync_cursor"] = *cursor
+	}
+	endpoint := from("devices").Eq("id", id).Eq("user_id", userID).Is("revoked_at", "null").Select("id").String()
+	return db.patchDevice(endpoint, patch, "failed to update device")
+}
+
+// RevokeDevice 标记设备为已吊销；设备下次心跳时被要求重新登录
+func (db *SupabaseDatabase) RevokeDevice(userID, id string) error {
+	endpoint := from("devices").Eq("id", id).Eq("user_id", userID).Select("id").String()
+	return db.patchDevice(endpoint, map[string]interface{}{
+		"revoked_at": time.Now().UTC().Format(time.RFC3339),
+	}, "failed to revoke device")
+}
+
+// patchDevice 执行 PATCH，未匹配到任何行时返回 ErrNotFound
+func (db *SupabaseDatabase) patchDevice(endpoint string, patch map[string]interface{}, action string) error {
+	data, err := db.makeRequest("PATCH", endpoint, patch)
+	if err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(rows) == 0 {
+		return notFound("device")
+	}
+	return nil
+}
+
+// ListDeviceSpaces 返回设备订阅同步的空间；为空表示同步全部空间
+func (db *SupabaseDatabase) ListDeviceSpaces(deviceID string) ([]string, error) {
+	endpoint := from("device_spaces").Eq("device_id", deviceID).Select("space_id").Order("created_at.asc").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device spaces: %w", err)
+	}
+	var rows []struct {
+		SpaceID string `json:"space_id"`
+	}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	spaceIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		spaceIDs = append(spaceIDs, row.SpaceID)
+	}
+	return spaceIDs, nil
+}
+
+// SetDeviceSpaces 先删除再批量插入（PostgREST 无事务，中途失败时订阅可能为空，即回退为同步全部空间）
+func (db *SupabaseDatabase) SetDeviceSpaces(deviceID string, spaceIDs []string) error {
+	if _, err := db.makeRequest("DELETE", from("device_spaces").Eq("device_id", deviceID).String(), nil); err != nil {
+		return fmt.Errorf("failed to clear device spaces: %w", err)
+	}
+	if len(spaceIDs) == 0 {
+		return nil
+	}
+	rows := make([]map[string]interface{}, 0, len(spaceIDs))
+	for _, spaceID := range spaceIDs {
+		rows = append(rows, map[string]interface{}{"device_id": deviceID, "space_id": spaceID})
+	}
+	if _, err := db.makeRequestWithHeaders("POST", "/device_spaces", rows,
+		map[string]string{"Prefer": "resolution=ignore-duplicates,return=minimal"}); err != nil {
+		return fmt.Errorf("failed to set device spaces: %w", err)
+	}
+	return nil
+}
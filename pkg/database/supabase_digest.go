@@ -0,0 +1,205 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// GetNotificationPreferences 返回通知偏好；无记录时返回默认值
+func (db *SupabaseDatabase) GetNotificationPreferences(userID string) (*models.NotificationPreferences, error) {
+	endpoint := from("notification_preferences").Eq("user_id", userID).Select("user_id,weekly_digest,last_digest_at").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	var rows []models.NotificationPreferences
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse notification preferences: %w", err)
+	}
+	if len(rows) == 0 {
+		return models.DefaultNotificationPreferences(userID), nil
+	}
+	return &rows[0], nil
+}
+
+// UpdateNotificationPreferences 写入用户可修改的偏好（不影响 last_digest_at）
+func (db *SupabaseDatabase) UpdateNotificationPreferences(prefs *models.NotificationPreferences) error {
+	return db.upsertNotificationPreferences(map[string]interface{}{
+		"user_id":       prefs.UserID,
+		"weekly_digest": prefs.WeeklyDigest,
+	})
+}
+
+// MarkDigestSent 记录本次摘要发送时间（空摘要同样记录，避免同一周重复计算）
+func (db *SupabaseDatabase) MarkDigestSent(userID string, at time.Time) error {
+	err := db.upsertNotificationPreferences(map[string]interface{}{
+		"user_id":        userID,
+		"last_digest_at": at.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark digest sent: %w", err)
+	}
+	return nil
+}
+
+// upsertNotificationPreferences merge-duplicates 只更新 payload 中出现的列
+func (db *SupabaseDatabase) upsertNotificationPreferences(payload map[string]interface{}) error {
+	_, err := db.makeRequestWithHeaders("POST", "/notification_preferences?on_conflict=user_id", payload, map[string]string{
+		"Prefer": "resolution=merge-duplicates,return=minimal",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update notification preferences: %w", err)
+	}
+	return nil
+}
+
+// ListDigestRecipients 返回开启每周摘要、且上次发送早于 sentBefore（或从未发送）的用户，最多 limit 个。
+// 先取没有偏好记录的用户（嵌入资源 is.null 反连接），不足时再取到期的已有记录用户。
+func (db *SupabaseDatabase) ListDigestRecipients(sentBefore time.Time, limit int) ([]models.User, error) {
+	const userColumns = "id,email,name,tier,created_at,updated_at"
+	queries := []*restQuery{
+		from("users").
+			Is("notification_preferences", "null").
+			Select(userColumns + ",notification_preferences(user_id)").
+			Order("created_at.asc"),
+		from("users").
+			Is("notification_preferences.weekly_digest", "true").
+			Lt("notification_preferences.last_digest_at", sentBefore.UTC().Format(time.RFC3339)).
+			Select(userColumns + ",notification_preferences!inner(last_digest_at)").
+			Order("created_at.asc"),
+	}
+
+	users := []models.User{}
+	for _, q := range queries {
+		if len(users) >= limit {
+			break
+		}
+		data, err := db.makeRequest("GET", q.Limit(limit-len(users)).String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list digest recipients: %w", err)
+		}
+		var batch []models.User
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("failed to parse users: %w", err)
+		}
+		users = append(users, batch...)
+	}
+	return users, nil
+}
+
+type supabaseDigestItem struct {
+	Title       string  `json:"title"`
+	URL         *string `json:"url"`
+	Collections struct {
+		Name string `json:"name"`
+	} `json:"collections"`
+}
+
+type supabaseDigestSpace struct {
+	Spaces struct {
+		ID            string `json:"id"`
+		Name          string `json:"name"`
+		Organizations struct {
+			Name string `json:"name"`
+		} `json:"organizations"`
+	} `json:"spaces"`
+}
+
+// GetActivityDigest 汇总 since 之后用户所在组织的新增条目、新共享给用户的空间与失效链接
+func (db *SupabaseDatabase) GetActivityDigest(userID string, since time.Time) (*models.ActivityDigest, error) {
+	d := &models.ActivityDigest{Since: since, RecentItems: []models.DigestItem{}, SharedSpaces: []models.DigestSpace{}, DeadLinks: []models.DigestItem{}}
+	sinceStr := since.UTC().Format(time.RFC3339)
+
+	data, err := db.makeRequest("GET", from("organization_memberships").Eq("user_id", userID).Select("organization_id").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	var memberships []struct {
+		OrganizationID string `json:"organization_id"`
+	}
+	if err := json.Unmarshal(data, &memberships); err != nil {
+		return nil, fmt.Errorf("failed to parse memberships: %w", err)
+	}
+
+	if len(memberships) > 0 {
+		orgIDs := make([]string, len(memberships))
+		for i, m := range memberships {
+			orgIDs[i] = m.OrganizationID
+		}
+		// 用户所在组织中未删除的条目
+		scope := func() *restQuery {
+			return from("collection_items").
+				Is("deleted_at", "null").
+				Is("collections.deleted_at", "null").
+				Is("collections.spaces.deleted_at", "null").
+				In("collections.spaces.organization_id", orgIDs).
+				Select("title,url,collections!inner(name,spaces!inner(organization_id))")
+		}
+
+		d.RecentItems, d.NewItemsCount, err = db.digestItems(scope().Gt("created_at", sinceStr).Order("created_at.desc"), digestItemsLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list new items: %w", err)
+		}
+		d.DeadLinks, d.DeadLinksCount, err = db.digestItems(
+			scope().Eq("metadata->>link_status", "dead").Gt("updated_at", sinceStr).Order("updated_at.desc"), digestDeadLinksLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dead links: %w", err)
+		}
+	}
+
+	endpoint := from("space_permissions").
+		Eq("user_id", userID).
+		Gt("created_at", sinceStr).
+		Is("spaces.deleted_at", "null").
+		Select("spaces!inner(id,name,organizations(name))").
+		Order("created_at.desc").
+		String()
+	data, err = db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared spaces: %w", err)
+	}
+	var shared []supabaseDigestSpace
+	if err := json.Unmarshal(data, &shared); err != nil {
+		return nil, fmt.Errorf("failed to parse shared spaces: %w", err)
+	}
+	for _, s := range shared {
+		d.SharedSpaces = append(d.SharedSpaces, models.DigestSpace{
+			ID:           s.Spaces.ID,
+			Name:         s.Spaces.Name,
+			Organization: s.Spaces.Organizations.Name,
+		})
+	}
+	return d, nil
+}
+
+// digestItems 返回前 limit 条及总数（Range + count=exact）
+func (db *SupabaseDatabase) digestItems(q *restQuery, limit int) ([]models.DigestItem, int, error) {
+	data, header, err := db.doRequest("GET", q.String(), nil, map[string]string{
+		"Range-Unit": "items",
+		"Range":      fmt.Sprintf("0-%d", limit-1),
+		"Prefer":     "count=exact",
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	var rows []supabaseDigestItem
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse items: %w", err)
+	}
+	items := make([]models.DigestItem, 0, len(rows))
+	for _, r := range rows {
+		it := models.DigestItem{Title: r.Title, Collection: r.Collections.Name}
+		if r.URL != nil {
+			it.URL = *r.URL
+		}
+		items = append(items, it)
+	}
+	total, ok := parseContentRangeTotal(header.Get("Content-Range"))
+	if !ok {
+		total = len(items)
+	}
+	return items, total, nil
+}
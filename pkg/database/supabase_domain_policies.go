@@ -0,0 +1,101 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// ListDomainPolicies 返回组织的域名策略（按域名排序）
+func (db *SupabaseDatabase) ListDomainPolicies(orgID string) ([]models.DomainPolicy, error) {
+	data, err := db.paginate(from("organization_domain_policies").Eq("organization_id", orgID).
+		Select("organization_id,domain,action,created_by,created_at").Order("domain.asc").String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domain policies: %w", err)
+	}
+	var rows []struct {
+		models.DomainPolicy
+		CreatedBy *string `json:"created_by"`
+	}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse domain policies: %w", err)
+	}
+	policies := make([]models.DomainPolicy, len(rows))
+	for i, row := range rows {
+		policies[i] = row.DomainPolicy
+		if row.CreatedBy != nil {
+			policies[i].CreatedBy = *row.CreatedBy
+		}
+	}
+	return policies, nil
+}
+
+// SetDomainPolicy 新增或修改（覆盖 action 与操作者）域名策略
+func (db *SupabaseDatabase) SetDomainPolicy(p *models.DomainPolicy) error {
+	p.CreatedAt = time.Now().UTC()
+	_, err := db.makeRequestWithHeaders("POST", "/organization_domain_policies?on_conflict=organization_id,domain", map[string]interface{}{
+		"organization_id": p.OrganizationID,
+		"domain":          p.Domain,
+		"action":          p.Action,
+		"created_by":      p.CreatedBy,
+		"created_at":      p.CreatedAt.Format(time.RFC3339),
+	}, map[string]string{"Prefer": "resolution=merge-duplicates,return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to set domain policy: %w", err)
+	}
+	return nil
+}
+
+// DeleteDomainPolicy 删除域名策略
+func (db *SupabaseDatabase) DeleteDomainPolicy(orgID, domain string) error {
+	data, err := db.makeRequest("DELETE", from("organization_domain_policies").Eq("organization_id", orgID).Eq("domain", domain).Select("domain").String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain policy: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(rows) == 0 {
+		return notFound("domain policy")
+	}
+	return nil
+}
+
+// RecordPolicyViolations 批量写入违规审计记录
+func (db *SupabaseDatabase) RecordPolicyViolations(vs []models.PolicyViolation) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	rows := make([]map[string]interface{}, len(vs))
+	for i, v := range vs {
+		rows[i] = map[string]interface{}{
+			"organization_id": v.OrganizationID,
+			"user_id":         v.UserID,
+			"domain":          v.Domain,
+			"host":            v.Host,
+			"action":          v.Action,
+			"source":          v.Source,
+		}
+	}
+	if _, err := db.makeRequestWithHeaders("POST", "/policy_violations", rows, map[string]string{"Prefer": "return=minimal"}); err != nil {
+		return fmt.Errorf("failed to record policy violations: %w", err)
+	}
+	return nil
+}
+
+// ListPolicyViolations 返回组织最近的违规记录（按时间倒序）
+func (db *SupabaseDatabase) ListPolicyViolations(orgID string, limit int) ([]models.PolicyViolation, error) {
+	data, err := db.makeRequest("GET", from("policy_violations").Eq("organization_id", orgID).
+		Select("id,organization_id,user_id,domain,host,action,source,created_at").Order("created_at.desc").Limit(limit).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy violations: %w", err)
+	}
+	violations := []models.PolicyViolation{}
+	if err := json.Unmarshal(data, &violations); err != nil {
+		return nil, fmt.Errorf("failed to parse policy violations: %w", err)
+	}
+	return violations, nil
+}
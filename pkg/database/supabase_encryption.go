@@ -0,0 +1,67 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetOrganizationDataKey 返回组织被包装的数据密钥，未启用加密时返回空串
+func (db *SupabaseDatabase) GetOrganizationDataKey(orgID string) (string, error) {
+	data, err := db.makeRequest("GET", from("organizations").Eq("id", orgID).Select("encrypted_data_key").String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get organization data key: %w", err)
+	}
+	var row struct {
+		EncryptedDataKey *string `json:"encrypted_data_key"`
+	}
+	if err := decodeFirstRow(data, &row, "organization"); err != nil {
+		return "", err
+	}
+	if row.EncryptedDataKey == nil {
+		return "", nil
+	}
+	return *row.EncryptedDataKey, nil
+}
+
+// SetOrganizationDataKey 以 encrypted_data_key IS NULL 为条件 PATCH，已有密钥时不会覆盖
+func (db *SupabaseDatabase) SetOrganizationDataKey(orgID, wrappedKey string) error {
+	endpoint := from("organizations").Eq("id", orgID).Is("encrypted_data_key", "null").Select("id").String()
+	data, err := db.makeRequest("PATCH", endpoint, map[string]interface{}{
+		"encrypted_data_key": wrappedKey,
+		"updated_at":         time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set organization data key: %w", err)
+	}
+	var updated struct {
+		ID string `json:"id"`
+	}
+	if err := decodeFirstRow(data, &updated, "organization"); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if _, getErr := db.GetOrganizationDataKey(orgID); getErr != nil {
+			return getErr
+		}
+		return ErrDataKeyExists
+	}
+	return nil
+}
+
+// GetCollectionOrganizationID 通过 spaces 嵌入查询集合所属组织
+func (db *SupabaseDatabase) GetCollectionOrganizationID(collectionID string) (string, error) {
+	data, err := db.makeRequest("GET", from("collections").Eq("id", collectionID).Select("spaces(organization_id)").String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get collection organization: %w", err)
+	}
+	var row struct {
+		Spaces struct {
+			OrganizationID string `json:"organization_id"`
+		} `json:"spaces"`
+	}
+	if err := decodeFirstRow(data, &row, "collection"); err != nil {
+		return "", err
+	}
+	return row.Spaces.OrganizationID, nil
+}
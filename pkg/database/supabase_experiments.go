@@ -0,0 +1,18 @@
+package database
+
+import "fmt"
+
+// RecordExperimentExposure 记录首次曝光；同一用户、实验、变体重复曝光时不变
+func (db *SupabaseDatabase) RecordExperimentExposure(userID, experimentKey, variant string) error {
+	_, err := db.makeRequestWithHeaders("POST", "/experiment_exposures?on_conflict=user_id,experiment_key,variant", map[string]interface{}{
+		"user_id":        userID,
+		"experiment_key": experimentKey,
+		"variant":        variant,
+	}, map[string]string{
+		"Prefer": "resolution=ignore-duplicates,return=minimal",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record experiment exposure: %w", err)
+	}
+	return nil
+}
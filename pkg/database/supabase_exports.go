@@ -0,0 +1,173 @@
+package database
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// supabaseDataExportColumns 导出元数据列（不含 archive）
+const supabaseDataExportColumns = "id,user_id,status,size_bytes,error,started_at,completed_at,expires_at,created_at"
+
+// CreateDataExport 创建 pending 状态的导出
+func (db *SupabaseDatabase) CreateDataExport(e *models.DataExport) error {
+	e.Status = models.ExportPending
+	data, err := db.makeRequest("POST", "/data_exports", map[string]interface{}{
+		"user_id": e.UserID,
+		"status":  e.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create data export: %w", err)
+	}
+	var created models.DataExport
+	if err := decodeFirstRow(data, &created, "data export"); err != nil {
+		return fmt.Errorf("failed to parse data export: %w", err)
+	}
+	*e = created
+	return nil
+}
+
+// GetLatestDataExport 返回用户最近一次导出
+func (db *SupabaseDatabase) GetLatestDataExport(userID string) (*models.DataExport, error) {
+	endpoint := from("data_exports").Eq("user_id", userID).Select(supabaseDataExportColumns).Order("created_at.desc").Limit(1).String()
+	return db.getDataExport(endpoint)
+}
+
+// GetDataExport 仅返回属于 userID 的导出
+func (db *SupabaseDatabase) GetDataExport(userID, id string) (*models.DataExport, error) {
+	endpoint := from("data_exports").Eq("id", id).Eq("user_id", userID).Select(supabaseDataExportColumns).String()
+	return db.getDataExport(endpoint)
+}
+
+func (db *SupabaseDatabase) getDataExport(endpoint string) (*models.DataExport, error) {
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	var e models.DataExport
+	if err := decodeFirstRow(data, &e, "data export"); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetDataExportArchive 返回导出及其 zip 内容（PostgREST 以 "\x" 开头的十六进制字符串表示 bytea）
+func (db *SupabaseDatabase) GetDataExportArchive(id string) (*models.DataExport, []byte, error) {
+	endpoint := from("data_exports").Eq("id", id).Select(supabaseDataExportColumns + ",archive").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	var row struct {
+		models.DataExport
+		Archive *string `json:"archive"`
+	}
+	if err := decodeFirstRow(data, &row, "data export"); err != nil {
+		return nil, nil, err
+	}
+	var archive []byte
+	if row.Archive != nil {
+		archive, err = hex.DecodeString(strings.TrimPrefix(*row.Archive, `\x`))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode data export archive: %w", err)
+		}
+	}
+	return &row.DataExport, archive, nil
+}
+
+// ClaimDataExports 逐条以状态为条件 PATCH 认领（无事务时的乐观锁），被并发任务抢先的导出会被跳过
+func (db *SupabaseDatabase) ClaimDataExports(limit int, staleBefore time.Time) ([]models.DataExport, error) {
+	candidates := []*restQuery{
+		from("data_exports").Eq("status", string(models.ExportPending)),
+		from("data_exports").Eq("status", string(models.ExportProcessing)).Lt("started_at", staleBefore.UTC().Format(time.RFC3339)),
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	claimed := []models.DataExport{}
+	for _, q := range candidates {
+		if len(claimed) >= limit {
+			break
+		}
+		data, err := db.makeRequest("GET", q.Select(supabaseDataExportColumns).Order("created_at.asc").Limit(limit-len(claimed)).String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list data exports: %w", err)
+		}
+		var rows []models.DataExport
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("failed to parse data exports: %w", err)
+		}
+		for _, e := range rows {
+			claim := from("data_exports").Eq("id", e.ID).Eq("status", string(e.Status))
+			if e.StartedAt != nil {
+				claim = claim.Eq("started_at", e.StartedAt.UTC().Format(time.RFC3339Nano))
+			}
+			data, err := db.makeRequest("PATCH", claim.Select(supabaseDataExportColumns).String(), map[string]interface{}{
+				"status":     models.ExportProcessing,
+				"started_at": now,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to claim data export: %w", err)
+			}
+			var updated []models.DataExport
+			if err := json.Unmarshal(data, &updated); err != nil {
+				return nil, fmt.Errorf("failed to parse data export: %w", err)
+			}
+			claimed = append(claimed, updated...)
+		}
+	}
+	return claimed, nil
+}
+
+// CompleteDataExport 保存归档并标记为 ready
+func (db *SupabaseDatabase) CompleteDataExport(id string, archive []byte, expiresAt time.Time) error {
+	_, err := db.makeRequestWithHeaders("PATCH", from("data_exports").Eq("id", id).String(), map[string]interface{}{
+		"status":       models.ExportReady,
+		"archive":      `\x` + hex.EncodeToString(archive),
+		"size_bytes":   len(archive),
+		"error":        nil,
+		"completed_at": time.Now().UTC().Format(time.RFC3339),
+		"expires_at":   expiresAt.UTC().Format(time.RFC3339),
+	}, map[string]string{"Prefer": "return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to complete data export: %w", err)
+	}
+	return nil
+}
+
+// FailDataExport 标记为 failed 并记录原因
+func (db *SupabaseDatabase) FailDataExport(id, reason string) error {
+	_, err := db.makeRequestWithHeaders("PATCH", from("data_exports").Eq("id", id).String(), map[string]interface{}{
+		"status":       models.ExportFailed,
+		"error":        reason,
+		"completed_at": time.Now().UTC().Format(time.RFC3339),
+	}, map[string]string{"Prefer": "return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to mark data export failed: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredDataExports 清空过期归档
+func (db *SupabaseDatabase) PurgeExpiredDataExports(before time.Time) (int, error) {
+	endpoint := from("data_exports").
+		Eq("status", string(models.ExportReady)).
+		Lt("expires_at", before.UTC().Format(time.RFC3339)).
+		Select("id").
+		String()
+	data, err := db.makeRequest("PATCH", endpoint, map[string]interface{}{
+		"status":  models.ExportExpired,
+		"archive": nil,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge data exports: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return len(rows), nil
+}
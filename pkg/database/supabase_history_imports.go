@@ -0,0 +1,93 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// CreateHistoryImport 创建历史导入
+func (db *SupabaseDatabase) CreateHistoryImport(imp *models.HistoryImport) error {
+	data, err := db.makeRequest("POST", "/history_imports", map[string]interface{}{
+		"user_id":            imp.UserID,
+		"space_id":           imp.SpaceID,
+		"utc_offset_minutes": imp.UTCOffsetMinutes,
+		"total_entries":      imp.TotalEntries,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create history import: %w", err)
+	}
+	var row struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	if err := decodeFirstRow(data, &row, "history import"); err != nil {
+		return err
+	}
+	imp.ID, imp.CreatedAt = row.ID, row.CreatedAt
+	imp.ReceivedBatches = []int{}
+	return nil
+}
+
+// GetHistoryImport 仅返回属于 userID 的导入，附带已记录的批次与计数合计
+func (db *SupabaseDatabase) GetHistoryImport(userID, id string) (*models.HistoryImport, error) {
+	data, err := db.makeRequest("GET", from("history_imports").Eq("id", id).Eq("user_id", userID).
+		Select("id,user_id,space_id,utc_offset_minutes,total_entries,completed_at,created_at").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history import: %w", err)
+	}
+	var imp models.HistoryImport
+	if err := decodeFirstRow(data, &imp, "history import"); err != nil {
+		return nil, err
+	}
+
+	data, err = db.makeRequest("GET", from("history_import_batches").Eq("import_id", id).
+		Select("batch_index,received,imported,duplicates,skipped,blocked").Order("batch_index.asc").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history import batches: %w", err)
+	}
+	var batches []models.HistoryImportBatch
+	if err := json.Unmarshal(data, &batches); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	imp.ReceivedBatches = make([]int, len(batches))
+	for i, b := range batches {
+		imp.ReceivedBatches[i] = b.Index
+		imp.Received += b.Received
+		imp.Imported += b.Imported
+		imp.Duplicates += b.Duplicates
+		imp.Skipped += b.Skipped
+		imp.Blocked += b.Blocked
+	}
+	return &imp, nil
+}
+
+// RecordHistoryImportBatch 记录批次结果；同一序号已记录时保留原结果
+func (db *SupabaseDatabase) RecordHistoryImportBatch(b *models.HistoryImportBatch) error {
+	_, err := db.makeRequestWithHeaders("POST", "/history_import_batches?on_conflict=import_id,batch_index", map[string]interface{}{
+		"import_id":   b.ImportID,
+		"batch_index": b.Index,
+		"received":    b.Received,
+		"imported":    b.Imported,
+		"duplicates":  b.Duplicates,
+		"skipped":     b.Skipped,
+		"blocked":     b.Blocked,
+	}, map[string]string{"Prefer": "resolution=ignore-duplicates,return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to record history import batch: %w", err)
+	}
+	return nil
+}
+
+// CompleteHistoryImport 标记导入完成（重复调用保留首次完成时间）
+func (db *SupabaseDatabase) CompleteHistoryImport(id string) error {
+	_, err := db.makeRequestWithHeaders("PATCH", from("history_imports").Eq("id", id).Is("completed_at", "null").String(),
+		map[string]interface{}{"completed_at": time.Now().UTC().Format(time.RFC3339)},
+		map[string]string{"Prefer": "return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to complete history import: %w", err)
+	}
+	return nil
+}
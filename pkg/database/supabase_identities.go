@@ -0,0 +1,117 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// GetUserIdentity 按 provider + provider_user_id 查找关联
+func (db *SupabaseDatabase) GetUserIdentity(provider, providerUserID string) (*models.UserIdentity, error) {
+	endpoint := from("user_identities").Eq("provider", provider).Eq("provider_user_id", providerUserID).Select("*").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+	var i models.UserIdentity
+	if err := decodeFirstRow(data, &i, "identity"); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// ListUserIdentities 返回用户的全部外部身份
+func (db *SupabaseDatabase) ListUserIdentities(userID string) ([]models.UserIdentity, error) {
+	data, err := db.makeRequest("GET", from("user_identities").Eq("user_id", userID).Select("*").Order("created_at.asc").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user identities: %w", err)
+	}
+	identities := []models.UserIdentity{}
+	if err := json.Unmarshal(data, &identities); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return identities, nil
+}
+
+// LinkUserIdentity 以 ignore-duplicates 插入：唯一约束冲突时返回空数组，再比较已有关联的用户
+func (db *SupabaseDatabase) LinkUserIdentity(identity *models.UserIdentity) error {
+	identity.Email = models.NormalizeEmail(identity.Email)
+	body := map[string]interface{}{
+		"user_id":          identity.UserID,
+		"provider":         identity.Provider,
+		"provider_user_id": identity.ProviderUserID,
+	}
+	if identity.Email != "" {
+		body["email"] = identity.Email
+	}
+	data, err := db.makeRequestWithHeaders("POST", "/user_identities?on_conflict=provider,provider_user_id", body,
+		map[string]string{"Prefer": "resolution=ignore-duplicates,return=representation"})
+	if err != nil {
+		return fmt.Errorf("failed to link user identity: %w", err)
+	}
+	var created models.UserIdentity
+	err = decodeFirstRow(data, &created, "identity")
+	if err == nil {
+		*identity = created
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	existing, err := db.GetUserIdentity(identity.Provider, identity.ProviderUserID)
+	if err != nil {
+		return err
+	}
+	if existing.UserID != identity.UserID {
+		return ErrIdentityLinked
+	}
+	*identity = *existing
+	return nil
+}
+
+// GetTokenVersion 返回用户当前的令牌版本（由 init_db.sql 中的触发器维护）
+func (db *SupabaseDatabase) GetTokenVersion(userID string) (int, error) {
+	data, err := db.makeRequest("GET", from("users").Eq("id", userID).Select("token_version").String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token version: %w", err)
+	}
+	var row struct {
+		TokenVersion int `json:"token_version"`
+	}
+	if err := decodeFirstRow(data, &row, "user"); err != nil {
+		return 0, err
+	}
+	return row.TokenVersion, nil
+}
+
+// RevokeUserSessions 记录会话吊销时间：此前签发的刷新令牌失效，触发器同时递增令牌版本
+func (db *SupabaseDatabase) RevokeUserSessions(userID string) error {
+	data, err := db.makeRequestWithHeaders("PATCH", from("users").Eq("id", userID).Select("id").String(),
+		map[string]interface{}{"sessions_revoked_at": time.Now().UTC().Format(time.RFC3339Nano)},
+		map[string]string{"Prefer": "return=representation"})
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	var row struct {
+		ID string `json:"id"`
+	}
+	return decodeFirstRow(data, &row, "user")
+}
+
+// GetSessionsRevokedAt 返回最近一次会话吊销时间；从未吊销时为 nil
+func (db *SupabaseDatabase) GetSessionsRevokedAt(userID string) (*time.Time, error) {
+	data, err := db.makeRequest("GET", from("users").Eq("id", userID).Select("sessions_revoked_at").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions revoked time: %w", err)
+	}
+	var row struct {
+		SessionsRevokedAt *time.Time `json:"sessions_revoked_at"`
+	}
+	if err := decodeFirstRow(data, &row, "user"); err != nil {
+		return nil, err
+	}
+	return row.SessionsRevokedAt, nil
+}
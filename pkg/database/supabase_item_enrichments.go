@@ -0,0 +1,78 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+const supabaseItemEnrichmentColumns = "item_id,attempts,claimed_at,created_at"
+
+// EnqueueItemEnrichment 将条目加入元数据补全队列；已在队列中时不重复加入
+func (db *SupabaseDatabase) EnqueueItemEnrichment(itemID string) error {
+	_, err := db.makeRequestWithHeaders("POST", "/item_enrichments?on_conflict=item_id",
+		map[string]interface{}{"item_id": itemID},
+		map[string]string{"Prefer": "resolution=ignore-duplicates,return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue item enrichment: %w", err)
+	}
+	return nil
+}
+
+// ClaimItemEnrichments 逐条以 claimed_at 为条件 PATCH 认领（无事务时的乐观锁），被并发任务抢先的条目会被跳过
+func (db *SupabaseDatabase) ClaimItemEnrichments(limit int, staleBefore time.Time) ([]models.ItemEnrichment, error) {
+	candidates := []*restQuery{
+		from("item_enrichments").Is("claimed_at", "null"),
+		from("item_enrichments").Lt("claimed_at", staleBefore.UTC().Format(time.RFC3339)),
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	claimed := []models.ItemEnrichment{}
+	for _, q := range candidates {
+		if len(claimed) >= limit {
+			break
+		}
+		data, err := db.makeRequest("GET", q.Select(supabaseItemEnrichmentColumns).Order("created_at.asc").Limit(limit-len(claimed)).String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list item enrichments: %w", err)
+		}
+		var rows []models.ItemEnrichment
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("failed to parse item enrichments: %w", err)
+		}
+		for _, e := range rows {
+			claim := from("item_enrichments").Eq("item_id", e.ItemID).Eq("attempts", strconv.Itoa(e.Attempts))
+			if e.ClaimedAt != nil {
+				claim = claim.Eq("claimed_at", e.ClaimedAt.UTC().Format(time.RFC3339Nano))
+			} else {
+				claim = claim.Is("claimed_at", "null")
+			}
+			data, err := db.makeRequest("PATCH", claim.Select(supabaseItemEnrichmentColumns).String(), map[string]interface{}{
+				"claimed_at": now,
+				"attempts":   e.Attempts + 1,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to claim item enrichment: %w", err)
+			}
+			var updated []models.ItemEnrichment
+			if err := json.Unmarshal(data, &updated); err != nil {
+				return nil, fmt.Errorf("failed to parse item enrichment: %w", err)
+			}
+			claimed = append(claimed, updated...)
+		}
+	}
+	return claimed, nil
+}
+
+// DeleteItemEnrichment 将条目移出队列（补全完成或放弃）
+func (db *SupabaseDatabase) DeleteItemEnrichment(itemID string) error {
+	_, err := db.makeRequestWithHeaders("DELETE", from("item_enrichments").Eq("item_id", itemID).String(), nil,
+		map[string]string{"Prefer": "return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to delete item enrichment: %w", err)
+	}
+	return nil
+}
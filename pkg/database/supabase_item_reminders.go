@@ -0,0 +1,90 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+const supabaseItemReminderColumns = "item_id,user_id,remind_at,email,notified_at,created_at"
+
+// SetItemReminder 设置（覆盖）用户在条目上的提醒；重新设置会清除 notified_at，使提醒再次触发
+func (db *SupabaseDatabase) SetItemReminder(rem *models.ItemReminder) error {
+	data, err := db.makeRequestWithHeaders("POST", "/item_reminders?on_conflict=item_id,user_id&select="+supabaseItemReminderColumns,
+		map[string]interface{}{
+			"item_id":     rem.ItemID,
+			"user_id":     rem.UserID,
+			"remind_at":   rem.RemindAt.UTC().Format(time.RFC3339),
+			"email":       rem.Email,
+			"notified_at": nil,
+		}, map[string]string{"Prefer": "resolution=merge-duplicates,return=representation"})
+	if err != nil {
+		return fmt.Errorf("failed to set item reminder: %w", err)
+	}
+	var saved models.ItemReminder
+	if err := decodeFirstRow(data, &saved, "item reminder"); err != nil {
+		return fmt.Errorf("failed to parse item reminder: %w", err)
+	}
+	*rem = saved
+	return nil
+}
+
+// DeleteItemReminder 清除提醒；不存在时返回 not found
+func (db *SupabaseDatabase) DeleteItemReminder(userID, itemID string) error {
+	data, err := db.makeRequest("DELETE", from("item_reminders").Eq("item_id", itemID).Eq("user_id", userID).Select("item_id").String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete item reminder: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(rows) == 0 {
+		return notFound("item reminder")
+	}
+	return nil
+}
+
+// ListItemReminders 按 remind_at 升序返回用户的全部提醒
+func (db *SupabaseDatabase) ListItemReminders(userID string) ([]models.ItemReminder, error) {
+	data, err := db.paginate(from("item_reminders").Eq("user_id", userID).Select(supabaseItemReminderColumns).Order("remind_at.asc").String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list item reminders: %w", err)
+	}
+	reminders := []models.ItemReminder{}
+	if err := json.Unmarshal(data, &reminders); err != nil {
+		return nil, fmt.Errorf("failed to parse item reminders: %w", err)
+	}
+	return reminders, nil
+}
+
+// ClaimDueItemReminders 逐条以 notified_at 为空为条件 PATCH 认领（无事务时的乐观锁），被并发任务抢先的提醒会被跳过
+func (db *SupabaseDatabase) ClaimDueItemReminders(now time.Time, limit int) ([]models.ItemReminder, error) {
+	stamp := now.UTC().Format(time.RFC3339)
+	data, err := db.makeRequest("GET", from("item_reminders").Is("notified_at", "null").Lte("remind_at", stamp).
+		Select(supabaseItemReminderColumns).Order("remind_at.asc").Limit(limit).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due item reminders: %w", err)
+	}
+	var due []models.ItemReminder
+	if err := json.Unmarshal(data, &due); err != nil {
+		return nil, fmt.Errorf("failed to parse item reminders: %w", err)
+	}
+
+	claimed := []models.ItemReminder{}
+	for _, rem := range due {
+		data, err := db.makeRequest("PATCH", from("item_reminders").Eq("item_id", rem.ItemID).Eq("user_id", rem.UserID).Is("notified_at", "null").
+			Select(supabaseItemReminderColumns).String(), map[string]interface{}{"notified_at": stamp})
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim item reminder: %w", err)
+		}
+		var updated []models.ItemReminder
+		if err := json.Unmarshal(data, &updated); err != nil {
+			return nil, fmt.Errorf("failed to parse item reminder: %w", err)
+		}
+		claimed = append(claimed, updated...)
+	}
+	return claimed, nil
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// ListItemRevisions 按时间倒序返回条目的历史版本（由 collection_items 上的触发器写入）
+func (db *SupabaseDatabase) ListItemRevisions(itemID string, limit int) ([]models.ItemRevision, error) {
+	endpoint := from("item_revisions").Eq("item_id", itemID).
+		Order("created_at.desc,id.desc").Limit(limit).Select("*").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list item revisions: %w", err)
+	}
+	revisions := []models.ItemRevision{}
+	if err := json.Unmarshal(data, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// GetItemRevision 返回属于 itemID 的一个历史版本
+func (db *SupabaseDatabase) GetItemRevision(itemID, revisionID string) (*models.ItemRevision, error) {
+	data, err := db.makeRequest("GET", from("item_revisions").Eq("id", revisionID).Eq("item_id", itemID).Select("*").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item revision: %w", err)
+	}
+	var rev models.ItemRevision
+	if err := decodeFirstRow(data, &rev, "item revision"); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// RecordLoginEvent 记录一次成功登录
+func (db *SupabaseDatabase) RecordLoginEvent(e *models.LoginEvent) error {
+	data, err := db.makeRequestWithHeaders("POST", "/login_events", map[string]interface{}{
+		"user_id":    e.UserID,
+		"method":     e.Method,
+		"ip":         e.IP,
+		"user_agent": e.UserAgent,
+		"country":    e.Country,
+		"region":     e.Region,
+		"city":       e.City,
+	}, map[string]string{"Prefer": "return=representation"})
+	if err != nil {
+		return fmt.Errorf("failed to record login event: %w", err)
+	}
+	return decodeFirstRow(data, e, "login event")
+}
+
+// ListLoginEvents 按时间倒序返回用户最近的 limit 条登录记录
+func (db *SupabaseDatabase) ListLoginEvents(userID string, limit int) ([]models.LoginEvent, error) {
+	data, err := db.makeRequest("GET", from("login_events").Eq("user_id", userID).Select("*").
+		Order("created_at.desc").Limit(limit).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login events: %w", err)
+	}
+	events := []models.LoginEvent{}
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// CreateNotification 写入通知；DedupeKey 已存在时不重复写入（n.ID 保持为空）
+func (db *SupabaseDatabase) CreateNotification(n *models.Notification) error {
+	payload := map[string]interface{}{
+		"user_id":    n.UserID,
+		"kind":       n.Kind,
+		"title":      n.Title,
+		"body":       n.Body,
+		"data":       notificationData(n),
+		"dedupe_key": n.DedupeKey,
+	}
+	endpoint := "/notifications"
+	headers := map[string]string{}
+	if n.DedupeKey != nil {
+		endpoint += "?on_conflict=user_id,dedupe_key"
+		headers["Prefer"] = "resolution=ignore-duplicates,return=representation"
+	}
+	data, err := db.makeRequestWithHeaders("POST", endpoint, payload, headers)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	var rows []models.Notification
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("failed to parse notification: %w", err)
+	}
+	if len(rows) > 0 {
+		n.ID = rows[0].ID
+		n.CreatedAt = rows[0].CreatedAt
+	}
+	return nil
+}
+
+// ListNotifications 按时间倒序分页返回通知及总数（Range + count=exact）
+func (db *SupabaseDatabase) ListNotifications(userID string, unreadOnly bool, limit, offset int) ([]models.Notification, int, error) {
+	q := from("notifications").Eq("user_id", userID)
+	if unreadOnly {
+		q = q.Is("read_at", "null")
+	}
+	endpoint := q.Select("id,user_id,kind,title,body,data,read_at,created_at").Order("created_at.desc").String()
+	data, header, err := db.doRequest("GET", endpoint, nil, map[string]string{
+		"Range-Unit": "items",
+		"Range":      fmt.Sprintf("%d-%d", offset, offset+limit-1),
+		"Prefer":     "count=exact",
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	list := []models.Notification{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse notifications: %w", err)
+	}
+	total, ok := parseContentRangeTotal(header.Get("Content-Range"))
+	if !ok {
+		total = offset + len(list)
+	}
+	return list, total, nil
+}
+
+// CountUnreadNotifications 未读通知数（扩展角标）
+func (db *SupabaseDatabase) CountUnreadNotifications(userID string) (int, error) {
+	endpoint := from("notifications").Eq("user_id", userID).Is("read_at", "null").Select("id").String()
+	_, header, err := db.doRequest("GET", endpoint, nil, map[string]string{
+		"Range-Unit": "items",
+		"Range":      "0-0",
+		"Prefer":     "count=exact",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	total, ok := parseContentRangeTotal(header.Get("Content-Range"))
+	if !ok {
+		return 0, fmt.Errorf("failed to count unread notifications: missing Content-Range")
+	}
+	return total, nil
+}
+
+// MarkNotificationsRead 将指定通知（ids 为空时为全部）标记为已读，返回更新条数
+func (db *SupabaseDatabase) MarkNotificationsRead(userID string, ids []string) (int, error) {
+	q := from("notifications").Eq("user_id", userID).Is("read_at", "null")
+	if len(ids) > 0 {
+		q = q.In("id", ids)
+	}
+	data, err := db.makeRequest("PATCH", q.Select("id").String(), map[string]interface{}{
+		"read_at": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// GetOrganizationBySlug 按 slug 查找组织
+func (db *SupabaseDatabase) GetOrganizationBySlug(slug string) (*models.Organization, error) {
+	data, err := db.makeRequest("GET", from("organizations").Eq("slug", strings.ToLower(slug)).Select("*").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization by slug: %w", err)
+	}
+	var rows []models.Organization
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, notFound("organization")
+	}
+	return &rows[0], nil
+}
+
+// SetOrganizationSlug PATCH slug；唯一索引冲突时 PostgREST 返回 409（code 23505）
+func (db *SupabaseDatabase) SetOrganizationSlug(orgID, slug string) error {
+	data, err := db.makeRequest("PATCH", from("organizations").Eq("id", orgID).Select("id").String(), map[string]interface{}{
+		"slug":       strings.ToLower(slug),
+		"updated_at": time.Now().UTC().Format(time.RFC3339),
+	})
+	if isUniqueViolation(err) {
+		return ErrSlugTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set organization slug: %w", err)
+	}
+	var updated struct {
+		ID string `json:"id"`
+	}
+	return decodeFirstRow(data, &updated, "organization")
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// SaveOrgSnapshot 以 merge-duplicates 按 (organization_id, name) 插入或覆盖；已存在时不改写 created_by
+func (db *SupabaseDatabase) SaveOrgSnapshot(orgID, userID, name string, tabGroups []models.TabGroup) error {
+	tabCount := 0
+	for _, group := range tabGroups {
+		tabCount += len(group.Tabs)
+	}
+	tabGroupsJSON, err := encodeTabGroups(tabGroups, db.compressSnapshots)
+	if err != nil {
+		return err
+	}
+	snapshot := map[string]interface{}{
+		"tab_groups":  tabGroupsJSON,
+		"group_count": len(tabGroups),
+		"tab_count":   tabCount,
+		"updated_by":  userID,
+		"updated_at":  time.Now().UTC().Format(time.RFC3339),
+	}
+
+	endpoint := from("org_snapshots").Eq("organization_id", orgID).Eq("name", name).Select("name").String()
+	data, err := db.makeRequest("PATCH", endpoint, snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to update org snapshot: %w", err)
+	}
+	var updated []json.RawMessage
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(updated) > 0 {
+		return nil
+	}
+
+	snapshot["organization_id"] = orgID
+	snapshot["name"] = name
+	snapshot["created_by"] = userID
+	if _, err := db.makeRequest("POST", "/org_snapshots", snapshot); err != nil {
+		return fmt.Errorf("failed to create org snapshot: %w", err)
+	}
+	return nil
+}
+
+// ListOrgSnapshots 按 updated_at 倒序列出组织共享快照
+func (db *SupabaseDatabase) ListOrgSnapshots(orgID string) ([]SnapshotInfo, error) {
+	endpoint := from("org_snapshots").Eq("organization_id", orgID).
+		Select("name,created_by,created_at,updated_at,group_count,tab_count").Order("updated_at.desc").String()
+	respBody, err := db.paginate(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query org snapshots: %w", err)
+	}
+	var rows []struct {
+		Name       string    `json:"name"`
+		CreatedBy  *string   `json:"created_by"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+		GroupCount int       `json:"group_count"`
+		TabCount   int       `json:"tab_count"`
+	}
+	if err := json.Unmarshal(respBody, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse org snapshots response: %w", err)
+	}
+	snapshots := make([]SnapshotInfo, 0, len(rows))
+	for _, row := range rows {
+		createdBy := ""
+		if row.CreatedBy != nil {
+			createdBy = *row.CreatedBy
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			Name:       row.Name,
+			Kind:       models.SnapshotKindManual,
+			CreatedBy:  createdBy,
+			CreatedAt:  row.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:  row.UpdatedAt.Format(time.RFC3339),
+			GroupCount: row.GroupCount,
+			TabCount:   row.TabCount,
+		})
+	}
+	return snapshots, nil
+}
+
+// LoadOrgSnapshotRaw 加载组织共享快照，tab_groups 保持 PostgREST 返回的 JSON 原文
+func (db *SupabaseDatabase) LoadOrgSnapshotRaw(orgID, name string) (*RawSnapshot, error) {
+	endpoint := from("org_snapshots").Eq("organization_id", orgID).Eq("name", name).
+		Select("name,tab_groups,created_at,updated_at").String()
+	respBody, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query org snapshot: %w", err)
+	}
+	var row struct {
+		Name      string          `json:"name"`
+		TabGroups json.RawMessage `json:"tab_groups"`
+		CreatedAt time.Time       `json:"created_at"`
+		UpdatedAt time.Time       `json:"updated_at"`
+	}
+	if err := decodeFirstRow(respBody, &row, "snapshot"); err != nil {
+		return nil, err
+	}
+	tabGroups, err := decodeTabGroups(row.TabGroups)
+	if err != nil {
+		return nil, err
+	}
+	return &RawSnapshot{Name: row.Name, TabGroups: tabGroups, CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt}, nil
+}
+
+// DeleteOrgSnapshot 删除组织共享快照
+func (db *SupabaseDatabase) DeleteOrgSnapshot(orgID, name string) error {
+	endpoint := from("org_snapshots").Eq("organization_id", orgID).Eq("name", name).Select("name").String()
+	data, err := db.makeRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete org snapshot: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(rows) == 0 {
+		return notFound("snapshot")
+	}
+	return nil
+}
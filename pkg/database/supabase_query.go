@@ -0,0 +1,124 @@
+package database
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// restQuery 构造 PostgREST 查询路径，所有过滤值都会进行 URL 编码，
+// 避免 "a+b@example.com" 这类值被误解析或被注入额外的过滤条件。
+type restQuery struct {
+	table  string
+	params [][2]string
+}
+
+// from 以表名开始构造查询
+func from(table string) *restQuery {
+	return &restQuery{table: table}
+}
+
+// Eq 添加 column=eq.value 过滤
+func (q *restQuery) Eq(column, value string) *restQuery {
+	return q.filter(column, "eq", value)
+}
+
+// Neq 添加 column=neq.value 过滤
+func (q *restQuery) Neq(column, value string) *restQuery {
+	return q.filter(column, "neq", value)
+}
+
+// Ilike 添加 column=ilike.pattern 过滤；精确匹配时 pattern 应先经 likeLiteral 转义
+func (q *restQuery) Ilike(column, pattern string) *restQuery {
+	return q.filter(column, "ilike", pattern)
+}
+
+// Is 添加 column=is.value 过滤（null/true/false）
+func (q *restQuery) Is(column, value string) *restQuery {
+	return q.filter(column, "is", value)
+}
+
+// IsNot 添加 column=not.is.value 过滤
+func (q *restQuery) IsNot(column, value string) *restQuery {
+	return q.filter(column, "not.is", value)
+}
+
+// Lt 添加 column=lt.value 过滤
+func (q *restQuery) Lt(column, value string) *restQuery {
+	return q.filter(column, "lt", value)
+}
+
+// Lte 添加 column=lte.value 过滤
+func (q *restQuery) Lte(column, value string) *restQuery {
+	return q.filter(column, "lte", value)
+}
+
+// Gt 添加 column=gt.value 过滤
+func (q *restQuery) Gt(column, value string) *restQuery {
+	return q.filter(column, "gt", value)
+}
+
+// In 添加 column=in.(v1,v2) 过滤，值以双引号包裹以容纳逗号等保留字符
+func (q *restQuery) In(column string, values []string) *restQuery {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quoteFilterValue(v)
+	}
+	return q.filter(column, "in", "("+strings.Join(quoted, ",")+")")
+}
+
+// Or 添加 or=(c1,c2) 过滤；条件形如 "column.op.value"，值应以 quoteFilterValue 包裹
+func (q *restQuery) Or(conditions ...string) *restQuery {
+	q.params = append(q.params, [2]string{"or", "(" + strings.Join(conditions, ",") + ")"})
+	return q
+}
+
+// quoteFilterValue 以双引号包裹过滤值（转义反斜杠与双引号）
+func quoteFilterValue(v string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(v, `\`, `\\`), `"`, `\"`) + `"`
+}
+
+// likeLiteral 转义 LIKE 通配符，使 ilike 退化为不区分大小写的精确匹配
+func likeLiteral(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(v)
+}
+
+func (q *restQuery) filter(column, op, value string) *restQuery {
+	q.params = append(q.params, [2]string{column, op + "." + value})
+	return q
+}
+
+// Select 指定返回列
+func (q *restQuery) Select(columns string) *restQuery {
+	q.params = append(q.params, [2]string{"select", columns})
+	return q
+}
+
+// Order 指定排序，如 "updated_at.desc"
+func (q *restQuery) Order(order string) *restQuery {
+	q.params = append(q.params, [2]string{"order", order})
+	return q
+}
+
+// Limit 限制返回行数
+func (q *restQuery) Limit(n int) *restQuery {
+	q.params = append(q.params, [2]string{"limit", strconv.Itoa(n)})
+	return q
+}
+
+// String 返回编码后的 endpoint（不含 /rest/v1 前缀）
+func (q *restQuery) String() string {
+	if len(q.params) == 0 {
+		return "/" + q.table
+	}
+	parts := make([]string, 0, len(q.params))
+	for _, p := range q.params {
+		parts = append(parts, escapeQueryComponent(p[0])+"="+escapeQueryComponent(p[1]))
+	}
+	return "/" + q.table + "?" + strings.Join(parts, "&")
+}
+
+// escapeQueryComponent 与 url.QueryEscape 相同，但空格编码为 %20 而非 "+"
+func escapeQueryComponent(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
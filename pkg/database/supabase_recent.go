@@ -0,0 +1,52 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// ListRecentItems spaceIDs 内最近加入的未归档条目与最近删除的条目，各取 limit 条。
+// PostgREST 无法合并两个排序不同的结果，分两次请求
+func (db *SupabaseDatabase) ListRecentItems(spaceIDs []string, limit int) (added, deleted []models.RecentItem, err error) {
+	added, deleted = []models.RecentItem{}, []models.RecentItem{}
+	if len(spaceIDs) == 0 {
+		return added, deleted, nil
+	}
+	scope := func() *restQuery {
+		return from("collection_items").
+			In("collections.space_id", spaceIDs).
+			Select("*,collections!inner(name,space_id)")
+	}
+	if added, err = db.recentItems(scope().Is("deleted_at", "null").Is("archived_at", "null").
+		Is("collections.deleted_at", "null").Order("created_at.desc").Limit(limit)); err != nil {
+		return nil, nil, fmt.Errorf("failed to list recently added items: %w", err)
+	}
+	if deleted, err = db.recentItems(scope().IsNot("deleted_at", "null").Order("deleted_at.desc").Limit(limit)); err != nil {
+		return nil, nil, fmt.Errorf("failed to list recently deleted items: %w", err)
+	}
+	return added, deleted, nil
+}
+
+func (db *SupabaseDatabase) recentItems(q *restQuery) ([]models.RecentItem, error) {
+	data, err := db.makeRequest("GET", q.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		models.CollectionItem
+		Collections struct {
+			Name    string `json:"name"`
+			SpaceID string `json:"space_id"`
+		} `json:"collections"`
+	}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	items := make([]models.RecentItem, len(rows))
+	for i, row := range rows {
+		items[i] = models.RecentItem{CollectionItem: row.CollectionItem, CollectionName: row.Collections.Name, SpaceID: row.Collections.SpaceID}
+	}
+	return items, nil
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsRetryableStatus(t *testing.T) {
+	tests := []struct {
+		method string
+		status int
+		want   bool
+	}{
+		{"GET", 429, true},
+		{"GET", 500, true},
+		{"GET", 503, true},
+		{"DELETE", 502, true},
+		{"PUT", 504, true},
+		{"GET", 404, false},
+		{"POST", 429, true},
+		{"POST", 500, false},
+		{"POST", 503, false},
+		{"PATCH", 429, true},
+		{"PATCH", 500, false},
+		{"PATCH", 503, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryableStatus(tt.method, tt.status); got != tt.want {
+			t.Errorf("isRetryableStatus(%s, %d) = %v, want %v", tt.method, tt.status, got, tt.want)
+		}
+	}
+}
+
+// countingServer 始终以 status 响应（Retry-After: 0 使重试不等待），返回收到的请求数
+func countingServer(t *testing.T, status int) (*SupabaseDatabase, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return NewSupabaseDatabase(srv.URL, "key").(*SupabaseDatabase), &calls
+}
+
+func TestSupabaseRetryByStatus(t *testing.T) {
+	tests := []struct {
+		method string
+		status int
+		want   int32
+	}{
+		{"GET", 503, supabaseMaxAttempts},
+		{"DELETE", 500, supabaseMaxAttempts},
+		{"POST", 429, supabaseMaxAttempts},
+		{"POST", 500, 1},
+		{"POST", 503, 1},
+		{"PATCH", 503, 1},
+	}
+	for _, tt := range tests {
+		db, calls := countingServer(t, tt.status)
+		if _, err := db.makeRequest(tt.method, "/items", map[string]string{"a": "b"}); err == nil {
+			t.Errorf("%s %d: expected error", tt.method, tt.status)
+		}
+		if got := calls.Load(); got != tt.want {
+			t.Errorf("%s %d: %d attempts, want %d", tt.method, tt.status, got, tt.want)
+		}
+	}
+}
+
+// failingTransport 不访问网络，按 wroteHeaders 模拟请求发出前/后的连接错误
+type failingTransport struct {
+	wroteHeaders bool
+	calls        atomic.Int32
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls.Add(1)
+	if trace := httptrace.ContextClientTrace(req.Context()); f.wroteHeaders && trace != nil && trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+	return nil, errors.New("connection reset")
+}
+
+func TestSupabaseRetryOnConnectionError(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		wroteHeaders bool
+		want         int32
+	}{
+		{"POST before sending", "POST", false, supabaseMaxAttempts},
+		{"POST after sending", "POST", true, 1},
+		{"PATCH after sending", "PATCH", true, 1},
+		{"GET after sending", "GET", true, supabaseMaxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &failingTransport{wroteHeaders: tt.wroteHeaders}
+			db := NewSupabaseDatabase("http://supabase.test", "key").(*SupabaseDatabase)
+			db.httpClient = &http.Client{Transport: transport}
+			_, err := db.makeRequest(tt.method, "/items", map[string]string{"a": "b"})
+			if !errors.Is(err, ErrUnavailable) {
+				t.Errorf("err = %v, want ErrUnavailable", err)
+			}
+			if got := transport.calls.Load(); got != tt.want {
+				t.Errorf("%d attempts, want %d", got, tt.want)
+			}
+		})
+	}
+}
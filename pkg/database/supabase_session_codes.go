@@ -0,0 +1,29 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ConsumeSessionCode 以 ignore-duplicates 插入：主键冲突时 PostgREST 返回空数组，即为重放
+func (db *SupabaseDatabase) ConsumeSessionCode(jti, userID string, expiresAt time.Time) (bool, error) {
+	data, err := db.makeRequestWithHeaders("POST", "/consumed_session_codes?on_conflict=jti", map[string]interface{}{
+		"jti":        jti,
+		"user_id":    userID,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	}, map[string]string{"Prefer": "resolution=ignore-duplicates,return=representation"})
+	if err != nil {
+		return false, fmt.Errorf("failed to consume session code: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return false, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	endpoint := from("consumed_session_codes").Lt("expires_at", time.Now().UTC().Format(time.RFC3339)).String()
+	if _, err := db.makeRequestWithHeaders("DELETE", endpoint, nil, map[string]string{"Prefer": "return=minimal"}); err != nil {
+		fmt.Printf("⚠️  Failed to purge consumed session codes: %v\n", err)
+	}
+	return len(rows) == 1, nil
+}
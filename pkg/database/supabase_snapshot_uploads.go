@@ -0,0 +1,141 @@
+package database
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// CreateSnapshotUpload 创建分块上传
+func (db *SupabaseDatabase) CreateSnapshotUpload(u *models.SnapshotUpload) error {
+	body := map[string]interface{}{
+		"user_id":     u.UserID,
+		"name":        u.Name,
+		"kind":        u.Kind,
+		"total_bytes": u.TotalBytes,
+		"expires_at":  u.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if u.OrganizationID != "" {
+		body["organization_id"] = u.OrganizationID
+	}
+	data, err := db.makeRequest("POST", "/snapshot_uploads", body)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot upload: %w", err)
+	}
+	var row struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	if err := decodeFirstRow(data, &row, "snapshot upload"); err != nil {
+		return err
+	}
+	u.ID, u.CreatedAt = row.ID, row.CreatedAt
+	u.ReceivedChunks = []int{}
+	return nil
+}
+
+// GetSnapshotUpload 仅返回属于 userID 且未过期的上传，附带已收到的分块
+func (db *SupabaseDatabase) GetSnapshotUpload(userID, id string) (*models.SnapshotUpload, error) {
+	endpoint := from("snapshot_uploads").Eq("id", id).Eq("user_id", userID).
+		Gt("expires_at", time.Now().UTC().Format(time.RFC3339)).
+		Select("id,user_id,organization_id,name,kind,total_bytes,expires_at,created_at").String()
+	data, err := db.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot upload: %w", err)
+	}
+	var row struct {
+		models.SnapshotUpload
+		OrganizationID *string `json:"organization_id"`
+	}
+	if err := decodeFirstRow(data, &row, "snapshot upload"); err != nil {
+		return nil, err
+	}
+	u := row.SnapshotUpload
+	if row.OrganizationID != nil {
+		u.OrganizationID = *row.OrganizationID
+	}
+
+	data, err = db.makeRequest("GET", from("snapshot_upload_chunks").Eq("upload_id", id).
+		Select("chunk_index,size_bytes").Order("chunk_index.asc").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot upload chunks: %w", err)
+	}
+	var chunks []struct {
+		Index int   `json:"chunk_index"`
+		Size  int64 `json:"size_bytes"`
+	}
+	if err := json.Unmarshal(data, &chunks); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	u.ReceivedChunks = make([]int, len(chunks))
+	for i, c := range chunks {
+		u.ReceivedChunks[i] = c.Index
+		u.ReceivedBytes += c.Size
+	}
+	return &u, nil
+}
+
+// PutSnapshotUploadChunk 写入（覆盖）一个分块（PostgREST 以 "\x" 开头的十六进制字符串表示 bytea）
+func (db *SupabaseDatabase) PutSnapshotUploadChunk(uploadID string, index int, data []byte) error {
+	_, err := db.makeRequestWithHeaders("POST", "/snapshot_upload_chunks?on_conflict=upload_id,chunk_index", map[string]interface{}{
+		"upload_id":   uploadID,
+		"chunk_index": index,
+		"data":        `\x` + hex.EncodeToString(data),
+		"size_bytes":  len(data),
+		"created_at":  time.Now().UTC().Format(time.RFC3339),
+	}, map[string]string{"Prefer": "resolution=merge-duplicates,return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot upload chunk: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshotUploadChunks 按序号升序返回全部分块内容
+func (db *SupabaseDatabase) LoadSnapshotUploadChunks(uploadID string) ([][]byte, error) {
+	data, err := db.makeRequest("GET", from("snapshot_upload_chunks").Eq("upload_id", uploadID).
+		Select("data").Order("chunk_index.asc").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot upload chunks: %w", err)
+	}
+	var rows []struct {
+		Data string `json:"data"`
+	}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	chunks := make([][]byte, len(rows))
+	for i, row := range rows {
+		if chunks[i], err = hex.DecodeString(strings.TrimPrefix(row.Data, `\x`)); err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot upload chunk: %w", err)
+		}
+	}
+	return chunks, nil
+}
+
+// DeleteSnapshotUpload 删除上传及其分块（分块随外键级联删除）
+func (db *SupabaseDatabase) DeleteSnapshotUpload(id string) error {
+	_, err := db.makeRequestWithHeaders("DELETE", from("snapshot_uploads").Eq("id", id).String(), nil,
+		map[string]string{"Prefer": "return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot upload: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredSnapshotUploads 删除 expires_at 早于 before 的上传，返回条数
+func (db *SupabaseDatabase) PurgeExpiredSnapshotUploads(before time.Time) (int, error) {
+	data, err := db.makeRequest("DELETE", from("snapshot_uploads").
+		Lt("expires_at", before.UTC().Format(time.RFC3339)).Select("id").String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge snapshot uploads: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// DeleteSpacePermission 删除显式权限
+func (db *SupabaseDatabase) DeleteSpacePermission(spaceID, userID string) error {
+	endpoint := from("space_permissions").Eq("space_id", spaceID).Eq("user_id", userID).String()
+	if _, err := db.makeRequestWithHeaders("DELETE", endpoint, nil, map[string]string{"Prefer": "return=minimal"}); err != nil {
+		return fmt.Errorf("failed to delete space permission: %w", err)
+	}
+	return nil
+}
+
+// CreateSpaceInvitation 写入访客邀请
+func (db *SupabaseDatabase) CreateSpaceInvitation(inv *models.SpaceInvitation) error {
+	inv.Email = models.NormalizeEmail(inv.Email)
+	data, err := db.makeRequest("POST", "/space_invitations", map[string]interface{}{
+		"organization_id": inv.OrganizationID,
+		"space_id":        inv.SpaceID,
+		"email":           inv.Email,
+		"inviter_id":      inv.InviterID,
+		"token":           hashToken(inv.Token),
+		"can_edit":        inv.CanEdit,
+		"status":          string(inv.Status),
+		"expires_at":      inv.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create space invitation: %w", err)
+	}
+	var created models.SpaceInvitation
+	if err := decodeFirstRow(data, &created, "invitation"); err != nil {
+		return err
+	}
+	inv.ID, inv.CreatedAt, inv.UpdatedAt = created.ID, created.CreatedAt, created.UpdatedAt
+	return nil
+}
+
+// spaceInvitationSelect token 列只存摘要（见 hashToken），不读出
+const spaceInvitationSelect = "id,organization_id,space_id,email,inviter_id,can_edit,status,expires_at,accepted_by,created_at,updated_at"
+
+// GetSpaceInvitationByToken 按 token 摘要查找访客邀请
+func (db *SupabaseDatabase) GetSpaceInvitationByToken(token string) (*models.SpaceInvitation, error) {
+	return db.getSpaceInvitation(from("space_invitations").Eq("token", hashToken(token)))
+}
+
+// GetSpaceInvitationByID 按 ID 查找访客邀请（应用内接受）
+func (db *SupabaseDatabase) GetSpaceInvitationByID(id string) (*models.SpaceInvitation, error) {
+	return db.getSpaceInvitation(from("space_invitations").Eq("id", id))
+}
+
+func (db *SupabaseDatabase) getSpaceInvitation(q *restQuery) (*models.SpaceInvitation, error) {
+	data, err := db.makeRequest("GET", q.Select(spaceInvitationSelect).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get space invitation: %w", err)
+	}
+	var inv models.SpaceInvitation
+	if err := decodeFirstRow(data, &inv, "invitation"); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// UpdateSpaceInvitation 更新状态与接受者
+func (db *SupabaseDatabase) UpdateSpaceInvitation(inv *models.SpaceInvitation) error {
+	_, err := db.makeRequest("PATCH", from("space_invitations").Eq("id", inv.ID).String(), map[string]interface{}{
+		"status":      string(inv.Status),
+		"accepted_by": inv.AcceptedBy,
+		"updated_at":  time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update space invitation: %w", err)
+	}
+	return nil
+}
+
+// AddSpaceGuest 先写显式权限再写访客记录：中途失败时只会留下无效的显式权限，不会出现没有权限的访客
+func (db *SupabaseDatabase) AddSpaceGuest(spaceID, userID, invitationID string, canEdit bool) error {
+	if err := db.SetSpacePermission(spaceID, userID, canEdit); err != nil {
+		return fmt.Errorf("failed to add space guest: %w", err)
+	}
+	payload := map[string]interface{}{"space_id": spaceID, "user_id": userID, "invitation_id": nil}
+	if invitationID != "" {
+		payload["invitation_id"] = invitationID
+	}
+	_, err := db.makeRequestWithHeaders("POST", "/space_guests?on_conflict=space_id,user_id", payload,
+		map[string]string{"Prefer": "resolution=merge-duplicates,return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to add space guest: %w", err)
+	}
+	return nil
+}
+
+// RemoveSpaceGuest 先删访客记录再删显式权限
+func (db *SupabaseDatabase) RemoveSpaceGuest(spaceID, userID string) error {
+	endpoint := from("space_guests").Eq("space_id", spaceID).Eq("user_id", userID).String()
+	if _, err := db.makeRequestWithHeaders("DELETE", endpoint, nil, map[string]string{"Prefer": "return=minimal"}); err != nil {
+		return fmt.Errorf("failed to remove space guest: %w", err)
+	}
+	return db.DeleteSpacePermission(spaceID, userID)
+}
+
+// ListSpaceGuests 按加入时间返回访客，can_edit 取自显式权限
+func (db *SupabaseDatabase) ListSpaceGuests(spaceID string) ([]models.SpaceGuest, error) {
+	data, err := db.makeRequest("GET", from("space_guests").Eq("space_id", spaceID).
+		Select("user_id,created_at").Order("created_at.asc,user_id.asc").String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list space guests: %w", err)
+	}
+	guests := []models.SpaceGuest{}
+	if err := json.Unmarshal(data, &guests); err != nil {
+		return nil, err
+	}
+	if len(guests) == 0 {
+		return guests, nil
+	}
+	perms, err := db.GetSpacePermissions(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	canEdit := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		canEdit[p.UserID] = p.CanEdit
+	}
+	for i := range guests {
+		guests[i].CanEdit = canEdit[guests[i].UserID]
+	}
+	return guests, nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// RecordTierChange 记录一次等级变化
+func (db *SupabaseDatabase) RecordTierChange(c *models.TierChange) error {
+	data, err := db.makeRequest("POST", "/tier_changes", map[string]interface{}{
+		"user_id":      c.UserID,
+		"old_tier":     c.OldTier,
+		"new_tier":     c.NewTier,
+		"source":       c.Source,
+		"reference_id": c.ReferenceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record tier change: %w", err)
+	}
+	return decodeFirstRow(data, c, "tier change")
+}
+
+// ListTierChanges 按时间倒序返回用户最近的 limit 条等级变化
+func (db *SupabaseDatabase) ListTierChanges(userID string, limit int) ([]models.TierChange, error) {
+	data, err := db.makeRequest("GET", from("tier_changes").Eq("user_id", userID).Select("*").
+		Order("created_at.desc").Limit(limit).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tier changes: %w", err)
+	}
+	changes := []models.TierChange{}
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+const supabaseWebArchiveJobColumns = "item_id,organization_id,job_id,attempts,next_attempt_at,claimed_at,created_at"
+
+// GetWebArchiveEnabled 组织是否开启了网页存档
+func (db *SupabaseDatabase) GetWebArchiveEnabled(orgID string) (bool, error) {
+	data, err := db.makeRequest("GET", from("organization_web_archive").Eq("organization_id", orgID).Select("organization_id").Limit(1).String(), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get web archive setting: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return false, fmt.Errorf("failed to parse web archive setting: %w", err)
+	}
+	return len(rows) > 0, nil
+}
+
+// SetWebArchiveEnabled 开启（记录操作者）或关闭组织的网页存档；关闭时同时清空该组织尚未完成的存档任务
+func (db *SupabaseDatabase) SetWebArchiveEnabled(orgID, userID string, enabled bool) error {
+	if enabled {
+		_, err := db.makeRequestWithHeaders("POST", "/organization_web_archive?on_conflict=organization_id",
+			map[string]interface{}{"organization_id": orgID, "enabled_by": userID},
+			map[string]string{"Prefer": "resolution=ignore-duplicates,return=minimal"})
+		if err != nil {
+			return fmt.Errorf("failed to enable web archive: %w", err)
+		}
+		return nil
+	}
+	minimal := map[string]string{"Prefer": "return=minimal"}
+	if _, err := db.makeRequestWithHeaders("DELETE", from("organization_web_archive").Eq("organization_id", orgID).String(), nil, minimal); err != nil {
+		return fmt.Errorf("failed to disable web archive: %w", err)
+	}
+	if _, err := db.makeRequestWithHeaders("DELETE", from("web_archive_jobs").Eq("organization_id", orgID).String(), nil, minimal); err != nil {
+		return fmt.Errorf("failed to clear web archive jobs: %w", err)
+	}
+	return nil
+}
+
+// EnqueueWebArchiveJob 将条目加入存档队列；已在队列中时不重复加入
+func (db *SupabaseDatabase) EnqueueWebArchiveJob(itemID, orgID string) error {
+	_, err := db.makeRequestWithHeaders("POST", "/web_archive_jobs?on_conflict=item_id",
+		map[string]interface{}{"item_id": itemID, "organization_id": orgID},
+		map[string]string{"Prefer": "resolution=ignore-duplicates,return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue web archive job: %w", err)
+	}
+	return nil
+}
+
+// ClaimWebArchiveJobs 逐条以 claimed_at 为条件 PATCH 认领（无事务时的乐观锁），被并发任务抢先的任务会被跳过
+func (db *SupabaseDatabase) ClaimWebArchiveJobs(limit int, now, staleBefore time.Time) ([]models.WebArchiveJob, error) {
+	stamp := now.UTC().Format(time.RFC3339)
+	candidates := []*restQuery{
+		from("web_archive_jobs").Lte("next_attempt_at", stamp).Is("claimed_at", "null"),
+		from("web_archive_jobs").Lte("next_attempt_at", stamp).Lt("claimed_at", staleBefore.UTC().Format(time.RFC3339)),
+	}
+
+	claimed := []models.WebArchiveJob{}
+	for _, q := range candidates {
+		if len(claimed) >= limit {
+			break
+		}
+		data, err := db.makeRequest("GET", q.Select(supabaseWebArchiveJobColumns).Order("next_attempt_at.asc").Limit(limit-len(claimed)).String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list web archive jobs: %w", err)
+		}
+		var rows []models.WebArchiveJob
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("failed to parse web archive jobs: %w", err)
+		}
+		for _, j := range rows {
+			claim := from("web_archive_jobs").Eq("item_id", j.ItemID)
+			if j.ClaimedAt != nil {
+				claim = claim.Eq("claimed_at", j.ClaimedAt.UTC().Format(time.RFC3339Nano))
+			} else {
+				claim = claim.Is("claimed_at", "null")
+			}
+			data, err := db.makeRequest("PATCH", claim.Select(supabaseWebArchiveJobColumns).String(), map[string]interface{}{"claimed_at": stamp})
+			if err != nil {
+				return nil, fmt.Errorf("failed to claim web archive job: %w", err)
+			}
+			var updated []models.WebArchiveJob
+			if err := json.Unmarshal(data, &updated); err != nil {
+				return nil, fmt.Errorf("failed to parse web archive job: %w", err)
+			}
+			claimed = append(claimed, updated...)
+		}
+	}
+	return claimed, nil
+}
+
+// UpdateWebArchiveJob 保存任务进度（job_id、attempts、next_attempt_at）并释放认领
+func (db *SupabaseDatabase) UpdateWebArchiveJob(j *models.WebArchiveJob) error {
+	var jobID interface{}
+	if j.JobID != "" {
+		jobID = j.JobID
+	}
+	_, err := db.makeRequestWithHeaders("PATCH", from("web_archive_jobs").Eq("item_id", j.ItemID).String(), map[string]interface{}{
+		"job_id":          jobID,
+		"attempts":        j.Attempts,
+		"next_attempt_at": j.NextAttemptAt.UTC().Format(time.RFC3339),
+		"claimed_at":      nil,
+	}, map[string]string{"Prefer": "return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to update web archive job: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebArchiveJob 将条目移出存档队列（完成或放弃）
+func (db *SupabaseDatabase) DeleteWebArchiveJob(itemID string) error {
+	_, err := db.makeRequestWithHeaders("DELETE", from("web_archive_jobs").Eq("item_id", itemID).String(), nil,
+		map[string]string{"Prefer": "return=minimal"})
+	if err != nil {
+		return fmt.Errorf("failed to delete web archive job: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ClaimWebhookEvent 以 ignore-duplicates 插入：主键冲突时 PostgREST 返回空数组，即为重复投递
+func (db *SupabaseDatabase) ClaimWebhookEvent(eventID, eventType string) (bool, error) {
+	data, err := db.makeRequestWithHeaders("POST", "/paddle_webhook_events?on_conflict=event_id", map[string]interface{}{
+		"event_id":   eventID,
+		"event_type": eventType,
+	}, map[string]string{"Prefer": "resolution=ignore-duplicates,return=representation"})
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook event: %w", err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return false, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return len(rows) == 1, nil
+}
+
+// ReleaseWebhookEvent 删除事件记录
+func (db *SupabaseDatabase) ReleaseWebhookEvent(eventID string) error {
+	endpoint := from("paddle_webhook_events").Eq("event_id", eventID).String()
+	if _, err := db.makeRequestWithHeaders("DELETE", endpoint, nil, map[string]string{"Prefer": "return=minimal"}); err != nil {
+		return fmt.Errorf("failed to release webhook event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// hashToken 邀请与分享链接令牌只以 SHA-256 摘要存储：数据库泄露不会暴露仍有效的链接。
+// 令牌是 24 字节随机数，不需要加盐或慢哈希；查找时对传入令牌求摘要后做等值比较
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
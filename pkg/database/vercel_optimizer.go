@@ -7,10 +7,19 @@ import (
 	"time"
 )
 
+// 空闲连接清理：不启动后台 goroutine（无服务器实例冻结/回收时无法停止），
+// 而是在取连接时顺带清理，每 optimizerSweepInterval 最多一次
+const (
+	optimizerIdleTimeout   = 10 * time.Minute
+	optimizerSweepInterval = time.Minute
+)
+
 // VercelOptimizer Vercel环境优化器
 type VercelOptimizer struct {
 	connections map[string]DatabaseInterface
 	lastUsed    map[string]time.Time
+	checkedAt   map[string]time.Time // 最近一次健康检查通过的时间（见 healthFresh）
+	lastSweep   time.Time            // 最近一次清理空闲连接的时间
 	mu          sync.RWMutex
 }
 
@@ -25,56 +34,78 @@ func GetVercelOptimizer() *VercelOptimizer {
 		vercelOptimizer = &VercelOptimizer{
 			connections: make(map[string]DatabaseInterface),
 			lastUsed:    make(map[string]time.Time),
+			checkedAt:   make(map[string]time.Time),
 		}
 
-		// 在Vercel环境中启动后台清理
-		if IsVercelEnvironment() {
-			go vercelOptimizer.backgroundCleanup()
-		}
 	})
 	return vercelOptimizer
 }
 
-// GetOptimizedConnection 获取优化的数据库连接
-func (vo *VercelOptimizer) GetOptimizedConnection(config DatabaseConfig) DatabaseInterface {
+// GetOptimizedConnection 获取优化的数据库连接；连接失败时不缓存，下次请求重新尝试
+func (vo *VercelOptimizer) GetOptimizedConnection(config DatabaseConfig) (DatabaseInterface, error) {
 	// 生成配置的唯一键
 	configKey := vo.generateConfigKey(config)
 
 	vo.mu.Lock()
 	defer vo.mu.Unlock()
 
+	if time.Since(vo.lastSweep) >= optimizerSweepInterval {
+		vo.sweepLocked()
+	}
+
 	// 检查是否有现有连接
 	if conn, exists := vo.connections[configKey]; exists {
-		// 检查连接健康状态
-		if err := conn.HealthCheck(); err == nil {
+		// 健康状态在 healthCheckTTL 内且其间无连接错误时直接复用，避免每个请求都 Ping 一次
+		if healthFresh(vo.checkedAt[configKey]) {
 			vo.lastUsed[configKey] = time.Now()
+			return conn, nil
+		}
+		if err := conn.HealthCheck(); err == nil {
+			now := time.Now()
+			vo.lastUsed[configKey] = now
+			vo.checkedAt[configKey] = now
 			fmt.Printf("♻️  Reusing optimized database connection (key: %s)\n", configKey[:8])
-			return conn
+			return conn, nil
 		} else {
 			fmt.Printf("❌ Connection unhealthy, removing: %v\n", err)
 			conn.Close()
 			delete(vo.connections, configKey)
 			delete(vo.lastUsed, configKey)
+			delete(vo.checkedAt, configKey)
 		}
 	}
 
 	// 创建新连接
 	fmt.Printf("🔄 Creating new optimized database connection (key: %s)\n", configKey[:8])
-	conn := NewDatabase(config)
+	conn, err := NewDatabase(config)
+	if err != nil {
+		return nil, err
+	}
 
+	now := time.Now()
 	vo.connections[configKey] = conn
-	vo.lastUsed[configKey] = time.Now()
+	vo.lastUsed[configKey] = now
+	vo.checkedAt[configKey] = now
 
-	return conn
+	return conn, nil
 }
 
 // generateConfigKey 生成配置的唯一键
 func (vo *VercelOptimizer) generateConfigKey(config DatabaseConfig) string {
-    return fmt.Sprintf("%s_%s_%s_%t",
+    return fmt.Sprintf("%s_%s_%s_%s_%s_%s_%t_%t_%s_%s_%s_%s_%v",
+        config.Driver,
         hashString(config.PostgresDSN),
+        hashString(config.PostgresReadDSN),
         hashString(config.SupabaseURL),
+        hashString(config.SupabaseReadURL),
         hashString(config.SupabaseKey),
+        config.SnapshotCompression,
         config.Debug,
+        config.HomeRegion,
+        hashString(config.RegionDSNs["us"]),
+        hashString(config.RegionDSNs["eu"]),
+        hashString(config.EncryptionMasterKey),
+        config.Pool,
     )
 }
 
@@ -89,30 +120,21 @@ func hashString(s string) string {
 	return s
 }
 
-// backgroundCleanup 后台清理过期连接
-func (vo *VercelOptimizer) backgroundCleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			vo.cleanupExpiredConnections()
-		}
-	}
-}
-
 // cleanupExpiredConnections 清理过期连接
 func (vo *VercelOptimizer) cleanupExpiredConnections() {
 	vo.mu.Lock()
 	defer vo.mu.Unlock()
+	vo.sweepLocked()
+}
 
+// sweepLocked 关闭空闲超过 optimizerIdleTimeout 的连接；调用方需持有 vo.mu
+func (vo *VercelOptimizer) sweepLocked() {
 	now := time.Now()
+	vo.lastSweep = now
 	expiredKeys := []string{}
 
 	for key, lastUsed := range vo.lastUsed {
-		// 在Vercel中，连接空闲超过10分钟就清理
-		if now.Sub(lastUsed) > 10*time.Minute {
+		if now.Sub(lastUsed) > optimizerIdleTimeout {
 			expiredKeys = append(expiredKeys, key)
 		}
 	}
@@ -123,6 +145,7 @@ func (vo *VercelOptimizer) cleanupExpiredConnections() {
 			conn.Close()
 			delete(vo.connections, key)
 			delete(vo.lastUsed, key)
+			delete(vo.checkedAt, key)
 		}
 	}
 
@@ -164,11 +187,12 @@ func (vo *VercelOptimizer) ForceCleanup() {
 		conn.Close()
 		delete(vo.connections, key)
 		delete(vo.lastUsed, key)
+		delete(vo.checkedAt, key)
 	}
 }
 
 // GetOptimizedDatabase 全局函数，获取优化的数据库连接
-func GetOptimizedDatabase(config DatabaseConfig) DatabaseInterface {
+func GetOptimizedDatabase(config DatabaseConfig) (DatabaseInterface, error) {
 	if IsVercelEnvironment() {
 		// 在Vercel环境中使用优化器
 		optimizer := GetVercelOptimizer()
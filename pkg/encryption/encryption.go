@@ -0,0 +1,173 @@
+// Package encryption 应用层信封加密：每个组织一把数据密钥（DEK），DEK 由主密钥（KEK）包装后存库。
+// 主密钥只在 KeyWrapper 内使用；接入云 KMS 时实现同一接口即可，字段密文格式不变。
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize AES-256 密钥长度
+const KeySize = 32
+
+const (
+	// FieldPrefix 字段密文前缀；不带前缀的值视为明文（启用加密前写入、尚未重写的条目）
+	FieldPrefix = "enc:v1:"
+	// BlindIndexPrefix 盲索引前缀，用于在不解密的情况下做等值查找
+	BlindIndexPrefix = "bi:v1:"
+
+	localWrapPrefix = "local:v1:"
+)
+
+// ErrInvalidCiphertext 密文格式错误或认证失败（密钥不匹配、数据被篡改）
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// KeyWrapper 用主密钥包装/解包数据密钥
+type KeyWrapper interface {
+	Wrap(dataKey []byte) (string, error)
+	Unwrap(wrapped string) ([]byte, error)
+}
+
+// LocalKeyWrapper 以本地主密钥（ENCRYPTION_MASTER_KEY）做 AES-256-GCM 包装
+type LocalKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// NewLocalKeyWrapper masterKey 为 base64 编码的 32 字节密钥
+func NewLocalKeyWrapper(masterKey string) (*LocalKeyWrapper, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(masterKey))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, base64 encoded", KeySize)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalKeyWrapper{aead: aead}, nil
+}
+
+// Wrap 实现 KeyWrapper
+func (w *LocalKeyWrapper) Wrap(dataKey []byte) (string, error) {
+	sealed, err := seal(w.aead, dataKey, []byte("data-key"))
+	if err != nil {
+		return "", err
+	}
+	return localWrapPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Unwrap 实现 KeyWrapper
+func (w *LocalKeyWrapper) Unwrap(wrapped string) ([]byte, error) {
+	if !strings.HasPrefix(wrapped, localWrapPrefix) {
+		return nil, fmt.Errorf("unsupported wrapped key format")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(wrapped, localWrapPrefix))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return open(w.aead, raw, []byte("data-key"))
+}
+
+// GenerateDataKey 生成随机数据密钥
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// FieldCipher 用组织数据密钥加解密条目字段；字段名作为附加数据，密文不能在字段间挪用
+type FieldCipher struct {
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+// NewFieldCipher 由数据密钥构造
+func NewFieldCipher(dataKey []byte) (*FieldCipher, error) {
+	if len(dataKey) != KeySize {
+		return nil, fmt.Errorf("data key must be %d bytes", KeySize)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("blind-index"))
+	return &FieldCipher{aead: aead, indexKey: mac.Sum(nil)}, nil
+}
+
+// Encrypt 加密字段值；空值与已加密的值原样返回
+func (c *FieldCipher) Encrypt(field, plaintext string) (string, error) {
+	if plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+	sealed, err := seal(c.aead, []byte(plaintext), []byte("item:"+field))
+	if err != nil {
+		return "", err
+	}
+	return FieldPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密字段值；明文（无前缀）原样返回
+func (c *FieldCipher) Decrypt(field, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, FieldPrefix))
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	plaintext, err := open(c.aead, raw, []byte("item:"+field))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex 返回值的确定性 HMAC，相同组织内相同的值得到相同的索引
+func (c *FieldCipher) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(value))
+	return BlindIndexPrefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted 值是否为字段密文
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, FieldPrefix)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 返回 nonce || ciphertext
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, raw, aad []byte) ([]byte, error) {
+	if len(raw) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, ciphertext := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
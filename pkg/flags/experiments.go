@@ -0,0 +1,77 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+)
+
+// Variant 实验变体及其权重（各变体权重之和为分桶总数）
+type Variant struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// Experiment 单个实验：enabled 为 false 或等级不在 tiers 内（为空时不限）的用户不参与，客户端按对照组处理
+type Experiment struct {
+	Enabled  bool      `json:"enabled"`
+	Variants []Variant `json:"variants"`
+	Tiers    []string  `json:"tiers,omitempty"`
+}
+
+// ParseExperiments 解析 EXPERIMENTS：{"experiment_key": Experiment, ...}
+func ParseExperiments(raw string) (map[string]Experiment, error) {
+	experiments := map[string]Experiment{}
+	if raw == "" {
+		return experiments, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &experiments); err != nil {
+		return nil, fmt.Errorf("invalid EXPERIMENTS: %w", err)
+	}
+	for key, e := range experiments {
+		if len(e.Variants) < 2 {
+			return nil, fmt.Errorf("invalid EXPERIMENTS: %s needs at least two variants", key)
+		}
+		for _, v := range e.Variants {
+			if v.Name == "" || v.Weight <= 0 {
+				return nil, fmt.Errorf("invalid EXPERIMENTS: %s variants need a name and a positive weight", key)
+			}
+		}
+	}
+	return experiments, nil
+}
+
+// Assign 实现 Provider：同一用户在同一实验中的变体只取决于 (实验 key, 用户 ID)，Web 与扩展结果一致
+func (p StaticProvider) Assign(ctx context.Context, s Subject) (map[string]string, error) {
+	result := make(map[string]string, len(p.Experiments))
+	for key, e := range p.Experiments {
+		if v, ok := e.assign(key, s); ok {
+			result[key] = v
+		}
+	}
+	return result, nil
+}
+
+func (e Experiment) assign(key string, s Subject) (string, bool) {
+	if !e.Enabled || (len(e.Tiers) > 0 && !contains(e.Tiers, s.Tier)) {
+		return "", false
+	}
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return "", false
+	}
+	h := fnv.New32a()
+	h.Write([]byte("experiment:" + key + ":" + s.UserID))
+	n := int(h.Sum32() % uint32(total))
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v.Name, true
+		}
+		n -= v.Weight
+	}
+	return "", false
+}
@@ -0,0 +1,180 @@
+// Package geoip 按 IP 查询大致位置（国家/地区/城市），用于登录记录与设备列表中标注位置，帮助用户发现可疑登录。
+// 可选：未配置 GEOIP_PROVIDER 时所有查询返回空位置。
+package geoip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/tracing"
+)
+
+const (
+	lookupTimeout = 2 * time.Second
+	cacheTTL      = time.Hour
+	maxCached     = 10000
+)
+
+// Locator 查询 IP 的位置；查询不到（私有地址、未配置、服务故障）时返回 nil 位置与可能的错误，调用方不应因此失败
+type Locator interface {
+	Lookup(ctx context.Context, ip string) (*models.GeoLocation, error)
+}
+
+var (
+	sharedOnce    sync.Once
+	sharedLocator Locator
+)
+
+// Shared 返回进程内共享的 Locator（缓存跨请求复用）
+func Shared(cfg *config.Config) Locator {
+	sharedOnce.Do(func() { sharedLocator = New(cfg) })
+	return sharedLocator
+}
+
+// New 按 GEOIP_PROVIDER 返回 ipinfo 或 MaxMind（GeoIP2 Web 服务）查询器；未配置时返回 NopLocator
+func New(cfg *config.Config) Locator {
+	client := tracing.NewHTTPClient(lookupTimeout)
+	var l lookupFunc
+	switch cfg.GeoIPProvider {
+	case "ipinfo":
+		l = ipinfoLookup(client, cfg.GeoIPToken)
+	case "maxmind":
+		l = maxmindLookup(client, cfg.GeoIPAccountID, cfg.GeoIPToken)
+	default:
+		return NopLocator{}
+	}
+	return &cachingLocator{lookup: l, entries: map[string]cachedLocation{}}
+}
+
+// NopLocator 未配置 GeoIP 时使用
+type NopLocator struct{}
+
+// Lookup 实现 Locator
+func (NopLocator) Lookup(ctx context.Context, ip string) (*models.GeoLocation, error) {
+	return nil, nil
+}
+
+type lookupFunc func(ctx context.Context, ip string) (*models.GeoLocation, error)
+
+type cachedLocation struct {
+	loc       *models.GeoLocation
+	fetchedAt time.Time
+}
+
+// cachingLocator 在进程内缓存查询结果（包括查不到的结果），避免同一 IP 反复调用外部服务
+type cachingLocator struct {
+	lookup  lookupFunc
+	mu      sync.Mutex
+	entries map[string]cachedLocation
+}
+
+// Lookup 实现 Locator；私有、回环等非公网地址不查询
+func (c *cachingLocator) Lookup(ctx context.Context, ip string) (*models.GeoLocation, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || !parsed.IsGlobalUnicast() || parsed.IsPrivate() {
+		return nil, nil
+	}
+	c.mu.Lock()
+	if e, ok := c.entries[ip]; ok && time.Since(e.fetchedAt) < cacheTTL {
+		c.mu.Unlock()
+		return e.loc, nil
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	loc, err := c.lookup(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCached {
+		// 简单整体清空：缓存只为削减重复查询，不追求命中率
+		c.entries = map[string]cachedLocation{}
+	}
+	c.entries[ip] = cachedLocation{loc: loc, fetchedAt: time.Now()}
+	return loc, nil
+}
+
+// ipinfoLookup https://ipinfo.io/{ip}?token=...
+func ipinfoLookup(client *http.Client, token string) lookupFunc {
+	return func(ctx context.Context, ip string) (*models.GeoLocation, error) {
+		var body struct {
+			Country string `json:"country"`
+			Region  string `json:"region"`
+			City    string `json:"city"`
+			Bogon   bool   `json:"bogon"`
+		}
+		endpoint := "https://ipinfo.io/" + url.PathEscape(ip) + "?token=" + url.QueryEscape(token)
+		if err := getJSON(ctx, client, endpoint, nil, &body); err != nil {
+			return nil, err
+		}
+		if body.Bogon || body.Country == "" {
+			return nil, nil
+		}
+		return &models.GeoLocation{Country: body.Country, Region: body.Region, City: body.City}, nil
+	}
+}
+
+// maxmindLookup https://geoip.maxmind.com/geoip/v2.1/city/{ip}，以账户 ID 与 License Key 做 Basic 认证
+func maxmindLookup(client *http.Client, accountID, licenseKey string) lookupFunc {
+	return func(ctx context.Context, ip string) (*models.GeoLocation, error) {
+		type names struct {
+			Names map[string]string `json:"names"`
+		}
+		var body struct {
+			Country struct {
+				ISOCode string `json:"iso_code"`
+			} `json:"country"`
+			Subdivisions []names `json:"subdivisions"`
+			City         names   `json:"city"`
+		}
+		endpoint := "https://geoip.maxmind.com/geoip/v2.1/city/" + url.PathEscape(ip)
+		auth := func(req *http.Request) { req.SetBasicAuth(accountID, licenseKey) }
+		if err := getJSON(ctx, client, endpoint, auth, &body); err != nil {
+			return nil, err
+		}
+		if body.Country.ISOCode == "" {
+			return nil, nil
+		}
+		loc := &models.GeoLocation{Country: body.Country.ISOCode, City: body.City.Names["en"]}
+		if len(body.Subdivisions) > 0 {
+			loc.Region = body.Subdivisions[0].Names["en"]
+		}
+		return loc, nil
+	}
+}
+
+func getJSON(ctx context.Context, client *http.Client, endpoint string, prepare func(*http.Request), dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if prepare != nil {
+		prepare(req)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("geoip lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// 地址不在库中
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("geoip lookup failed: status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
@@ -1,20 +1,24 @@
 package handlers
 
 import (
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"tab-sync-backend-refactor/pkg/cache"
 	"tab-sync-backend-refactor/pkg/config"
 	"tab-sync-backend-refactor/pkg/database"
 	"tab-sync-backend-refactor/pkg/middleware"
 	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/notify"
+	"tab-sync-backend-refactor/pkg/tracing"
 	"tab-sync-backend-refactor/pkg/utils"
 )
 
@@ -22,6 +26,8 @@ import (
 type AuthHandler struct {
     config *config.Config
     db     database.DatabaseInterface
+    guard  *authGuard
+    alerts *securityAlerts
 }
 
 // ensureDefaultOrgAndSpace ensures the user has at least one organization and a default space.
@@ -33,7 +39,7 @@ func (h *AuthHandler) ensureDefaultOrgAndSpace(user *models.User) (string, error
     // Check existing orgs
     orgs, err := h.db.ListUserOrganizations(user.ID)
     if err == nil && len(orgs) > 0 {
-        return orgs[0].ID, nil
+        return models.DefaultOrganization(orgs, user.ID).ID, nil
     }
     // Create a default org
     displayName := user.Name
@@ -51,6 +57,7 @@ func (h *AuthHandler) ensureDefaultOrgAndSpace(user *models.User) (string, error
     if err := h.db.CreateOrganization(org); err != nil {
         return "", err
     }
+    assignOrgSlug(h.db, org)
     // Create a default space (best-effort)
     _ = h.db.CreateSpace(&models.Space{ OrganizationID: org.ID, Name: "General", Description: "Default space", IsDefault: true })
     return org.ID, nil
@@ -94,15 +101,32 @@ type GitHubTokenResponse struct {
 }
 
 // NewAuthHandler 创建认证处理器
-func NewAuthHandler(cfg *config.Config, db database.DatabaseInterface) *AuthHandler {
+func NewAuthHandler(cfg *config.Config) *AuthHandler {
+	mailer := notify.NewMailer(cfg)
+	alerts := newSecurityAlerts(cfg, mailer)
 	return &AuthHandler{
 		config: cfg,
-		db:     db,
+		guard: &authGuard{
+			store:   cache.Shared(cfg),
+			mailer:  mailer,
+			alerts:  alerts,
+			secret:  cfg.JWTSecret,
+			baseURL: cfg.BaseURL,
+		},
+		alerts: alerts,
 	}
 }
 
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *AuthHandler) withRequest(r *http.Request) *AuthHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
 // CheckSubscription 检查用户订阅状态（兼容现有实现）
 func (h *AuthHandler) CheckSubscription(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 解析请求体
 	var req struct {
 		Provider string `json:"provider"`
@@ -110,7 +134,7 @@ func (h *AuthHandler) CheckSubscription(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := utils.ParseJSONBody(r, &req); err != nil {
-		utils.WriteBadRequestResponse(w, "Invalid request body")
+		writeBodyError(w, err, "Invalid request body")
 		return
 	}
 
@@ -128,7 +152,7 @@ func (h *AuthHandler) CheckSubscription(w http.ResponseWriter, r *http.Request)
 	// 获取用户订阅信息
 	userWithSub, err := h.db.GetUserWithSubscription(req.UserID)
 	if err != nil {
-		utils.WriteErrorResponse(w, http.StatusNotFound, "User not found: "+err.Error())
+		writeError(w, err)
 		return
 	}
 
@@ -136,11 +160,13 @@ func (h *AuthHandler) CheckSubscription(w http.ResponseWriter, r *http.Request)
 	utils.WriteSuccessResponse(w, map[string]interface{}{
 		"success": true,
 		"user": map[string]interface{}{
-			"id":         userWithSub.ID,
-			"email":      userWithSub.Email,
-			"tier":       string(userWithSub.Tier),
-			"created_at": userWithSub.CreatedAt,
-			"updated_at": userWithSub.UpdatedAt,
+			"id":                   userWithSub.ID,
+			"email":                userWithSub.Email,
+			"tier":                 string(userWithSub.EffectiveTier()),
+			"is_lifetime_member":   userWithSub.IsLifetimeMember,
+			"lifetime_member_type": userWithSub.LifetimeMemberType,
+			"created_at":           userWithSub.CreatedAt,
+			"updated_at":           userWithSub.UpdatedAt,
 		},
 	})
 }
@@ -151,19 +177,28 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		"User registration not yet implemented", "")
 }
 
-// Login 用户登录
+// Login 用户登录（尚未实现；锁定中的邮箱/IP 先返回 429，实现校验后在失败时调用 guard.recordFailure）
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	_ = utils.ParseJSONBody(r, &req)
+	if retry := h.guard.lockedFor(r.Context(), req.Email, middleware.ClientIP(r)); retry > 0 {
+		writeAuthLocked(w, retry)
+		return
+	}
 	utils.WriteErrorResponseWithCode(w, http.StatusNotImplemented, "NOT_IMPLEMENTED",
 		"User login not yet implemented", "")
 }
 
 // RefreshToken 刷新令牌
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     var req struct {
         RefreshToken string `json:"refresh_token"`
     }
     if err := utils.ParseJSONBody(r, &req); err != nil {
-        utils.WriteBadRequestResponse(w, "Invalid request body")
+        writeBodyError(w, err, "Invalid request body")
         return
     }
     if strings.TrimSpace(req.RefreshToken) == "" {
@@ -171,10 +206,46 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // 签名校验前只按 IP 计数：未验证令牌里的邮箱可以伪造，不能用来锁定他人账户
+    ip := middleware.ClientIP(r)
+    if retry := h.guard.lockedFor(r.Context(), "", ip); retry > 0 {
+        writeAuthLocked(w, retry)
+        return
+    }
+
     jwtService := utils.NewJWTService(h.config.JWTSecret)
-    accessToken, expiresIn, err := jwtService.RefreshAccessToken(req.RefreshToken)
+    claims, err := jwtService.ValidateRefreshToken(req.RefreshToken)
+    if err != nil {
+        h.guard.recordFailure(r, h.db, "", ip)
+        utils.WriteAppError(w, utils.ErrInvalidToken.Wrap(err).WithMessage("Invalid or expired refresh token"))
+        return
+    }
+    email := claims.Email
+    if retry := h.guard.lockedFor(r.Context(), email, ""); retry > 0 {
+        writeAuthLocked(w, retry)
+        return
+    }
+    // 检测到可疑活动后吊销的会话：此前签发的刷新令牌需要重新登录
+    revokedAt, err := h.db.GetSessionsRevokedAt(claims.UserID)
     if err != nil {
-        utils.WriteUnauthorizedResponse(w, "Invalid or expired refresh token: "+err.Error())
+        writeError(w, err)
+        return
+    }
+    if revokedAt != nil && claims.Iat < revokedAt.Unix() {
+        utils.WriteAppError(w, utils.ErrReauthRequired)
+        return
+    }
+    h.guard.recordSuccess(r.Context(), email)
+
+    // 每次刷新都从数据库重新读取等级、组织与令牌版本，使 webhook 改动后的声明在刷新后生效
+    profile, err := tokenProfile(h.db, claims.UserID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    accessToken, expiresIn, err := jwtService.GenerateAccessToken(claims.UserID, claims.Email, profile)
+    if err != nil {
+        writeError(w, err)
         return
     }
 
@@ -192,6 +263,7 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 
 // GoogleOAuth Google OAuth登录 - 处理前端发送的授权码
 func (h *AuthHandler) GoogleOAuth(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 解析请求体
 	var req struct {
 		Code  string `json:"code"`
@@ -199,7 +271,7 @@ func (h *AuthHandler) GoogleOAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := utils.ParseJSONBody(r, &req); err != nil {
-		utils.WriteBadRequestResponse(w, "Invalid request body")
+		writeBodyError(w, err, "Invalid request body")
 		return
 	}
 
@@ -226,10 +298,11 @@ func (h *AuthHandler) GoogleOAuth(w http.ResponseWriter, r *http.Request) {
 
 // GitHubOAuth GitHub OAuth登录
 func (h *AuthHandler) GitHubOAuth(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 解析请求体
 	var req OAuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.WriteBadRequestResponse(w, "Invalid request body")
+		writeBodyError(w, err, "Invalid request body")
 		return
 	}
 
@@ -257,19 +330,19 @@ func (h *AuthHandler) GeneratePricingSession(w http.ResponseWriter, r *http.Requ
 	fmt.Printf("✅ GeneratePricingSession: User authenticated: %s (%s)\n", user.ID, user.Email)
 
 	// 获取客户端IP
-	clientIP := h.getClientIP(r)
+	clientIP := middleware.ClientIP(r)
 
-	// 生成会话码（简单实现：使用UUID + 时间戳）
+	// 生成会话码（pricing_session 类型的短期 JWT，不附带刷新令牌）
 	sessionCode, err := h.generateSessionCode(user.ID, user.Email, user.Name, clientIP)
 	if err != nil {
-		utils.WriteInternalServerErrorResponse(w, "Failed to generate session: "+err.Error())
+		writeError(w, err)
 		return
 	}
 
 	// 返回响应
 	response := map[string]interface{}{
 		"session_code": sessionCode,
-		"expires_in":   300, // 5分钟
+		"expires_in":   int(utils.PricingSessionTTL.Seconds()),
 	}
 
 	utils.WriteSuccessResponse(w, response)
@@ -280,16 +353,7 @@ func (h *AuthHandler) GeneratePricingSession(w http.ResponseWriter, r *http.Requ
 func (h *AuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("🔄 OAuth callback received - URL: %s\n", r.URL.String())
 
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// 处理预检请求
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	// CORS 由全局中间件按路由处理（/api/oauth/ 为公开策略）
 
 	// 只允许GET请求
 	if r.Method != http.MethodGet {
@@ -297,146 +361,9 @@ func (h *AuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 设置响应头
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// 输出静态回调页面（templates/oauth_callback.html，与旧项目一致）
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-
-	// OAuth回调页面HTML（与旧项目完全一致）
-	html := `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>OAuth Callback - Tab Sync</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
-            background: #1a1a1a;
-            color: #ffffff;
-            display: flex;
-            align-items: center;
-            justify-content: center;
-            min-height: 100vh;
-            margin: 0;
-        }
-        .container {
-            text-align: center;
-            padding: 40px;
-            background: #2a2a2a;
-            border-radius: 12px;
-            box-shadow: 0 20px 40px rgba(0, 0, 0, 0.3);
-            max-width: 400px;
-        }
-        .spinner {
-            width: 40px;
-            height: 40px;
-            border: 4px solid #333;
-            border-top: 4px solid #4285F4;
-            border-radius: 50%;
-            animation: spin 1s linear infinite;
-            margin: 0 auto 20px;
-        }
-        @keyframes spin {
-            0% { transform: rotate(0deg); }
-            100% { transform: rotate(360deg); }
-        }
-        .error {
-            color: #ff6b6b;
-            margin-top: 20px;
-        }
-        .success {
-            color: #4CAF50;
-            margin-top: 20px;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="spinner"></div>
-        <h2>Processing OAuth Callback...</h2>
-        <p>Please wait while we complete your authentication.</p>
-        <div id="message"></div>
-    </div>
-
-    <script>
-        (function() {
-            const messageEl = document.getElementById('message');
-
-            try {
-                // 获取URL参数
-                const urlParams = new URLSearchParams(window.location.search);
-                const code = urlParams.get('code');
-                const error = urlParams.get('error');
-                const state = urlParams.get('state');
-
-                console.log('OAuth callback received:', { code: code ? 'present' : 'missing', error, state });
-
-                if (error) {
-                    // OAuth错误
-                    messageEl.innerHTML = '<div class="error">Authentication failed: ' + error + '</div>';
-
-                    // 通知父窗口
-                    if (window.opener) {
-                        window.opener.postMessage({
-                            type: 'OAUTH_ERROR',
-                            error: error
-                        }, '*');
-                        setTimeout(() => window.close(), 2000);
-                    }
-                    return;
-                }
-
-                if (code) {
-                    // OAuth成功，获得授权码
-                    messageEl.innerHTML = '<div class="success">Authentication successful! Redirecting...</div>';
-
-                    // 通知父窗口
-                    if (window.opener) {
-                        window.opener.postMessage({
-                            type: 'OAUTH_SUCCESS',
-                            code: code,
-                            state: state
-                        }, '*');
-                        setTimeout(() => window.close(), 1000);
-                    } else {
-                        // 如果没有父窗口，显示消息
-                        messageEl.innerHTML += '<div>You can close this window now.</div>';
-                        setTimeout(() => {
-                            try { window.close(); } catch(e) { console.log('Cannot close window'); }
-                        }, 3000);
-                    }
-                } else {
-                    // 没有code参数
-                    messageEl.innerHTML = '<div class="error">No authorization code received</div>';
-
-                    if (window.opener) {
-                        window.opener.postMessage({
-                            type: 'OAUTH_ERROR',
-                            error: 'No authorization code received'
-                        }, '*');
-                        setTimeout(() => window.close(), 2000);
-                    }
-                }
-            } catch (err) {
-                console.error('OAuth callback error:', err);
-                messageEl.innerHTML = '<div class="error">Processing error: ' + err.message + '</div>';
-
-                if (window.opener) {
-                    window.opener.postMessage({
-                        type: 'OAUTH_ERROR',
-                        error: err.message
-                    }, '*');
-                    setTimeout(() => window.close(), 2000);
-                }
-            }
-        })();
-    </script>
-</body>
-</html>`
-
-	// 输出HTML
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(html))
+	renderPage(w, "oauth_callback.html", nil)
 
 	fmt.Printf("✅ Returned OAuth callback HTML page\n")
 }
@@ -472,25 +399,31 @@ func (h *AuthHandler) handleGoogleOAuthFlow(w http.ResponseWriter, r *http.Reque
 
 	// 1. 使用授权码换取访问令牌
 	fmt.Printf("🔄 Exchanging Google authorization code for access token...\n")
-    accessToken, err := h.exchangeGoogleCodeVerbose(code)
+    accessToken, err := h.exchangeGoogleCodeVerbose(r.Context(), code)
 	if err != nil {
 		fmt.Printf("❌ Failed to exchange Google code: %v\n", err)
-		h.handleOAuthError(w, r, clientType, "token_exchange_failed", "Failed to exchange code for token: "+err.Error())
+		h.handleOAuthError(w, r, clientType, "token_exchange_failed", "Failed to exchange code for token", err)
 		return
 	}
 	fmt.Printf("✅ Successfully obtained Google access token\n")
 
 	// 2. 使用访问令牌获取用户信息
-	googleUser, err := h.getGoogleUserInfo(accessToken)
+	googleUser, err := h.getGoogleUserInfo(r.Context(), accessToken)
 	if err != nil {
-		h.handleOAuthError(w, r, clientType, "user_info_failed", "Failed to get user info: "+err.Error())
+		h.handleOAuthError(w, r, clientType, "user_info_failed", "Failed to get user info", err)
 		return
 	}
 
     // 3. 在数据库中查找或创建用户
-    user, err := h.findOrCreateUser(googleUser.Email, googleUser.Name, googleUser.Picture, "google")
+    user, err := h.findOrCreateUser(oauthProfile{
+        Provider:       "google",
+        ProviderUserID: googleUser.ID,
+        Email:          googleUser.Email,
+        Name:           googleUser.Name,
+        Avatar:         googleUser.Picture,
+    })
     if err != nil {
-        h.handleOAuthError(w, r, clientType, "user_creation_failed", "Failed to create user: "+err.Error())
+        h.handleOAuthUserError(w, r, clientType, err)
         return
     }
 
@@ -499,12 +432,19 @@ func (h *AuthHandler) handleGoogleOAuthFlow(w http.ResponseWriter, r *http.Reque
 
     // 4. 生成JWT令牌
     jwtService := utils.NewJWTService(h.config.JWTSecret)
-    accessTokenJWT, refreshToken, expiresIn, err := jwtService.GenerateTokenPair(user.ID, user.Email)
+    profile, err := tokenProfile(h.db, user.ID)
+    if err != nil {
+        h.handleOAuthError(w, r, clientType, "token_generation_failed", "Failed to generate tokens", err)
+        return
+    }
+    accessTokenJWT, refreshToken, expiresIn, err := jwtService.GenerateTokenPair(user.ID, user.Email, profile)
     if err != nil {
-        h.handleOAuthError(w, r, clientType, "token_generation_failed", "Failed to generate tokens: "+err.Error())
+        h.handleOAuthError(w, r, clientType, "token_generation_failed", "Failed to generate tokens", err)
         return
     }
 
+    h.recordLogin(r, user, models.LoginMethodGoogle)
+
     // 5. 返回响应 - 根据客户端类型选择格式
     h.handleOAuthSuccess(w, r, clientType, user, accessTokenJWT, refreshToken, expiresIn, orgID)
 }
@@ -519,61 +459,55 @@ func (h *AuthHandler) handleGitHubOAuthFlow(w http.ResponseWriter, r *http.Reque
 	fmt.Printf("🔍 Detected client type: %s\n", clientType)
 
 	// 2. 交换授权码为访问令牌
-	accessToken, err := h.exchangeGitHubCodeForToken(code)
+	accessToken, err := h.exchangeGitHubCodeForToken(r.Context(), code)
 	if err != nil {
-		h.handleOAuthError(w, r, clientType, "token_exchange_failed", "Failed to exchange code for token: "+err.Error())
+		h.handleOAuthError(w, r, clientType, "token_exchange_failed", "Failed to exchange code for token", err)
 		return
 	}
 
 	// 3. 获取用户信息
-	githubUser, err := h.getGitHubUserInfo(accessToken)
+	githubUser, err := h.getGitHubUserInfo(r.Context(), accessToken)
 	if err != nil {
-		h.handleOAuthError(w, r, clientType, "user_info_failed", "Failed to get user info: "+err.Error())
+		h.handleOAuthError(w, r, clientType, "user_info_failed", "Failed to get user info", err)
 		return
 	}
 
-	// 4. 创建或更新用户
-	user := &models.User{
-		Email:     githubUser.Email,
-		Name:      githubUser.Name,
-		Avatar:    githubUser.AvatarURL,
-		Provider:  "github",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	// 没有任何可用标识时返回结构化错误，由客户端提示用户公开邮箱或改用其他登录方式
+	if githubUser.Email == "" {
+		h.handleOAuthError(w, r, clientType, "needs_email", "GitHub account has no accessible email address", nil)
+		return
 	}
 
-	// 检查用户是否已存在
-	existingUser, err := h.db.GetUserByEmail(user.Email)
-	if err == nil && existingUser != nil {
-		// 更新现有用户
-		user.ID = existingUser.ID
-		user.CreatedAt = existingUser.CreatedAt
-		err = h.db.UpdateUser(user)
-		if err != nil {
-			h.handleOAuthError(w, r, clientType, "user_update_failed", "Failed to update user: "+err.Error())
-			return
-		}
-		fmt.Printf("👤 Found existing user %s, updated OAuth info (provider: github)\n", user.Email)
-	} else {
-		// 创建新用户
-		err = h.db.CreateUser(user)
-		if err != nil {
-			h.handleOAuthError(w, r, clientType, "user_creation_failed", "Failed to create user: "+err.Error())
-			return
-		}
-		fmt.Printf("👤 Created new user %s via GitHub OAuth\n", user.Email)
+	// 4. 按 GitHub 用户 ID 查找或创建用户
+	user, err := h.findOrCreateUser(oauthProfile{
+		Provider:       "github",
+		ProviderUserID: strconv.Itoa(githubUser.ID),
+		Email:          githubUser.Email,
+		Name:           githubUser.Name,
+		Avatar:         githubUser.AvatarURL,
+	})
+	if err != nil {
+		h.handleOAuthUserError(w, r, clientType, err)
+		return
 	}
 
+    // 4.1 首次登录引导：须在签发令牌之前，创建组织会递增 token_version（见 organizations_token_version 触发器）
+    orgID, _ := h.ensureDefaultOrgAndSpace(user)
+
     // 5. 生成JWT令牌
     jwtService := utils.NewJWTService(h.config.JWTSecret)
-    accessTokenJWT, refreshToken, expiresIn, err := jwtService.GenerateTokenPair(user.ID, user.Email)
+    profile, err := tokenProfile(h.db, user.ID)
     if err != nil {
-        h.handleOAuthError(w, r, clientType, "token_generation_failed", "Failed to generate tokens: "+err.Error())
+        h.handleOAuthError(w, r, clientType, "token_generation_failed", "Failed to generate tokens", err)
+        return
+    }
+    accessTokenJWT, refreshToken, expiresIn, err := jwtService.GenerateTokenPair(user.ID, user.Email, profile)
+    if err != nil {
+        h.handleOAuthError(w, r, clientType, "token_generation_failed", "Failed to generate tokens", err)
         return
     }
 
-    // 5.1 首次登录引导
-    orgID, _ := h.ensureDefaultOrgAndSpace(user)
+    h.recordLogin(r, user, models.LoginMethodGitHub)
 
     // 6. 返回响应
     h.handleOAuthSuccess(w, r, clientType, user, accessTokenJWT, refreshToken, expiresIn, orgID)
@@ -581,6 +515,7 @@ func (h *AuthHandler) handleGitHubOAuthFlow(w http.ResponseWriter, r *http.Reque
 
 // GoogleOAuthCallback Google OAuth回调
 func (h *AuthHandler) GoogleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 获取查询参数
 	code := r.URL.Query().Get("code")
 	state := r.URL.Query().Get("state") // 获取state参数用于客户端类型检测
@@ -629,22 +564,30 @@ func (h *AuthHandler) GitHubOAuthCallback(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// HealthCheck 健康检查
+// HealthCheck 健康检查；数据库不可用（连接失败时上下文中没有数据库）时以 503 报告 degraded
 func (h *AuthHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 测试数据库连接
-	dbStatus := "healthy"
-	if err := h.db.HealthCheck(); err != nil {
-		dbStatus = "unhealthy: " + err.Error()
+	status, dbStatus := "healthy", "healthy"
+	if h.db == nil {
+		status, dbStatus = "degraded", "unavailable"
+	} else if err := h.db.HealthCheck(); err != nil {
+		status, dbStatus = "degraded", "unhealthy: "+err.Error()
 	}
 
-	utils.WriteSuccessResponse(w, map[string]interface{}{
+	code := http.StatusOK
+	if status != "healthy" {
+		code = http.StatusServiceUnavailable
+		utils.SetRetryAfter(w, utils.DefaultRetryAfter)
+	}
+	utils.WriteJSONResponse(w, code, map[string]interface{}{
 		"service":     "tab-sync-backend-refactor",
 		"version":     "1.0.0",
 		"environment": h.config.Environment,
 		"database":    h.getDatabaseType(),
 		"db_status":   dbStatus,
 		"timestamp":   time.Now().Unix(),
-		"status":      "healthy",
+		"status":      status,
 	})
 }
 
@@ -658,8 +601,21 @@ func (h *AuthHandler) getDatabaseType() string {
     return "unknown"
 }
 
+// oauthHTTPClient 访问 OAuth 提供方的客户端，每次调用产生一个子 Span
+var oauthHTTPClient = tracing.NewHTTPClient(10 * time.Second)
+
+// postForm 等价于 http.PostForm，但携带请求上下文
+func postForm(ctx context.Context, endpoint string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return oauthHTTPClient.Do(req)
+}
+
 // exchangeGoogleCode 使用授权码换取访问令牌
-func (h *AuthHandler) exchangeGoogleCode(code string) (string, error) {
+func (h *AuthHandler) exchangeGoogleCode(ctx context.Context, code string) (string, error) {
 	// 构建请求参数
 	data := url.Values{}
 	data.Set("client_id", h.config.GoogleClientID)
@@ -674,7 +630,7 @@ func (h *AuthHandler) exchangeGoogleCode(code string) (string, error) {
 	fmt.Printf("   - Code length: %d\n", len(code))
 
 	// 发送POST请求到Google
-	resp, err := http.PostForm("https://oauth2.googleapis.com/token", data)
+	resp, err := postForm(ctx, "https://oauth2.googleapis.com/token", data)
 	if err != nil {
 		return "", fmt.Errorf("failed to exchange code: %w", err)
 	}
@@ -699,7 +655,7 @@ func (h *AuthHandler) exchangeGoogleCode(code string) (string, error) {
 }
 
 // exchangeGoogleCodeVerbose 和 exchangeGoogleCode 行为一致，但增加更详细的响应体/提示日志，便于本地排查
-func (h *AuthHandler) exchangeGoogleCodeVerbose(code string) (string, error) {
+func (h *AuthHandler) exchangeGoogleCodeVerbose(ctx context.Context, code string) (string, error) {
     data := url.Values{}
     data.Set("client_id", h.config.GoogleClientID)
     data.Set("client_secret", h.config.GoogleClientSecret)
@@ -716,7 +672,7 @@ func (h *AuthHandler) exchangeGoogleCodeVerbose(code string) (string, error) {
     fmt.Printf("   - Redirect URI: %s\n", h.config.OAuthRedirectURI)
     fmt.Printf("   - Code length: %d\n", len(code))
 
-    resp, err := http.PostForm("https://oauth2.googleapis.com/token", data)
+    resp, err := postForm(ctx, "https://oauth2.googleapis.com/token", data)
     if err != nil { return "", fmt.Errorf("failed to exchange code: %w", err) }
     defer resp.Body.Close()
 
@@ -752,9 +708,9 @@ func (h *AuthHandler) exchangeGoogleCodeVerbose(code string) (string, error) {
 }
 
 // getGoogleUserInfo 使用访问令牌获取用户信息
-func (h *AuthHandler) getGoogleUserInfo(accessToken string) (*GoogleUser, error) {
+func (h *AuthHandler) getGoogleUserInfo(ctx context.Context, accessToken string) (*GoogleUser, error) {
 	// 创建请求
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -763,8 +719,7 @@ func (h *AuthHandler) getGoogleUserInfo(accessToken string) (*GoogleUser, error)
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
 	// 发送请求
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := oauthHTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -784,44 +739,6 @@ func (h *AuthHandler) getGoogleUserInfo(accessToken string) (*GoogleUser, error)
 	return &user, nil
 }
 
-// findOrCreateUser 查找或创建用户
-func (h *AuthHandler) findOrCreateUser(email, name, avatar, provider string) (*models.User, error) {
-	// 先尝试查找现有用户
-	user, err := h.db.GetUserByEmail(email)
-	if err == nil {
-		// 用户已存在，更新OAuth信息
-		user.Name = name
-		user.Avatar = avatar
-		user.Provider = provider
-		user.UpdatedAt = time.Now()
-
-		if err := h.db.UpdateUser(user); err != nil {
-			return nil, fmt.Errorf("failed to update user: %w", err)
-		}
-
-		fmt.Printf("👤 Found existing user %s, updated OAuth info (provider: %s)\n", user.Email, provider)
-		return user, nil
-	}
-
-	// 用户不存在，创建新用户
-	newUser := &models.User{
-		// ID will be auto-generated by PostgreSQL
-		Email:     email,
-		Name:      name,
-		Provider:  provider,
-		Avatar:    avatar,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	if err := h.db.CreateUser(newUser); err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
-	}
-
-	fmt.Printf("👤 Created new OAuth user %s (provider: %s)\n", newUser.Email, provider)
-	return newUser, nil
-}
-
 // handleChromeExtensionSuccess 处理Chrome扩展的成功响应
 func (h *AuthHandler) handleChromeExtensionSuccess(w http.ResponseWriter, r *http.Request, user *models.User, accessToken, refreshToken string, expiresIn int64) {
 	// 对于Chrome扩展，我们需要重定向到一个包含token信息的URL
@@ -866,97 +783,24 @@ func (h *AuthHandler) ExtensionOAuthCallback(w http.ResponseWriter, r *http.Requ
 	avatar := params.Get("avatar")
 	provider := params.Get("provider")
 
-	// 构建HTML页面，显示OAuth结果
-	html := fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>OAuth Success - Chrome Extension</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
-            display: flex;
-            justify-content: center;
-            align-items: center;
-            min-height: 100vh;
-            margin: 0;
-            background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
-            color: white;
-        }
-        .container {
-            text-align: center;
-            padding: 2rem;
-            background: rgba(255, 255, 255, 0.1);
-            border-radius: 10px;
-            backdrop-filter: blur(10px);
-            box-shadow: 0 8px 32px rgba(0, 0, 0, 0.1);
-        }
-        .success-icon {
-            font-size: 4rem;
-            margin-bottom: 1rem;
-        }
-        .user-info {
-            margin: 1rem 0;
-            padding: 1rem;
-            background: rgba(255, 255, 255, 0.1);
-            border-radius: 8px;
-        }
-        .close-message {
-            margin-top: 2rem;
-            opacity: 0.8;
-            font-size: 0.9rem;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="success-icon">✅</div>
-        <h1>OAuth Authentication Successful!</h1>
-        <p>You have successfully authenticated with %s.</p>
-
-        <div class="user-info">
-            <h3>Welcome, %s!</h3>
-            <p>Email: %s</p>
-            <p>User ID: %s</p>
-        </div>
-
-        <div class="close-message">
-            <p>This window will close automatically.</p>
-            <p>You can now return to the extension.</p>
-        </div>
-    </div>
-
-    <script>
-        // 自动关闭窗口（如果是弹窗）
-        setTimeout(() => {
-            if (window.opener) {
-                window.close();
-            }
-        }, 3000);
-
-        // 记录OAuth参数供Chrome Identity API使用
-        console.log('OAuth Success Parameters:', {
-            success: '%s',
-            access_token: '%s',
-            refresh_token: '%s',
-            expires_in: '%s',
-            user_id: '%s',
-            email: '%s',
-            name: '%s',
-            avatar: '%s',
-            provider: '%s'
-        });
-    </script>
-</body>
-</html>`,
-		provider, name, email, userID,
-		success, accessToken, refreshToken, expiresIn, userID, email, name, avatar, provider)
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(html))
+	// 渲染OAuth结果页面（templates/extension_callback.html）；参数均来自 URL，由模板按上下文转义
+	renderPage(w, "extension_callback.html", map[string]interface{}{
+		"Provider": provider,
+		"Name":     name,
+		"Email":    email,
+		"UserID":   userID,
+		"Params": map[string]string{
+			"success":       success,
+			"access_token":  accessToken,
+			"refresh_token": refreshToken,
+			"expires_in":    expiresIn,
+			"user_id":       userID,
+			"email":         email,
+			"name":          name,
+			"avatar":        avatar,
+			"provider":      provider,
+		},
+	})
 
 	fmt.Printf("✅ Extension OAuth callback page served successfully\n")
 }
@@ -1106,16 +950,16 @@ func (h *AuthHandler) handleOAuthSuccess(w http.ResponseWriter, r *http.Request,
 }
 
 // handleOAuthError 处理OAuth错误响应
-func (h *AuthHandler) handleOAuthError(w http.ResponseWriter, r *http.Request, clientType ClientType, errorCode, errorMessage string) {
+// cause 仅记录到日志，不会回显给客户端
+func (h *AuthHandler) handleOAuthError(w http.ResponseWriter, r *http.Request, clientType ClientType, errorCode, errorMessage string, cause error) {
+	fmt.Printf("[error] oauth %s: %s: %v\n", errorCode, errorMessage, cause)
 	switch clientType {
 	case ClientTypeExtension:
 		h.handleChromeExtensionError(w, r, errorCode, errorMessage)
-	case ClientTypeAPI:
-		utils.WriteInternalServerErrorResponse(w, errorMessage)
 	case ClientTypeWeb:
 		h.handleWebClientError(w, r, errorCode, errorMessage)
 	default:
-		utils.WriteInternalServerErrorResponse(w, errorMessage)
+		utils.WriteErrorResponseWithCode(w, http.StatusInternalServerError, strings.ToUpper(errorCode), errorMessage, "")
 	}
 }
 
@@ -1184,7 +1028,7 @@ func (h *AuthHandler) getFrontendCallbackURL() string {
 }
 
 // exchangeGitHubCodeForToken 交换GitHub授权码为访问令牌
-func (h *AuthHandler) exchangeGitHubCodeForToken(code string) (string, error) {
+func (h *AuthHandler) exchangeGitHubCodeForToken(ctx context.Context, code string) (string, error) {
 	// 构建请求数据
 	data := url.Values{}
 	data.Set("client_id", h.config.GitHubClientID)
@@ -1197,7 +1041,7 @@ func (h *AuthHandler) exchangeGitHubCodeForToken(code string) (string, error) {
 	fmt.Printf("   - Code length: %d\n", len(code))
 
 	// 发送POST请求到GitHub
-	resp, err := http.PostForm("https://github.com/login/oauth/access_token", data)
+	resp, err := postForm(ctx, "https://github.com/login/oauth/access_token", data)
 	if err != nil {
 		return "", fmt.Errorf("failed to exchange code: %w", err)
 	}
@@ -1232,9 +1076,9 @@ func (h *AuthHandler) exchangeGitHubCodeForToken(code string) (string, error) {
 }
 
 // getGitHubUserInfo 获取GitHub用户信息
-func (h *AuthHandler) getGitHubUserInfo(accessToken string) (*GitHubUser, error) {
+func (h *AuthHandler) getGitHubUserInfo(ctx context.Context, accessToken string) (*GitHubUser, error) {
 	// 创建请求
-	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -1244,8 +1088,7 @@ func (h *AuthHandler) getGitHubUserInfo(accessToken string) (*GitHubUser, error)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
 	// 发送请求
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := oauthHTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -1264,7 +1107,7 @@ func (h *AuthHandler) getGitHubUserInfo(accessToken string) (*GitHubUser, error)
 
 	// 如果用户没有公开邮箱，需要单独获取
 	if githubUser.Email == "" {
-		email, err := h.getGitHubUserEmail(accessToken)
+		email, err := h.getGitHubUserEmail(ctx, accessToken)
 		if err != nil {
 			fmt.Printf("⚠️ Failed to get GitHub user email: %v\n", err)
 		} else {
@@ -1272,14 +1115,26 @@ func (h *AuthHandler) getGitHubUserInfo(accessToken string) (*GitHubUser, error)
 		}
 	}
 
+	// 仍然没有邮箱（邮箱全部私有且 user:email 接口失败）时，使用 GitHub 的 noreply 地址作为确定性替代，
+	// 避免以空邮箱查找/创建用户
+	if githubUser.Email == "" && githubUser.Login != "" {
+		githubUser.Email = githubNoreplyEmail(githubUser.Login)
+		fmt.Printf("⚠️ GitHub user %s has no accessible email, using %s\n", githubUser.Login, githubUser.Email)
+	}
+
 	fmt.Printf("👤 Retrieved GitHub user info: %s (%s)\n", githubUser.Login, githubUser.Email)
 	return &githubUser, nil
 }
 
+// githubNoreplyEmail GitHub 用户无可用邮箱时的替代地址
+func githubNoreplyEmail(login string) string {
+	return strings.ToLower(login) + "@users.noreply.github.com"
+}
+
 // getGitHubUserEmail 获取GitHub用户的主邮箱
-func (h *AuthHandler) getGitHubUserEmail(accessToken string) (string, error) {
+func (h *AuthHandler) getGitHubUserEmail(ctx context.Context, accessToken string) (string, error) {
 	// 创建请求
-	req, err := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user/emails", nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -1289,8 +1144,7 @@ func (h *AuthHandler) getGitHubUserEmail(accessToken string) (string, error) {
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
 	// 发送请求
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := oauthHTTPClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to get user emails: %w", err)
 	}
@@ -1324,38 +1178,12 @@ func (h *AuthHandler) getGitHubUserEmail(accessToken string) (string, error) {
 	return "", fmt.Errorf("no email found")
 }
 
-// getClientIP 获取客户端IP地址
-func (h *AuthHandler) getClientIP(r *http.Request) string {
-	// 检查X-Forwarded-For头（代理环境）
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	// 检查X-Real-IP头
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// 使用RemoteAddr
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
-	}
-
-	return ip
-}
-
-// generateSessionCode 生成会话码
+// generateSessionCode 生成定价页会话码（pricing_session 类型的短期 JWT）
 func (h *AuthHandler) generateSessionCode(userID, email, name, clientIP string) (string, error) {
-	// 简单实现：使用JWT作为session code
-	// 创建包含用户信息的临时token
 	jwtService := utils.NewJWTService(h.config.JWTSecret)
-
-	// 生成一个短期的session token（5分钟有效期）
-	sessionToken, _, _, err := jwtService.GenerateTokenPair(userID, email)
+	sessionToken, _, err := jwtService.GeneratePricingSessionToken(userID, email)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate session token: %w", err)
+		return "", err
 	}
 
 	fmt.Printf("🔑 Generated session code for user %s from IP %s\n", email, clientIP)
@@ -1364,6 +1192,7 @@ func (h *AuthHandler) generateSessionCode(userID, email, name, clientIP string)
 
 // ExchangeSession 交换会话码获取用户信息
 func (h *AuthHandler) ExchangeSession(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	fmt.Printf("🔍 ExchangeSession: Request received\n")
 
 	// 解析请求体
@@ -1372,7 +1201,7 @@ func (h *AuthHandler) ExchangeSession(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		fmt.Printf("❌ ExchangeSession: Invalid request body: %v\n", err)
-		utils.WriteBadRequestResponse(w, "Invalid request body")
+		writeBodyError(w, err, "Invalid request body")
 		return
 	}
 
@@ -1384,22 +1213,52 @@ func (h *AuthHandler) ExchangeSession(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Printf("🔍 ExchangeSession: Session code received (length: %d)\n", len(req.SessionCode))
 
+	// 签名校验前只按 IP 计数，邮箱锁定只针对已验证令牌的主体
+	ip := middleware.ClientIP(r)
+	if retry := h.guard.lockedFor(r.Context(), "", ip); retry > 0 {
+		writeAuthLocked(w, retry)
+		return
+	}
+
 	// 解析JWT token获取用户信息
-	_, email, err := h.validateSessionCode(req.SessionCode)
+	claims, err := h.validateSessionCode(req.SessionCode)
 	if err != nil {
 		fmt.Printf("❌ Session validation failed: %v\n", err)
+		h.guard.recordFailure(r, h.db, "", ip)
 		utils.WriteUnauthorizedResponse(w, "Invalid or expired session")
 		return
 	}
+	email := claims.Email
+	if retry := h.guard.lockedFor(r.Context(), email, ""); retry > 0 {
+		writeAuthLocked(w, retry)
+		return
+	}
+
+	// 会话码只能兑换一次
+	first, err := h.db.ConsumeSessionCode(claims.JTI, claims.UserID, time.Unix(claims.Exp, 0))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !first {
+		fmt.Printf("❌ Session code replayed for user %s\n", claims.UserID)
+		h.guard.recordFailure(r, h.db, email, ip)
+		h.alerts.tokenReuse(r, h.db, claims.UserID, claims.Email, claims.JTI)
+		utils.WriteAppError(w, utils.ErrInvalidToken.WithMessage("Session code has already been used"))
+		return
+	}
+	h.guard.recordSuccess(r.Context(), email)
 
 	// 从数据库获取完整的用户信息
 	user, err := h.db.GetUserByEmail(email)
 	if err != nil {
 		fmt.Printf("❌ Failed to get user info: %v\n", err)
-		utils.WriteNotFoundResponse(w, "User not found")
+		writeError(w, err)
 		return
 	}
 
+	h.recordLogin(r, user, models.LoginMethodSessionCode)
+
 	// 返回用户信息
 	response := map[string]interface{}{
 		"user": map[string]interface{}{
@@ -1413,51 +1272,32 @@ func (h *AuthHandler) ExchangeSession(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("✅ Session exchanged for user %s\n", user.Email)
 }
 
-// validateSessionCode 验证会话码并提取用户信息
-func (h *AuthHandler) validateSessionCode(sessionCode string) (userID, email string, err error) {
-	// 解析JWT token
-	parts := strings.Split(sessionCode, ".")
-	if len(parts) != 3 {
-		return "", "", fmt.Errorf("invalid session code format")
-	}
-
-	// 直接解析payload部分
-	payload := parts[1]
-	// 添加padding如果需要
-	for len(payload)%4 != 0 {
-		payload += "="
-	}
-
-	payloadBytes, err := base64.URLEncoding.DecodeString(payload)
+// validateSessionCode 验证会话码签名、有效期与类型，返回其声明（含用于一次性校验的 JTI）
+func (h *AuthHandler) validateSessionCode(sessionCode string) (*models.TokenClaims, error) {
+	claims, err := utils.NewJWTService(h.config.JWTSecret).ValidatePricingSessionToken(sessionCode)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to decode payload: %w", err)
+		return nil, err
 	}
-
-	// 解析JSON
-	var claims map[string]interface{}
-	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
-		return "", "", fmt.Errorf("failed to parse claims: %w", err)
-	}
-
-	// 检查过期时间
-	if exp, ok := claims["exp"].(float64); ok {
-		if time.Now().Unix() > int64(exp) {
-			return "", "", fmt.Errorf("session expired")
-		}
+	if claims.UserID == "" || claims.Email == "" || claims.JTI == "" {
+		return nil, fmt.Errorf("missing user or id in session")
 	}
+	return claims, nil
+}
 
-	// 提取用户信息
-	if userIDClaim, ok := claims["user_id"].(string); ok {
-		userID = userIDClaim
-	} else {
-		return "", "", fmt.Errorf("missing user_id in session")
+// Unlock 解锁邮件中的链接：校验签名与有效期后清除该邮箱的失败计数与锁定
+func (h *AuthHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	email := models.NormalizeEmail(q.Get("email"))
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if email == "" || err != nil || time.Now().Unix() > expires ||
+		!utils.VerifySignedValue(h.config.JWTSecret, unlockPayload(email, expires), q.Get("sig")) {
+		renderPage(w, "unlocked.html", map[string]interface{}{"OK": false})
+		return
 	}
-
-	if emailClaim, ok := claims["email"].(string); ok {
-		email = emailClaim
-	} else {
-		return "", "", fmt.Errorf("missing email in session")
+	if err := h.guard.unlock(r.Context(), email); err != nil {
+		writeError(w, err)
+		return
 	}
-
-	return userID, email, nil
+	fmt.Printf("🔓 Auth unlocked for %s via email link\n", email)
+	renderPage(w, "unlocked.html", map[string]interface{}{"OK": true})
 }
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/storage"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// capabilityTiers capabilities 中列出限额的等级
+var capabilityTiers = []models.UserTier{models.TierFree, models.TierPro, models.TierPower}
+
+// Capabilities GET /api/capabilities：本部署启用的功能与各等级限额（公开路由，内容只随配置变化），
+// 扩展据此调整界面，而不是硬编码服务端假设。只描述部署级能力；用户级开关见 /api/flags
+func (h *ClientHandler) Capabilities(w http.ResponseWriter, r *http.Request) {
+	cfg := h.config
+
+	billingProvider := "none"
+	if cfg.PaddleAPIKey != "" {
+		billingProvider = "paddle"
+	}
+	authProviders := []string{}
+	if cfg.GoogleClientID != "" {
+		authProviders = append(authProviders, "google")
+	}
+	if cfg.GitHubClientID != "" {
+		authProviders = append(authProviders, "github")
+	}
+
+	// 限额（0 表示不限）；组织每日配额包含 ORG_DAILY_QUOTAS 覆盖
+	quotas := middleware.NewOrgQuotas(cfg)
+	tiers := map[models.UserTier]models.TierLimits{}
+	for _, tier := range capabilityTiers {
+		limits := tier.Limits()
+		limits.DailyReadRequests = quotas.Limit(tier, middleware.QuotaClassRead)
+		limits.DailyWriteRequests = quotas.Limit(tier, middleware.QuotaClassWrite)
+		tiers[tier] = limits
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"ai":       map[string]interface{}{"enabled": false}, // /api/ai/* 尚未实现
+		"realtime": map[string]interface{}{"enabled": false}, // 无推送通道，客户端轮询
+		"billing": map[string]interface{}{
+			"provider":   billingProvider,
+			"lifetime":   cfg.PaddleLifetimeProPriceID != "" || cfg.PaddleLifetimePowerPriceID != "",
+			"trial_days": cfg.TrialDays,
+		},
+		"auth":        map[string]interface{}{"providers": authProviders},
+		"encryption":  map[string]interface{}{"enabled": cfg.EncryptionMasterKey != ""},
+		"storage":     map[string]interface{}{"enabled": storage.Configured(cfg)},
+		"geoip":       map[string]interface{}{"enabled": cfg.GeoIPProvider != ""},
+		"image_proxy": map[string]interface{}{"enabled": len(cfg.ImageProxyHosts) > 0},
+		"snapshots": map[string]interface{}{
+			"max_bytes":          cfg.MaxSnapshotBytes,
+			"max_groups":         cfg.MaxSnapshotGroups,
+			"max_group_tabs":     cfg.MaxSnapshotGroupTabs,
+			"max_url_length":     cfg.MaxSnapshotURLLength,
+			"upload_max_bytes":   cfg.MaxSnapshotUploadBytes,
+			"upload_chunk_bytes": snapshotUploadChunkBytes,
+		},
+		"client": map[string]interface{}{
+			"min_version":    cfg.MinClientVersion,
+			"latest_version": cfg.LatestClientVersion,
+		},
+		"tiers": tiers,
+	})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 客户端版本状态
+const (
+	clientStatusOK          = "ok"
+	clientStatusDeprecated  = "deprecated"  // 仍可使用，建议更新
+	clientStatusUnsupported = "unsupported" // 低于最低版本，API 返回 426
+	clientStatusUnknown     = "unknown"     // 未携带或无法解析版本
+)
+
+// ClientHandler 浏览器扩展的版本检查
+type ClientHandler struct {
+	config *config.Config
+}
+
+// NewClientHandler 创建客户端版本处理器
+func NewClientHandler(cfg *config.Config) *ClientHandler {
+	return &ClientHandler{config: cfg}
+}
+
+// clientNotice 弃用提示
+type clientNotice struct {
+	Below   string `json:"below"`
+	Message string `json:"message"`
+}
+
+// Version GET /api/client/version：扩展启动与定期更新检查时调用（公开路由，不受版本门限制），
+// 返回最低支持版本、最新版本与弃用提示；携带 X-Client-Version 时同时给出该版本的状态
+func (h *ClientHandler) Version(w http.ResponseWriter, r *http.Request) {
+	cfg := h.config
+	notices := []clientNotice{}
+	if cfg.ClientDeprecatedBelow != "" {
+		message := cfg.ClientDeprecationMessage
+		if message == "" {
+			message = "This version of the extension will stop working soon. Please update to the latest version."
+		}
+		notices = append(notices, clientNotice{Below: cfg.ClientDeprecatedBelow, Message: message})
+	}
+
+	version := r.Header.Get(middleware.ClientVersionHeader)
+	if version == "" {
+		version = r.URL.Query().Get("version")
+	}
+	status := clientStatusUnknown
+	if middleware.ValidVersion(version) {
+		status = clientStatusOK
+		if cmp, ok := middleware.CompareVersions(version, cfg.ClientDeprecatedBelow); ok && cmp < 0 {
+			status = clientStatusDeprecated
+		}
+		if cmp, ok := middleware.CompareVersions(version, cfg.MinClientVersion); ok && cmp < 0 {
+			status = clientStatusUnsupported
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"client_version":   version,
+		"status":           status,
+		"min_version":      cfg.MinClientVersion,
+		"latest_version":   cfg.LatestClientVersion,
+		"deprecated_below": cfg.ClientDeprecatedBelow,
+		"notices":          notices,
+	})
+}
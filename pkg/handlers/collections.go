@@ -2,6 +2,7 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
     "fmt"
     "net/http"
     "strings"
@@ -22,58 +23,73 @@ type CollectionsHandler struct {
     db     database.DatabaseInterface
 }
 
-func NewCollectionsHandler(cfg *config.Config, db database.DatabaseInterface) *CollectionsHandler {
-    return &CollectionsHandler{config: cfg, db: db}
+func NewCollectionsHandler(cfg *config.Config) *CollectionsHandler {
+    return &CollectionsHandler{config: cfg}
 }
 
-// helper: require edit permission on a space (owner/admin or explicit can_edit)
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *CollectionsHandler) withRequest(r *http.Request) *CollectionsHandler {
+    c := *h
+    c.db = database.FromContext(r.Context())
+    return &c
+}
+
+// helper: require edit permission on a space (owner/admin, default_access=edit, or explicit can_edit)
 func (h *CollectionsHandler) requireSpaceEdit(w http.ResponseWriter, userID, spaceID string) (spaceOrgID string, ok bool) {
     // get space to determine org
-    space, err := h.db.GetSpaceByID(spaceID)
-    if err != nil { utils.WriteNotFoundResponse(w, "space not found"); return "", false }
-    spaceOrgID = space.OrganizationID
-    // owner/admin?
-    members, err := h.db.ListOrganizationMembers(spaceOrgID)
-    if err == nil {
-        for _, m := range members {
-            if m.UserID == userID && (m.Role == models.RoleOwner || m.Role == models.RoleAdmin) {
-                return spaceOrgID, true
-            }
-        }
+    space, err := h.db.GetSpaceByID(userID, spaceID)
+    if err != nil { writeError(w, err); return "", false }
+    access, err := userSpaceAccess(h.db, userID, space)
+    if err != nil { writeError(w, err); return "", false }
+    if !access.CanEdit {
+        utils.WriteAppError(w, utils.ErrForbidden.WithMessage("No edit permission for this space"))
+        return "", false
     }
-    // explicit permission
-    perms, err := h.db.GetSpacePermissions(spaceID)
-    if err == nil {
-        for _, p := range perms {
-            if p.UserID == userID && p.CanEdit { return spaceOrgID, true }
-        }
+    return space.OrganizationID, true
+}
+
+// helper: require view permission on a space (org member, unless the space is restricted)
+func (h *CollectionsHandler) requireSpaceView(w http.ResponseWriter, userID string, space *models.Space) bool {
+    access, err := userSpaceAccess(h.db, userID, space)
+    if err != nil { writeError(w, err); return false }
+    if access.Role == "" { utils.WriteAppError(w, utils.ErrNotOrgMember); return false }
+    if !access.CanView {
+        utils.WriteAppError(w, utils.ErrForbidden.WithMessage("No access to this space"))
+        return false
     }
-    utils.WriteForbiddenResponse(w, "No edit permission for this space")
-    return "", false
+    return true
+}
+
+// helper: whether the calling device (X-Device-ID) syncs this space; ok is false after an error has been written
+func (h *CollectionsHandler) deviceSyncsSpace(w http.ResponseWriter, r *http.Request, userID, spaceID string) (synced, ok bool) {
+    set, err := syncedSpaces(h.db, r, userID)
+    if err != nil { writeError(w, err); return false, false }
+    return set == nil || set[spaceID], true
 }
 
 // GET /api/collections?space_id=
 func (h *CollectionsHandler) ListCollections(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     spaceID := r.URL.Query().Get("space_id")
     if strings.TrimSpace(spaceID) == "" { utils.WriteBadRequestResponse(w, "space_id required"); return }
     // must be org member to view
-    space, err := h.db.GetSpaceByID(spaceID)
-    if err != nil { utils.WriteNotFoundResponse(w, "space not found"); return }
-    // basic membership check
-    members, _ := h.db.ListOrganizationMembers(space.OrganizationID)
-    allowed := false
-    for _, m := range members { if m.UserID == user.ID { allowed = true; break } }
-    if !allowed { utils.WriteForbiddenResponse(w, "Not a member of organization"); return }
+    space, err := h.db.GetSpaceByID(user.ID, spaceID)
+    if err != nil { writeError(w, err); return }
+    if !h.requireSpaceView(w, user.ID, space) { return }
+    // Optional pagination (full list when no page params, as before pagination) and incremental filtering
+    pg := utils.ParsePaginationOrAll(r)
+    // Selective sync: spaces the calling device is not subscribed to sync as empty
+    synced, ok := h.deviceSyncsSpace(w, r, user.ID, spaceID)
+    if !ok { return }
+    if !synced {
+        utils.WriteListResponse(w, []models.Collection{}, pg.Meta(0))
+        return
+    }
     list, err := h.db.ListCollectionsBySpace(spaceID)
-    if err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    if err != nil { writeError(w, err); return }
 
-    // Optional pagination and incremental filtering
-    page := 1
-    pageSize := 20
-    if v := r.URL.Query().Get("page"); v != "" { if n, e := strconv.Atoi(v); e == nil && n > 0 { page = n } }
-    if v := r.URL.Query().Get("page_size"); v != "" { if n, e := strconv.Atoi(v); e == nil && n > 0 && n <= 200 { pageSize = n } }
     // since in milliseconds epoch or RFC3339
     var sinceTime time.Time
     if sv := r.URL.Query().Get("since"); sv != "" {
@@ -101,29 +117,21 @@ func (h *CollectionsHandler) ListCollections(w http.ResponseWriter, r *http.Requ
             if td := c.DeletedAt.UnixMilli(); td > maxDeleted { maxDeleted = td }
         }
     }
-    total := len(filtered)
-    start := (page - 1) * pageSize
-    if start < 0 { start = 0 }
-    if start > total { start = total }
-    end := start + pageSize
-    if end > total { end = total }
-    pageItems := filtered[start:end]
+    // Smart collections are evaluated on read: fill in their counts from the space's current items
+    if err := h.refreshSmartCollections(spaceID, filtered); err != nil { writeError(w, err); return }
+    pageItems, meta := utils.PageOf(filtered, pg)
+    meta.NextSince = maxUpdated
 
     // Set ETag header (weak)
-    etag := fmt.Sprintf("W/\"collections:%s:%d:%d:%d\"", spaceID, total, maxUpdated, maxDeleted)
+    etag := fmt.Sprintf("W/\"collections:%s:%d:%d:%d:%d:%d\"", spaceID, meta.Total, maxUpdated, maxDeleted, pg.Page, pg.PerPage)
     w.Header().Set("ETag", etag)
 
-    utils.WriteSuccessResponse(w, map[string]interface{}{
-        "collections": pageItems,
-        "total":       total,
-        "next_since":  maxUpdated,
-        "page":        page,
-        "page_size":   pageSize,
-    })
+    utils.WriteListResponse(w, pageItems, meta)
 }
 
 // POST /api/collections
 func (h *CollectionsHandler) CreateCollection(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     var req struct{
@@ -133,11 +141,23 @@ func (h *CollectionsHandler) CreateCollection(w http.ResponseWriter, r *http.Req
         Color string `json:"color"`
         Icon string `json:"icon"`
         Position int `json:"position"`
+        Type string `json:"type"`
+        Query *models.SmartQuery `json:"query"`
     }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
     if strings.TrimSpace(req.SpaceID) == "" || strings.TrimSpace(req.Name) == "" {
         utils.WriteBadRequestResponse(w, "space_id and name required"); return
     }
+    if req.Type == "" { req.Type = models.CollectionTypeManual }
+    switch req.Type {
+    case models.CollectionTypeManual:
+        if req.Query != nil { utils.WriteBadRequestResponse(w, "query is only allowed on smart collections"); return }
+    case models.CollectionTypeSmart:
+        if req.Query == nil { utils.WriteBadRequestResponse(w, "query required for smart collections"); return }
+        if err := req.Query.Validate(); err != nil { utils.WriteBadRequestResponse(w, err.Error()); return }
+    default:
+        utils.WriteBadRequestResponse(w, "type must be manual or smart"); return
+    }
     if _, ok := h.requireSpaceEdit(w, user.ID, req.SpaceID); !ok { return }
     c := &models.Collection{
         SpaceID: req.SpaceID,
@@ -146,13 +166,16 @@ func (h *CollectionsHandler) CreateCollection(w http.ResponseWriter, r *http.Req
         Color: req.Color,
         Icon: req.Icon,
         Position: req.Position,
+        Type: req.Type,
+        Query: req.Query,
     }
-    if err := h.db.CreateCollection(c); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    if err := h.db.CreateCollection(c); err != nil { writeError(w, err); return }
     utils.WriteSuccessResponse(w, map[string]interface{}{"collection": c})
 }
 
 // PUT /api/collections/{id}
 func (h *CollectionsHandler) UpdateCollection(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     id := chiRoute.URLParam(r, "id")
@@ -164,12 +187,13 @@ func (h *CollectionsHandler) UpdateCollection(w http.ResponseWriter, r *http.Req
         Color *string `json:"color"`
         Icon *string `json:"icon"`
         Position *int `json:"position"`
+        Query *models.SmartQuery `json:"query"`
     }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
     if strings.TrimSpace(req.SpaceID) == "" { utils.WriteBadRequestResponse(w, "space_id required"); return }
     // load existing
-    existing, err := h.db.GetCollection(id)
-    if err != nil { utils.WriteNotFoundResponse(w, "collection not found"); return }
+    existing, err := h.db.GetCollection(user.ID, id)
+    if err != nil { writeError(w, err); return }
     // permission against its (target) space
     if _, ok := h.requireSpaceEdit(w, user.ID, existing.SpaceID); !ok { return }
     // patch fields
@@ -179,12 +203,24 @@ func (h *CollectionsHandler) UpdateCollection(w http.ResponseWriter, r *http.Req
     if req.Color != nil { existing.Color = *req.Color }
     if req.Icon != nil { existing.Icon = *req.Icon }
     if req.Position != nil { existing.Position = *req.Position }
-    if err := h.db.UpdateCollection(existing); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    if req.Query != nil {
+        // A collection's type is fixed at creation; only smart collections carry a query
+        if !existing.IsSmart() { utils.WriteBadRequestResponse(w, "query is only allowed on smart collections"); return }
+        if err := req.Query.Validate(); err != nil { utils.WriteBadRequestResponse(w, err.Error()); return }
+        existing.Query = req.Query
+    }
+    if err := h.db.UpdateCollection(existing); err != nil { writeError(w, err); return }
+    if existing.IsSmart() {
+        list := []models.Collection{*existing}
+        if err := h.refreshSmartCollections(existing.SpaceID, list); err != nil { writeError(w, err); return }
+        existing = &list[0]
+    }
     utils.WriteSuccessResponse(w, map[string]interface{}{"collection": existing})
 }
 
 // DELETE /api/collections/{id}
 func (h *CollectionsHandler) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     id := chiRoute.URLParam(r, "id")
@@ -192,44 +228,149 @@ func (h *CollectionsHandler) DeleteCollection(w http.ResponseWriter, r *http.Req
     if strings.TrimSpace(id) == "" { utils.WriteBadRequestResponse(w, "id required"); return }
     if strings.TrimSpace(spaceID) == "" {
         // try load collection to infer space id
-        if c, e := h.db.GetCollection(id); e == nil { spaceID = c.SpaceID }
+        if c, e := h.db.GetCollection(user.ID, id); e == nil { spaceID = c.SpaceID }
     }
     if strings.TrimSpace(spaceID) == "" { utils.WriteBadRequestResponse(w, "space_id required"); return }
     if _, ok := h.requireSpaceEdit(w, user.ID, spaceID); !ok { return }
-    if err := h.db.DeleteCollection(id); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    if err := h.db.DeleteCollection(id); err != nil { writeError(w, err); return }
     utils.WriteSuccessResponse(w, map[string]interface{}{"deleted": true, "id": id})
 }
 
-// GET /api/collections/{id}/items
+// GET /api/collections/{id}/context
+// 深链接只带集合 ID：一次返回集合及其空间、组织摘要与当前用户的有效权限，省去客户端三次串行查询
+func (h *CollectionsHandler) GetCollectionContext(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    coll, err := h.db.GetCollection(user.ID, chiRoute.URLParam(r, "id"))
+    if err != nil { writeError(w, err); return }
+    space, err := h.db.GetSpaceByID(user.ID, coll.SpaceID)
+    if err != nil { writeError(w, err); return }
+    access, err := userSpaceAccess(h.db, user.ID, space)
+    if err != nil { writeError(w, err); return }
+    if access.Role == "" { utils.WriteAppError(w, utils.ErrNotOrgMember); return }
+    if !access.CanView {
+        utils.WriteAppError(w, utils.ErrForbidden.WithMessage("No access to this space"))
+        return
+    }
+    if coll.IsSmart() {
+        list := []models.Collection{*coll}
+        if err := h.refreshSmartCollections(space.ID, list); err != nil { writeError(w, err); return }
+        coll = &list[0]
+    }
+    org, err := h.db.GetOrganization(space.OrganizationID)
+    if err != nil { writeError(w, err); return }
+    utils.WriteSuccessResponse(w, map[string]interface{}{
+        "collection": coll,
+        "space": map[string]interface{}{
+            "id":         space.ID,
+            "name":       space.Name,
+            "is_default": space.IsDefault,
+            "visibility": space.Visibility,
+        },
+        "organization": map[string]interface{}{
+            "id":     org.ID,
+            "name":   org.Name,
+            "avatar": org.Avatar,
+            "color":  org.Color,
+        },
+        "access": map[string]interface{}{
+            "role":     access.Role,
+            "can_view": access.CanView,
+            "can_edit": access.CanEdit,
+            "source":   access.Source,
+        },
+    })
+}
+
+// smartCollectionItems evaluates a smart collection's query against the items of its space
+func (h *CollectionsHandler) smartCollectionItems(coll *models.Collection, state string) ([]models.CollectionItem, error) {
+    items, err := h.db.ListItemsBySpace(coll.SpaceID, state)
+    if err != nil { return nil, err }
+    matched := []models.CollectionItem{}
+    if coll.Query == nil { return matched, nil }
+    now := time.Now()
+    for i := range items {
+        if coll.Query.Matches(&items[i], now) { matched = append(matched, items[i]) }
+    }
+    return matched, nil
+}
+
+// refreshSmartCollections sets item_count / last_item_added_at on the smart collections in list
+// (in place), loading the space's active items once; manual collections are left untouched
+func (h *CollectionsHandler) refreshSmartCollections(spaceID string, list []models.Collection) error {
+    var items []models.CollectionItem
+    loaded := false
+    now := time.Now()
+    for i := range list {
+        c := &list[i]
+        if !c.IsSmart() || c.DeletedAt != nil || c.Query == nil { continue }
+        if !loaded {
+            var err error
+            if items, err = h.db.ListItemsBySpace(spaceID, models.ItemStateActive); err != nil { return err }
+            loaded = true
+        }
+        c.ItemCount, c.LastItemAddedAt = 0, nil
+        for j := range items {
+            if !c.Query.Matches(&items[j], now) { continue }
+            c.ItemCount++
+            if c.LastItemAddedAt == nil || items[j].CreatedAt.After(*c.LastItemAddedAt) {
+                added := items[j].CreatedAt
+                c.LastItemAddedAt = &added
+            }
+        }
+    }
+    return nil
+}
+
+// GET /api/collections/{id}/items[?state=active|archived|all]
+// Defaults to active items so archived ones stay out of what the extension syncs.
 func (h *CollectionsHandler) ListItems(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     collectionID := chiRoute.URLParam(r, "id")
     if strings.TrimSpace(collectionID) == "" { utils.WriteBadRequestResponse(w, "collection id required"); return }
-    coll, err := h.db.GetCollection(collectionID)
-    if err != nil { utils.WriteNotFoundResponse(w, "collection not found"); return }
-    // must be org member
-    space, _ := h.db.GetSpaceByID(coll.SpaceID)
-    if space == nil { utils.WriteNotFoundResponse(w, "space not found"); return }
-    members, _ := h.db.ListOrganizationMembers(space.OrganizationID)
-    allowed := false
-    for _, m := range members { if m.UserID == user.ID { allowed = true; break } }
-    if !allowed { utils.WriteForbiddenResponse(w, "Not a member of organization"); return }
-    items, err := h.db.ListItemsByCollection(collectionID)
-    if err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
-    utils.WriteSuccessResponse(w, map[string]interface{}{"items": items})
+    state := r.URL.Query().Get("state")
+    if state == "" { state = models.ItemStateActive }
+    if !models.ValidItemState(state) { utils.WriteBadRequestResponse(w, "state must be active, archived or all"); return }
+    coll, err := h.db.GetCollection(user.ID, collectionID)
+    if err != nil { writeError(w, err); return }
+    // must be able to view the space
+    space, err := h.db.GetSpaceByID(user.ID, coll.SpaceID)
+    if err != nil { writeError(w, err); return }
+    if !h.requireSpaceView(w, user.ID, space) { return }
+    synced, ok := h.deviceSyncsSpace(w, r, user.ID, space.ID)
+    if !ok { return }
+    if !synced {
+        utils.WriteListResponse(w, []models.CollectionItem{}, utils.ParsePaginationOrAll(r).Meta(0))
+        return
+    }
+    var items []models.CollectionItem
+    if coll.IsSmart() {
+        items, err = h.smartCollectionItems(coll, state)
+    } else {
+        items, err = h.db.ListItemsByCollection(collectionID, state)
+    }
+    if err != nil { writeError(w, err); return }
+    // 不带分页参数时返回全部条目（扩展同步依赖完整列表）
+    pageItems, meta := utils.PageOf(items, utils.ParsePaginationOrAll(r))
+    utils.WriteListResponse(w, pageItems, meta)
 }
 
 
 // POST /api/collections/{id}/items
 func (h *CollectionsHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     collectionID := chiRoute.URLParam(r, "id")
     if strings.TrimSpace(collectionID) == "" { utils.WriteBadRequestResponse(w, "collection id required"); return }
-    coll, err := h.db.GetCollection(collectionID)
-    if err != nil { utils.WriteNotFoundResponse(w, "collection not found"); return }
-    if _, ok := h.requireSpaceEdit(w, user.ID, coll.SpaceID); !ok { return }
+    coll, err := h.db.GetCollection(user.ID, collectionID)
+    if err != nil { writeError(w, err); return }
+    orgID, ok := h.requireSpaceEdit(w, user.ID, coll.SpaceID)
+    if !ok { return }
+    if coll.IsSmart() { utils.WriteAppError(w, utils.ErrSmartCollection); return }
     var req struct {
         Title string `json:"title"`
         URL string `json:"url"`
@@ -240,7 +381,9 @@ func (h *CollectionsHandler) CreateItem(w http.ResponseWriter, r *http.Request)
         Metadata map[string]interface{} `json:"metadata"`
         Position int `json:"position"`
     }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
+    warnings, ok := enforceDomainPolicies(w, h.db, orgID, user.ID, policySourceCreate, req.URL)
+    if !ok { return }
     metaJSON, _ := json.Marshal(req.Metadata)
     // Idempotency: compute normalized url (prefer client-provided metadata.normalized_url)
     var metaMap map[string]interface{}
@@ -250,7 +393,11 @@ func (h *CollectionsHandler) CreateItem(w http.ResponseWriter, r *http.Request)
     if strings.TrimSpace(normalizedURL) == "" { normalizedURL = strings.ToLower(strings.TrimSpace(req.URL)) }
     if strings.TrimSpace(normalizedURL) != "" {
         if ex, err := h.db.FindItemByCollectionAndNormalizedURL(collectionID, normalizedURL); err == nil && ex != nil {
-            utils.WriteSuccessResponse(w, map[string]interface{}{"item": ex})
+            // Saving an archived tab again brings it back to the active list
+            if ex.ArchivedAt != nil {
+                if ex, err = h.db.UpdateCollectionItemPartial(ex.ID, map[string]interface{}{"archived_at": (*time.Time)(nil)}); err != nil { writeError(w, err); return }
+            }
+            utils.WriteSuccessResponse(w, withPolicyWarnings(map[string]interface{}{"item": ex}, warnings))
             return
         }
     }
@@ -265,20 +412,24 @@ func (h *CollectionsHandler) CreateItem(w http.ResponseWriter, r *http.Request)
         Metadata: metaJSON,
         Position: req.Position,
     }
-    if err := h.db.CreateCollectionItem(it); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
-    utils.WriteSuccessResponse(w, map[string]interface{}{"item": it})
+    if err := h.db.CreateCollectionItem(it); err != nil { writeError(w, err); return }
+    enqueueWebArchive(r, h.config, h.db, collectionID, []models.CollectionItem{*it})
+    utils.WriteSuccessResponse(w, withPolicyWarnings(map[string]interface{}{"item": it}, warnings))
 }
 
 // POST /api/collections/{id}/items/batch
 func (h *CollectionsHandler) CreateItemsBatch(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     collectionID := chiRoute.URLParam(r, "id")
     if strings.TrimSpace(collectionID) == "" { utils.WriteBadRequestResponse(w, "collection id required"); return }
-    coll, err := h.db.GetCollection(collectionID)
-    if err != nil { utils.WriteNotFoundResponse(w, "collection not found"); return }
+    coll, err := h.db.GetCollection(user.ID, collectionID)
+    if err != nil { writeError(w, err); return }
     // permission against its space
-    if _, ok := h.requireSpaceEdit(w, user.ID, coll.SpaceID); !ok { return }
+    orgID, ok := h.requireSpaceEdit(w, user.ID, coll.SpaceID)
+    if !ok { return }
+    if coll.IsSmart() { utils.WriteAppError(w, utils.ErrSmartCollection); return }
     var req struct { Items []struct {
         Title string `json:"title"`
         URL string `json:"url"`
@@ -289,10 +440,16 @@ func (h *CollectionsHandler) CreateItemsBatch(w http.ResponseWriter, r *http.Req
         Metadata map[string]interface{} `json:"metadata"`
         Position int `json:"position"`
     } `json:"items"` }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
     if len(req.Items) == 0 { utils.WriteBadRequestResponse(w, "items required"); return }
     if len(req.Items) > 200 { utils.WriteBadRequestResponse(w, "too many items (max 200)"); return }
+    // A blocked URL rejects the whole batch before anything is saved
+    urls := make([]string, len(req.Items))
+    for i, it := range req.Items { urls[i] = it.URL }
+    warnings, ok := enforceDomainPolicies(w, h.db, orgID, user.ID, policySourceBatch, urls...)
+    if !ok { return }
     created := make([]models.CollectionItem, 0, len(req.Items))
+    fresh := make([]models.CollectionItem, 0, len(req.Items)) // newly created only, for web archiving
     for _, it := range req.Items {
         metaJSON, _ := json.Marshal(it.Metadata)
         // Idempotency for batch: skip existing by normalized_url
@@ -318,14 +475,17 @@ func (h *CollectionsHandler) CreateItemsBatch(w http.ResponseWriter, r *http.Req
             Metadata: metaJSON,
             Position: it.Position,
         }
-        if err := h.db.CreateCollectionItem(row); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+        if err := h.db.CreateCollectionItem(row); err != nil { writeError(w, err); return }
         created = append(created, *row)
+        fresh = append(fresh, *row)
     }
-    utils.WriteSuccessResponse(w, map[string]interface{}{"items": created})
+    enqueueWebArchive(r, h.config, h.db, collectionID, fresh)
+    utils.WriteSuccessResponse(w, withPolicyWarnings(map[string]interface{}{"items": created}, warnings))
 }
 
 // PUT /api/collection-items/{item_id}
 func (h *CollectionsHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     itemID := chiRoute.URLParam(r, "item_id")
@@ -341,15 +501,33 @@ func (h *CollectionsHandler) UpdateItem(w http.ResponseWriter, r *http.Request)
         Metadata map[string]interface{} `json:"metadata"`
         Position *int `json:"position"`
     }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
-    if strings.TrimSpace(req.CollectionID) == "" { utils.WriteBadRequestResponse(w, "collection_id required"); return }
-    coll, err := h.db.GetCollection(req.CollectionID)
-    if err != nil { utils.WriteNotFoundResponse(w, "collection not found"); return }
-    if _, ok := h.requireSpaceEdit(w, user.ID, coll.SpaceID); !ok { return }
-    // Build partial patch to avoid wiping unspecified fields
-    patch := map[string]interface{}{
-        "collection_id": req.CollectionID,
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
+    // Authorize against the item's actual collection, never the client-supplied collection_id
+    current, ok := h.requireItemEdit(w, user.ID, itemID)
+    if !ok { return }
+    patch := map[string]interface{}{}
+    destOrgID := "" // set when the item moves to another collection
+    if req.CollectionID != "" && req.CollectionID != current.CollectionID {
+        // Moving to another collection also requires edit rights on the target
+        target, err := h.db.GetCollection(user.ID, req.CollectionID)
+        if err != nil { writeError(w, err); return }
+        targetOrgID, ok := h.requireSpaceEdit(w, user.ID, target.SpaceID)
+        if !ok { return }
+        if target.IsSmart() { utils.WriteAppError(w, utils.ErrSmartCollection); return }
+        patch["collection_id"] = req.CollectionID
+        destOrgID = targetOrgID
     }
+    // Content policies of the destination org apply to a changed URL or a move
+    var warnings []policyWarning
+    if req.URL != nil || destOrgID != "" {
+        if destOrgID == "" {
+            if destOrgID, err = h.db.GetCollectionOrganizationID(current.CollectionID); err != nil { writeError(w, err); return }
+        }
+        newURL := current.URL
+        if req.URL != nil { newURL = *req.URL }
+        if warnings, ok = enforceDomainPolicies(w, h.db, destOrgID, user.ID, policySourceUpdate, newURL); !ok { return }
+    }
+    // Build partial patch to avoid wiping unspecified fields
     if req.Title != nil { patch["title"] = *req.Title }
     if req.URL != nil { patch["url"] = *req.URL }
     if req.FavIconURL != nil { patch["fav_icon_url"] = *req.FavIconURL }
@@ -361,20 +539,120 @@ func (h *CollectionsHandler) UpdateItem(w http.ResponseWriter, r *http.Request)
         patch["metadata"] = metaJSON
     }
     if req.Position != nil { patch["position"] = *req.Position }
-    if err := h.db.UpdateCollectionItemPartial(itemID, patch); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
-    utils.WriteSuccessResponse(w, map[string]interface{}{"updated": true, "id": itemID})
+    item, err := h.db.UpdateCollectionItemPartial(itemID, patch)
+    if err != nil { writeError(w, err); return }
+    utils.WriteSuccessResponse(w, withPolicyWarnings(map[string]interface{}{"updated": true, "id": itemID, "item": item}, warnings))
 }
 
-// DELETE /api/collection-items/{item_id}?collection_id=
+// DELETE /api/collection-items/{item_id}[?collection_id=]
 func (h *CollectionsHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     itemID := chiRoute.URLParam(r, "item_id")
-    collID := r.URL.Query().Get("collection_id")
-    if strings.TrimSpace(itemID) == "" || strings.TrimSpace(collID) == "" { utils.WriteBadRequestResponse(w, "item_id and collection_id required"); return }
-    coll, err := h.db.GetCollection(collID)
-    if err != nil { utils.WriteNotFoundResponse(w, "collection not found"); return }
-    if _, ok := h.requireSpaceEdit(w, user.ID, coll.SpaceID); !ok { return }
-    if err := h.db.DeleteCollectionItem(itemID); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    if strings.TrimSpace(itemID) == "" { utils.WriteBadRequestResponse(w, "item id required"); return }
+    item, ok := h.requireItemEdit(w, user.ID, itemID)
+    if !ok { return }
+    // collection_id is optional now; if given it must match the item's actual collection
+    if collID := r.URL.Query().Get("collection_id"); collID != "" && collID != item.CollectionID {
+        utils.WriteAppError(w, utils.ErrItemNotFound)
+        return
+    }
+    if err := h.db.DeleteCollectionItem(item.CollectionID, itemID); err != nil { writeError(w, err); return }
     utils.WriteSuccessResponse(w, map[string]interface{}{"deleted": true, "id": itemID})
 }
+
+// POST /api/collection-items/{item_id}/archive
+func (h *CollectionsHandler) ArchiveItem(w http.ResponseWriter, r *http.Request) {
+    h.setItemArchived(w, r, true)
+}
+
+// POST /api/collection-items/{item_id}/unarchive
+func (h *CollectionsHandler) UnarchiveItem(w http.ResponseWriter, r *http.Request) {
+    h.setItemArchived(w, r, false)
+}
+
+// setItemArchived toggles archived_at; archiving an already archived item keeps its original timestamp
+func (h *CollectionsHandler) setItemArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+    h = h.withRequest(r)
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    itemID := chiRoute.URLParam(r, "item_id")
+    if strings.TrimSpace(itemID) == "" { utils.WriteBadRequestResponse(w, "item id required"); return }
+    item, ok := h.requireItemEdit(w, user.ID, itemID)
+    if !ok { return }
+    if (item.ArchivedAt != nil) != archived {
+        var at *time.Time
+        if archived {
+            now := time.Now().UTC()
+            at = &now
+        }
+        if item, err = h.db.UpdateCollectionItemPartial(itemID, map[string]interface{}{"archived_at": at}); err != nil { writeError(w, err); return }
+    }
+    utils.WriteSuccessResponse(w, map[string]interface{}{"archived": archived, "id": itemID, "item": item})
+}
+
+// itemRevisionsLimit matches the number of revisions the database keeps per item
+const itemRevisionsLimit = 50
+
+// GET /api/collection-items/{item_id}/revisions (newest first)
+func (h *CollectionsHandler) ListItemRevisions(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    itemID := chiRoute.URLParam(r, "item_id")
+    if strings.TrimSpace(itemID) == "" { utils.WriteBadRequestResponse(w, "item id required"); return }
+    item, err := h.db.GetCollectionItem(itemID)
+    if err != nil { writeError(w, err); return }
+    if item.DeletedAt != nil { utils.WriteAppError(w, utils.ErrItemNotFound); return }
+    coll, err := h.db.GetCollection(user.ID, item.CollectionID)
+    if err != nil {
+        if errors.Is(err, database.ErrNotFound) { err = utils.ErrItemNotFound }
+        writeError(w, err)
+        return
+    }
+    space, err := h.db.GetSpaceByID(user.ID, coll.SpaceID)
+    if err != nil { writeError(w, err); return }
+    if !h.requireSpaceView(w, user.ID, space) { return }
+    revisions, err := h.db.ListItemRevisions(itemID, itemRevisionsLimit)
+    if err != nil { writeError(w, err); return }
+    utils.WriteSuccessResponse(w, map[string]interface{}{"item": item, "revisions": revisions})
+}
+
+// POST /api/collection-items/{item_id}/revisions/{revision_id}/revert
+// Restores title/url/metadata from the revision; the values it replaces are recorded as a new revision.
+func (h *CollectionsHandler) RevertItem(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    itemID := chiRoute.URLParam(r, "item_id")
+    if strings.TrimSpace(itemID) == "" { utils.WriteBadRequestResponse(w, "item id required"); return }
+    if _, ok := h.requireItemEdit(w, user.ID, itemID); !ok { return }
+    rev, err := h.db.GetItemRevision(itemID, chiRoute.URLParam(r, "revision_id"))
+    if err != nil { writeError(w, err); return }
+    metadata := []byte(rev.Metadata)
+    if len(metadata) == 0 { metadata = []byte("{}") }
+    item, err := h.db.UpdateCollectionItemPartial(itemID, map[string]interface{}{
+        "title":    rev.Title,
+        "url":      rev.URL,
+        "metadata": metadata,
+    })
+    if err != nil { writeError(w, err); return }
+    utils.WriteSuccessResponse(w, map[string]interface{}{"reverted": true, "id": itemID, "revision_id": rev.ID, "item": item})
+}
+
+// helper: load an active item and require edit permission on the space of the collection it actually belongs to
+func (h *CollectionsHandler) requireItemEdit(w http.ResponseWriter, userID, itemID string) (*models.CollectionItem, bool) {
+    item, err := h.db.GetCollectionItem(itemID)
+    if err != nil { writeError(w, err); return nil, false }
+    if item.DeletedAt != nil { utils.WriteAppError(w, utils.ErrItemNotFound); return nil, false }
+    coll, err := h.db.GetCollection(userID, item.CollectionID)
+    if err != nil {
+        // Items in collections outside the caller's orgs are reported as missing, not forbidden
+        if errors.Is(err, database.ErrNotFound) { err = utils.ErrItemNotFound }
+        writeError(w, err)
+        return nil, false
+    }
+    if _, ok := h.requireSpaceEdit(w, userID, coll.SpaceID); !ok { return nil, false }
+    return item, true
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	chiRoute "github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 发送到设备：单次最多 maxDevicePushURLs 个链接；超过 devicePushTTL 仍未被目标设备处理的推送不再下发
+const (
+	maxDevicePushURLs   = 50
+	maxDevicePushURLLen = 2048
+	devicePushTTL       = 7 * 24 * time.Hour
+)
+
+// validatePushURLs 去除空白项，要求 1..maxDevicePushURLs 个 http(s) 链接
+func validatePushURLs(raw []string) ([]string, error) {
+	urls := make([]string, 0, len(raw))
+	for _, u := range raw {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(u) > maxDevicePushURLLen {
+			return nil, utils.ErrValidation.WithMessage("Invalid URL").WithDetails(u)
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		return nil, utils.ErrValidation.WithMessage("urls is required")
+	}
+	if len(urls) > maxDevicePushURLs {
+		return nil, utils.ErrValidation.WithMessage(fmt.Sprintf("At most %d urls per push", maxDevicePushURLs))
+	}
+	return urls, nil
+}
+
+// PushToDevice 把一组链接发送到同一用户的另一台设备：{"urls": [...]}；来源设备取自 X-Device-ID（可选）
+func (h *DevicesHandler) PushToDevice(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		URLs []string `json:"urls"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	urls, err := validatePushURLs(req.URLs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	target, err := h.db.GetDevice(user.ID, chiRoute.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if target.RevokedAt != nil {
+		utils.WriteAppError(w, utils.ErrBadRequest.WithMessage("Target device has been revoked"))
+		return
+	}
+
+	push := &models.DevicePush{UserID: user.ID, TargetDeviceID: target.ID, URLs: urls}
+	if sourceID := strings.TrimSpace(r.Header.Get(deviceHeader)); sourceID != "" && sourceID != target.ID {
+		if source, err := h.db.GetDevice(user.ID, sourceID); err == nil {
+			push.SourceDeviceID = &source.ID
+		}
+	}
+	if err := h.db.CreateDevicePush(push); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteCreatedResponse(w, push)
+}
+
+// ListDevicePushes 目标设备轮询待打开的推送；返回的推送标记为 delivered，设备处理后调用 AckDevicePush
+func (h *DevicesHandler) ListDevicePushes(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	device, err := h.db.GetDevice(user.ID, chiRoute.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if device.RevokedAt != nil {
+		utils.WriteAppError(w, utils.ErrDeviceRevoked)
+		return
+	}
+	pushes, err := h.db.ClaimDevicePushes(user.ID, device.ID, time.Now().Add(-devicePushTTL))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"pushes": pushes})
+}
+
+// GetDevicePush 发送方查询推送的投递状态
+func (h *DevicesHandler) GetDevicePush(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	push, err := h.db.GetDevicePush(user.ID, chiRoute.URLParam(r, "pushID"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, push)
+}
+
+// AckDevicePush 目标设备回报处理结果：{"status": "opened" | "dismissed"}
+func (h *DevicesHandler) AckDevicePush(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Status models.DevicePushStatus `json:"status"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if req.Status != models.DevicePushOpened && req.Status != models.DevicePushDismissed {
+		utils.WriteValidationErrorResponse(w, "Invalid status", "status must be opened or dismissed")
+		return
+	}
+	pushID := chiRoute.URLParam(r, "pushID")
+	if err := h.db.CompleteDevicePush(user.ID, pushID, req.Status); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"id": pushID, "status": req.Status})
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	chiRoute "github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 超过 deviceStaleAfter 未心跳的设备在账户页标记为 stale，提示用户吊销
+const deviceStaleAfter = 30 * 24 * time.Hour
+
+// 设备字段长度上限（与 devices 表一致）
+const (
+	maxDeviceInstallIDLen = 128
+	maxDeviceNameLen      = 100
+	maxDeviceBrowserLen   = 50
+)
+
+// DevicesHandler 扩展安装的注册、心跳与吊销
+type DevicesHandler struct {
+	config *config.Config
+	db     database.DatabaseInterface
+}
+
+// NewDevicesHandler 创建设备处理器
+func NewDevicesHandler(cfg *config.Config) *DevicesHandler {
+	return &DevicesHandler{config: cfg}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *DevicesHandler) withRequest(r *http.Request) *DevicesHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// deviceView 设备及其是否长期未同步
+type deviceView struct {
+	models.Device
+	Stale bool `json:"stale"`
+}
+
+func newDeviceView(d models.Device, now time.Time) deviceView {
+	return deviceView{Device: d, Stale: d.RevokedAt == nil && now.Sub(d.LastSeen) > deviceStaleAfter}
+}
+
+// RegisterDevice 扩展登录后注册：{"install_id", "name", "browser", "platform"}；同一 install_id 重复注册会更新信息并恢复已吊销的设备。
+// 同时记录注册时的客户端 IP 与 GeoIP 位置，设备列表据此显示登录地点
+func (h *DevicesHandler) RegisterDevice(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		InstallID string `json:"install_id"`
+		Name      string `json:"name"`
+		Browser   string `json:"browser"`
+		Platform  string `json:"platform"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	req.InstallID = strings.TrimSpace(req.InstallID)
+	req.Name = strings.TrimSpace(req.Name)
+	switch {
+	case req.InstallID == "":
+		utils.WriteValidationErrorResponse(w, "install_id is required", "")
+		return
+	case len(req.InstallID) > maxDeviceInstallIDLen:
+		utils.WriteValidationErrorResponse(w, "install_id is too long", "")
+		return
+	case len(req.Name) > maxDeviceNameLen:
+		utils.WriteValidationErrorResponse(w, "name is too long", "")
+		return
+	case len(req.Browser) > maxDeviceBrowserLen || len(req.Platform) > maxDeviceBrowserLen:
+		utils.WriteValidationErrorResponse(w, "browser/platform is too long", "")
+		return
+	}
+
+	ip, loc := locateRequest(h.config, r)
+	device := &models.Device{
+		UserID:      user.ID,
+		InstallID:   req.InstallID,
+		Name:        req.Name,
+		Browser:     req.Browser,
+		Platform:    req.Platform,
+		LastIP:      ip,
+		GeoLocation: loc,
+	}
+	if err := h.db.RegisterDevice(device); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, newDeviceView(*device, time.Now()))
+}
+
+// ListDevices 账户页设备列表（按最近心跳倒序，含已吊销的设备）
+func (h *DevicesHandler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	devices, err := h.db.ListDevices(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	now := time.Now()
+	views := make([]deviceView, 0, len(devices))
+	for _, d := range devices {
+		views = append(views, newDeviceView(d, now))
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"devices": views})
+}
+
+// Heartbeat 扩展定期上报：刷新 last_seen，同步完成后带上 {"sync_cursor": "..."}；已吊销的设备返回 DEVICE_REVOKED
+func (h *DevicesHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		SyncCursor *string `json:"sync_cursor"`
+	}
+	if r.ContentLength != 0 {
+		if err := utils.ParseJSONBody(r, &req); err != nil {
+			writeBodyError(w, err, "Invalid request body")
+			return
+		}
+	}
+
+	device, err := h.db.GetDevice(user.ID, chiRoute.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if device.RevokedAt != nil {
+		utils.WriteAppError(w, utils.ErrDeviceRevoked)
+		return
+	}
+	if err := h.db.TouchDevice(user.ID, device.ID, req.SyncCursor); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"ok": true})
+}
+
+// RevokeDevice 吊销设备；该设备下次心跳时被要求重新登录
+func (h *DevicesHandler) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	if err := h.db.RevokeDevice(user.ID, chiRoute.URLParam(r, "id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"revoked": true})
+}
+
+// deviceHeader 扩展在同步请求中携带的设备 ID（RegisterDevice 返回的 id），用于选择性同步
+const deviceHeader = "X-Device-ID"
+
+// syncedSpaces 返回调用设备订阅的空间集合；未携带设备头、设备不属于当前用户或未配置选择性同步时返回 nil（不过滤）。
+// 已吊销的设备返回 ErrDeviceRevoked
+func syncedSpaces(db database.DatabaseInterface, r *http.Request, userID string) (map[string]bool, error) {
+	deviceID := strings.TrimSpace(r.Header.Get(deviceHeader))
+	if deviceID == "" {
+		return nil, nil
+	}
+	device, err := db.GetDevice(userID, deviceID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if device.RevokedAt != nil {
+		return nil, utils.ErrDeviceRevoked
+	}
+	spaceIDs, err := db.ListDeviceSpaces(device.ID)
+	if err != nil || len(spaceIDs) == 0 {
+		return nil, err
+	}
+	set := make(map[string]bool, len(spaceIDs))
+	for _, id := range spaceIDs {
+		set[id] = true
+	}
+	return set, nil
+}
+
+// GetDeviceSpaces 返回设备的选择性同步配置：{"space_ids": [...], "all": 是否同步全部空间}
+func (h *DevicesHandler) GetDeviceSpaces(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	device, err := h.db.GetDevice(user.ID, chiRoute.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	spaceIDs, err := h.db.ListDeviceSpaces(device.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"space_ids": spaceIDs, "all": len(spaceIDs) == 0})
+}
+
+// SetDeviceSpaces 设置设备同步哪些空间：{"space_ids": [...]}，空数组恢复同步全部空间；每个空间须对当前用户可见
+func (h *DevicesHandler) SetDeviceSpaces(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		SpaceIDs []string `json:"space_ids"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	device, err := h.db.GetDevice(user.ID, chiRoute.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	seen := make(map[string]bool, len(req.SpaceIDs))
+	spaceIDs := make([]string, 0, len(req.SpaceIDs))
+	for _, id := range req.SpaceIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		space, err := h.db.GetSpaceByID(user.ID, id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		access, err := userSpaceAccess(h.db, user.ID, space)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !access.CanView {
+			utils.WriteAppError(w, utils.ErrForbidden.WithMessage("No access to space "+id))
+			return
+		}
+		spaceIDs = append(spaceIDs, space.ID)
+	}
+
+	if err := h.db.SetDeviceSpaces(device.ID, spaceIDs); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"space_ids": spaceIDs, "all": len(spaceIDs) == 0})
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	chiRoute "github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const (
+	// maxDomainPolicies 每个组织的域名策略数上限（每次保存条目都会加载全部策略）
+	maxDomainPolicies = 500
+	// 违规审计列表的默认与最大条数
+	defaultPolicyViolationLimit = 50
+	maxPolicyViolationLimit     = 200
+)
+
+// 违规记录的 source：触发检查的保存入口
+const (
+	policySourceCreate        = "create"
+	policySourceBatch         = "batch"
+	policySourceUpdate        = "update"
+	policySourceQuickSave     = "quick_save"
+	policySourceHistoryImport = "history_import"
+)
+
+// policyWarning 命中 warn 策略的提示，随保存结果以 policy_warnings 返回
+type policyWarning struct {
+	Domain string `json:"domain"`
+	Host   string `json:"host"`
+}
+
+// ListDomainPolicies GET /api/orgs/{id}/domain-policies
+// 组织成员均可查看（扩展据此在保存前提示）
+func (h *OrgsHandler) ListDomainPolicies(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chiRoute.URLParam(r, "id")
+	if _, ok := h.requireOrgMember(w, user.ID, orgID); !ok {
+		return
+	}
+	policies, err := h.db.ListDomainPolicies(orgID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"policies": policies})
+}
+
+// SetDomainPolicy PUT /api/orgs/{id}/domain-policies {"domain","action":"block"|"warn"}（owner/admin）
+// 新增或覆盖域名策略；domain 匹配自身及全部子域名，保存时 block 优先于 warn
+func (h *OrgsHandler) SetDomainPolicy(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chiRoute.URLParam(r, "id")
+	if !h.requirePolicyAdmin(w, user.ID, orgID) {
+		return
+	}
+	var req struct {
+		Domain string                    `json:"domain"`
+		Action models.DomainPolicyAction `json:"action"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid body")
+		return
+	}
+	domain, ok := normalizePolicyDomain(req.Domain)
+	if !ok {
+		utils.WriteValidationErrorResponse(w, "Invalid domain", "domain must be a host name such as secrets.example.com")
+		return
+	}
+	if req.Action != models.DomainPolicyBlock && req.Action != models.DomainPolicyWarn {
+		utils.WriteValidationErrorResponse(w, "Invalid action", "action must be block or warn")
+		return
+	}
+	existing, err := h.db.ListDomainPolicies(orgID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(existing) >= maxDomainPolicies {
+		replacing := false
+		for _, p := range existing {
+			replacing = replacing || p.Domain == domain
+		}
+		if !replacing {
+			utils.WriteBadRequestResponse(w, "too many domain policies (max 500)")
+			return
+		}
+	}
+	p := &models.DomainPolicy{OrganizationID: orgID, Domain: domain, Action: req.Action, CreatedBy: user.ID}
+	if err := h.db.SetDomainPolicy(p); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"policy": p})
+}
+
+// DeleteDomainPolicy DELETE /api/orgs/{id}/domain-policies/{domain}（owner/admin）
+func (h *OrgsHandler) DeleteDomainPolicy(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chiRoute.URLParam(r, "id")
+	if !h.requirePolicyAdmin(w, user.ID, orgID) {
+		return
+	}
+	domain, ok := normalizePolicyDomain(chiRoute.URLParam(r, "domain"))
+	if !ok {
+		utils.WriteBadRequestResponse(w, "invalid domain")
+		return
+	}
+	if err := h.db.DeleteDomainPolicy(orgID, domain); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"deleted": true, "domain": domain})
+}
+
+// ListPolicyViolations GET /api/orgs/{id}/policy-violations?limit=（owner/admin）
+// 按时间倒序返回命中域名策略的保存（含被拒绝的尝试），只含主机名不含完整 URL
+func (h *OrgsHandler) ListPolicyViolations(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chiRoute.URLParam(r, "id")
+	if !h.requirePolicyAdmin(w, user.ID, orgID) {
+		return
+	}
+	limit := defaultPolicyViolationLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPolicyViolationLimit {
+			utils.WriteBadRequestResponse(w, "limit must be between 1 and 200")
+			return
+		}
+		limit = n
+	}
+	violations, err := h.db.ListPolicyViolations(orgID, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"violations": violations})
+}
+
+// requirePolicyAdmin 要求 owner/admin
+func (h *OrgsHandler) requirePolicyAdmin(w http.ResponseWriter, userID, orgID string) bool {
+	role, ok := h.requireOrgMember(w, userID, orgID)
+	if !ok {
+		return false
+	}
+	if role != models.RoleOwner && role != models.RoleAdmin {
+		utils.WriteForbiddenResponse(w, "Only owner/admin can manage content policies")
+		return false
+	}
+	return true
+}
+
+// normalizePolicyDomain 小写、去掉首尾空白与 "*." 前缀；只接受不带端口、路径的主机名
+func normalizePolicyDomain(raw string) (string, bool) {
+	domain := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(raw)), "*.")
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || len(domain) > 253 {
+		return "", false
+	}
+	u, err := url.Parse("http://" + domain)
+	if err != nil || u.Host != domain || u.Hostname() != domain {
+		return "", false
+	}
+	return domain, true
+}
+
+// matchDomainPolicy 返回与 host 匹配（相等或为其子域名）的策略，block 优先于 warn
+func matchDomainPolicy(policies []models.DomainPolicy, host string) *models.DomainPolicy {
+	var match *models.DomainPolicy
+	for i := range policies {
+		p := &policies[i]
+		if host != p.Domain && !strings.HasSuffix(host, "."+p.Domain) {
+			continue
+		}
+		if p.Action == models.DomainPolicyBlock {
+			return p
+		}
+		if match == nil {
+			match = p
+		}
+	}
+	return match
+}
+
+// domainPolicyCheck 一次保存请求中的策略检查：加载组织策略一次，逐个 URL 匹配并累积违规记录，最后由 record 写入审计
+type domainPolicyCheck struct {
+	db         database.DatabaseInterface
+	orgID      string
+	userID     string
+	source     string
+	policies   []models.DomainPolicy
+	violations []models.PolicyViolation
+	warnings   []policyWarning
+}
+
+func newDomainPolicyCheck(db database.DatabaseInterface, orgID, userID, source string) (*domainPolicyCheck, error) {
+	policies, err := db.ListDomainPolicies(orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &domainPolicyCheck{db: db, orgID: orgID, userID: userID, source: source, policies: policies}, nil
+}
+
+// check 匹配 rawURL 的主机名，命中时记录违规（warn 同时加入 warnings）；返回命中的 block 策略，未被拒绝时为 nil
+func (c *domainPolicyCheck) check(rawURL string) *models.DomainPolicy {
+	if len(c.policies) == 0 {
+		return nil
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	p := matchDomainPolicy(c.policies, host)
+	if p == nil {
+		return nil
+	}
+	c.violations = append(c.violations, models.PolicyViolation{
+		OrganizationID: c.orgID,
+		UserID:         c.userID,
+		Domain:         p.Domain,
+		Host:           host,
+		Action:         p.Action,
+		Source:         c.source,
+	})
+	if p.Action == models.DomainPolicyBlock {
+		return p
+	}
+	for _, wn := range c.warnings {
+		if wn.Domain == p.Domain && wn.Host == host {
+			return nil
+		}
+	}
+	c.warnings = append(c.warnings, policyWarning{Domain: p.Domain, Host: host})
+	return nil
+}
+
+// record 写入累积的违规记录；审计失败只记日志，不影响保存结果
+func (c *domainPolicyCheck) record() {
+	if err := c.db.RecordPolicyViolations(c.violations); err != nil {
+		fmt.Printf("⚠️ Failed to record policy violations for org %s: %v\n", c.orgID, err)
+	}
+	c.violations = nil
+}
+
+// enforceDomainPolicies 检查即将保存到 orgID 的 urls：任一命中 block 时写入 POLICY_BLOCKED（details 为策略域名），
+// 整个请求不保存；命中 warn 的作为提示返回。命中的 URL 都记入审计
+func enforceDomainPolicies(w http.ResponseWriter, db database.DatabaseInterface, orgID, userID, source string, urls ...string) ([]policyWarning, bool) {
+	c, err := newDomainPolicyCheck(db, orgID, userID, source)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	var blocked *models.DomainPolicy
+	for _, u := range urls {
+		if p := c.check(u); p != nil && blocked == nil {
+			blocked = p
+		}
+	}
+	c.record()
+	if blocked != nil {
+		utils.WriteAppError(w, utils.ErrPolicyBlocked.
+			WithMessage("Saving links to "+blocked.Domain+" is blocked by your organization's policy").
+			WithDetails(blocked.Domain))
+		return nil, false
+	}
+	return c.warnings, true
+}
+
+// withPolicyWarnings 有提示时在响应中加入 policy_warnings
+func withPolicyWarnings(resp map[string]interface{}, warnings []policyWarning) map[string]interface{} {
+	if len(warnings) > 0 {
+		resp["policy_warnings"] = warnings
+	}
+	return resp
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// 可通过签名链接下载的产物类型
+const (
+	downloadKindExport = "export" // GDPR 数据导出归档
+)
+
+// downloadArtifact 待下载的产物；OwnerID 须与令牌签发对象一致
+type downloadArtifact struct {
+	OwnerID     string
+	Filename    string
+	ContentType string
+	Size        int64
+	Body        io.ReadCloser
+}
+
+// downloadSource 按 ID 打开某一类产物；产物已不可用时返回 utils.ErrLinkExpired
+type downloadSource func(db database.DatabaseInterface, id string) (*downloadArtifact, error)
+
+var downloadSources = map[string]downloadSource{
+	downloadKindExport: openExportArchive,
+}
+
+// DownloadsHandler 签名下载链接（无需登录，链接本身即凭据）
+type DownloadsHandler struct {
+	config *config.Config
+	db     database.DatabaseInterface
+}
+
+// NewDownloadsHandler 创建签名下载处理器
+func NewDownloadsHandler(cfg *config.Config) *DownloadsHandler {
+	return &DownloadsHandler{config: cfg}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *DownloadsHandler) withRequest(r *http.Request) *DownloadsHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// Download 校验令牌签名与有效期，确认产物仍属于令牌签发的用户后以流的形式返回。
+// 任何校验失败都返回 410 LINK_EXPIRED，不泄露产物是否存在
+func (h *DownloadsHandler) Download(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	token, err := utils.ParseDownloadToken(h.config.JWTSecret, chi.URLParam(r, "token"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	open, ok := downloadSources[token.Kind]
+	if !ok {
+		utils.WriteAppError(w, utils.ErrLinkExpired)
+		return
+	}
+	artifact, err := open(h.db, token.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			err = utils.ErrLinkExpired
+		}
+		writeError(w, err)
+		return
+	}
+	defer artifact.Body.Close()
+	if artifact.OwnerID != token.UserID {
+		utils.WriteAppError(w, utils.ErrLinkExpired)
+		return
+	}
+
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+artifact.Filename+`"`)
+	if artifact.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(artifact.Size, 10))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, artifact.Body); err != nil {
+		fmt.Printf("⚠️ Download of %s %s interrupted: %v\n", token.Kind, token.ID, err)
+	}
+}
+
+// errDownloadLinksUnavailable 未配置 BASE_URL：不签发下载链接（不能用客户端控制的 Host 拼链接）
+var errDownloadLinksUnavailable = utils.ErrServiceUnavailable.WithMessage("Download links are unavailable: BASE_URL is not configured")
+
+// signedDownloadURL 基于 BASE_URL 为 userID 签发 kind/id 的下载链接，ttl 后失效；未配置 BASE_URL 时返回错误
+func signedDownloadURL(cfg *config.Config, kind, id, userID string, ttl time.Duration) (string, time.Time, error) {
+	base := strings.TrimRight(cfg.BaseURL, "/")
+	if base == "" {
+		return "", time.Time{}, errDownloadLinksUnavailable
+	}
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	token := utils.SignDownloadToken(cfg.JWTSecret, utils.DownloadToken{Kind: kind, ID: id, UserID: userID, ExpiresAt: expires.Unix()})
+	return base + "/api/downloads/" + url.PathEscape(token), expires, nil
+}
+
+// openExportArchive 导出归档存于 data_exports.archive
+func openExportArchive(db database.DatabaseInterface, id string) (*downloadArtifact, error) {
+	export, archive, err := db.GetDataExportArchive(id)
+	if err != nil {
+		return nil, err
+	}
+	if export.Status != models.ExportReady || len(archive) == 0 {
+		return nil, utils.ErrLinkExpired.WithMessage("Export is no longer available")
+	}
+	return &downloadArtifact{
+		OwnerID:     export.UserID,
+		Filename:    fmt.Sprintf("tab-sync-export-%s.zip", export.CreatedAt.UTC().Format("2006-01-02")),
+		ContentType: "application/zip",
+		Size:        int64(len(archive)),
+		Body:        io.NopCloser(bytes.NewReader(archive)),
+	}, nil
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// notFoundCatalog 将数据库层的实体名映射到错误码目录
+var notFoundCatalog = map[string]*utils.AppError{
+	"user":            utils.ErrUserNotFound,
+	"organization":    utils.ErrOrgNotFound,
+	"space":           utils.ErrSpaceNotFound,
+	"invitation":      utils.ErrInvitationNotFound,
+	"collection":      utils.ErrCollectionNotFound,
+	"item":            utils.ErrItemNotFound,
+	"item revision":   utils.ErrRevisionNotFound,
+	"snapshot":        utils.ErrSnapshotNotFound,
+	"snapshot upload": utils.ErrUploadNotFound,
+	"promo code":      utils.ErrPromoInvalid,
+	"data export":     utils.ErrExportNotFound,
+	"device":          utils.ErrDeviceNotFound,
+	"device push":     utils.ErrDevicePushNotFound,
+	"history import":  utils.ErrImportNotFound,
+}
+
+// alreadyExistsCatalog 将唯一约束冲突的实体名映射到错误码目录
+var alreadyExistsCatalog = map[string]*utils.AppError{
+	"user": utils.ErrUserExists,
+}
+
+// toAppError 把内部错误映射到错误码目录；未识别的错误统一视为 INTERNAL_SERVER_ERROR
+func toAppError(err error) *utils.AppError {
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	// 请求时限耗尽（见 middleware.Timeout）；需先于 ErrUnavailable 判断，超时的出站调用也会被标记为不可用
+	if errors.Is(err, context.DeadlineExceeded) {
+		return utils.ErrTimeout.Wrap(err)
+	}
+	if errors.Is(err, database.ErrPromoAlreadyRedeemed) {
+		return utils.ErrPromoAlreadyRedeemed.Wrap(err)
+	}
+	if errors.Is(err, database.ErrPromoExhausted) {
+		return utils.ErrPromoInvalid.Wrap(err).WithMessage("Promo code has reached its redemption limit")
+	}
+	if errors.Is(err, database.ErrIdentityLinked) {
+		return utils.ErrIdentityLinked.Wrap(err)
+	}
+	if errors.Is(err, database.ErrSlugTaken) {
+		return utils.ErrSlugTaken.Wrap(err)
+	}
+	if errors.Is(err, database.ErrCrossRegion) {
+		return utils.ErrCrossRegion.Wrap(err)
+	}
+	if errors.Is(err, database.ErrUnsupportedRegion) {
+		return utils.ErrValidation.Wrap(err).WithMessage("Unsupported region")
+	}
+	if errors.Is(err, database.ErrUnavailable) {
+		return utils.ErrServiceUnavailable.Wrap(err)
+	}
+	var ae *database.AlreadyExistsError
+	if errors.As(err, &ae) {
+		if mapped, ok := alreadyExistsCatalog[ae.Entity]; ok {
+			return mapped.Wrap(err)
+		}
+		return utils.ErrConflict.Wrap(err)
+	}
+	var nf *database.NotFoundError
+	if errors.As(err, &nf) {
+		if mapped, ok := notFoundCatalog[nf.Entity]; ok {
+			return mapped.Wrap(err)
+		}
+		return utils.ErrNotFound.Wrap(err)
+	}
+	return utils.ErrInternal.Wrap(err)
+}
+
+// writeBodyError 请求体解析失败：超过路由的 MaxBodySize 上限返回 413，其余返回 400 与 message
+func writeBodyError(w http.ResponseWriter, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		utils.WriteAppError(w, utils.ErrPayloadTooLarge.WithMessage(
+			fmt.Sprintf("Request body exceeds the maximum size of %d bytes", tooLarge.Limit)))
+		return
+	}
+	utils.WriteBadRequestResponse(w, message)
+}
+
+// writeError 写入映射后的错误响应；内部错误只进日志，不回显给客户端
+func writeError(w http.ResponseWriter, err error) {
+	utils.WriteAppError(w, toAppError(err))
+}
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/notify"
+	"tab-sync-backend-refactor/pkg/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// exportBatchSize 每次任务最多生成的导出数（受函数时长限制）
+	exportBatchSize = 3
+	// exportStaleAfter processing 超过该时长视为任务中断，允许重新认领
+	exportStaleAfter = 10 * time.Minute
+	// exportRetention 归档保留时长，过期后清空
+	exportRetention = 7 * 24 * time.Hour
+	// exportCooldown 同一用户两次导出的最短间隔；期间重复请求返回已有导出
+	exportCooldown = 24 * time.Hour
+	// exportLinkTTL 签名下载链接的有效期
+	exportLinkTTL = 15 * time.Minute
+	// maxExportedLoginEvents 归档包含的最近登录记录数
+	maxExportedLoginEvents = 1000
+)
+
+// ExportHandler GDPR 数据导出
+type ExportHandler struct {
+	config *config.Config
+	db     database.DatabaseInterface
+}
+
+// NewExportHandler 创建数据导出处理器
+func NewExportHandler(cfg *config.Config) *ExportHandler {
+	return &ExportHandler{
+		config: cfg,
+	}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *ExportHandler) withRequest(r *http.Request) *ExportHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// exportResponse 导出状态；ready 时附带签名下载链接
+type exportResponse struct {
+	*models.DataExport
+	DownloadURL    string     `json:"download_url,omitempty"`
+	DownloadExpiry *time.Time `json:"download_url_expires_at,omitempty"`
+}
+
+// RequestExport 请求导出本人的全部数据，异步生成（见 ProcessExports），返回 202 与导出状态；
+// 进行中或 24 小时内已生成的导出直接返回，不重复排队
+func (h *ExportHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	latest, err := h.db.GetLatestDataExport(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		writeError(w, err)
+		return
+	}
+	if latest != nil {
+		if latest.Active() {
+			h.writeExport(w, http.StatusAccepted, latest)
+			return
+		}
+		if latest.Status == models.ExportReady && time.Since(latest.CreatedAt) < exportCooldown {
+			h.writeExport(w, http.StatusOK, latest)
+			return
+		}
+	}
+
+	export := &models.DataExport{UserID: user.ID}
+	if err := h.db.CreateDataExport(export); err != nil {
+		writeError(w, err)
+		return
+	}
+	fmt.Printf("📦 Queued data export %s for user %s\n", export.ID, user.ID)
+	h.writeExport(w, http.StatusAccepted, export)
+}
+
+// GetExport 查询导出状态；ready 时返回新签发的下载链接
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	export, err := h.db.GetDataExport(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.writeExport(w, http.StatusOK, export)
+}
+
+// ProcessExports 定时任务：认领待处理的导出生成 zip 归档并通知用户，同时清空已过期的归档。
+// 单个导出失败标记为 failed（用户可重新请求），不中断整批。
+func (h *ExportHandler) ProcessExports(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	now := time.Now().UTC()
+
+	purged, err := h.db.PurgeExpiredDataExports(now)
+	if err != nil {
+		fmt.Printf("⚠️ Failed to purge expired exports: %v\n", err)
+	}
+
+	exports, err := h.db.ClaimDataExports(exportBatchSize, now.Add(-exportStaleAfter))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	completed, failed := 0, 0
+	for _, e := range exports {
+		archive, err := buildUserArchive(h.db, e.UserID, now)
+		if err == nil {
+			err = h.db.CompleteDataExport(e.ID, archive, now.Add(exportRetention))
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to build data export %s: %v\n", e.ID, err)
+			if ferr := h.db.FailDataExport(e.ID, "failed to assemble export"); ferr != nil {
+				fmt.Printf("⚠️ Failed to mark data export %s failed: %v\n", e.ID, ferr)
+			}
+			failed++
+			continue
+		}
+		completed++
+		notifyUser(r, notify.Notification{
+			UserID:    e.UserID,
+			Kind:      notify.KindExportReady,
+			Title:     "Your data export is ready",
+			Body:      fmt.Sprintf("Download it within %d days from your account settings.", int(exportRetention.Hours()/24)),
+			Data:      map[string]interface{}{"export_id": e.ID},
+			DedupeKey: "export_ready:" + e.ID,
+		})
+	}
+
+	fmt.Printf("📦 Data export job: %d completed, %d failed, %d purged\n", completed, failed, purged)
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"completed": completed,
+		"failed":    failed,
+		"purged":    purged,
+	})
+}
+
+// writeExport 写出导出状态；ready 时附带签名下载链接，无法签发时返回错误而不是缺少链接的 ready 状态
+func (h *ExportHandler) writeExport(w http.ResponseWriter, status int, e *models.DataExport) {
+	resp := exportResponse{DataExport: e}
+	if e.Status == models.ExportReady {
+		link, expires, err := signedDownloadURL(h.config, downloadKindExport, e.ID, e.UserID, exportLinkTTL)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		resp.DownloadURL = link
+		resp.DownloadExpiry = &expires
+	}
+	utils.WriteJSONResponse(w, status, resp)
+}
+
+// exportedOrganization 用户拥有的组织及其全部内容
+type exportedOrganization struct {
+	models.Organization
+	Members []models.OrganizationMembership `json:"members"`
+	Spaces  []exportedSpace                 `json:"spaces"`
+}
+
+type exportedSpace struct {
+	models.Space
+	Collections []exportedCollection `json:"collections"`
+}
+
+type exportedCollection struct {
+	models.Collection
+	Items []models.CollectionItem `json:"items"`
+}
+
+// buildUserArchive 汇总与用户相关的全部数据为 zip：
+// profile.json（账户、订阅与通知偏好）、organizations.json（拥有的组织及其空间/集合/条目，
+// 条目不记录创建者，因此以组织归属为准；仅为成员的组织只列出名称与角色）、
+// snapshots/*.json（快照原文）、activity.json（通知与登录记录）
+func buildUserArchive(db database.DatabaseInterface, userID string, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	writeJSON := func(name string, v interface{}) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	// 账户
+	profile, err := db.GetUserWithSubscription(userID)
+	if err != nil {
+		return nil, fmt.Errorf("profile: %w", err)
+	}
+	subscription, err := db.GetUserSubscription(userID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, fmt.Errorf("subscription: %w", err)
+	}
+	prefs, err := db.GetNotificationPreferences(userID)
+	if err != nil {
+		return nil, fmt.Errorf("notification preferences: %w", err)
+	}
+	if err := writeJSON("profile.json", map[string]interface{}{
+		"user":                     profile,
+		"subscription":             subscription,
+		"notification_preferences": prefs,
+	}); err != nil {
+		return nil, err
+	}
+
+	// 组织
+	orgs, err := db.ListUserOrganizations(userID)
+	if err != nil {
+		return nil, fmt.Errorf("organizations: %w", err)
+	}
+	owned := []exportedOrganization{}
+	memberOf := []map[string]interface{}{}
+	for _, org := range orgs {
+		members, err := db.ListOrganizationMembers(org.ID)
+		if err != nil {
+			return nil, fmt.Errorf("members of %s: %w", org.ID, err)
+		}
+		if org.OwnerID != userID {
+			role := ""
+			for _, m := range members {
+				if m.UserID == userID {
+					role = string(m.Role)
+				}
+			}
+			memberOf = append(memberOf, map[string]interface{}{"id": org.ID, "name": org.Name, "role": role})
+			continue
+		}
+		eo := exportedOrganization{Organization: org, Members: members, Spaces: []exportedSpace{}}
+		spaces, err := db.ListSpacesByOrganization(org.ID)
+		if err != nil {
+			return nil, fmt.Errorf("spaces of %s: %w", org.ID, err)
+		}
+		// 其他成员的私有空间不属于组织所有者的个人数据
+		if spaces, err = visibleSpaces(db, userID, spaces); err != nil {
+			return nil, fmt.Errorf("spaces of %s: %w", org.ID, err)
+		}
+		for _, s := range spaces {
+			es := exportedSpace{Space: s, Collections: []exportedCollection{}}
+			collections, err := db.ListCollectionsBySpace(s.ID)
+			if err != nil {
+				return nil, fmt.Errorf("collections of %s: %w", s.ID, err)
+			}
+			for _, c := range collections {
+				items, err := db.ListItemsByCollection(c.ID, models.ItemStateAll)
+				if err != nil {
+					return nil, fmt.Errorf("items of %s: %w", c.ID, err)
+				}
+				es.Collections = append(es.Collections, exportedCollection{Collection: c, Items: items})
+			}
+			eo.Spaces = append(eo.Spaces, es)
+		}
+		owned = append(owned, eo)
+	}
+	if err := writeJSON("organizations.json", map[string]interface{}{
+		"owned":     owned,
+		"member_of": memberOf,
+	}); err != nil {
+		return nil, err
+	}
+
+	// 快照
+	snapshots, err := db.ListSnapshots(userID, "")
+	if err != nil {
+		return nil, fmt.Errorf("snapshots: %w", err)
+	}
+	for i, s := range snapshots {
+		raw, err := db.LoadSnapshotRaw(userID, s.Name)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %q: %w", s.Name, err)
+		}
+		// 快照名可能含路径分隔符，文件名使用序号
+		if err := writeJSON(fmt.Sprintf("snapshots/%03d.json", i+1), map[string]interface{}{
+			"name":       raw.Name,
+			"created_at": s.CreatedAt,
+			"updated_at": s.UpdatedAt,
+			"tab_groups": raw.TabGroups,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// 活动记录
+	notifications := []models.Notification{}
+	for offset := 0; ; offset += 500 {
+		page, total, err := db.ListNotifications(userID, false, 500, offset)
+		if err != nil {
+			return nil, fmt.Errorf("notifications: %w", err)
+		}
+		notifications = append(notifications, page...)
+		if len(page) == 0 || len(notifications) >= total {
+			break
+		}
+	}
+	logins, err := db.ListLoginEvents(userID, maxExportedLoginEvents)
+	if err != nil {
+		return nil, fmt.Errorf("login events: %w", err)
+	}
+	if err := writeJSON("activity.json", map[string]interface{}{
+		"notifications": notifications,
+		"logins":        logins,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+
+	chiRoute "github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/flags"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// FlagsHandler 功能开关与 A/B 实验处理器
+type FlagsHandler struct {
+	provider flags.Provider
+	db       database.DatabaseInterface
+}
+
+// NewFlagsHandler 创建功能开关处理器
+func NewFlagsHandler(cfg *config.Config) *FlagsHandler {
+	return &FlagsHandler{provider: flags.NewProvider(cfg)}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *FlagsHandler) withRequest(r *http.Request) *FlagsHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// flagSubject 从访问令牌声明构造评估对象（等级与组织取自访问令牌，无需查库）
+func flagSubject(r *http.Request, userID string) flags.Subject {
+	s := flags.Subject{UserID: userID}
+	if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+		s.OrgIDs, s.Tier = claims.Orgs, claims.Tier
+	}
+	return s
+}
+
+// GET /api/flags
+// 返回当前用户的全部开关 {flags: {key: bool}}
+func (h *FlagsHandler) GetFlags(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	result, err := h.provider.Evaluate(r.Context(), flagSubject(r, user.ID))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"flags": result})
+}
+
+// GET /api/experiments
+// 返回当前用户参与的实验及分配的变体 {experiments: {key: variant}}；未列出的实验按对照组处理。只分配不记曝光
+func (h *FlagsHandler) GetExperiments(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	result, err := h.provider.Assign(r.Context(), flagSubject(r, user.ID))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"experiments": result})
+}
+
+// POST /api/experiments/{key}/exposure
+// 客户端真正展示实验内容时调用；变体由服务端重新计算，客户端无法上报任意变体
+func (h *FlagsHandler) RecordExposure(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	key := chiRoute.URLParam(r, "key")
+	assigned, err := h.provider.Assign(r.Context(), flagSubject(r, user.ID))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	variant, ok := assigned[key]
+	if !ok {
+		utils.WriteAppError(w, utils.ErrNotFound.WithMessage("Not enrolled in this experiment"))
+		return
+	}
+	if err := h.db.RecordExperimentExposure(user.ID, key, variant); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"experiment": key, "variant": variant})
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const (
+	// maxHistoryBatchEntries 单个批次的条目数上限（扩展按此分页读取历史记录）
+	maxHistoryBatchEntries = 500
+	// historyCollectionPrefix 历史条目按本地访问日期分到 "History YYYY-MM-DD" 集合
+	historyCollectionPrefix = "History "
+	// maxUTCOffsetMinutes 时区偏移范围（UTC-14:00 ~ UTC+14:00）
+	maxUTCOffsetMinutes = 14 * 60
+)
+
+// historyImportView 导入记录加上进度（progress 在客户端声明了 total_entries 时为 0~1）
+type historyImportView struct {
+	*models.HistoryImport
+	Progress *float64 `json:"progress,omitempty"`
+}
+
+func newHistoryImportView(imp *models.HistoryImport) historyImportView {
+	v := historyImportView{HistoryImport: imp}
+	if imp.TotalEntries > 0 {
+		p := float64(imp.Received) / float64(imp.TotalEntries)
+		if p > 1 || imp.CompletedAt != nil {
+			p = 1
+		}
+		v.Progress = &p
+	}
+	return v
+}
+
+// ImportHistory POST /api/import/history
+// {"import_id","space_id","utc_offset_minutes","total_entries","batch","entries":[{"url","title","visit_time"}],"done"}
+// 扩展分页读取浏览器历史并按序号（batch，从 0 开始）分批提交：首个批次不带 import_id，服务端创建导入并返回其 id，
+// 后续批次带上该 id（space_id / utc_offset_minutes / total_entries 只在创建时生效）。条目按 visit_time 加偏移后的日期
+// 分到目标空间的 "History YYYY-MM-DD" 集合（不存在时创建），同一集合中已有相同规范化 URL 的条目计为重复；
+// 非 http(s) 或缺少 visit_time 的条目跳过，命中组织域名策略 block 的计为 blocked。已记录的批次重发时直接返回当前进度；
+// done=true 标记导入完成
+func (h *CollectionsHandler) ImportHistory(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	var req struct {
+		ImportID         string `json:"import_id"`
+		SpaceID          string `json:"space_id"`
+		UTCOffsetMinutes int    `json:"utc_offset_minutes"`
+		TotalEntries     int    `json:"total_entries"`
+		Batch            *int   `json:"batch"`
+		Entries          []struct {
+			URL       string     `json:"url"`
+			Title     string     `json:"title"`
+			VisitTime *time.Time `json:"visit_time"`
+		} `json:"entries"`
+		Done bool `json:"done"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid body")
+		return
+	}
+	if req.Batch == nil || *req.Batch < 0 {
+		utils.WriteBadRequestResponse(w, "batch must be a non-negative batch index")
+		return
+	}
+	if len(req.Entries) > maxHistoryBatchEntries {
+		utils.WriteBadRequestResponse(w, "too many entries (max 500 per batch)")
+		return
+	}
+
+	imp, ok := h.historyImport(w, user.ID, req.ImportID, req.SpaceID, req.UTCOffsetMinutes, req.TotalEntries)
+	if !ok {
+		return
+	}
+	if imp.CompletedAt != nil {
+		utils.WriteAppError(w, utils.ErrImportCompleted)
+		return
+	}
+
+	batch := &models.HistoryImportBatch{ImportID: imp.ID, Index: *req.Batch, Received: len(req.Entries)}
+	var warnings []policyWarning
+	if !imp.HasBatch(batch.Index) {
+		// 导入期间权限可能被收回：每个批次重新校验
+		orgID, ok := h.requireSpaceEdit(w, user.ID, imp.SpaceID)
+		if !ok {
+			return
+		}
+		policy, err := newDomainPolicyCheck(h.db, orgID, user.ID, policySourceHistoryImport)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		colls, err := h.db.ListCollectionsBySpace(imp.SpaceID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		byName := map[string]*models.Collection{}
+		for i := range colls {
+			if !colls[i].IsSmart() {
+				byName[strings.TrimSpace(colls[i].Name)] = &colls[i]
+			}
+		}
+
+		zone := time.FixedZone("", imp.UTCOffsetMinutes*60)
+		seen := map[string]bool{} // collection + 规范化 URL，批次内去重
+		for _, e := range req.Entries {
+			rawURL := strings.TrimSpace(e.URL)
+			u, err := url.Parse(rawURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || e.VisitTime == nil {
+				batch.Skipped++
+				continue
+			}
+			// 命中 block 的条目不导入（不中断整个批次），命中 warn 的照常导入；都记入审计
+			if policy.check(rawURL) != nil {
+				batch.Blocked++
+				continue
+			}
+			name := historyCollectionPrefix + e.VisitTime.In(zone).Format("2006-01-02")
+			coll := byName[name]
+			if coll == nil {
+				coll = &models.Collection{
+					SpaceID:     imp.SpaceID,
+					Name:        name,
+					Description: "Imported from browser history",
+					Icon:        "history",
+					Type:        models.CollectionTypeManual,
+				}
+				if err := h.db.CreateCollection(coll); err != nil {
+					writeError(w, err)
+					return
+				}
+				byName[name] = coll
+			}
+
+			// 与 CreateItem 相同的规范化规则
+			normalizedURL := strings.ToLower(rawURL)
+			if seen[coll.ID+" "+normalizedURL] {
+				batch.Duplicates++
+				continue
+			}
+			seen[coll.ID+" "+normalizedURL] = true
+			if ex, err := h.db.FindItemByCollectionAndNormalizedURL(coll.ID, normalizedURL); err == nil && ex != nil {
+				batch.Duplicates++
+				continue
+			}
+
+			title := strings.TrimSpace(e.Title)
+			if title == "" {
+				title = rawURL
+			}
+			metaJSON, _ := json.Marshal(map[string]interface{}{
+				"normalized_url": normalizedURL,
+				"source":         "history_import",
+				"import_id":      imp.ID,
+				"visit_time":     e.VisitTime.UTC().Format(time.RFC3339),
+			})
+			item := &models.CollectionItem{
+				CollectionID: coll.ID,
+				Title:        title,
+				URL:          rawURL,
+				Domain:       strings.ToLower(u.Hostname()),
+				Metadata:     metaJSON,
+			}
+			if err := h.db.CreateCollectionItem(item); err != nil {
+				writeError(w, err)
+				return
+			}
+			batch.Imported++
+		}
+		policy.record()
+		warnings = policy.warnings
+		if err := h.db.RecordHistoryImportBatch(batch); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	if req.Done {
+		if err := h.db.CompleteHistoryImport(imp.ID); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if imp, err = h.db.GetHistoryImport(user.ID, imp.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, withPolicyWarnings(map[string]interface{}{"import": newHistoryImportView(imp), "batch": batch}, warnings))
+}
+
+// GetHistoryImport GET /api/import/history/{id}
+// 返回导入进度（各批次计数合计；声明了 total_entries 时附带 progress）
+func (h *CollectionsHandler) GetHistoryImport(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	imp, err := h.db.GetHistoryImport(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"import": newHistoryImportView(imp)})
+}
+
+// historyImport 加载 importID 指定的导入；为空时在 spaceID（未指定时为默认空间，见 defaultSpace）上创建新导入
+func (h *CollectionsHandler) historyImport(w http.ResponseWriter, userID, importID, spaceID string, utcOffset, total int) (*models.HistoryImport, bool) {
+	if importID != "" {
+		imp, err := h.db.GetHistoryImport(userID, importID)
+		if err != nil {
+			writeError(w, err)
+			return nil, false
+		}
+		return imp, true
+	}
+	if utcOffset < -maxUTCOffsetMinutes || utcOffset > maxUTCOffsetMinutes {
+		utils.WriteBadRequestResponse(w, "utc_offset_minutes must be between -840 and 840")
+		return nil, false
+	}
+	if total < 0 {
+		utils.WriteBadRequestResponse(w, "total_entries must not be negative")
+		return nil, false
+	}
+	if spaceID == "" {
+		space, ok := h.defaultSpace(w, userID)
+		if !ok {
+			return nil, false
+		}
+		spaceID = space.ID
+	} else if _, ok := h.requireSpaceEdit(w, userID, spaceID); !ok {
+		return nil, false
+	}
+	imp := &models.HistoryImport{UserID: userID, SpaceID: spaceID, UTCOffsetMinutes: utcOffset, TotalEntries: total}
+	if err := h.db.CreateHistoryImport(imp); err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	return imp, true
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 关联令牌有效期：用户需在此时间内登录已有账户并完成关联
+const identityLinkTTL = 15 * time.Minute
+
+// oauthProfile 身份提供商返回的用户信息
+type oauthProfile struct {
+	Provider       string
+	ProviderUserID string
+	Email          string
+	Name           string
+	Avatar         string
+}
+
+// linkRequiredError 外部账户未关联、但邮箱已属于另一账户；Token 供用户登录该账户后显式关联
+type linkRequiredError struct {
+	Token string
+}
+
+func (e *linkRequiredError) Error() string { return "account link required" }
+
+// identityLinkClaims 关联令牌内容（签名见 signIdentityLink）
+type identityLinkClaims struct {
+	Provider       string `json:"provider"`
+	ProviderUserID string `json:"provider_user_id"`
+	Email          string `json:"email"`
+	Exp            int64  `json:"exp"`
+}
+
+func (h *AuthHandler) signIdentityLink(p oauthProfile) (string, error) {
+	data, err := json.Marshal(identityLinkClaims{
+		Provider:       p.Provider,
+		ProviderUserID: p.ProviderUserID,
+		Email:          p.Email,
+		Exp:            time.Now().Add(identityLinkTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + utils.SignValue(h.config.JWTSecret, "identity-link:"+payload), nil
+}
+
+func (h *AuthHandler) parseIdentityLink(token string) (*identityLinkClaims, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !utils.VerifySignedValue(h.config.JWTSecret, "identity-link:"+payload, sig) {
+		return nil, utils.ErrInvalidToken.WithMessage("Invalid link token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, utils.ErrInvalidToken.WithMessage("Invalid link token")
+	}
+	var claims identityLinkClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, utils.ErrInvalidToken.WithMessage("Invalid link token")
+	}
+	if time.Now().Unix() > claims.Exp {
+		return nil, utils.ErrTokenExpired.WithMessage("Link token expired")
+	}
+	return &claims, nil
+}
+
+// createUserAttempts 并发登录以同一邮箱创建用户时，落败一方重新查找的总尝试次数
+const createUserAttempts = 3
+
+// findOrCreateUser 查找或创建 OAuth 用户。同一账户的两个登录并发到达（如扩展与网页同时完成授权）时，
+// 后创建的一方会遇到唯一约束冲突：此时稍候从头重新查找（身份关联可能也已由另一方建立），而不是让登录失败
+func (h *AuthHandler) findOrCreateUser(p oauthProfile) (*models.User, error) {
+	for attempt := 1; ; attempt++ {
+		user, err := h.lookupOrCreateUser(p)
+		if !errors.Is(err, database.ErrAlreadyExists) || attempt == createUserAttempts {
+			return user, err
+		}
+		fmt.Printf("👤 %s user %s was created concurrently, retrying lookup\n", p.Provider, p.Email)
+		// 只读副本可能尚未同步到另一方刚写入的用户
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+}
+
+// lookupOrCreateUser 按 provider + provider_user_id 查找用户，未关联时按邮箱处理：
+//   - 邮箱无对应账户：创建用户并关联
+//   - 邮箱属于同一提供商创建、尚无任何关联的旧账户（身份表上线前注册）：自动补建关联
+//   - 其余情况（邮箱属于其他方式注册的账户）：返回 linkRequiredError，不按邮箱接管
+func (h *AuthHandler) lookupOrCreateUser(p oauthProfile) (*models.User, error) {
+	if p.ProviderUserID == "" {
+		return nil, fmt.Errorf("%s account has no user id", p.Provider)
+	}
+	if strings.TrimSpace(p.Email) == "" {
+		return nil, fmt.Errorf("%s account has no email address", p.Provider)
+	}
+
+	identity, err := h.db.GetUserIdentity(p.Provider, p.ProviderUserID)
+	if err == nil {
+		user, err := h.db.GetUserByID(identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get linked user: %w", err)
+		}
+		user.Name = p.Name
+		user.Avatar = p.Avatar
+		user.UpdatedAt = time.Now()
+		if err := h.db.UpdateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		fmt.Printf("👤 Found user %s by %s identity\n", user.Email, p.Provider)
+		return user, nil
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	user, err := h.db.GetUserByEmail(p.Email)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	if user != nil {
+		linked, err := h.db.ListUserIdentities(user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list user identities: %w", err)
+		}
+		if len(linked) > 0 || user.Provider != p.Provider {
+			token, err := h.signIdentityLink(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign link token: %w", err)
+			}
+			fmt.Printf("🔗 %s identity for %s requires explicit linking\n", p.Provider, p.Email)
+			return nil, &linkRequiredError{Token: token}
+		}
+		user.Name = p.Name
+		user.Avatar = p.Avatar
+		user.UpdatedAt = time.Now()
+		if err := h.db.UpdateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		fmt.Printf("👤 Found existing user %s, backfilling %s identity\n", user.Email, p.Provider)
+	} else {
+		user = &models.User{
+			// ID will be auto-generated by PostgreSQL
+			Email:     p.Email,
+			Name:      p.Name,
+			Provider:  p.Provider,
+			Avatar:    p.Avatar,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		if err := h.db.CreateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		fmt.Printf("👤 Created new OAuth user %s (provider: %s)\n", user.Email, p.Provider)
+	}
+
+	if err := h.db.LinkUserIdentity(&models.UserIdentity{
+		UserID:         user.ID,
+		Provider:       p.Provider,
+		ProviderUserID: p.ProviderUserID,
+		Email:          p.Email,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to link user identity: %w", err)
+	}
+	return user, nil
+}
+
+// handleOAuthUserError 查找/创建用户失败：需要显式关联时返回 account_link_required 与关联令牌
+func (h *AuthHandler) handleOAuthUserError(w http.ResponseWriter, r *http.Request, clientType ClientType, err error) {
+	var linkErr *linkRequiredError
+	if !errors.As(err, &linkErr) {
+		h.handleOAuthError(w, r, clientType, "user_creation_failed", "Failed to create user", err)
+		return
+	}
+	q := url.Values{}
+	q.Set("error", "account_link_required")
+	q.Set("error_description", utils.ErrAccountLinkRequired.Message)
+	q.Set("link_token", linkErr.Token)
+	switch clientType {
+	case ClientTypeExtension:
+		http.Redirect(w, r, h.config.OAuthRedirectURI+"?"+q.Encode(), http.StatusFound)
+	case ClientTypeWeb:
+		http.Redirect(w, r, h.getFrontendCallbackURL()+"?"+q.Encode(), http.StatusFound)
+	default:
+		utils.WriteAppError(w, utils.ErrAccountLinkRequired.WithDetails(linkErr.Token))
+	}
+}
+
+// ListIdentities 列出当前用户已关联的外部账户
+func (h *AuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	identities, err := h.db.ListUserIdentities(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"identities": identities})
+}
+
+// LinkIdentity 用 OAuth 登录时返回的关联令牌，把外部账户关联到当前登录的账户；令牌邮箱须与当前账户一致
+func (h *AuthHandler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	var req struct {
+		LinkToken string `json:"link_token"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if req.LinkToken == "" {
+		utils.WriteBadRequestResponse(w, "link_token is required")
+		return
+	}
+	claims, err := h.parseIdentityLink(req.LinkToken)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !strings.EqualFold(claims.Email, user.Email) {
+		utils.WriteAppError(w, utils.ErrForbidden.WithMessage("Link token was issued for a different email address"))
+		return
+	}
+	identity := &models.UserIdentity{
+		UserID:         user.ID,
+		Provider:       claims.Provider,
+		ProviderUserID: claims.ProviderUserID,
+		Email:          claims.Email,
+	}
+	if err := h.db.LinkUserIdentity(identity); err != nil {
+		writeError(w, err)
+		return
+	}
+	fmt.Printf("🔗 Linked %s identity to user %s\n", claims.Provider, user.ID)
+	utils.WriteSuccessResponse(w, identity)
+}
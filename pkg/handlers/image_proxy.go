@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/storage"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const (
+	// imageFetchTimeout 抓取源图的上限
+	imageFetchTimeout = 5 * time.Second
+	// maxImageBytes 源图大小上限
+	maxImageBytes = 5 << 20
+	// maxImagePixels 解码前按头部声明的尺寸拒绝过大的图片（解压炸弹）
+	maxImagePixels = 4096 * 4096
+	// maxImageRedirects 重定向次数上限；每一跳的主机都须在白名单内
+	maxImageRedirects = 3
+	// imageCacheMaxAge 浏览器与 CDN 缓存时长
+	imageCacheMaxAge = 7 * 24 * time.Hour
+	// imageCachePrefix 对象存储中缓存副本的前缀
+	imageCachePrefix = "img-cache/"
+)
+
+// imageWidths 允许的输出宽度；请求宽度向上取整到其中一档，限制缓存副本数量
+var imageWidths = []int{16, 32, 48, 64, 96, 128, 192, 256, 512}
+
+// proxiedImageTypes 按内容嗅探允许的类型（不信任源站的 Content-Type）；SVG 可携带脚本，不代理。
+// ICO 与 WebP 标准库无法解码，原样返回
+var proxiedImageTypes = map[string]bool{
+	"image/png":    true,
+	"image/jpeg":   true,
+	"image/gif":    true,
+	"image/webp":   true,
+	"image/x-icon": true,
+}
+
+// ImageProxyHandler 代理第三方头像与 favicon：客户端只访问本服务，不向外部主机暴露用户 IP
+type ImageProxyHandler struct {
+	hosts  []string
+	client *http.Client
+	store  storage.Store
+	cached bool
+}
+
+// NewImageProxyHandler 创建图片代理处理器；配置了对象存储时缓存处理后的图片
+func NewImageProxyHandler(cfg *config.Config) *ImageProxyHandler {
+	h := &ImageProxyHandler{hosts: cfg.ImageProxyHosts, store: storage.Shared(cfg), cached: storage.Configured(cfg)}
+	dialer := &net.Dialer{Timeout: imageFetchTimeout, Control: publicAddressOnly}
+	h.client = &http.Client{
+		Timeout: imageFetchTimeout,
+		// 不使用追踪 Transport：不向第三方发送 traceparent；不读取代理环境变量
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   imageFetchTimeout,
+			ResponseHeaderTimeout: imageFetchTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxImageRedirects {
+				return errors.New("too many redirects")
+			}
+			return h.checkURL(req.URL)
+		},
+	}
+	return h
+}
+
+// Image GET /api/img?url=&w=：抓取白名单主机上的图片，校验类型后按宽度缩小（只缩不放）。
+// 源站只能是 https，连接时校验解析出的地址为公网地址（防止 DNS 重绑定指向内网）
+func (h *ImageProxyHandler) Image(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	src, err := url.Parse(q.Get("url"))
+	if err != nil || q.Get("url") == "" {
+		utils.WriteAppError(w, utils.ErrValidation.WithMessage("url must be an absolute https URL"))
+		return
+	}
+	if err := h.checkURL(src); err != nil {
+		utils.WriteAppError(w, utils.ErrForbidden.WithMessage("Image host not allowed"))
+		return
+	}
+	width := 0
+	if raw := q.Get("w"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			utils.WriteAppError(w, utils.ErrValidation.WithMessage("w must be a positive integer"))
+			return
+		}
+		width = snapImageWidth(n)
+	}
+
+	cacheKey := imageCacheKey(src.String(), width)
+	if h.cached {
+		if obj, err := h.store.Get(r.Context(), cacheKey); err == nil {
+			setImageHeaders(w)
+			if err := storage.Serve(w, obj, ""); err != nil {
+				fmt.Printf("⚠️ Failed to serve cached image: %v\n", err)
+			}
+			return
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			fmt.Printf("⚠️ Image cache read failed: %v\n", err)
+		}
+	}
+
+	body, contentType, err := h.fetch(r.Context(), src)
+	if err != nil {
+		fmt.Printf("⚠️ Image proxy fetch %s failed: %v\n", src.Host, err)
+		utils.WriteAppError(w, utils.ErrImageUnavailable)
+		return
+	}
+	if width > 0 {
+		body, contentType, err = resizeImage(body, contentType, width)
+		if err != nil {
+			fmt.Printf("⚠️ Image proxy resize %s failed: %v\n", src.Host, err)
+			utils.WriteAppError(w, utils.ErrImageUnavailable)
+			return
+		}
+	}
+	if h.cached {
+		if err := h.store.Put(r.Context(), cacheKey, bytes.NewReader(body), int64(len(body)), contentType); err != nil {
+			fmt.Printf("⚠️ Image cache write failed: %v\n", err)
+		}
+	}
+
+	setImageHeaders(w)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// checkURL 只允许 https、默认端口与白名单主机
+func (h *ImageProxyHandler) checkURL(u *url.URL) error {
+	if u.Scheme != "https" || u.User != nil || u.Port() != "" {
+		return errors.New("only https URLs on the default port are allowed")
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range h.hosts {
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not allowed", host)
+}
+
+// fetch 下载源图（上限 maxImageBytes）并按内容嗅探类型
+func (h *ImageProxyHandler) fetch(ctx context.Context, src *url.URL) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/png,image/jpeg,image/gif,image/webp,image/x-icon")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) > maxImageBytes {
+		return nil, "", fmt.Errorf("image larger than %d bytes", maxImageBytes)
+	}
+	contentType := http.DetectContentType(body)
+	if !proxiedImageTypes[contentType] {
+		return nil, "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+	return body, contentType, nil
+}
+
+// publicAddressOnly 在建立连接前检查解析后的地址，拒绝回环、私有、链路本地等非公网地址
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
+
+func setImageHeaders(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(imageCacheMaxAge.Seconds())))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+}
+
+// snapImageWidth 向上取整到 imageWidths 中的一档，超出最大档时取最大档
+func snapImageWidth(n int) int {
+	for _, w := range imageWidths {
+		if n <= w {
+			return w
+		}
+	}
+	return imageWidths[len(imageWidths)-1]
+}
+
+func imageCacheKey(src string, width int) string {
+	sum := sha256.Sum256([]byte(src + "|" + strconv.Itoa(width)))
+	return imageCachePrefix + hex.EncodeToString(sum[:])
+}
+
+// resizeImage 将 PNG/JPEG/GIF（取第一帧）按比例缩小到 width；不宽于 width 或无法解码的格式原样返回
+func resizeImage(body []byte, contentType string, width int) ([]byte, string, error) {
+	var decode func(io.Reader) (image.Image, error)
+	switch contentType {
+	case "image/png":
+		decode = png.Decode
+	case "image/jpeg":
+		decode = jpeg.Decode
+	case "image/gif":
+		decode = gif.Decode
+	default:
+		return body, contentType, nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, "", fmt.Errorf("image dimensions %dx%d too large", cfg.Width, cfg.Height)
+	}
+	if cfg.Width <= width {
+		return body, contentType, nil
+	}
+	src, err := decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	height := cfg.Height * width / cfg.Width
+	if height < 1 {
+		height = 1
+	}
+	dst := downscale(src, width, height)
+
+	var out bytes.Buffer
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(&out, dst)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return out.Bytes(), contentType, nil
+}
+
+// downscale 区域平均缩小（每个目标像素取覆盖的源像素的平均值），对头像与图标足够清晰
+func downscale(src image.Image, width, height int) *image.NRGBA {
+	b := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := b.Min.Y + (y+1)*b.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := b.Min.X + (x+1)*b.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					// 按透明度加权，避免透明像素的颜色渗入边缘
+					r += uint64(c.R) * uint64(c.A)
+					g += uint64(c.G) * uint64(c.A)
+					bl += uint64(c.B) * uint64(c.A)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			if a == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / a >> 8),
+				G: uint8(g / a >> 8),
+				B: uint8(bl / a >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const (
+	// maxTriageActions 单次整理的条目数上限（与批量创建条目一致）
+	maxTriageActions = 200
+	// maxTriageSuggestions 每个条目建议的目标集合数
+	maxTriageSuggestions = 3
+)
+
+// triageSuggestion 建议的目标集合：同一空间中已保存过该域名条目的集合，Matches 为条目数
+type triageSuggestion struct {
+	CollectionID string `json:"collection_id"`
+	Name         string `json:"name"`
+	Matches      int    `json:"matches"`
+}
+
+type triageItem struct {
+	models.CollectionItem
+	Suggestions []triageSuggestion `json:"suggestions"`
+}
+
+// GetInbox GET /api/inbox[?collection_id=]
+// 返回 Inbox（见 QuickSave）中未归档、未延后的条目，每条附带按域名历史建议的目标集合
+func (h *CollectionsHandler) GetInbox(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	inbox, ok := h.inboxOrCollection(w, user.ID, r.URL.Query().Get("collection_id"))
+	if !ok {
+		return
+	}
+	items, err := h.db.ListItemsByCollection(inbox.ID, models.ItemStateActive)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	suggest, err := h.domainSuggestions(inbox)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	now := time.Now()
+	pending := make([]triageItem, 0, len(items))
+	snoozed := 0
+	for _, it := range items {
+		if it.SnoozedUntil != nil && it.SnoozedUntil.After(now) {
+			snoozed++
+			continue
+		}
+		pending = append(pending, triageItem{CollectionItem: it, Suggestions: suggest(itemDomain(&it))})
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"collection": inbox,
+		"items":      pending,
+		"snoozed":    snoozed,
+	})
+}
+
+// TriageInbox POST /api/inbox/triage {"collection_id","actions":[{"item_id","move_to"}|{"item_id","snooze_until"}]}
+// 批量整理 Inbox 条目：move_to 移入目标集合（需编辑权限，不能是智能集合），snooze_until 延后到该时间
+// （不晚于当前时间即取消延后）。先校验全部动作再依次执行，任一校验失败时不做任何修改
+func (h *CollectionsHandler) TriageInbox(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	var req struct {
+		CollectionID string `json:"collection_id"`
+		Actions      []struct {
+			ItemID      string     `json:"item_id"`
+			MoveTo      string     `json:"move_to"`
+			SnoozeUntil *time.Time `json:"snooze_until"`
+		} `json:"actions"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid body")
+		return
+	}
+	if len(req.Actions) == 0 {
+		utils.WriteBadRequestResponse(w, "actions required")
+		return
+	}
+	if len(req.Actions) > maxTriageActions {
+		utils.WriteBadRequestResponse(w, "too many actions (max 200)")
+		return
+	}
+	inbox, ok := h.inboxOrCollection(w, user.ID, req.CollectionID)
+	if !ok {
+		return
+	}
+	items, err := h.db.ListItemsByCollection(inbox.ID, models.ItemStateAll)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	inInbox := make(map[string]bool, len(items))
+	for _, it := range items {
+		inInbox[it.ID] = true
+	}
+
+	targets := map[string]bool{}
+	for _, a := range req.Actions {
+		if (a.MoveTo == "") == (a.SnoozeUntil == nil) {
+			utils.WriteBadRequestResponse(w, "each action needs exactly one of move_to or snooze_until")
+			return
+		}
+		if !inInbox[a.ItemID] {
+			utils.WriteAppError(w, utils.ErrItemNotFound.WithDetails(a.ItemID))
+			return
+		}
+		if a.MoveTo == "" || targets[a.MoveTo] {
+			continue
+		}
+		if a.MoveTo == inbox.ID {
+			utils.WriteBadRequestResponse(w, "move_to must be a different collection")
+			return
+		}
+		if _, ok := h.inboxOrCollection(w, user.ID, a.MoveTo); !ok {
+			return
+		}
+		targets[a.MoveTo] = true
+	}
+
+	now := time.Now().UTC()
+	updated := make([]models.CollectionItem, 0, len(req.Actions))
+	moved, snoozed := 0, 0
+	for _, a := range req.Actions {
+		patch := map[string]interface{}{"snoozed_until": (*time.Time)(nil)}
+		if a.MoveTo != "" {
+			patch["collection_id"] = a.MoveTo
+			moved++
+		} else if a.SnoozeUntil.After(now) {
+			until := a.SnoozeUntil.UTC()
+			patch["snoozed_until"] = &until
+			snoozed++
+		}
+		item, err := h.db.UpdateCollectionItemPartial(a.ItemID, patch)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		updated = append(updated, *item)
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"moved":   moved,
+		"snoozed": snoozed,
+		"items":   updated,
+	})
+}
+
+// domainSuggestions 统计 inbox 所在空间其他普通集合中各域名的条目数，返回按条目数（同数按名称）排序的建议函数
+func (h *CollectionsHandler) domainSuggestions(inbox *models.Collection) (func(domain string) []triageSuggestion, error) {
+	colls, err := h.db.ListCollectionsBySpace(inbox.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	for _, c := range colls {
+		if c.ID != inbox.ID && !c.IsSmart() {
+			names[c.ID] = c.Name
+		}
+	}
+	items, err := h.db.ListItemsBySpace(inbox.SpaceID, models.ItemStateAll)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]map[string]int{} // domain -> collection -> 条目数
+	for i := range items {
+		if _, ok := names[items[i].CollectionID]; !ok {
+			continue
+		}
+		domain := itemDomain(&items[i])
+		if domain == "" {
+			continue
+		}
+		if counts[domain] == nil {
+			counts[domain] = map[string]int{}
+		}
+		counts[domain][items[i].CollectionID]++
+	}
+
+	return func(domain string) []triageSuggestion {
+		suggestions := []triageSuggestion{}
+		for id, n := range counts[domain] {
+			suggestions = append(suggestions, triageSuggestion{CollectionID: id, Name: names[id], Matches: n})
+		}
+		sort.Slice(suggestions, func(i, j int) bool {
+			if suggestions[i].Matches != suggestions[j].Matches {
+				return suggestions[i].Matches > suggestions[j].Matches
+			}
+			return suggestions[i].Name < suggestions[j].Name
+		})
+		if len(suggestions) > maxTriageSuggestions {
+			suggestions = suggestions[:maxTriageSuggestions]
+		}
+		return suggestions
+	}, nil
+}
+
+// itemDomain 条目的域名（小写、去掉 www.）；domain 为空时从 URL 解析
+func itemDomain(it *models.CollectionItem) string {
+	domain := it.Domain
+	if domain == "" {
+		if u, err := url.Parse(it.URL); err == nil {
+			domain = u.Hostname()
+		}
+	}
+	return strings.TrimPrefix(strings.ToLower(domain), "www.")
+}
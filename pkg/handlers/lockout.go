@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/cache"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/notify"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 认证端点（login / refresh / exchange-session）的暴力破解防护：按邮箱与按 IP 分别统计失败次数，
+// 窗口内达到阈值即锁定（refresh / exchange-session 的令牌未通过签名校验时只按 IP 计数）；锁定时长随 24 小时内的锁定次数翻倍。计数存放在共享缓存，跨 Serverless 实例生效。
+const (
+	authFailureWindow  = 15 * time.Minute
+	authEmailThreshold = 5
+	authIPThreshold    = 20
+	authLockBase       = time.Minute
+	authLockMax        = 24 * time.Hour
+	authLockLevelTTL   = 24 * time.Hour
+	unlockLinkTTL      = time.Hour
+)
+
+// authGuard 失败计数与锁定；缓存不可用时放行（只记录日志），不因缓存故障阻断登录
+type authGuard struct {
+	store   cache.Store
+	mailer  notify.Mailer
+	alerts  *securityAlerts
+	secret  string
+	baseURL string
+}
+
+type lockSubject struct {
+	kind      string // email | ip
+	value     string
+	threshold int64
+}
+
+func (s lockSubject) key(prefix string) string {
+	return "authguard:" + prefix + ":" + s.kind + ":" + s.value
+}
+
+func authSubjects(email, ip string) []lockSubject {
+	var subjects []lockSubject
+	if email = models.NormalizeEmail(email); email != "" {
+		subjects = append(subjects, lockSubject{kind: "email", value: email, threshold: authEmailThreshold})
+	}
+	if ip != "" {
+		subjects = append(subjects, lockSubject{kind: "ip", value: ip, threshold: authIPThreshold})
+	}
+	return subjects
+}
+
+// lockedFor 返回剩余锁定时间（邮箱与 IP 中较长者），未锁定时为 0
+func (g *authGuard) lockedFor(ctx context.Context, email, ip string) time.Duration {
+	var longest time.Duration
+	for _, s := range authSubjects(email, ip) {
+		_, ttl, ok, err := g.store.Get(ctx, s.key("lock"))
+		if err != nil {
+			fmt.Printf("⚠️  Auth lockout check failed: %v\n", err)
+			continue
+		}
+		if ok && ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest
+}
+
+// recordFailure 记录一次失败；达到阈值时锁定，邮箱被锁定时向账户发送解锁邮件
+func (g *authGuard) recordFailure(r *http.Request, db database.DatabaseInterface, email, ip string) {
+	ctx := r.Context()
+	for _, s := range authSubjects(email, ip) {
+		n, err := g.store.Incr(ctx, s.key("fail"), authFailureWindow)
+		if err != nil {
+			fmt.Printf("⚠️  Failed to record auth failure: %v\n", err)
+			return
+		}
+		if n < s.threshold {
+			continue
+		}
+		level, err := g.store.Incr(ctx, s.key("level"), authLockLevelTTL)
+		if err != nil {
+			fmt.Printf("⚠️  Failed to record auth lockout: %v\n", err)
+			return
+		}
+		d := authLockBase << uint(min(level-1, 20))
+		if d > authLockMax {
+			d = authLockMax
+		}
+		if err := g.store.Set(ctx, s.key("lock"), strconv.FormatInt(level, 10), d); err != nil {
+			fmt.Printf("⚠️  Failed to set auth lockout: %v\n", err)
+			return
+		}
+		_ = g.store.Delete(ctx, s.key("fail"))
+		fmt.Printf("🔒 Auth locked for %s %s (%s, level %d)\n", s.kind, s.value, d, level)
+		if s.kind == "email" && db != nil {
+			g.sendUnlockEmail(r, db, s.value, d)
+		}
+	}
+}
+
+// recordSuccess 成功后清零该邮箱的失败计数（IP 计数保留，直到窗口过期）
+func (g *authGuard) recordSuccess(ctx context.Context, email string) {
+	if subjects := authSubjects(email, ""); len(subjects) > 0 {
+		_ = g.store.Delete(ctx, subjects[0].key("fail"))
+	}
+}
+
+// unlock 清除邮箱的失败计数、锁定与锁定次数
+func (g *authGuard) unlock(ctx context.Context, email string) error {
+	subjects := authSubjects(email, "")
+	if len(subjects) == 0 {
+		return nil
+	}
+	s := subjects[0]
+	return g.store.Delete(ctx, s.key("fail"), s.key("lock"), s.key("level"))
+}
+
+// sendUnlockEmail 仅在邮箱对应已有账户时发送，同时产生 failed_attempts 安全告警
+func (g *authGuard) sendUnlockEmail(r *http.Request, db database.DatabaseInterface, email string, d time.Duration) {
+	user, err := db.GetUserByEmail(email)
+	if err != nil {
+		return
+	}
+	g.alerts.failedAttempts(r, db, user.ID, user.Email, d)
+	text := fmt.Sprintf("We blocked sign-in to your Tab Sync account for %s after several failed attempts.\n\n", d)
+	// 未配置 BASE_URL 时不附解锁链接（不能用请求的 Host 拼链接：它由客户端控制）
+	if link, ok := g.unlockURL(email); ok {
+		text += fmt.Sprintf("If this was you, unlock your account now:\n%s\n\n", link)
+	}
+	text += "If it wasn't, you can ignore this email; the block lifts automatically.\n"
+	if err := g.mailer.Send(r.Context(), notify.Email{
+		To:      user.Email,
+		Subject: "Tab Sync sign-in temporarily blocked",
+		Text:    text,
+	}); err != nil {
+		fmt.Printf("❌ Failed to send unlock email: %v\n", err)
+	}
+}
+
+// unlockURL 基于 BASE_URL（启动时已校验为绝对 URL）生成带有效期签名的解锁链接；未配置时返回 false
+func (g *authGuard) unlockURL(email string) (string, bool) {
+	base := strings.TrimRight(g.baseURL, "/")
+	if base == "" {
+		return "", false
+	}
+	expires := time.Now().Add(unlockLinkTTL).Unix()
+	q := url.Values{}
+	q.Set("email", email)
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", utils.SignValue(g.secret, unlockPayload(email, expires)))
+	return base + "/api/email/unlock?" + q.Encode(), true
+}
+
+func unlockPayload(email string, expires int64) string {
+	return "unlock:" + email + ":" + strconv.FormatInt(expires, 10)
+}
+
+// writeAuthLocked 返回 429 与 Retry-After
+func writeAuthLocked(w http.ResponseWriter, retry time.Duration) {
+	secs := int(math.Ceil(retry.Seconds()))
+	utils.SetRetryAfter(w, retry)
+	utils.WriteAppError(w, utils.ErrAuthLocked.WithDetails(fmt.Sprintf("retry after %d seconds", secs)))
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tab-sync-backend-refactor/pkg/cache"
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 用其他密钥签名、声明受害者邮箱的刷新令牌不能锁定该邮箱，只计入请求方 IP
+func TestRefreshForgedTokenLocksOnlyIP(t *testing.T) {
+	const victim = "victim@example.com"
+	guard := &authGuard{store: cache.NewMemoryStore()}
+	h := &AuthHandler{config: &config.Config{JWTSecret: "server-secret"}, guard: guard}
+	_, forged, _, err := utils.NewJWTService("attacker-secret").GenerateTokenPair("u1", victim, models.TokenProfile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < authIPThreshold; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"`+forged+`"}`))
+		req.RemoteAddr = "203.0.113.7:1234"
+		rec := httptest.NewRecorder()
+		h.RefreshToken(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, rec.Code)
+		}
+	}
+
+	ctx := context.Background()
+	if retry := guard.lockedFor(ctx, victim, ""); retry != 0 {
+		t.Errorf("victim email locked for %s, want unlocked", retry)
+	}
+	if retry := guard.lockedFor(ctx, "", "203.0.113.7"); retry == 0 {
+		t.Error("attacker IP not locked after threshold failures")
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/geoip"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 登录记录列表的默认与最大条数
+const (
+	defaultLoginEventLimit = 20
+	maxLoginEventLimit     = 100
+)
+
+const maxUserAgentLen = 255
+
+// locateRequest 返回请求客户端 IP 及其 GeoIP 位置；查询失败只记录日志，位置留空
+func locateRequest(cfg *config.Config, r *http.Request) (string, models.GeoLocation) {
+	ip := middleware.ClientIP(r)
+	loc, err := geoip.Shared(cfg).Lookup(r.Context(), ip)
+	if err != nil {
+		fmt.Printf("⚠️  geoip lookup for %s failed: %v\n", ip, err)
+	}
+	if loc == nil {
+		return ip, models.GeoLocation{}
+	}
+	return ip, *loc
+}
+
+// recordLogin 记录一次成功登录，并在登录来自从未出现过的国家时告警；写入失败不影响登录本身
+func (h *AuthHandler) recordLogin(r *http.Request, user *models.User, method string) {
+	ip, loc := locateRequest(h.config, r)
+	h.alerts.checkNewCountry(r, h.db, user.ID, user.Email, loc.Country, ip)
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLen {
+		ua = ua[:maxUserAgentLen]
+	}
+	event := &models.LoginEvent{UserID: user.ID, Method: method, IP: ip, UserAgent: ua, GeoLocation: loc}
+	if err := h.db.RecordLoginEvent(event); err != nil {
+		fmt.Printf("⚠️  failed to record login for user %s: %v\n", user.ID, err)
+	}
+}
+
+// ListLoginEvents GET /api/user/login-events?limit=20
+// 最近的登录记录（方式、IP、位置、User-Agent），供账户安全页识别可疑登录
+func (h *AuthHandler) ListLoginEvents(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	limit := defaultLoginEventLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			utils.WriteBadRequestResponse(w, "limit must be a positive integer")
+			return
+		}
+		if n > maxLoginEventLimit {
+			n = maxLoginEventLimit
+		}
+		limit = n
+	}
+	events, err := h.db.ListLoginEvents(user.ID, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"events": events})
+}
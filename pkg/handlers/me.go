@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// meOrganization 组织摘要及当前用户的角色（GET /api/me）
+type meOrganization struct {
+	ID     string               `json:"id"`
+	Name   string               `json:"name"`
+	Avatar string               `json:"avatar,omitempty"`
+	Color  string               `json:"color,omitempty"`
+	Region string               `json:"region,omitempty"`
+	Role   models.OrgMemberRole `json:"role"`
+}
+
+// tokenProfile 读取签发访问令牌的账户声明；先读版本，读取期间发生的变更会让新令牌立即过时而再次刷新，不会漏掉
+func tokenProfile(db database.DatabaseInterface, userID string) (models.TokenProfile, error) {
+	version, err := db.GetTokenVersion(userID)
+	if err != nil {
+		return models.TokenProfile{}, err
+	}
+	sub, err := db.GetUserWithSubscription(userID)
+	if err != nil {
+		return models.TokenProfile{}, err
+	}
+	orgs, err := db.ListUserOrganizations(userID)
+	if err != nil {
+		return models.TokenProfile{}, err
+	}
+	profile := models.TokenProfile{Tier: string(sub.EffectiveTier()), Version: version}
+	for _, o := range orgs {
+		if len(profile.Orgs) == models.MaxTokenOrgs {
+			break
+		}
+		profile.Orgs = append(profile.Orgs, o.ID)
+	}
+	return profile, nil
+}
+
+// GET /api/me
+// 登录后扩展需要的全部账户信息：资料、有效等级与终身会员、试用/催缴状态、当前周期 AI 积分、组织及角色、默认组织
+func (h *AuthHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	authUser, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	user, err := h.db.GetUserByID(authUser.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sub, err := h.db.GetUserWithSubscription(authUser.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var credits interface{}
+	if c, err := h.db.GetUserAICredits(authUser.ID); err == nil {
+		credits = map[string]interface{}{
+			"total":      c.CreditsTotal,
+			"used":       c.CreditsUsed,
+			"remaining":  c.CreditsRemaining,
+			"period_end": c.PeriodEnd,
+		}
+	} else if !errors.Is(err, database.ErrNotFound) {
+		writeError(w, err)
+		return
+	}
+
+	orgs, err := h.db.ListUserOrganizations(authUser.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	grants, err := h.db.ListPermissionGrants(authUser.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	roles := map[string]models.OrgMemberRole{}
+	for _, g := range grants {
+		if g.Role != "" {
+			roles[g.OrganizationID] = g.Role
+		}
+	}
+	memberships := make([]meOrganization, 0, len(orgs))
+	for _, o := range orgs {
+		memberships = append(memberships, meOrganization{
+			ID: o.ID, Name: o.Name, Avatar: o.Avatar, Color: o.Color, Region: o.Region, Role: roles[o.ID],
+		})
+	}
+	var defaultOrgID string
+	if o := models.DefaultOrganization(orgs, authUser.ID); o != nil {
+		defaultOrgID = o.ID
+	}
+
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":         user.ID,
+			"email":      user.Email,
+			"name":       user.Name,
+			"avatar":     user.Avatar,
+			"provider":   user.Provider,
+			"created_at": user.CreatedAt,
+		},
+		"tier":                    string(sub.EffectiveTier()),
+		"is_lifetime_member":      sub.IsLifetimeMember,
+		"lifetime_member_type":    sub.LifetimeMemberType,
+		"trial_active":            sub.TrialActive,
+		"trial_ends_at":           sub.TrialEndsAt,
+		"dunning_status":          sub.DunningStatus,
+		"ai_credits":              credits,
+		"organizations":           memberships,
+		"default_organization_id": defaultOrgID,
+	})
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/notify"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// notifier 业务事件的通知投递渠道
+var notifier notify.Notifier = notify.InAppNotifier{}
+
+// notifyUser 投递通知；失败只记录日志，不影响已完成的业务操作
+func notifyUser(r *http.Request, n notify.Notification) {
+	if err := notifier.Notify(r.Context(), n); err != nil {
+		fmt.Printf("⚠️ Failed to notify user %s (%s): %v\n", n.UserID, n.Kind, err)
+	}
+}
+
+// 每周摘要：每次任务最多处理 digestBatchSize 个用户（受函数时长限制），同一用户两次发送至少间隔 digestInterval 减 1 小时
+const (
+	digestBatchSize = 50
+	digestInterval  = 7 * 24 * time.Hour
+)
+
+// unsubscribeTopicWeeklyDigest 退订链接中的主题名
+const unsubscribeTopicWeeklyDigest = "weekly_digest"
+
+// NotificationsHandler 站内通知、通知偏好与每周摘要邮件
+type NotificationsHandler struct {
+	config *config.Config
+	db     database.DatabaseInterface
+	mailer notify.Mailer
+}
+
+// NewNotificationsHandler 创建通知处理器
+func NewNotificationsHandler(cfg *config.Config) *NotificationsHandler {
+	return &NotificationsHandler{
+		config: cfg,
+		mailer: notify.NewMailer(cfg),
+	}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *NotificationsHandler) withRequest(r *http.Request) *NotificationsHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// ListNotifications 按时间倒序分页列出通知；?unread=true 只返回未读
+func (h *NotificationsHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	pg := utils.ParsePagination(r)
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	list, total, err := h.db.ListNotifications(user.ID, unreadOnly, pg.PerPage, (pg.Page-1)*pg.PerPage)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteListResponse(w, list, pg.Meta(total))
+}
+
+// UnreadCount 返回未读通知数（扩展角标轮询）
+func (h *NotificationsHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	unread, err := h.db.CountUnreadNotifications(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"unread": unread})
+}
+
+// MarkRead 将通知标记为已读：{"ids":[...]} 指定通知，或 {"all":true} 全部
+func (h *NotificationsHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		IDs []string `json:"ids"`
+		All bool     `json:"all"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if len(req.IDs) == 0 && !req.All {
+		utils.WriteValidationErrorResponse(w, "Nothing to mark", "provide ids or all=true")
+		return
+	}
+	ids := req.IDs
+	if req.All {
+		ids = nil
+	}
+
+	updated, err := h.db.MarkNotificationsRead(user.ID, ids)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	unread, err := h.db.CountUnreadNotifications(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"updated": updated,
+		"unread":  unread,
+	})
+}
+
+// GetPreferences 返回通知偏好（未设置过时为默认值）
+func (h *NotificationsHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	prefs, err := h.db.GetNotificationPreferences(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, prefs)
+}
+
+// UpdatePreferences 修改通知偏好：{"weekly_digest": false}
+func (h *NotificationsHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		WeeklyDigest *bool `json:"weekly_digest"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if req.WeeklyDigest == nil {
+		utils.WriteValidationErrorResponse(w, "Nothing to update", "provide weekly_digest")
+		return
+	}
+
+	prefs, err := h.db.GetNotificationPreferences(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	prefs.WeeklyDigest = *req.WeeklyDigest
+	if err := h.db.UpdateNotificationPreferences(prefs); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, prefs)
+}
+
+// Unsubscribe 邮件中的退订链接（无需登录，以签名校验 u 与 topic）。
+// GET 为用户点击，POST 为邮件客户端的一键退订（RFC 8058 List-Unsubscribe-Post）。
+func (h *NotificationsHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	q := r.URL.Query()
+	userID, topic, sig := q.Get("u"), q.Get("topic"), q.Get("sig")
+
+	if userID == "" || topic != unsubscribeTopicWeeklyDigest ||
+		!utils.VerifySignedValue(h.config.JWTSecret, unsubscribePayload(userID, topic), sig) {
+		if r.Method == http.MethodPost {
+			utils.WriteErrorResponseWithCode(w, http.StatusBadRequest, "INVALID_SIGNATURE", "Invalid unsubscribe link", "")
+			return
+		}
+		renderPage(w, "unsubscribed.html", map[string]interface{}{"OK": false})
+		return
+	}
+
+	prefs, err := h.db.GetNotificationPreferences(userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	prefs.WeeklyDigest = false
+	if err := h.db.UpdateNotificationPreferences(prefs); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		utils.WriteSuccessResponse(w, map[string]interface{}{"unsubscribed": topic})
+		return
+	}
+	renderPage(w, "unsubscribed.html", map[string]interface{}{"OK": true, "Topic": "weekly digest"})
+}
+
+// SendWeeklyDigest 定时任务：为开启每周摘要、上次发送已满一周的用户汇总新增条目、新共享的空间与失效链接并发送邮件。
+// 没有任何动态的用户不发邮件但同样记录发送时间；发送失败的用户不记录，下次运行重试。
+func (h *NotificationsHandler) SendWeeklyDigest(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	now := time.Now().UTC()
+	users, err := h.db.ListDigestRecipients(now.Add(-digestInterval+time.Hour), digestBatchSize)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	sent, skipped, failed := 0, 0, 0
+	for _, u := range users {
+		digest, err := h.db.GetActivityDigest(u.ID, now.Add(-digestInterval))
+		if err != nil {
+			fmt.Printf("❌ Failed to build digest for user %s: %v\n", u.ID, err)
+			failed++
+			continue
+		}
+		if digest.Empty() {
+			skipped++
+		} else {
+			if err := h.sendDigest(r, u, digest); err != nil {
+				fmt.Printf("❌ Failed to send digest to user %s: %v\n", u.ID, err)
+				failed++
+				continue
+			}
+			sent++
+		}
+		if err := h.db.MarkDigestSent(u.ID, now); err != nil {
+			fmt.Printf("⚠️ Failed to record digest for user %s: %v\n", u.ID, err)
+		}
+	}
+
+	fmt.Printf("📬 Weekly digest job: %d sent, %d empty, %d failed\n", sent, skipped, failed)
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"sent":    sent,
+		"skipped": skipped,
+		"failed":  failed,
+	})
+}
+
+func (h *NotificationsHandler) sendDigest(r *http.Request, u models.User, digest *models.ActivityDigest) error {
+	unsubscribeURL := h.unsubscribeURL(r, u.ID, unsubscribeTopicWeeklyDigest)
+	html, err := renderString("digest_email.html", map[string]interface{}{
+		"Digest":         digest,
+		"UnsubscribeURL": unsubscribeURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Your week in Tab Sync (since %s)\n\n", digest.Since.Format("Jan 2"))
+	if digest.NewItemsCount > 0 {
+		fmt.Fprintf(&text, "%d new saved tabs\n", digest.NewItemsCount)
+		for _, it := range digest.RecentItems {
+			fmt.Fprintf(&text, "  - %s (%s)\n", it.Title, it.URL)
+		}
+	}
+	if len(digest.SharedSpaces) > 0 {
+		fmt.Fprintf(&text, "\nShared with you\n")
+		for _, s := range digest.SharedSpaces {
+			fmt.Fprintf(&text, "  - %s (%s)\n", s.Name, s.Organization)
+		}
+	}
+	if digest.DeadLinksCount > 0 {
+		fmt.Fprintf(&text, "\n%d dead links found\n", digest.DeadLinksCount)
+		for _, it := range digest.DeadLinks {
+			fmt.Fprintf(&text, "  - %s (%s)\n", it.Title, it.URL)
+		}
+	}
+	fmt.Fprintf(&text, "\nUnsubscribe: %s\n", unsubscribeURL)
+
+	return h.mailer.Send(r.Context(), notify.Email{
+		To:      u.Email,
+		Subject: "Your weekly Tab Sync digest",
+		Text:    text.String(),
+		HTML:    html,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// unsubscribeURL 生成带签名的退订链接；未配置 BASE_URL 时使用当前请求的主机
+func (h *NotificationsHandler) unsubscribeURL(r *http.Request, userID, topic string) string {
+	base := strings.TrimRight(h.config.BaseURL, "/")
+	if base == "" {
+		scheme := "https"
+		if r.TLS == nil && r.URL.Scheme == "http" {
+			scheme = "http"
+		}
+		base = scheme + "://" + r.Host
+	}
+	q := url.Values{}
+	q.Set("u", userID)
+	q.Set("topic", topic)
+	q.Set("sig", utils.SignValue(h.config.JWTSecret, unsubscribePayload(userID, topic)))
+	return base + "/api/email/unsubscribe?" + q.Encode()
+}
+
+func unsubscribePayload(userID, topic string) string {
+	return "unsubscribe:" + userID + ":" + topic
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	chiRoute "github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const (
+	minOrgSlugLen = 3
+	maxOrgSlugLen = 40
+	// orgSlugAttempts 自动生成时按 base、base-2 … 依次尝试，之后改用随机后缀
+	orgSlugAttempts = 5
+)
+
+// orgSlugPattern 小写字母、数字与单个连字符，首尾不能是连字符
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// reservedOrgSlugs 与前端顶层路由或常见保留词冲突的 slug，不允许使用
+var reservedOrgSlugs = map[string]bool{
+	"api": true, "app": true, "admin": true, "auth": true, "new": true, "settings": true,
+	"login": true, "logout": true, "signup": true, "pricing": true, "help": true, "support": true,
+	"www": true, "static": true, "assets": true, "o": true, "org": true, "orgs": true,
+}
+
+// validOrgSlug 校验用户指定的 slug，返回面向客户端的错误说明
+func validOrgSlug(slug string) error {
+	switch {
+	case len(slug) < minOrgSlugLen || len(slug) > maxOrgSlugLen:
+		return fmt.Errorf("slug must be %d-%d characters", minOrgSlugLen, maxOrgSlugLen)
+	case !orgSlugPattern.MatchString(slug):
+		return errors.New("slug may only contain lowercase letters, digits and single hyphens, and cannot start or end with a hyphen")
+	case reservedOrgSlugs[slug]:
+		return fmt.Errorf("slug %q is reserved", slug)
+	}
+	return nil
+}
+
+// slugify 把组织名转为 slug 候选：ASCII 字母数字保留，其余字符折叠为单个连字符。
+// 结果过短或为保留词时（如全中文名称）退回 "org"，由 assignOrgSlug 追加后缀
+func slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			hyphen = false
+		} else if !hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+	slug := strings.Trim(b.String(), "-")
+	// 为 "-2"、"-a1b2c3" 等后缀预留长度
+	if len(slug) > maxOrgSlugLen-7 {
+		slug = strings.TrimRight(slug[:maxOrgSlugLen-7], "-")
+	}
+	if validOrgSlug(slug) != nil {
+		return "org"
+	}
+	return slug
+}
+
+// assignOrgSlug 为新建组织生成唯一 slug（best-effort）：冲突时依次尝试 base-2、base-3…，
+// 再尝试随机后缀；失败只记录日志，组织仍可通过 ID 访问
+func assignOrgSlug(db database.DatabaseInterface, org *models.Organization) {
+	base := slugify(org.Name)
+	for i := 1; i <= orgSlugAttempts+2; i++ {
+		candidate := base
+		switch {
+		case i > orgSlugAttempts:
+			suffix := make([]byte, 3)
+			if _, err := rand.Read(suffix); err != nil {
+				fmt.Printf("⚠️ Failed to generate slug suffix: %v\n", err)
+				return
+			}
+			candidate = base + "-" + hex.EncodeToString(suffix)
+		case i > 1 || base == "org":
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		err := db.SetOrganizationSlug(org.ID, candidate)
+		if err == nil {
+			org.Slug = candidate
+			return
+		}
+		if !errors.Is(err, database.ErrSlugTaken) {
+			fmt.Printf("⚠️ Failed to assign slug to organization %s: %v\n", org.ID, err)
+			return
+		}
+	}
+	fmt.Printf("⚠️ Could not find a free slug for organization %s\n", org.ID)
+}
+
+// PUT /api/orgs/{id}/slug
+// owner/admin 修改组织 slug；旧 slug 立即释放，之前分享的 /o/{旧 slug} 链接将失效
+func (h *OrgsHandler) UpdateSlug(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chiRoute.URLParam(r, "id")
+	role, ok := h.requireOrgMember(w, user.ID, orgID)
+	if !ok {
+		return
+	}
+	if role != models.RoleOwner && role != models.RoleAdmin {
+		utils.WriteForbiddenResponse(w, "Only owner/admin can change the organization URL")
+		return
+	}
+	var req struct {
+		Slug string `json:"slug"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid body")
+		return
+	}
+	slug := strings.ToLower(strings.TrimSpace(req.Slug))
+	if err := validOrgSlug(slug); err != nil {
+		utils.WriteValidationErrorResponse(w, "Invalid slug", err.Error())
+		return
+	}
+	if err := h.db.SetOrganizationSlug(orgID, slug); err != nil {
+		writeError(w, err)
+		return
+	}
+	org, err := h.db.GetOrganization(orgID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"organization": org})
+}
+
+// GET /api/orgs/by-slug/{slug}
+// 解析 /o/{slug} 分享链接；非成员与不存在的 slug 一样返回 404，不暴露组织是否存在
+func (h *OrgsHandler) GetOrganizationBySlug(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	org, err := h.db.GetOrganizationBySlug(strings.ToLower(strings.TrimSpace(chiRoute.URLParam(r, "slug"))))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	role, ok := h.getUserRoleInOrg(user.ID, org.ID)
+	if !ok {
+		utils.WriteAppError(w, utils.ErrOrgNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"organization": org, "role": role})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	chiRoute "github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// quotaUsage 单个路由类别在某天的用量；limit 为 0 表示不限，此时不返回 remaining
+type quotaUsage struct {
+	Used      int64  `json:"used"`
+	Limit     int    `json:"limit"`
+	Remaining *int64 `json:"remaining,omitempty"`
+}
+
+// dailyUsage 某个 UTC 自然日的用量（read / write）
+type dailyUsage struct {
+	Date    string                `json:"date"`
+	Classes map[string]quotaUsage `json:"classes"`
+}
+
+// GET /api/orgs/{id}/usage
+// 组织 API 用量（owner/admin）：按所有者等级计算的每日上限、今日各类别用量与重置时间，以及最近 7 天的历史（今天在前）
+func (h *OrgsHandler) GetOrgUsage(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chiRoute.URLParam(r, "id")
+	if strings.TrimSpace(orgID) == "" {
+		utils.WriteBadRequestResponse(w, "organization id required")
+		return
+	}
+	role, ok := h.requireOrgMember(w, user.ID, orgID)
+	if !ok {
+		return
+	}
+	if role != models.RoleOwner && role != models.RoleAdmin {
+		utils.WriteForbiddenResponse(w, "Only owner/admin can view API usage")
+		return
+	}
+
+	quotas := middleware.NewOrgQuotas(h.config)
+	tier, err := quotas.OrgTier(r.Context(), h.db, orgID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	now := time.Now().UTC()
+	days := make([]dailyUsage, 0, middleware.OrgQuotaHistoryDays)
+	for i := 0; i < middleware.OrgQuotaHistoryDays; i++ {
+		day := now.AddDate(0, 0, -i)
+		usage := dailyUsage{Date: day.Format("2006-01-02"), Classes: map[string]quotaUsage{}}
+		for _, class := range middleware.QuotaClasses {
+			used, err := quotas.Used(r.Context(), orgID, class, day)
+			if err != nil {
+				utils.WriteAppError(w, utils.ErrServiceUnavailable.WithDetails("usage counters unavailable"))
+				return
+			}
+			u := quotaUsage{Used: used, Limit: quotas.Limit(tier, class)}
+			if u.Limit > 0 {
+				remaining := int64(u.Limit) - used
+				if remaining < 0 {
+					remaining = 0
+				}
+				u.Remaining = &remaining
+			}
+			usage.Classes[class] = u
+		}
+		days = append(days, usage)
+	}
+
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"organization_id": orgID,
+		"tier":            string(tier),
+		"today":           days[0],
+		"reset_at":        middleware.QuotaReset(now),
+		"history":         days,
+	})
+}
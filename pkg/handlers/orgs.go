@@ -1,15 +1,19 @@
 package handlers
 
 import (
+    "errors"
     "fmt"
     "net/http"
     "strings"
     "time"
+    "unicode/utf8"
 
     "tab-sync-backend-refactor/pkg/config"
     "tab-sync-backend-refactor/pkg/database"
+    "tab-sync-backend-refactor/pkg/encryption"
     "tab-sync-backend-refactor/pkg/middleware"
     "tab-sync-backend-refactor/pkg/models"
+    "tab-sync-backend-refactor/pkg/notify"
     "tab-sync-backend-refactor/pkg/utils"
     chiRoute "github.com/go-chi/chi/v5"
 )
@@ -19,20 +23,32 @@ type OrgsHandler struct {
     db     database.DatabaseInterface
 }
 
-func NewOrgsHandler(cfg *config.Config, db database.DatabaseInterface) *OrgsHandler {
-    return &OrgsHandler{config: cfg, db: db}
+func NewOrgsHandler(cfg *config.Config) *OrgsHandler {
+    return &OrgsHandler{config: cfg}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *OrgsHandler) withRequest(r *http.Request) *OrgsHandler {
+    c := *h
+    c.db = database.FromContext(r.Context())
+    return &c
 }
 
 // ==== helpers: membership/role checks ====
 func (h *OrgsHandler) getUserRoleInOrg(userID, orgID string) (models.OrgMemberRole, bool) {
+    return orgMemberRole(h.db, userID, orgID)
+}
+
+// orgMemberRole returns the user's role in the organization (owner fast-path, then memberships)
+func orgMemberRole(db database.DatabaseInterface, userID, orgID string) (models.OrgMemberRole, bool) {
     // owner fast-path
-    if org, err := h.db.GetOrganization(orgID); err == nil {
+    if org, err := db.GetOrganization(orgID); err == nil {
         if org.OwnerID == userID {
             return models.RoleOwner, true
         }
     }
     // check memberships
-    members, err := h.db.ListOrganizationMembers(orgID)
+    members, err := db.ListOrganizationMembers(orgID)
     if err != nil {
         return "", false
     }
@@ -47,7 +63,7 @@ func (h *OrgsHandler) getUserRoleInOrg(userID, orgID string) (models.OrgMemberRo
 func (h *OrgsHandler) requireOrgMember(w http.ResponseWriter, userID, orgID string) (models.OrgMemberRole, bool) {
     role, ok := h.getUserRoleInOrg(userID, orgID)
     if !ok {
-        utils.WriteForbiddenResponse(w, "Not a member of organization")
+        utils.WriteAppError(w, utils.ErrNotOrgMember)
         return "", false
     }
     return role, true
@@ -64,6 +80,7 @@ func (h *OrgsHandler) requireOwner(w http.ResponseWriter, userID, orgID string)
 
 // POST /api/orgs
 func (h *OrgsHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     var req struct{
@@ -71,17 +88,27 @@ func (h *OrgsHandler) CreateOrganization(w http.ResponseWriter, r *http.Request)
         Description string `json:"description"`
         Avatar string `json:"avatar"`
         Color string `json:"color"`
+        Region string `json:"region"` // 数据驻留区域（us/eu），为空时使用主库区域；创建后不可修改
         DefaultSpaces []struct{ Name, Description string; IsDefault bool } `json:"default_spaces"`
         InviteEmails []string `json:"invite_emails"`
     }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
     if strings.TrimSpace(req.Name) == "" { utils.WriteBadRequestResponse(w, "Name required"); return }
+    region := strings.ToLower(strings.TrimSpace(req.Region))
+    if region != "" && region != h.config.HomeRegion {
+        if _, ok := h.config.RegionDSNs()[region]; !ok {
+            utils.WriteValidationErrorResponse(w, "Unsupported region", fmt.Sprintf("region %q is not available", region))
+            return
+        }
+    }
 
     // Default color if not provided
-    color := strings.TrimSpace(req.Color)
-    if color == "" { color = "#3b82f6" }
-    org := &models.Organization{ Name: req.Name, Description: req.Description, Avatar: req.Avatar, Color: color, OwnerID: user.ID }
-    if err := h.db.CreateOrganization(org); err != nil { utils.WriteInternalServerErrorResponse(w, "Create org failed: "+err.Error()); return }
+    color, ok := orgColor(w, req.Color)
+    if !ok { return }
+    if color == "" { color = defaultOrgColor }
+    org := &models.Organization{ Name: req.Name, Description: req.Description, Avatar: req.Avatar, Color: color, OwnerID: user.ID, Region: region }
+    if err := h.db.CreateOrganization(org); err != nil { writeError(w, err); return }
+    assignOrgSlug(h.db, org)
 
     // Create optional default spaces
     for _, s := range req.DefaultSpaces {
@@ -102,8 +129,25 @@ func (h *OrgsHandler) CreateOrganization(w http.ResponseWriter, r *http.Request)
     utils.WriteSuccessResponse(w, map[string]interface{}{ "organization": org })
 }
 
+// organizations.color 为 VARCHAR(20)
+const (
+    defaultOrgColor = "#3b82f6"
+    maxOrgColorLen  = 20
+)
+
+// orgColor 去掉首尾空白并校验长度（超长会在写库时失败）；不合法时写入 400 并返回 false
+func orgColor(w http.ResponseWriter, raw string) (string, bool) {
+    color := strings.TrimSpace(raw)
+    if utf8.RuneCountInString(color) > maxOrgColorLen {
+        utils.WriteValidationErrorResponse(w, "Invalid color", fmt.Sprintf("color must be at most %d characters", maxOrgColorLen))
+        return "", false
+    }
+    return color, true
+}
+
 // PUT /api/orgs/{id}
 func (h *OrgsHandler) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     orgID := chiRoute.URLParam(r, "id")
@@ -122,61 +166,156 @@ func (h *OrgsHandler) UpdateOrganization(w http.ResponseWriter, r *http.Request)
         Avatar string `json:"avatar"`
         Color string `json:"color"`
     }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
     // Load current org (optional)
     org, err := h.db.GetOrganization(orgID)
-    if err != nil { utils.WriteNotFoundResponse(w, "organization not found"); return }
+    if err != nil { writeError(w, err); return }
     // Apply patch values (only non-empty)
     if strings.TrimSpace(req.Name) != "" { org.Name = req.Name }
     if strings.TrimSpace(req.Description) != "" { org.Description = req.Description }
     if strings.TrimSpace(req.Avatar) != "" { org.Avatar = req.Avatar }
-    if strings.TrimSpace(req.Color) != "" { org.Color = req.Color }
-    if err := h.db.UpdateOrganization(org); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    color, ok := orgColor(w, req.Color)
+    if !ok { return }
+    if color != "" { org.Color = color }
+    if err := h.db.UpdateOrganization(org); err != nil { writeError(w, err); return }
     utils.WriteSuccessResponse(w, map[string]interface{}{"organization": org})
 }
 
+// GET /api/orgs/{id}/encryption
+func (h *OrgsHandler) GetEncryption(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    orgID := chiRoute.URLParam(r, "id")
+    if strings.TrimSpace(orgID) == "" { utils.WriteBadRequestResponse(w, "organization id required"); return }
+    if _, ok := h.requireOrgMember(w, user.ID, orgID); !ok { return }
+    wrapped, err := h.db.GetOrganizationDataKey(orgID)
+    if err != nil { writeError(w, err); return }
+    utils.WriteSuccessResponse(w, map[string]interface{}{
+        "enabled":   wrapped != "",
+        "available": h.config.EncryptionMasterKey != "",
+    })
+}
+
+// POST /api/orgs/{id}/encryption
+// 为组织生成数据密钥并启用应用层加密（仅 owner，不可关闭）；之后写入的条目加密存储，已有条目在下次修改时加密
+func (h *OrgsHandler) EnableEncryption(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    orgID := chiRoute.URLParam(r, "id")
+    if strings.TrimSpace(orgID) == "" { utils.WriteBadRequestResponse(w, "organization id required"); return }
+    if !h.requireOwner(w, user.ID, orgID) { return }
+    if h.config.EncryptionMasterKey == "" {
+        utils.WriteAppError(w, utils.ErrNotImplemented.WithMessage("Encryption is not configured on this server"))
+        return
+    }
+    wrapped, err := h.db.GetOrganizationDataKey(orgID)
+    if err != nil { writeError(w, err); return }
+    if wrapped == "" {
+        wrapper, err := encryption.NewLocalKeyWrapper(h.config.EncryptionMasterKey)
+        if err != nil { writeError(w, err); return }
+        dataKey, err := encryption.GenerateDataKey()
+        if err != nil { writeError(w, err); return }
+        wrapped, err := wrapper.Wrap(dataKey)
+        if err != nil { writeError(w, err); return }
+        // 并发启用时以先写入的密钥为准
+        if err := h.db.SetOrganizationDataKey(orgID, wrapped); err != nil && !errors.Is(err, database.ErrDataKeyExists) {
+            writeError(w, err)
+            return
+        }
+    }
+    utils.WriteSuccessResponse(w, map[string]interface{}{"enabled": true, "available": true})
+}
+
 // GET /api/orgs
 func (h *OrgsHandler) ListMyOrganizations(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     orgs, err := h.db.ListUserOrganizations(user.ID)
     if err != nil {
         fmt.Printf("[error] ListMyOrganizations failed for user=%s: %v\n", user.ID, err)
-        utils.WriteInternalServerErrorResponse(w, err.Error()); return }
-    // Compute weak ETag: orgs:<user>:<count>:<maxUpdated>
+        writeError(w, err); return }
+    // Compute weak ETag: orgs:<user>:<count>:<maxUpdated>:<page>:<per_page>
+    pg := utils.ParsePaginationOrAll(r)
     var maxUpdated int64
     for _, o := range orgs {
         if ts := o.UpdatedAt.UnixMilli(); ts > maxUpdated { maxUpdated = ts }
     }
-    etag := fmt.Sprintf("W/\"orgs:%s:%d:%d\"", user.ID, len(orgs), maxUpdated)
+    etag := fmt.Sprintf("W/\"orgs:%s:%d:%d:%d:%d\"", user.ID, len(orgs), maxUpdated, pg.Page, pg.PerPage)
     ifNone := r.Header.Get("If-None-Match")
     w.Header().Set("ETag", etag)
     if ifNone == etag {
         w.WriteHeader(http.StatusNotModified)
         return
     }
-    utils.WriteSuccessResponse(w, map[string]interface{}{ "organizations": orgs })
+    page, meta := utils.PageOf(orgs, pg)
+    utils.WriteListResponse(w, page, meta)
 }
 
 // GET /api/orgs/{orgID}/members
 func (h *OrgsHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     orgID := r.URL.Query().Get("org_id")
     if orgID == "" { utils.WriteBadRequestResponse(w, "org_id required"); return }
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     if _, ok := h.requireOrgMember(w, user.ID, orgID); !ok { return }
-    members, err := h.db.ListOrganizationMembers(orgID)
-    if err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
-    utils.WriteSuccessResponse(w, map[string]interface{}{ "members": members })
+    p := utils.ParsePaginationOrAll(r)
+    members, total, err := h.db.ListOrganizationMemberProfiles(orgID, p.PerPage, (p.Page-1)*p.PerPage)
+    if err != nil { writeError(w, err); return }
+    utils.WriteListResponse(w, members, p.Meta(total))
+}
+
+// DELETE /api/orgs/members/{userID}?org_id=
+// owner 移除成员；其显式空间权限与访客记录由触发器一并清除，已签发的令牌随 token_version 失效
+func (h *OrgsHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
+    orgID := r.URL.Query().Get("org_id")
+    if orgID == "" { utils.WriteBadRequestResponse(w, "org_id required"); return }
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    if !h.requireOwner(w, user.ID, orgID) { return }
+    memberID := chiRoute.URLParam(r, "userID")
+    if role, ok := h.getUserRoleInOrg(memberID, orgID); ok && role == models.RoleOwner {
+        utils.WriteBadRequestResponse(w, "The organization owner cannot be removed")
+        return
+    }
+    if err := h.db.RemoveOrganizationMember(orgID, memberID); err != nil { writeError(w, err); return }
+    utils.WriteSuccessResponse(w, map[string]interface{}{"removed": true, "user_id": memberID})
+}
+
+// spaces.color 为 VARCHAR(20)、icon 为 VARCHAR(50)（与 collections 相同）；按字符计数，emoji 也算一个
+const (
+    maxSpaceColorLen = 20
+    maxSpaceIconLen  = 50
+)
+
+// validSpaceAppearance 校验颜色与图标长度，超长时写入 400 并返回 false
+func validSpaceAppearance(w http.ResponseWriter, color, icon string) bool {
+    if utf8.RuneCountInString(strings.TrimSpace(color)) > maxSpaceColorLen {
+        utils.WriteValidationErrorResponse(w, "Invalid color", fmt.Sprintf("color must be at most %d characters", maxSpaceColorLen))
+        return false
+    }
+    if utf8.RuneCountInString(strings.TrimSpace(icon)) > maxSpaceIconLen {
+        utils.WriteValidationErrorResponse(w, "Invalid icon", fmt.Sprintf("icon must be at most %d characters", maxSpaceIconLen))
+        return false
+    }
+    return true
 }
 
 // POST /api/orgs/{orgID}/spaces
 func (h *OrgsHandler) CreateSpace(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
-    var req struct{ OrganizationID, Name, Description string; IsDefault bool }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    var req struct{ OrganizationID, Name, Description, Color, Icon string; IsDefault bool; DefaultAccess string `json:"default_access"`; Visibility string `json:"visibility"` }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
     if req.OrganizationID == "" || strings.TrimSpace(req.Name) == "" { utils.WriteBadRequestResponse(w, "org_id and name required"); return }
+    if !validSpaceAppearance(w, req.Color, req.Icon) { return }
+    if req.DefaultAccess != "" && !models.ValidSpaceAccess(req.DefaultAccess) { utils.WriteBadRequestResponse(w, "default_access must be edit, view or restricted"); return }
+    if req.Visibility != "" && !models.ValidSpaceVisibility(req.Visibility) { utils.WriteBadRequestResponse(w, "visibility must be org or private"); return }
     // Authorization: only owner (或未来扩展 admin) 可创建空间
     role, ok := h.requireOrgMember(w, user.ID, req.OrganizationID)
     if !ok { return }
@@ -184,13 +323,18 @@ func (h *OrgsHandler) CreateSpace(w http.ResponseWriter, r *http.Request) {
         utils.WriteForbiddenResponse(w, "Only owner/admin can create spaces")
         return
     }
-    space := &models.Space{ OrganizationID: req.OrganizationID, Name: req.Name, Description: req.Description, IsDefault: req.IsDefault }
-    if err := h.db.CreateSpace(space); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    space := &models.Space{ OrganizationID: req.OrganizationID, Name: req.Name, Description: req.Description, Color: strings.TrimSpace(req.Color), Icon: strings.TrimSpace(req.Icon), IsDefault: req.IsDefault, DefaultAccess: req.DefaultAccess, Visibility: req.Visibility }
+    if err := h.db.CreateSpace(space); err != nil { writeError(w, err); return }
+    // 私有空间：创建者获得显式编辑权限，否则自己也看不到
+    if space.Visibility == models.SpaceVisibilityPrivate {
+        if err := h.db.SetSpacePermission(space.ID, user.ID, true); err != nil { writeError(w, err); return }
+    }
     utils.WriteSuccessResponse(w, map[string]interface{}{ "space": space })
 }
 
 // GET /api/orgs/{orgID}/spaces
 func (h *OrgsHandler) ListSpaces(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     orgID := r.URL.Query().Get("org_id")
     if orgID == "" { utils.WriteBadRequestResponse(w, "org_id required"); return }
     // require membership to browse
@@ -198,45 +342,98 @@ func (h *OrgsHandler) ListSpaces(w http.ResponseWriter, r *http.Request) {
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     if _, ok := h.requireOrgMember(w, user.ID, orgID); !ok { return }
     spaces, err := h.db.ListSpacesByOrganization(orgID)
-    if err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    if err != nil { writeError(w, err); return }
+    // 私有空间只对有显式权限的成员列出
+    spaces, err = visibleSpaces(h.db, user.ID, spaces)
+    if err != nil { writeError(w, err); return }
+    // 可见的私有空间因人而异：ETag 含用户与分页参数
+    pg := utils.ParsePaginationOrAll(r)
     var maxUpdated int64
     for _, s := range spaces {
         if ts := s.UpdatedAt.UnixMilli(); ts > maxUpdated { maxUpdated = ts }
     }
-    etag := fmt.Sprintf("W/\"spaces:%s:%d:%d\"", orgID, len(spaces), maxUpdated)
+    etag := fmt.Sprintf("W/\"spaces:%s:%s:%d:%d:%d:%d\"", orgID, user.ID, len(spaces), maxUpdated, pg.Page, pg.PerPage)
     ifNone := r.Header.Get("If-None-Match")
     w.Header().Set("ETag", etag)
     if ifNone == etag {
         w.WriteHeader(http.StatusNotModified)
         return
     }
-    utils.WriteSuccessResponse(w, map[string]interface{}{ "spaces": spaces })
+    page, meta := utils.PageOf(spaces, pg)
+    utils.WriteListResponse(w, page, meta)
 }
 
 // PUT /api/spaces/{spaceID}/permissions
 func (h *OrgsHandler) SetSpacePermission(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     var req struct{ SpaceID, UserID string; CanEdit bool }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
     if req.SpaceID == "" || req.UserID == "" { utils.WriteBadRequestResponse(w, "space_id and user_id required"); return }
     // Only the organization owner of the space's organization can set permissions
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
-    space, err := h.db.GetSpaceByID(req.SpaceID)
-    if err != nil { utils.WriteNotFoundResponse(w, "space not found"); return }
+    space, err := h.db.GetSpaceByID(user.ID, req.SpaceID)
+    if err != nil { writeError(w, err); return }
     if !h.requireOwner(w, user.ID, space.OrganizationID) { return }
-    if err := h.db.SetSpacePermission(req.SpaceID, req.UserID, req.CanEdit); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    // 只能为组织成员或已有访客设置：给非成员写显式权限并不会让其获得访问（访客须经邀请加入）
+    if _, member := h.getUserRoleInOrg(req.UserID, space.OrganizationID); !member {
+        guests, err := h.db.ListSpaceGuests(space.ID)
+        if err != nil { writeError(w, err); return }
+        guest := false
+        for _, g := range guests {
+            if g.UserID == req.UserID { guest = true; break }
+        }
+        if !guest { utils.WriteBadRequestResponse(w, "User is not a member of this organization; invite them as a space guest instead"); return }
+    }
+    if err := h.db.SetSpacePermission(req.SpaceID, req.UserID, req.CanEdit); err != nil { writeError(w, err); return }
     perms, _ := h.db.GetSpacePermissions(req.SpaceID)
     utils.WriteSuccessResponse(w, map[string]interface{}{ "permissions": perms })
 }
 
+// GET /api/orgs/spaces/{id}/permissions
+// 返回每个成员对空间的有效权限（角色默认值 + 显式设置）及成员资料，按成员分页
+func (h *OrgsHandler) ListEffectiveSpacePermissions(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    space, err := h.db.GetSpaceByID(user.ID, chiRoute.URLParam(r, "id"))
+    if err != nil { writeError(w, err); return }
+    if _, ok := h.requireOrgMember(w, user.ID, space.OrganizationID); !ok { return }
+    org, err := h.db.GetOrganization(space.OrganizationID)
+    if err != nil { writeError(w, err); return }
+    p := utils.ParsePagination(r)
+    members, total, err := h.db.ListOrganizationMemberProfiles(space.OrganizationID, p.PerPage, (p.Page-1)*p.PerPage)
+    if err != nil { writeError(w, err); return }
+    perms, err := h.db.GetSpacePermissions(space.ID)
+    if err != nil { writeError(w, err); return }
+    utils.WriteListResponse(w, effectiveSpacePermissions(org.OwnerID, space, members, perms), p.Meta(total))
+}
+
+// effectiveSpacePermissions 按 resolveSpaceAccess 计算每个成员的有效权限
+func effectiveSpacePermissions(ownerID string, space *models.Space, members []models.OrganizationMember, perms []models.SpacePermission) []models.EffectiveSpacePermission {
+    explicit := make(map[string]bool, len(perms))
+    for _, p := range perms { explicit[p.UserID] = p.CanEdit }
+    result := make([]models.EffectiveSpacePermission, 0, len(members))
+    for _, m := range members {
+        e := models.EffectiveSpacePermission{ UserID: m.UserID, Email: m.Email, Name: m.Name, Avatar: m.Avatar, Role: m.Role }
+        if m.UserID == ownerID { e.Role = models.RoleOwner }
+        if canEdit, ok := explicit[m.UserID]; ok { e.Explicit = &canEdit }
+        access := resolveSpaceAccess(e.Role, space, e.Explicit)
+        e.CanView, e.CanEdit, e.Source = access.CanView, access.CanEdit, access.Source
+        result = append(result, e)
+    }
+    return result
+}
+
 // PUT /api/orgs/spaces/{id}
 func (h *OrgsHandler) UpdateSpace(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     spaceID := chiRoute.URLParam(r, "id")
     if strings.TrimSpace(spaceID) == "" { utils.WriteBadRequestResponse(w, "space id required"); return }
-    space, err := h.db.GetSpaceByID(spaceID)
-    if err != nil { utils.WriteNotFoundResponse(w, "space not found"); return }
+    space, err := h.db.GetSpaceByID(user.ID, spaceID)
+    if err != nil { writeError(w, err); return }
     // owner/admin only
     role, ok := h.requireOrgMember(w, user.ID, space.OrganizationID)
     if !ok { return }
@@ -244,23 +441,45 @@ func (h *OrgsHandler) UpdateSpace(w http.ResponseWriter, r *http.Request) {
         utils.WriteForbiddenResponse(w, "Only owner/admin can update spaces")
         return
     }
-    var req struct{ Name, Description string; IsDefault bool }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
-    space.Name = req.Name
-    space.Description = req.Description
-    space.IsDefault = req.IsDefault
-    if err := h.db.UpdateSpace(space); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    // 部分更新：未传的字段保持不变（与 UpdateCollection 相同），color / icon 传空字符串清除
+    var req struct{
+        Name *string `json:"name"`
+        Description *string `json:"description"`
+        IsDefault *bool `json:"is_default"`
+        DefaultAccess *string `json:"default_access"`
+        Visibility *string `json:"visibility"`
+        Color *string `json:"color"`
+        Icon *string `json:"icon"`
+    }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
+    if req.Name != nil && strings.TrimSpace(*req.Name) == "" { utils.WriteBadRequestResponse(w, "name cannot be empty"); return }
+    if req.DefaultAccess != nil && !models.ValidSpaceAccess(*req.DefaultAccess) { utils.WriteBadRequestResponse(w, "default_access must be edit, view or restricted"); return }
+    if req.Visibility != nil && !models.ValidSpaceVisibility(*req.Visibility) { utils.WriteBadRequestResponse(w, "visibility must be org or private"); return }
+    if req.Name != nil { space.Name = *req.Name }
+    if req.Description != nil { space.Description = *req.Description }
+    if req.IsDefault != nil { space.IsDefault = *req.IsDefault }
+    if req.DefaultAccess != nil { space.DefaultAccess = *req.DefaultAccess }
+    if req.Visibility != nil { space.Visibility = *req.Visibility }
+    if req.Color != nil { space.Color = strings.TrimSpace(*req.Color) }
+    if req.Icon != nil { space.Icon = strings.TrimSpace(*req.Icon) }
+    if !validSpaceAppearance(w, space.Color, space.Icon) { return }
+    // 改为私有时为操作者保留显式权限，避免空间对其不可见
+    if req.Visibility != nil && *req.Visibility == models.SpaceVisibilityPrivate {
+        if err := h.db.SetSpacePermission(space.ID, user.ID, true); err != nil { writeError(w, err); return }
+    }
+    if err := h.db.UpdateSpace(space); err != nil { writeError(w, err); return }
     utils.WriteSuccessResponse(w, map[string]interface{}{"space": space})
 }
 
 // DELETE /api/orgs/spaces/{id}
 func (h *OrgsHandler) DeleteSpace(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     spaceID := chiRoute.URLParam(r, "id")
     if strings.TrimSpace(spaceID) == "" { utils.WriteBadRequestResponse(w, "space id required"); return }
-    space, err := h.db.GetSpaceByID(spaceID)
-    if err != nil { utils.WriteNotFoundResponse(w, "space not found"); return }
+    space, err := h.db.GetSpaceByID(user.ID, spaceID)
+    if err != nil { writeError(w, err); return }
     // owner/admin only
     role, ok := h.requireOrgMember(w, user.ID, space.OrganizationID)
     if !ok { return }
@@ -268,54 +487,135 @@ func (h *OrgsHandler) DeleteSpace(w http.ResponseWriter, r *http.Request) {
         utils.WriteForbiddenResponse(w, "Only owner/admin can delete spaces")
         return
     }
-    if err := h.db.DeleteSpace(spaceID); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
+    if err := h.db.DeleteSpace(spaceID); err != nil { writeError(w, err); return }
     utils.WriteSuccessResponse(w, map[string]interface{}{"deleted": true, "id": spaceID})
 }
 
 // POST /api/orgs/{orgID}/invite
+// 按 email 或 user_id 邀请；被邀请人已注册时记录 invitee_id 并发送站内通知，可在应用内直接接受
 func (h *OrgsHandler) InviteMember(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
-    var req struct{ OrganizationID string; Email string }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
-    if req.OrganizationID == "" || req.Email == "" { utils.WriteBadRequestResponse(w, "org_id and email required"); return }
+    var req struct{ OrganizationID string; Email string; UserID string `json:"user_id"` }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
+    req.Email = strings.TrimSpace(req.Email)
+    if req.OrganizationID == "" || (req.Email == "" && req.UserID == "") { utils.WriteBadRequestResponse(w, "org_id and email or user_id required"); return }
     // Only owner can invite
     if !h.requireOwner(w, user.ID, req.OrganizationID) { return }
+
+    var invitee *models.User
+    if req.UserID != "" {
+        invitee, err = h.db.GetUserByID(req.UserID)
+        if err != nil { writeError(w, err); return }
+        req.Email = invitee.Email
+    } else if u, err := h.db.GetUserByEmail(req.Email); err == nil {
+        invitee = u
+    }
+
     tok, err := utils.GenerateURLToken(24)
-    if err != nil { utils.WriteInternalServerErrorResponse(w, "failed to generate token"); return }
+    if err != nil { writeError(w, err); return }
     inv := &models.OrganizationInvitation{ OrganizationID: req.OrganizationID, Email: req.Email, InviterID: user.ID, Token: tok, Status: models.InvitationPending, ExpiresAt: time.Now().Add(14*24*time.Hour) }
-    if err := h.db.CreateInvitation(inv); err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
-    utils.WriteSuccessResponse(w, map[string]interface{}{ "invitation": inv })
+    if invitee != nil { inv.InviteeID = &invitee.ID }
+    if err := h.db.CreateInvitation(inv); err != nil { writeError(w, err); return }
+    // 被邀请人已注册时发送站内通知
+    if invitee != nil {
+        orgName := ""
+        if org, err := h.db.GetOrganization(req.OrganizationID); err == nil { orgName = org.Name }
+        notifyUser(r, notify.Notification{
+            UserID: invitee.ID,
+            Email:  invitee.Email,
+            Kind:   notify.KindInvitationReceived,
+            Title:  "You've been invited to join an organization",
+            Body:   fmt.Sprintf("%s invited you to join %s.", user.Email, orgName),
+            Data:   map[string]interface{}{"organization_id": req.OrganizationID, "invitation_id": inv.ID},
+        })
+    }
+    // 按 user_id 邀请时邮箱只留在服务端：不能让邀请人借此把用户 ID 换成邮箱
+    resp := *inv
+    if req.UserID != "" { resp.Email = "" }
+    utils.WriteSuccessResponse(w, map[string]interface{}{ "invitation": resp })
+}
+
+// userEmails 返回用户的主邮箱与已关联外部账户的邮箱（小写、去重）
+func (h *OrgsHandler) userEmails(user *models.User) []string {
+    seen := map[string]bool{}
+    var emails []string
+    add := func(e string) {
+        e = strings.ToLower(strings.TrimSpace(e))
+        if e != "" && !seen[e] { seen[e] = true; emails = append(emails, e) }
+    }
+    add(user.Email)
+    if identities, err := h.db.ListUserIdentities(user.ID); err == nil {
+        for _, i := range identities { add(i.Email) }
+    } else {
+        fmt.Printf("[warn] failed to list identities for %s: %v\n", user.ID, err)
+    }
+    return emails
 }
 
 // GET /api/invitations/my
 func (h *OrgsHandler) ListMyInvitations(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
-    invs, err := h.db.ListInvitationsByEmail(user.Email)
-    if err != nil { utils.WriteInternalServerErrorResponse(w, err.Error()); return }
-    utils.WriteSuccessResponse(w, map[string]interface{}{ "invitations": invs })
+    invs, err := h.db.ListInvitationsForUser(user.ID, h.userEmails(user))
+    if err != nil { writeError(w, err); return }
+    page, meta := utils.PageOf(invs, utils.ParsePaginationOrAll(r))
+    utils.WriteListResponse(w, page, meta)
 }
 
 // POST /api/invitations/accept
 func (h *OrgsHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
     user, err := middleware.RequireUser(r.Context())
     if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
     var req struct{ Token string }
-    if err := utils.ParseJSONBody(r, &req); err != nil { utils.WriteBadRequestResponse(w, "Invalid body"); return }
+    if err := utils.ParseJSONBody(r, &req); err != nil { writeBodyError(w, err, "Invalid body"); return }
     if req.Token == "" { utils.WriteBadRequestResponse(w, "token required"); return }
     inv, err := h.db.GetInvitationByToken(req.Token)
-    if err != nil { utils.WriteNotFoundResponse(w, "Invitation not found"); return }
-    if inv.Status != models.InvitationPending || time.Now().After(inv.ExpiresAt) { utils.WriteBadRequestResponse(w, "Invitation invalid or expired"); return }
+    if err != nil { writeError(w, err); return }
+    h.acceptInvitation(w, r, user, inv)
+}
+
+// POST /api/invitations/{id}/accept
+// 应用内接受（无需邮件中的 token）：邀请须指向当前用户（invitee_id 或其邮箱之一）
+func (h *OrgsHandler) AcceptInvitationByID(w http.ResponseWriter, r *http.Request) {
+    h = h.withRequest(r)
+    user, err := middleware.RequireUser(r.Context())
+    if err != nil { utils.WriteUnauthorizedResponse(w, "Authentication required"); return }
+    inv, err := h.db.GetInvitationByID(chiRoute.URLParam(r, "id"))
+    if err != nil { writeError(w, err); return }
+    mine := inv.InviteeID != nil && *inv.InviteeID == user.ID
+    for _, e := range h.userEmails(user) {
+        if strings.EqualFold(inv.Email, e) { mine = true }
+    }
+    // 不属于当前用户的邀请按不存在处理，不泄露其存在
+    if !mine { utils.WriteAppError(w, utils.ErrInvitationNotFound); return }
+    h.acceptInvitation(w, r, user, inv)
+}
+
+func (h *OrgsHandler) acceptInvitation(w http.ResponseWriter, r *http.Request, user *models.User, inv *models.OrganizationInvitation) {
+    if inv.Status != models.InvitationPending || time.Now().After(inv.ExpiresAt) { utils.WriteAppError(w, utils.ErrInvitationInvalid); return }
 
     // Add membership
     if err := h.db.AddOrganizationMember(&models.OrganizationMembership{ OrganizationID: inv.OrganizationID, UserID: user.ID, Role: models.RoleMember }); err != nil {
-        utils.WriteInternalServerErrorResponse(w, "Failed to add membership: "+err.Error()); return
+        writeError(w, err); return
     }
     // Update invitation
     inv.Status = models.InvitationAccepted
     inv.AcceptedBy = &user.ID
     if err := h.db.UpdateInvitation(inv); err != nil { fmt.Printf("[warn] update invitation failed: %v\n", err) }
+    // 通知组织所有者有新成员加入
+    if org, err := h.db.GetOrganization(inv.OrganizationID); err == nil && org.OwnerID != user.ID {
+        notifyUser(r, notify.Notification{
+            UserID: org.OwnerID,
+            Kind:   notify.KindMemberJoined,
+            Title:  "A new member joined your organization",
+            Body:   fmt.Sprintf("%s joined %s.", user.Email, org.Name),
+            Data:   map[string]interface{}{"organization_id": org.ID, "user_id": user.ID},
+        })
+    }
 
     utils.WriteSuccessResponse(w, map[string]interface{}{ "organization_id": inv.OrganizationID })
 }
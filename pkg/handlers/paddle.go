@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/tracing"
+)
+
+// paddleHTTPClient 访问 Paddle Billing API 的客户端，每次调用产生一个子 Span
+var paddleHTTPClient = tracing.NewHTTPClient(10 * time.Second)
+
+// paddleAPIBase 按 PADDLE_ENVIRONMENT 选择 Paddle API 地址
+func paddleAPIBase(cfg *config.Config) string {
+	if cfg.PaddleEnvironment == "production" {
+		return "https://api.paddle.com"
+	}
+	return "https://sandbox-api.paddle.com"
+}
+
+// paddleRequest 调用 Paddle API；非 2xx 响应返回包含 Paddle 错误详情的错误
+func paddleRequest(ctx context.Context, cfg *config.Config, method, path string, payload interface{}) ([]byte, error) {
+	if cfg.PaddleAPIKey == "" {
+		return nil, fmt.Errorf("PADDLE_API_KEY is not configured")
+	}
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, paddleAPIBase(cfg)+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.PaddleAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := paddleHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("paddle request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read paddle response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("paddle %s %s returned %d: %s", method, path, resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+// paddleCheckout Paddle 创建交易（结账）的结果
+type paddleCheckout struct {
+	TransactionID string `json:"transaction_id"`
+	CheckoutURL   string `json:"checkout_url,omitempty"`
+}
+
+// paddleCreateCheckout 为订阅价格创建待支付交易；customData 随后续 webhook 回传（user_id 等），
+// discountID 非空时应用 Paddle 折扣
+func paddleCreateCheckout(ctx context.Context, cfg *config.Config, priceID, customerID, discountID string, customData map[string]interface{}) (*paddleCheckout, error) {
+	payload := map[string]interface{}{
+		"items":       []map[string]interface{}{{"price_id": priceID, "quantity": 1}},
+		"custom_data": customData,
+	}
+	if customerID != "" {
+		payload["customer_id"] = customerID
+	}
+	if discountID != "" {
+		payload["discount_id"] = discountID
+	}
+	body, err := paddleRequest(ctx, cfg, http.MethodPost, "/transactions", payload)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			ID       string `json:"id"`
+			Checkout *struct {
+				URL string `json:"url"`
+			} `json:"checkout"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse paddle transaction: %w", err)
+	}
+	checkout := &paddleCheckout{TransactionID: resp.Data.ID}
+	if resp.Data.Checkout != nil {
+		checkout.CheckoutURL = resp.Data.Checkout.URL
+	}
+	return checkout, nil
+}
+
+// paddleChangeSubscriptionPrice 将订阅切换到新价格，按比例立即结算差额（升级补款、降级抵扣）
+func paddleChangeSubscriptionPrice(ctx context.Context, cfg *config.Config, subscriptionID, priceID string) error {
+	_, err := paddleRequest(ctx, cfg, http.MethodPatch, "/subscriptions/"+subscriptionID, map[string]interface{}{
+		"items":                  []map[string]interface{}{{"price_id": priceID, "quantity": 1}},
+		"proration_billing_mode": "prorated_immediately",
+	})
+	return err
+}
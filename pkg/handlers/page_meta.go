@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// pageFetchTimeout 抓取页面的上限（含重定向）
+	pageFetchTimeout = 5 * time.Second
+	// maxPageBytes 只读取页面开头部分：title / meta / link 都在 <head> 中
+	maxPageBytes = 512 << 10
+	// maxPageRedirects 重定向次数上限；每一跳都重新校验地址
+	maxPageRedirects = 3
+	// maxPageTextLen 标题与描述的长度上限（按字符）
+	maxPageTextLen = 300
+)
+
+// pageMeta 从页面 <head> 中提取的元数据
+type pageMeta struct {
+	Title       string
+	Description string
+	FavIconURL  string
+}
+
+var (
+	pageTitlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	pageMetaPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	pageLinkPattern  = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	pageAttrPattern  = regexp.MustCompile(`(?is)([a-z_:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// pageFetchClient 抓取用户保存的页面：与图片代理相同，连接时拒绝非公网地址，不读取代理环境变量
+var pageFetchClient = &http.Client{
+	Timeout: pageFetchTimeout,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: pageFetchTimeout, Control: publicAddressOnly}).DialContext,
+		TLSHandshakeTimeout:   pageFetchTimeout,
+		ResponseHeaderTimeout: pageFetchTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxPageRedirects {
+			return errors.New("too many redirects")
+		}
+		return checkPageURL(req.URL)
+	},
+}
+
+// checkPageURL 只抓取默认端口上的 http/https 页面
+func checkPageURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.User != nil || u.Hostname() == "" {
+		return errors.New("only http and https URLs are fetched")
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return fmt.Errorf("port %s is not allowed", port)
+	}
+	return nil
+}
+
+// fetchPageMeta 抓取页面并提取标题、描述与 favicon（相对地址按最终 URL 解析；页面未声明时取站点根目录的 /favicon.ico）
+func fetchPageMeta(ctx context.Context, rawURL string) (*pageMeta, error) {
+	src, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPageURL(src); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", "TabSyncBot/1.0 (+metadata preview)")
+	resp, err := pageFetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return nil, err
+	}
+	return parsePageMeta(string(body), resp.Request.URL), nil
+}
+
+// parsePageMeta 提取 <title>（缺失时用 og:title）、og:description / description 与 rel 含 icon 的 <link>
+func parsePageMeta(doc string, base *url.URL) *pageMeta {
+	doc = strings.ToValidUTF8(doc, "")
+	meta := &pageMeta{}
+	if m := pageTitlePattern.FindStringSubmatch(doc); m != nil {
+		meta.Title = cleanPageText(m[1])
+	}
+	var ogTitle, ogDescription, description string
+	for _, tag := range pageMetaPattern.FindAllString(doc, -1) {
+		attrs := pageTagAttrs(tag)
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		switch strings.ToLower(key) {
+		case "og:title":
+			ogTitle = cleanPageText(attrs["content"])
+		case "og:description":
+			ogDescription = cleanPageText(attrs["content"])
+		case "description":
+			description = cleanPageText(attrs["content"])
+		}
+	}
+	if meta.Title == "" {
+		meta.Title = ogTitle
+	}
+	meta.Description = ogDescription
+	if meta.Description == "" {
+		meta.Description = description
+	}
+
+	for _, tag := range pageLinkPattern.FindAllString(doc, -1) {
+		attrs := pageTagAttrs(tag)
+		if !containsFold(strings.Fields(attrs["rel"]), "icon") || attrs["href"] == "" {
+			continue
+		}
+		if icon, err := base.Parse(html.UnescapeString(attrs["href"])); err == nil && (icon.Scheme == "http" || icon.Scheme == "https") {
+			meta.FavIconURL = icon.String()
+			break
+		}
+	}
+	if meta.FavIconURL == "" {
+		meta.FavIconURL = (&url.URL{Scheme: base.Scheme, Host: base.Host, Path: "/favicon.ico"}).String()
+	}
+	return meta
+}
+
+// pageTagAttrs 解析标签属性（属性名小写；值未反转义）
+func pageTagAttrs(tag string) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range pageAttrPattern.FindAllStringSubmatch(tag, -1) {
+		attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+	}
+	return attrs
+}
+
+// cleanPageText 反转义实体、合并空白并截断到 maxPageTextLen 个字符
+func cleanPageText(s string) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	if runes := []rune(s); len(runes) > maxPageTextLen {
+		s = string(runes[:maxPageTextLen])
+	}
+	return s
+}
+
+func containsFold(values []string, v string) bool {
+	for _, x := range values {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// spacePermissionView 单个空间的有效权限（GET /api/me/permissions）
+type spacePermissionView struct {
+	OrganizationID string               `json:"organization_id"`
+	Name           string               `json:"name"`
+	Role           models.OrgMemberRole `json:"role"`
+	CanView        bool                 `json:"can_view"`
+	CanEdit        bool                 `json:"can_edit"`
+	Source         string               `json:"source,omitempty"`
+}
+
+// GET /api/me/permissions
+// 一次返回当前用户在各组织的角色（organization_id → role）与各空间的有效权限（space_id → 权限），供前端批量控制界面；
+// 看不到的私有空间不会出现在结果中
+func (h *OrgsHandler) GetMyPermissions(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	grants, err := h.db.ListPermissionGrants(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// 先汇总角色：数据驻留时区域组织的角色行与空间行来自不同的库
+	orgs := map[string]models.OrgMemberRole{}
+	for _, g := range grants {
+		if g.Role != "" {
+			orgs[g.OrganizationID] = g.Role
+		}
+	}
+	spaces := map[string]spacePermissionView{}
+	for _, g := range grants {
+		if g.Space == nil {
+			continue
+		}
+		role := orgs[g.OrganizationID]
+		if role == "" && g.Explicit != nil {
+			role = models.RoleGuest
+		}
+		access := resolveSpaceAccess(role, g.Space, g.Explicit)
+		if !access.CanView && g.Space.Visibility == models.SpaceVisibilityPrivate {
+			continue
+		}
+		spaces[g.Space.ID] = spacePermissionView{
+			OrganizationID: g.OrganizationID,
+			Name:           g.Space.Name,
+			Role:           access.Role,
+			CanView:        access.CanView,
+			CanEdit:        access.CanEdit,
+			Source:         access.Source,
+		}
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"organizations": orgs,
+		"spaces":        spaces,
+	})
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// PromoHandler 优惠码校验与兑换
+type PromoHandler struct {
+	config *config.Config
+	db     database.DatabaseInterface
+}
+
+// NewPromoHandler 创建优惠码处理器
+func NewPromoHandler(cfg *config.Config) *PromoHandler {
+	return &PromoHandler{
+		config: cfg,
+	}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *PromoHandler) withRequest(r *http.Request) *PromoHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// ValidatePromo 校验优惠码是否可被当前用户使用（不兑换）；tier 可选，用于校验折扣是否适用于该计划
+func (h *PromoHandler) ValidatePromo(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+		Tier string `json:"tier"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if models.NormalizePromoCode(req.Code) == "" {
+		utils.WriteValidationErrorResponse(w, "Promo code is required", "code must not be empty")
+		return
+	}
+
+	promo, err := lookupPromo(h.db, req.Code, user.ID, models.UserTier(req.Tier))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, promoResponse(promo))
+}
+
+// RedeemPromo 兑换站内优惠码：临时升级等级或赠送 AI 积分（Paddle 折扣码只能在结账时使用）
+func (h *PromoHandler) RedeemPromo(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if models.NormalizePromoCode(req.Code) == "" {
+		utils.WriteValidationErrorResponse(w, "Promo code is required", "code must not be empty")
+		return
+	}
+
+	promo, err := lookupPromo(h.db, req.Code, user.ID, "")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var update *database.UserBillingUpdate
+	var current *models.UserWithSubscription
+	switch promo.Kind {
+	case models.PromoPaddleDiscount:
+		utils.WriteAppError(w, utils.ErrPromoInvalid.WithMessage("This promo code can only be used at checkout"))
+		return
+	case models.PromoTierUpgrade:
+		// 临时升级复用试用机制：到期后由 /api/cron/expire-trials 降回免费，因此只对免费用户开放
+		if promo.Tier == nil || promo.DurationDays <= 0 {
+			utils.WriteAppError(w, utils.ErrPromoInvalid.WithMessage("Promo code is misconfigured"))
+			return
+		}
+		current, err = h.db.GetUserWithSubscription(user.ID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if current.EffectiveTier() != models.TierFree || current.TrialActive {
+			utils.WriteAppError(w, utils.ErrConflict.WithMessage("Tier upgrade promo codes are only available on the free plan"))
+			return
+		}
+		tier := string(*promo.Tier)
+		endsAt := time.Now().UTC().AddDate(0, 0, promo.DurationDays)
+		active := true
+		update = &database.UserBillingUpdate{Tier: &tier, TrialEndsAt: &endsAt, TrialActive: &active}
+	case models.PromoAICredits:
+		if promo.Credits <= 0 {
+			utils.WriteAppError(w, utils.ErrPromoInvalid.WithMessage("Promo code is misconfigured"))
+			return
+		}
+	default:
+		utils.WriteAppError(w, utils.ErrPromoInvalid.WithMessage("Promo code is misconfigured"))
+		return
+	}
+
+	// 先占用兑换名额再发放，避免并发请求重复发放
+	if err := h.db.RedeemPromoCode(promo.ID, user.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if update != nil {
+		_, err = updateBilling(h.db, current, user.ID, *update, models.TierChangeSourcePromo, promo.Code)
+	} else {
+		err = h.db.GrantAICredits(user.ID, promo.Credits)
+	}
+	if err != nil {
+		fmt.Printf("❌ Promo %s redeemed by user %s but grant failed: %v\n", promo.Code, user.ID, err)
+		writeError(w, err)
+		return
+	}
+
+	fmt.Printf("🎟️ User %s redeemed promo %s (%s)\n", user.ID, promo.Code, promo.Kind)
+	resp := promoResponse(promo)
+	resp["redeemed"] = true
+	if update != nil {
+		resp["tier_ends_at"] = update.TrialEndsAt
+	}
+	utils.WriteSuccessResponse(w, resp)
+}
+
+// lookupPromo 查找优惠码并校验有效期、次数、用户是否已兑换；tier 非空时校验折扣是否适用于该计划
+func lookupPromo(db database.DatabaseInterface, code, userID string, tier models.UserTier) (*models.PromoCode, error) {
+	promo, err := db.GetPromoCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if reason := promo.UnusableReason(time.Now()); reason != "" {
+		return nil, utils.ErrPromoInvalid.WithMessage(reason)
+	}
+	if tier != "" && promo.Kind == models.PromoPaddleDiscount && promo.Tier != nil && *promo.Tier != tier {
+		return nil, utils.ErrPromoInvalid.WithMessage(fmt.Sprintf("Promo code does not apply to the %s plan", tier))
+	}
+	redeemed, err := db.HasRedeemedPromo(promo.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if redeemed {
+		return nil, utils.ErrPromoAlreadyRedeemed
+	}
+	return promo, nil
+}
+
+// promoResponse 返回给客户端的优惠码信息（不含计数等内部字段）
+func promoResponse(promo *models.PromoCode) map[string]interface{} {
+	return map[string]interface{}{
+		"valid":         true,
+		"code":          promo.Code,
+		"kind":          promo.Kind,
+		"tier":          promo.Tier,
+		"duration_days": promo.DurationDays,
+		"credits":       promo.Credits,
+		"expires_at":    promo.ExpiresAt,
+	}
+}
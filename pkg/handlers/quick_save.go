@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const (
+	// quickSaveInboxName 未指定集合时保存到默认空间中的同名集合，不存在时自动创建
+	quickSaveInboxName = "Inbox"
+	// enrichBatchSize 每次定时任务补全的条目数（逐个抓取页面，受函数执行时长限制）
+	enrichBatchSize = 20
+	// enrichStaleAfter 认领后超过该时间仍在队列中（任务中途退出）则重新认领
+	enrichStaleAfter = 10 * time.Minute
+	// maxEnrichAttempts 抓取失败的重试次数上限，之后放弃并标记为 failed
+	maxEnrichAttempts = 3
+)
+
+// 条目 metadata.enrichment 的取值：快速保存时为 pending，定时任务处理后为 done 或 failed
+const (
+	enrichmentPending = "pending"
+	enrichmentDone    = "done"
+	enrichmentFailed  = "failed"
+)
+
+// QuickSave POST /api/quick-save {"url","title","collection_id"}
+// 只需 URL（标题可选）：未指定 collection_id 时保存到默认组织默认空间的 Inbox 集合（不存在则创建）。
+// 立即返回 201；页面标题、favicon 与描述由 /api/cron/enrich-items 异步补全（metadata.enrichment 标记进度）
+func (h *CollectionsHandler) QuickSave(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	var req struct {
+		URL          string `json:"url"`
+		Title        string `json:"title"`
+		CollectionID string `json:"collection_id"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid body")
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	target, err := url.Parse(req.URL)
+	if err != nil || req.URL == "" || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		utils.WriteAppError(w, utils.ErrValidation.WithMessage("url must be an absolute http or https URL"))
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = req.URL
+	}
+
+	coll, ok := h.inboxOrCollection(w, user.ID, req.CollectionID)
+	if !ok {
+		return
+	}
+	orgID, err := h.db.GetCollectionOrganizationID(coll.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	warnings, ok := enforceDomainPolicies(w, h.db, orgID, user.ID, policySourceQuickSave, req.URL)
+	if !ok {
+		return
+	}
+
+	// 与 CreateItem 相同的幂等规则：同一集合中已保存的 URL 直接返回（已归档的恢复到活跃列表）
+	normalizedURL := strings.ToLower(req.URL)
+	if ex, err := h.db.FindItemByCollectionAndNormalizedURL(coll.ID, normalizedURL); err == nil && ex != nil {
+		if ex.ArchivedAt != nil {
+			if ex, err = h.db.UpdateCollectionItemPartial(ex.ID, map[string]interface{}{"archived_at": (*time.Time)(nil)}); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		utils.WriteSuccessResponse(w, withPolicyWarnings(map[string]interface{}{"item": ex, "collection": coll, "created": false}, warnings))
+		return
+	}
+
+	metaJSON, _ := json.Marshal(map[string]interface{}{
+		"normalized_url": normalizedURL,
+		"source":         "quick_save",
+		"enrichment":     enrichmentPending,
+	})
+	item := &models.CollectionItem{
+		CollectionID: coll.ID,
+		Title:        title,
+		URL:          req.URL,
+		Domain:       strings.ToLower(target.Hostname()),
+		Metadata:     metaJSON,
+	}
+	if err := h.db.CreateCollectionItem(item); err != nil {
+		writeError(w, err)
+		return
+	}
+	// 入队失败不影响保存：条目保留用户输入的标题，只是不会被补全
+	if err := h.db.EnqueueItemEnrichment(item.ID); err != nil {
+		fmt.Printf("⚠️ Failed to enqueue enrichment for item %s: %v\n", item.ID, err)
+	}
+	enqueueWebArchive(r, h.config, h.db, coll.ID, []models.CollectionItem{*item})
+	utils.WriteCreatedResponse(w, withPolicyWarnings(map[string]interface{}{"item": item, "collection": coll, "created": true}, warnings))
+}
+
+// inboxOrCollection 返回 collectionID 指定的集合（需编辑权限且不是智能集合），未指定时返回 Inbox（见 inboxCollection）
+func (h *CollectionsHandler) inboxOrCollection(w http.ResponseWriter, userID, collectionID string) (*models.Collection, bool) {
+	if collectionID == "" {
+		return h.inboxCollection(w, userID)
+	}
+	coll, err := h.db.GetCollection(userID, collectionID)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	if _, ok := h.requireSpaceEdit(w, userID, coll.SpaceID); !ok {
+		return nil, false
+	}
+	if coll.IsSmart() {
+		utils.WriteAppError(w, utils.ErrSmartCollection)
+		return nil, false
+	}
+	return coll, true
+}
+
+// inboxCollection 解析默认空间（见 defaultSpace）中名为 Inbox 的普通集合，不存在时创建
+func (h *CollectionsHandler) inboxCollection(w http.ResponseWriter, userID string) (*models.Collection, bool) {
+	space, ok := h.defaultSpace(w, userID)
+	if !ok {
+		return nil, false
+	}
+	colls, err := h.db.ListCollectionsBySpace(space.ID)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	for i := range colls {
+		if !colls[i].IsSmart() && strings.EqualFold(strings.TrimSpace(colls[i].Name), quickSaveInboxName) {
+			return &colls[i], true
+		}
+	}
+	inbox := &models.Collection{
+		SpaceID:     space.ID,
+		Name:        quickSaveInboxName,
+		Description: "Quick saves land here",
+		Icon:        "inbox",
+		Type:        models.CollectionTypeManual,
+	}
+	if err := h.db.CreateCollection(inbox); err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	return inbox, true
+}
+
+// defaultSpace 默认组织（见 models.DefaultOrganization）的默认空间（无 is_default 时取第一个）；要求对该空间有编辑权限
+func (h *CollectionsHandler) defaultSpace(w http.ResponseWriter, userID string) (*models.Space, bool) {
+	orgs, err := h.db.ListUserOrganizations(userID)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	org := models.DefaultOrganization(orgs, userID)
+	if org == nil {
+		utils.WriteAppError(w, utils.ErrOrgNotFound.WithMessage("No organization to save into; create an organization or pass an explicit target"))
+		return nil, false
+	}
+	spaces, err := h.db.ListSpacesByOrganization(org.ID)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	if len(spaces) == 0 {
+		utils.WriteAppError(w, utils.ErrSpaceNotFound.WithMessage("Default organization has no space; pass an explicit target"))
+		return nil, false
+	}
+	space := spaces[0]
+	for _, s := range spaces {
+		if s.IsDefault {
+			space = s
+			break
+		}
+	}
+	if _, ok := h.requireSpaceEdit(w, userID, space.ID); !ok {
+		return nil, false
+	}
+	return &space, true
+}
+
+// EnrichItems 定时任务：认领补全队列中的条目，抓取页面补全标题（仍为用户输入的 URL 时）、favicon 与描述。
+// 抓取失败的条目留在队列中待认领超时后重试，超过 maxEnrichAttempts 次标记为 failed 并移出队列
+func (h *CollectionsHandler) EnrichItems(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	now := time.Now().UTC()
+
+	claimed, err := h.db.ClaimItemEnrichments(enrichBatchSize, now.Add(-enrichStaleAfter))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	enriched, failed, skipped := 0, 0, 0
+	for _, e := range claimed {
+		item, err := h.db.GetCollectionItem(e.ItemID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			fmt.Printf("⚠️ Failed to load item %s for enrichment: %v\n", e.ItemID, err)
+			failed++
+			continue
+		}
+		if item == nil || item.DeletedAt != nil {
+			h.dequeueEnrichment(e.ItemID)
+			skipped++
+			continue
+		}
+
+		page, err := fetchPageMeta(r.Context(), item.URL)
+		if err != nil {
+			fmt.Printf("⚠️ Enrichment fetch for item %s failed (attempt %d): %v\n", item.ID, e.Attempts, err)
+			failed++
+			if e.Attempts < maxEnrichAttempts {
+				continue
+			}
+		}
+		if _, err := h.db.UpdateCollectionItemPartial(item.ID, enrichmentPatch(item, page)); err != nil {
+			fmt.Printf("⚠️ Failed to save enrichment for item %s: %v\n", item.ID, err)
+			continue
+		}
+		h.dequeueEnrichment(item.ID)
+		if page != nil {
+			enriched++
+		}
+	}
+
+	fmt.Printf("🔎 Item enrichment job: %d enriched, %d failed, %d skipped\n", enriched, failed, skipped)
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"claimed":  len(claimed),
+		"enriched": enriched,
+		"failed":   failed,
+		"skipped":  skipped,
+	})
+}
+
+func (h *CollectionsHandler) dequeueEnrichment(itemID string) {
+	if err := h.db.DeleteItemEnrichment(itemID); err != nil {
+		fmt.Printf("⚠️ Failed to dequeue enrichment for item %s: %v\n", itemID, err)
+	}
+}
+
+// enrichmentPatch 只填充空缺：标题仅在仍为空或为 URL 时替换（用户在补全前改过的标题保留），favicon 仅在为空时设置。
+// page 为 nil 表示放弃补全，只标记 metadata.enrichment = failed
+func enrichmentPatch(item *models.CollectionItem, page *pageMeta) map[string]interface{} {
+	meta := map[string]interface{}{}
+	_ = json.Unmarshal(item.Metadata, &meta)
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	patch := map[string]interface{}{}
+	if page == nil {
+		meta["enrichment"] = enrichmentFailed
+	} else {
+		meta["enrichment"] = enrichmentDone
+		if page.Title != "" {
+			if strings.TrimSpace(item.Title) == "" || item.Title == item.URL {
+				patch["title"] = page.Title
+			}
+			if item.OriginalTitle == "" {
+				patch["original_title"] = page.Title
+			}
+		}
+		if page.FavIconURL != "" && item.FavIconURL == "" {
+			patch["fav_icon_url"] = page.FavIconURL
+		}
+		if page.Description != "" {
+			if _, ok := meta["description"]; !ok {
+				meta["description"] = page.Description
+			}
+		}
+	}
+	metaJSON, _ := json.Marshal(meta)
+	patch["metadata"] = metaJSON
+	return patch
+}
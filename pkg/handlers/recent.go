@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const (
+	recentItemsDefaultLimit = 10
+	recentItemsMaxLimit     = 50
+)
+
+// GetRecentItems GET /api/orgs/{id}/recent[?limit=10]
+// 扩展首页弹窗：组织内当前用户可查看的所有空间中最近加入与最近删除的条目（各 limit 条，最多 50）。
+// 可见空间取自权限聚合（与 /api/me/permissions 相同），条目由单次聚合查询取出
+func (h *OrgsHandler) GetRecentItems(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chi.URLParam(r, "id")
+	limit := recentItemsDefaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			utils.WriteBadRequestResponse(w, "limit must be a positive integer")
+			return
+		}
+		if n > recentItemsMaxLimit {
+			n = recentItemsMaxLimit
+		}
+		limit = n
+	}
+
+	grants, err := h.db.ListPermissionGrants(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var role models.OrgMemberRole
+	for _, g := range grants {
+		if g.OrganizationID == orgID && g.Role != "" {
+			role = g.Role
+		}
+	}
+	spaceIDs := []string{}
+	for _, g := range grants {
+		if g.OrganizationID != orgID || g.Space == nil {
+			continue
+		}
+		spaceRole := role
+		if spaceRole == "" && g.Explicit != nil {
+			spaceRole = models.RoleGuest
+		}
+		if resolveSpaceAccess(spaceRole, g.Space, g.Explicit).CanView {
+			spaceIDs = append(spaceIDs, g.Space.ID)
+		}
+	}
+	if role == "" && len(spaceIDs) == 0 {
+		utils.WriteAppError(w, utils.ErrNotOrgMember)
+		return
+	}
+
+	added, deleted, err := h.db.ListRecentItems(spaceIDs, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"added":   added,
+		"deleted": deleted,
+	})
+}
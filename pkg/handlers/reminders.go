@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/notify"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// reminderBatchSize 每次定时任务触发的提醒数上限
+const reminderBatchSize = 100
+
+// 提醒列表的 status 取值
+const (
+	reminderStatusDue      = "due"
+	reminderStatusUpcoming = "upcoming"
+	reminderStatusAll      = "all"
+)
+
+// reminderItem 提醒列表中的条目：条目本身加上当前用户的提醒
+type reminderItem struct {
+	models.CollectionItem
+	Reminder models.ItemReminder `json:"reminder"`
+}
+
+// SetItemReminder PUT /api/collection-items/{item_id}/reminder {"remind_at","email"}
+// 设置（覆盖）当前用户在条目上的提醒；可查看条目即可设置。到期后由 /api/cron/send-reminders 发送站内通知，email=true 时同时发邮件
+func (h *CollectionsHandler) SetItemReminder(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	var req struct {
+		RemindAt *time.Time `json:"remind_at"`
+		Email    bool       `json:"email"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid body")
+		return
+	}
+	if req.RemindAt == nil {
+		utils.WriteBadRequestResponse(w, "remind_at required")
+		return
+	}
+	if !req.RemindAt.After(time.Now()) {
+		utils.WriteBadRequestResponse(w, "remind_at must be in the future")
+		return
+	}
+	item, ok := h.requireItemView(w, user.ID, chi.URLParam(r, "item_id"))
+	if !ok {
+		return
+	}
+	rem := &models.ItemReminder{ItemID: item.ID, UserID: user.ID, RemindAt: req.RemindAt.UTC(), Email: req.Email}
+	if err := h.db.SetItemReminder(rem); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"reminder": rem})
+}
+
+// ClearItemReminder DELETE /api/collection-items/{item_id}/reminder
+// 清除当前用户的提醒（已触发的提醒在跟进后也以此移出到期列表）
+func (h *CollectionsHandler) ClearItemReminder(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	itemID := chi.URLParam(r, "item_id")
+	if err := h.db.DeleteItemReminder(user.ID, itemID); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"deleted": true, "item_id": itemID})
+}
+
+// ListReminders GET /api/reminders?status=due（默认，remind_at 已到）|upcoming|all
+// 返回带提醒的条目（按 remind_at 升序）；已删除或已无权查看的条目不返回
+func (h *CollectionsHandler) ListReminders(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reminderStatusDue
+	}
+	if status != reminderStatusDue && status != reminderStatusUpcoming && status != reminderStatusAll {
+		utils.WriteBadRequestResponse(w, "status must be due, upcoming or all")
+		return
+	}
+	reminders, err := h.db.ListItemReminders(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	now := time.Now()
+	visible := map[string]bool{} // collection -> 当前用户可查看
+	items := []reminderItem{}
+	for _, rem := range reminders {
+		due := !rem.RemindAt.After(now)
+		if (status == reminderStatusDue && !due) || (status == reminderStatusUpcoming && due) {
+			continue
+		}
+		item, err := h.db.GetCollectionItem(rem.ItemID)
+		if errors.Is(err, database.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if item.DeletedAt != nil {
+			continue
+		}
+		ok, seen := visible[item.CollectionID]
+		if !seen {
+			if ok, err = itemVisibleTo(h.db, user.ID, item); err != nil {
+				writeError(w, err)
+				return
+			}
+			visible[item.CollectionID] = ok
+		}
+		if ok {
+			items = append(items, reminderItem{CollectionItem: *item, Reminder: rem})
+		}
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"status": status, "items": items})
+}
+
+// requireItemView 加载未删除的条目并要求当前用户可查看其所在空间
+func (h *CollectionsHandler) requireItemView(w http.ResponseWriter, userID, itemID string) (*models.CollectionItem, bool) {
+	item, err := h.db.GetCollectionItem(itemID)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	if item.DeletedAt != nil {
+		utils.WriteAppError(w, utils.ErrItemNotFound)
+		return nil, false
+	}
+	ok, err := itemVisibleTo(h.db, userID, item)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	if !ok {
+		// 与 requireItemEdit 一致：看不到的条目报告为不存在
+		utils.WriteAppError(w, utils.ErrItemNotFound)
+		return nil, false
+	}
+	return item, true
+}
+
+// itemVisibleTo 用户是否可查看条目所在空间（组织成员，受限空间需显式权限；空间访客同样适用）
+func itemVisibleTo(db database.DatabaseInterface, userID string, item *models.CollectionItem) (bool, error) {
+	coll, err := db.GetCollection(userID, item.CollectionID)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	space, err := db.GetSpaceByID(userID, coll.SpaceID)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	access, err := userSpaceAccess(db, userID, space)
+	if err != nil {
+		return false, err
+	}
+	return access.CanView, nil
+}
+
+// SendDueReminders 定时任务：认领到期的提醒，发送站内通知（email=true 时同时发邮件）。
+// 认领即标记为已触发，单条发送失败不重试；条目已删除或用户已无权查看时删除提醒
+func (h *NotificationsHandler) SendDueReminders(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	now := time.Now().UTC()
+	claimed, err := h.db.ClaimDueItemReminders(now, reminderBatchSize)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	sent, emailed, dropped := 0, 0, 0
+	for _, rem := range claimed {
+		item, err := h.db.GetCollectionItem(rem.ItemID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			fmt.Printf("⚠️ Failed to load item %s for reminder: %v\n", rem.ItemID, err)
+			continue
+		}
+		visible := false
+		if item != nil && item.DeletedAt == nil {
+			if visible, err = itemVisibleTo(h.db, rem.UserID, item); err != nil {
+				fmt.Printf("⚠️ Failed to check access to item %s for reminder: %v\n", rem.ItemID, err)
+				continue
+			}
+		}
+		if !visible {
+			if err := h.db.DeleteItemReminder(rem.UserID, rem.ItemID); err != nil && !errors.Is(err, database.ErrNotFound) {
+				fmt.Printf("⚠️ Failed to drop reminder on item %s: %v\n", rem.ItemID, err)
+			}
+			dropped++
+			continue
+		}
+
+		notifyUser(r, notify.Notification{
+			UserID: rem.UserID,
+			Kind:   notify.KindItemReminder,
+			Title:  "Reminder: " + item.Title,
+			Body:   item.URL,
+			Data: map[string]interface{}{
+				"item_id":       item.ID,
+				"collection_id": item.CollectionID,
+				"url":           item.URL,
+				"remind_at":     rem.RemindAt,
+			},
+			DedupeKey: fmt.Sprintf("item_reminder:%s:%d", item.ID, rem.RemindAt.Unix()),
+		})
+		sent++
+		if rem.Email {
+			if err := h.sendReminderEmail(r, rem.UserID, item); err != nil {
+				fmt.Printf("❌ Failed to send reminder email for item %s: %v\n", item.ID, err)
+			} else {
+				emailed++
+			}
+		}
+	}
+
+	fmt.Printf("⏰ Reminder job: %d sent, %d emailed, %d dropped\n", sent, emailed, dropped)
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"sent":    sent,
+		"emailed": emailed,
+		"dropped": dropped,
+	})
+}
+
+func (h *NotificationsHandler) sendReminderEmail(r *http.Request, userID string, item *models.CollectionItem) error {
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return errors.New("user has no email address")
+	}
+	return h.mailer.Send(r.Context(), notify.Email{
+		To:      user.Email,
+		Subject: "Reminder: " + item.Title,
+		Text:    fmt.Sprintf("You asked to be reminded about this tab:\n\n%s\n%s\n", item.Title, item.URL),
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/notify"
+)
+
+// 可疑活动告警类型；failed_attempts 与 token_reuse 可配置在 ANOMALY_REAUTH 中要求重新登录
+// （新国家登录只通知：吊销会话会连同刚完成的这次登录一起失效，对冒用者没有意义）
+const (
+	alertNewCountry     = "new_country"     // 从未登录过的国家登录
+	alertFailedAttempts = "failed_attempts" // 多次刷新/兑换失败导致邮箱被锁定
+	alertTokenReuse     = "token_reuse"     // 一次性会话码被重复使用
+)
+
+// newCountryHistory 判断“新国家”时参考的最近登录记录数
+const newCountryHistory = 50
+
+// securityAlert 一次可疑活动
+type securityAlert struct {
+	Kind    string
+	UserID  string
+	Email   string
+	Title   string
+	Body    string
+	Data    map[string]interface{}
+	Dedupe  string // 同一用户同一 key 只告警一次
+	NoEmail bool   // 已有专门的邮件（如解锁邮件）时不再重复发送
+}
+
+// securityAlerts 投递站内告警与邮件，并按 ANOMALY_REAUTH 吊销会话；任何失败只记录日志，不影响触发它的请求
+type securityAlerts struct {
+	mailer notify.Mailer
+	reauth map[string]bool
+}
+
+func newSecurityAlerts(cfg *config.Config, mailer notify.Mailer) *securityAlerts {
+	a := &securityAlerts{mailer: mailer, reauth: map[string]bool{}}
+	for _, kind := range cfg.AnomalyReauth {
+		a.reauth[kind] = true
+	}
+	return a
+}
+
+// raise 投递告警；该类型配置为需要重新登录时吊销用户的全部会话
+func (a *securityAlerts) raise(r *http.Request, db database.DatabaseInterface, alert securityAlert) {
+	revoked := false
+	if a.reauth[alert.Kind] {
+		if err := db.RevokeUserSessions(alert.UserID); err != nil {
+			fmt.Printf("⚠️  Failed to revoke sessions of user %s: %v\n", alert.UserID, err)
+		} else {
+			revoked = true
+		}
+	}
+	fmt.Printf("🚨 Security alert user=%s kind=%s ip=%s revoked=%t\n", alert.UserID, alert.Kind, middleware.ClientIP(r), revoked)
+
+	body := alert.Body
+	if revoked {
+		body += " We signed you out on all devices; sign in again to continue."
+	} else {
+		body += " If this wasn't you, review your recent sign-ins and sign out of devices you don't recognise."
+	}
+	data := map[string]interface{}{"alert": alert.Kind, "sessions_revoked": revoked}
+	for k, v := range alert.Data {
+		data[k] = v
+	}
+	notifyUser(r, notify.Notification{
+		UserID:    alert.UserID,
+		Email:     alert.Email,
+		Kind:      notify.KindSecurityAlert,
+		Title:     alert.Title,
+		Body:      body,
+		Data:      data,
+		DedupeKey: alert.Dedupe,
+	})
+	if alert.NoEmail || alert.Email == "" {
+		return
+	}
+	if err := a.mailer.Send(r.Context(), notify.Email{
+		To:      alert.Email,
+		Subject: "Tab Sync security alert: " + alert.Title,
+		Text:    body + "\n",
+	}); err != nil {
+		fmt.Printf("❌ Failed to send security alert email: %v\n", err)
+	}
+}
+
+// checkNewCountry 在写入本次登录记录前调用：用户已有带位置的登录记录、且都不在该国家时告警。
+// 没有历史（首次登录或未配置 GeoIP）时不告警
+func (a *securityAlerts) checkNewCountry(r *http.Request, db database.DatabaseInterface, userID, email, country, ip string) {
+	if country == "" {
+		return
+	}
+	previous, err := db.ListLoginEvents(userID, newCountryHistory)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to load login history of user %s: %v\n", userID, err)
+		return
+	}
+	located := false
+	for _, e := range previous {
+		if e.Country == country {
+			return
+		}
+		located = located || e.Country != ""
+	}
+	if !located {
+		return
+	}
+	a.raise(r, db, securityAlert{
+		Kind:   alertNewCountry,
+		UserID: userID,
+		Email:  email,
+		Title:  "New sign-in from " + country,
+		Body:   fmt.Sprintf("Your account was signed in from a new country (%s, IP %s).", country, ip),
+		Data:   map[string]interface{}{"country": country, "ip": ip},
+		Dedupe: "security:new_country:" + country,
+	})
+}
+
+// failedAttempts 邮箱因多次失败被锁定时告警（解锁邮件已单独发送，这里只发站内通知）
+func (a *securityAlerts) failedAttempts(r *http.Request, db database.DatabaseInterface, userID, email string, lock time.Duration) {
+	a.raise(r, db, securityAlert{
+		Kind:    alertFailedAttempts,
+		UserID:  userID,
+		Email:   email,
+		Title:   "Repeated failed sign-in attempts",
+		Body:    fmt.Sprintf("Sign-in was blocked for %s after several failed attempts (IP %s).", lock, middleware.ClientIP(r)),
+		Data:    map[string]interface{}{"ip": middleware.ClientIP(r)},
+		Dedupe:  "security:failed_attempts:" + time.Now().UTC().Format("2006-01-02"),
+		NoEmail: true,
+	})
+}
+
+// tokenReuse 一次性凭证被重复使用：凭证可能已泄露
+func (a *securityAlerts) tokenReuse(r *http.Request, db database.DatabaseInterface, userID, email, tokenID string) {
+	a.raise(r, db, securityAlert{
+		Kind:   alertTokenReuse,
+		UserID: userID,
+		Email:  email,
+		Title:  "A sign-in link was used twice",
+		Body:   fmt.Sprintf("A one-time sign-in code for your account was used again (IP %s); it may have been intercepted.", middleware.ClientIP(r)),
+		Data:   map[string]interface{}{"ip": middleware.ClientIP(r)},
+		Dedupe: "security:token_reuse:" + tokenID,
+	})
+}
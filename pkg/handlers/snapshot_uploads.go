@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+const (
+	// snapshotUploadChunkBytes 单个分块上限：低于 API 默认请求体上限，multipart 封装后仍能通过
+	snapshotUploadChunkBytes = 512 << 10
+	// snapshotUploadTTL 未完成的上传保留时间，过期后需重新 init（过期上传在新建上传时顺带清理）
+	snapshotUploadTTL = 24 * time.Hour
+)
+
+// CreateSnapshotUpload POST /api/snapshot-uploads {"name","kind","total_bytes"}（?org_id= 为组织共享快照）
+// 开始分块上传：组装后的内容与 POST /api/snapshots 的请求体相同（只取其中的 tabGroups，名称与类型以此处为准）
+func (h *SnapshotHandler) CreateSnapshotUpload(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	var req struct {
+		Name       string `json:"name"`
+		Kind       string `json:"kind"`
+		TotalBytes int64  `json:"total_bytes"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if req.Name == "" {
+		utils.WriteBadRequestResponse(w, "Snapshot name is required")
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = models.SnapshotKindManual
+	}
+	if !models.ValidSnapshotKind(req.Kind) {
+		utils.WriteBadRequestResponse(w, "kind must be manual or auto")
+		return
+	}
+	if req.TotalBytes <= 0 {
+		utils.WriteBadRequestResponse(w, "total_bytes must be a positive number of bytes")
+		return
+	}
+	if req.TotalBytes > h.config.MaxSnapshotUploadBytes {
+		utils.WriteAppError(w, utils.ErrPayloadTooLarge.WithDetails(
+			fmt.Sprintf("total_bytes: %d/%d", req.TotalBytes, h.config.MaxSnapshotUploadBytes)))
+		return
+	}
+	orgID, _, ok := h.snapshotScope(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if orgID != "" && req.Kind != models.SnapshotKindManual {
+		utils.WriteBadRequestResponse(w, "Auto snapshots are per-user")
+		return
+	}
+
+	now := time.Now().UTC()
+	if _, err := h.db.PurgeExpiredSnapshotUploads(now); err != nil {
+		fmt.Printf("[warn] purge expired snapshot uploads failed: %v\n", err)
+	}
+	upload := &models.SnapshotUpload{
+		UserID:         user.ID,
+		OrganizationID: orgID,
+		Name:           req.Name,
+		Kind:           req.Kind,
+		TotalBytes:     req.TotalBytes,
+		ExpiresAt:      now.Add(snapshotUploadTTL),
+	}
+	if err := h.db.CreateSnapshotUpload(upload); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteCreatedResponse(w, map[string]interface{}{
+		"upload":          upload,
+		"max_chunk_bytes": snapshotUploadChunkBytes,
+	})
+}
+
+// GetSnapshotUpload GET /api/snapshot-uploads/{id}
+// 返回已收到的分块序号，客户端据此只补传缺失的分块（断点续传）
+func (h *SnapshotHandler) GetSnapshotUpload(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	upload, err := h.db.GetSnapshotUpload(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"upload":          upload,
+		"max_chunk_bytes": snapshotUploadChunkBytes,
+	})
+}
+
+// PutSnapshotUploadChunk PUT /api/snapshot-uploads/{id}/chunks/{index}
+// 请求体为分块原始字节；也接受 multipart/form-data（取名为 chunk 的部分）。序号从 0 开始，重传同一序号覆盖原分块
+func (h *SnapshotHandler) PutSnapshotUploadChunk(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if err != nil || index < 0 {
+		utils.WriteBadRequestResponse(w, "Chunk index must be a non-negative integer")
+		return
+	}
+	upload, err := h.db.GetSnapshotUpload(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if int64(index)*snapshotUploadChunkBytes >= upload.TotalBytes {
+		utils.WriteBadRequestResponse(w, "Chunk index is beyond the declared total_bytes")
+		return
+	}
+
+	data, err := readUploadChunk(r)
+	if err != nil {
+		writeBodyError(w, err, "Invalid chunk")
+		return
+	}
+	if len(data) == 0 {
+		utils.WriteBadRequestResponse(w, "Chunk is empty")
+		return
+	}
+	if len(data) > snapshotUploadChunkBytes {
+		utils.WriteAppError(w, utils.ErrPayloadTooLarge.WithDetails(fmt.Sprintf("chunk: %d/%d", len(data), snapshotUploadChunkBytes)))
+		return
+	}
+	if !containsInt(upload.ReceivedChunks, index) && upload.ReceivedBytes+int64(len(data)) > upload.TotalBytes {
+		utils.WriteAppError(w, utils.ErrPayloadTooLarge.WithDetails(
+			fmt.Sprintf("total_bytes: %d/%d", upload.ReceivedBytes+int64(len(data)), upload.TotalBytes)))
+		return
+	}
+	if err := h.db.PutSnapshotUploadChunk(upload.ID, index, data); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"index": index, "size": len(data)})
+}
+
+// CommitSnapshotUpload POST /api/snapshot-uploads/{id}/commit
+// 按序号组装分块，校验大小与快照结构后保存（与 POST /api/snapshots 相同的响应），成功后删除上传
+func (h *SnapshotHandler) CommitSnapshotUpload(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	upload, err := h.db.GetSnapshotUpload(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if missing := missingChunks(upload); len(missing) > 0 {
+		utils.WriteAppError(w, utils.ErrUploadIncomplete.WithDetails("missing chunks: "+joinInts(missing)))
+		return
+	}
+	if upload.ReceivedBytes != upload.TotalBytes {
+		utils.WriteAppError(w, utils.ErrUploadIncomplete.WithDetails(
+			fmt.Sprintf("received %d of %d bytes", upload.ReceivedBytes, upload.TotalBytes)))
+		return
+	}
+	if upload.OrganizationID != "" {
+		// 上传期间可能已被移出组织
+		if _, member := orgMemberRole(h.db, user.ID, upload.OrganizationID); !member {
+			utils.WriteAppError(w, utils.ErrNotOrgMember)
+			return
+		}
+	}
+
+	chunks, err := h.db.LoadSnapshotUploadChunks(upload.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var body struct {
+		TabGroups []models.TabGroup `json:"tabGroups"`
+	}
+	if err := json.Unmarshal(bytes.Join(chunks, nil), &body); err != nil {
+		utils.WriteValidationErrorResponse(w, "Assembled upload is not a valid snapshot body", err.Error())
+		return
+	}
+	if len(body.TabGroups) == 0 {
+		utils.WriteBadRequestResponse(w, "Tab groups are required")
+		return
+	}
+	if err := h.checkSnapshotLimits(body.TabGroups); err != nil {
+		utils.WriteAppError(w, err)
+		return
+	}
+
+	h.saveSnapshot(w, user.ID, upload.OrganizationID, upload.Name, upload.Kind, body.TabGroups)
+	// 保存失败时保留上传，客户端可直接重试 commit；成功后删除失败只留待过期清理
+	if err := h.db.DeleteSnapshotUpload(upload.ID); err != nil {
+		fmt.Printf("[warn] delete snapshot upload %s failed: %v\n", upload.ID, err)
+	}
+}
+
+// AbortSnapshotUpload DELETE /api/snapshot-uploads/{id}
+func (h *SnapshotHandler) AbortSnapshotUpload(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	upload, err := h.db.GetSnapshotUpload(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.db.DeleteSnapshotUpload(upload.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"deleted": true, "id": upload.ID})
+}
+
+// readUploadChunk 读取分块内容：multipart/form-data 取 chunk 部分，否则为整个请求体
+func readUploadChunk(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(r.Body)
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New(`multipart body has no "chunk" part`)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "chunk" {
+			return io.ReadAll(part)
+		}
+	}
+}
+
+// missingChunks 返回 0..n-1 中尚未收到的序号（n 由 total_bytes 与分块上限推出的最少分块数，与已收到的最大序号取大）
+func missingChunks(u *models.SnapshotUpload) []int {
+	n := int((u.TotalBytes + snapshotUploadChunkBytes - 1) / snapshotUploadChunkBytes)
+	if k := len(u.ReceivedChunks); k > 0 && u.ReceivedChunks[k-1]+1 > n {
+		n = u.ReceivedChunks[k-1] + 1
+	}
+	var missing []int
+	for i := 0; i < n; i++ {
+		if !containsInt(u.ReceivedChunks, i) {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ", ")
+}
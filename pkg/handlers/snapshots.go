@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"tab-sync-backend-refactor/pkg/config"
@@ -18,15 +23,106 @@ type SnapshotHandler struct {
 }
 
 // NewSnapshotHandler 创建快照处理器
-func NewSnapshotHandler(cfg *config.Config, db database.DatabaseInterface) *SnapshotHandler {
+func NewSnapshotHandler(cfg *config.Config) *SnapshotHandler {
 	return &SnapshotHandler{
 		config: cfg,
-		db:     db,
 	}
 }
 
-// ListSnapshots 列出用户的所有快照
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *SnapshotHandler) withRequest(r *http.Request) *SnapshotHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// snapshotScope 解析快照作用域：?scope=org&org_id=...（或只带 org_id）为组织共享快照，返回组织 ID 与当前用户在组织中的角色；
+// 个人快照（默认，或 scope=user）返回空的 orgID。非组织成员返回 NOT_ORG_MEMBER
+func (h *SnapshotHandler) snapshotScope(w http.ResponseWriter, r *http.Request, userID string) (orgID string, role models.OrgMemberRole, ok bool) {
+	q := r.URL.Query()
+	scope, orgID := q.Get("scope"), strings.TrimSpace(q.Get("org_id"))
+	switch scope {
+	case "user":
+		return "", "", true
+	case "org":
+		if orgID == "" {
+			utils.WriteBadRequestResponse(w, "org_id is required for scope=org")
+			return "", "", false
+		}
+	case "":
+		if orgID == "" {
+			return "", "", true
+		}
+	default:
+		utils.WriteBadRequestResponse(w, "scope must be user or org")
+		return "", "", false
+	}
+	role, member := orgMemberRole(h.db, userID, orgID)
+	if !member {
+		utils.WriteAppError(w, utils.ErrNotOrgMember)
+		return "", "", false
+	}
+	return orgID, role, true
+}
+
+// snapshotRetention 各类型快照自动保留的数量；0 表示不自动清理
+func (h *SnapshotHandler) snapshotRetention(kind string) int {
+	if kind == models.SnapshotKindAuto {
+		return h.config.AutoSnapshotKeep
+	}
+	return 0
+}
+
+// maxLimitViolations 错误详情中最多逐条列出的超限标签组数
+const maxLimitViolations = 10
+
+// checkSnapshotLimits 检查标签组数、单组标签数与 URL 长度；超限时返回带计数详情的 SNAPSHOT_LIMIT_EXCEEDED
+func (h *SnapshotHandler) checkSnapshotLimits(groups []models.TabGroup) error {
+	var exceeded []string
+	if len(groups) > h.config.MaxSnapshotGroups {
+		exceeded = append(exceeded, fmt.Sprintf("groups: %d/%d", len(groups), h.config.MaxSnapshotGroups))
+	}
+	listed, longURLs := 0, 0
+	for gi, g := range groups {
+		if len(g.Tabs) > h.config.MaxSnapshotGroupTabs && listed < maxLimitViolations {
+			exceeded = append(exceeded, fmt.Sprintf("group %d (%s) tabs: %d/%d", gi, g.ID, len(g.Tabs), h.config.MaxSnapshotGroupTabs))
+			listed++
+		}
+		for _, t := range g.Tabs {
+			if len(t.URL) > h.config.MaxSnapshotURLLength {
+				longURLs++
+			}
+		}
+	}
+	if longURLs > 0 {
+		exceeded = append(exceeded, fmt.Sprintf("urls over %d chars: %d", h.config.MaxSnapshotURLLength, longURLs))
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return utils.ErrSnapshotTooLarge.WithDetails(strings.Join(exceeded, "; "))
+}
+
+// GetSnapshotLimits 返回快照上限，扩展上传前据此提示用户拆分或裁剪
+func (h *SnapshotHandler) GetSnapshotLimits(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.RequireUser(r.Context()); err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"max_bytes":          h.config.MaxSnapshotBytes,
+		"max_groups":         h.config.MaxSnapshotGroups,
+		"max_tabs_per_group": h.config.MaxSnapshotGroupTabs,
+		"max_url_length":     h.config.MaxSnapshotURLLength,
+		"upload_max_bytes":   h.config.MaxSnapshotUploadBytes,
+		"upload_chunk_bytes": snapshotUploadChunkBytes,
+	})
+}
+
+// ListSnapshots 列出用户的快照；默认只列手动快照，?kind=auto 列自动快照，?kind=all 列全部；
+// ?scope=org&org_id= 列出组织共享快照。不带分页参数时返回全部快照
 func (h *SnapshotHandler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 从认证中间件获取用户信息
 	user, err := middleware.RequireUser(r.Context())
 	if err != nil {
@@ -34,21 +130,46 @@ func (h *SnapshotHandler) ListSnapshots(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	orgID, _, ok := h.snapshotScope(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if orgID != "" {
+		snapshots, err := h.db.ListOrgSnapshots(orgID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		page, meta := utils.PageOf(snapshots, utils.ParsePaginationOrAll(r))
+		utils.WriteListResponse(w, page, meta)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	switch {
+	case kind == "":
+		kind = models.SnapshotKindManual
+	case kind == "all":
+		kind = ""
+	case !models.ValidSnapshotKind(kind):
+		utils.WriteBadRequestResponse(w, "kind must be manual, auto or all")
+		return
+	}
+
 	// 获取快照列表
-	snapshots, err := h.db.ListSnapshots(user.ID)
+	snapshots, err := h.db.ListSnapshots(user.ID, kind)
 	if err != nil {
-		utils.WriteInternalServerErrorResponse(w, "Failed to list snapshots: "+err.Error())
+		writeError(w, err)
 		return
 	}
 
-	utils.WriteSuccessResponse(w, map[string]interface{}{
-		"snapshots": snapshots,
-		"count":     len(snapshots),
-	})
+	page, meta := utils.PageOf(snapshots, utils.ParsePaginationOrAll(r))
+	utils.WriteListResponse(w, page, meta)
 }
 
 // CreateSnapshot 创建新快照
 func (h *SnapshotHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 从认证中间件获取用户信息
 	user, err := middleware.RequireUser(r.Context())
 	if err != nil {
@@ -58,12 +179,13 @@ func (h *SnapshotHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request)
 
 	// 解析请求体
 	var req struct {
-		Name      string              `json:"name"`
-		TabGroups []models.TabGroup   `json:"tabGroups"`
+		Name      string            `json:"name"`
+		Kind      string            `json:"kind"` // manual（默认）或 auto
+		TabGroups []models.TabGroup `json:"tabGroups"`
 	}
 
 	if err := utils.ParseJSONBody(r, &req); err != nil {
-		utils.WriteBadRequestResponse(w, "Invalid request body")
+		writeBodyError(w, err, "Invalid request body")
 		return
 	}
 
@@ -78,21 +200,71 @@ func (h *SnapshotHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := h.checkSnapshotLimits(req.TabGroups); err != nil {
+		utils.WriteAppError(w, err)
+		return
+	}
+
+	if req.Kind == "" {
+		req.Kind = models.SnapshotKindManual
+	}
+	if !models.ValidSnapshotKind(req.Kind) {
+		utils.WriteBadRequestResponse(w, "kind must be manual or auto")
+		return
+	}
+
+	orgID, _, ok := h.snapshotScope(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if orgID != "" && req.Kind != models.SnapshotKindManual {
+		// 组织共享快照只有手动类型
+		utils.WriteBadRequestResponse(w, "Auto snapshots are per-user")
+		return
+	}
+	h.saveSnapshot(w, user.ID, orgID, req.Name, req.Kind, req.TabGroups)
+}
+
+// saveSnapshot 保存已校验的快照并写出 201 响应（CreateSnapshot 与分块上传的 commit 共用）；
+// orgID 非空时保存为组织共享快照，个人快照按保留规则清理同类旧快照
+func (h *SnapshotHandler) saveSnapshot(w http.ResponseWriter, userID, orgID, name, kind string, groups []models.TabGroup) {
+	if orgID != "" {
+		if err := h.db.SaveOrgSnapshot(orgID, userID, name, groups); err != nil {
+			writeError(w, err)
+			return
+		}
+		utils.WriteCreatedResponse(w, map[string]interface{}{
+			"message":         "Snapshot created successfully",
+			"name":            name,
+			"kind":            kind,
+			"organization_id": orgID,
+		})
+		return
+	}
+
 	// 保存快照
-	err = h.db.SaveSnapshot(user.ID, req.Name, req.TabGroups)
-	if err != nil {
-		utils.WriteInternalServerErrorResponse(w, "Failed to save snapshot: "+err.Error())
+	if err := h.db.SaveSnapshot(userID, name, kind, groups); err != nil {
+		writeError(w, err)
 		return
 	}
 
+	// 按保留规则清理同类旧快照；失败只记录日志，下次保存时会再次清理
+	if keep := h.snapshotRetention(kind); keep > 0 {
+		if _, err := h.db.PruneSnapshots(userID, kind, keep); err != nil {
+			fmt.Printf("[warn] prune %s snapshots failed for user=%s: %v\n", kind, userID, err)
+		}
+	}
+
 	utils.WriteCreatedResponse(w, map[string]interface{}{
 		"message": "Snapshot created successfully",
-		"name":    req.Name,
+		"name":    name,
+		"kind":    kind,
 	})
 }
 
 // GetSnapshot 获取指定快照
 func (h *SnapshotHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 从认证中间件获取用户信息
 	user, err := middleware.RequireUser(r.Context())
 	if err != nil {
@@ -107,18 +279,74 @@ func (h *SnapshotHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 加载快照
-	snapshot, err := h.db.LoadSnapshot(user.ID, name)
+	// 加载快照（tab_groups 不反序列化，原样写入响应；压缩由全局 Compress 中间件按 Accept-Encoding 处理）
+	orgID, _, ok := h.snapshotScope(w, r, user.ID)
+	if !ok {
+		return
+	}
+	var snapshot *database.RawSnapshot
+	if orgID != "" {
+		snapshot, err = h.db.LoadOrgSnapshotRaw(orgID, name)
+	} else {
+		snapshot, err = h.db.LoadSnapshotRaw(user.ID, name)
+	}
 	if err != nil {
-		utils.WriteNotFoundResponse(w, "Snapshot not found: "+err.Error())
+		writeError(w, err)
+		return
+	}
+
+	// 弱 ETag：snapshot:<updatedAt>:<size>，快照内容变化必然刷新 updated_at
+	etag := fmt.Sprintf("W/\"snapshot:%d:%d\"", snapshot.UpdatedAt.UnixMilli(), len(snapshot.TabGroups))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	utils.WriteSuccessResponse(w, snapshot)
+	if err := writeRawSnapshot(w, snapshot); err != nil {
+		fmt.Printf("[error] GetSnapshot write failed for user=%s name=%s: %v\n", user.ID, name, err)
+	}
+}
+
+// writeRawSnapshot 按 LoadSnapshotResponse 的结构写出 {"success":true,"data":{...}}，
+// 其中 tabGroups 直接使用数据库中的 JSON 原文，避免多 MB 快照先解码再编码
+func writeRawSnapshot(w http.ResponseWriter, snapshot *database.RawSnapshot) error {
+	head, err := json.Marshal(struct {
+		Name      string `json:"name"`
+		CreatedAt string `json:"createdAt"`
+		UpdatedAt string `json:"updatedAt"`
+	}{
+		Name:      snapshot.Name,
+		CreatedAt: snapshot.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: snapshot.UpdatedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	tabGroups := []byte(snapshot.TabGroups)
+	if len(bytes.TrimSpace(tabGroups)) == 0 || bytes.Equal(tabGroups, []byte("null")) {
+		tabGroups = []byte("[]")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	for _, part := range [][]byte{
+		[]byte(`{"success":true,"data":`),
+		head[:len(head)-1], // 去掉结尾的 }，追加 tabGroups
+		[]byte(`,"tabGroups":`),
+		tabGroups,
+		[]byte("}}\n"),
+	} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // UpdateSnapshot 更新快照
 func (h *SnapshotHandler) UpdateSnapshot(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 从认证中间件获取用户信息
 	user, err := middleware.RequireUser(r.Context())
 	if err != nil {
@@ -139,7 +367,7 @@ func (h *SnapshotHandler) UpdateSnapshot(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := utils.ParseJSONBody(r, &req); err != nil {
-		utils.WriteBadRequestResponse(w, "Invalid request body")
+		writeBodyError(w, err, "Invalid request body")
 		return
 	}
 
@@ -147,11 +375,23 @@ func (h *SnapshotHandler) UpdateSnapshot(w http.ResponseWriter, r *http.Request)
 		utils.WriteBadRequestResponse(w, "Tab groups are required")
 		return
 	}
+	if err := h.checkSnapshotLimits(req.TabGroups); err != nil {
+		utils.WriteAppError(w, err)
+		return
+	}
 
 	// 更新快照（实际上是保存，因为SaveSnapshot支持UPSERT）
-	err = h.db.SaveSnapshot(user.ID, name, req.TabGroups)
+	orgID, _, ok := h.snapshotScope(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if orgID != "" {
+		err = h.db.SaveOrgSnapshot(orgID, user.ID, name, req.TabGroups)
+	} else {
+		err = h.db.SaveSnapshot(user.ID, name, "", req.TabGroups)
+	}
 	if err != nil {
-		utils.WriteInternalServerErrorResponse(w, "Failed to update snapshot: "+err.Error())
+		writeError(w, err)
 		return
 	}
 
@@ -163,6 +403,7 @@ func (h *SnapshotHandler) UpdateSnapshot(w http.ResponseWriter, r *http.Request)
 
 // DeleteSnapshot 删除快照
 func (h *SnapshotHandler) DeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	// 从认证中间件获取用户信息
 	user, err := middleware.RequireUser(r.Context())
 	if err != nil {
@@ -177,10 +418,23 @@ func (h *SnapshotHandler) DeleteSnapshot(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	orgID, role, ok := h.snapshotScope(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if orgID != "" && role != models.RoleOwner && role != models.RoleAdmin {
+		utils.WriteForbiddenResponse(w, "Only owner/admin can delete shared snapshots")
+		return
+	}
+
 	// 删除快照
-	err = h.db.DeleteSnapshot(user.ID, name)
+	if orgID != "" {
+		err = h.db.DeleteOrgSnapshot(orgID, name)
+	} else {
+		err = h.db.DeleteSnapshot(user.ID, name)
+	}
 	if err != nil {
-		utils.WriteNotFoundResponse(w, "Failed to delete snapshot: "+err.Error())
+		writeError(w, err)
 		return
 	}
 
@@ -189,3 +443,219 @@ func (h *SnapshotHandler) DeleteSnapshot(w http.ResponseWriter, r *http.Request)
 		"name":    name,
 	})
 }
+
+// PruneSnapshots 批量清理快照：{"kind": "auto", "keep": 10}，保留最近更新的 keep 个；
+// kind 默认为 auto，keep 省略时使用该类型的保留规则（手动快照必须显式指定 keep）
+func (h *SnapshotHandler) PruneSnapshots(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Kind string `json:"kind"`
+		Keep *int   `json:"keep"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = models.SnapshotKindAuto
+	}
+	if !models.ValidSnapshotKind(req.Kind) {
+		utils.WriteBadRequestResponse(w, "kind must be manual or auto")
+		return
+	}
+	keep := h.snapshotRetention(req.Kind)
+	if req.Keep != nil {
+		keep = *req.Keep
+	} else if keep == 0 {
+		utils.WriteBadRequestResponse(w, "keep is required for manual snapshots")
+		return
+	}
+	if keep < 0 {
+		utils.WriteBadRequestResponse(w, "keep must not be negative")
+		return
+	}
+
+	deleted, err := h.db.PruneSnapshots(user.ID, req.Kind, keep)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"kind":    req.Kind,
+		"kept":    keep,
+		"deleted": deleted,
+	})
+}
+
+// 单次转换的标签数上限（与集合条目批量导入一致）
+const maxMaterializeTabs = 200
+
+// MaterializeSnapshot 把快照中的一个标签组转换为指定空间下的新集合：
+// {"space_id": "...", "group_id": "...", "name": "可选，默认为标签组名"}；快照只有一个标签组时可省略 group_id。
+// 与其他快照接口一样，?org_id= 指定组织共享快照
+func (h *SnapshotHandler) MaterializeSnapshot(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		SpaceID string `json:"space_id"`
+		GroupID string `json:"group_id"`
+		Name    string `json:"name"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.SpaceID) == "" {
+		utils.WriteBadRequestResponse(w, "space_id is required")
+		return
+	}
+
+	orgID, _, ok := h.snapshotScope(w, r, user.ID)
+	if !ok {
+		return
+	}
+	var snapshot *database.LoadSnapshotResponse
+	if orgID != "" {
+		snapshot, err = h.loadOrgSnapshot(orgID, chi.URLParam(r, "name"))
+	} else {
+		snapshot, err = h.db.LoadSnapshot(user.ID, chi.URLParam(r, "name"))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var group *models.TabGroup
+	for i := range snapshot.TabGroups {
+		if snapshot.TabGroups[i].ID == req.GroupID {
+			group = &snapshot.TabGroups[i]
+			break
+		}
+	}
+	if group == nil && req.GroupID == "" && len(snapshot.TabGroups) == 1 {
+		group = &snapshot.TabGroups[0]
+	}
+	if group == nil {
+		utils.WriteAppError(w, utils.ErrNotFound.WithMessage("Tab group not found in snapshot"))
+		return
+	}
+	if len(group.Tabs) > maxMaterializeTabs {
+		utils.WriteBadRequestResponse(w, fmt.Sprintf("too many tabs in group (max %d)", maxMaterializeTabs))
+		return
+	}
+
+	space, err := h.db.GetSpaceByID(user.ID, req.SpaceID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	access, err := userSpaceAccess(h.db, user.ID, space)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !access.CanEdit {
+		utils.WriteAppError(w, utils.ErrForbidden.WithMessage("No edit permission for this space"))
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = group.Name
+	}
+	if name == "" {
+		name = snapshot.Name
+	}
+	coll := &models.Collection{SpaceID: space.ID, Name: name}
+	if group.Description != nil {
+		coll.Description = *group.Description
+	}
+	if group.Color != nil {
+		coll.Color = *group.Color
+	}
+	if err := h.db.CreateCollection(coll); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// 同一标签组内按规范化 URL 去重，与集合条目的幂等规则一致
+	seen := make(map[string]bool, len(group.Tabs))
+	items := make([]models.CollectionItem, 0, len(group.Tabs))
+	for _, tab := range group.Tabs {
+		normalizedURL := strings.ToLower(strings.TrimSpace(tab.URL))
+		if normalizedURL == "" || seen[normalizedURL] {
+			continue
+		}
+		seen[normalizedURL] = true
+
+		meta := map[string]interface{}{}
+		for k, v := range tab.Metadata {
+			meta[k] = v
+		}
+		meta["normalized_url"] = normalizedURL
+		meta["source_snapshot"] = snapshot.Name
+		if len(tab.Tags) > 0 {
+			meta["tags"] = tab.Tags
+		}
+		metaJSON, err := json.Marshal(meta)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		item := &models.CollectionItem{
+			CollectionID:  coll.ID,
+			Title:         tab.Title,
+			URL:           tab.URL,
+			OriginalTitle: tab.OriginalTitle,
+			Domain:        tab.Domain,
+			Metadata:      metaJSON,
+			Position:      len(items),
+		}
+		if tab.FavIconURL != nil {
+			item.FavIconURL = *tab.FavIconURL
+		}
+		if err := h.db.CreateCollectionItem(item); err != nil {
+			writeError(w, err)
+			return
+		}
+		items = append(items, *item)
+	}
+	// 计数由触发器维护；响应中的集合按已写入的条目同步，免得客户端再取一次
+	coll.ItemCount = len(items)
+	if n := len(items); n > 0 && !items[n-1].CreatedAt.IsZero() {
+		coll.LastItemAddedAt = &items[n-1].CreatedAt
+	}
+
+	utils.WriteCreatedResponse(w, map[string]interface{}{
+		"collection": coll,
+		"items":      items,
+	})
+}
+
+// loadOrgSnapshot 加载并解析组织共享快照
+func (h *SnapshotHandler) loadOrgSnapshot(orgID, name string) (*database.LoadSnapshotResponse, error) {
+	raw, err := h.db.LoadOrgSnapshotRaw(orgID, name)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &database.LoadSnapshotResponse{
+		Name:      raw.Name,
+		CreatedAt: raw.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: raw.UpdatedAt.Format(time.RFC3339),
+	}
+	if err := json.Unmarshal(raw.TabGroups, &snapshot.TabGroups); err != nil {
+		return nil, fmt.Errorf("failed to parse tab groups: %w", err)
+	}
+	return snapshot, nil
+}
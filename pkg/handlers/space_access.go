@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// spaceAccess 成员对空间的有效权限
+type spaceAccess struct {
+	Role    models.OrgMemberRole
+	CanView bool
+	CanEdit bool
+	Source  string // models.PermissionSource*
+}
+
+// resolveSpaceAccess 私有空间仅对有显式设置的成员可见（owner/admin 也不例外）；其余依次判断：
+// owner/admin → 空间 default_access 为 edit → 显式设置 → default_access（view 只读，restricted 无权限）。
+// explicit 为 nil 表示该成员没有显式设置；role 为空表示既不是组织成员也不是访客
+func resolveSpaceAccess(role models.OrgMemberRole, space *models.Space, explicit *bool) spaceAccess {
+	a := spaceAccess{Role: role}
+	switch {
+	case role == "":
+		return a
+	case role == models.RoleGuest:
+		// 访客只看显式设置，不受 default_access 影响
+		a.CanView, a.CanEdit, a.Source = explicit != nil, explicit != nil && *explicit, models.PermissionSourceExplicit
+	case space.Visibility == models.SpaceVisibilityPrivate && explicit == nil:
+		a.Source = models.PermissionSourceDefault
+	case role == models.RoleOwner || role == models.RoleAdmin:
+		a.CanView, a.CanEdit, a.Source = true, true, models.PermissionSourceRole
+	case space.DefaultAccess == models.SpaceAccessEdit:
+		a.CanView, a.CanEdit, a.Source = true, true, models.PermissionSourceDefault
+	case explicit != nil:
+		a.CanView, a.CanEdit, a.Source = true, *explicit, models.PermissionSourceExplicit
+	case space.DefaultAccess == models.SpaceAccessRestricted:
+		a.Source = models.PermissionSourceDefault
+	default:
+		a.CanView, a.Source = true, models.PermissionSourceDefault
+	}
+	return a
+}
+
+// userSpaceAccess 查询 userID 在空间所属组织的角色与显式设置，返回有效权限（访客的 Role 为 RoleGuest）
+func userSpaceAccess(db database.DatabaseInterface, userID string, space *models.Space) (spaceAccess, error) {
+	members, err := db.ListOrganizationMembers(space.OrganizationID)
+	if err != nil {
+		return spaceAccess{}, err
+	}
+	var role models.OrgMemberRole
+	for _, m := range members {
+		if m.UserID == userID {
+			role = m.Role
+			break
+		}
+	}
+	perms, err := db.GetSpacePermissions(space.ID)
+	if err != nil {
+		return spaceAccess{}, err
+	}
+	var explicit *bool
+	for _, p := range perms {
+		if p.UserID == userID {
+			canEdit := p.CanEdit
+			explicit = &canEdit
+			break
+		}
+	}
+	// 非组织成员：只有 space_guests 中的访客才能访问，残留的显式权限（如成员已离开组织）不算
+	if role == "" && explicit != nil {
+		guests, err := db.ListSpaceGuests(space.ID)
+		if err != nil {
+			return spaceAccess{}, err
+		}
+		for _, g := range guests {
+			if g.UserID == userID {
+				role = models.RoleGuest
+				break
+			}
+		}
+	}
+	return resolveSpaceAccess(role, space, explicit), nil
+}
+
+// visibleSpaces 过滤掉 userID 无权查看的私有空间（组织空间对所有成员可见，受 default_access 限制的仍会列出）
+func visibleSpaces(db database.DatabaseInterface, userID string, spaces []models.Space) ([]models.Space, error) {
+	visible := make([]models.Space, 0, len(spaces))
+	for _, s := range spaces {
+		if s.Visibility != models.SpaceVisibilityPrivate {
+			visible = append(visible, s)
+			continue
+		}
+		perms, err := db.GetSpacePermissions(s.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range perms {
+			if p.UserID == userID {
+				visible = append(visible, s)
+				break
+			}
+		}
+	}
+	return visible, nil
+}
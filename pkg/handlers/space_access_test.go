@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"testing"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// fakeSpaceAccessDB 只实现 userSpaceAccess 用到的成员、显式权限与访客查询
+type fakeSpaceAccessDB struct {
+	database.DatabaseInterface
+	members []models.OrganizationMembership
+	perms   []models.SpacePermission
+	guests  []models.SpaceGuest
+}
+
+func (db *fakeSpaceAccessDB) ListOrganizationMembers(orgID string) ([]models.OrganizationMembership, error) {
+	return db.members, nil
+}
+
+func (db *fakeSpaceAccessDB) GetSpacePermissions(spaceID string) ([]models.SpacePermission, error) {
+	return db.perms, nil
+}
+
+func (db *fakeSpaceAccessDB) ListSpaceGuests(spaceID string) ([]models.SpaceGuest, error) {
+	return db.guests, nil
+}
+
+func TestUserSpaceAccessGuests(t *testing.T) {
+	space := &models.Space{ID: "s1", OrganizationID: "o1", DefaultAccess: models.SpaceAccessView, Visibility: models.SpaceVisibilityOrg}
+	tests := []struct {
+		name     string
+		db       *fakeSpaceAccessDB
+		wantRole models.OrgMemberRole
+		wantView bool
+		wantEdit bool
+	}{
+		{
+			name: "accepted guest",
+			db: &fakeSpaceAccessDB{
+				perms:  []models.SpacePermission{{SpaceID: "s1", UserID: "u1", CanEdit: true}},
+				guests: []models.SpaceGuest{{UserID: "u1", CanEdit: true}},
+			},
+			wantRole: models.RoleGuest, wantView: true, wantEdit: true,
+		},
+		{
+			name: "leftover permission after leaving the organization",
+			db: &fakeSpaceAccessDB{
+				perms: []models.SpacePermission{{SpaceID: "s1", UserID: "u1", CanEdit: true}},
+			},
+		},
+		{
+			name: "guest of another user does not grant access",
+			db: &fakeSpaceAccessDB{
+				perms:  []models.SpacePermission{{SpaceID: "s1", UserID: "u1"}},
+				guests: []models.SpaceGuest{{UserID: "u2"}},
+			},
+		},
+		{
+			name: "member keeps member access",
+			db: &fakeSpaceAccessDB{
+				members: []models.OrganizationMembership{{OrganizationID: "o1", UserID: "u1", Role: models.RoleMember}},
+			},
+			wantRole: models.RoleMember, wantView: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := userSpaceAccess(tt.db, "u1", space)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Role != tt.wantRole || a.CanView != tt.wantView || a.CanEdit != tt.wantEdit {
+				t.Errorf("access = %+v, want role %q view %v edit %v", a, tt.wantRole, tt.wantView, tt.wantEdit)
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/notify"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// SubscriptionHandler 订阅自助操作（试用等）与相关定时任务
+type SubscriptionHandler struct {
+	config *config.Config
+	db     database.DatabaseInterface
+}
+
+// NewSubscriptionHandler 创建订阅处理器
+func NewSubscriptionHandler(cfg *config.Config) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		config: cfg,
+	}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *SubscriptionHandler) withRequest(r *http.Request) *SubscriptionHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// GetStatus 返回当前用户的订阅状态；banner 非空时客户端应展示付款提醒
+func (h *SubscriptionHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	current, err := h.db.GetUserWithSubscription(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	dunning := map[string]interface{}{
+		"status":     current.DunningStatus,
+		"started_at": current.DunningStartedAt,
+	}
+	var banner map[string]interface{}
+	switch current.DunningStatus {
+	case models.DunningGrace:
+		var graceEndsAt *time.Time
+		if current.DunningStartedAt != nil {
+			t := current.DunningStartedAt.AddDate(0, 0, h.config.DunningGraceDays)
+			graceEndsAt = &t
+		}
+		dunning["grace_ends_at"] = graceEndsAt
+		banner = map[string]interface{}{
+			"type":          "payment_failed",
+			"message":       "Your last payment failed. Update your payment method to keep your plan.",
+			"grace_ends_at": graceEndsAt,
+		}
+	case models.DunningLapsed:
+		banner = map[string]interface{}{
+			"type":    "payment_lapsed",
+			"message": "Your plan was downgraded because payment could not be collected.",
+		}
+	}
+
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"tier":                 string(current.EffectiveTier()),
+		"is_lifetime_member":   current.IsLifetimeMember,
+		"lifetime_member_type": current.LifetimeMemberType,
+		"trial_active":         current.TrialActive,
+		"trial_ends_at":        current.TrialEndsAt,
+		"dunning":              dunning,
+		"banner":               banner,
+	})
+}
+
+// CreateCheckout 为免费用户创建 Pro/Power 订阅的 Paddle 结账交易；promo_code 为 Paddle 折扣码时透传给 Paddle
+func (h *SubscriptionHandler) CreateCheckout(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Tier      string `json:"tier"`
+		PromoCode string `json:"promo_code"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	target := models.UserTier(req.Tier)
+	if target != models.TierPro && target != models.TierPower {
+		utils.WriteValidationErrorResponse(w, "Invalid tier", "tier must be one of: pro, power")
+		return
+	}
+	priceID := h.priceIDForTier(target)
+	if priceID == "" {
+		utils.WriteAppError(w, utils.ErrNotImplemented.WithMessage("Checkout is not configured"))
+		return
+	}
+
+	subscription, err := h.db.GetUserSubscription(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		writeError(w, err)
+		return
+	}
+	if subscription != nil && subscription.Status == models.StatusActive {
+		utils.WriteAppError(w, utils.ErrConflict.WithMessage("Already subscribed; use PUT /api/subscription/plan to change plans"))
+		return
+	}
+
+	var discountID string
+	if code := models.NormalizePromoCode(req.PromoCode); code != "" {
+		promo, err := lookupPromo(h.db, code, user.ID, target)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if promo.Kind != models.PromoPaddleDiscount || promo.PaddleDiscountID == nil {
+			utils.WriteAppError(w, utils.ErrPromoInvalid.WithMessage("Promo code cannot be used at checkout; redeem it instead"))
+			return
+		}
+		discountID = *promo.PaddleDiscountID
+	}
+
+	current, err := h.db.GetUserWithSubscription(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var customerID string
+	if current.PaddleCustomerID != nil {
+		customerID = *current.PaddleCustomerID
+	}
+
+	checkout, err := paddleCreateCheckout(r.Context(), h.config, priceID, customerID, discountID, map[string]interface{}{
+		"user_id": user.ID,
+		"plan_id": string(target),
+	})
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeError(w, err)
+			return
+		}
+		utils.WriteAppError(w, utils.ErrServiceUnavailable.Wrap(err).WithMessage("Billing provider unavailable, please retry later"))
+		return
+	}
+
+	fmt.Printf("🛒 Created checkout %s for user %s (tier %s, discount %q)\n", checkout.TransactionID, user.ID, target, discountID)
+	utils.WriteCreatedResponse(w, checkout)
+}
+
+// ChangePlan 在 Pro 与 Power 之间切换付费计划：通过 Paddle API 按比例结算，
+// 等级与 user_subscriptions 在 subscription.updated webhook 确认后更新，因此返回 202。
+// 降级前检查当前用量，超出目标等级配额时拒绝。
+func (h *SubscriptionHandler) ChangePlan(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Tier string `json:"tier"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+	target := models.UserTier(req.Tier)
+	if target != models.TierPro && target != models.TierPower {
+		utils.WriteValidationErrorResponse(w, "Invalid tier", "tier must be one of: pro, power")
+		return
+	}
+	priceID := h.priceIDForTier(target)
+	if priceID == "" {
+		utils.WriteAppError(w, utils.ErrNotImplemented.WithMessage("Plan changes are not configured"))
+		return
+	}
+
+	current, err := h.db.GetUserWithSubscription(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	subscription, err := h.db.GetUserSubscription(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		writeError(w, err)
+		return
+	}
+	if subscription == nil || subscription.PaddleSubscriptionID == nil || subscription.Status != models.StatusActive {
+		utils.WriteAppError(w, utils.ErrConflict.WithMessage("No active subscription to change"))
+		return
+	}
+	if current.Tier == target {
+		utils.WriteAppError(w, utils.ErrConflict.WithMessage("Already on the requested plan"))
+		return
+	}
+	if target.Rank() < current.Tier.Rank() {
+		quotaErr, err := h.checkDowngradeQuota(user.ID, target)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if quotaErr != nil {
+			utils.WriteAppError(w, quotaErr)
+			return
+		}
+	}
+
+	if err := paddleChangeSubscriptionPrice(r.Context(), h.config, *subscription.PaddleSubscriptionID, priceID); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeError(w, err)
+			return
+		}
+		utils.WriteAppError(w, utils.ErrServiceUnavailable.Wrap(err).WithMessage("Billing provider rejected the plan change, please retry later"))
+		return
+	}
+
+	fmt.Printf("🔀 Requested plan change for user %s: %s -> %s (subscription %s)\n",
+		user.ID, current.Tier, target, *subscription.PaddleSubscriptionID)
+	utils.WriteJSONResponse(w, http.StatusAccepted, map[string]interface{}{
+		"status":         "pending",
+		"current_tier":   string(current.Tier),
+		"requested_tier": string(target),
+	})
+}
+
+// priceIDForTier 返回订阅等级对应的 Paddle 价格 ID
+func (h *SubscriptionHandler) priceIDForTier(tier models.UserTier) string {
+	switch tier {
+	case models.TierPro:
+		return h.config.PaddleProPriceID
+	case models.TierPower:
+		return h.config.PaddlePowerPriceID
+	}
+	return ""
+}
+
+// checkDowngradeQuota 当前用量超出目标等级配额时返回 QUOTA_EXCEEDED（Details 列出超出项）
+func (h *SubscriptionHandler) checkDowngradeQuota(userID string, target models.UserTier) (*utils.AppError, error) {
+	limits := target.Limits()
+	var exceeded []string
+
+	// 自动快照由保留规则限量，不计入配额
+	if limits.MaxSnapshots > 0 {
+		snapshots, err := h.db.ListSnapshots(userID, models.SnapshotKindManual)
+		if err != nil {
+			return nil, err
+		}
+		if len(snapshots) > limits.MaxSnapshots {
+			exceeded = append(exceeded, fmt.Sprintf("snapshots: %d/%d", len(snapshots), limits.MaxSnapshots))
+		}
+	}
+	if limits.MaxOrganizations > 0 {
+		orgs, err := h.db.ListUserOrganizations(userID)
+		if err != nil {
+			return nil, err
+		}
+		owned := 0
+		for _, org := range orgs {
+			if org.OwnerID == userID {
+				owned++
+			}
+		}
+		if owned > limits.MaxOrganizations {
+			exceeded = append(exceeded, fmt.Sprintf("organizations: %d/%d", owned, limits.MaxOrganizations))
+		}
+	}
+
+	if len(exceeded) == 0 {
+		return nil, nil
+	}
+	return utils.ErrQuotaExceeded.
+		WithMessage(fmt.Sprintf("Current usage exceeds the %s plan limits", target)).
+		WithDetails(strings.Join(exceeded, "; ")), nil
+}
+
+// StartTrial 为免费用户开启 Pro 试用；每个用户只能试用一次
+func (h *SubscriptionHandler) StartTrial(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+
+	current, err := h.db.GetUserWithSubscription(user.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if current.TrialEndsAt != nil {
+		utils.WriteAppError(w, utils.ErrConflict.WithMessage("Trial has already been used"))
+		return
+	}
+	if current.EffectiveTier() != models.TierFree {
+		utils.WriteAppError(w, utils.ErrConflict.WithMessage("Trial is only available on the free plan"))
+		return
+	}
+
+	tier := string(models.TierPro)
+	endsAt := time.Now().UTC().AddDate(0, 0, h.config.TrialDays)
+	active := true
+	if _, err := updateBilling(h.db, current, user.ID, database.UserBillingUpdate{
+		Tier:        &tier,
+		TrialEndsAt: &endsAt,
+		TrialActive: &active,
+	}, models.TierChangeSourceTrialStarted, ""); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	notifyUser(r, notify.Notification{
+		UserID: current.ID,
+		Email:  current.Email,
+		Kind:   notify.KindTrialStarted,
+		Title:  "Your Pro trial has started",
+		Body:   fmt.Sprintf("Enjoy Pro features until %s.", endsAt.Format("2006-01-02")),
+		Data:   map[string]interface{}{"trial_ends_at": endsAt},
+	})
+
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"tier":          tier,
+		"trial_active":  true,
+		"trial_ends_at": endsAt,
+	})
+}
+
+// trialExpiringNotice 试用到期前多久发送即将到期提醒
+const trialExpiringNotice = 3 * 24 * time.Hour
+
+// ExpireTrials 定时任务：把已到期的试用降回免费（终身会员保留终身等级）并通知用户；
+// 即将到期的试用发送一次提醒（按到期时间去重）。单个用户失败不中断整批，下次运行会重试。
+func (h *SubscriptionHandler) ExpireTrials(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	now := time.Now().UTC()
+	users, err := h.db.ListExpiredTrials(now.Add(trialExpiringNotice))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	expired, reminded, failed := 0, 0, 0
+	for _, u := range users {
+		if u.TrialEndsAt != nil && u.TrialEndsAt.After(now) {
+			reminded++
+			notifyUser(r, notify.Notification{
+				UserID:    u.ID,
+				Email:     u.Email,
+				Kind:      notify.KindTrialExpiring,
+				Title:     "Your Pro trial ends soon",
+				Body:      fmt.Sprintf("Your trial ends on %s. Upgrade to keep Pro features.", u.TrialEndsAt.Format("2006-01-02")),
+				Data:      map[string]interface{}{"trial_ends_at": u.TrialEndsAt},
+				DedupeKey: fmt.Sprintf("trial_expiring:%d", u.TrialEndsAt.Unix()),
+			})
+			continue
+		}
+
+		tier := downgradedTier(u)
+		inactive := false
+		if _, err := updateBilling(h.db, &u, u.ID, database.UserBillingUpdate{
+			Tier:        &tier,
+			TrialActive: &inactive,
+		}, models.TierChangeSourceTrialExpired, ""); err != nil {
+			fmt.Printf("❌ Failed to expire trial for user %s: %v\n", u.ID, err)
+			failed++
+			continue
+		}
+		expired++
+		notifyUser(r, notify.Notification{
+			UserID: u.ID,
+			Email:  u.Email,
+			Kind:   notify.KindTrialExpired,
+			Title:  "Your Pro trial has ended",
+			Body:   "Your account is back on the free plan. Upgrade any time to keep Pro features.",
+		})
+	}
+
+	fmt.Printf("⏰ Trial expiry job: %d expired, %d reminded, %d failed\n", expired, reminded, failed)
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"expired":  expired,
+		"reminded": reminded,
+		"failed":   failed,
+	})
+}
+
+// ExpireDunning 定时任务：催缴宽限期（DUNNING_GRACE_DAYS）已过仍未恢复付款的用户降回免费并标记为 lapsed。
+// 付款恢复后由 webhook 的订阅事件恢复等级并清除催缴状态。
+func (h *SubscriptionHandler) ExpireDunning(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	cutoff := time.Now().UTC().AddDate(0, 0, -h.config.DunningGraceDays)
+	users, err := h.db.ListExpiredDunning(cutoff)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	lapsed, failed := 0, 0
+	for _, u := range users {
+		tier := downgradedTier(u)
+		status := string(models.DunningLapsed)
+		if _, err := updateBilling(h.db, &u, u.ID, database.UserBillingUpdate{
+			Tier:          &tier,
+			DunningStatus: &status,
+		}, models.TierChangeSourceDunningLapsed, ""); err != nil {
+			fmt.Printf("❌ Failed to lapse dunning user %s: %v\n", u.ID, err)
+			failed++
+			continue
+		}
+		lapsed++
+		notifyUser(r, notify.Notification{
+			UserID: u.ID,
+			Email:  u.Email,
+			Kind:   notify.KindPaymentLapsed,
+			Title:  "Your plan has been downgraded",
+			Body:   "We couldn't collect your payment, so your account is now on the free plan. Update your payment method to restore it.",
+		})
+	}
+
+	fmt.Printf("⏰ Dunning expiry job: %d lapsed, %d failed\n", lapsed, failed)
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"lapsed": lapsed,
+		"failed": failed,
+	})
+}
+
+// downgradedTier 回收付费等级后用户应处的等级：免费，终身会员保留终身等级
+func downgradedTier(u models.UserWithSubscription) string {
+	tier := models.TierFree
+	if u.IsLifetimeMember && u.LifetimeMemberType != nil {
+		tier = models.MaxTier(tier, models.UserTier(*u.LifetimeMemberType))
+	}
+	return string(tier)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// OAuth 回调等 HTML 页面使用 html/template 渲染，URL 参数等用户输入按所在上下文（HTML/JS）自动转义
+//
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var pageTemplates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// renderPage 渲染 templates/ 下的页面；先渲染到缓冲区，失败时返回 500 而不是输出半个页面
+func renderPage(w http.ResponseWriter, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := pageTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		fmt.Printf("❌ Failed to render %s: %v\n", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// renderString 将模板渲染为字符串（邮件正文等）
+func renderString(name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := pageTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
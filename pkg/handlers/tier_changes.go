@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	chiRoute "github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/notify"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 等级变化历史列表的默认与最大条数
+const (
+	defaultTierChangeLimit = 50
+	maxTierChangeLimit     = 500
+)
+
+// updateBilling 应用计费更新；update 改变了等级时追加一条 tier_changes 记录并返回该记录（否则返回 nil）。
+// current 为更新前的用户（调用方通常已加载，用于取旧等级与邮箱），为 nil 时旧等级记为空。
+// 历史写入失败只记录日志：等级本身已生效，不应让 webhook 因此重试
+func updateBilling(db database.DatabaseInterface, current *models.UserWithSubscription, userID string, update database.UserBillingUpdate, source, referenceID string) (*models.TierChange, error) {
+	if err := db.UpdateUserBilling(userID, update); err != nil {
+		return nil, err
+	}
+	if update.Tier == nil {
+		return nil, nil
+	}
+	oldTier := ""
+	if current != nil {
+		oldTier = string(current.Tier)
+	}
+	if oldTier == *update.Tier {
+		return nil, nil
+	}
+	change := &models.TierChange{UserID: userID, OldTier: oldTier, NewTier: *update.Tier, Source: source, ReferenceID: referenceID}
+	if err := db.RecordTierChange(change); err != nil {
+		fmt.Printf("⚠️ Failed to record tier change for user %s (%s -> %s): %v\n", userID, oldTier, *update.Tier, err)
+	}
+	return change, nil
+}
+
+// notifyTierChange 通知用户计划已变化；用于 webhook 等用户未主动操作的变化（试用、催缴等有各自的通知）
+func notifyTierChange(ctx context.Context, email string, change *models.TierChange) {
+	if change == nil {
+		return
+	}
+	n := notify.Notification{
+		UserID: change.UserID,
+		Email:  email,
+		Kind:   notify.KindPlanChanged,
+		Title:  fmt.Sprintf("Your plan changed to %s", change.NewTier),
+		Body:   "Your subscription changed. Open your account page for details.",
+		Data:   map[string]interface{}{"old_tier": change.OldTier, "new_tier": change.NewTier},
+	}
+	if change.ID != "" {
+		n.DedupeKey = "tier_change:" + change.ID
+	}
+	if err := notifier.Notify(ctx, n); err != nil {
+		fmt.Printf("⚠️ Failed to notify user %s (%s): %v\n", n.UserID, n.Kind, err)
+	}
+}
+
+// AdminHandler 运维管理 API（ADMIN_API_KEY 鉴权，见 middleware.AdminAuth）
+type AdminHandler struct {
+	config *config.Config
+	db     database.DatabaseInterface
+}
+
+// NewAdminHandler 创建管理 API 处理器
+func NewAdminHandler(cfg *config.Config) *AdminHandler {
+	return &AdminHandler{config: cfg}
+}
+
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *AdminHandler) withRequest(r *http.Request) *AdminHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	return &c
+}
+
+// ListTierChanges GET /api/admin/users/{id}/tier-changes?limit=50
+// 用户的等级变化历史（新到旧），排查"等级为何变化"类工单
+func (h *AdminHandler) ListTierChanges(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	limit := defaultTierChangeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			utils.WriteBadRequestResponse(w, "limit must be a positive integer")
+			return
+		}
+		if n > maxTierChangeLimit {
+			n = maxTierChangeLimit
+		}
+		limit = n
+	}
+	userID := chiRoute.URLParam(r, "id")
+	if _, err := h.db.GetUserByID(userID); err != nil {
+		writeError(w, err)
+		return
+	}
+	changes, err := h.db.ListTierChanges(userID, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"changes": changes})
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	chiRoute "github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/cache"
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/middleware"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+	"tab-sync-backend-refactor/pkg/webarchive"
+)
+
+const (
+	// webArchiveBatchSize 每次定时任务处理的任务数（提交与轮询合计），同时是对 Internet Archive 的全局限速
+	webArchiveBatchSize = 10
+	// webArchiveStaleAfter 认领后超过该时间仍未释放（任务中途退出）则重新认领
+	webArchiveStaleAfter = 10 * time.Minute
+	// webArchivePollInterval 提交后轮询存档结果的间隔
+	webArchivePollInterval = time.Minute
+	// webArchiveBackoff 失败重试间隔（乘以已失败次数）；被限流时整批推迟同样时长
+	webArchiveBackoff = 15 * time.Minute
+	// maxWebArchiveAttempts 提交或存档失败的次数上限，之后放弃并标记为 failed
+	maxWebArchiveAttempts = 3
+	// webArchiveMaxPending 提交后超过该时间仍未完成视为失败
+	webArchiveMaxPending = 24 * time.Hour
+)
+
+// 条目 metadata.web_archive_status 的取值；成功时另有 web_archive_url 与 web_archived_at
+const (
+	webArchiveArchived = "archived"
+	webArchiveFailed   = "failed"
+)
+
+// GetWebArchive GET /api/orgs/{id}/web-archive
+// 返回组织是否开启网页存档；available 为服务端是否配置了存档密钥
+func (h *OrgsHandler) GetWebArchive(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chiRoute.URLParam(r, "id")
+	if _, ok := h.requireOrgMember(w, user.ID, orgID); !ok {
+		return
+	}
+	enabled, err := h.db.GetWebArchiveEnabled(orgID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"enabled":     enabled,
+		"available":   webarchive.Configured(h.config),
+		"daily_limit": h.config.WebArchiveDailyLimit,
+	})
+}
+
+// UpdateWebArchive PUT /api/orgs/{id}/web-archive {"enabled"}（owner/admin）
+// 开启后新保存的 http(s) 条目提交到 Internet Archive（URL 会发送给第三方，因此需要组织显式开启）；关闭时丢弃未完成的任务
+func (h *OrgsHandler) UpdateWebArchive(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	user, err := middleware.RequireUser(r.Context())
+	if err != nil {
+		utils.WriteUnauthorizedResponse(w, "Authentication required")
+		return
+	}
+	orgID := chiRoute.URLParam(r, "id")
+	role, ok := h.requireOrgMember(w, user.ID, orgID)
+	if !ok {
+		return
+	}
+	if role != models.RoleOwner && role != models.RoleAdmin {
+		utils.WriteForbiddenResponse(w, "Only owner/admin can change web archiving")
+		return
+	}
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := utils.ParseJSONBody(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid body")
+		return
+	}
+	if req.Enabled == nil {
+		utils.WriteValidationErrorResponse(w, "Nothing to update", "provide enabled")
+		return
+	}
+	if *req.Enabled && !webarchive.Configured(h.config) {
+		utils.WriteAppError(w, utils.ErrNotImplemented.WithMessage("Web archiving is not configured on this server"))
+		return
+	}
+	if err := h.db.SetWebArchiveEnabled(orgID, user.ID, *req.Enabled); err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{"enabled": *req.Enabled})
+}
+
+// enqueueWebArchive 组织开启了网页存档时将新保存的 http(s) 条目加入存档队列。
+// 每个组织每日至多 WEB_ARCHIVE_DAILY_LIMIT 个（共享缓存计数），超出的条目不存档；失败只记日志，不影响保存
+func enqueueWebArchive(r *http.Request, cfg *config.Config, db database.DatabaseInterface, collectionID string, items []models.CollectionItem) {
+	if len(items) == 0 || !webarchive.Configured(cfg) {
+		return
+	}
+	orgID, err := db.GetCollectionOrganizationID(collectionID)
+	if err == nil {
+		var enabled bool
+		if enabled, err = db.GetWebArchiveEnabled(orgID); err == nil && !enabled {
+			return
+		}
+	}
+	if err != nil {
+		fmt.Printf("⚠️ Failed to check web archive setting for collection %s: %v\n", collectionID, err)
+		return
+	}
+
+	store := cache.Shared(cfg)
+	key := "webarchive:" + orgID + ":" + time.Now().UTC().Format("20060102")
+	for _, it := range items {
+		if u, err := url.Parse(it.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		n, err := store.Incr(r.Context(), key, 48*time.Hour)
+		if err != nil {
+			fmt.Printf("⚠️ Web archive counter failed for org %s: %v\n", orgID, err)
+			return
+		}
+		if n > int64(cfg.WebArchiveDailyLimit) {
+			fmt.Printf("⚠️ Web archive daily limit reached for org %s\n", orgID)
+			return
+		}
+		if err := db.EnqueueWebArchiveJob(it.ID, orgID); err != nil {
+			fmt.Printf("⚠️ Failed to enqueue web archive for item %s: %v\n", it.ID, err)
+		}
+	}
+}
+
+// ArchiveItems 定时任务：提交存档队列中的条目并轮询已提交任务的结果，成功后写入 metadata.web_archive_url。
+// 被 Internet Archive 限流时本轮剩余任务整体推迟；组织已关闭存档或条目已删除的任务直接丢弃
+func (h *CollectionsHandler) ArchiveItems(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
+	if !webarchive.Configured(h.config) {
+		utils.WriteSuccessResponse(w, map[string]interface{}{"configured": false})
+		return
+	}
+	client := webarchive.New(h.config)
+	now := time.Now().UTC()
+	jobs, err := h.db.ClaimWebArchiveJobs(webArchiveBatchSize, now, now.Add(-webArchiveStaleAfter))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	enabled := map[string]bool{}
+	rateLimited := false
+	submitted, archived, failed, dropped := 0, 0, 0, 0
+	for i := range jobs {
+		j := &jobs[i]
+		if rateLimited {
+			h.rescheduleWebArchive(j, now.Add(webArchiveBackoff))
+			continue
+		}
+		on, seen := enabled[j.OrganizationID]
+		if !seen {
+			if on, err = h.db.GetWebArchiveEnabled(j.OrganizationID); err != nil {
+				fmt.Printf("⚠️ Failed to check web archive setting for org %s: %v\n", j.OrganizationID, err)
+				h.rescheduleWebArchive(j, now.Add(webArchivePollInterval))
+				continue
+			}
+			enabled[j.OrganizationID] = on
+		}
+		item, err := h.db.GetCollectionItem(j.ItemID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			fmt.Printf("⚠️ Failed to load item %s for web archive: %v\n", j.ItemID, err)
+			h.rescheduleWebArchive(j, now.Add(webArchivePollInterval))
+			continue
+		}
+		if !on || item == nil || item.DeletedAt != nil {
+			h.dropWebArchive(j.ItemID)
+			dropped++
+			continue
+		}
+
+		if j.JobID == "" {
+			jobID, err := client.Submit(r.Context(), item.URL)
+			switch {
+			case errors.Is(err, webarchive.ErrRateLimited):
+				rateLimited = true
+				h.rescheduleWebArchive(j, now.Add(webArchiveBackoff))
+			case err != nil:
+				if h.retryWebArchive(j, item, now, err) {
+					failed++
+				}
+			default:
+				j.JobID = jobID
+				h.rescheduleWebArchive(j, now.Add(webArchivePollInterval))
+				submitted++
+			}
+			continue
+		}
+
+		capture, err := client.Status(r.Context(), j.JobID)
+		switch {
+		case errors.Is(err, webarchive.ErrRateLimited):
+			rateLimited = true
+			h.rescheduleWebArchive(j, now.Add(webArchiveBackoff))
+		case err != nil:
+			if h.retryWebArchive(j, item, now, err) {
+				failed++
+			}
+		case capture.Status == webarchive.StatusSuccess:
+			if h.finishWebArchive(item, map[string]interface{}{
+				"web_archive_status": webArchiveArchived,
+				"web_archive_url":    capture.ArchivedURL,
+				"web_archived_at":    now.Format(time.RFC3339),
+			}) {
+				archived++
+			}
+		case capture.Status == webarchive.StatusError:
+			j.JobID = ""
+			if h.retryWebArchive(j, item, now, errors.New(capture.Message)) {
+				failed++
+			}
+		case now.Sub(j.CreatedAt) > webArchiveMaxPending:
+			if h.finishWebArchive(item, map[string]interface{}{"web_archive_status": webArchiveFailed}) {
+				failed++
+			}
+		default:
+			h.rescheduleWebArchive(j, now.Add(webArchivePollInterval))
+		}
+	}
+
+	fmt.Printf("🗄️ Web archive job: %d submitted, %d archived, %d failed, %d dropped, rate limited: %v\n",
+		submitted, archived, failed, dropped, rateLimited)
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"configured":   true,
+		"submitted":    submitted,
+		"archived":     archived,
+		"failed":       failed,
+		"dropped":      dropped,
+		"rate_limited": rateLimited,
+	})
+}
+
+// retryWebArchive 记录一次失败：未到上限时按次数退避后重试，否则标记为 failed 并移出队列（返回 true）
+func (h *CollectionsHandler) retryWebArchive(j *models.WebArchiveJob, item *models.CollectionItem, now time.Time, cause error) bool {
+	j.Attempts++
+	fmt.Printf("⚠️ Web archive for item %s failed (attempt %d): %v\n", item.ID, j.Attempts, cause)
+	if j.Attempts < maxWebArchiveAttempts {
+		h.rescheduleWebArchive(j, now.Add(time.Duration(j.Attempts)*webArchiveBackoff))
+		return false
+	}
+	return h.finishWebArchive(item, map[string]interface{}{"web_archive_status": webArchiveFailed})
+}
+
+func (h *CollectionsHandler) rescheduleWebArchive(j *models.WebArchiveJob, next time.Time) {
+	j.NextAttemptAt = next
+	if err := h.db.UpdateWebArchiveJob(j); err != nil {
+		fmt.Printf("⚠️ Failed to reschedule web archive for item %s: %v\n", j.ItemID, err)
+	}
+}
+
+// finishWebArchive 将结果合并进条目 metadata 并移出队列；写入失败时保留任务，认领超时后重新处理
+func (h *CollectionsHandler) finishWebArchive(item *models.CollectionItem, fields map[string]interface{}) bool {
+	meta := map[string]interface{}{}
+	_ = json.Unmarshal(item.Metadata, &meta)
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	for k, v := range fields {
+		meta[k] = v
+	}
+	metaJSON, _ := json.Marshal(meta)
+	if _, err := h.db.UpdateCollectionItemPartial(item.ID, map[string]interface{}{"metadata": metaJSON}); err != nil {
+		fmt.Printf("⚠️ Failed to save web archive result for item %s: %v\n", item.ID, err)
+		return false
+	}
+	h.dropWebArchive(item.ID)
+	return true
+}
+
+func (h *CollectionsHandler) dropWebArchive(itemID string) {
+	if err := h.db.DeleteWebArchiveJob(itemID); err != nil {
+		fmt.Printf("⚠️ Failed to dequeue web archive for item %s: %v\n", itemID, err)
+	}
+}
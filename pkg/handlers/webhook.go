@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +15,8 @@ import (
 
 	"tab-sync-backend-refactor/pkg/config"
 	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/tracing"
 	"tab-sync-backend-refactor/pkg/utils"
 )
 
@@ -20,16 +24,24 @@ import (
 type WebhookHandler struct {
 	config *config.Config
 	db     database.DatabaseInterface
+	ctx    context.Context // 请求上下文（投递通知）
 }
 
 // NewWebhookHandler 创建新的webhook处理器
-func NewWebhookHandler(cfg *config.Config, db database.DatabaseInterface) *WebhookHandler {
+func NewWebhookHandler(cfg *config.Config) *WebhookHandler {
 	return &WebhookHandler{
 		config: cfg,
-		db:     db,
 	}
 }
 
+// withRequest 返回使用当前请求数据库句柄（见 middleware.Database）的处理器副本
+func (h *WebhookHandler) withRequest(r *http.Request) *WebhookHandler {
+	c := *h
+	c.db = database.FromContext(r.Context())
+	c.ctx = r.Context()
+	return &c
+}
+
 // PaddleWebhookEvent Paddle webhook事件结构
 type PaddleWebhookEvent struct {
 	EventID    string                 `json:"event_id"`
@@ -55,10 +67,18 @@ type PaddleTransaction struct {
 
 // PaddleSubscription Paddle订阅数据结构
 type PaddleSubscription struct {
-	ID         string `json:"id"`
-	Status     string `json:"status"`
-	CustomerID string `json:"customer_id"`
-	Items      []struct {
+	ID                   string `json:"id"`
+	Status               string `json:"status"`
+	CustomerID           string `json:"customer_id"`
+	CurrentBillingPeriod *struct {
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+	} `json:"current_billing_period"`
+	CanceledAt      *time.Time `json:"canceled_at"`
+	ScheduledChange *struct {
+		Action string `json:"action"`
+	} `json:"scheduled_change"`
+	Items []struct {
 		PriceID string `json:"price_id"`
 		Product struct {
 			ID   string `json:"id"`
@@ -68,8 +88,29 @@ type PaddleSubscription struct {
 	CustomData map[string]interface{} `json:"custom_data"`
 }
 
+// PaddleAdjustment Paddle调整数据结构（adjustment.* 事件）。退款与拒付都以调整的形式通知，
+// 不带价格与 custom_data，只能按 customer_id 找用户、按 subscription_id 区分订阅付款与一次性购买
+type PaddleAdjustment struct {
+	ID             string `json:"id"`
+	Action         string `json:"action"` // refund、chargeback、credit 及其 *_reverse、chargeback_warning
+	Type           string `json:"type"`   // full、partial
+	Status         string `json:"status"` // pending_approval、approved、rejected、reversed
+	TransactionID  string `json:"transaction_id"`
+	SubscriptionID string `json:"subscription_id"`
+	CustomerID     string `json:"customer_id"`
+}
+
+// PaddleCustomer Paddle客户数据结构（customer.* 事件）
+type PaddleCustomer struct {
+	ID         string                 `json:"id"`
+	Email      string                 `json:"email"`
+	Name       string                 `json:"name"`
+	CustomData map[string]interface{} `json:"custom_data"`
+}
+
 // HandlePaddleWebhook 处理Paddle webhook
 func (h *WebhookHandler) HandlePaddleWebhook(w http.ResponseWriter, r *http.Request) {
+	h = h.withRequest(r)
 	fmt.Printf("🔔 Paddle webhook received: %s %s\n", r.Method, r.URL.Path)
 	fmt.Printf("🔧 Webhook config check:\n")
 	fmt.Printf("   - Pro Price ID: '%s' (len=%d)\n", h.config.PaddleProPriceID, len(h.config.PaddleProPriceID))
@@ -101,6 +142,26 @@ func (h *WebhookHandler) HandlePaddleWebhook(w http.ResponseWriter, r *http.Requ
 
 	fmt.Printf("🔍 Processing Paddle event: %s (ID: %s)\n", event.EventType, event.EventID)
 
+	_, span := tracing.StartSpan(r.Context(), "paddle "+event.EventType, tracing.KindInternal)
+	defer span.End()
+	span.SetAttribute("paddle.event_id", event.EventID)
+
+	// 重复投递（Paddle 超时或收到非 2xx 时会重发同一 event_id）直接确认，不再处理
+	if event.EventID != "" {
+		first, err := h.db.ClaimWebhookEvent(event.EventID, event.EventType)
+		if err != nil {
+			span.RecordError(err)
+			fmt.Printf("❌ Failed to claim webhook event %s: %v\n", event.EventID, err)
+			utils.WriteInternalServerErrorResponse(w, "Failed to process webhook")
+			return
+		}
+		if !first {
+			fmt.Printf("🔁 Duplicate Paddle webhook ignored: %s (ID: %s)\n", event.EventType, event.EventID)
+			utils.WriteSuccessResponse(w, map[string]string{"status": "duplicate"})
+			return
+		}
+	}
+
 	// 处理不同类型的事件
 	switch event.EventType {
 	case "transaction.completed":
@@ -113,6 +174,14 @@ func (h *WebhookHandler) HandlePaddleWebhook(w http.ResponseWriter, r *http.Requ
 		err = h.handleSubscriptionUpdated(event)
 	case "subscription.canceled":
 		err = h.handleSubscriptionCanceled(event)
+	case "subscription.paused":
+		err = h.handleSubscriptionPaused(event)
+	case "subscription.resumed":
+		err = h.handleSubscriptionResumed(event)
+	case "adjustment.created", "adjustment.updated":
+		err = h.handleAdjustment(event)
+	case "customer.updated":
+		err = h.handleCustomerUpdated(event)
 	default:
 		fmt.Printf("⚠️ Unhandled Paddle event type: %s\n", event.EventType)
 		utils.WriteSuccessResponse(w, map[string]string{"status": "ignored"})
@@ -120,7 +189,13 @@ func (h *WebhookHandler) HandlePaddleWebhook(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err != nil {
+		span.RecordError(err)
 		fmt.Printf("❌ Failed to process webhook event: %v\n", err)
+		if event.EventID != "" {
+			if rerr := h.db.ReleaseWebhookEvent(event.EventID); rerr != nil {
+				fmt.Printf("⚠️ Failed to release webhook event %s: %v\n", event.EventID, rerr)
+			}
+		}
 		utils.WriteInternalServerErrorResponse(w, "Failed to process webhook")
 		return
 	}
@@ -190,6 +265,11 @@ func (h *WebhookHandler) handleTransactionCompleted(event PaddleWebhookEvent) er
 		return fmt.Errorf("missing user_id in transaction custom_data")
 	}
 
+	// 一次性终身会员购买（按价格ID识别）
+	if lifetime := h.lifetimeTierFromTransaction(transaction); lifetime != "" {
+		return h.grantLifetime(userID, lifetime, transaction.CustomerID, transaction.ID)
+	}
+
 	// 确定用户等级
 	tier := h.determineTierFromTransaction(transaction)
 	if tier == "" {
@@ -197,7 +277,7 @@ func (h *WebhookHandler) handleTransactionCompleted(event PaddleWebhookEvent) er
 	}
 
 	// 更新用户等级
-	return h.updateUserTier(userID, tier, "transaction_completed", transaction.ID)
+	return h.updateUserTier(userID, tier, transaction.CustomerID, "transaction_completed", transaction.ID)
 }
 
 // handleSubscriptionCreated 处理订阅创建事件
@@ -240,7 +320,133 @@ func (h *WebhookHandler) handleSubscriptionCanceled(event PaddleWebhookEvent) er
 	}
 
 	// 将用户降级为免费版
-	return h.updateUserTier(userID, "free", "subscription_canceled", subscription.ID)
+	if err := h.updateUserTier(userID, "free", subscription.CustomerID, "subscription_canceled", subscription.ID); err != nil {
+		return err
+	}
+	h.syncSubscription(userID, h.tierFromPriceIDs(subscription), subscription)
+	return nil
+}
+
+// handleSubscriptionPaused 处理订阅暂停事件：暂停期间不再享有付费权益
+func (h *WebhookHandler) handleSubscriptionPaused(event PaddleWebhookEvent) error {
+	fmt.Printf("⏸️ Processing subscription paused event\n")
+
+	var subscription PaddleSubscription
+	if err := decodeEventData(event, &subscription); err != nil {
+		return fmt.Errorf("failed to parse subscription: %w", err)
+	}
+	userID, err := h.resolveUserID(subscription.CustomData, subscription.CustomerID)
+	if err != nil {
+		return err
+	}
+	if err := h.updateUserTier(userID, "free", subscription.CustomerID, "subscription_paused", subscription.ID); err != nil {
+		return err
+	}
+	h.syncSubscription(userID, h.tierFromPriceIDs(subscription), subscription)
+	return nil
+}
+
+// handleSubscriptionResumed 处理订阅恢复事件：按恢复后的订阅状态与价格重新确定等级
+func (h *WebhookHandler) handleSubscriptionResumed(event PaddleWebhookEvent) error {
+	fmt.Printf("▶️ Processing subscription resumed event\n")
+	return h.handleSubscriptionEvent(event, "subscription_resumed")
+}
+
+// handleAdjustment 处理已批准的全额退款与拒付（adjustment.created/updated）：撤销该交易带来的付费等级，其他调整忽略
+func (h *WebhookHandler) handleAdjustment(event PaddleWebhookEvent) error {
+	var adj PaddleAdjustment
+	if err := decodeEventData(event, &adj); err != nil {
+		return fmt.Errorf("failed to parse adjustment: %w", err)
+	}
+	fmt.Printf("↩️ Processing %s: %s %s (%s), transaction %s\n", event.EventType, adj.Type, adj.Action, adj.Status, adj.TransactionID)
+
+	var source string
+	switch adj.Action {
+	case "refund":
+		// 部分退款（如按比例退差价）不影响等级
+		if adj.Type == "partial" {
+			fmt.Printf("⚠️ Ignoring partial refund %s\n", adj.ID)
+			return nil
+		}
+		source = "transaction_refunded"
+	case "chargeback":
+		source = "transaction_chargeback"
+	default:
+		return nil
+	}
+	// 退款需经 Paddle 审核：创建时为 pending_approval，审核通过后以 adjustment.updated 通知
+	if adj.Status != "approved" {
+		return nil
+	}
+	userID, err := h.resolveUserID(nil, adj.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	// 没有订阅的交易是一次性购买，即终身会员：先撤销终身资格，否则降级会被终身等级挡住
+	if adj.SubscriptionID == "" {
+		revoked, none := false, ""
+		if err := h.db.UpdateUserBilling(userID, database.UserBillingUpdate{IsLifetimeMember: &revoked, LifetimeMemberType: &none}); err != nil {
+			return fmt.Errorf("failed to revoke lifetime membership: %w", err)
+		}
+		fmt.Printf("↩️ Revoked lifetime membership of user %s (ref: %s)\n", userID, adj.TransactionID)
+	}
+	return h.updateUserTier(userID, "free", adj.CustomerID, source, adj.TransactionID)
+}
+
+// handleCustomerUpdated 同步用户的 paddle_customer_id（按 custom_data.user_id，其次按邮箱匹配）
+func (h *WebhookHandler) handleCustomerUpdated(event PaddleWebhookEvent) error {
+	fmt.Printf("👤 Processing customer updated event\n")
+
+	var customer PaddleCustomer
+	if err := decodeEventData(event, &customer); err != nil {
+		return fmt.Errorf("failed to parse customer: %w", err)
+	}
+	if customer.ID == "" {
+		return fmt.Errorf("missing customer id")
+	}
+
+	userID, _ := customer.CustomData["user_id"].(string)
+	if userID == "" {
+		if customer.Email == "" {
+			return fmt.Errorf("customer %s has neither user_id nor email", customer.ID)
+		}
+		user, err := h.db.GetUserByEmail(customer.Email)
+		if err != nil {
+			return fmt.Errorf("failed to find user for customer %s: %w", customer.ID, err)
+		}
+		userID = user.ID
+	}
+
+	if err := h.db.UpdateUserBilling(userID, database.UserBillingUpdate{PaddleCustomerID: &customer.ID}); err != nil {
+		return fmt.Errorf("failed to sync paddle customer id: %w", err)
+	}
+	fmt.Printf("✅ Synced paddle customer %s to user %s\n", customer.ID, userID)
+	return nil
+}
+
+// decodeEventData 将事件 data 解析为具体结构
+func decodeEventData(event PaddleWebhookEvent, v interface{}) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// resolveUserID 优先使用 custom_data.user_id（结账时写入），否则按 Paddle 客户 ID 查找用户
+func (h *WebhookHandler) resolveUserID(customData map[string]interface{}, customerID string) (string, error) {
+	if userID, ok := customData["user_id"].(string); ok && userID != "" {
+		return userID, nil
+	}
+	if customerID == "" {
+		return "", fmt.Errorf("missing user_id in custom_data and no customer_id")
+	}
+	user, err := h.db.GetUserByPaddleCustomerID(customerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to find user for customer %s: %w", customerID, err)
+	}
+	return user.ID, nil
 }
 
 // handleSubscriptionEvent 处理订阅相关事件
@@ -276,16 +482,30 @@ func (h *WebhookHandler) handleSubscriptionEvent(event PaddleWebhookEvent, event
 		}
 	}
 
+	// 确定订阅的计划：价格 ID 精确匹配优先（计划变更后 custom_data 仍是最初结账时的计划），
+	// 其次 custom_data，最后按产品名推断
+	planTier := h.tierFromPriceIDs(subscription)
+	if planTier == "" && tierFromCustomData != "" {
+		planTier = tierFromCustomData
+		fmt.Printf("🎯 Using tier from custom_data: %s\n", planTier)
+	}
+	if planTier == "" {
+		planTier = h.determineTierFromSubscription(subscription)
+	}
+
+	// 付款失败：进入催缴宽限期，保留当前等级，到期后由 SubscriptionHandler.ExpireDunning 降级
+	if subscription.Status == string(models.StatusPastDue) || subscription.Status == string(models.StatusUnpaid) {
+		if err := h.startDunning(userID, subscription.CustomerID, eventType, subscription.ID); err != nil {
+			return err
+		}
+		h.syncSubscription(userID, planTier, subscription)
+		return nil
+	}
+
 	// 根据订阅状态确定用户等级
 	var tier string
 	if subscription.Status == "active" {
-		// 优先使用custom_data中的计划信息
-		if tierFromCustomData != "" {
-			tier = tierFromCustomData
-			fmt.Printf("🎯 Using tier from custom_data: %s\n", tier)
-		} else {
-			tier = h.determineTierFromSubscription(subscription)
-		}
+		tier = planTier
 	} else {
 		tier = "free" // 非活跃订阅降级为免费版
 	}
@@ -295,7 +515,138 @@ func (h *WebhookHandler) handleSubscriptionEvent(event PaddleWebhookEvent, event
 	}
 
 	// 更新用户等级
-	return h.updateUserTier(userID, tier, eventType, subscription.ID)
+	if err := h.updateUserTier(userID, tier, subscription.CustomerID, eventType, subscription.ID); err != nil {
+		return err
+	}
+	h.syncSubscription(userID, planTier, subscription)
+	return nil
+}
+
+// tierFromPriceIDs 按配置的订阅价格 ID 精确匹配等级，未匹配返回空
+func (h *WebhookHandler) tierFromPriceIDs(subscription PaddleSubscription) string {
+	for _, item := range subscription.Items {
+		switch {
+		case item.PriceID == "":
+		case item.PriceID == h.config.PaddleProPriceID:
+			return "pro"
+		case item.PriceID == h.config.PaddlePowerPriceID:
+			return "power"
+		}
+	}
+	return ""
+}
+
+// syncSubscription 将 Paddle 订阅镜像到 user_subscriptions（供计划变更等查找 Paddle 订阅 ID）。
+// 用户权益以 users.tier 为准，镜像失败只记录日志，不让 Paddle 重试整个事件。
+func (h *WebhookHandler) syncSubscription(userID, planTier string, subscription PaddleSubscription) {
+	if err := h.upsertSubscription(userID, planTier, subscription); err != nil {
+		fmt.Printf("⚠️ Failed to sync subscription %s for user %s: %v\n", subscription.ID, userID, err)
+	}
+}
+
+func (h *WebhookHandler) upsertSubscription(userID, planTier string, subscription PaddleSubscription) error {
+	existing, err := h.db.GetUserSubscription(userID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if existing == nil || existing.PaddleSubscriptionID == nil || *existing.PaddleSubscriptionID != subscription.ID {
+		existing = &models.UserSubscription{UserID: userID, PaddleSubscriptionID: &subscription.ID}
+	}
+
+	// 无法识别计划时沿用已有记录的计划
+	if planTier != "" {
+		plan, err := h.db.GetSubscriptionPlanByTier(models.UserTier(planTier))
+		if err != nil {
+			return fmt.Errorf("failed to get %s plan: %w", planTier, err)
+		}
+		existing.PlanID = plan.ID
+	}
+	if existing.PlanID == "" {
+		return fmt.Errorf("unable to determine plan for subscription")
+	}
+
+	existing.Status = models.SubscriptionStatus(subscription.Status)
+	existing.CanceledAt = subscription.CanceledAt
+	existing.CancelAtPeriodEnd = subscription.ScheduledChange != nil && subscription.ScheduledChange.Action == "cancel"
+	if period := subscription.CurrentBillingPeriod; period != nil {
+		existing.CurrentPeriodStart = &period.StartsAt
+		existing.CurrentPeriodEnd = &period.EndsAt
+	}
+
+	if existing.ID == "" {
+		return h.db.CreateSubscription(existing)
+	}
+	return h.db.UpdateSubscription(existing)
+}
+
+// startDunning 标记用户进入催缴宽限期；已在宽限期内时保留最初的开始时间，重复事件不会延长宽限
+func (h *WebhookHandler) startDunning(userID, customerID, source, referenceID string) error {
+	current, err := h.db.GetUserWithSubscription(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if current.DunningStatus == models.DunningGrace {
+		fmt.Printf("⏳ User %s already in dunning grace period since %v (source: %s)\n", userID, current.DunningStartedAt, source)
+		return nil
+	}
+
+	status := string(models.DunningGrace)
+	now := time.Now().UTC()
+	update := database.UserBillingUpdate{DunningStatus: &status, DunningStartedAt: &now}
+	if customerID != "" {
+		update.PaddleCustomerID = &customerID
+	}
+	if err := h.db.UpdateUserBilling(userID, update); err != nil {
+		return fmt.Errorf("failed to start dunning: %w", err)
+	}
+	fmt.Printf("⏳ User %s entered dunning grace period, keeping tier %s (source: %s, ref: %s)\n",
+		userID, current.Tier, source, referenceID)
+	return nil
+}
+
+// lifetimeTierFromTransaction 交易包含终身会员价格时返回对应等级，否则返回空
+func (h *WebhookHandler) lifetimeTierFromTransaction(transaction PaddleTransaction) string {
+	for _, item := range transaction.Items {
+		if item.PriceID == "" {
+			continue
+		}
+		switch item.PriceID {
+		case h.config.PaddleLifetimePowerPriceID:
+			return string(models.TierPower)
+		case h.config.PaddleLifetimeProPriceID:
+			return string(models.TierPro)
+		}
+	}
+	return ""
+}
+
+// grantLifetime 授予终身会员：记录终身等级，并把当前等级提升到不低于终身等级
+func (h *WebhookHandler) grantLifetime(userID, lifetime, customerID, referenceID string) error {
+	fmt.Printf("♾️ Granting %s lifetime membership to user %s (ref: %s)\n", lifetime, userID, referenceID)
+
+	current, err := h.db.GetUserWithSubscription(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	lifetimeTier := models.UserTier(lifetime)
+	if current.IsLifetimeMember && current.LifetimeMemberType != nil {
+		lifetimeTier = models.MaxTier(lifetimeTier, models.UserTier(*current.LifetimeMemberType))
+	}
+	tier := string(models.MaxTier(current.Tier, lifetimeTier))
+	lifetimeType := string(lifetimeTier)
+	isLifetime := true
+
+	update := database.UserBillingUpdate{Tier: &tier, IsLifetimeMember: &isLifetime, LifetimeMemberType: &lifetimeType}
+	if customerID != "" {
+		update.PaddleCustomerID = &customerID
+	}
+	change, err := updateBilling(h.db, current, userID, update, "paddle:lifetime_purchase", referenceID)
+	if err != nil {
+		return fmt.Errorf("failed to grant lifetime membership: %w", err)
+	}
+	notifyTierChange(h.ctx, current.Email, change)
+	fmt.Printf("✅ User %s is now a %s lifetime member (tier: %s)\n", userID, lifetimeType, tier)
+	return nil
 }
 
 // determineTierFromTransaction 从交易中确定用户等级
@@ -406,29 +757,37 @@ func (h *WebhookHandler) determineTierFromSubscription(subscription PaddleSubscr
 	return ""
 }
 
-// updateUserTier 更新用户等级
-func (h *WebhookHandler) updateUserTier(userID, tier, source, referenceID string) error {
+// updateUserTier 更新用户等级；customerID 非空时同时同步 paddle_customer_id
+func (h *WebhookHandler) updateUserTier(userID, tier, customerID, source, referenceID string) error {
 	fmt.Printf("🔄 Updating user %s tier to %s (source: %s, ref: %s)\n",
 		userID, tier, source, referenceID)
 
-	// 获取用户信息
-	user, err := h.db.GetUserByID(userID)
-	if err != nil {
+	// 终身会员不会因订阅变化（取消、暂停、降级）落到终身等级以下
+	current, err := h.db.GetUserWithSubscription(userID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
+	if current != nil && current.IsLifetimeMember && current.LifetimeMemberType != nil {
+		if effective := string(models.MaxTier(models.UserTier(tier), models.UserTier(*current.LifetimeMemberType))); effective != tier {
+			fmt.Printf("♾️ User %s is a %s lifetime member, keeping tier %s\n", userID, *current.LifetimeMemberType, effective)
+			tier = effective
+		}
+	}
 
-	// 更新用户等级和时间戳
-	user.Tier = tier
-	user.UpdatedAt = time.Now()
-
-	// 更新用户信息
-	err = h.db.UpdateUser(user)
+	// 订阅生效即视为试用结束（转为付费或被订阅状态覆盖）；等级已由订阅状态确定，结束催缴
+	trialActive, dunning := false, string(models.DunningNone)
+	update := database.UserBillingUpdate{Tier: &tier, TrialActive: &trialActive, DunningStatus: &dunning}
+	if customerID != "" {
+		update.PaddleCustomerID = &customerID
+	}
+	change, err := updateBilling(h.db, current, userID, update, "paddle:"+source, referenceID)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
+	if current != nil {
+		notifyTierChange(h.ctx, current.Email, change)
+	}
 
-	fmt.Printf("✅ Successfully updated user %s (%s) tier to %s\n",
-		userID, user.Email, tier)
-
+	fmt.Printf("✅ Successfully updated user %s tier to %s\n", userID, tier)
 	return nil
 }
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+const (
+	testWebhookSecret   = "pdl_ntfset_test_secret"
+	testProPriceID      = "pri_pro"
+	testPowerPriceID    = "pri_power"
+	testLifetimePriceID = "pri_lifetime_power"
+)
+
+// fakeWebhookDB 只实现 webhook 处理用到的方法；其余方法调用时 panic（嵌入的接口为 nil）
+type fakeWebhookDB struct {
+	database.DatabaseInterface
+	users         map[string]*models.UserWithSubscription
+	events        map[string]bool
+	billingWrites int
+	tierChanges   []models.TierChange
+}
+
+func newFakeWebhookDB(users ...*models.UserWithSubscription) *fakeWebhookDB {
+	db := &fakeWebhookDB{users: map[string]*models.UserWithSubscription{}, events: map[string]bool{}}
+	for _, u := range users {
+		db.users[u.ID] = u
+	}
+	return db
+}
+
+func (db *fakeWebhookDB) ClaimWebhookEvent(eventID, eventType string) (bool, error) {
+	if db.events[eventID] {
+		return false, nil
+	}
+	db.events[eventID] = true
+	return true, nil
+}
+
+func (db *fakeWebhookDB) ReleaseWebhookEvent(eventID string) error {
+	delete(db.events, eventID)
+	return nil
+}
+
+func (db *fakeWebhookDB) GetUserWithSubscription(userID string) (*models.UserWithSubscription, error) {
+	u, ok := db.users[userID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	c := *u
+	return &c, nil
+}
+
+func (db *fakeWebhookDB) GetUserByEmail(email string) (*models.User, error) {
+	for _, u := range db.users {
+		if u.Email == email {
+			return &u.User, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (db *fakeWebhookDB) GetUserByPaddleCustomerID(customerID string) (*models.User, error) {
+	for _, u := range db.users {
+		if u.PaddleCustomerID != nil && *u.PaddleCustomerID == customerID {
+			return &u.User, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (db *fakeWebhookDB) UpdateUserBilling(userID string, update database.UserBillingUpdate) error {
+	u, ok := db.users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	db.billingWrites++
+	if update.Tier != nil {
+		u.Tier = models.UserTier(*update.Tier)
+	}
+	if update.PaddleCustomerID != nil {
+		id := *update.PaddleCustomerID
+		u.PaddleCustomerID = &id
+	}
+	if update.IsLifetimeMember != nil {
+		u.IsLifetimeMember = *update.IsLifetimeMember
+	}
+	if update.LifetimeMemberType != nil {
+		if *update.LifetimeMemberType == "" {
+			u.LifetimeMemberType = nil
+		} else {
+			t := *update.LifetimeMemberType
+			u.LifetimeMemberType = &t
+		}
+	}
+	if update.DunningStatus != nil {
+		u.DunningStatus = models.DunningStatus(*update.DunningStatus)
+	}
+	return nil
+}
+
+func (db *fakeWebhookDB) RecordTierChange(c *models.TierChange) error {
+	db.tierChanges = append(db.tierChanges, *c)
+	return nil
+}
+
+func (db *fakeWebhookDB) CreateNotification(n *models.Notification) error { return nil }
+
+func (db *fakeWebhookDB) GetUserSubscription(userID string) (*models.UserSubscription, error) {
+	return nil, database.ErrNotFound
+}
+
+func (db *fakeWebhookDB) GetSubscriptionPlanByTier(tier models.UserTier) (*models.SubscriptionPlan, error) {
+	return &models.SubscriptionPlan{ID: "plan-" + string(tier)}, nil
+}
+
+func (db *fakeWebhookDB) CreateSubscription(s *models.UserSubscription) error { return nil }
+
+func (db *fakeWebhookDB) UpdateSubscription(s *models.UserSubscription) error { return nil }
+
+func newTestWebhookHandler() *WebhookHandler {
+	return NewWebhookHandler(&config.Config{
+		PaddleWebhookSecret:        testWebhookSecret,
+		PaddleProPriceID:           testProPriceID,
+		PaddlePowerPriceID:         testPowerPriceID,
+		PaddleLifetimePowerPriceID: testLifetimePriceID,
+	})
+}
+
+// deliverWebhook 以 Paddle 的签名格式投递事件，返回响应
+func deliverWebhook(t *testing.T, h *WebhookHandler, db database.DatabaseInterface, eventID, eventType string, data map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{
+		"event_id":    eventID,
+		"event_type":  eventType,
+		"occurred_at": "2026-01-01T00:00:00Z",
+		"data":        data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := "1767225600"
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(ts + ":" + string(body)))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/webhooks/paddle", strings.NewReader(string(body)))
+	r.Header.Set("Paddle-Signature", "ts="+ts+";h1="+hex.EncodeToString(mac.Sum(nil)))
+	r = r.WithContext(database.ContextWithDatabase(r.Context(), db))
+	w := httptest.NewRecorder()
+	h.HandlePaddleWebhook(w, r)
+	return w
+}
+
+func webhookStatus(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	return resp.Data.Status
+}
+
+func testUser(id, email string, tier models.UserTier) *models.UserWithSubscription {
+	return &models.UserWithSubscription{User: models.User{ID: id, Email: email}, Tier: tier}
+}
+
+func paddleCustomer(u *models.UserWithSubscription, customerID string) *models.UserWithSubscription {
+	u.PaddleCustomerID = &customerID
+	return u
+}
+
+func wantTier(tier models.UserTier) func(t *testing.T, u *models.UserWithSubscription) {
+	return func(t *testing.T, u *models.UserWithSubscription) {
+		if u.Tier != tier {
+			t.Errorf("tier = %s, want %s", u.Tier, tier)
+		}
+	}
+}
+
+// adjustmentPayload Paddle Billing adjustment 实体（adjustment.created/updated 的 data），subscriptionID 为空表示一次性购买
+func adjustmentPayload(action, typ, status, subscriptionID string) map[string]interface{} {
+	var sub interface{}
+	if subscriptionID != "" {
+		sub = subscriptionID
+	}
+	return map[string]interface{}{
+		"id":                        "adj_01",
+		"action":                    action,
+		"type":                      typ,
+		"transaction_id":            "txn_01",
+		"subscription_id":           sub,
+		"customer_id":               "ctm_1",
+		"reason":                    "customer requested",
+		"credit_applied_to_balance": nil,
+		"currency_code":             "USD",
+		"status":                    status,
+		"items": []map[string]interface{}{{
+			"id": "adjitm_01", "item_id": "txnitm_01", "type": typ, "amount": "1000", "proration": nil,
+			"totals": map[string]interface{}{"subtotal": "909", "tax": "91", "total": "1000"},
+		}},
+		"totals":     map[string]interface{}{"subtotal": "909", "tax": "91", "total": "1000", "fee": "55", "earnings": "854", "currency_code": "USD"},
+		"created_at": "2026-01-01T00:00:00Z",
+		"updated_at": "2026-01-01T00:00:00Z",
+	}
+}
+
+func TestPaddleWebhookEvents(t *testing.T) {
+	lifetime := string(models.TierPower)
+	tests := []struct {
+		name      string
+		eventType string
+		user      *models.UserWithSubscription
+		data      map[string]interface{}
+		check     func(t *testing.T, u *models.UserWithSubscription)
+	}{
+		{
+			name:      "subscription paused downgrades to free",
+			eventType: "subscription.paused",
+			user:      testUser("u1", "a@example.com", models.TierPro),
+			data: map[string]interface{}{
+				"id": "sub_1", "status": "paused", "customer_id": "ctm_1",
+				"items":       []map[string]interface{}{{"price_id": testProPriceID}},
+				"custom_data": map[string]interface{}{"user_id": "u1"},
+			},
+			check: func(t *testing.T, u *models.UserWithSubscription) {
+				if u.Tier != models.TierFree {
+					t.Errorf("tier = %s, want free", u.Tier)
+				}
+			},
+		},
+		{
+			name:      "subscription resumed restores the plan tier",
+			eventType: "subscription.resumed",
+			user:      testUser("u1", "a@example.com", models.TierFree),
+			data: map[string]interface{}{
+				"id": "sub_1", "status": "active", "customer_id": "ctm_1",
+				"items":       []map[string]interface{}{{"price_id": testPowerPriceID}},
+				"custom_data": map[string]interface{}{"user_id": "u1"},
+			},
+			check: func(t *testing.T, u *models.UserWithSubscription) {
+				if u.Tier != models.TierPower {
+					t.Errorf("tier = %s, want power", u.Tier)
+				}
+			},
+		},
+		{
+			name:      "approved full refund of a subscription payment downgrades user found by customer id",
+			eventType: "adjustment.updated",
+			user:      paddleCustomer(testUser("u1", "a@example.com", models.TierPro), "ctm_1"),
+			data:      adjustmentPayload("refund", "full", "approved", "sub_1"),
+			check: func(t *testing.T, u *models.UserWithSubscription) {
+				if u.Tier != models.TierFree {
+					t.Errorf("tier = %s, want free", u.Tier)
+				}
+			},
+		},
+		{
+			name:      "chargeback of a one-time purchase revokes lifetime membership",
+			eventType: "adjustment.created",
+			user: func() *models.UserWithSubscription {
+				u := paddleCustomer(testUser("u1", "a@example.com", models.TierPower), "ctm_1")
+				u.IsLifetimeMember, u.LifetimeMemberType = true, &lifetime
+				return u
+			}(),
+			data: adjustmentPayload("chargeback", "full", "approved", ""),
+			check: func(t *testing.T, u *models.UserWithSubscription) {
+				if u.Tier != models.TierFree {
+					t.Errorf("tier = %s, want free", u.Tier)
+				}
+				if u.IsLifetimeMember || u.LifetimeMemberType != nil {
+					t.Errorf("lifetime membership not revoked: %v %v", u.IsLifetimeMember, u.LifetimeMemberType)
+				}
+			},
+		},
+		{
+			name:      "refund of a subscription payment keeps lifetime tier",
+			eventType: "adjustment.updated",
+			user: func() *models.UserWithSubscription {
+				u := paddleCustomer(testUser("u1", "a@example.com", models.TierPower), "ctm_1")
+				u.IsLifetimeMember, u.LifetimeMemberType = true, &lifetime
+				return u
+			}(),
+			data: adjustmentPayload("refund", "full", "approved", "sub_1"),
+			check: func(t *testing.T, u *models.UserWithSubscription) {
+				if u.Tier != models.TierPower || !u.IsLifetimeMember {
+					t.Errorf("tier = %s lifetime = %v, want power lifetime", u.Tier, u.IsLifetimeMember)
+				}
+			},
+		},
+		{
+			name:      "refund pending approval does not change tier",
+			eventType: "adjustment.created",
+			user:      paddleCustomer(testUser("u1", "a@example.com", models.TierPro), "ctm_1"),
+			data:      adjustmentPayload("refund", "full", "pending_approval", "sub_1"),
+			check:     wantTier(models.TierPro),
+		},
+		{
+			name:      "partial refund does not change tier",
+			eventType: "adjustment.updated",
+			user:      paddleCustomer(testUser("u1", "a@example.com", models.TierPro), "ctm_1"),
+			data:      adjustmentPayload("refund", "partial", "approved", "sub_1"),
+			check:     wantTier(models.TierPro),
+		},
+		{
+			name:      "credit adjustment does not change tier",
+			eventType: "adjustment.created",
+			user:      paddleCustomer(testUser("u1", "a@example.com", models.TierPro), "ctm_1"),
+			data:      adjustmentPayload("credit", "partial", "approved", "sub_1"),
+			check:     wantTier(models.TierPro),
+		},
+		{
+			name:      "customer updated syncs paddle customer id by email",
+			eventType: "customer.updated",
+			user:      testUser("u1", "a@example.com", models.TierPro),
+			data: map[string]interface{}{
+				"id": "ctm_9", "email": "a@example.com",
+			},
+			check: func(t *testing.T, u *models.UserWithSubscription) {
+				if u.PaddleCustomerID == nil || *u.PaddleCustomerID != "ctm_9" {
+					t.Errorf("paddle_customer_id = %v, want ctm_9", u.PaddleCustomerID)
+				}
+				if u.Tier != models.TierPro {
+					t.Errorf("tier = %s, want unchanged pro", u.Tier)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeWebhookDB(tt.user)
+			h := newTestWebhookHandler()
+
+			if got := webhookStatus(t, deliverWebhook(t, h, db, "evt_1", tt.eventType, tt.data)); got != "processed" {
+				t.Fatalf("first delivery status = %q, want processed", got)
+			}
+			tt.check(t, db.users["u1"])
+
+			// 重复投递不再写入：即使期间状态被其他事件改变也保持不变
+			writes, changes := db.billingWrites, len(db.tierChanges)
+			before := *db.users["u1"]
+			if got := webhookStatus(t, deliverWebhook(t, h, db, "evt_1", tt.eventType, tt.data)); got != "duplicate" {
+				t.Fatalf("duplicate delivery status = %q, want duplicate", got)
+			}
+			if db.billingWrites != writes || len(db.tierChanges) != changes {
+				t.Errorf("duplicate delivery wrote billing (%d -> %d writes, %d -> %d tier changes)",
+					writes, db.billingWrites, changes, len(db.tierChanges))
+			}
+			if after := *db.users["u1"]; after.Tier != before.Tier {
+				t.Errorf("duplicate delivery changed tier %s -> %s", before.Tier, after.Tier)
+			}
+		})
+	}
+}
+
+func TestPaddleWebhookFailureReleasesEvent(t *testing.T) {
+	db := newFakeWebhookDB()
+	h := newTestWebhookHandler()
+	data := map[string]interface{}{"id": "ctm_9", "email": "late@example.com"}
+
+	if w := deliverWebhook(t, h, db, "evt_1", "customer.updated", data); w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 for unknown customer", w.Code)
+	}
+	if db.events["evt_1"] {
+		t.Fatal("failed event still recorded; Paddle retry would be ignored")
+	}
+
+	db.users["u1"] = testUser("u1", "late@example.com", models.TierFree)
+	if got := webhookStatus(t, deliverWebhook(t, h, db, "evt_1", "customer.updated", data)); got != "processed" {
+		t.Fatalf("retry status = %q, want processed", got)
+	}
+	if id := db.users["u1"].PaddleCustomerID; id == nil || *id != "ctm_9" {
+		t.Errorf("paddle_customer_id = %v, want ctm_9", id)
+	}
+}
+
+func TestPaddleWebhookRejectsBadSignature(t *testing.T) {
+	db := newFakeWebhookDB(testUser("u1", "a@example.com", models.TierPro))
+	r := httptest.NewRequest(http.MethodPost, "/api/webhooks/paddle",
+		strings.NewReader(`{"event_id":"evt_1","event_type":"subscription.paused","data":{}}`))
+	r.Header.Set("Paddle-Signature", "ts=1;h1=deadbeef")
+	r = r.WithContext(database.ContextWithDatabase(r.Context(), db))
+	w := httptest.NewRecorder()
+	newTestWebhookHandler().HandlePaddleWebhook(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if len(db.events) != 0 || db.billingWrites != 0 {
+		t.Error("unsigned delivery was processed")
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// AdminAuth 保护运维管理端点：调用方携带 "Authorization: Bearer $ADMIN_API_KEY"。
+// 未配置 ADMIN_API_KEY 时拒绝所有调用（与 CronAuth 相同）
+func AdminAuth(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expected := "Bearer " + cfg.AdminAPIKey
+			got := r.Header.Get("Authorization")
+			if cfg.AdminAPIKey == "" || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+				utils.WriteAppError(w, utils.ErrUnauthorized.WithMessage("Invalid admin API key"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
     "context"
+    "errors"
     "fmt"
     "net/http"
     "strings"
@@ -9,6 +10,7 @@ import (
 
     "tab-sync-backend-refactor/pkg/config"
     "tab-sync-backend-refactor/pkg/models"
+    "tab-sync-backend-refactor/pkg/reporting"
     "tab-sync-backend-refactor/pkg/utils"
 
     "github.com/golang-jwt/jwt/v5"
@@ -19,6 +21,8 @@ type ContextKey string
 
 const (
     UserContextKey ContextKey = "user"
+    // claimsContextKey 访问令牌的完整声明（见 TokenVersion）
+    claimsContextKey ContextKey = "token_claims"
 )
 
 // AuthMiddleware JWT 鉴权中间件
@@ -40,7 +44,7 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
                     tokenString = strings.TrimPrefix(authHeader, "Bearer ")
                 } else {
                     debugf("Auth middleware: Invalid authorization header format\n")
-                    utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid authorization header format")
+                    utils.WriteAppError(w, utils.ErrInvalidToken.WithMessage("Invalid authorization header format"))
                     return
                 }
             } else if c, err := r.Cookie("access_token"); err == nil && c != nil && c.Value != "" {
@@ -48,7 +52,7 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
                 debugf("Auth middleware: Using token from cookie\n")
             } else {
                 debugf("Auth middleware: Missing authorization header and cookie\n")
-                utils.WriteErrorResponse(w, http.StatusUnauthorized, "Missing authorization header")
+                utils.WriteAppError(w, utils.ErrUnauthorized.WithMessage("Missing authorization header"))
                 return
             }
 
@@ -65,14 +69,18 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 
             if err != nil {
                 debugf("Auth middleware: Token parsing failed: %v\n", err)
-                utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid token: "+err.Error())
+                if errors.Is(err, jwt.ErrTokenExpired) {
+                    utils.WriteAppError(w, utils.ErrTokenExpired)
+                    return
+                }
+                utils.WriteAppError(w, utils.ErrInvalidToken)
                 return
             }
 
             // 检查 token 是否有效
             if !token.Valid {
                 debugf("Auth middleware: Token is not valid\n")
-                utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+                utils.WriteAppError(w, utils.ErrInvalidToken)
                 return
             }
 
@@ -80,7 +88,7 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
             claims, ok := token.Claims.(*models.TokenClaims)
             if !ok {
                 debugf("Auth middleware: Invalid token claims\n")
-                utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid token claims")
+                utils.WriteAppError(w, utils.ErrInvalidToken.WithMessage("Invalid token claims"))
                 return
             }
 
@@ -89,26 +97,30 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
             // 仅允许 access token
             if claims.Type != "access" {
                 debugf("Auth middleware: Invalid token type: %s\n", claims.Type)
-                utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid token type")
+                utils.WriteAppError(w, utils.ErrInvalidToken.WithMessage("Invalid token type"))
                 return
             }
 
             // 过期校验
             if time.Now().Unix() > claims.Exp {
                 debugf("Auth middleware: Token expired. Current: %d, Exp: %d\n", time.Now().Unix(), claims.Exp)
-                utils.WriteErrorResponse(w, http.StatusUnauthorized, "Token expired")
+                utils.WriteAppError(w, utils.ErrTokenExpired)
                 return
             }
 
+            reporting.SetUser(r.Context(), claims.UserID)
+
             // 将用户信息注入 context
             user := &models.User{
                 ID:    claims.UserID,
                 Email: claims.Email,
+                Tier:  claims.Tier,
             }
 
             debugf("Auth middleware: Authentication successful for user %s (%s)\n", user.ID, user.Email)
 
             ctx := context.WithValue(r.Context(), UserContextKey, user)
+            ctx = context.WithValue(ctx, claimsContextKey, claims)
             next.ServeHTTP(w, r.WithContext(ctx))
         })
     }
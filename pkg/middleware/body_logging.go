@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"tab-sync-backend-refactor/pkg/config"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxLoggedBody 单个请求最多记录的请求体字节数
+const maxLoggedBody = 4 << 10
+
+type bodyLogKey struct{}
+
+// bodyLogState 在请求处理期间共享，允许路由级中间件关闭记录
+type bodyLogState struct {
+	skip bool
+}
+
+// BodyLogger 在 DEBUG=true 时记录脱敏后的请求体与响应状态，用于排查扩展端上报的同步问题。
+// 按 DEBUG_BODY_SAMPLE_RATE 采样；请求体在处理结束后才输出，因此路由可用 SkipBodyLogging 单独关闭。
+func BodyLogger(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if cfg == nil || !cfg.Debug {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.DebugBodySampleRate < 1 && rand.Float64() >= cfg.DebugBodySampleRate {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			state := &bodyLogState{}
+			captured := &cappedBuffer{max: maxLoggedBody}
+			if r.Body != nil {
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.TeeReader(r.Body, captured), r.Body}
+			}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), bodyLogKey{}, state)))
+
+			if state.skip {
+				return
+			}
+			fmt.Printf("[debug] %s %s status=%d bytes=%d req_id=%s body=%s\n",
+				r.Method, r.URL.Path, ww.Status(), ww.BytesWritten(),
+				middleware.GetReqID(r.Context()), redactBody(captured.Bytes(), captured.truncated))
+		})
+	}
+}
+
+// SkipBodyLogging 关闭当前路由的请求体记录（如 Webhook、OAuth 回调）
+func SkipBodyLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if state, ok := r.Context().Value(bodyLogKey{}).(*bodyLogState); ok {
+			state.skip = true
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cappedBuffer 只保留前 max 个字节
+type cappedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// redactBody 将 JSON 中的敏感字段替换为 [REDACTED]；无法解析的内容只输出长度，避免原样打印
+func redactBody(raw []byte, truncated bool) string {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return "-"
+	}
+	if truncated {
+		return fmt.Sprintf("[truncated %d+ bytes]", len(raw))
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Sprintf("[non-json %d bytes]", len(raw))
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("[unloggable %d bytes]", len(raw))
+	}
+	return string(out)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, child := range vv {
+			if isSensitiveKey(k) {
+				vv[k] = "[REDACTED]"
+			} else {
+				vv[k] = redactValue(child)
+			}
+		}
+		return vv
+	case []interface{}:
+		for i, child := range vv {
+			vv[i] = redactValue(child)
+		}
+		return vv
+	default:
+		return v
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range []string{"password", "token", "secret", "authorization", "api_key", "apikey"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return k == "code" || k == "session_code"
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"tab-sync-backend-refactor/pkg/config"
+)
+
+// TrustedProxies 解析真实客户端 IP 并写回 r.RemoteAddr（替代 chi 的 RealIP，后者无条件信任转发头）：
+// 只有直连地址属于 TRUSTED_PROXIES 时才读取 X-Forwarded-For，从右向左跳过可信代理，第一个不可信的地址即客户端；
+// 没有 X-Forwarded-For 时才使用可信代理给出的 X-Real-IP。之后统一用 ClientIP(r) 读取
+func TrustedProxies(cfg *config.Config) func(http.Handler) http.Handler {
+	trusted := parseTrustedProxies(cfg.TrustedProxies)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := resolveClientIP(r, trusted); ip != "" {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP 返回请求的客户端 IP（TrustedProxies 已解析过转发头；未挂载时即直连地址）
+func ClientIP(r *http.Request) string {
+	return remoteHost(r.RemoteAddr)
+}
+
+// parseTrustedProxies 解析 CIDR 或单个 IP；格式错误的条目已在配置校验中报告，这里跳过
+func parseTrustedProxies(entries []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return nets
+}
+
+func resolveClientIP(r *http.Request, trusted []*net.IPNet) string {
+	peer := remoteHost(r.RemoteAddr)
+	if !isTrustedProxy(peer, trusted) {
+		return peer
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				// 无法解析的跳转地址：不再向左信任，取最后一个可信跳转给出的地址
+				break
+			}
+			client = hop
+			if !isTrustedProxy(hop, trusted) {
+				break
+			}
+		}
+		return client
+	}
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xri) != nil {
+		return xri
+	}
+	return peer
+}
+
+func isTrustedProxy(host string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost 去掉 RemoteAddr 中的端口（IPv6 的方括号一并去掉）
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
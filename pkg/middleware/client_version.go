@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// ClientVersionHeader 浏览器扩展在每个请求中携带自身版本（manifest version）
+const ClientVersionHeader = "X-Client-Version"
+
+// ClientVersion 拒绝版本低于 MIN_CLIENT_VERSION 的扩展请求，返回 426 CLIENT_UPGRADE_REQUIRED。
+// 未携带或无法解析版本头的请求（网页、旧式脚本、服务端回调）放行；未配置最低版本时不做检查
+func ClientVersion(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if cfg.MinClientVersion == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			version := r.Header.Get(ClientVersionHeader)
+			if cmp, ok := CompareVersions(version, cfg.MinClientVersion); ok && cmp < 0 {
+				utils.WriteAppError(w, utils.ErrClientUpgradeRequired.WithDetails(cfg.MinClientVersion))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CompareVersions 比较点分数字版本号（缺失的段视为 0，"-beta" 等后缀忽略），返回 -1/0/1；
+// 任一版本无法解析时 ok 为 false
+func CompareVersions(a, b string) (cmp int, ok bool) {
+	pa, ok := parseVersion(a)
+	if !ok {
+		return 0, false
+	}
+	pb, ok := parseVersion(b)
+	if !ok {
+		return 0, false
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y uint64
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// ValidVersion 报告 v 是否为可比较的版本号
+func ValidVersion(v string) bool {
+	_, ok := parseVersion(v)
+	return ok
+}
+
+func parseVersion(v string) ([]uint64, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return nil, false
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 4 {
+		return nil, false
+	}
+	out := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
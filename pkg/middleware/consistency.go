@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/database"
+)
+
+// ConsistencyTokenHeader 读己之写令牌：写请求的响应中下发，客户端在随后的请求中原样回传
+const ConsistencyTokenHeader = "X-Consistency-Token"
+
+// Consistency 读取请求携带的一致性令牌并放入上下文；本请求有数据库写入时在响应头下发新令牌。
+// 令牌有效期内的读取绕过只读副本（见 database.WithConsistency）
+func Consistency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := database.WithConsistency(r.Context(), r.Header.Get(ConsistencyTokenHeader))
+		next.ServeHTTP(&consistencyWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// consistencyWriter 在写出响应头之前补上令牌（写入发生在处理器内、响应之前）
+type consistencyWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	wroteHeader bool
+}
+
+func (cw *consistencyWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if token := database.ConsistencyToken(cw.ctx); token != "" {
+			cw.Header().Set(ConsistencyTokenHeader, token)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *consistencyWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap 供 http.ResponseController 与 utils 解包
+func (cw *consistencyWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Flush 透传流式响应
+func (cw *consistencyWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -8,10 +8,51 @@ import (
 	"tab-sync-backend-refactor/pkg/config"
 )
 
-// CORS 创建CORS中间件
-func CORS(cfg *config.Config) func(http.Handler) http.Handler {
-	// 配置CORS选项
-	corsOptions := cors.Options{
+// CORSPolicy 路由的跨域策略
+type CORSPolicy int
+
+const (
+	// CORSCredentialed 默认策略：仅允许 ALLOWED_ORIGINS 中的来源，并允许携带凭据（Cookie/Authorization）
+	CORSCredentialed CORSPolicy = iota
+	// CORSPublic 任意来源可读（GET/HEAD），不允许凭据；用于公开分享链接、静态回调页
+	CORSPublic
+	// CORSNone 不输出任何 CORS 头（服务端到服务端的 Webhook）
+	CORSNone
+)
+
+// CORS 按路由前缀选择跨域策略，未匹配的路由使用 CORSCredentialed；多个前缀匹配时取最长者。
+// 作为全局中间件使用（而不是挂在路由组上），这样预检请求在鉴权之前、且无论方法是否注册都能得到处理。
+func CORS(cfg *config.Config, routes map[string]CORSPolicy) func(http.Handler) http.Handler {
+	credentialed := cors.Handler(credentialedCORSOptions(cfg))
+	public := cors.Handler(publicCORSOptions())
+
+	return func(next http.Handler) http.Handler {
+		handlers := map[CORSPolicy]http.Handler{
+			CORSCredentialed: credentialed(next),
+			CORSPublic:       public(next),
+			CORSNone:         next,
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[corsPolicyFor(r.URL.Path, routes)].ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsPolicyFor 返回最长匹配前缀的策略
+func corsPolicyFor(path string, routes map[string]CORSPolicy) CORSPolicy {
+	policy, matched := CORSCredentialed, -1
+	for prefix, p := range routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > matched {
+			policy, matched = p, len(prefix)
+		}
+	}
+	return policy
+}
+
+// credentialedCORSOptions 应用 API 的跨域配置：来源来自 ALLOWED_ORIGINS；
+// 配置为 * 时（开发环境默认）浏览器不允许同时携带凭据，因此关闭 AllowCredentials
+func credentialedCORSOptions(cfg *config.Config) cors.Options {
+	options := cors.Options{
 		AllowedOrigins: cfg.AllowedOrigins,
 		AllowedMethods: []string{
 			http.MethodGet,
@@ -28,28 +69,43 @@ func CORS(cfg *config.Config) func(http.Handler) http.Handler {
 			"X-CSRF-Token",
 			"X-Requested-With",
 			"Cache-Control",
+			"If-None-Match",
+			"X-Device-ID",
+			"X-Org-ID",
+			"X-Client-Version",
+			ConsistencyTokenHeader,
 		},
 		ExposedHeaders: []string{
 			"Link",
 			"X-Total-Count",
+			"ETag",
+			"Retry-After",
+			"X-RateLimit-Limit",
+			"X-RateLimit-Remaining",
+			"X-RateLimit-Reset",
+			"X-Request-ID",
+			ConsistencyTokenHeader,
 		},
 		AllowCredentials: true,
 		MaxAge:           300, // 5分钟
 	}
-
-	// 开发环境允许所有来源
-	if cfg.IsDevelopment() {
-		corsOptions.AllowedOrigins = []string{"*"}
-		corsOptions.AllowCredentials = false // 当AllowedOrigins为*时，不能设置AllowCredentials为true
+	if len(cfg.AllowedOrigins) == 0 || contains(cfg.AllowedOrigins, "*") {
+		options.AllowedOrigins = []string{"*"}
+		options.AllowCredentials = false
 	}
+	return options
+}
 
-	// 如果配置了特定的允许来源，则使用配置的值
-	if len(cfg.AllowedOrigins) > 0 && cfg.AllowedOrigins[0] != "*" {
-		corsOptions.AllowedOrigins = cfg.AllowedOrigins
-		corsOptions.AllowCredentials = true
+// publicCORSOptions 公开只读资源的跨域配置
+func publicCORSOptions() cors.Options {
+	return cors.Options{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodHead, http.MethodOptions},
+		AllowedHeaders:   []string{"Accept", "Content-Type", "If-None-Match"},
+		ExposedHeaders:   []string{"ETag", "X-Request-ID"},
+		AllowCredentials: false,
+		MaxAge:           86400,
 	}
-
-	return cors.Handler(corsOptions)
 }
 
 // CustomCORS 自定义CORS中间件（如果需要更细粒度的控制）
@@ -67,7 +123,7 @@ func CustomCORS(cfg *config.Config) func(http.Handler) http.Handler {
 			}
 
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token, X-Requested-With, Cache-Control")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token, X-Requested-With, Cache-Control, X-Device-ID")
 			w.Header().Set("Access-Control-Expose-Headers", "Link, X-Total-Count")
 			w.Header().Set("Access-Control-Max-Age", "300")
 
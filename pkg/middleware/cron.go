@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// CronAuth 保护定时任务端点：Vercel Cron 调用时携带 "Authorization: Bearer $CRON_SECRET"。
+// 未配置 CRON_SECRET 时拒绝所有调用，避免任务端点被公开触发。
+func CronAuth(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expected := "Bearer " + cfg.CronSecret
+			got := r.Header.Get("Authorization")
+			if cfg.CronSecret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+				utils.WriteAppError(w, utils.ErrUnauthorized.WithMessage("Invalid cron secret"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
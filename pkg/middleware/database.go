@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// Database 为挂载它的路由组按需获取数据库连接（由连接池/Vercel 优化器复用），
+// 放入请求上下文供处理器通过 database.FromContext 取用；连接失败时返回 503。
+// 不访问数据库的路由（静态 OAuth 回调页等）不挂载它，也就不会触发连接。
+func Database(cfg *config.Config) func(http.Handler) http.Handler {
+	return databaseMiddleware(cfg, true)
+}
+
+// OptionalDatabase 同 Database，但连接失败时继续处理（上下文中没有数据库），
+// 供健康检查与就绪检查报告降级状态。
+func OptionalDatabase(cfg *config.Config) func(http.Handler) http.Handler {
+	return databaseMiddleware(cfg, false)
+}
+
+func databaseMiddleware(cfg *config.Config, required bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 上下文中已有数据库句柄（外层已挂载，或测试注入）时直接使用
+			if database.FromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			db, err := database.GetOptimizedDatabase(databaseConfig(cfg))
+			if err != nil {
+				fmt.Printf("❌ Database unavailable: %v\n", err)
+				if required {
+					utils.SetRetryAfter(w, utils.DefaultRetryAfter)
+					utils.WriteAppError(w, utils.ErrServiceUnavailable.Wrap(err))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(database.ContextWithDatabase(r.Context(), db)))
+		})
+	}
+}
+
+// databaseConfig 从应用配置提取数据库配置
+func databaseConfig(cfg *config.Config) database.DatabaseConfig {
+	return database.DatabaseConfig{
+		Driver:              cfg.DBDriver,
+		PostgresDSN:         cfg.PostgresDSN,
+		PostgresReadDSN:     cfg.PostgresReadDSN,
+		SupabaseURL:         cfg.SupabaseURL,
+		SupabaseReadURL:     cfg.SupabaseReadURL,
+		SupabaseKey:         cfg.SupabaseKey,
+		SnapshotCompression: cfg.SnapshotCompression,
+		Debug:               cfg.Debug,
+		HomeRegion:          cfg.HomeRegion,
+		RegionDSNs:          cfg.RegionDSNs(),
+		EncryptionMasterKey: cfg.EncryptionMasterKey,
+		Pool: database.PoolConfig{
+			MaxOpenConns:    cfg.DBMaxOpenConns,
+			MaxIdleConns:    cfg.DBMaxIdleConns,
+			ConnMaxLifetime: time.Duration(cfg.DBConnMaxLifetimeSeconds) * time.Second,
+			ConnMaxIdleTime: time.Duration(cfg.DBConnMaxIdleSeconds) * time.Second,
+		},
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/cache"
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// KillSwitchKey 共享缓存中运行时封禁列表的键（值与 BLOCKED_CLIENT_VERSIONS 格式相同）；
+// 事故期间直接在 KV 控制台写入即可生效，无需重新部署
+const KillSwitchKey = "killswitch:client_versions"
+
+// killSwitchRefresh 进程内缓存运行时列表的时长：写入 KV 后最迟在此时间后对所有实例生效
+const killSwitchRefresh = 30 * time.Second
+
+// ClientKillSwitch 拒绝被封禁版本的扩展请求（出问题的版本持续请求 API 时止血），
+// 返回 503 CLIENT_VERSION_BLOCKED 与 Retry-After，客户端应停止重试直到该时间之后。
+// 封禁列表为 BLOCKED_CLIENT_VERSIONS 与 KV 中 KillSwitchKey 的并集；条目为精确版本（1.4.2）
+// 或前缀通配（1.4.*）。未携带 X-Client-Version 的请求不受影响；读取 KV 失败时沿用上次结果
+func ClientKillSwitch(cfg *config.Config) func(http.Handler) http.Handler {
+	k := &killSwitch{static: cfg.BlockedClientVersions, store: cache.Shared(cfg)}
+	retryAfter := time.Duration(cfg.KillSwitchRetryAfter) * time.Second
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			version := strings.TrimSpace(r.Header.Get(ClientVersionHeader))
+			if version != "" && k.blocked(r.Context(), version) {
+				// 预期中的拒绝：不经 WriteAppError，避免每个请求都作为 5xx 记录日志并上报
+				e := utils.ErrClientVersionBlocked
+				utils.SetRetryAfter(w, retryAfter)
+				utils.WriteErrorResponseWithCode(w, e.Status, e.Code, e.Message, version)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type killSwitch struct {
+	static []string
+	store  cache.Store
+
+	mu        sync.Mutex
+	runtime   []string
+	fetchedAt time.Time
+}
+
+func (k *killSwitch) blocked(ctx context.Context, version string) bool {
+	for _, pattern := range k.static {
+		if versionMatches(pattern, version) {
+			return true
+		}
+	}
+	for _, pattern := range k.runtimeList(ctx) {
+		if versionMatches(pattern, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// runtimeList 返回 KV 中的封禁列表（进程内缓存 killSwitchRefresh）
+func (k *killSwitch) runtimeList(ctx context.Context) []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if time.Since(k.fetchedAt) < killSwitchRefresh {
+		return k.runtime
+	}
+	// 无论成功与否都推迟下次读取，KV 故障时不在每个请求上重试
+	k.fetchedAt = time.Now()
+	value, _, ok, err := k.store.Get(ctx, KillSwitchKey)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to read client kill switch: %v\n", err)
+		return k.runtime
+	}
+	k.runtime = nil
+	if ok {
+		k.runtime = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' })
+	}
+	return k.runtime
+}
+
+// versionMatches 精确匹配，或以 ".*" 结尾的前缀匹配（"1.4.*" 匹配 1.4 与 1.4.x）
+func versionMatches(pattern, version string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+		return version == prefix || strings.HasPrefix(version, prefix+".")
+	}
+	return pattern == version
+}
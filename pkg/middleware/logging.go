@@ -10,9 +10,11 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-// Logger 创建日志中间件
+// Logger 创建日志中间件：生产环境输出带 request_id 的结构化 JSON，其余环境使用 Chi 的默认日志（行首带请求 ID）
 func Logger(cfg *config.Config) func(http.Handler) http.Handler {
-	// 统一使用Chi的默认日志中间件
+	if cfg.IsProduction() {
+		return CustomLogger(cfg)
+	}
 	return middleware.Logger
 }
 
@@ -51,14 +53,15 @@ func CustomLogger(cfg *config.Config) func(http.Handler) http.Handler {
 
 // logProductionRequest 生产环境日志格式
 func logProductionRequest(r *http.Request, ww middleware.WrapResponseWriter, duration time.Duration, userInfo string) {
-	fmt.Printf(`{"time":"%s","method":"%s","path":"%s","status":%d,"duration":"%s","user":"%s","ip":"%s","user_agent":"%s"}`+"\n",
+	fmt.Printf(`{"time":"%s","request_id":"%s","method":"%s","path":"%s","status":%d,"duration":"%s","user":"%s","ip":"%s","user_agent":"%s"}`+"\n",
 		time.Now().Format(time.RFC3339),
+		middleware.GetReqID(r.Context()),
 		r.Method,
 		r.URL.Path,
 		ww.Status(),
 		duration,
 		userInfo,
-		getClientIP(r),
+		ClientIP(r),
 		r.UserAgent(),
 	)
 }
@@ -80,26 +83,10 @@ func logDevelopmentRequest(r *http.Request, ww middleware.WrapResponseWriter, du
 		"\033[0m",
 		duration,
 		userInfo,
-		getClientIP(r),
+		ClientIP(r),
 	)
 }
 
-// getClientIP 获取客户端IP地址
-func getClientIP(r *http.Request) string {
-	// 检查X-Forwarded-For头（代理/负载均衡器）
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
-	}
-
-	// 检查X-Real-IP头
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// 使用RemoteAddr
-	return r.RemoteAddr
-}
-
 // getStatusColor 根据HTTP状态码返回颜色代码
 func getStatusColor(status int) string {
 	switch {
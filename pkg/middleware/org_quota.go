@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/cache"
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// 组织 API 配额的路由类别：GET/HEAD 计为读，其余方法计为写
+const (
+	QuotaClassRead  = "read"
+	QuotaClassWrite = "write"
+)
+
+const (
+	// OrgQuotaHistoryDays 每日计数保留的天数（用量端点返回的历史长度）
+	OrgQuotaHistoryDays = 7
+	orgQuotaCounterTTL  = (OrgQuotaHistoryDays + 1) * 24 * time.Hour
+	orgTierTTL          = 10 * time.Minute
+)
+
+// QuotaClasses 按固定顺序列出路由类别
+var QuotaClasses = []string{QuotaClassRead, QuotaClassWrite}
+
+// OrgQuotas 组织每日请求计数与按等级的上限；计数存放在共享缓存（按 UTC 自然日的固定窗口），跨实例生效
+type OrgQuotas struct {
+	store     cache.Store
+	overrides map[models.UserTier]orgQuotaOverride
+}
+
+type orgQuotaOverride struct {
+	Read  int `json:"read"`
+	Write int `json:"write"`
+}
+
+// NewOrgQuotas 创建配额计数器；ORG_DAILY_QUOTAS 已在配置校验中检查过格式
+func NewOrgQuotas(cfg *config.Config) *OrgQuotas {
+	q := &OrgQuotas{store: cache.Shared(cfg), overrides: map[models.UserTier]orgQuotaOverride{}}
+	if cfg.OrgDailyQuotas != "" {
+		if err := json.Unmarshal([]byte(cfg.OrgDailyQuotas), &q.overrides); err != nil {
+			fmt.Printf("⚠️  ORG_DAILY_QUOTAS ignored: %v\n", err)
+		}
+	}
+	return q
+}
+
+// QuotaClass 返回请求所属的路由类别
+func QuotaClass(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return QuotaClassRead
+	}
+	return QuotaClassWrite
+}
+
+// Limit 返回等级在该类别下的每日上限，0 表示不限
+func (q *OrgQuotas) Limit(tier models.UserTier, class string) int {
+	limits := tier.Limits()
+	read, write := limits.DailyReadRequests, limits.DailyWriteRequests
+	if o, ok := q.overrides[tier]; ok {
+		read, write = o.Read, o.Write
+	}
+	if class == QuotaClassRead {
+		return read
+	}
+	return write
+}
+
+// Used 返回组织在 day（UTC 自然日）该类别下已计的请求数
+func (q *OrgQuotas) Used(ctx context.Context, orgID, class string, day time.Time) (int64, error) {
+	value, _, ok, err := q.store.Get(ctx, orgQuotaKey(orgID, class, day))
+	if err != nil || !ok {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	return n, nil
+}
+
+// OrgTier 返回计费等级：组织按所有者的有效等级计算配额，结果缓存 10 分钟
+func (q *OrgQuotas) OrgTier(ctx context.Context, db database.DatabaseInterface, orgID string) (models.UserTier, error) {
+	key := "orgquota:tier:" + orgID
+	if value, _, ok, err := q.store.Get(ctx, key); err == nil && ok {
+		return models.UserTier(value), nil
+	}
+	org, err := db.GetOrganization(orgID)
+	if err != nil {
+		return "", err
+	}
+	owner, err := db.GetUserWithSubscription(org.OwnerID)
+	if err != nil {
+		return "", err
+	}
+	tier := owner.EffectiveTier()
+	_ = q.store.Set(ctx, key, string(tier), orgTierTTL)
+	return tier, nil
+}
+
+// QuotaReset 返回 day 所在计数窗口的结束时间（下一个 UTC 零点）
+func QuotaReset(day time.Time) time.Time {
+	y, m, d := day.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+func orgQuotaKey(orgID, class string, day time.Time) string {
+	return "orgquota:" + orgID + ":" + class + ":" + day.UTC().Format("20060102")
+}
+
+// OrgQuota 按组织统计每日请求并在超出等级上限时返回 429 ORG_QUOTA_EXCEEDED，响应带 X-RateLimit-* 头。
+// 计费组织见 quotaOrgID：未指定组织的请求记在调用者的默认组织上，不能靠省略或伪造 X-Org-ID 绕过配额；
+// 须挂在 AuthMiddleware 与 Database 之后。缓存或数据库故障时放行，不因计数让请求失败
+func OrgQuota(cfg *config.Config) func(http.Handler) http.Handler {
+	quotas := NewOrgQuotas(cfg)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			db := database.FromContext(r.Context())
+			if !ok || db == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			orgID := quotas.quotaOrgID(r, db, claims)
+			if orgID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tier, err := quotas.OrgTier(r.Context(), db, orgID)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			class := QuotaClass(r.Method)
+			used, err := quotas.store.Incr(r.Context(), orgQuotaKey(orgID, class, now), orgQuotaCounterTTL)
+			limit := quotas.Limit(tier, class)
+			if err != nil || limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			reset := QuotaReset(now)
+			remaining := int64(limit) - used
+			if remaining < 0 {
+				remaining = 0
+			}
+			utils.SetRateLimitHeaders(w, utils.RateLimit{Limit: limit, Remaining: remaining, Reset: reset})
+			if used > int64(limit) {
+				utils.SetRetryAfter(w, reset.Sub(now))
+				utils.WriteAppError(w, utils.ErrOrgQuotaExceeded.WithDetails(fmt.Sprintf("%s: %d/%d", class, used, limit)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DefaultOrgID 返回用户的默认组织（见 models.DefaultOrganization），结果缓存 10 分钟；没有组织时返回空串（不缓存，首次登录引导创建组织后即生效）
+func (q *OrgQuotas) DefaultOrgID(ctx context.Context, db database.DatabaseInterface, userID string) (string, error) {
+	key := "orgquota:default:" + userID
+	if value, _, ok, err := q.store.Get(ctx, key); err == nil && ok {
+		return value, nil
+	}
+	orgs, err := db.ListUserOrganizations(userID)
+	if err != nil {
+		return "", err
+	}
+	o := models.DefaultOrganization(orgs, userID)
+	if o == nil {
+		return "", nil
+	}
+	_ = q.store.Set(ctx, key, o.ID, orgTierTTL)
+	return o.ID, nil
+}
+
+// quotaOrgID 计费组织：X-Org-ID 头或 org_id 查询参数指定、且在访问令牌组织声明中的组织（避免替其他组织消耗配额）；
+// 未指定或不在声明中时为调用者的默认组织。没有组织或查询失败时返回空串（不计数）
+func (q *OrgQuotas) quotaOrgID(r *http.Request, db database.DatabaseInterface, claims *models.TokenClaims) string {
+	if orgID := requestOrgID(r); orgID != "" && contains(claims.Orgs, orgID) {
+		return orgID
+	}
+	orgID, err := q.DefaultOrgID(r.Context(), db, claims.UserID)
+	if err != nil {
+		return ""
+	}
+	return orgID
+}
+
+// requestOrgID 读取请求针对的组织（X-Org-ID 头优先）
+func requestOrgID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get("X-Org-ID")); id != "" {
+		return id
+	}
+	return strings.TrimSpace(r.URL.Query().Get("org_id"))
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/cache"
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// fakeQuotaOrgsDB u1 是 owned（较晚创建）的所有者，同时是 joined（较早创建）的成员
+type fakeQuotaOrgsDB struct {
+	database.DatabaseInterface
+}
+
+func (db *fakeQuotaOrgsDB) ListUserOrganizations(userID string) ([]models.Organization, error) {
+	now := time.Now()
+	return []models.Organization{
+		{ID: "joined", OwnerID: "u2", CreatedAt: now.Add(-time.Hour)},
+		{ID: "owned", OwnerID: userID, CreatedAt: now},
+	}, nil
+}
+
+func TestQuotaOrgID(t *testing.T) {
+	claims := &models.TokenClaims{UserID: "u1", Orgs: []string{"owned", "joined"}}
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   string
+	}{
+		{"header in claims", "joined", "", "joined"},
+		{"query in claims", "", "org_id=joined", "joined"},
+		{"no org falls back to default", "", "", "owned"},
+		{"org outside claims falls back to default", "someone-else", "", "owned"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &OrgQuotas{store: cache.NewMemoryStore()}
+			r := httptest.NewRequest(http.MethodGet, "/api/collections?"+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set("X-Org-ID", tt.header)
+			}
+			if got := q.quotaOrgID(r, &fakeQuotaOrgsDB{}, claims); got != tt.want {
+				t.Errorf("quotaOrgID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
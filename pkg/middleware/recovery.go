@@ -6,35 +6,51 @@ import (
 	"runtime/debug"
 
 	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/reporting"
 	"tab-sync-backend-refactor/pkg/utils"
+
+	"github.com/go-chi/chi/v5/middleware"
 )
 
-// Recovery 恢复中间件，处理panic并返回友好的错误信息
+// Recovery 恢复中间件：处理 panic 并返回 JSON 错误信封（error.request_id 与 X-Request-ID 相同），
+// 日志带 request_id 与堆栈。须注册在 RequestID 之后、ErrorReporting 之前：ErrorReporting 已上报的 panic
+// 以 reportedPanic 重新抛出，其余（外层中间件中的）panic 在这里上报，避免重复上报
 func Recovery(cfg *config.Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
-				if err := recover(); err != nil {
-					// 记录panic信息
-					stack := debug.Stack()
-					
-					if cfg.IsDevelopment() {
-						// 开发环境：显示详细错误信息
-						fmt.Printf("❌ PANIC: %v\n", err)
-						fmt.Printf("📍 Stack trace:\n%s\n", stack)
-						
-						utils.WriteErrorResponseWithCode(w, http.StatusInternalServerError, 
-							"INTERNAL_SERVER_ERROR", 
-							fmt.Sprintf("Internal server error: %v", err),
-							string(stack))
-					} else {
-						// 生产环境：隐藏详细错误信息
-						fmt.Printf("❌ PANIC: %v\n", err)
-						fmt.Printf("📍 Stack trace:\n%s\n", stack)
-						
-						utils.WriteInternalServerErrorResponse(w, "Internal server error occurred")
-					}
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					// 由 net/http 处理的中止信号，不是程序错误
+					panic(rec)
+				}
+				value, reported := rec, false
+				if p, ok := rec.(reportedPanic); ok {
+					value, reported = p.value, true
 				}
+				if !reported {
+					reporting.CapturePanic(r, value)
+				}
+
+				stack := debug.Stack()
+				fmt.Printf("❌ PANIC request_id=%s: %v\n", middleware.GetReqID(r.Context()), value)
+				fmt.Printf("📍 Stack trace:\n%s\n", stack)
+				if r.Header.Get("Connection") == "Upgrade" {
+					return
+				}
+				if cfg.IsDevelopment() {
+					// 开发环境：显示详细错误信息
+					utils.WriteErrorResponseWithCode(w, http.StatusInternalServerError,
+						"INTERNAL_SERVER_ERROR",
+						fmt.Sprintf("Internal server error: %v", value),
+						string(stack))
+					return
+				}
+				// 生产环境：隐藏详细错误信息
+				utils.WriteAppError(w, utils.ErrInternal)
 			}()
 
 			next.ServeHTTP(w, r)
@@ -42,6 +58,11 @@ func Recovery(cfg *config.Config) func(http.Handler) http.Handler {
 	}
 }
 
+// reportedPanic 包装已由 ErrorReporting 上报过的 panic 值
+type reportedPanic struct {
+	value interface{}
+}
+
 // ErrorHandler 统一错误处理中间件
 func ErrorHandler(cfg *config.Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
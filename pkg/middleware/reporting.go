@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/reporting"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// ErrorReporting 将 panic 与 5xx 错误上报到 Sentry（未配置 SENTRY_DSN 时直接透传）。
+// 需注册在 Recovery 之后：捕获并上报 panic 后以 reportedPanic 重新抛出，由 Recovery 负责响应（不再重复上报）。
+func ErrorReporting(cfg *config.Config) func(http.Handler) http.Handler {
+	reporting.Init(cfg.SentryDSN, cfg.Environment, cfg.SentryRelease)
+	return func(next http.Handler) http.Handler {
+		if !reporting.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, scope := reporting.WithScope(r.Context())
+			if reqID := middleware.GetReqID(ctx); reqID != "" {
+				scope.SetTag("request_id", reqID)
+			}
+			r = r.WithContext(ctx)
+
+			defer func() {
+				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					if _, ok := rec.(reportedPanic); !ok {
+						reporting.CapturePanic(r, rec)
+						rec = reportedPanic{value: rec}
+					}
+					panic(rec)
+				}
+			}()
+
+			next.ServeHTTP(&reportingWriter{ResponseWriter: w, r: r}, r)
+		})
+	}
+}
+
+// reportingWriter 让 utils 中的 5xx 写入函数可以拿到当前请求并上报错误
+type reportingWriter struct {
+	http.ResponseWriter
+	r *http.Request
+}
+
+// ReportError 实现 utils.ErrorReporter
+func (rw *reportingWriter) ReportError(err error) {
+	reporting.CaptureError(rw.r, err)
+}
+
+// Unwrap 供 http.ResponseController 与 utils 解包
+func (rw *reportingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush 透传流式响应
+func (rw *reportingWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
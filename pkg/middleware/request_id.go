@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// maxRequestIDLength 沿用入站请求 ID 的最大长度
+const maxRequestIDLength = 64
+
+// RequestID 为每个请求分配请求 ID 并通过 X-Request-ID 响应头返回；错误响应体的 error.request_id 与日志使用同一个值，
+// 用户反馈问题时可直接引用。生成与上下文键复用 chi 的 RequestID（middleware.GetReqID 照常可用）；
+// 上游代理或客户端传入的 X-Request-Id 只在由字母、数字与 -_.:/ 组成且不超过 64 个字符时沿用，避免污染日志
+func RequestID(next http.Handler) http.Handler {
+	withHeader := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(utils.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.Header.Get(middleware.RequestIDHeader); id != "" && !validRequestID(id) {
+			r.Header.Del(middleware.RequestIDHeader)
+		}
+		withHeader.ServeHTTP(w, r)
+	})
+}
+
+func validRequestID(id string) bool {
+	if len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/utils"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Timeout 为请求设置总时限 total，并从中预留 reserve 用于写出错误响应：
+// 请求上下文的截止时间为 total-reserve，数据库、Supabase、OAuth 等出站调用都从该上下文派生，
+// 超时后处理器仍有时间返回 JSON 错误，而不是被平台在 maxDuration 处切断成空白 504。
+// 处理器因超时没有写出任何响应时，补写 504 TIMEOUT。
+func Timeout(total, reserve time.Duration) func(http.Handler) http.Handler {
+	budget := total - reserve
+	if budget <= 0 {
+		budget = total
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), budget)
+			defer cancel()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && ww.Status() == 0 && ww.BytesWritten() == 0 {
+				utils.WriteAppError(w, utils.ErrTimeout.Wrap(ctx.Err()))
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// tokenVersionTTL 进程内缓存 users.token_version 的时长：变更最迟在此时间后对已签发的访问令牌生效
+const tokenVersionTTL = 30 * time.Second
+
+type cachedTokenVersion struct {
+	version   int
+	fetchedAt time.Time
+}
+
+var tokenVersions sync.Map // userID -> cachedTokenVersion
+
+// ClaimsFromContext 返回 AuthMiddleware 解析出的访问令牌声明
+func ClaimsFromContext(ctx context.Context) (*models.TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*models.TokenClaims)
+	return claims, ok
+}
+
+// TokenVersion 拒绝令牌版本落后于 users.token_version 的访问令牌（等级、终身会员或组织成员关系变化后由触发器递增），
+// 返回 TOKEN_REFRESH_REQUIRED，客户端用刷新令牌换取带新声明的访问令牌。须挂在 AuthMiddleware 与 Database 之后；
+// 版本读取失败时放行，不因缓存查询让请求失败
+func TokenVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		current, ok := currentTokenVersion(r.Context(), claims.UserID, claims.Ver)
+		if ok && claims.Ver < current {
+			utils.WriteAppError(w, utils.ErrTokenRefreshRequired)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentTokenVersion 优先使用缓存；令牌版本比缓存新（刚刷新过）时说明缓存已过时，重新读取
+func currentTokenVersion(ctx context.Context, userID string, seen int) (int, bool) {
+	if v, ok := tokenVersions.Load(userID); ok {
+		c := v.(cachedTokenVersion)
+		if time.Since(c.fetchedAt) < tokenVersionTTL && seen <= c.version {
+			return c.version, true
+		}
+	}
+	db := database.FromContext(ctx)
+	if db == nil {
+		return 0, false
+	}
+	version, err := db.GetTokenVersion(userID)
+	if err != nil {
+		return 0, false
+	}
+	tokenVersions.Store(userID, cachedTokenVersion{version: version, fetchedAt: time.Now()})
+	return version, true
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/tracing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Tracing 为每个请求创建服务端根 Span（未配置 OTEL_EXPORTER_OTLP_ENDPOINT 时直接透传）。
+// 应作为第一个全局中间件，使 middleware.Database 放入上下文的数据库句柄绑定到带 Span 的上下文；
+// 路由完成后以路由模板（如 /api/snapshots/{name}）命名 Span（独立使用时会预先放入 RouteContext）。
+func Tracing(cfg *config.Config) func(http.Handler) http.Handler {
+	tracing.Init(tracing.Options{
+		Endpoint:    cfg.OTLPEndpoint,
+		Headers:     tracing.ParseHeaders(cfg.OTLPHeaders),
+		SampleRate:  cfg.TraceSampleRate,
+		Environment: cfg.Environment,
+	})
+	return func(next http.Handler) http.Handler {
+		if !tracing.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Extract(r.Context(), r.Header)
+			ctx, span := tracing.StartSpan(ctx, r.Method+" "+r.URL.Path, tracing.KindServer)
+			if span == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			defer span.End()
+
+			rctx := chi.RouteContext(ctx)
+			if rctx == nil {
+				rctx = chi.NewRouteContext()
+				ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+			}
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.target", r.URL.Path)
+			w.Header().Set("traceparent", span.TraceParent())
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				span.SetName(r.Method + " " + pattern)
+				span.SetAttribute("http.route", pattern)
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttribute("http.status_code", status)
+			if status >= 500 {
+				span.RecordError(fmt.Errorf("status %d", status))
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"io"
 	"net/http"
 	"strings"
 
@@ -10,17 +11,12 @@ import (
 // ContentTypeJSON 验证请求Content-Type为application/json
 func ContentTypeJSON(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// 只对POST、PUT、PATCH请求验证Content-Type
-		if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		// 只对带请求体的POST、PUT、PATCH请求验证Content-Type（如无请求体的 /logout）
+		if (r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch) && r.ContentLength != 0 {
+			// 缺少或不是 application/json（忽略charset等参数）时返回 415
 			contentType := r.Header.Get("Content-Type")
-			if contentType == "" {
-				utils.WriteBadRequestResponse(w, "Content-Type header is required")
-				return
-			}
-
-			// 检查是否为application/json（忽略charset等参数）
 			if !strings.HasPrefix(strings.ToLower(contentType), "application/json") {
-				utils.WriteBadRequestResponse(w, "Content-Type must be application/json")
+				utils.WriteAppError(w, utils.ErrUnsupportedMedia)
 				return
 			}
 		}
@@ -29,17 +25,31 @@ func ContentTypeJSON(next http.Handler) http.Handler {
 	})
 }
 
-// MaxBodySize 限制请求体大小
+// MaxBodySize 限制请求体大小；超出时读取返回 *http.MaxBytesError（处理器据此返回 413）。
+// 嵌套使用时内层上限替换外层，路由可以放宽或收紧分组的默认上限。
 func MaxBodySize(maxBytes int64) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 限制请求体大小
-			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			orig := r.Body
+			if lb, ok := r.Body.(*limitedBody); ok {
+				orig = lb.orig
+			}
+			r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, orig, maxBytes), orig: orig}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// limitedBody 记录未受限的原始请求体，供内层 MaxBodySize 替换上限
+type limitedBody struct {
+	io.ReadCloser
+	orig io.ReadCloser
+}
+
 // RequireUserAgent 要求User-Agent头
 func RequireUserAgent(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"tab-sync-backend-refactor/pkg/utils"
+)
+
+// readBody 读取完整请求体；超出 MaxBodySize 时与 handlers.writeBodyError 一样返回 413
+func readBody(w http.ResponseWriter, r *http.Request) {
+	if _, err := io.ReadAll(r.Body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteAppError(w, utils.ErrPayloadTooLarge)
+			return
+		}
+		utils.WriteBadRequestResponse(w, "Invalid body")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func postBody(h http.Handler, path string, n int) int {
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(make([]byte, n)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h := MaxBodySize(100)(http.HandlerFunc(readBody))
+	tests := []struct {
+		size int
+		want int
+	}{
+		{0, http.StatusNoContent},
+		{100, http.StatusNoContent},
+		{101, http.StatusRequestEntityTooLarge},
+		{10 << 10, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		if got := postBody(h, "/", tt.size); got != tt.want {
+			t.Errorf("%d byte body: status = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+// 与 api/index.go 相同的挂载方式：分组默认上限，单个路由用 With 覆盖，子路由组用 Use 覆盖
+func TestMaxBodySizeRouteOverrides(t *testing.T) {
+	const (
+		defaultLimit  = 1 << 10
+		importLimit   = 10 << 10
+		snapshotLimit = 4 << 10
+	)
+	r := chi.NewRouter()
+	r.Use(MaxBodySize(defaultLimit))
+	r.Post("/items", readBody)
+	r.With(MaxBodySize(importLimit)).Post("/import", readBody)
+	r.Route("/snapshots", func(r chi.Router) {
+		r.Use(MaxBodySize(snapshotLimit))
+		r.Post("/", readBody)
+	})
+	r.With(MaxBodySize(defaultLimit / 2)).Post("/small", readBody)
+
+	tests := []struct {
+		path string
+		size int
+		want int
+	}{
+		{"/items", defaultLimit, http.StatusNoContent},
+		{"/items", defaultLimit + 1, http.StatusRequestEntityTooLarge},
+		{"/import", importLimit, http.StatusNoContent},
+		{"/import", importLimit + 1, http.StatusRequestEntityTooLarge},
+		{"/snapshots/", snapshotLimit, http.StatusNoContent},
+		{"/snapshots/", snapshotLimit + 1, http.StatusRequestEntityTooLarge},
+		// 内层上限同样可以收紧
+		{"/small", defaultLimit/2 + 1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		if got := postBody(r, tt.path, tt.size); got != tt.want {
+			t.Errorf("POST %s with %d bytes: status = %d, want %d", tt.path, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestContentTypeJSON(t *testing.T) {
+	h := ContentTypeJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json", http.MethodPost, "application/json", "{}", http.StatusNoContent},
+		{"json with charset", http.MethodPut, "Application/JSON; charset=utf-8", "{}", http.StatusNoContent},
+		{"form", http.MethodPost, "application/x-www-form-urlencoded", "a=1", http.StatusUnsupportedMediaType},
+		{"text", http.MethodPatch, "text/plain", "{}", http.StatusUnsupportedMediaType},
+		{"missing", http.MethodPost, "", "{}", http.StatusUnsupportedMediaType},
+		{"post without body", http.MethodPost, "", "", http.StatusNoContent},
+		{"get", http.MethodGet, "text/plain", "x", http.StatusNoContent},
+		{"delete", http.MethodDelete, "", "x", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", bytes.NewReader([]byte(tt.body)))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want == http.StatusUnsupportedMediaType && !bytes.Contains(w.Body.Bytes(), []byte("UNSUPPORTED_MEDIA_TYPE")) {
+				t.Errorf("body = %s, want UNSUPPORTED_MEDIA_TYPE", w.Body.String())
+			}
+		})
+	}
+}
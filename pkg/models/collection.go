@@ -1,6 +1,12 @@
 package models
 
-import "time"
+import (
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
 
 // Collection represents a group of saved tabs/items under a Space
 type Collection struct {
@@ -11,7 +17,106 @@ type Collection struct {
     Color       string    `json:"color,omitempty" db:"color"`
     Icon        string    `json:"icon,omitempty" db:"icon"`
     Position    int       `json:"position" db:"position"`
+    // Type is CollectionTypeManual or CollectionTypeSmart; smart collections hold no items of
+    // their own and list the space's items matching Query, evaluated on every read
+    Type        string      `json:"type" db:"type"`
+    Query       *SmartQuery `json:"query,omitempty" db:"query"`
+    // ItemCount / LastItemAddedAt 由数据库触发器维护的未删除条目数与最近加入时间（只读）
+    ItemCount       int        `json:"item_count" db:"item_count"`
+    LastItemAddedAt *time.Time `json:"last_item_added_at,omitempty" db:"last_item_added_at"`
     CreatedAt   time.Time `json:"created_at" db:"created_at"`
     UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
     DeletedAt   *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
+
+// Collection types
+const (
+    CollectionTypeManual = "manual"
+    CollectionTypeSmart  = "smart"
+)
+
+// IsSmart reports whether the collection is defined by a stored query
+func (c *Collection) IsSmart() bool {
+    return c.Type == CollectionTypeSmart
+}
+
+// SmartQuery is the stored definition of a smart collection. All set conditions must
+// match; it is evaluated against the active (not archived, not deleted) items of the
+// collection's space.
+type SmartQuery struct {
+    // Domain matches the item domain (case-insensitive), including its subdomains
+    Domain string `json:"domain,omitempty"`
+    // Tag matches items whose metadata.tags array contains the tag (case-insensitive)
+    Tag string `json:"tag,omitempty"`
+    // AddedWithin matches items created within the window: "7d", "12h" or any Go duration
+    AddedWithin string `json:"added_within,omitempty"`
+}
+
+// Validate normalizes the query and checks that at least one condition is set
+func (q *SmartQuery) Validate() error {
+    q.Domain = strings.ToLower(strings.TrimSpace(q.Domain))
+    q.Tag = strings.TrimSpace(q.Tag)
+    q.AddedWithin = strings.TrimSpace(q.AddedWithin)
+    if q.Domain == "" && q.Tag == "" && q.AddedWithin == "" {
+        return fmt.Errorf("query needs at least one of domain, tag or added_within")
+    }
+    if q.AddedWithin != "" {
+        if _, err := q.window(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// window parses AddedWithin; day suffixes are accepted in addition to Go durations
+func (q *SmartQuery) window() (time.Duration, error) {
+    v := q.AddedWithin
+    var d time.Duration
+    var err error
+    if days := strings.TrimSuffix(v, "d"); days != v {
+        var n int
+        n, err = strconv.Atoi(days)
+        d = time.Duration(n) * 24 * time.Hour
+    } else {
+        d, err = time.ParseDuration(v)
+    }
+    if err != nil || d <= 0 {
+        return 0, fmt.Errorf("added_within must be a positive duration such as 7d or 12h")
+    }
+    return d, nil
+}
+
+// Matches reports whether the item satisfies every condition of the query at now
+func (q *SmartQuery) Matches(it *CollectionItem, now time.Time) bool {
+    if q.Domain != "" {
+        domain := strings.ToLower(it.Domain)
+        if domain != q.Domain && !strings.HasSuffix(domain, "."+q.Domain) {
+            return false
+        }
+    }
+    if q.Tag != "" && !itemHasTag(it, q.Tag) {
+        return false
+    }
+    if q.AddedWithin != "" {
+        d, err := q.window()
+        if err != nil || it.CreatedAt.Before(now.Add(-d)) {
+            return false
+        }
+    }
+    return true
+}
+
+func itemHasTag(it *CollectionItem, tag string) bool {
+    var meta struct {
+        Tags []string `json:"tags"`
+    }
+    if json.Unmarshal(it.Metadata, &meta) != nil {
+        return false
+    }
+    for _, t := range meta.Tags {
+        if strings.EqualFold(strings.TrimSpace(t), tag) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Device is a browser extension install that syncs with the account; the
+// account page lists devices by last_seen and lets users revoke stale ones
+type Device struct {
+	ID             string     `json:"id" db:"id"`
+	UserID         string     `json:"user_id" db:"user_id"`
+	InstallID      string     `json:"install_id" db:"install_id"` // generated by the extension on install
+	Name           string     `json:"name,omitempty" db:"name"`   // user-facing label, e.g. "laptop"
+	Browser        string     `json:"browser,omitempty" db:"browser"`
+	Platform       string     `json:"platform,omitempty" db:"platform"`
+	LastSeen       time.Time  `json:"last_seen" db:"last_seen"`
+	LastSyncCursor *string    `json:"last_sync_cursor,omitempty" db:"last_sync_cursor"` // opaque, reported by the extension after each sync
+	RevokedAt      *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	LastIP         string     `json:"last_ip,omitempty" db:"last_ip"` // address the device last registered from
+	GeoLocation               // location of LastIP
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// DevicePushStatus is the delivery state of a "send to device" push
+type DevicePushStatus string
+
+const (
+	DevicePushPending   DevicePushStatus = "pending"   // queued, target has not polled yet
+	DevicePushDelivered DevicePushStatus = "delivered" // returned to the target extension
+	DevicePushOpened    DevicePushStatus = "opened"    // target opened the tabs
+	DevicePushDismissed DevicePushStatus = "dismissed" // target user declined
+)
+
+// DevicePush is a set of URLs sent from one device to another of the same user
+type DevicePush struct {
+	ID             string           `json:"id" db:"id"`
+	UserID         string           `json:"user_id" db:"user_id"`
+	SourceDeviceID *string          `json:"source_device_id,omitempty" db:"source_device_id"`
+	TargetDeviceID string           `json:"target_device_id" db:"target_device_id"`
+	URLs           []string         `json:"urls" db:"urls"`
+	Status         DevicePushStatus `json:"status" db:"status"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty" db:"delivered_at"`
+	CompletedAt    *time.Time       `json:"completed_at,omitempty" db:"completed_at"` // opened or dismissed
+	CreatedAt      time.Time        `json:"created_at" db:"created_at"`
+}
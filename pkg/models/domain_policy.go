@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// DomainPolicyAction is what happens when a saved URL matches a domain policy
+type DomainPolicyAction string
+
+const (
+	DomainPolicyBlock DomainPolicyAction = "block" // the save is rejected with POLICY_BLOCKED
+	DomainPolicyWarn  DomainPolicyAction = "warn"  // the save goes through and the response carries a warning
+)
+
+// DomainPolicy is an org-level content rule. Domain matches the URL host and
+// all of its subdomains.
+type DomainPolicy struct {
+	OrganizationID string             `json:"organization_id" db:"organization_id"`
+	Domain         string             `json:"domain" db:"domain"`
+	Action         DomainPolicyAction `json:"action" db:"action"`
+	CreatedBy      string             `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt      time.Time          `json:"created_at" db:"created_at"`
+}
+
+// PolicyViolation is an audit record of a save that matched a domain policy.
+// Only the host is kept: the full URL may belong to an encrypted organization.
+type PolicyViolation struct {
+	ID             string             `json:"id" db:"id"`
+	OrganizationID string             `json:"organization_id" db:"organization_id"`
+	UserID         string             `json:"user_id" db:"user_id"`
+	Domain         string             `json:"domain" db:"domain"` // the matching policy domain
+	Host           string             `json:"host" db:"host"`
+	Action         DomainPolicyAction `json:"action" db:"action"`
+	Source         string             `json:"source" db:"source"` // create, batch, update, quick_save or history_import
+	CreatedAt      time.Time          `json:"created_at" db:"created_at"`
+}
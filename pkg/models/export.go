@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ExportStatus is the lifecycle state of a data export
+type ExportStatus string
+
+const (
+	ExportPending    ExportStatus = "pending"
+	ExportProcessing ExportStatus = "processing"
+	ExportReady      ExportStatus = "ready"
+	ExportFailed     ExportStatus = "failed"
+	ExportExpired    ExportStatus = "expired" // archive purged after ExpiresAt
+)
+
+// DataExport is a user's GDPR data export request; the archive itself is
+// loaded separately (see DatabaseInterface.GetDataExportArchive)
+type DataExport struct {
+	ID          string       `json:"id" db:"id"`
+	UserID      string       `json:"user_id" db:"user_id"`
+	Status      ExportStatus `json:"status" db:"status"`
+	SizeBytes   *int64       `json:"size_bytes,omitempty" db:"size_bytes"`
+	Error       *string      `json:"error,omitempty" db:"error"`
+	StartedAt   *time.Time   `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+}
+
+// Active reports whether the export is still queued or being built
+func (e *DataExport) Active() bool {
+	return e.Status == ExportPending || e.Status == ExportProcessing
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// HistoryImport is a multi-batch browser history import into one space. The
+// extension pages through its history and posts numbered batches; entries
+// land in one collection per local visit date. Progress counters are summed
+// from the recorded batches, so re-sending a batch is a no-op.
+type HistoryImport struct {
+	ID               string     `json:"id" db:"id"`
+	UserID           string     `json:"user_id" db:"user_id"`
+	SpaceID          string     `json:"space_id" db:"space_id"`
+	UTCOffsetMinutes int        `json:"utc_offset_minutes" db:"utc_offset_minutes"` // offset used to pick each entry's date
+	TotalEntries     int        `json:"total_entries" db:"total_entries"`           // declared by the client, 0 if unknown
+	ReceivedBatches  []int      `json:"received_batches" db:"-"`                    // batch indexes recorded so far, ascending
+	Received         int        `json:"received" db:"-"`
+	Imported         int        `json:"imported" db:"-"`
+	Duplicates       int        `json:"duplicates" db:"-"`
+	Skipped          int        `json:"skipped" db:"-"` // invalid or non-http(s) entries
+	Blocked          int        `json:"blocked" db:"-"` // rejected by an org domain policy
+	CompletedAt      *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// HistoryImportBatch is the outcome of one processed batch
+type HistoryImportBatch struct {
+	ImportID   string `json:"import_id" db:"import_id"`
+	Index      int    `json:"batch_index" db:"batch_index"`
+	Received   int    `json:"received" db:"received"`
+	Imported   int    `json:"imported" db:"imported"`
+	Duplicates int    `json:"duplicates" db:"duplicates"`
+	Skipped    int    `json:"skipped" db:"skipped"`
+	Blocked    int    `json:"blocked" db:"blocked"`
+}
+
+// HasBatch reports whether batch index has already been recorded
+func (h *HistoryImport) HasBatch(index int) bool {
+	for _, b := range h.ReceivedBatches {
+		if b == index {
+			return true
+		}
+	}
+	return false
+}
@@ -15,9 +15,10 @@ const (
 type OrganizationInvitation struct {
     ID             string            `json:"id" db:"id"`
     OrganizationID string            `json:"organization_id" db:"organization_id"`
-    Email          string            `json:"email" db:"email"`
+    Email          string            `json:"email,omitempty" db:"email"` // 按 user_id 邀请时不返回给邀请人
+    InviteeID      *string           `json:"invitee_id,omitempty" db:"invitee_id"` // 按用户 ID 邀请（或邀请时邮箱已注册）时为被邀请用户
     InviterID      string            `json:"inviter_id" db:"inviter_id"`
-    Token          string            `json:"token" db:"token"`
+    Token          string            `json:"token,omitempty" db:"token"` // 只在创建时返回；库中只存摘要
     Status         InvitationStatus  `json:"status" db:"status"`
     ExpiresAt      time.Time         `json:"expires_at" db:"expires_at"`
     AcceptedBy     *string           `json:"accepted_by,omitempty" db:"accepted_by"`
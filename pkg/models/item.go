@@ -16,6 +16,24 @@ type CollectionItem struct {
     Position        int        `json:"position" db:"position"`
     CreatedAt       time.Time  `json:"created_at" db:"created_at"`
     UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+    // ArchivedAt is set when the user marks the item as done; archived items stay in the
+    // collection but are left out of the default item list that clients sync.
+    ArchivedAt      *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+    // SnoozedUntil hides the item from inbox triage until the given time; it stays in
+    // regular collection lists.
+    SnoozedUntil    *time.Time `json:"snoozed_until,omitempty" db:"snoozed_until"`
     DeletedAt       *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
+// Item archive states accepted by item list filters
+const (
+    ItemStateActive   = "active"
+    ItemStateArchived = "archived"
+    ItemStateAll      = "all"
+)
+
+// ValidItemState reports whether state is a known item list filter
+func ValidItemState(state string) bool {
+    return state == ItemStateActive || state == ItemStateArchived || state == ItemStateAll
+}
+
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ItemEnrichment is a queued request to fill in an item's page title, favicon and
+// description after a quick save, which stores only what the user typed. The queue
+// holds item ids only, so it reveals nothing about encrypted organizations' items.
+type ItemEnrichment struct {
+	ItemID    string     `json:"item_id" db:"item_id"`
+	Attempts  int        `json:"attempts" db:"attempts"`
+	ClaimedAt *time.Time `json:"claimed_at,omitempty" db:"claimed_at"` // set while a cron run is fetching the page
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
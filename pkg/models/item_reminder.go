@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ItemReminder asks for a follow-up on a saved item at RemindAt. Reminders are
+// per user (items in shared spaces can carry a reminder for each member) and are
+// stored in the home database with ids only, whatever region the item lives in.
+type ItemReminder struct {
+	ItemID     string     `json:"item_id" db:"item_id"`
+	UserID     string     `json:"user_id" db:"user_id"`
+	RemindAt   time.Time  `json:"remind_at" db:"remind_at"`
+	Email      bool       `json:"email" db:"email"`                       // also send an email when due
+	NotifiedAt *time.Time `json:"notified_at,omitempty" db:"notified_at"` // set once the reminder fired
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ItemRevision is a prior version of a collection item's title, url and metadata,
+// recorded by a database trigger whenever one of them changes. Reverting to a
+// revision is itself an update, so it records the replaced values as a new revision.
+type ItemRevision struct {
+	ID           string          `json:"id" db:"id"`
+	ItemID       string          `json:"item_id" db:"item_id"`
+	CollectionID string          `json:"collection_id" db:"collection_id"` // collection the item was in at the time
+	Title        string          `json:"title" db:"title"`
+	URL          string          `json:"url,omitempty" db:"url"`
+	Metadata     json.RawMessage `json:"metadata,omitempty" db:"metadata"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"` // when these values were replaced
+}
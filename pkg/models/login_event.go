@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// GeoLocation is the approximate location of an IP address (see pkg/geoip);
+// empty when GeoIP is not configured or the address is not public
+type GeoLocation struct {
+	Country string `json:"country,omitempty" db:"country"` // ISO 3166-1 alpha-2
+	Region  string `json:"region,omitempty" db:"region"`
+	City    string `json:"city,omitempty" db:"city"`
+}
+
+// Login methods recorded in login_events
+const (
+	LoginMethodGoogle      = "google"
+	LoginMethodGitHub      = "github"
+	LoginMethodSessionCode = "session_code" // pricing page session exchange
+)
+
+// LoginEvent is one successful sign-in; the account security page lists
+// them with their location so users can spot logins they do not recognise
+type LoginEvent struct {
+	ID        string `json:"id" db:"id"`
+	UserID    string `json:"user_id" db:"user_id"`
+	Method    string `json:"method" db:"method"`
+	IP        string `json:"ip" db:"ip"`
+	UserAgent string `json:"user_agent,omitempty" db:"user_agent"`
+	GeoLocation
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
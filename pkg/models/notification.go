@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Notification is an in-app notification shown in the extension/web inbox
+type Notification struct {
+	ID        string                 `json:"id" db:"id"`
+	UserID    string                 `json:"user_id" db:"user_id"`
+	Kind      string                 `json:"kind" db:"kind"`
+	Title     string                 `json:"title" db:"title"`
+	Body      string                 `json:"body" db:"body"`
+	Data      map[string]interface{} `json:"data,omitempty" db:"data"`
+	DedupeKey *string                `json:"-" db:"dedupe_key"` // at most one notification per user and key
+	ReadAt    *time.Time             `json:"read_at,omitempty" db:"read_at"`
+	CreatedAt time.Time              `json:"created_at" db:"created_at"`
+}
+
+// NotificationPreferences are per-user delivery settings; users without a
+// stored row get DefaultNotificationPreferences
+type NotificationPreferences struct {
+	UserID       string     `json:"user_id" db:"user_id"`
+	WeeklyDigest bool       `json:"weekly_digest" db:"weekly_digest"`
+	LastDigestAt *time.Time `json:"last_digest_at,omitempty" db:"last_digest_at"`
+}
+
+// DefaultNotificationPreferences returns the settings of a user who never changed them
+func DefaultNotificationPreferences(userID string) *NotificationPreferences {
+	return &NotificationPreferences{UserID: userID, WeeklyDigest: true}
+}
+
+// DigestItem is a saved tab listed in the weekly digest
+type DigestItem struct {
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	Collection string `json:"collection"`
+}
+
+// DigestSpace is a space newly shared with the user
+type DigestSpace struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Organization string `json:"organization"`
+}
+
+// ActivityDigest summarizes what happened in the user's organizations since a point in time
+type ActivityDigest struct {
+	Since          time.Time     `json:"since"`
+	NewItemsCount  int           `json:"new_items_count"`
+	RecentItems    []DigestItem  `json:"recent_items"`
+	SharedSpaces   []DigestSpace `json:"shared_spaces"`
+	DeadLinksCount int           `json:"dead_links_count"`
+	DeadLinks      []DigestItem  `json:"dead_links"`
+}
+
+// Empty reports whether there is nothing worth emailing
+func (d *ActivityDigest) Empty() bool {
+	return d.NewItemsCount == 0 && len(d.SharedSpaces) == 0 && d.DeadLinksCount == 0
+}
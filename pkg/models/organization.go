@@ -6,21 +6,46 @@ import "time"
 type Organization struct {
     ID        string    `json:"id" db:"id"`
     Name      string    `json:"name" db:"name"`
+    // URL-safe unique handle (lowercase a-z, 0-9, '-') used by vanity links such as /o/acme
+    Slug      string    `json:"slug,omitempty" db:"slug"`
     OwnerID   string    `json:"owner_id" db:"owner_id"`
     Description string  `json:"description,omitempty" db:"description"`
     Avatar    string    `json:"avatar,omitempty" db:"avatar"`
     // UI theme color (hex or named id). Stored as short text in DB.
     Color     string    `json:"color,omitempty" db:"color"`
+    // Data residency region ("us"/"eu"); empty means the primary database's home region.
+    // Set at creation and immutable.
+    Region    string    `json:"region,omitempty" db:"region"`
     CreatedAt time.Time `json:"created_at" db:"created_at"`
     UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// DefaultOrganization 默认组织：用户拥有的最早创建的组织，没有则为最早创建的组织
+func DefaultOrganization(orgs []Organization, userID string) *Organization {
+    var owned, any *Organization
+    for i := range orgs {
+        o := &orgs[i]
+        if any == nil || o.CreatedAt.Before(any.CreatedAt) {
+            any = o
+        }
+        if o.OwnerID == userID && (owned == nil || o.CreatedAt.Before(owned.CreatedAt)) {
+            owned = o
+        }
+    }
+    if owned != nil {
+        return owned
+    }
+    return any
+}
+
 type OrgMemberRole string
 
 const (
     RoleOwner  OrgMemberRole = "owner"
     RoleAdmin  OrgMemberRole = "admin"
     RoleMember OrgMemberRole = "member"
+    // RoleGuest 空间访客：不是组织成员（不写入 organization_memberships），接受访客邀请后记入 space_guests，按 space_permissions 访问单个空间
+    RoleGuest  OrgMemberRole = "guest"
 )
 
 // OrganizationMembership relates users to organizations with a role
@@ -31,3 +56,11 @@ type OrganizationMembership struct {
     Role           OrgMemberRole `json:"role" db:"role"`
     CreatedAt      time.Time     `json:"created_at" db:"created_at"`
 }
+
+// OrganizationMember is a membership joined with the member's profile (for member lists)
+type OrganizationMember struct {
+    OrganizationMembership
+    Email  string `json:"email"`
+    Name   string `json:"name,omitempty"`
+    Avatar string `json:"avatar,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// PermissionGrant is one row of the per-user permission aggregate: the user's
+// role in an organization and, optionally, one of its spaces with the user's
+// explicit space_permissions setting. Handlers resolve effective access from it
+type PermissionGrant struct {
+	OrganizationID string
+	Role           OrgMemberRole // empty when the user is only a space guest (space_guests) in this organization
+	Space          *Space        // nil for an organization with no (non-deleted) spaces
+	Explicit       *bool         // space_permissions.can_edit; nil when there is no explicit setting
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// PromoKind is what a promo code grants
+type PromoKind string
+
+const (
+	// PromoPaddleDiscount is passed through to Paddle checkout as a discount
+	PromoPaddleDiscount PromoKind = "paddle_discount"
+	// PromoTierUpgrade grants a temporary tier without payment
+	PromoTierUpgrade PromoKind = "tier_upgrade"
+	// PromoAICredits grants bonus AI credits
+	PromoAICredits PromoKind = "ai_credits"
+)
+
+// PromoCode is a promotional code managed in the promo_codes table
+type PromoCode struct {
+	ID               string     `json:"id" db:"id"`
+	Code             string     `json:"code" db:"code"`
+	Kind             PromoKind  `json:"kind" db:"kind"`
+	PaddleDiscountID *string    `json:"paddle_discount_id,omitempty" db:"paddle_discount_id"`
+	Tier             *UserTier  `json:"tier,omitempty" db:"tier"` // upgrade target, or the only plan a discount applies to
+	DurationDays     int        `json:"duration_days" db:"duration_days"`
+	Credits          int        `json:"credits" db:"credits"`
+	MaxRedemptions   *int       `json:"max_redemptions,omitempty" db:"max_redemptions"`
+	RedemptionCount  int        `json:"redemption_count" db:"redemption_count"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	IsActive         bool       `json:"is_active" db:"is_active"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// NormalizePromoCode canonicalizes user input; codes are stored upper-case
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// UnusableReason explains why the code cannot be used at now, or "" if it can
+func (p *PromoCode) UnusableReason(now time.Time) string {
+	switch {
+	case !p.IsActive:
+		return "Promo code is no longer active"
+	case p.ExpiresAt != nil && !now.Before(*p.ExpiresAt):
+		return "Promo code has expired"
+	case p.MaxRedemptions != nil && p.RedemptionCount >= *p.MaxRedemptions:
+		return "Promo code has reached its redemption limit"
+	}
+	return ""
+}
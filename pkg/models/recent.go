@@ -0,0 +1,10 @@
+package models
+
+// RecentItem is an entry of the recently added / recently deleted quick lists,
+// carrying the collection and space it belongs to so clients can label it
+// without further lookups.
+type RecentItem struct {
+	CollectionItem
+	CollectionName string `json:"collection_name"`
+	SpaceID        string `json:"space_id"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// SnapshotUpload is an in-progress chunked snapshot upload (init, append
+// chunks, commit). Chunks are stored server-side until commit assembles the
+// body, validates it and saves the snapshot; unfinished uploads expire.
+type SnapshotUpload struct {
+	ID             string    `json:"id" db:"id"`
+	UserID         string    `json:"user_id" db:"user_id"`
+	OrganizationID string    `json:"organization_id,omitempty" db:"organization_id"` // empty for personal snapshots
+	Name           string    `json:"name" db:"name"`
+	Kind           string    `json:"kind" db:"kind"`
+	TotalBytes     int64     `json:"total_bytes" db:"total_bytes"` // declared size of the assembled body
+	ReceivedChunks []int     `json:"received_chunks" db:"-"`       // chunk indexes stored so far, ascending
+	ReceivedBytes  int64     `json:"received_bytes" db:"-"`
+	ExpiresAt      time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
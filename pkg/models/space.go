@@ -8,11 +8,38 @@ type Space struct {
     OrganizationID string    `json:"organization_id" db:"organization_id"`
     Name           string    `json:"name" db:"name"`
     Description    string    `json:"description,omitempty" db:"description"`
+    Color          string    `json:"color,omitempty" db:"color"` // 与集合相同：hex 或命名颜色
+    Icon           string    `json:"icon,omitempty" db:"icon"`   // 图标名或 emoji
     IsDefault      bool      `json:"is_default" db:"is_default"`
+    DefaultAccess  string    `json:"default_access" db:"default_access"` // SpaceAccess*：普通成员未单独设置时的权限
+    Visibility     string    `json:"visibility" db:"visibility"`         // SpaceVisibility*
     CreatedAt      time.Time `json:"created_at" db:"created_at"`
     UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Space default access levels for members without an explicit SpacePermission
+const (
+    SpaceAccessEdit       = "edit"       // 组织成员均可编辑
+    SpaceAccessView       = "view"       // 组织成员均可查看，编辑需显式授权（默认）
+    SpaceAccessRestricted = "restricted" // 仅 owner/admin 与显式授权的成员可访问
+)
+
+// ValidSpaceAccess reports whether a is a known default access level
+func ValidSpaceAccess(a string) bool {
+    return a == SpaceAccessEdit || a == SpaceAccessView || a == SpaceAccessRestricted
+}
+
+// Space visibility: private spaces are only visible to members with an explicit SpacePermission
+const (
+    SpaceVisibilityOrg     = "org"
+    SpaceVisibilityPrivate = "private"
+)
+
+// ValidSpaceVisibility reports whether v is a known visibility
+func ValidSpaceVisibility(v string) bool {
+    return v == SpaceVisibilityOrg || v == SpaceVisibilityPrivate
+}
+
 // SpacePermission controls per-member editing capability in a space
 type SpacePermission struct {
     ID        string    `json:"id" db:"id"`
@@ -23,3 +50,49 @@ type SpacePermission struct {
     UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+
+// Permission sources for EffectiveSpacePermission
+const (
+    PermissionSourceRole     = "role"     // owner/admin 始终可编辑
+    PermissionSourceExplicit = "explicit" // space_permissions 中的显式设置
+    PermissionSourceDefault  = "default"  // 空间的 default_access
+)
+
+// EffectiveSpacePermission is a member's resolved access to a space (share dialog)
+type EffectiveSpacePermission struct {
+    UserID   string        `json:"user_id"`
+    Email    string        `json:"email"`
+    Name     string        `json:"name,omitempty"`
+    Avatar   string        `json:"avatar,omitempty"`
+    Role     OrgMemberRole `json:"role"`
+    CanView  bool          `json:"can_view"`
+    CanEdit  bool          `json:"can_edit"`
+    Source   string        `json:"source"`
+    Explicit *bool         `json:"explicit_can_edit,omitempty"` // 显式设置（即使被角色覆盖也返回，便于共享对话框展示）
+}
+
+// SpaceInvitation invites an external collaborator (guest) to a single space
+type SpaceInvitation struct {
+    ID             string           `json:"id" db:"id"`
+    OrganizationID string           `json:"organization_id" db:"organization_id"`
+    SpaceID        string           `json:"space_id" db:"space_id"`
+    Email      string           `json:"email" db:"email"`
+    InviterID  string           `json:"inviter_id" db:"inviter_id"`
+    Token      string           `json:"token,omitempty" db:"token"` // 只在创建时返回；库中只存摘要
+    CanEdit    bool             `json:"can_edit" db:"can_edit"`
+    Status     InvitationStatus `json:"status" db:"status"`
+    ExpiresAt  time.Time        `json:"expires_at" db:"expires_at"`
+    AcceptedBy *string          `json:"accepted_by,omitempty" db:"accepted_by"`
+    CreatedAt  time.Time        `json:"created_at" db:"created_at"`
+    UpdatedAt  time.Time        `json:"updated_at" db:"updated_at"`
+}
+
+// SpaceGuest is a user with access to a space but no organization membership
+type SpaceGuest struct {
+    UserID    string    `json:"user_id"`
+    Email     string    `json:"email"`
+    Name      string    `json:"name,omitempty"`
+    Avatar    string    `json:"avatar,omitempty"`
+    CanEdit   bool      `json:"can_edit"`
+    CreatedAt time.Time `json:"created_at"`
+}
@@ -13,6 +13,46 @@ const (
 	TierPower UserTier = "power"
 )
 
+// Rank orders tiers from free (0) to power (2); unknown tiers rank as free
+func (t UserTier) Rank() int {
+	switch t {
+	case TierPro:
+		return 1
+	case TierPower:
+		return 2
+	}
+	return 0
+}
+
+// MaxTier returns the higher of two tiers
+func MaxTier(a, b UserTier) UserTier {
+	if b.Rank() > a.Rank() {
+		return b
+	}
+	return a
+}
+
+// TierLimits are the per-tier resource quotas; zero means unlimited
+type TierLimits struct {
+	MaxSnapshots     int `json:"max_snapshots"`
+	MaxOrganizations int `json:"max_organizations"` // organizations owned by the user
+	// daily API requests per organization, by route class (reads: GET/HEAD, writes: everything else);
+	// counted against the owner's tier
+	DailyReadRequests  int `json:"daily_read_requests"`
+	DailyWriteRequests int `json:"daily_write_requests"`
+}
+
+// Limits returns the quotas of the tier; unknown tiers get the free quotas
+func (t UserTier) Limits() TierLimits {
+	switch t {
+	case TierPro:
+		return TierLimits{MaxSnapshots: 100, MaxOrganizations: 3, DailyReadRequests: 200000, DailyWriteRequests: 50000}
+	case TierPower:
+		return TierLimits{}
+	}
+	return TierLimits{MaxSnapshots: 10, MaxOrganizations: 1, DailyReadRequests: 20000, DailyWriteRequests: 5000}
+}
+
 // SubscriptionStatus represents the status of a subscription
 type SubscriptionStatus string
 
@@ -24,14 +64,37 @@ const (
 	StatusIncomplete SubscriptionStatus = "incomplete"
 )
 
+// DunningStatus is the state of a user's failed-payment (dunning) cycle:
+// none -> grace (payment failed, paid tier kept) -> lapsed (grace window
+// elapsed, downgraded to free); a successful payment returns it to none
+type DunningStatus string
+
+const (
+	DunningNone   DunningStatus = ""
+	DunningGrace  DunningStatus = "grace"
+	DunningLapsed DunningStatus = "lapsed"
+)
+
 // UserWithSubscription represents a user with their subscription details
 type UserWithSubscription struct {
 	User
-	Tier               UserTier   `json:"tier" db:"tier"`
-	PaddleCustomerID   *string    `json:"paddle_customer_id,omitempty" db:"paddle_customer_id"`
-	TrialEndsAt        *time.Time `json:"trial_ends_at,omitempty" db:"trial_ends_at"`
-	IsLifetimeMember   bool       `json:"is_lifetime_member" db:"is_lifetime_member"`
-	LifetimeMemberType *string    `json:"lifetime_member_type,omitempty" db:"lifetime_member_type"`
+	Tier               UserTier      `json:"tier" db:"tier"`
+	PaddleCustomerID   *string       `json:"paddle_customer_id,omitempty" db:"paddle_customer_id"`
+	TrialEndsAt        *time.Time    `json:"trial_ends_at,omitempty" db:"trial_ends_at"`
+	TrialActive        bool          `json:"trial_active" db:"trial_active"` // 试用进行中；trial_ends_at 保留用于判断是否已用过试用
+	IsLifetimeMember   bool          `json:"is_lifetime_member" db:"is_lifetime_member"`
+	LifetimeMemberType *string       `json:"lifetime_member_type,omitempty" db:"lifetime_member_type"`
+	DunningStatus      DunningStatus `json:"dunning_status" db:"dunning_status"`
+	DunningStartedAt   *time.Time    `json:"dunning_started_at,omitempty" db:"dunning_started_at"`
+}
+
+// EffectiveTier returns the tier the user is entitled to: lifetime members
+// never resolve below their lifetime tier, whatever their subscription says
+func (u *UserWithSubscription) EffectiveTier() UserTier {
+	if u.IsLifetimeMember && u.LifetimeMemberType != nil {
+		return MaxTier(u.Tier, UserTier(*u.LifetimeMemberType))
+	}
+	return u.Tier
 }
 
 // SubscriptionPlan represents a subscription plan
@@ -84,3 +147,22 @@ type AICredits struct {
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
 }
+
+// TierChange records one change of a user's tier and what caused it
+type TierChange struct {
+	ID          string    `json:"id" db:"id"`
+	UserID      string    `json:"user_id" db:"user_id"`
+	OldTier     string    `json:"old_tier" db:"old_tier"`
+	NewTier     string    `json:"new_tier" db:"new_tier"`
+	Source      string    `json:"source" db:"source"`                       // TierChangeSource*，webhook 事件为 "paddle:<event>"
+	ReferenceID string    `json:"reference_id,omitempty" db:"reference_id"` // Paddle 交易/订阅 ID、优惠码等
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// Tier change sources outside Paddle webhooks
+const (
+	TierChangeSourceTrialStarted  = "trial_started"
+	TierChangeSourceTrialExpired  = "trial_expired"
+	TierChangeSourceDunningLapsed = "dunning_lapsed"
+	TierChangeSourcePromo         = "promo"
+)
@@ -55,9 +55,22 @@ type Snapshot struct {
 	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// Snapshot kinds: manual snapshots are saved by the user, auto snapshots are
+// captured periodically by the extension and pruned by retention rules
+const (
+	SnapshotKindManual = "manual"
+	SnapshotKindAuto   = "auto"
+)
+
+// ValidSnapshotKind reports whether kind is a known snapshot kind
+func ValidSnapshotKind(kind string) bool {
+	return kind == SnapshotKindManual || kind == SnapshotKindAuto
+}
+
 // SnapshotInfo represents snapshot metadata
 type SnapshotInfo struct {
 	Name       string `json:"name"`
+	Kind       string `json:"kind"`
 	CreatedAt  string `json:"created_at"`
 	UpdatedAt  string `json:"updated_at"`
 	TabCount   int    `json:"tab_count"`
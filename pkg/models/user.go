@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -19,6 +20,21 @@ type User struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// NormalizeEmail 邮箱统一去除首尾空白并转为小写后存储与比较（Bob@Email.com 与 bob@email.com 为同一账户）
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UserIdentity 用户在外部身份提供商上的账户；OAuth 登录先按 provider + provider_user_id 匹配，而不是邮箱
+type UserIdentity struct {
+	ID             string    `json:"id" db:"id"`
+	UserID         string    `json:"user_id" db:"user_id"`
+	Provider       string    `json:"provider" db:"provider"`                 // "google", "github"
+	ProviderUserID string    `json:"provider_user_id" db:"provider_user_id"` // 提供商侧的稳定用户 ID
+	Email          string    `json:"email,omitempty" db:"email"`             // 关联时提供商返回的邮箱
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
 // UserRegisterRequest represents the request payload for user registration
 type UserRegisterRequest struct {
 	Email    string `json:"email" validate:"required,email"`
@@ -45,11 +61,30 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
+// TokenTypePricingSession is the short-lived code handed from the extension to the pricing page;
+// it can only be exchanged via /api/auth/exchange-session, never used as a bearer token
+const TokenTypePricingSession = "pricing_session"
+
+// TokenProfile 签发访问令牌时写入的账户声明
+type TokenProfile struct {
+	Tier    string   // 有效等级（含终身会员）
+	Orgs    []string // 所属组织 ID，最多 MaxTokenOrgs 个
+	Version int      // users.token_version
+}
+
+// MaxTokenOrgs 访问令牌中最多携带的组织数，避免 Cookie 超长；完整列表以 GET /api/me 为准
+const MaxTokenOrgs = 25
+
 // TokenClaims represents the JWT token claims
 type TokenClaims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
-	Type   string `json:"type"` // "access" or "refresh"
+	Type   string `json:"type"` // "access", "refresh" or "pricing_session"
+	JTI    string `json:"jti,omitempty"` // 仅一次性令牌（pricing_session）携带
+	// 以下仅访问令牌携带；Ver 落后于 users.token_version 时需刷新（见 middleware.TokenVersion）
+	Tier string   `json:"tier,omitempty"`
+	Orgs []string `json:"orgs,omitempty"`
+	Ver  int      `json:"ver,omitempty"`
 	Exp    int64  `json:"exp"`
 	Iat    int64  `json:"iat"`
 }
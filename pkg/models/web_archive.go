@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// WebArchiveJob is a saved item waiting to be captured by the Internet Archive.
+// A job without JobID still has to be submitted; once submitted, JobID is polled
+// until the capture succeeds or fails. NextAttemptAt spaces out polls and retries.
+type WebArchiveJob struct {
+	ItemID         string     `json:"item_id" db:"item_id"`
+	OrganizationID string     `json:"organization_id" db:"organization_id"`
+	JobID          string     `json:"job_id,omitempty" db:"job_id"`
+	Attempts       int        `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	ClaimedAt      *time.Time `json:"claimed_at,omitempty" db:"claimed_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
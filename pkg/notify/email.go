@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+)
+
+// Email 一封纯文本 + HTML 的邮件
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers 额外邮件头，如 List-Unsubscribe
+	Headers map[string]string
+}
+
+// Mailer 发送邮件
+type Mailer interface {
+	Send(ctx context.Context, e Email) error
+}
+
+// NewMailer 按配置返回 SMTP 发送器；未配置 SMTP_HOST 时返回只打印日志的 LogMailer
+func NewMailer(cfg *config.Config) Mailer {
+	if cfg.SMTPHost == "" {
+		return LogMailer{}
+	}
+	return &SMTPMailer{
+		Addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		Host:     cfg.SMTPHost,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.EmailFrom,
+	}
+}
+
+// LogMailer 本地开发使用，只打印收件人与主题
+type LogMailer struct{}
+
+// Send 实现 Mailer
+func (LogMailer) Send(ctx context.Context, e Email) error {
+	fmt.Printf("📧 [email disabled] to=%s subject=%q\n", e.To, e.Subject)
+	return nil
+}
+
+// SMTPMailer 通过 SMTP 发送（服务器支持时自动 STARTTLS）
+type SMTPMailer struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send 实现 Mailer
+func (m *SMTPMailer) Send(ctx context.Context, e Email) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid EMAIL_FROM: %w", err)
+	}
+	msg, err := buildMessage(from.String(), e)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	if err := smtp.SendMail(m.Addr, auth, from.Address, []string{e.To}, msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// buildMessage 组装 multipart/alternative 邮件
+func buildMessage(from string, e Email) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", e.Text},
+		{"text/html; charset=UTF-8", e.HTML},
+	}
+	for _, p := range parts {
+		if p.content == "" {
+			continue
+		}
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		w.Write([]byte(p.content))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", e.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", e.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	for k, v := range e.Headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", textproto.CanonicalMIMEHeaderKey(k), v)
+	}
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"tab-sync-backend-refactor/pkg/database"
+	"tab-sync-backend-refactor/pkg/models"
+)
+
+// 通知类型
+const (
+	KindTrialStarted       = "trial_started"
+	KindTrialExpiring      = "trial_expiring"
+	KindTrialExpired       = "trial_expired"
+	KindPaymentLapsed      = "payment_lapsed"
+	KindInvitationReceived = "invitation_received"
+	KindMemberJoined       = "member_joined"
+	KindExportReady        = "export_ready"
+	KindSecurityAlert      = "security_alert"
+	KindPlanChanged        = "plan_changed"
+	KindItemReminder       = "item_reminder"
+)
+
+// Notification 发给单个用户的通知
+type Notification struct {
+	UserID string
+	Email  string
+	Kind   string
+	Title  string
+	Body   string
+	Data   map[string]interface{}
+	// DedupeKey 非空时同一用户同一 key 只投递一次（如定时任务重复运行）
+	DedupeKey string
+}
+
+// Notifier 向用户投递通知（站内、邮件等渠道）；投递失败不应影响触发它的业务操作
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// InAppNotifier 写入 notifications 表，供 GET /api/notifications 与扩展角标读取。
+// 使用 ctx 中的请求级数据库句柄（见 database.FromContext），因此只能在带 middleware.Database 的路由中使用。
+type InAppNotifier struct{}
+
+// Notify 实现 Notifier
+func (InAppNotifier) Notify(ctx context.Context, n Notification) error {
+	db := database.FromContext(ctx)
+	if db == nil {
+		return fmt.Errorf("no database in context")
+	}
+	record := &models.Notification{
+		UserID: n.UserID,
+		Kind:   n.Kind,
+		Title:  n.Title,
+		Body:   n.Body,
+		Data:   n.Data,
+	}
+	if n.DedupeKey != "" {
+		record.DedupeKey = &n.DedupeKey
+	}
+	if err := db.CreateNotification(record); err != nil {
+		return err
+	}
+	fmt.Printf("🔔 notify user=%s kind=%s title=%q\n", n.UserID, n.Kind, n.Title)
+	return nil
+}
@@ -0,0 +1,255 @@
+// Package reporting 将服务端错误与 panic 上报到 Sentry（通过其 HTTP Store API，无需 SDK）。
+// 未配置 SENTRY_DSN 时所有函数均为空操作。
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client Sentry 上报客户端
+type Client struct {
+	endpoint    string
+	authHeader  string
+	environment string
+	release     string
+	serverName  string
+	httpClient  *http.Client
+}
+
+// NewClient 解析 DSN（https://<key>@<host>/<project_id>）并创建客户端
+func NewClient(dsn, environment, release string) (*Client, error) {
+	u, err := url.Parse(strings.TrimSpace(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: missing public key")
+	}
+	projectID := strings.Trim(u.Path, "/")
+	if projectID == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: missing project id")
+	}
+	host, _ := os.Hostname()
+	return &Client{
+		endpoint: fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, projectID),
+		authHeader: fmt.Sprintf("Sentry sentry_version=7, sentry_client=tab-sync-backend/1.0, sentry_key=%s",
+			u.User.Username()),
+		environment: environment,
+		release:     release,
+		serverName:  host,
+		httpClient:  &http.Client{Timeout: 3 * time.Second},
+	}, nil
+}
+
+var (
+	defaultClient *Client
+	initOnce      sync.Once
+)
+
+// Init 初始化全局客户端（每个冷启动只执行一次）；dsn 为空时保持禁用
+func Init(dsn, environment, release string) {
+	initOnce.Do(func() {
+		if strings.TrimSpace(dsn) == "" {
+			return
+		}
+		c, err := NewClient(dsn, environment, release)
+		if err != nil {
+			fmt.Printf("[warn] error reporting disabled: %v\n", err)
+			return
+		}
+		defaultClient = c
+		fmt.Printf("🛰️  Error reporting enabled (release=%s)\n", release)
+	})
+}
+
+// Enabled 是否已配置上报
+func Enabled() bool {
+	return defaultClient != nil
+}
+
+// CaptureError 上报一个错误，附带请求上下文与 Scope 中的用户信息
+func CaptureError(r *http.Request, err error) {
+	if defaultClient == nil || err == nil {
+		return
+	}
+	defaultClient.send(r, fmt.Sprintf("%T", err), err.Error(), 2)
+}
+
+// CapturePanic 上报一次 panic
+func CapturePanic(r *http.Request, recovered interface{}) {
+	if defaultClient == nil {
+		return
+	}
+	defaultClient.send(r, "panic", fmt.Sprint(recovered), 3)
+}
+
+type event struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Platform    string                 `json:"platform"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Exception   map[string]interface{} `json:"exception"`
+	Request     map[string]interface{} `json:"request,omitempty"`
+	User        map[string]string      `json:"user,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+}
+
+func (c *Client) send(r *http.Request, errType, message string, skip int) {
+	ev := event{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Platform:    "go",
+		Level:       "error",
+		Logger:      "tab-sync-backend",
+		ServerName:  c.serverName,
+		Release:     c.release,
+		Environment: c.environment,
+		Exception: map[string]interface{}{
+			"values": []map[string]interface{}{{
+				"type":       errType,
+				"value":      message,
+				"stacktrace": map[string]interface{}{"frames": stackFrames(skip + 1)},
+			}},
+		},
+	}
+	if r != nil {
+		ev.Request = map[string]interface{}{
+			"method":       r.Method,
+			"url":          requestURL(r),
+			"query_string": r.URL.RawQuery,
+			"headers": map[string]string{
+				"User-Agent": r.UserAgent(),
+				"Origin":     r.Header.Get("Origin"),
+			},
+		}
+		if scope := ScopeFrom(r.Context()); scope != nil {
+			ev.User, ev.Tags = scope.snapshot()
+		}
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	// 同步发送：Serverless 函数返回后后台 goroutine 可能被冻结，短超时保证不拖慢响应太多
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", c.authHeader)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		fmt.Printf("[warn] error report failed: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Printf("[warn] error report rejected: status %d\n", resp.StatusCode)
+	}
+}
+
+func requestURL(r *http.Request) string {
+	scheme := "https"
+	if r.TLS == nil && r.Header.Get("X-Forwarded-Proto") != "https" {
+		scheme = "http"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// stackFrames 收集调用栈，Sentry 要求按从外到内（最早调用在前）排列
+func stackFrames(skip int) []map[string]interface{} {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []map[string]interface{}
+	for {
+		f, more := frames.Next()
+		out = append(out, map[string]interface{}{
+			"function": f.Function,
+			"filename": f.File,
+			"lineno":   f.Line,
+			"in_app":   strings.Contains(f.Function, "tab-sync-backend-refactor"),
+		})
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type scopeKey struct{}
+
+// Scope 单个请求的上报上下文（用户、标签），由中间件创建、鉴权中间件补充
+type Scope struct {
+	mu     sync.Mutex
+	userID string
+	tags   map[string]string
+}
+
+// WithScope 在 context 中创建新的 Scope
+func WithScope(ctx context.Context) (context.Context, *Scope) {
+	s := &Scope{tags: map[string]string{}}
+	return context.WithValue(ctx, scopeKey{}, s), s
+}
+
+// ScopeFrom 读取 context 中的 Scope
+func ScopeFrom(ctx context.Context) *Scope {
+	s, _ := ctx.Value(scopeKey{}).(*Scope)
+	return s
+}
+
+// SetUser 记录当前请求的用户 ID（无 Scope 时忽略）
+func SetUser(ctx context.Context, userID string) {
+	if s := ScopeFrom(ctx); s != nil {
+		s.mu.Lock()
+		s.userID = userID
+		s.mu.Unlock()
+	}
+}
+
+// SetTag 设置标签
+func (s *Scope) SetTag(key, value string) {
+	s.mu.Lock()
+	s.tags[key] = value
+	s.mu.Unlock()
+}
+
+func (s *Scope) snapshot() (map[string]string, map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var user map[string]string
+	if s.userID != "" {
+		user = map[string]string{"id": s.userID}
+	}
+	tags := make(map[string]string, len(s.tags))
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+	return user, tags
+}
@@ -0,0 +1,150 @@
+// Package storage 对象存储（头像、favicon、导出归档等二进制内容）。
+// STORAGE_PROVIDER 选择 S3 兼容存储（AWS S3、R2、MinIO 等）或 Supabase Storage；
+// 未配置时所有操作返回 ErrNotConfigured，调用方应回退到原有行为或提示功能不可用。
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+)
+
+var (
+	// ErrNotFound 对象不存在
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrNotConfigured 未配置 STORAGE_PROVIDER
+	ErrNotConfigured = errors.New("storage: not configured")
+)
+
+// requestTimeout 单次请求的上限；上传/下载大对象时请求上下文通常更早到期
+const requestTimeout = 5 * time.Minute
+
+// Object 读取到的对象；调用方负责关闭 Body
+type Object struct {
+	Key         string
+	ContentType string
+	Size        int64 // 未知时为 -1
+	Body        io.ReadCloser
+}
+
+// Store 对象存储
+type Store interface {
+	// Put 写入（覆盖）对象；size 为 body 的字节数，未知时传 -1（见 PutStream）
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get 读取对象；不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete 删除对象；对象不存在不视为错误
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	sharedOnce  sync.Once
+	sharedStore Store
+)
+
+// Shared 返回进程内共享的 Store
+func Shared(cfg *config.Config) Store {
+	sharedOnce.Do(func() { sharedStore = New(cfg) })
+	return sharedStore
+}
+
+// Configured 报告是否配置了对象存储
+func Configured(cfg *config.Config) bool {
+	return cfg.StorageProvider != ""
+}
+
+// New 按 STORAGE_PROVIDER 创建 Store
+func New(cfg *config.Config) Store {
+	switch cfg.StorageProvider {
+	case "s3":
+		return NewS3Store(S3Options{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.StorageBucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PathStyle:       cfg.S3ForcePathStyle,
+		})
+	case "supabase":
+		return NewSupabaseStore(cfg.SupabaseURL, cfg.SupabaseKey, cfg.StorageBucket)
+	default:
+		return unconfigured{}
+	}
+}
+
+type unconfigured struct{}
+
+func (unconfigured) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	return ErrNotConfigured
+}
+
+func (unconfigured) Get(ctx context.Context, key string) (*Object, error) {
+	return nil, ErrNotConfigured
+}
+
+func (unconfigured) Delete(ctx context.Context, key string) error {
+	return ErrNotConfigured
+}
+
+// PutStream 写入长度未知的流：S3 的单次 PUT 需要 Content-Length，先落到临时文件再上传，
+// 不把整个对象读进内存
+func PutStream(ctx context.Context, s Store, key string, body io.Reader, contentType string) (int64, error) {
+	tmp, err := os.CreateTemp("", "storage-upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, s.Put(ctx, key, tmp, size, contentType)
+}
+
+// Serve 以附件形式把对象流式写入响应（filename 为空时内联展示）
+func Serve(w http.ResponseWriter, obj *Object, filename string) error {
+	defer obj.Body.Close()
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if obj.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	if filename != "" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(filename, `"`, "")+`"`)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err := io.Copy(w, obj.Body)
+	return err
+}
+
+// statusError 非预期的响应状态
+func statusError(op string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("storage: %s failed: status %d: %s", op, resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+// contentLength 从响应头读取长度，未知时为 -1
+func contentLength(resp *http.Response) int64 {
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength
+	}
+	return -1
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tab-sync-backend-refactor/pkg/tracing"
+)
+
+// SupabaseStore Supabase Storage（/storage/v1/object），以 service key 访问私有 bucket
+type SupabaseStore struct {
+	baseURL    string
+	serviceKey string
+	bucket     string
+	client     *http.Client
+}
+
+// NewSupabaseStore 创建 Supabase Storage 存储
+func NewSupabaseStore(supabaseURL, serviceKey, bucket string) *SupabaseStore {
+	return &SupabaseStore{
+		baseURL:    strings.TrimRight(supabaseURL, "/") + "/storage/v1/object/",
+		serviceKey: serviceKey,
+		bucket:     bucket,
+		client:     tracing.NewHTTPClient(requestTimeout),
+	}
+}
+
+// Put 实现 Store；Supabase 接受分块传输，长度未知时直接流式上传
+func (s *SupabaseStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPost, key, body)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-upsert", "true")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError("put "+key, resp)
+	}
+	return nil
+}
+
+// Get 实现 Store
+func (s *SupabaseStore) Get(ctx context.Context, key string) (*Object, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return &Object{Key: key, ContentType: resp.Header.Get("Content-Type"), Size: contentLength(resp), Body: resp.Body}, nil
+	}
+	defer resp.Body.Close()
+	if isSupabaseNotFound(resp) {
+		return nil, ErrNotFound
+	}
+	return nil, statusError("get "+key, resp)
+}
+
+// Delete 实现 Store
+func (s *SupabaseStore) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK || isSupabaseNotFound(resp) {
+		return nil
+	}
+	return statusError("delete "+key, resp)
+}
+
+func (s *SupabaseStore) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	segments := strings.Split(strings.TrimLeft(key, "/"), "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+url.PathEscape(s.bucket)+"/"+strings.Join(segments, "/"), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	req.Header.Set("apikey", s.serviceKey)
+	return req, nil
+}
+
+// isSupabaseNotFound Storage API 对不存在的对象返回 404，部分版本返回 400 并在正文中注明 not found
+func isSupabaseNotFound(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusNotFound {
+		return true
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return strings.Contains(strings.ToLower(string(body)), "not found")
+}
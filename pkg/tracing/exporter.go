@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options 追踪配置
+type Options struct {
+	Endpoint    string            // OTLP/HTTP 基地址，如 https://otlp.example.com
+	Headers     map[string]string // 额外请求头（认证等）
+	ServiceName string
+	SampleRate  float64 // 0-1
+	Environment string
+}
+
+type exporter struct {
+	opts       Options
+	url        string
+	httpClient *http.Client
+}
+
+var (
+	globalExporter *exporter
+	initOnce       sync.Once
+)
+
+// Init 初始化全局导出器（每个冷启动一次）；Endpoint 为空时保持禁用
+func Init(opts Options) {
+	initOnce.Do(func() {
+		if strings.TrimSpace(opts.Endpoint) == "" {
+			return
+		}
+		if opts.ServiceName == "" {
+			opts.ServiceName = "tab-sync-backend"
+		}
+		globalExporter = &exporter{
+			opts: opts,
+			url:  strings.TrimRight(opts.Endpoint, "/") + "/v1/traces",
+			// 导出请求本身不经过追踪 Transport，避免递归
+			httpClient: &http.Client{Timeout: 2 * time.Second},
+		}
+		fmt.Printf("🔭 Tracing enabled (OTLP %s, sample=%.2f)\n", globalExporter.url, opts.SampleRate)
+	})
+}
+
+// Enabled 是否已启用追踪
+func Enabled() bool {
+	return globalExporter != nil
+}
+
+func currentExporter() *exporter {
+	return globalExporter
+}
+
+func (e *exporter) sample() bool {
+	return e.opts.SampleRate >= 1 || rand.Float64() < e.opts.SampleRate
+}
+
+// export 以 OTLP JSON 编码同步发送；Serverless 实例在响应后可能被冻结，因此不做后台批量
+func (e *exporter) export(spans []*Span) {
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		otlpSpans = append(otlpSpans, s.toOTLP())
+	}
+	payload := map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": attributes(map[string]interface{}{
+					"service.name":           e.opts.ServiceName,
+					"deployment.environment": e.opts.Environment,
+				}),
+			},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": "tab-sync-backend/tracing"},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		fmt.Printf("[warn] trace export failed: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Printf("[warn] trace export rejected: status %d\n", resp.StatusCode)
+	}
+}
+
+func (s *Span) toOTLP() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[string]interface{}{
+		"traceId":           hex.EncodeToString(s.traceID[:]),
+		"spanId":            hex.EncodeToString(s.spanID[:]),
+		"name":              s.name,
+		"kind":              int(s.kind),
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        attributes(s.attrs),
+	}
+	if s.parentID != ([8]byte{}) {
+		out["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+	}
+	if s.failed {
+		out["status"] = map[string]interface{}{"code": 2, "message": s.errMsg}
+	}
+	return out
+}
+
+func attributes(m map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(m))
+	for k, v := range m {
+		var value map[string]interface{}
+		switch vv := v.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": vv}
+		case bool:
+			value = map[string]interface{}{"boolValue": vv}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(vv)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(vv, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": vv}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(vv)}
+		}
+		out = append(out, map[string]interface{}{"key": k, "value": value})
+	}
+	return out
+}
+
+// ParseHeaders 解析 OTEL_EXPORTER_OTLP_HEADERS 格式（k1=v1,k2=v2）
+func ParseHeaders(raw string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) == 2 && kv[0] != "" {
+			out[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return out
+}
@@ -0,0 +1,233 @@
+// Package tracing 提供轻量级的分布式追踪：每个请求一个根 Span，DB/Supabase/OAuth/Paddle
+// 调用作为子 Span，通过 context 传递，并在根 Span 结束时以 OTLP/HTTP(JSON) 导出。
+// 兼容 W3C traceparent；未配置 OTEL_EXPORTER_OTLP_ENDPOINT 时所有操作为空操作。
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind 与 OTLP 定义一致
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Span 一次被追踪的操作；nil Span 的所有方法都是安全的空操作
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     SpanKind
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	errMsg   string
+	failed   bool
+	trace    *trace
+	mu       sync.Mutex
+}
+
+// trace 收集同一请求内的所有 Span，根 Span 结束时统一导出
+type trace struct {
+	mu    sync.Mutex
+	root  *Span
+	spans []*Span
+	done  bool
+}
+
+type spanKey struct{}
+
+// StartSpan 以 ctx 中的 Span 为父节点开始一个新 Span；未启用追踪时返回 nil Span
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	exp := currentExporter()
+	if exp == nil {
+		return ctx, nil
+	}
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: map[string]interface{}{}}
+	_, _ = rand.Read(s.spanID[:])
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+		s.trace = parent.trace
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		// 继承上游 traceparent，根 Span 由本服务创建
+		s.traceID = remote.traceID
+		s.parentID = remote.spanID
+		s.trace = &trace{root: s}
+	} else {
+		if !exp.sample() {
+			return ctx, nil
+		}
+		_, _ = rand.Read(s.traceID[:])
+		s.trace = &trace{root: s}
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFromContext 返回 ctx 中当前的 Span
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetName 修改 Span 名称（如在路由匹配后改为路由模板）
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute 设置属性（string/int/int64/bool/float64）
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError 标记 Span 失败
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed = true
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End 结束 Span；根 Span 结束时导出整个 trace
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	t := s.trace
+	t.mu.Lock()
+	if t.done {
+		// 根 Span 已导出，迟到的子 Span 丢弃
+		t.mu.Unlock()
+		return
+	}
+	t.spans = append(t.spans, s)
+	var batch []*Span
+	if s == t.root {
+		t.done = true
+		batch = t.spans
+	}
+	t.mu.Unlock()
+
+	if batch != nil {
+		if exp := currentExporter(); exp != nil {
+			exp.export(batch)
+		}
+	}
+}
+
+// TraceParent 返回 W3C traceparent 头的值
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// TraceID 返回十六进制 trace id
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+type remoteKey struct{}
+
+type remoteParent struct {
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+// Extract 解析请求头中的 traceparent（仅处理 sampled 标记），供随后的 StartSpan 继承
+func Extract(ctx context.Context, h http.Header) context.Context {
+	parts := strings.Split(strings.TrimSpace(h.Get("traceparent")), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || !strings.HasSuffix(parts[3], "1") {
+		return ctx
+	}
+	var rp remoteParent
+	if _, err := hex.Decode(rp.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(rp.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, rp)
+}
+
+// Inject 将当前 Span 写入出站请求的 traceparent 头
+func Inject(ctx context.Context, h http.Header) {
+	if s := SpanFromContext(ctx); s != nil {
+		h.Set("traceparent", s.TraceParent())
+	}
+}
+
+// Transport 为出站 HTTP 请求创建客户端 Span 并注入 traceparent
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := StartSpan(req.Context(), "HTTP "+req.Method+" "+req.URL.Host, KindClient)
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.RecordError(fmt.Errorf("status %d", resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// NewHTTPClient 返回带追踪 Transport 的 HTTP 客户端
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: &Transport{}}
+}
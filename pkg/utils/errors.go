@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// AppError 是对外暴露的错误：稳定的错误码 + 面向用户的消息 + HTTP 状态码。
+// 内部原因（cause）只写日志，不会出现在响应中。
+type AppError struct {
+	Status  int
+	Code    string
+	Message string
+	Details string
+	cause   error
+}
+
+func (e *AppError) Error() string {
+	if e.cause != nil {
+		return e.Code + ": " + e.cause.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+// Unwrap 返回内部原因
+func (e *AppError) Unwrap() error { return e.cause }
+
+// Is 按错误码比较，使 errors.Is(err, utils.ErrOrgNotFound) 在 Wrap/WithMessage 之后依然成立
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
+}
+
+// Wrap 返回附带内部原因的副本（目录中的值本身保持不变）
+func (e *AppError) Wrap(cause error) *AppError {
+	c := *e
+	c.cause = cause
+	return &c
+}
+
+// WithMessage 返回替换了用户消息的副本
+func (e *AppError) WithMessage(message string) *AppError {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// WithDetails 返回附带机器可读详情的副本
+func (e *AppError) WithDetails(details string) *AppError {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+func newAppError(status int, code, message string) *AppError {
+	return &AppError{Status: status, Code: code, Message: message}
+}
+
+// 错误码目录：客户端按 error.code 分支处理，新增错误码时只追加、不修改已有含义
+var (
+	// 通用
+	ErrBadRequest         = newAppError(http.StatusBadRequest, "BAD_REQUEST", "Invalid request")
+	ErrValidation         = newAppError(http.StatusBadRequest, "VALIDATION_ERROR", "Validation failed")
+	ErrUnauthorized       = newAppError(http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+	ErrForbidden          = newAppError(http.StatusForbidden, "FORBIDDEN", "Permission denied")
+	ErrNotFound           = newAppError(http.StatusNotFound, "NOT_FOUND", "Resource not found")
+	ErrConflict           = newAppError(http.StatusConflict, "CONFLICT", "Resource already exists")
+	ErrPayloadTooLarge    = newAppError(http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE", "Request body too large")
+	ErrUnsupportedMedia   = newAppError(http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE", "Content-Type must be application/json")
+	ErrQuotaExceeded      = newAppError(http.StatusForbidden, "QUOTA_EXCEEDED", "Quota exceeded for current plan")
+	ErrInternal           = newAppError(http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "Internal server error")
+	ErrNotImplemented     = newAppError(http.StatusNotImplemented, "NOT_IMPLEMENTED", "Not implemented")
+	ErrServiceUnavailable = newAppError(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Service temporarily unavailable, please retry later")
+	ErrTimeout            = newAppError(http.StatusGatewayTimeout, "TIMEOUT", "Request timed out, please retry later")
+
+	// 鉴权
+	ErrInvalidToken = newAppError(http.StatusUnauthorized, "INVALID_TOKEN", "Invalid token")
+	ErrTokenExpired = newAppError(http.StatusUnauthorized, "TOKEN_EXPIRED", "Token expired")
+	ErrAuthLocked   = newAppError(http.StatusTooManyRequests, "AUTH_LOCKED", "Too many failed attempts, please try again later")
+	// ErrTokenRefreshRequired 账户等级或组织成员关系已变化：用刷新令牌换取新的访问令牌后重试
+	ErrTokenRefreshRequired = newAppError(http.StatusUnauthorized, "TOKEN_REFRESH_REQUIRED", "Account changed, refresh the access token")
+	// ErrReauthRequired 检测到可疑活动后会话已被吊销：刷新令牌失效，需要重新登录
+	ErrReauthRequired = newAppError(http.StatusUnauthorized, "REAUTH_REQUIRED", "Your sessions were signed out after suspicious activity, sign in again")
+	// ErrOrgQuotaExceeded 组织当日该类请求已达等级上限（details 为 "类别: 已用/上限"），按 Retry-After 在下一个 UTC 零点后重试
+	ErrOrgQuotaExceeded = newAppError(http.StatusTooManyRequests, "ORG_QUOTA_EXCEEDED", "Organization daily API quota exceeded")
+	// ErrAccountLinkRequired 外部账户的邮箱已属于另一账户：需先登录该账户再显式关联（details 为关联令牌）
+	ErrAccountLinkRequired = newAppError(http.StatusConflict, "ACCOUNT_LINK_REQUIRED", "An account with this email already exists; sign in to it to link this provider")
+	ErrIdentityLinked      = newAppError(http.StatusConflict, "IDENTITY_LINKED", "This provider account is already linked to another user")
+	// ErrDeviceRevoked 设备已在账户页被吊销：扩展应清除本地令牌并提示重新登录
+	ErrDeviceRevoked = newAppError(http.StatusUnauthorized, "DEVICE_REVOKED", "This device has been signed out; sign in again to resume syncing")
+
+	// 用户
+	ErrUserExists   = newAppError(http.StatusConflict, "USER_EXISTS", "User already exists")
+	ErrUserNotFound = newAppError(http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+
+	// 组织 / 空间 / 邀请
+	ErrOrgNotFound        = newAppError(http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
+	ErrNotOrgMember       = newAppError(http.StatusForbidden, "NOT_ORG_MEMBER", "Not a member of organization")
+	ErrSpaceNotFound      = newAppError(http.StatusNotFound, "SPACE_NOT_FOUND", "Space not found")
+	ErrInvitationNotFound = newAppError(http.StatusNotFound, "INVITATION_NOT_FOUND", "Invitation not found")
+	ErrInvitationInvalid  = newAppError(http.StatusBadRequest, "INVITATION_INVALID", "Invitation invalid or expired")
+
+	// 集合 / 条目 / 快照
+	ErrCollectionNotFound = newAppError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found")
+	ErrItemNotFound       = newAppError(http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found")
+	ErrRevisionNotFound   = newAppError(http.StatusNotFound, "REVISION_NOT_FOUND", "Item revision not found")
+	// ErrSmartCollection 智能集合的条目由查询决定，不能直接加入或移入条目
+	ErrSmartCollection  = newAppError(http.StatusConflict, "SMART_COLLECTION", "Smart collections list items by query and cannot hold items")
+	ErrSnapshotNotFound = newAppError(http.StatusNotFound, "SNAPSHOT_NOT_FOUND", "Snapshot not found")
+	// ErrSnapshotTooLarge 快照超出结构上限；details 为 "groups: 250/200; ..." 形式的计数，扩展可据此提示拆分
+	ErrSnapshotTooLarge = newAppError(http.StatusRequestEntityTooLarge, "SNAPSHOT_LIMIT_EXCEEDED", "Snapshot exceeds size limits")
+	// 分块上传：上传不存在或已过期需重新 init；commit 时缺少分块（details 为缺失的序号），补传后重试
+	ErrUploadNotFound   = newAppError(http.StatusNotFound, "UPLOAD_NOT_FOUND", "Upload not found or expired")
+	ErrUploadIncomplete = newAppError(http.StatusConflict, "UPLOAD_INCOMPLETE", "Upload is missing chunks")
+	ErrDeviceNotFound   = newAppError(http.StatusNotFound, "DEVICE_NOT_FOUND", "Device not found")
+	// 历史导入：导入不存在（或不属于当前用户）；已标记完成的导入不再接收批次，需重新开始
+	ErrImportNotFound     = newAppError(http.StatusNotFound, "IMPORT_NOT_FOUND", "Import not found")
+	ErrImportCompleted    = newAppError(http.StatusConflict, "IMPORT_COMPLETED", "Import already completed; start a new import")
+	ErrDevicePushNotFound = newAppError(http.StatusNotFound, "DEVICE_PUSH_NOT_FOUND", "Push not found or already handled")
+
+	// 数据导出
+	ErrExportNotFound = newAppError(http.StatusNotFound, "EXPORT_NOT_FOUND", "Export not found")
+	ErrLinkExpired    = newAppError(http.StatusGone, "LINK_EXPIRED", "Download link expired or invalid")
+
+	// 数据驻留
+	ErrCrossRegion = newAppError(http.StatusConflict, "CROSS_REGION", "Resources belong to different data regions")
+
+	// ErrPolicyBlocked 组织域名策略禁止保存该 URL（details 为命中的策略域名）
+	ErrPolicyBlocked = newAppError(http.StatusForbidden, "POLICY_BLOCKED", "Saving links to this domain is blocked by your organization's policy")
+
+	// ErrSlugTaken 组织 slug 已被占用
+	ErrSlugTaken = newAppError(http.StatusConflict, "SLUG_TAKEN", "This URL is already taken by another organization")
+
+	// 优惠码
+	ErrPromoInvalid         = newAppError(http.StatusBadRequest, "PROMO_INVALID", "Promo code is invalid or expired")
+	ErrPromoAlreadyRedeemed = newAppError(http.StatusConflict, "PROMO_ALREADY_REDEEMED", "Promo code already redeemed")
+
+	// ErrClientUpgradeRequired 扩展版本低于 MIN_CLIENT_VERSION（details 为最低版本），扩展应提示用户更新
+	ErrClientUpgradeRequired = newAppError(http.StatusUpgradeRequired, "CLIENT_UPGRADE_REQUIRED", "This version of the extension is no longer supported, please update")
+	// ErrClientVersionBlocked 该扩展版本已被临时封禁（details 为版本）：客户端应停止请求，按 Retry-After 之后再试
+	ErrClientVersionBlocked = newAppError(http.StatusServiceUnavailable, "CLIENT_VERSION_BLOCKED", "This extension version is temporarily blocked, please back off and update")
+
+	// 图片代理：源站不可达、返回非图片或超出大小限制
+	ErrImageUnavailable = newAppError(http.StatusBadGateway, "IMAGE_UNAVAILABLE", "Image could not be loaded")
+)
+
+// ErrorReporter 由支持错误上报的 ResponseWriter 实现（见 middleware.ErrorReporting）
+type ErrorReporter interface {
+	ReportError(err error)
+}
+
+// reportServerError 沿 Unwrap 链查找 ErrorReporter 并上报 5xx 错误
+func reportServerError(w http.ResponseWriter, err error) {
+	for w != nil {
+		if rep, ok := w.(ErrorReporter); ok {
+			rep.ReportError(err)
+			return
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
+
+// WriteAppError 写入目录中的错误；非 AppError 一律记录日志并返回通用 500，避免泄露数据库等内部信息
+func WriteAppError(w http.ResponseWriter, err error) {
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		appErr = ErrInternal.Wrap(err)
+	}
+	if appErr.cause != nil || appErr.Status >= 500 {
+		fmt.Printf("[error] %s (%d) request_id=%s: %v\n", appErr.Code, appErr.Status, w.Header().Get(RequestIDHeader), err)
+	}
+	if appErr.Status >= 500 {
+		reportServerError(w, err)
+	}
+	WriteErrorResponseWithCode(w, appErr.Status, appErr.Code, appErr.Message, appErr.Details)
+}
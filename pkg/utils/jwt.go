@@ -20,8 +20,8 @@ func NewJWTService(secretKey string) *JWTService {
 	}
 }
 
-// GenerateTokenPair 生成访问令牌和刷新令牌对
-func (j *JWTService) GenerateTokenPair(userID, email string) (accessToken, refreshToken string, expiresIn int64, err error) {
+// GenerateTokenPair 生成访问令牌和刷新令牌对；profile 写入访问令牌
+func (j *JWTService) GenerateTokenPair(userID, email string, profile models.TokenProfile) (accessToken, refreshToken string, expiresIn int64, err error) {
 	now := time.Now()
 	
 	// 访问令牌（15分钟有效期）
@@ -30,6 +30,9 @@ func (j *JWTService) GenerateTokenPair(userID, email string) (accessToken, refre
 		UserID: userID,
 		Email:  email,
 		Type:   "access",
+		Tier:   profile.Tier,
+		Orgs:   profile.Orgs,
+		Ver:    profile.Version,
 		Exp:    accessExpiry.Unix(),
 		Iat:    now.Unix(),
 	}
@@ -60,7 +63,7 @@ func (j *JWTService) GenerateTokenPair(userID, email string) (accessToken, refre
 }
 
 // GenerateAccessToken 生成访问令牌
-func (j *JWTService) GenerateAccessToken(userID, email string) (string, int64, error) {
+func (j *JWTService) GenerateAccessToken(userID, email string, profile models.TokenProfile) (string, int64, error) {
 	now := time.Now()
 	expiry := now.Add(15 * time.Minute)
 
@@ -68,6 +71,9 @@ func (j *JWTService) GenerateAccessToken(userID, email string) (string, int64, e
 		UserID: userID,
 		Email:  email,
 		Type:   "access",
+		Tier:   profile.Tier,
+		Orgs:   profile.Orgs,
+		Ver:    profile.Version,
 		Exp:    expiry.Unix(),
 		Iat:    now.Unix(),
 	}
@@ -81,6 +87,37 @@ func (j *JWTService) GenerateAccessToken(userID, email string) (string, int64, e
 	return tokenString, expiry.Unix(), nil
 }
 
+// PricingSessionTTL 定价页会话码有效期（独立于访问令牌的 15 分钟）
+const PricingSessionTTL = 5 * time.Minute
+
+// GeneratePricingSessionToken 生成定价页会话码（type=pricing_session）：只能通过 ExchangeSession 换取用户信息，
+// 不能作为访问令牌或刷新令牌使用；JTI 用于保证只能兑换一次
+func (j *JWTService) GeneratePricingSessionToken(userID, email string) (string, int64, error) {
+	now := time.Now()
+	expiry := now.Add(PricingSessionTTL)
+
+	jti, err := GenerateURLToken(16)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to generate pricing session id: %w", err)
+	}
+	claims := &models.TokenClaims{
+		UserID: userID,
+		Email:  email,
+		Type:   models.TokenTypePricingSession,
+		JTI:    jti,
+		Exp:    expiry.Unix(),
+		Iat:    now.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(j.secretKey)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to generate pricing session token: %w", err)
+	}
+
+	return tokenString, expiry.Unix(), nil
+}
+
 // ValidateToken 验证令牌
 func (j *JWTService) ValidateToken(tokenString string) (*models.TokenClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -126,14 +163,18 @@ func (j *JWTService) ValidateRefreshToken(tokenString string) (*models.TokenClai
 	return claims, nil
 }
 
-// RefreshAccessToken 使用刷新令牌生成新的访问令牌
-func (j *JWTService) RefreshAccessToken(refreshToken string) (string, int64, error) {
-	claims, err := j.ValidateRefreshToken(refreshToken)
+// ValidatePricingSessionToken 验证定价页会话码（签名、有效期与类型）
+func (j *JWTService) ValidatePricingSessionToken(tokenString string) (*models.TokenClaims, error) {
+	claims, err := j.ValidateToken(tokenString)
 	if err != nil {
-		return "", 0, fmt.Errorf("invalid refresh token: %w", err)
+		return nil, err
 	}
 
-	return j.GenerateAccessToken(claims.UserID, claims.Email)
+	if claims.Type != models.TokenTypePricingSession {
+		return nil, fmt.Errorf("invalid token type: expected %s, got %s", models.TokenTypePricingSession, claims.Type)
+	}
+
+	return claims, nil
 }
 
 // ExtractUserFromToken 从令牌中提取用户信息
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	// DefaultPerPage 列表接口默认每页条数
+	DefaultPerPage = 20
+	// MaxPerPage 列表接口每页条数上限
+	MaxPerPage = 200
+)
+
+// Pagination 列表分页参数；PerPage 为 0 表示不分页，返回完整列表（见 ParsePaginationOrAll）
+type Pagination struct {
+	Page    int
+	PerPage int
+}
+
+// ParsePagination 从查询参数解析 page/per_page（兼容旧参数 page_size），非法值回退为默认值
+func ParsePagination(r *http.Request) Pagination {
+	p := Pagination{Page: 1, PerPage: DefaultPerPage}
+	q := r.URL.Query()
+	if n, err := strconv.Atoi(q.Get("page")); err == nil && n > 0 {
+		p.Page = n
+	}
+	perPage := q.Get("per_page")
+	if perPage == "" {
+		perPage = q.Get("page_size")
+	}
+	if n, err := strconv.Atoi(perPage); err == nil && n > 0 {
+		if n > MaxPerPage {
+			n = MaxPerPage
+		}
+		p.PerPage = n
+	}
+	return p
+}
+
+// ParsePaginationOrAll 同 ParsePagination，但请求未带 page/per_page/page_size 时不分页。
+// 用于分页之前就返回完整列表、客户端依赖全量结果的接口（集合条目、快照、集合、组织、成员、空间、邀请列表）
+func ParsePaginationOrAll(r *http.Request) Pagination {
+	q := r.URL.Query()
+	if q.Get("page") == "" && q.Get("per_page") == "" && q.Get("page_size") == "" {
+		return Pagination{Page: 1}
+	}
+	return ParsePagination(r)
+}
+
+// Bounds 返回当前页在长度为 total 的切片中的 [start, end) 区间
+func (p Pagination) Bounds(total int) (int, int) {
+	if p.PerPage <= 0 {
+		return 0, total
+	}
+	start := (p.Page - 1) * p.PerPage
+	if start > total {
+		start = total
+	}
+	end := start + p.PerPage
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// Meta 构造当前分页的 Meta
+func (p Pagination) Meta(total int) *Meta {
+	if p.PerPage <= 0 {
+		return NewMeta(1, total, total)
+	}
+	return NewMeta(p.Page, p.PerPage, total)
+}
+
+// PageOf 截取 items 的当前页并返回对应 Meta；结果切片永不为 nil，保证 data 序列化为 []
+func PageOf[T any](items []T, p Pagination) ([]T, *Meta) {
+	start, end := p.Bounds(len(items))
+	page := make([]T, 0, end-start)
+	page = append(page, items[start:end]...)
+	return page, p.Meta(len(items))
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePaginationOrAll(t *testing.T) {
+	tests := []struct {
+		query          string
+		total          int
+		wantStart      int
+		wantEnd        int
+		wantPerPage    int
+		wantTotalPages int
+	}{
+		{"", 45, 0, 45, 45, 1},
+		{"", 0, 0, 0, 0, 0},
+		{"?page=2", 45, 20, 40, DefaultPerPage, 3},
+		{"?per_page=10", 45, 0, 10, 10, 5},
+		{"?page_size=50", 45, 0, 45, 50, 1},
+		{"?state=all", 45, 0, 45, 45, 1},
+	}
+	for _, tt := range tests {
+		p := ParsePaginationOrAll(httptest.NewRequest("GET", "/items"+tt.query, nil))
+		start, end := p.Bounds(tt.total)
+		if start != tt.wantStart || end != tt.wantEnd {
+			t.Errorf("%q: bounds = [%d, %d), want [%d, %d)", tt.query, start, end, tt.wantStart, tt.wantEnd)
+		}
+		meta := p.Meta(tt.total)
+		if meta.PerPage != tt.wantPerPage || meta.TotalPages != tt.wantTotalPages || meta.Page != p.Page {
+			t.Errorf("%q: meta = %+v, want per_page %d, total_pages %d", tt.query, *meta, tt.wantPerPage, tt.wantTotalPages)
+		}
+	}
+}
+
+func TestPageOfAll(t *testing.T) {
+	items := make([]int, 250)
+	page, meta := PageOf(items, Pagination{Page: 1})
+	if len(page) != 250 || meta.Total != 250 {
+		t.Fatalf("len = %d, total = %d, want the full list beyond MaxPerPage", len(page), meta.Total)
+	}
+}
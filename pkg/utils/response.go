@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 )
 
@@ -13,23 +14,47 @@ type APIResponse struct {
 	Meta    *Meta       `json:"meta,omitempty"`
 }
 
+// RequestIDHeader 返回请求 ID 的响应头（由 middleware.RequestID 设置）
+const RequestIDHeader = "X-Request-ID"
+
 // APIError 错误信息结构
 type APIError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // 与 X-Request-ID 响应头相同，用户反馈问题时引用
 }
 
 // Meta 元数据结构（用于分页等）
+//
+// 所有列表接口统一返回 {"success":true,"data":[...],"meta":{...}}：
+// data 为当前页的数组（无数据时为 []），meta.total 为过滤后的总条数，
+// 增量同步接口额外返回 next_since（毫秒时间戳），作为下次请求的 since。
 type Meta struct {
-	Page       int `json:"page,omitempty"`
-	PerPage    int `json:"per_page,omitempty"`
-	Total      int `json:"total,omitempty"`
-	TotalPages int `json:"total_pages,omitempty"`
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int   `json:"total"`
+	TotalPages int   `json:"total_pages"`
+	NextSince  int64 `json:"next_since,omitempty"`
+}
+
+// NewMeta 根据分页参数与总数构造 Meta
+func NewMeta(page, perPage, total int) *Meta {
+	totalPages := 0
+	if perPage > 0 {
+		totalPages = (total + perPage - 1) / perPage // 向上取整
+	}
+	return &Meta{
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: totalPages,
+	}
 }
 
 // WriteJSONResponse 写入JSON响应
 func WriteJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	ensureRetryHeaders(w, statusCode)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
@@ -61,15 +86,18 @@ func WriteErrorResponse(w http.ResponseWriter, statusCode int, message string) {
 
 // WriteErrorResponseWithCode 写入带错误代码的错误响应
 func WriteErrorResponseWithCode(w http.ResponseWriter, statusCode int, code, message, details string) {
+	requestID := w.Header().Get(RequestIDHeader)
+	ensureRetryHeaders(w, statusCode)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
 	response := APIResponse{
 		Success: false,
 		Error: &APIError{
-			Code:    code,
-			Message: message,
-			Details: details,
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: requestID,
 		},
 	}
 
@@ -106,6 +134,7 @@ func WriteConflictResponse(w http.ResponseWriter, message string) {
 
 // WriteInternalServerErrorResponse 写入500错误响应
 func WriteInternalServerErrorResponse(w http.ResponseWriter, message string) {
+	reportServerError(w, errors.New(message))
 	WriteErrorResponseWithCode(w, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", message, "")
 }
 
@@ -116,20 +145,18 @@ func WriteValidationErrorResponse(w http.ResponseWriter, message string, details
 
 // WritePaginatedResponse 写入分页响应
 func WritePaginatedResponse(w http.ResponseWriter, data interface{}, page, perPage, total int) {
-	totalPages := (total + perPage - 1) / perPage // 向上取整
+	WriteListResponse(w, data, NewMeta(page, perPage, total))
+}
 
+// WriteListResponse 写入带 Meta 的列表响应
+func WriteListResponse(w http.ResponseWriter, data interface{}, meta *Meta) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	response := APIResponse{
 		Success: true,
 		Data:    data,
-		Meta: &Meta{
-			Page:       page,
-			PerPage:    perPage,
-			Total:      total,
-			TotalPages: totalPages,
-		},
+		Meta:    meta,
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
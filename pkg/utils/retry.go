@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetryAfter 429/503 响应未指定退避时间时使用（数据库不可用、上游故障等）
+const DefaultRetryAfter = 30 * time.Second
+
+// RateLimit 限流计数的当前状态
+type RateLimit struct {
+	Limit     int
+	Remaining int64
+	Reset     time.Time
+}
+
+// SetRateLimitHeaders 写入 X-RateLimit-Limit / Remaining / Reset（Reset 为 Unix 秒）；
+// 未超限的响应同样携带，客户端可提前放缓
+func SetRateLimitHeaders(w http.ResponseWriter, rl RateLimit) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rl.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(rl.Remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(rl.Reset.Unix(), 10))
+}
+
+// SetRetryAfter 写入 Retry-After（向上取整到秒，至少 1 秒），并补齐 X-RateLimit-Remaining: 0 与
+// X-RateLimit-Reset，使限流、锁定、封禁与降级的 429/503 可以用同一套客户端重试逻辑处理
+func SetRetryAfter(w http.ResponseWriter, d time.Duration) {
+	secs := int64(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	h := w.Header()
+	h.Set("Retry-After", strconv.FormatInt(secs, 10))
+	h.Set("X-RateLimit-Remaining", "0")
+	if h.Get("X-RateLimit-Reset") == "" {
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix()+secs, 10))
+	}
+}
+
+// ensureRetryHeaders 429/503 未设置 Retry-After 时按 DefaultRetryAfter 补齐
+func ensureRetryHeaders(w http.ResponseWriter, status int) {
+	if status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable {
+		return
+	}
+	if w.Header().Get("Retry-After") == "" {
+		SetRetryAfter(w, DefaultRetryAfter)
+	}
+}
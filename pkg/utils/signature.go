@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// SignValue 返回 value 的 HMAC-SHA256 签名（URL-safe base64），用于邮件退订等无需登录的链接
+func SignValue(secret, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignedValue 以常量时间比较签名
+func VerifySignedValue(secret, value, sig string) bool {
+	return hmac.Equal([]byte(SignValue(secret, value)), []byte(sig))
+}
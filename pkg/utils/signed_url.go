@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// DownloadToken 签名下载链接携带的声明：下载哪一类产物（Kind/ID）、签发给谁（UserID）、何时失效
+type DownloadToken struct {
+	Kind      string `json:"k"`
+	ID        string `json:"id"`
+	UserID    string `json:"u"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Expiry 返回失效时间
+func (t *DownloadToken) Expiry() time.Time {
+	return time.Unix(t.ExpiresAt, 0).UTC()
+}
+
+// SignDownloadToken 签发 "<payload>.<sig>" 形式的下载令牌（均为 URL-safe base64），可直接放在路径中
+func SignDownloadToken(secret string, t DownloadToken) string {
+	raw, _ := json.Marshal(t)
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + SignValue(secret, "download:"+payload)
+}
+
+// ParseDownloadToken 校验签名与有效期；签名错误、格式错误与过期一律返回 ErrLinkExpired，不区分原因
+func ParseDownloadToken(secret, token string) (*DownloadToken, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !VerifySignedValue(secret, "download:"+payload, sig) {
+		return nil, ErrLinkExpired
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrLinkExpired
+	}
+	var t DownloadToken
+	if err := json.Unmarshal(raw, &t); err != nil || t.Kind == "" || t.ID == "" || t.UserID == "" {
+		return nil, ErrLinkExpired
+	}
+	if time.Now().Unix() > t.ExpiresAt {
+		return nil, ErrLinkExpired
+	}
+	return &t, nil
+}
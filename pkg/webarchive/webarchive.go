@@ -0,0 +1,147 @@
+// Package webarchive 通过 Internet Archive 的 Save Page Now（SPN2）接口提交网页存档并查询结果，
+// 组织 opt-in 后保存的 URL 由定时任务提交，存档地址写入条目 metadata，链接失效后仍可访问。
+// 可选：未配置 WEB_ARCHIVE_ACCESS_KEY / WEB_ARCHIVE_SECRET_KEY 时不可用。
+package webarchive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tab-sync-backend-refactor/pkg/config"
+	"tab-sync-backend-refactor/pkg/tracing"
+)
+
+const (
+	defaultBaseURL = "https://web.archive.org"
+	requestTimeout = 10 * time.Second
+	maxBodyBytes   = 64 << 10
+)
+
+// 存档任务状态（SPN2 status 字段）
+const (
+	StatusPending = "pending"
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// ErrRateLimited 提交过于频繁（HTTP 429 或当日存档配额用尽）：本轮应停止提交，稍后重试
+var ErrRateLimited = errors.New("web archive rate limit reached")
+
+// Capture 存档任务的结果
+type Capture struct {
+	Status      string
+	ArchivedURL string // Status 为 success 时的存档地址（https://web.archive.org/web/<timestamp>/<url>）
+	Message     string // Status 为 error 时的原因
+}
+
+// Client Save Page Now 客户端
+type Client struct {
+	base      string
+	accessKey string
+	secretKey string
+	http      *http.Client
+}
+
+// Configured 是否配置了存档密钥
+func Configured(cfg *config.Config) bool {
+	return cfg.WebArchiveAccessKey != "" && cfg.WebArchiveSecretKey != ""
+}
+
+// New 创建客户端；调用方应先以 Configured 检查
+func New(cfg *config.Config) *Client {
+	return &Client{
+		base:      defaultBaseURL,
+		accessKey: cfg.WebArchiveAccessKey,
+		secretKey: cfg.WebArchiveSecretKey,
+		http:      tracing.NewHTTPClient(requestTimeout),
+	}
+}
+
+// Submit 提交 pageURL 存档，返回用于查询结果的任务 id
+func (c *Client) Submit(ctx context.Context, pageURL string) (string, error) {
+	form := url.Values{}
+	form.Set("url", pageURL)
+	form.Set("skip_first_archive", "1")
+	var resp struct {
+		JobID     string `json:"job_id"`
+		Status    string `json:"status"`
+		StatusExt string `json:"status_ext"`
+		Message   string `json:"message"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/save", strings.NewReader(form.Encode()), &resp); err != nil {
+		return "", err
+	}
+	if resp.JobID == "" {
+		if strings.Contains(resp.StatusExt, "too-many") {
+			return "", ErrRateLimited
+		}
+		return "", fmt.Errorf("save rejected: %s %s", resp.StatusExt, resp.Message)
+	}
+	return resp.JobID, nil
+}
+
+// Status 查询存档任务
+func (c *Client) Status(ctx context.Context, jobID string) (*Capture, error) {
+	var resp struct {
+		Status      string `json:"status"`
+		Timestamp   string `json:"timestamp"`
+		OriginalURL string `json:"original_url"`
+		StatusExt   string `json:"status_ext"`
+		Message     string `json:"message"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/save/status/"+url.PathEscape(jobID), nil, &resp); err != nil {
+		return nil, err
+	}
+	capture := &Capture{Status: resp.Status}
+	switch resp.Status {
+	case StatusSuccess:
+		if resp.Timestamp == "" || resp.OriginalURL == "" {
+			return nil, errors.New("success status without timestamp or original_url")
+		}
+		capture.ArchivedURL = c.base + "/web/" + resp.Timestamp + "/" + resp.OriginalURL
+	case StatusError:
+		capture.Message = strings.TrimSpace(resp.StatusExt + " " + resp.Message)
+	case StatusPending:
+	default:
+		return nil, fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	return capture, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "LOW "+c.accessKey+":"+c.secretKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("web archive %s %s: status %d", method, path, resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("failed to parse web archive response: %w", err)
+	}
+	return nil
+}
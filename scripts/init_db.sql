@@ -16,6 +16,15 @@ CREATE TABLE IF NOT EXISTS users (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- 计费字段（由 Paddle webhook 写入）
+ALTER TABLE users ADD COLUMN IF NOT EXISTS paddle_customer_id VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS trial_ends_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS trial_active BOOLEAN DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dunning_status VARCHAR(20);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dunning_started_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_lifetime_member BOOLEAN DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS lifetime_member_type VARCHAR(50);
+
 -- 创建快照表
 CREATE TABLE IF NOT EXISTS snapshots (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -79,8 +88,14 @@ CREATE TABLE IF NOT EXISTS ai_credits (
 
 -- 创建索引
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_users_paddle_customer_id ON users(paddle_customer_id);
+CREATE INDEX IF NOT EXISTS idx_users_active_trials ON users(trial_ends_at) WHERE trial_active;
+CREATE INDEX IF NOT EXISTS idx_users_dunning_grace ON users(dunning_started_at) WHERE dunning_status = 'grace';
 CREATE INDEX IF NOT EXISTS idx_snapshots_user_id ON snapshots(user_id);
 CREATE INDEX IF NOT EXISTS idx_snapshots_user_name ON snapshots(user_id, name);
+-- 快照类型：manual（用户保存）/ auto（扩展定时捕获，按 SNAPSHOT_AUTO_KEEP 保留最近若干个）
+ALTER TABLE snapshots ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'manual';
+CREATE INDEX IF NOT EXISTS idx_snapshots_user_kind ON snapshots(user_id, kind, updated_at DESC);
 CREATE INDEX IF NOT EXISTS idx_user_subscriptions_user_id ON user_subscriptions(user_id);
 CREATE INDEX IF NOT EXISTS idx_ai_credits_user_id ON ai_credits(user_id);
 
@@ -205,6 +220,11 @@ CREATE INDEX IF NOT EXISTS idx_space_permissions_user ON space_permissions(user_
 CREATE INDEX IF NOT EXISTS idx_invitations_email ON organization_invitations(email);
 CREATE INDEX IF NOT EXISTS idx_invitations_org ON organization_invitations(organization_id);
 
+-- 按用户 ID 邀请（或邀请时邮箱已注册）：记录被邀请用户，支持应用内接受；邮箱不区分大小写匹配
+ALTER TABLE organization_invitations ADD COLUMN IF NOT EXISTS invitee_id UUID NULL REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_invitations_invitee ON organization_invitations(invitee_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_email_lower ON organization_invitations(lower(email));
+
 -- Triggers for updated_at
 DROP TRIGGER IF EXISTS update_organizations_updated_at ON organizations;
 CREATE TRIGGER update_organizations_updated_at BEFORE UPDATE ON organizations FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -243,6 +263,10 @@ CREATE TRIGGER update_collections_updated_at BEFORE UPDATE ON collections FOR EA
 -- Soft delete columns (idempotent)
 ALTER TABLE IF EXISTS organizations ADD COLUMN IF NOT EXISTS color VARCHAR(20);
 ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE NULL;
+-- 空间默认权限：普通成员未单独设置 space_permissions 时的权限（edit / view / restricted）
+ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS default_access VARCHAR(20) NOT NULL DEFAULT 'view';
+-- 空间可见性：private 仅对有显式 space_permissions 的成员可见
+ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'org';
 ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE NULL;
 
 -- Helpful indexes for soft delete filtering
@@ -275,3 +299,598 @@ CREATE INDEX IF NOT EXISTS idx_items_collection_deleted ON collection_items(coll
 
 DROP TRIGGER IF EXISTS update_collection_items_updated_at ON collection_items;
 CREATE TRIGGER update_collection_items_updated_at BEFORE UPDATE ON collection_items FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- =============================
+-- Promo codes
+-- =============================
+
+-- kind: paddle_discount（结账时传给 Paddle 的 discount_id）| tier_upgrade（免付费临时升级）| ai_credits（赠送 AI 积分）
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(64) NOT NULL UNIQUE,
+    kind VARCHAR(20) NOT NULL,
+    paddle_discount_id VARCHAR(255),
+    tier VARCHAR(20),
+    duration_days INTEGER NOT NULL DEFAULT 0,
+    credits INTEGER NOT NULL DEFAULT 0,
+    max_redemptions INTEGER,
+    redemption_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    promo_id UUID NOT NULL REFERENCES promo_codes(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redeemed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (promo_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_promo_redemptions_user ON promo_redemptions(user_id);
+
+DROP TRIGGER IF EXISTS update_promo_codes_updated_at ON promo_codes;
+CREATE TRIGGER update_promo_codes_updated_at BEFORE UPDATE ON promo_codes FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- =============================
+-- In-app notifications
+-- =============================
+
+-- dedupe_key 非空时同一用户只保留一条（定时任务重复运行不会重复提醒）
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    data JSONB NOT NULL DEFAULT '{}',
+    dedupe_key VARCHAR(255),
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, dedupe_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+-- 通知偏好：无记录的用户使用默认值（接收每周摘要）
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    weekly_digest BOOLEAN NOT NULL DEFAULT true,
+    last_digest_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+DROP TRIGGER IF EXISTS update_notification_preferences_updated_at ON notification_preferences;
+CREATE TRIGGER update_notification_preferences_updated_at BEFORE UPDATE ON notification_preferences FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 每周摘要统计新增条目与失效链接（metadata.link_status = 'dead'）
+CREATE INDEX IF NOT EXISTS idx_items_created_at ON collection_items(created_at) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_space_permissions_user_created ON space_permissions(user_id, created_at);
+
+-- GDPR 数据导出：POST /api/user/export 入队，/api/cron/process-exports 生成 zip 存入 archive，过期后清空
+CREATE TABLE IF NOT EXISTS data_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending | processing | ready | failed | expired
+    archive BYTEA,
+    size_bytes BIGINT,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_created ON data_exports(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_data_exports_status ON data_exports(status, created_at);
+
+-- 数据驻留：组织固定的数据区域（NULL 为主库所在区域）；其余区域的组织内容存放在对应的区域库（见 init_region_db.sql）
+ALTER TABLE IF EXISTS organizations ADD COLUMN IF NOT EXISTS region VARCHAR(8);
+
+-- 应用层加密：组织数据密钥（由 ENCRYPTION_MASTER_KEY 包装；NULL 表示未启用）。密文长于明文，条目的文本列放宽为 TEXT
+ALTER TABLE IF EXISTS organizations ADD COLUMN IF NOT EXISTS encrypted_data_key TEXT;
+ALTER TABLE IF EXISTS collection_items
+    ALTER COLUMN title TYPE TEXT,
+    ALTER COLUMN original_title TYPE TEXT,
+    ALTER COLUMN ai_generated_title TYPE TEXT,
+    ALTER COLUMN domain TYPE TEXT;
+
+-- 空间访客邀请：邀请外部协作者访问单个空间（接受后写入 space_permissions，不成为组织成员）
+CREATE TABLE IF NOT EXISTS space_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- 区域组织的空间只在区域库，space_id 不引用 spaces 表
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    space_id UUID NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    inviter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(255) NOT NULL UNIQUE,
+    can_edit BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_space_invitations_space ON space_invitations(space_id);
+
+-- 外部身份：OAuth 登录按 provider + provider_user_id 匹配用户；邮箱相同但未关联的账户需由用户登录后显式关联
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    provider_user_id VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (provider, provider_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+-- 一次性会话码：定价页会话码（pricing_session JWT）兑换后记录其 JTI，拒绝重放；记录在令牌过期后清理
+CREATE TABLE IF NOT EXISTS consumed_session_codes (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    consumed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_consumed_session_codes_expires ON consumed_session_codes(expires_at);
+
+-- 设备：每个扩展安装一条（install_id 由扩展生成）；心跳刷新 last_seen 与 last_sync_cursor，吊销后心跳被拒绝、重新登录注册时恢复
+CREATE TABLE IF NOT EXISTS devices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    install_id VARCHAR(128) NOT NULL,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    browser VARCHAR(50) NOT NULL DEFAULT '',
+    platform VARCHAR(50) NOT NULL DEFAULT '',
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_sync_cursor VARCHAR(255),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, install_id)
+);
+
+-- 选择性同步：设备订阅的空间（无记录表示同步全部空间）；space_id 不加外键，空间可能位于区域库
+CREATE TABLE IF NOT EXISTS device_spaces (
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    space_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (device_id, space_id)
+);
+
+-- 发送到设备：pending → delivered（目标设备轮询取走）→ opened/dismissed（目标设备回报）；超过 7 天未处理的推送不再下发
+CREATE TABLE IF NOT EXISTS device_pushes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    target_device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    urls TEXT[] NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_pushes_target ON device_pushes(target_device_id, created_at) WHERE completed_at IS NULL;
+
+-- 组织共享快照：组织成员可保存/恢复，按 (organization_id, name) 唯一；固定到其他区域的组织存放在区域库（见 init_region_db.sql）
+CREATE TABLE IF NOT EXISTS org_snapshots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    tab_groups JSONB NOT NULL,
+    group_count INTEGER DEFAULT 0,
+    tab_count INTEGER DEFAULT 0,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (organization_id, name)
+);
+
+-- 集合条目计数缓存：item_count / last_item_added_at 由 collection_items 上的触发器维护（软删除、恢复、移动均会同步），
+-- 列表视图无需拉取条目即可渲染数量。下方 UPDATE 为已有数据回填，重复执行结果不变
+ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS item_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS last_item_added_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE OR REPLACE FUNCTION update_collection_item_stats()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    -- 离开旧集合（硬删除、软删除或移动到其他集合）
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.deleted_at IS NULL
+       AND (TG_OP = 'DELETE' OR NEW.deleted_at IS NOT NULL OR NEW.collection_id <> OLD.collection_id) THEN
+        UPDATE collections SET item_count = GREATEST(item_count - 1, 0) WHERE id = OLD.collection_id;
+    END IF;
+    -- 进入新集合（新建、恢复或从其他集合移入）
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.deleted_at IS NULL
+       AND (TG_OP = 'INSERT' OR OLD.deleted_at IS NOT NULL OR NEW.collection_id <> OLD.collection_id) THEN
+        UPDATE collections
+        SET item_count = item_count + 1,
+            last_item_added_at = GREATEST(COALESCE(last_item_added_at, NEW.created_at), NEW.created_at)
+        WHERE id = NEW.collection_id;
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS collection_items_stats ON collection_items;
+CREATE TRIGGER collection_items_stats AFTER INSERT OR UPDATE OF deleted_at, collection_id OR DELETE ON collection_items
+    FOR EACH ROW EXECUTE FUNCTION update_collection_item_stats();
+
+UPDATE collections c SET
+    item_count = s.cnt,
+    last_item_added_at = s.last_added
+FROM (
+    SELECT c2.id, COUNT(i.id) AS cnt, MAX(i.created_at) AS last_added
+    FROM collections c2
+    LEFT JOIN collection_items i ON i.collection_id = c2.id AND i.deleted_at IS NULL
+    GROUP BY c2.id
+) s
+WHERE c.id = s.id AND (c.item_count IS DISTINCT FROM s.cnt OR c.last_item_added_at IS DISTINCT FROM s.last_added);
+
+-- 令牌版本：等级、终身会员或组织成员关系变化时由触发器递增；携带旧版本的访问令牌会被要求刷新（见 middleware.TokenVersion）
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;
+-- 会话吊销时间：检测到可疑活动（见 ANOMALY_REAUTH）时设置，此前签发的刷新令牌失效
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sessions_revoked_at TIMESTAMP WITH TIME ZONE;
+
+CREATE OR REPLACE FUNCTION bump_user_token_version()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.tier IS DISTINCT FROM OLD.tier
+       OR NEW.is_lifetime_member IS DISTINCT FROM OLD.is_lifetime_member
+       OR NEW.lifetime_member_type IS DISTINCT FROM OLD.lifetime_member_type
+       OR NEW.sessions_revoked_at IS DISTINCT FROM OLD.sessions_revoked_at THEN
+        NEW.token_version := OLD.token_version + 1;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS users_token_version ON users;
+CREATE TRIGGER users_token_version BEFORE UPDATE ON users FOR EACH ROW EXECUTE FUNCTION bump_user_token_version();
+
+-- 成员加入、退出、角色变更，以及组织创建、转让、删除时递增相关用户的令牌版本
+CREATE OR REPLACE FUNCTION bump_member_token_version()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    old_user UUID;
+    new_user UUID;
+BEGIN
+    IF TG_TABLE_NAME = 'organizations' THEN
+        IF TG_OP <> 'INSERT' THEN old_user := OLD.owner_id; END IF;
+        IF TG_OP <> 'DELETE' THEN new_user := NEW.owner_id; END IF;
+    ELSE
+        IF TG_OP <> 'INSERT' THEN old_user := OLD.user_id; END IF;
+        IF TG_OP <> 'DELETE' THEN new_user := NEW.user_id; END IF;
+    END IF;
+    UPDATE users SET token_version = token_version + 1 WHERE id IN (old_user, new_user);
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS organization_memberships_token_version ON organization_memberships;
+CREATE TRIGGER organization_memberships_token_version AFTER INSERT OR UPDATE OF user_id, role OR DELETE ON organization_memberships
+    FOR EACH ROW EXECUTE FUNCTION bump_member_token_version();
+
+DROP TRIGGER IF EXISTS organizations_token_version ON organizations;
+CREATE TRIGGER organizations_token_version AFTER INSERT OR UPDATE OF owner_id OR DELETE ON organizations
+    FOR EACH ROW EXECUTE FUNCTION bump_member_token_version();
+
+-- A/B 实验曝光：客户端真正展示实验内容时记录（每个用户、实验、变体只记首次曝光），变体由服务端按用户 ID 哈希分配
+CREATE TABLE IF NOT EXISTS experiment_exposures (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    experiment_key VARCHAR(100) NOT NULL,
+    variant VARCHAR(100) NOT NULL,
+    exposed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, experiment_key, variant)
+);
+
+CREATE INDEX IF NOT EXISTS idx_experiment_exposures_key ON experiment_exposures(experiment_key, variant, exposed_at);
+
+-- 登录记录（账户安全页）：每次成功登录一条，附客户端 IP 与 GeoIP 位置（未配置 GEOIP_PROVIDER 时位置为空）
+CREATE TABLE IF NOT EXISTS login_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    method VARCHAR(30) NOT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    country VARCHAR(2) NOT NULL DEFAULT '',
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user ON login_events(user_id, created_at DESC);
+
+-- 设备最近一次注册时的 IP 与位置
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS last_ip VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS country VARCHAR(2) NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS region VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS city VARCHAR(100) NOT NULL DEFAULT '';
+
+-- 邀请令牌只存 SHA-256 摘要（十六进制），数据库泄露不会暴露仍有效的邀请链接。
+-- 空间邀请通知改为携带邀请 ID（应用内按 ID 接受），先按明文令牌回填，再把存量令牌换成摘要；可重复执行
+UPDATE notifications n
+SET data = (n.data - 'space_invitation_token') || jsonb_build_object('space_invitation_id', si.id::text)
+FROM space_invitations si
+WHERE n.data ? 'space_invitation_token' AND si.token = n.data->>'space_invitation_token';
+UPDATE notifications SET data = data - 'space_invitation_token' WHERE data ? 'space_invitation_token';
+
+UPDATE organization_invitations SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex') WHERE token !~ '^[0-9a-f]{64}$';
+UPDATE space_invitations SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex') WHERE token !~ '^[0-9a-f]{64}$';
+
+-- 空间颜色与图标（与 collections 相同：color 为 hex 或命名颜色，icon 为图标名或 emoji）
+ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS color VARCHAR(20);
+ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS icon VARCHAR(50);
+
+-- 每个组织至多一个默认空间：先保留每个组织最早创建的默认空间，再建部分唯一索引；
+-- 设为默认时由应用在同一事务中先取消旧的默认空间
+UPDATE spaces s SET is_default = FALSE, updated_at = NOW()
+WHERE s.is_default AND s.deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM spaces d
+    WHERE d.organization_id = s.organization_id AND d.is_default AND d.deleted_at IS NULL
+      AND (d.created_at, d.id) < (s.created_at, s.id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spaces_single_default ON spaces(organization_id) WHERE is_default AND deleted_at IS NULL;
+
+-- 组织 slug（/o/{slug} 分享链接）：小写 a-z、0-9 与连字符，全局唯一。
+-- 存量组织按名称生成并追加 ID 前缀保证唯一；名称无 ASCII 字母数字时使用 "org"
+ALTER TABLE IF EXISTS organizations ADD COLUMN IF NOT EXISTS slug VARCHAR(40);
+UPDATE organizations SET slug = COALESCE(NULLIF(left(trim(both '-' from regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g')), 31), ''), 'org')
+    || '-' || left(replace(id::text, '-', ''), 8)
+WHERE slug IS NULL;
+UPDATE organizations SET slug = replace(slug, '--', '-') WHERE slug LIKE '%--%';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organizations_slug ON organizations(slug);
+
+-- 邮箱不区分大小写：应用写入前统一 trim + 小写，按 lower(email) 查找。
+-- 存量邮箱转为小写；仅大小写不同的重复账户保持原样（需人工合并），不会因唯一约束导致迁移失败
+UPDATE users u SET email = lower(trim(u.email)), updated_at = NOW()
+WHERE u.email <> lower(trim(u.email)) AND NOT EXISTS (
+    SELECT 1 FROM users d WHERE d.id <> u.id AND lower(trim(d.email)) = lower(trim(u.email)));
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
+UPDATE organization_invitations SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+UPDATE space_invitations SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+UPDATE user_identities SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+
+-- 等级变化历史：webhook、试用、催缴、优惠码等每次改变 users.tier 时追加一行（管理 API 查询）
+CREATE TABLE IF NOT EXISTS tier_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_tier VARCHAR(20) NOT NULL DEFAULT '',
+    new_tier VARCHAR(20) NOT NULL,
+    source VARCHAR(100) NOT NULL,
+    reference_id VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tier_changes_user ON tier_changes(user_id, created_at DESC);
+
+-- 分块上传快照：慢速网络下大快照分块上传（init → 逐块 PUT → commit），commit 时组装校验后写入 snapshots / org_snapshots
+CREATE TABLE IF NOT EXISTS snapshot_uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE, -- NULL 为个人快照
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL DEFAULT 'manual',
+    total_bytes BIGINT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshot_uploads_expires ON snapshot_uploads(expires_at);
+
+CREATE TABLE IF NOT EXISTS snapshot_upload_chunks (
+    upload_id UUID NOT NULL REFERENCES snapshot_uploads(id) ON DELETE CASCADE,
+    chunk_index INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (upload_id, chunk_index)
+);
+
+-- 条目归档：与删除不同，归档条目仍保留在集合中，只是不出现在默认（active）列表
+ALTER TABLE IF EXISTS collection_items ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE NULL;
+CREATE INDEX IF NOT EXISTS idx_items_collection_archived ON collection_items(collection_id, archived_at) WHERE deleted_at IS NULL;
+
+-- 条目历史：title/url/metadata 被修改前的值由触发器写入 item_revisions（每个条目保留最近 50 个版本），
+-- 误操作（AI 标题覆盖、批量编辑）可经 /api/collection-items/{id}/revisions 回滚。加密组织的历史与条目一样是密文
+CREATE TABLE IF NOT EXISTS item_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    item_id UUID NOT NULL REFERENCES collection_items(id) ON DELETE CASCADE,
+    collection_id UUID NOT NULL,
+    title TEXT NOT NULL,
+    url TEXT,
+    metadata JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_item_revisions_item ON item_revisions(item_id, created_at DESC);
+
+CREATE OR REPLACE FUNCTION record_item_revision()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.title IS DISTINCT FROM OLD.title
+       OR NEW.url IS DISTINCT FROM OLD.url
+       OR NEW.metadata IS DISTINCT FROM OLD.metadata THEN
+        INSERT INTO item_revisions (item_id, collection_id, title, url, metadata, created_at)
+        VALUES (OLD.id, OLD.collection_id, OLD.title, OLD.url, OLD.metadata, clock_timestamp());
+        DELETE FROM item_revisions WHERE id IN (
+            SELECT id FROM item_revisions WHERE item_id = OLD.id
+            ORDER BY created_at DESC, id DESC OFFSET 50
+        );
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS collection_items_revision ON collection_items;
+CREATE TRIGGER collection_items_revision AFTER UPDATE OF title, url, metadata ON collection_items
+    FOR EACH ROW EXECUTE FUNCTION record_item_revision();
+
+-- 智能集合：type='smart' 的集合没有自己的条目，query（JSONB，domain / tag / added_within）在读取时对同一空间的条目求值
+ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS type VARCHAR(16) NOT NULL DEFAULT 'manual';
+ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS query JSONB;
+
+-- 快速保存的元数据补全队列：/api/quick-save 只保存 URL 与标题，/api/cron/enrich-items 抓取页面补全标题、favicon 与描述。
+-- 只存条目 id（条目可能在区域库，不加外键）；认领超时后重试，超过次数上限放弃
+CREATE TABLE IF NOT EXISTS item_enrichments (
+    item_id UUID PRIMARY KEY,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    claimed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_item_enrichments_created ON item_enrichments(created_at);
+
+-- 收件箱整理：snoozed_until 之前条目不出现在 GET /api/inbox（普通集合列表不受影响）
+ALTER TABLE IF EXISTS collection_items ADD COLUMN IF NOT EXISTS snoozed_until TIMESTAMP WITH TIME ZONE NULL;
+
+-- 条目提醒：每个用户在每个条目上至多一条（共享空间的成员各自设置），/api/cron/send-reminders 到期时发送站内通知（可选邮件）。
+-- 只存 id（条目可能在区域库，不加条目外键）；条目删除后由任务顺带清理
+CREATE TABLE IF NOT EXISTS item_reminders (
+    item_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    remind_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    email BOOLEAN NOT NULL DEFAULT FALSE,
+    notified_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (item_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_item_reminders_due ON item_reminders(remind_at) WHERE notified_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_item_reminders_user ON item_reminders(user_id, remind_at);
+
+-- 网页存档（可选，需配置 WEB_ARCHIVE_ACCESS_KEY / WEB_ARCHIVE_SECRET_KEY）：组织 owner/admin 开启后，新保存的条目加入
+-- web_archive_jobs，/api/cron/web-archive 提交到 Internet Archive（Save Page Now）并轮询结果，存档地址写入条目 metadata.web_archive_url。
+-- 队列只存 id（条目可能在区域库，不加条目外键）
+CREATE TABLE IF NOT EXISTS organization_web_archive (
+    organization_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    enabled_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    enabled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS web_archive_jobs (
+    item_id UUID PRIMARY KEY,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    job_id TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    claimed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_web_archive_jobs_next ON web_archive_jobs(next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_web_archive_jobs_org ON web_archive_jobs(organization_id);
+
+-- 浏览器历史导入：扩展分页读取历史记录，按序号分批 POST /api/import/history，条目按本地访问日期分到 "History YYYY-MM-DD" 集合。
+-- 每个批次的结果记一行，进度为各批次合计；重发已记录的批次不会重复计数。
+-- 导入记录在主库，只存空间 id（空间可能在区域库，不加外键）
+CREATE TABLE IF NOT EXISTS history_imports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    space_id UUID NOT NULL,
+    utc_offset_minutes INTEGER NOT NULL DEFAULT 0,
+    total_entries INTEGER NOT NULL DEFAULT 0,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_history_imports_user ON history_imports(user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS history_import_batches (
+    import_id UUID NOT NULL REFERENCES history_imports(id) ON DELETE CASCADE,
+    batch_index INTEGER NOT NULL,
+    received INTEGER NOT NULL,
+    imported INTEGER NOT NULL,
+    duplicates INTEGER NOT NULL,
+    skipped INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (import_id, batch_index)
+);
+
+-- 组织内容策略：owner/admin 设置的域名规则（匹配域名本身及子域名），block 拒绝保存（POLICY_BLOCKED），warn 允许保存并在响应中提示。
+-- 命中的保存（含被拒绝的尝试）记入 policy_violations 供审计；只记录主机名，不记录完整 URL（加密组织的 URL 是密文）
+CREATE TABLE IF NOT EXISTS organization_domain_policies (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    domain VARCHAR(253) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, domain)
+);
+
+CREATE TABLE IF NOT EXISTS policy_violations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    domain VARCHAR(253) NOT NULL,
+    host VARCHAR(253) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    source VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_policy_violations_org ON policy_violations(organization_id, created_at DESC);
+
+-- 历史导入中被域名策略拒绝的条目数
+ALTER TABLE IF EXISTS history_import_batches ADD COLUMN IF NOT EXISTS blocked INTEGER NOT NULL DEFAULT 0;
+
+-- Paddle webhook 去重：记录已处理的事件 ID，重复投递直接忽略；处理失败时删除记录，让 Paddle 重试
+CREATE TABLE IF NOT EXISTS paddle_webhook_events (
+    event_id VARCHAR(64) PRIMARY KEY,
+    event_type VARCHAR(64) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- 空间访客：接受 space_invitations 时写入，与 space_permissions 同库（区域组织在区域库）。访客身份只认此表，
+-- 不由"非组织成员 + 显式权限"推断，成员离开组织后残留的显式权限也不会让其变成访客
+CREATE TABLE IF NOT EXISTS space_guests (
+    space_id UUID NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    invitation_id UUID NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (space_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_space_guests_user ON space_guests(user_id);
+
+-- 回填已接受且仍有显式权限的访客邀请
+INSERT INTO space_guests (space_id, user_id, invitation_id, created_at)
+SELECT DISTINCT ON (si.space_id, si.accepted_by) si.space_id, si.accepted_by, si.id, si.updated_at
+FROM space_invitations si
+JOIN spaces s ON s.id = si.space_id
+JOIN space_permissions p ON p.space_id = si.space_id AND p.user_id = si.accepted_by
+WHERE si.status = 'accepted' AND si.accepted_by IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM organization_memberships m WHERE m.organization_id = si.organization_id AND m.user_id = si.accepted_by)
+ORDER BY si.space_id, si.accepted_by, si.updated_at DESC
+ON CONFLICT DO NOTHING;
+
+-- 成员离开组织时删除其在该组织各空间的显式权限与访客记录（区域库的成员关系副本上有同样的触发器）
+CREATE OR REPLACE FUNCTION purge_member_space_permissions()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    DELETE FROM space_permissions p USING spaces s
+    WHERE p.space_id = s.id AND s.organization_id = OLD.organization_id AND p.user_id = OLD.user_id;
+    DELETE FROM space_guests g USING spaces s
+    WHERE g.space_id = s.id AND s.organization_id = OLD.organization_id AND g.user_id = OLD.user_id;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS organization_memberships_purge_space_permissions ON organization_memberships;
+CREATE TRIGGER organization_memberships_purge_space_permissions AFTER DELETE ON organization_memberships
+    FOR EACH ROW EXECUTE FUNCTION purge_member_space_permissions();
+
+-- 清理已有的残留：既不是 owner、成员，也不是访客的显式权限
+DELETE FROM space_permissions p USING spaces s, organizations o
+WHERE p.space_id = s.id AND o.id = s.organization_id AND o.owner_id <> p.user_id
+  AND NOT EXISTS (SELECT 1 FROM organization_memberships m WHERE m.organization_id = o.id AND m.user_id = p.user_id)
+  AND NOT EXISTS (SELECT 1 FROM space_guests g WHERE g.space_id = p.space_id AND g.user_id = p.user_id);
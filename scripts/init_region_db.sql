@@ -0,0 +1,274 @@
+-- 区域数据库（数据驻留）：固定到该区域的组织的内容只存放在这里。
+-- 用户、计费等账户数据留在主库，因此这里的 owner_id / user_id 不引用 users 表；
+-- organizations 与 organization_memberships 是主库目录的副本，使成员范围校验可以在本库内完成（不跨区域 JOIN）。
+
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    owner_id UUID NOT NULL,
+    description TEXT,
+    avatar TEXT,
+    color VARCHAR(20),
+    region VARCHAR(8),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS organization_memberships (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'member',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(organization_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS spaces (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    is_default BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE TABLE IF NOT EXISTS space_permissions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    space_id UUID NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    can_edit BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(space_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    space_id UUID NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    color VARCHAR(20),
+    icon VARCHAR(50),
+    position INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE TABLE IF NOT EXISTS collection_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    title VARCHAR(512) NOT NULL,
+    url TEXT,
+    fav_icon_url TEXT,
+    original_title VARCHAR(512),
+    ai_generated_title VARCHAR(512),
+    domain VARCHAR(255),
+    metadata JSONB DEFAULT '{}',
+    position INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_memberships_user ON organization_memberships(user_id);
+CREATE INDEX IF NOT EXISTS idx_memberships_org ON organization_memberships(organization_id);
+CREATE INDEX IF NOT EXISTS idx_spaces_org_deleted ON spaces(organization_id, deleted_at);
+CREATE INDEX IF NOT EXISTS idx_space_permissions_space ON space_permissions(space_id);
+CREATE INDEX IF NOT EXISTS idx_space_permissions_user_created ON space_permissions(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_collections_space_deleted ON collections(space_id, deleted_at);
+CREATE INDEX IF NOT EXISTS idx_collections_space_pos ON collections(space_id, position);
+CREATE INDEX IF NOT EXISTS idx_items_collection_deleted ON collection_items(collection_id, deleted_at);
+CREATE INDEX IF NOT EXISTS idx_items_collection_pos ON collection_items(collection_id, position);
+CREATE INDEX IF NOT EXISTS idx_items_created_at ON collection_items(created_at) WHERE deleted_at IS NULL;
+
+DROP TRIGGER IF EXISTS update_organizations_updated_at ON organizations;
+CREATE TRIGGER update_organizations_updated_at BEFORE UPDATE ON organizations FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_spaces_updated_at ON spaces;
+CREATE TRIGGER update_spaces_updated_at BEFORE UPDATE ON spaces FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_space_permissions_updated_at ON space_permissions;
+CREATE TRIGGER update_space_permissions_updated_at BEFORE UPDATE ON space_permissions FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_collections_updated_at ON collections;
+CREATE TRIGGER update_collections_updated_at BEFORE UPDATE ON collections FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_collection_items_updated_at ON collection_items;
+CREATE TRIGGER update_collection_items_updated_at BEFORE UPDATE ON collection_items FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 应用层加密：数据密钥只存主库目录；区域库的条目可能为密文，文本列放宽为 TEXT
+ALTER TABLE IF EXISTS collection_items
+    ALTER COLUMN title TYPE TEXT,
+    ALTER COLUMN original_title TYPE TEXT,
+    ALTER COLUMN ai_generated_title TYPE TEXT,
+    ALTER COLUMN domain TYPE TEXT;
+
+-- 空间默认权限与可见性（见 init_db.sql）
+ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS default_access VARCHAR(20) NOT NULL DEFAULT 'view';
+ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'org';
+
+-- 空间颜色与图标（见 init_db.sql）
+ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS color VARCHAR(20);
+ALTER TABLE IF EXISTS spaces ADD COLUMN IF NOT EXISTS icon VARCHAR(50);
+
+-- 每个组织至多一个默认空间（见 init_db.sql）：先保留每个组织最早创建的默认空间，再建部分唯一索引
+UPDATE spaces s SET is_default = FALSE, updated_at = NOW()
+WHERE s.is_default AND s.deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM spaces d
+    WHERE d.organization_id = s.organization_id AND d.is_default AND d.deleted_at IS NULL
+      AND (d.created_at, d.id) < (s.created_at, s.id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spaces_single_default ON spaces(organization_id) WHERE is_default AND deleted_at IS NULL;
+
+-- 组织共享快照（见 init_db.sql）；created_by / updated_by 为主库用户 ID，不加外键
+CREATE TABLE IF NOT EXISTS org_snapshots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    tab_groups JSONB NOT NULL,
+    group_count INTEGER DEFAULT 0,
+    tab_count INTEGER DEFAULT 0,
+    created_by UUID,
+    updated_by UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (organization_id, name)
+);
+
+-- 集合条目计数缓存（见 init_db.sql）
+ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS item_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS last_item_added_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE OR REPLACE FUNCTION update_collection_item_stats()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    -- 离开旧集合（硬删除、软删除或移动到其他集合）
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.deleted_at IS NULL
+       AND (TG_OP = 'DELETE' OR NEW.deleted_at IS NOT NULL OR NEW.collection_id <> OLD.collection_id) THEN
+        UPDATE collections SET item_count = GREATEST(item_count - 1, 0) WHERE id = OLD.collection_id;
+    END IF;
+    -- 进入新集合（新建、恢复或从其他集合移入）
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.deleted_at IS NULL
+       AND (TG_OP = 'INSERT' OR OLD.deleted_at IS NOT NULL OR NEW.collection_id <> OLD.collection_id) THEN
+        UPDATE collections
+        SET item_count = item_count + 1,
+            last_item_added_at = GREATEST(COALESCE(last_item_added_at, NEW.created_at), NEW.created_at)
+        WHERE id = NEW.collection_id;
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS collection_items_stats ON collection_items;
+CREATE TRIGGER collection_items_stats AFTER INSERT OR UPDATE OF deleted_at, collection_id OR DELETE ON collection_items
+    FOR EACH ROW EXECUTE FUNCTION update_collection_item_stats();
+
+UPDATE collections c SET
+    item_count = s.cnt,
+    last_item_added_at = s.last_added
+FROM (
+    SELECT c2.id, COUNT(i.id) AS cnt, MAX(i.created_at) AS last_added
+    FROM collections c2
+    LEFT JOIN collection_items i ON i.collection_id = c2.id AND i.deleted_at IS NULL
+    GROUP BY c2.id
+) s
+WHERE c.id = s.id AND (c.item_count IS DISTINCT FROM s.cnt OR c.last_item_added_at IS DISTINCT FROM s.last_added);
+
+-- 条目归档：与删除不同，归档条目仍保留在集合中，只是不出现在默认（active）列表
+ALTER TABLE IF EXISTS collection_items ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE NULL;
+CREATE INDEX IF NOT EXISTS idx_items_collection_archived ON collection_items(collection_id, archived_at) WHERE deleted_at IS NULL;
+
+-- 条目历史：title/url/metadata 被修改前的值由触发器写入 item_revisions（每个条目保留最近 50 个版本），
+-- 误操作（AI 标题覆盖、批量编辑）可经 /api/collection-items/{id}/revisions 回滚。加密组织的历史与条目一样是密文
+CREATE TABLE IF NOT EXISTS item_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    item_id UUID NOT NULL REFERENCES collection_items(id) ON DELETE CASCADE,
+    collection_id UUID NOT NULL,
+    title TEXT NOT NULL,
+    url TEXT,
+    metadata JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_item_revisions_item ON item_revisions(item_id, created_at DESC);
+
+CREATE OR REPLACE FUNCTION record_item_revision()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.title IS DISTINCT FROM OLD.title
+       OR NEW.url IS DISTINCT FROM OLD.url
+       OR NEW.metadata IS DISTINCT FROM OLD.metadata THEN
+        INSERT INTO item_revisions (item_id, collection_id, title, url, metadata, created_at)
+        VALUES (OLD.id, OLD.collection_id, OLD.title, OLD.url, OLD.metadata, clock_timestamp());
+        DELETE FROM item_revisions WHERE id IN (
+            SELECT id FROM item_revisions WHERE item_id = OLD.id
+            ORDER BY created_at DESC, id DESC OFFSET 50
+        );
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS collection_items_revision ON collection_items;
+CREATE TRIGGER collection_items_revision AFTER UPDATE OF title, url, metadata ON collection_items
+    FOR EACH ROW EXECUTE FUNCTION record_item_revision();
+
+-- 智能集合：type='smart' 的集合没有自己的条目，query（JSONB，domain / tag / added_within）在读取时对同一空间的条目求值
+ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS type VARCHAR(16) NOT NULL DEFAULT 'manual';
+ALTER TABLE IF EXISTS collections ADD COLUMN IF NOT EXISTS query JSONB;
+
+-- 收件箱整理：snoozed_until 之前条目不出现在 GET /api/inbox（普通集合列表不受影响）
+ALTER TABLE IF EXISTS collection_items ADD COLUMN IF NOT EXISTS snoozed_until TIMESTAMP WITH TIME ZONE NULL;
+
+-- 空间访客（见 init_db.sql）：接受 space_invitations 时写入。访客身份只认此表，残留的显式权限不会让非成员变成访客
+CREATE TABLE IF NOT EXISTS space_guests (
+    space_id UUID NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    invitation_id UUID NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (space_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_space_guests_user ON space_guests(user_id);
+
+-- 邀请记录在主库，区域库无法按邀请回填：表为空（首次创建）时按原规则（非 owner、非成员的显式权限）回填一次
+INSERT INTO space_guests (space_id, user_id, created_at)
+SELECT p.space_id, p.user_id, p.created_at
+FROM space_permissions p
+JOIN spaces s ON s.id = p.space_id
+JOIN organizations o ON o.id = s.organization_id
+WHERE o.owner_id <> p.user_id
+  AND NOT EXISTS (SELECT 1 FROM organization_memberships m WHERE m.organization_id = o.id AND m.user_id = p.user_id)
+  AND NOT EXISTS (SELECT 1 FROM space_guests)
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION purge_member_space_permissions()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    DELETE FROM space_permissions p USING spaces s
+    WHERE p.space_id = s.id AND s.organization_id = OLD.organization_id AND p.user_id = OLD.user_id;
+    DELETE FROM space_guests g USING spaces s
+    WHERE g.space_id = s.id AND s.organization_id = OLD.organization_id AND g.user_id = OLD.user_id;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS organization_memberships_purge_space_permissions ON organization_memberships;
+CREATE TRIGGER organization_memberships_purge_space_permissions AFTER DELETE ON organization_memberships
+    FOR EACH ROW EXECUTE FUNCTION purge_member_space_permissions();
@@ -37,10 +37,14 @@ func main() {
 
 	fmt.Println("✅ Database connection successful")
 
-	// 读取SQL脚本
-	sqlContent, err := ioutil.ReadFile("scripts/init_db.sql")
+	// 读取SQL脚本；DB_SCHEMA=region 时初始化数据驻留的区域库（只含组织内容表）
+	script := "scripts/init_db.sql"
+	if os.Getenv("DB_SCHEMA") == "region" {
+		script = "scripts/init_region_db.sql"
+	}
+	sqlContent, err := ioutil.ReadFile(script)
 	if err != nil {
-		log.Fatalf("❌ Failed to read init_db.sql: %v", err)
+		log.Fatalf("❌ Failed to read %s: %v", script, err)
 	}
 
 	fmt.Println("📄 Executing database initialization script...")
@@ -52,6 +56,9 @@ func main() {
 	}
 
 	fmt.Println("✅ Database initialization completed successfully!")
+	if script != "scripts/init_db.sql" {
+		return
+	}
 
 	// 验证表是否创建成功
 	tables := []string{"users", "snapshots", "subscription_plans", "user_subscriptions", "ai_credits"}